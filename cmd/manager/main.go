@@ -20,6 +20,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubevirtv1 "kubevirt.io/api/core/v1"
@@ -59,6 +60,10 @@ func main() {
 		clientBurst           int
 		metricsPort           int
 		selectorStr           string
+		parentClusterTimeout  time.Duration
+		ipInstanceListPage    int64
+		connectionFailedAfter time.Duration
+		ignorePrivateSubnets  bool
 	)
 
 	// register flags
@@ -67,6 +72,10 @@ func main() {
 	pflag.IntVar(&clientBurst, "kube-client-burst", 600, "The Burst limit of apiserver client.")
 	pflag.IntVar(&metricsPort, "metrics-port", 9899, "The port to listen on for prometheus metrics.")
 	pflag.StringVar(&selectorStr, "pod-label-selector", "", "The label selector to select specified pods for IPAM.")
+	pflag.DurationVar(&parentClusterTimeout, "parent-cluster-timeout", multicluster.DefaultParentClusterTimeout, "The timeout of mutations against the parent cluster in multi-cluster mode.")
+	pflag.DurationVar(&connectionFailedAfter, "remote-cluster-connection-failed-threshold", multicluster.DefaultConnectionFailedThreshold, "How long the manager of a remote cluster fails continuously before it is reported as connection failed in multi-cluster mode, zero means never reporting.")
+	pflag.BoolVar(&ignorePrivateSubnets, "remote-cluster-ignore-private-subnets", false, "Whether private subnets, which are reserved for local use, are ignored when checking the subnet intersection of remote clusters in multi-cluster mode.")
+	pflag.Int64Var(&ipInstanceListPage, "remote-vtep-ip-instance-list-page-size", 0, "The page size of listing IP instances of a node from apiserver for remote VTEP in multi-cluster mode, zero means listing from cache at once.")
 
 	// parse flags
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
@@ -146,7 +155,11 @@ func main() {
 
 	if feature.MultiClusterEnabled() {
 		if err = multicluster.RegisterToManager(globalContext, mgr, multicluster.RegisterOptions{
-			ConcurrencyMap: controllerConcurrency,
+			ConcurrencyMap:            controllerConcurrency,
+			ParentClusterTimeout:      parentClusterTimeout,
+			IPInstanceListPageSize:    ipInstanceListPage,
+			ConnectionFailedThreshold: connectionFailedAfter,
+			IgnorePrivateSubnets:      ignorePrivateSubnets,
 		}); err != nil {
 			entryLog.Error(err, "unable to register multi-cluster controllers")
 			os.Exit(1)
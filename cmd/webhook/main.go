@@ -17,6 +17,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"os"
@@ -94,8 +95,14 @@ func main() {
 	}
 
 	// create webhooks
+	validatingHandler := validating.NewHandler()
+	if err = validatingHandler.InitIndexers(context.TODO(), mgr.GetFieldIndexer()); err != nil {
+		entryLog.Error(err, "unable to init indexers of validating webhook")
+		os.Exit(1)
+	}
+
 	mgr.GetWebhookServer().Register("/validate", &webhook.Admission{
-		Handler: validating.NewHandler(),
+		Handler: validatingHandler,
 	})
 	mgr.GetWebhookServer().Register("/mutate", &webhook.Admission{
 		Handler: mutating.NewHandler(),
@@ -31,6 +31,23 @@ type NodeInfoSpec struct {
 type NodeInfoStatus struct {
 	// +kubebuilder:validation:Optional
 	UpdateTimestamp metav1.Time `json:"updateTimestamp,omitempty"`
+	// bgpPeers are the bgp session states with the peers of bgp network which this node belongs to.
+	// +kubebuilder:validation:Optional
+	BGPPeers []BGPPeerStatus `json:"bgpPeers,omitempty"`
+}
+
+// BGPPeerStatus is the observed state of bgp session with a peer.
+type BGPPeerStatus struct {
+	// +kubebuilder:validation:Required
+	Address string `json:"address"`
+	// +kubebuilder:validation:Required
+	ASN int32 `json:"asn"`
+	// state is the bgp session state, e.g., idle, connect, active, established.
+	// +kubebuilder:validation:Required
+	State string `json:"state"`
+	// lastError is the last error of configuring the peer.
+	// +kubebuilder:validation:Optional
+	LastError string `json:"lastError,omitempty"`
 }
 
 // +k8s:openapi-gen=true
@@ -43,6 +60,7 @@ type NodeInfoStatus struct {
 // +kubebuilder:printcolumn:name="VTEPIP",type=string,JSONPath=`.spec.vtepInfo.ip`
 // +kubebuilder:printcolumn:name="VTEPMAC",type=string,JSONPath=`.spec.vtepInfo.mac`
 // +kubebuilder:printcolumn:name="VTEPLOCALIPS",type=string,JSONPath=`.spec.vtepInfo.localIPs`
+// +kubebuilder:printcolumn:name="BGPPEERSTATES",type=string,JSONPath=`.status.bgpPeers[*].state`
 
 // NodeInfo is the Schema for the NodeInfos API
 type NodeInfo struct {
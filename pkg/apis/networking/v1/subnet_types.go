@@ -41,6 +41,13 @@ type SubnetStatus struct {
 	Count `json:",inline"`
 	// +kubebuilder:validation:Optional
 	LastAllocatedIP string `json:"lastAllocatedIP"`
+	// ExcludeIPBlocks is the ip blocks excluded from allocation derived from range, which is truncated
+	// if there are too many blocks
+	// +kubebuilder:validation:Optional
+	ExcludeIPBlocks []string `json:"excludeIPBlocks,omitempty"`
+	// ExcludeIPBlockCount is the total number of ip blocks excluded from allocation
+	// +kubebuilder:validation:Optional
+	ExcludeIPBlockCount int32 `json:"excludeIPBlockCount,omitempty"`
 }
 
 // +k8s:openapi-gen=true
@@ -58,6 +65,7 @@ type SubnetStatus struct {
 // +kubebuilder:printcolumn:name="Total",type=integer,JSONPath=`.status.total`
 // +kubebuilder:printcolumn:name="Used",type=integer,JSONPath=`.status.used`
 // +kubebuilder:printcolumn:name="Available",type=integer,JSONPath=`.status.available`
+// +kubebuilder:printcolumn:name="ExcludeIPBlocks",type=integer,JSONPath=`.status.excludeIPBlockCount`,priority=1
 // +kubebuilder:printcolumn:name="NetID",type=integer,JSONPath=`.spec.netID`
 // +kubebuilder:printcolumn:name="Network",type=string,JSONPath=`.spec.network`
 
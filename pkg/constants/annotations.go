@@ -33,5 +33,18 @@ const (
 
 	AnnotationHandledByWebhook = "networking.alibaba.com/handled-by-webhook"
 
+	AnnotationDSCPGateways = "networking.alibaba.com/dscp-gateways"
+
+	AnnotationBGPGateways = "networking.alibaba.com/bgp-gateways"
+
+	AnnotationEgressGateway = "networking.alibaba.com/egress-gateway"
+
+	AnnotationRouteMTU    = "networking.alibaba.com/route-mtu"
+	AnnotationRouteAdvMSS = "networking.alibaba.com/route-advmss"
+
+	AnnotationRouteReconcilePaused = "networking.alibaba.com/route-reconcile-paused"
+
+	AnnotationSubnetDraining = "networking.alibaba.com/subnet-draining"
+
 	AnnotationCalicoPodIPs = "cni.projectcalico.org/podIPs"
 )
@@ -25,6 +25,9 @@ const (
 	RpFilterSysctl  = "/proc/sys/net/ipv4/conf/%s/rp_filter"
 	ArpFilterSysctl = "/proc/sys/net/ipv4/conf/%s/arp_filter"
 
+	ArpAnnounceSysctl = "/proc/sys/net/ipv4/conf/%s/arp_announce"
+	ArpIgnoreSysctl   = "/proc/sys/net/ipv4/conf/%s/arp_ignore"
+
 	IPv4NeighGCThresh1 = "/proc/sys/net/ipv4/neigh/default/gc_thresh1"
 	IPv4NeighGCThresh2 = "/proc/sys/net/ipv4/neigh/default/gc_thresh2"
 	IPv4NeighGCThresh3 = "/proc/sys/net/ipv4/neigh/default/gc_thresh3"
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"sync"
 
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -29,6 +30,7 @@ var _ Checker = &checker{}
 type checker struct {
 	sync.Mutex
 	checkMap map[string]Check
+	clock    clock.PassiveClock
 }
 
 func (c *checker) Register(name string, check Check) error {
@@ -68,7 +70,7 @@ func (c *checker) CheckAll(ctx context.Context, clusterManager ctrl.Manager, opt
 	ret := make(map[string]CheckResult)
 	for name, check := range c.checkMap {
 		// TODO: observe panic to error
-		ret[name] = check.Check(ctx, clusterManager, RawOptions(*options))
+		ret[name] = c.stamp(check.Check(ctx, clusterManager, RawOptions(*options)))
 	}
 
 	return ret, nil
@@ -79,15 +81,29 @@ func (c *checker) Check(ctx context.Context, name string, clusterManager ctrl.Ma
 	defer c.Unlock()
 
 	if check, exist := c.checkMap[name]; exist {
-		return check.Check(ctx, clusterManager, opts...), nil
+		return c.stamp(check.Check(ctx, clusterManager, opts...)), nil
 	}
 
 	return nil, fmt.Errorf("check %s not found", name)
 }
 
+// stamp overrides the time stamp of result built by NewResult or NewResultWithConditions with the clock.
+func (c *checker) stamp(checkResult CheckResult) CheckResult {
+	if r, ok := checkResult.(*result); ok {
+		r.timeStamp = c.clock.Now()
+	}
+	return checkResult
+}
+
 func NewChecker() Checker {
+	return NewCheckerWithClock(clock.RealClock{})
+}
+
+// NewCheckerWithClock builds a checker stamping results with the clock.
+func NewCheckerWithClock(passiveClock clock.PassiveClock) Checker {
 	return &checker{
 		Mutex:    sync.Mutex{},
 		checkMap: make(map[string]Check),
+		clock:    passiveClock,
 	}
 }
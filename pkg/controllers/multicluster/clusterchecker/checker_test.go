@@ -0,0 +1,69 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package clusterchecker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type fakeCheck struct {
+	err error
+}
+
+func (f *fakeCheck) Check(ctx context.Context, clusterManager ctrl.Manager, opts ...Option) CheckResult {
+	return NewResult(f.err)
+}
+
+func TestCheckerStampsResultsWithClock(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := NewCheckerWithClock(fakeClock)
+	if err := c.Register("pass", &fakeCheck{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Register("fail", &fakeCheck{err: errors.New("fail")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// cluster manager is only passed through to checks
+	var clusterManager ctrl.Manager = struct{ ctrl.Manager }{}
+
+	results, err := c.CheckAll(context.Background(), clusterManager)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, result := range results {
+		if !result.TimeStamp().Equal(fakeClock.Now()) {
+			t.Errorf("expect result of %v stamped at %v, but got %v", name, fakeClock.Now(), result.TimeStamp())
+		}
+	}
+
+	fakeClock.Step(time.Minute)
+	result, err := c.Check(context.Background(), "fail", clusterManager)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Succeed() || !result.TimeStamp().Equal(fakeClock.Now()) {
+		t.Errorf("expect failed result stamped at %v, but got %v at %v", fakeClock.Now(), result.Error(),
+			result.TimeStamp())
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	controllerruntime "sigs.k8s.io/controller-runtime"
 )
 
@@ -34,6 +35,14 @@ type CheckResult interface {
 	Succeed() bool
 	Error() error
 	TimeStamp() time.Time
+	Conditions() []Condition
+}
+
+// Condition is a named sub-condition contributed by a check.
+type Condition struct {
+	Name    string
+	Status  metav1.ConditionStatus
+	Message string
 }
 
 type Check interface {
@@ -43,13 +43,27 @@ func (o *OverlayNetID) Check(ctx context.Context, clusterManager ctrl.Manager, o
 		return NewResult(fmt.Errorf("unable to find overlay net ID of remote cluster: %v", err))
 	}
 
-	if *localOverlayNetID == *remoteOverlayNetID {
-		return NewResult(nil)
+	return NewResult(checkOverlayNetIDMatch(localOverlayNetID, remoteOverlayNetID))
+}
+
+// checkOverlayNetIDMatch returns an error if overlay net ids of local and remote cluster are missing or different,
+// which will break the vxlan traffic between clusters.
+func checkOverlayNetIDMatch(localOverlayNetID, remoteOverlayNetID *int32) error {
+	if localOverlayNetID == nil {
+		return fmt.Errorf("overlay net id of local cluster is not specified")
+	}
+
+	if remoteOverlayNetID == nil {
+		return fmt.Errorf("overlay net id of remote cluster is not specified")
+	}
+
+	if *localOverlayNetID != *remoteOverlayNetID {
+		return fmt.Errorf(
+			"overlay net id must match between local cluster %d and remote cluster %d",
+			*localOverlayNetID,
+			*remoteOverlayNetID,
+		)
 	}
 
-	return NewResult(fmt.Errorf(
-		"overlay net id must match between local cluster %d and remote cluster %d",
-		*localOverlayNetID,
-		*remoteOverlayNetID,
-	))
+	return nil
 }
@@ -0,0 +1,43 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package clusterchecker
+
+import (
+	"testing"
+
+	"k8s.io/utils/pointer"
+)
+
+func TestCheckOverlayNetIDMatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		local       *int32
+		remote      *int32
+		expectError bool
+	}{
+		{"matched", pointer.Int32(4), pointer.Int32(4), false},
+		{"mismatched", pointer.Int32(4), pointer.Int32(5), true},
+		{"local not specified", nil, pointer.Int32(4), true},
+		{"remote not specified", pointer.Int32(4), nil, true},
+	}
+
+	for _, test := range tests {
+		if err := checkOverlayNetIDMatch(test.local, test.remote); (err != nil) != test.expectError {
+			t.Errorf("test %v failed, expect error %v but got %v", test.name, test.expectError, err)
+		}
+	}
+}
@@ -16,11 +16,19 @@
 
 package clusterchecker
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
 
 type result struct {
-	err       error
-	timeStamp time.Time
+	err        error
+	timeStamp  time.Time
+	conditions []Condition
 }
 
 func (r *result) Succeed() bool {
@@ -35,9 +43,53 @@ func (r *result) TimeStamp() time.Time {
 	return r.timeStamp
 }
 
+func (r *result) Conditions() []Condition {
+	return r.conditions
+}
+
+// NewResult builds a result stamped with the current time, which is overridden by the clock of checker
+// when the check finishes.
 func NewResult(err error) CheckResult {
 	return &result{
 		err:       err,
 		timeStamp: time.Now(),
 	}
 }
+
+// NewResultWithConditions builds a result from sub-conditions, the result will
+// succeed only if all the sub-conditions are true.
+func NewResultWithConditions(conditions ...Condition) CheckResult {
+	var failedMessages []string
+	for _, condition := range conditions {
+		if condition.Status != metav1.ConditionTrue {
+			failedMessages = append(failedMessages, fmt.Sprintf("%s: %s", condition.Name, condition.Message))
+		}
+	}
+
+	var err error
+	if len(failedMessages) > 0 {
+		err = errors.New(strings.Join(failedMessages, "; "))
+	}
+
+	return &result{
+		err:        err,
+		timeStamp:  time.Now(),
+		conditions: conditions,
+	}
+}
+
+// NewCondition builds a sub-condition, which is false if err is not nil.
+func NewCondition(name string, err error) Condition {
+	if err != nil {
+		return Condition{
+			Name:    name,
+			Status:  metav1.ConditionFalse,
+			Message: err.Error(),
+		}
+	}
+
+	return Condition{
+		Name:   name,
+		Status: metav1.ConditionTrue,
+	}
+}
@@ -23,6 +23,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	multiclusterv1 "github.com/alibaba/hybridnet/pkg/apis/multicluster/v1"
 	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
 	"github.com/alibaba/hybridnet/pkg/constants"
 	clientutils "github.com/alibaba/hybridnet/pkg/controllers/utils"
@@ -30,8 +31,16 @@ import (
 
 const SubnetCheckName = "SubnetNonCross"
 
+const (
+	SubnetLocalSubnetConditionName       = "LocalSubnet"
+	SubnetLocalRemoteSubnetConditionName = "LocalRemoteSubnet"
+)
+
 type Subnet struct {
 	LocalClient client.Client
+
+	// IgnorePrivateSubnets makes private subnets, which are reserved for local use, never block the intersection check.
+	IgnorePrivateSubnets bool
 }
 
 func (o *Subnet) Check(ctx context.Context, clusterManager ctrl.Manager, opts ...Option) CheckResult {
@@ -51,25 +60,64 @@ func (o *Subnet) Check(ctx context.Context, clusterManager ctrl.Manager, opts ..
 		return NewResult(err)
 	}
 
+	var localSubnetErr, localRemoteSubnetErr error
+
 	for i := range subnetsOfCluster.Items {
 		var subnetOfCluster = &subnetsOfCluster.Items[i]
+		if o.IgnorePrivateSubnets && networkingv1.IsPrivateSubnet(subnetOfCluster) {
+			continue
+		}
 
 		for j := range localSubnets.Items {
 			var localSubnet = &localSubnets.Items[j]
-			if networkingv1.Intersect(&subnetOfCluster.Spec.Range, &localSubnet.Spec.Range) {
-				return NewResult(fmt.Errorf("subnet %s in cluster intersect with local subnet %s", subnetOfCluster.Name, localSubnet.Name))
+			if o.IgnorePrivateSubnets && networkingv1.IsPrivateSubnet(localSubnet) {
+				continue
+			}
+			if localSubnetErr == nil && networkingv1.Intersect(&subnetOfCluster.Spec.Range, &localSubnet.Spec.Range) {
+				localSubnetErr = fmt.Errorf("subnet %s in cluster intersect with local subnet %s", subnetOfCluster.Name, localSubnet.Name)
 			}
 		}
 
 		for k := range localRemoteSubnets.Items {
 			var localRemoteSubnet = &localRemoteSubnets.Items[k]
-			var loopback = localRemoteSubnet.Labels[constants.LabelCluster] == options.ClusterName &&
-				localRemoteSubnet.Labels[constants.LabelSubnet] == subnetOfCluster.Name
-			if !loopback && networkingv1.Intersect(&subnetOfCluster.Spec.Range, &localRemoteSubnet.Spec.Range) {
-				return NewResult(fmt.Errorf("subnet %s in cluster intersect with local remote subnet %s", subnetOfCluster.Name, localRemoteSubnet.Name))
+			if localRemoteSubnetErr == nil && !isLoopbackRemoteSubnet(localRemoteSubnet, options.ClusterName, subnetOfCluster.Name) && networkingv1.Intersect(&subnetOfCluster.Spec.Range, &localRemoteSubnet.Spec.Range) {
+				localRemoteSubnetErr = fmt.Errorf("subnet %s in cluster intersect with local remote subnet %s", subnetOfCluster.Name, localRemoteSubnet.Name)
 			}
 		}
 	}
 
-	return NewResult(nil)
+	return NewResultWithConditions(
+		NewCondition(SubnetLocalSubnetConditionName, localSubnetErr),
+		NewCondition(SubnetLocalRemoteSubnetConditionName, localRemoteSubnetErr),
+	)
+}
+
+// FindConflictingRemoteSubnets returns the local RemoteSubnets intersecting with a specified local subnet, the
+// RemoteSubnet exported from the subnet itself, which is recognized by the cluster name option, will be excluded.
+func (o *Subnet) FindConflictingRemoteSubnets(ctx context.Context, localSubnet *networkingv1.Subnet, opts ...Option) ([]*multiclusterv1.RemoteSubnet, error) {
+	options := ToOptions(opts...)
+
+	localRemoteSubnets, err := clientutils.ListRemoteSubnets(ctx, o.LocalClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote subnets: %v", err)
+	}
+
+	var conflictingRemoteSubnets []*multiclusterv1.RemoteSubnet
+	for i := range localRemoteSubnets.Items {
+		var localRemoteSubnet = &localRemoteSubnets.Items[i]
+		if isLoopbackRemoteSubnet(localRemoteSubnet, options.ClusterName, localSubnet.Name) {
+			continue
+		}
+		if networkingv1.Intersect(&localSubnet.Spec.Range, &localRemoteSubnet.Spec.Range) {
+			conflictingRemoteSubnets = append(conflictingRemoteSubnets, localRemoteSubnet)
+		}
+	}
+
+	return conflictingRemoteSubnets, nil
+}
+
+// isLoopbackRemoteSubnet returns true if the remote subnet is exported from the specified subnet of the specified cluster.
+func isLoopbackRemoteSubnet(remoteSubnet *multiclusterv1.RemoteSubnet, clusterName, subnetName string) bool {
+	return remoteSubnet.Labels[constants.LabelCluster] == clusterName &&
+		remoteSubnet.Labels[constants.LabelSubnet] == subnetName
 }
@@ -0,0 +1,240 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package clusterchecker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	multiclusterv1 "github.com/alibaba/hybridnet/pkg/apis/multicluster/v1"
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+	"github.com/alibaba/hybridnet/pkg/constants"
+)
+
+func newRemoteSubnet(name, clusterName, subnetName, cidr string) *multiclusterv1.RemoteSubnet {
+	return &multiclusterv1.RemoteSubnet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				constants.LabelCluster: clusterName,
+				constants.LabelSubnet:  subnetName,
+			},
+		},
+		Spec: multiclusterv1.RemoteSubnetSpec{
+			Range: networkingv1.AddressRange{
+				Version: networkingv1.IPv4,
+				CIDR:    cidr,
+			},
+			ClusterName: clusterName,
+		},
+	}
+}
+
+func TestFindConflictingRemoteSubnets(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := multiclusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newRemoteSubnet("cluster1.subnet1", "cluster1", "subnet1", "10.0.0.0/24"),
+		newRemoteSubnet("cluster2.subnet2", "cluster2", "subnet2", "10.0.0.128/25"),
+		newRemoteSubnet("cluster2.subnet3", "cluster2", "subnet3", "10.0.1.0/24"),
+		newRemoteSubnet("local.subnet1", "local", "subnet1", "10.0.0.0/24"),
+	).Build()
+
+	localSubnet := &networkingv1.Subnet{
+		ObjectMeta: metav1.ObjectMeta{Name: "subnet1"},
+		Spec: networkingv1.SubnetSpec{
+			Range: networkingv1.AddressRange{
+				Version: networkingv1.IPv4,
+				CIDR:    "10.0.0.0/24",
+			},
+		},
+	}
+
+	checker := &Subnet{LocalClient: c}
+	conflictingRemoteSubnets, err := checker.FindConflictingRemoteSubnets(context.Background(), localSubnet,
+		ClusterName("local"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, remoteSubnet := range conflictingRemoteSubnets {
+		names = append(names, remoteSubnet.Name)
+	}
+	if len(names) != 2 || names[0] != "cluster1.subnet1" || names[1] != "cluster2.subnet2" {
+		t.Errorf("expect conflicting remote subnets [cluster1.subnet1 cluster2.subnet2], but got %v", names)
+	}
+}
+
+type fakeClusterManager struct {
+	ctrl.Manager
+	apiReader client.Reader
+}
+
+func (f *fakeClusterManager) GetAPIReader() client.Reader {
+	return f.apiReader
+}
+
+func newSubnet(name, cidr string, private bool) *networkingv1.Subnet {
+	return &networkingv1.Subnet{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: networkingv1.SubnetSpec{
+			Range: networkingv1.AddressRange{
+				Version: networkingv1.IPv4,
+				CIDR:    cidr,
+			},
+			Config: &networkingv1.SubnetConfig{
+				Private: pointer.Bool(private),
+			},
+		},
+	}
+}
+
+func TestSubnetCheckIgnorePrivateSubnets(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := multiclusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	localClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newSubnet("reserved", "10.0.0.0/24", true),
+		newSubnet("subnet2", "10.0.1.0/24", false),
+	).Build()
+	clusterManager := &fakeClusterManager{
+		apiReader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			newSubnet("subnet1", "10.0.0.0/24", false),
+		).Build(),
+	}
+
+	tests := []struct {
+		name                 string
+		ignorePrivateSubnets bool
+		succeed              bool
+		localSubnetStatus    metav1.ConditionStatus
+	}{
+		{
+			name:                 "check all subnets by default",
+			ignorePrivateSubnets: false,
+			succeed:              false,
+			localSubnetStatus:    metav1.ConditionFalse,
+		},
+		{
+			name:                 "ignore private subnets",
+			ignorePrivateSubnets: true,
+			succeed:              true,
+			localSubnetStatus:    metav1.ConditionTrue,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checker := &Subnet{LocalClient: localClient, IgnorePrivateSubnets: test.ignorePrivateSubnets}
+			result := checker.Check(context.Background(), clusterManager, ClusterName("cluster1"))
+			if result.Succeed() != test.succeed {
+				t.Errorf("expect check succeed %v, but got %v: %v", test.succeed, result.Succeed(), result.Error())
+			}
+
+			// only the conflict with local subnets is reported, by its own sub-condition
+			expectedStatus := map[string]metav1.ConditionStatus{
+				SubnetLocalSubnetConditionName:       test.localSubnetStatus,
+				SubnetLocalRemoteSubnetConditionName: metav1.ConditionTrue,
+			}
+			if len(result.Conditions()) != len(expectedStatus) {
+				t.Fatalf("expect %v sub-conditions, but got %+v", len(expectedStatus), result.Conditions())
+			}
+			for _, condition := range result.Conditions() {
+				if condition.Status != expectedStatus[condition.Name] {
+					t.Errorf("expect sub-condition %v to be %v, but got %+v", condition.Name,
+						expectedStatus[condition.Name], condition)
+				}
+			}
+		})
+	}
+}
+
+func TestNewResultWithConditions(t *testing.T) {
+	tests := []struct {
+		name            string
+		conditions      []Condition
+		succeed         bool
+		expectedMessage string
+	}{
+		{
+			name:       "no sub-conditions",
+			conditions: nil,
+			succeed:    true,
+		},
+		{
+			name: "all sub-conditions pass",
+			conditions: []Condition{
+				NewCondition("A", nil),
+				NewCondition("B", nil),
+			},
+			succeed: true,
+		},
+		{
+			name: "some sub-conditions fail",
+			conditions: []Condition{
+				NewCondition("A", errors.New("a fails")),
+				NewCondition("B", nil),
+				NewCondition("C", errors.New("c fails")),
+			},
+			succeed:         false,
+			expectedMessage: "A: a fails; C: c fails",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := NewResultWithConditions(test.conditions...)
+			if result.Succeed() != test.succeed {
+				t.Fatalf("expect succeed %v, but got %v", test.succeed, result.Succeed())
+			}
+
+			if !test.succeed && result.Error().Error() != test.expectedMessage {
+				t.Errorf("expect error %q, but got %q", test.expectedMessage, result.Error())
+			}
+
+			if len(result.Conditions()) != len(test.conditions) {
+				t.Errorf("expect sub-conditions %+v, but got %+v", test.conditions, result.Conditions())
+			}
+
+			if result.TimeStamp().IsZero() {
+				t.Errorf("expect result to be stamped when built")
+			}
+		})
+	}
+
+	if condition := NewCondition("A", errors.New("a fails")); condition.Status != metav1.ConditionFalse ||
+		condition.Message != "a fails" {
+		t.Errorf("expect a false sub-condition with error message, but got %+v", condition)
+	}
+}
@@ -0,0 +1,43 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/alibaba/hybridnet/pkg/managerruntime"
+)
+
+// RemoteClusterDebugPath is the path on metrics server to inspect the manager runtimes of remote clusters.
+const RemoteClusterDebugPath = "/debug/remote-clusters"
+
+// newRemoteClusterDebugHandler serves the snapshot of manager runtimes of remote clusters as json, it helps
+// diagnose why a remote cluster is not reconciling.
+func newRemoteClusterDebugHandler(daemonHub managerruntime.DaemonHub) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(daemonHub.Snapshot()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -28,7 +28,17 @@ import (
 )
 
 type RegisterOptions struct {
-	ConcurrencyMap map[string]int
+	ConcurrencyMap       map[string]int
+	ParentClusterTimeout time.Duration
+
+	// page size of listing IPInstances of a node for remote VTEP, zero means no paging
+	IPInstanceListPageSize int64
+
+	// how long a remote cluster fails to connect before it is reported, zero means never reporting
+	ConnectionFailedThreshold time.Duration
+
+	// if private subnets never block the subnet intersection check of remote clusters
+	IgnorePrivateSubnets bool
 }
 
 func RegisterToManager(ctx context.Context, mgr manager.Manager, options RegisterOptions) error {
@@ -37,6 +47,7 @@ func RegisterToManager(ctx context.Context, mgr manager.Manager, options Registe
 	}
 
 	clusterStatusCheckChan := make(chan string, 10)
+	allClustersCheckChan := make(chan struct{}, 1)
 
 	uuidMutex, err := NewUUIDMutexFromClient(ctx, mgr.GetClient())
 	if err != nil {
@@ -45,7 +56,11 @@ func RegisterToManager(ctx context.Context, mgr manager.Manager, options Registe
 
 	daemonHub := managerruntime.NewDaemonHub(ctx)
 
-	clusterStatusChecker, err := InitClusterStatusChecker(ctx, mgr)
+	if err = mgr.AddMetricsExtraHandler(RemoteClusterDebugPath, newRemoteClusterDebugHandler(daemonHub)); err != nil {
+		return fmt.Errorf("unable to add remote cluster debug handler: %v", err)
+	}
+
+	clusterStatusChecker, err := InitClusterStatusChecker(ctx, mgr, options.IgnorePrivateSubnets)
 	if err != nil {
 		return fmt.Errorf("unable to init cluster status checker: %v", err)
 	}
@@ -66,6 +81,8 @@ func RegisterToManager(ctx context.Context, mgr manager.Manager, options Registe
 		UUIDMutex:              uuidMutex,
 		DaemonHub:              daemonHub,
 		LocalManager:           mgr,
+		ParentClusterTimeout:   options.ParentClusterTimeout,
+		IPInstanceListPageSize: options.IPInstanceListPageSize,
 		ClusterStatusCheckChan: clusterStatusCheckChan,
 		ControllerConcurrency:  concurrency.ControllerConcurrency(options.ConcurrencyMap[ControllerRemoteCluster]),
 	}).SetupWithManager(mgr); err != nil {
@@ -73,18 +90,24 @@ func RegisterToManager(ctx context.Context, mgr manager.Manager, options Registe
 	}
 
 	if err = mgr.Add(&RemoteClusterStatusChecker{
-		Client:                 mgr.GetClient(),
-		Logger:                 mgr.GetLogger().WithName("checker").WithName(CheckerRemoteClusterStatus),
-		CheckPeriod:            30 * time.Second,
-		DaemonHub:              daemonHub,
-		Checker:                clusterStatusChecker,
-		ClusterStatusCheckChan: clusterStatusCheckChan,
-		Recorder:               mgr.GetEventRecorderFor(CheckerRemoteClusterStatus + "Checker"),
-		Concurrency:            concurrency.ControllerConcurrency(options.ConcurrencyMap[CheckerRemoteClusterStatus]),
+		Client:                    mgr.GetClient(),
+		Logger:                    mgr.GetLogger().WithName("checker").WithName(CheckerRemoteClusterStatus),
+		CheckPeriod:               30 * time.Second,
+		ConnectionFailedThreshold: options.ConnectionFailedThreshold,
+		DaemonHub:                 daemonHub,
+		Checker:                   clusterStatusChecker,
+		ClusterStatusCheckChan:    clusterStatusCheckChan,
+		AllClustersCheckChan:      allClustersCheckChan,
+		Recorder:                  mgr.GetEventRecorderFor(CheckerRemoteClusterStatus + "Checker"),
+		Concurrency:               concurrency.ControllerConcurrency(options.ConcurrencyMap[CheckerRemoteClusterStatus]),
 	}); err != nil {
 		return fmt.Errorf("unable to inject checker %s: %v", CheckerRemoteClusterStatus, err)
 	}
 
+	if err = registerOverlayNetIDChangeTrigger(ctx, mgr, allClustersCheckChan); err != nil {
+		return fmt.Errorf("unable to register overlay net id change trigger: %v", err)
+	}
+
 	if err = (&GlobalServiceReconciler{
 		Context:               ctx,
 		Client:                mgr.GetClient(),
@@ -0,0 +1,80 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+// registerOverlayNetIDChangeTrigger makes all the remote clusters checked immediately once the local overlay net id
+// changes, rather than waiting for the next periodic check.
+func registerOverlayNetIDChangeTrigger(ctx context.Context, mgr manager.Manager, allClustersCheckChan chan<- struct{}) error {
+	informer, err := mgr.GetCache().GetInformer(ctx, &networkingv1.Network{})
+	if err != nil {
+		return fmt.Errorf("unable to get network informer: %v", err)
+	}
+
+	trigger := func() {
+		select {
+		case allClustersCheckChan <- struct{}{}:
+		default:
+		}
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if network, ok := obj.(*networkingv1.Network); ok && overlayNetIDChanged(nil, network) {
+				trigger()
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNetwork, oldOK := oldObj.(*networkingv1.Network)
+			newNetwork, newOK := newObj.(*networkingv1.Network)
+			if oldOK && newOK && overlayNetIDChanged(oldNetwork, newNetwork) {
+				trigger()
+			}
+		},
+	})
+	return nil
+}
+
+// overlayNetIDChanged returns true if the overlay net id carried by network changes, a nil old network means
+// network is newly added.
+func overlayNetIDChanged(oldNetwork, newNetwork *networkingv1.Network) bool {
+	oldNetID, newNetID := overlayNetIDOf(oldNetwork), overlayNetIDOf(newNetwork)
+	if oldNetID == nil || newNetID == nil {
+		return oldNetID != newNetID || isOverlayNetwork(oldNetwork) != isOverlayNetwork(newNetwork)
+	}
+	return *oldNetID != *newNetID
+}
+
+func overlayNetIDOf(network *networkingv1.Network) *int32 {
+	if !isOverlayNetwork(network) {
+		return nil
+	}
+	return network.Spec.NetID
+}
+
+func isOverlayNetwork(network *networkingv1.Network) bool {
+	return network != nil && networkingv1.GetNetworkType(network) == networkingv1.NetworkTypeOverlay
+}
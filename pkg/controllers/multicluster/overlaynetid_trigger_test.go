@@ -0,0 +1,156 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/workqueue"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	multiclusterv1 "github.com/alibaba/hybridnet/pkg/apis/multicluster/v1"
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestOverlayNetIDChanged(t *testing.T) {
+	newNetwork := func(networkType networkingv1.NetworkType, netID *int32) *networkingv1.Network {
+		return &networkingv1.Network{
+			ObjectMeta: metav1.ObjectMeta{Name: "network"},
+			Spec: networkingv1.NetworkSpec{
+				Type:  networkType,
+				NetID: netID,
+			},
+		}
+	}
+	netID4, netID5 := int32(4), int32(5)
+
+	tests := []struct {
+		name       string
+		oldNetwork *networkingv1.Network
+		newNetwork *networkingv1.Network
+		expected   bool
+	}{
+		{
+			name:       "overlay network added",
+			newNetwork: newNetwork(networkingv1.NetworkTypeOverlay, &netID4),
+			expected:   true,
+		},
+		{
+			name:       "underlay network added",
+			newNetwork: newNetwork(networkingv1.NetworkTypeUnderlay, &netID4),
+			expected:   false,
+		},
+		{
+			name:       "overlay net id changed",
+			oldNetwork: newNetwork(networkingv1.NetworkTypeOverlay, &netID4),
+			newNetwork: newNetwork(networkingv1.NetworkTypeOverlay, &netID5),
+			expected:   true,
+		},
+		{
+			name:       "overlay net id unchanged",
+			oldNetwork: newNetwork(networkingv1.NetworkTypeOverlay, &netID4),
+			newNetwork: newNetwork(networkingv1.NetworkTypeOverlay, &netID4),
+			expected:   false,
+		},
+		{
+			name:       "overlay net id unset",
+			oldNetwork: newNetwork(networkingv1.NetworkTypeOverlay, &netID4),
+			newNetwork: newNetwork(networkingv1.NetworkTypeOverlay, nil),
+			expected:   true,
+		},
+		{
+			name:       "underlay net id changed",
+			oldNetwork: newNetwork(networkingv1.NetworkTypeUnderlay, &netID4),
+			newNetwork: newNetwork(networkingv1.NetworkTypeUnderlay, &netID5),
+			expected:   false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if changed := overlayNetIDChanged(test.oldNetwork, test.newNetwork); changed != test.expected {
+				t.Errorf("expect changed %v, but got %v", test.expected, changed)
+			}
+		})
+	}
+}
+
+// recordingQueue records the cluster names added to queue.
+type recordingQueue struct {
+	workqueue.RateLimitingInterface
+	added chan interface{}
+}
+
+func (q *recordingQueue) Add(item interface{}) {
+	q.added <- item
+	q.RateLimitingInterface.Add(item)
+}
+
+func TestAllClustersCheckWithoutWaitingForTick(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := multiclusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	queue := &recordingQueue{
+		RateLimitingInterface: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		added:                 make(chan interface{}, 10),
+	}
+	allClustersCheckChan := make(chan struct{}, 1)
+
+	checker := &RemoteClusterStatusChecker{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&multiclusterv1.RemoteCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster1"}},
+			&multiclusterv1.RemoteCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster2"}},
+		).Build(),
+		Logger:               logr.Discard(),
+		CheckPeriod:          time.Hour,
+		AllClustersCheckChan: allClustersCheckChan,
+		Queue:                queue,
+		Clock:                clocktesting.NewFakeClock(time.Now()),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = checker.Start(ctx)
+	}()
+
+	// the fake clock never ticks, clusters are enqueued only by the trigger
+	allClustersCheckChan <- struct{}{}
+
+	enqueued := map[interface{}]bool{}
+	timeout := time.After(5 * time.Second)
+	for len(enqueued) < 2 {
+		select {
+		case item := <-queue.added:
+			enqueued[item] = true
+		case <-timeout:
+			t.Fatalf("expect all clusters to be enqueued, but got %v", enqueued)
+		}
+	}
+
+	if !enqueued["cluster1"] || !enqueued["cluster2"] {
+		t.Errorf("expect cluster1 and cluster2 to be enqueued, but got %v", enqueued)
+	}
+}
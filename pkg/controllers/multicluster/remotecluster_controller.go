@@ -19,6 +19,7 @@ package multicluster
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
@@ -59,6 +60,11 @@ type RemoteClusterReconciler struct {
 
 	LocalManager manager.Manager
 
+	ParentClusterTimeout time.Duration
+
+	// IPInstanceListPageSize is the page size of listing IPInstances of a node for remote VTEP, zero means no paging
+	IPInstanceListPageSize int64
+
 	concurrency.ControllerConcurrency
 }
 
@@ -222,24 +228,30 @@ func (r *RemoteClusterReconciler) constructClusterManagerRuntime(remoteCluster *
 
 			// inject RemoteSubnetReconciler
 			if err = (&RemoteSubnetReconciler{
-				Client:              mgr.GetClient(),
-				ClusterName:         shadowRemoteCluster.Name,
-				ParentCluster:       r.LocalManager,
-				ParentClusterObject: shadowRemoteCluster,
-				SubnetSet:           subnetSet,
+				Client:               mgr.GetClient(),
+				ClusterName:          shadowRemoteCluster.Name,
+				ParentCluster:        r.LocalManager,
+				ParentClusterObject:  shadowRemoteCluster,
+				ParentClusterTimeout: r.ParentClusterTimeout,
+				SubnetSet:            subnetSet,
 			}).SetupWithManager(mgr); err != nil {
 				return wrapError("unable to inject remote subnet reconciler", err)
 			}
 
 			// inject RemoteVtepReconciler
 			if err = (&RemoteVtepReconciler{
-				Context:             r.Context,
-				Client:              mgr.GetClient(),
-				ClusterName:         shadowRemoteCluster.Name,
-				ParentCluster:       r.LocalManager,
-				ParentClusterObject: shadowRemoteCluster,
-				SubnetSet:           subnetSet,
-				EventTrigger:        make(chan event.GenericEvent, 100),
+				Context:              r.Context,
+				Client:               mgr.GetClient(),
+				ClusterName:          shadowRemoteCluster.Name,
+				ParentCluster:        r.LocalManager,
+				ParentClusterObject:  shadowRemoteCluster,
+				ParentClusterTimeout: r.ParentClusterTimeout,
+				SubnetSet:            subnetSet,
+				EventTrigger:         make(chan event.GenericEvent, 100),
+				Recorder:             r.Recorder,
+
+				APIReader:              mgr.GetAPIReader(),
+				IPInstanceListPageSize: r.IPInstanceListPageSize,
 			}).SetupWithManager(mgr); err != nil {
 				return wrapError("unable to inject remote vtep reconciler", err)
 			}
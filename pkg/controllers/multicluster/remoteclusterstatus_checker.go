@@ -26,10 +26,12 @@ import (
 	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
@@ -45,6 +47,7 @@ const CheckerRemoteClusterStatus = "RemoteClusterStatus"
 
 const (
 	ConditionDaemonRegistered = "DaemonRegistered"
+	ConditionDaemonConnected  = "DaemonConnected"
 	ConditionCheckerExecuted  = "CheckerExecuted"
 )
 
@@ -57,15 +60,28 @@ type RemoteClusterStatusChecker struct {
 	CheckPeriod            time.Duration
 	Checker                clusterchecker.Checker
 	ClusterStatusCheckChan <-chan string
+	AllClustersCheckChan   <-chan struct{}
 	Queue                  workqueue.RateLimitingInterface
 	DaemonHub              managerruntime.DaemonHub
 
 	Concurrency concurrency.ControllerConcurrency
+
+	// ConnectionFailedThreshold is how long the daemon of a cluster fails continuously before it is reported as
+	// connection failed, zero means never reporting
+	ConnectionFailedThreshold time.Duration
+
+	// Clock is used for all the timing of checker, real clock will be used if it is nil
+	Clock clock.WithTicker
 }
 
 func (r *RemoteClusterStatusChecker) Start(ctx context.Context) error {
 	r.Logger.Info("remote cluster status checker is starting")
 
+	// initialize clock if nil
+	if r.Clock == nil {
+		r.Clock = clock.RealClock{}
+	}
+
 	// initialize work queue if nil
 	if r.Queue == nil {
 		r.Queue = workqueue.NewNamedRateLimitingQueue(
@@ -96,15 +112,18 @@ func (r *RemoteClusterStatusChecker) Start(ctx context.Context) error {
 		}()
 	}
 
-	ticker := time.NewTicker(r.CheckPeriod)
+	ticker := r.Clock.NewTicker(r.CheckPeriod)
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			r.Logger.V(1).Info("all clusters check from cronjob")
 			r.enqueueAll(ctx)
 		case clusterName := <-r.ClusterStatusCheckChan:
 			r.Logger.Info("single cluster check event from channel", "cluster", clusterName)
 			r.enqueue(clusterName)
+		case <-r.AllClustersCheckChan:
+			r.Logger.Info("all clusters check event from channel")
+			r.enqueueAll(ctx)
 		case <-ctx.Done():
 			ticker.Stop()
 			r.Logger.Info("remote cluster status checker is stopping, waiting for all workers to finish")
@@ -159,9 +178,9 @@ func (r *RemoteClusterStatusChecker) enqueue(name string) {
 }
 
 func (r *RemoteClusterStatusChecker) checkClusterStatus(ctx context.Context, name string) error {
-	start := time.Now()
+	start := r.Clock.Now()
 	defer func() {
-		metrics.RemoteClusterStatusCheckDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		metrics.RemoteClusterStatusCheckDuration.WithLabelValues(name).Observe(r.Clock.Since(start).Seconds())
 	}()
 
 	remoteCluster, err := utils.GetRemoteCluster(ctx, r, name)
@@ -179,28 +198,37 @@ func (r *RemoteClusterStatusChecker) checkClusterStatus(ctx context.Context, nam
 	}
 
 	_, err = controllerutil.CreateOrPatch(ctx, r, remoteCluster, func() (err error) {
+		now := r.Clock.Now()
+
 		var managerRuntime managerruntime.ManagerRuntime
 		if managerRuntime, err = r.getManagerRuntimeByDaemonID(daemonID); err != nil {
 			remoteCluster.Status.State = multiclusterv1.ClusterOffline
-			fillCondition(&remoteCluster.Status, &metav1.Condition{
+			fillCondition(&remoteCluster.Status, now, &metav1.Condition{
 				Type:               ConditionDaemonRegistered,
 				Status:             metav1.ConditionFalse,
 				ObservedGeneration: remoteCluster.Generation,
-				LastTransitionTime: metav1.Now(),
 				Reason:             "NotFound",
 				Message:            err.Error(),
 			})
 			return nil
 		}
+		managerRuntime.RecordChecked(now)
 
-		fillCondition(&remoteCluster.Status, &metav1.Condition{
+		fillCondition(&remoteCluster.Status, now, &metav1.Condition{
 			Type:               ConditionDaemonRegistered,
 			Status:             metav1.ConditionTrue,
 			ObservedGeneration: remoteCluster.Generation,
-			LastTransitionTime: metav1.Now(),
 			Reason:             "Registered",
 		})
 
+		if condition := daemonConnectedCondition(managerRuntime.Status(), now, r.ConnectionFailedThreshold,
+			remoteCluster.Generation); condition != nil {
+			if daemonConnectionNewlyFailed(remoteCluster.Status.Conditions, condition) {
+				r.Recorder.Event(remoteCluster, corev1.EventTypeWarning, condition.Reason, condition.Message)
+			}
+			fillCondition(&remoteCluster.Status, now, condition)
+		}
+
 		defer func() {
 			// TODO: more cases
 			switch remoteCluster.Status.State {
@@ -224,22 +252,20 @@ func (r *RemoteClusterStatusChecker) checkClusterStatus(ctx context.Context, nam
 		results, err := r.Checker.CheckAll(ctx, managerRuntime.Manager(), clusterchecker.ClusterName(name))
 		if err != nil {
 			remoteCluster.Status.State = multiclusterv1.ClusterNotReady
-			fillCondition(&remoteCluster.Status, &metav1.Condition{
+			fillCondition(&remoteCluster.Status, now, &metav1.Condition{
 				Type:               ConditionCheckerExecuted,
 				Status:             metav1.ConditionFalse,
 				ObservedGeneration: remoteCluster.Generation,
-				LastTransitionTime: metav1.Now(),
 				Reason:             "CheckerRunFail",
 				Message:            err.Error(),
 			})
 			return nil
 		}
 
-		fillCondition(&remoteCluster.Status, &metav1.Condition{
+		fillCondition(&remoteCluster.Status, now, &metav1.Condition{
 			Type:               ConditionCheckerExecuted,
 			Status:             metav1.ConditionTrue,
 			ObservedGeneration: remoteCluster.Generation,
-			LastTransitionTime: metav1.Now(),
 			Reason:             "CheckerRunSucceed",
 		})
 
@@ -249,7 +275,6 @@ func (r *RemoteClusterStatusChecker) checkClusterStatus(ctx context.Context, nam
 				Type:               checkName,
 				Status:             metav1.ConditionTrue,
 				ObservedGeneration: remoteCluster.Generation,
-				LastTransitionTime: metav1.Time{Time: result.TimeStamp()},
 				Reason:             "CheckPass",
 			}
 
@@ -260,7 +285,13 @@ func (r *RemoteClusterStatusChecker) checkClusterStatus(ctx context.Context, nam
 				condition.Message = result.Error().Error()
 			}
 
-			fillCondition(&remoteCluster.Status, condition)
+			fillCondition(&remoteCluster.Status, now, condition)
+
+			// sub-conditions are named with the check name as prefix
+			for _, subCondition := range result.Conditions() {
+				fillCondition(&remoteCluster.Status, now, subConditionOf(checkName, subCondition,
+					remoteCluster.Generation))
+			}
 		}
 
 		if allCheckPass {
@@ -293,13 +324,56 @@ func (r *RemoteClusterStatusChecker) getManagerRuntimeByDaemonID(daemonID manage
 	return mr, nil
 }
 
-func fillCondition(status *multiclusterv1.RemoteClusterStatus, condition *metav1.Condition) {
-	if len(status.Conditions) == 0 {
-		status.Conditions = []metav1.Condition{
-			*condition,
-		}
+// daemonConnectedCondition reports a daemon failing for longer than threshold as connection failed, nil will be
+// returned if threshold is zero.
+func daemonConnectedCondition(status managerruntime.DaemonStatus, now time.Time, threshold time.Duration,
+	generation int64) *metav1.Condition {
+	if threshold == 0 {
+		return nil
 	}
 
+	condition := &metav1.Condition{
+		Type:               ConditionDaemonConnected,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             "Connected",
+	}
+
+	if failingSince := status.FailingSince(); !failingSince.IsZero() && now.Sub(failingSince) > threshold {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ConnectionFailed"
+		condition.Message = fmt.Sprintf("daemon has been failing since %v after %d restarts: %s",
+			failingSince.Format(time.RFC3339), status.RestartCount(), status.TerminationMessage())
+	}
+	return condition
+}
+
+// daemonConnectionNewlyFailed checks if daemon connected condition turns to false from existing conditions, a
+// daemon failing continuously should be reported only once.
+func daemonConnectionNewlyFailed(conditions []metav1.Condition, condition *metav1.Condition) bool {
+	return condition.Status == metav1.ConditionFalse && !meta.IsStatusConditionFalse(conditions, condition.Type)
+}
+
+func subConditionOf(checkName string, subCondition clusterchecker.Condition, generation int64) *metav1.Condition {
+	condition := &metav1.Condition{
+		Type:               checkName + subCondition.Name,
+		Status:             subCondition.Status,
+		ObservedGeneration: generation,
+		Reason:             "CheckPass",
+		Message:            subCondition.Message,
+	}
+
+	if subCondition.Status != metav1.ConditionTrue {
+		condition.Reason = "CheckFail"
+	}
+	return condition
+}
+
+// fillCondition adds or updates the condition of the same type in status, last transition time of condition
+// is set to now only when it is added or its status changes.
+func fillCondition(status *multiclusterv1.RemoteClusterStatus, now time.Time, condition *metav1.Condition) {
+	condition.LastTransitionTime = metav1.NewTime(now)
+
 	idx := -1
 	for i := range status.Conditions {
 		if status.Conditions[i].Type == condition.Type {
@@ -311,6 +385,9 @@ func fillCondition(status *multiclusterv1.RemoteClusterStatus, condition *metav1
 	if idx < 0 {
 		status.Conditions = append(status.Conditions, *condition)
 	} else {
+		if status.Conditions[idx].Status == condition.Status {
+			condition.LastTransitionTime = status.Conditions[idx].LastTransitionTime
+		}
 		status.Conditions[idx] = *condition
 	}
 }
@@ -0,0 +1,211 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	multiclusterv1 "github.com/alibaba/hybridnet/pkg/apis/multicluster/v1"
+	"github.com/alibaba/hybridnet/pkg/controllers/multicluster/clusterchecker"
+)
+
+func TestFillConditionLastTransitionTime(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	status := &multiclusterv1.RemoteClusterStatus{}
+
+	newCondition := func(conditionType string, conditionStatus metav1.ConditionStatus,
+		message string) *metav1.Condition {
+		return &metav1.Condition{
+			Type:    conditionType,
+			Status:  conditionStatus,
+			Message: message,
+		}
+	}
+
+	firstTransitionTime := fakeClock.Now()
+	fillCondition(status, fakeClock.Now(), newCondition(ConditionCheckerExecuted, metav1.ConditionTrue, ""))
+
+	// status is not changed, last transition time should be kept even if message changes
+	fakeClock.Step(time.Minute)
+	fillCondition(status, fakeClock.Now(), newCondition(ConditionCheckerExecuted, metav1.ConditionTrue, "again"))
+
+	if len(status.Conditions) != 1 {
+		t.Fatalf("expect 1 condition but got %v", len(status.Conditions))
+	}
+	if !status.Conditions[0].LastTransitionTime.Time.Equal(firstTransitionTime) ||
+		status.Conditions[0].Message != "again" {
+		t.Errorf("expect last transition time %v with message updated but got %+v", firstTransitionTime,
+			status.Conditions[0])
+	}
+
+	// a new condition transitions now
+	fakeClock.Step(time.Minute)
+	fillCondition(status, fakeClock.Now(), newCondition(ConditionDaemonRegistered, metav1.ConditionTrue, ""))
+
+	if len(status.Conditions) != 2 || !status.Conditions[1].LastTransitionTime.Time.Equal(fakeClock.Now()) {
+		t.Errorf("expect new condition with last transition time %v but got %+v", fakeClock.Now(), status.Conditions)
+	}
+
+	// status is changed, last transition time should be updated
+	fakeClock.Step(time.Minute)
+	fillCondition(status, fakeClock.Now(), newCondition(ConditionCheckerExecuted, metav1.ConditionFalse, ""))
+
+	if !status.Conditions[0].LastTransitionTime.Time.Equal(fakeClock.Now()) {
+		t.Errorf("expect last transition time %v but got %v", fakeClock.Now(), status.Conditions[0].LastTransitionTime)
+	}
+}
+
+type fakeDaemonStatus struct {
+	restartCount       int32
+	terminationMessage string
+	failingSince       time.Time
+}
+
+func (f *fakeDaemonStatus) Running() bool              { return true }
+func (f *fakeDaemonStatus) RestartCount() int32        { return f.restartCount }
+func (f *fakeDaemonStatus) TerminationMessage() string { return f.terminationMessage }
+func (f *fakeDaemonStatus) FailingSince() time.Time    { return f.failingSince }
+func (f *fakeDaemonStatus) LastChecked() time.Time     { return time.Time{} }
+
+func TestDaemonConnectedCondition(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 10, 0, 0, time.UTC)
+	neverConnecting := &fakeDaemonStatus{
+		restartCount:       20,
+		terminationMessage: "dial tcp 10.0.0.1:6443: connect: connection refused",
+		failingSince:       now.Add(-10 * time.Minute),
+	}
+
+	tests := []struct {
+		name           string
+		status         *fakeDaemonStatus
+		threshold      time.Duration
+		expectNil      bool
+		expectedStatus metav1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:      "reporting disabled",
+			status:    neverConnecting,
+			threshold: 0,
+			expectNil: true,
+		},
+		{
+			name:           "connected",
+			status:         &fakeDaemonStatus{},
+			threshold:      5 * time.Minute,
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: "Connected",
+		},
+		{
+			name:           "failing within threshold",
+			status:         neverConnecting,
+			threshold:      time.Hour,
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: "Connected",
+		},
+		{
+			name:           "never connecting beyond threshold",
+			status:         neverConnecting,
+			threshold:      5 * time.Minute,
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: "ConnectionFailed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			condition := daemonConnectedCondition(test.status, now, test.threshold, 1)
+			if test.expectNil {
+				if condition != nil {
+					t.Errorf("expect no condition, but got %+v", condition)
+				}
+				return
+			}
+
+			if condition == nil || condition.Status != test.expectedStatus || condition.Reason != test.expectedReason {
+				t.Fatalf("expect condition %v/%v, but got %+v", test.expectedStatus, test.expectedReason, condition)
+			}
+			if condition.Status == metav1.ConditionFalse &&
+				!strings.Contains(condition.Message, test.status.terminationMessage) {
+				t.Errorf("expect condition message to carry the error, but got %q", condition.Message)
+			}
+		})
+	}
+}
+
+func TestDaemonConnectionNewlyFailed(t *testing.T) {
+	connected := metav1.Condition{Type: ConditionDaemonConnected, Status: metav1.ConditionTrue}
+	failed := metav1.Condition{Type: ConditionDaemonConnected, Status: metav1.ConditionFalse}
+
+	tests := []struct {
+		name       string
+		conditions []metav1.Condition
+		condition  metav1.Condition
+		expected   bool
+	}{
+		{"first failure", nil, failed, true},
+		{"failure after connected", []metav1.Condition{connected}, failed, true},
+		{"failing continuously", []metav1.Condition{failed}, failed, false},
+		{"connected", []metav1.Condition{failed}, connected, false},
+	}
+
+	for _, test := range tests {
+		condition := test.condition
+		if result := daemonConnectionNewlyFailed(test.conditions, &condition); result != test.expected {
+			t.Errorf("test %v failed, expect %v but got %v", test.name, test.expected, result)
+		}
+	}
+}
+
+func TestSubConditionOf(t *testing.T) {
+	tests := []struct {
+		name           string
+		subCondition   clusterchecker.Condition
+		expectedType   string
+		expectedReason string
+	}{
+		{
+			name:           "pass",
+			subCondition:   clusterchecker.NewCondition(clusterchecker.SubnetLocalSubnetConditionName, nil),
+			expectedType:   clusterchecker.SubnetCheckName + clusterchecker.SubnetLocalSubnetConditionName,
+			expectedReason: "CheckPass",
+		},
+		{
+			name: "fail",
+			subCondition: clusterchecker.NewCondition(clusterchecker.SubnetLocalRemoteSubnetConditionName,
+				errors.New("subnets intersect")),
+			expectedType:   clusterchecker.SubnetCheckName + clusterchecker.SubnetLocalRemoteSubnetConditionName,
+			expectedReason: "CheckFail",
+		},
+	}
+
+	for _, test := range tests {
+		condition := subConditionOf(clusterchecker.SubnetCheckName, test.subCondition, 2)
+		if condition.Type != test.expectedType || condition.Reason != test.expectedReason ||
+			condition.Status != test.subCondition.Status || condition.Message != test.subCondition.Message ||
+			condition.ObservedGeneration != 2 {
+			t.Errorf("test %v failed, expect %v/%v, but got %+v", test.name, test.expectedType,
+				test.expectedReason, condition)
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -51,6 +52,9 @@ type RemoteSubnetReconciler struct {
 	ParentCluster       cluster.Cluster
 	ParentClusterObject *multiclusterv1.RemoteCluster
 
+	// ParentClusterTimeout is the timeout of mutations against the parent cluster
+	ParentClusterTimeout time.Duration
+
 	SubnetSet sets.CallbackSet
 }
 
@@ -88,7 +92,7 @@ func (r *RemoteSubnetReconciler) Reconcile(ctx context.Context, req ctrl.Request
 			Name: generateRemoteSubnetName(r.ClusterName, req.Name),
 		},
 	}
-	if operationResult, err = controllerutil.CreateOrPatch(ctx, r.ParentCluster.GetClient(), remoteSubnet, func() error {
+	if operationResult, err = createOrPatchWithTimeout(ctx, r.ParentCluster.GetClient(), remoteSubnet, r.ParentClusterTimeout, func() error {
 		if !remoteSubnet.DeletionTimestamp.IsZero() {
 			return fmt.Errorf("remote subnet %s is terminating, can not be updated", remoteSubnet.Name)
 		}
@@ -111,6 +115,10 @@ func (r *RemoteSubnetReconciler) Reconcile(ctx context.Context, req ctrl.Request
 
 		return nil
 	}); err != nil {
+		if isParentClusterTimeout(err) {
+			log.Info("parent cluster is not responsive, retry later", "reason", err.Error())
+			return ctrl.Result{Requeue: true}, nil
+		}
 		return ctrl.Result{}, wrapError("unable to update remote subnet", err)
 	}
 
@@ -123,7 +131,8 @@ func (r *RemoteSubnetReconciler) Reconcile(ctx context.Context, req ctrl.Request
 
 	remoteSubnetPatch := client.MergeFrom(remoteSubnet.DeepCopy())
 	remoteSubnet.Status.LastModifyTime = metav1.Now()
-	if err = r.ParentCluster.GetClient().Status().Patch(ctx, remoteSubnet, remoteSubnetPatch); err != nil {
+	if err = patchStatusWithTimeout(ctx, r.ParentCluster.GetClient(), remoteSubnet, remoteSubnetPatch,
+		r.ParentClusterTimeout); err != nil {
 		// this error is not fatal, print it and go on
 		log.Error(err, "unable to update remote subnet status")
 	}
@@ -134,11 +143,11 @@ func (r *RemoteSubnetReconciler) Reconcile(ctx context.Context, req ctrl.Request
 
 func (r *RemoteSubnetReconciler) cleanRemoteSubnet(ctx context.Context, subnetName string) error {
 	r.SubnetSet.Delete(subnetName)
-	return client.IgnoreNotFound(r.ParentCluster.GetClient().Delete(ctx, &multiclusterv1.RemoteSubnet{
+	return client.IgnoreNotFound(deleteWithTimeout(ctx, r.ParentCluster.GetClient(), &multiclusterv1.RemoteSubnet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: generateRemoteSubnetName(r.ClusterName, subnetName),
 		},
-	}))
+	}, r.ParentClusterTimeout))
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -22,11 +22,14 @@ import (
 	"net"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -45,10 +48,15 @@ import (
 	"github.com/alibaba/hybridnet/pkg/constants"
 	"github.com/alibaba/hybridnet/pkg/controllers/utils"
 	"github.com/alibaba/hybridnet/pkg/controllers/utils/sets"
+	globalutils "github.com/alibaba/hybridnet/pkg/utils"
 )
 
 const ControllerRemoteVTEP = "RemoteVTEP"
 const indexerFieldNode = "node"
+const indexerFieldVTEPLocalIP = "vtepLocalIP"
+
+// maxIPInstanceListRestarts is how many times listing ip instances in pages restarts for expired continue tokens
+const maxIPInstanceListRestarts = 3
 
 //+kubebuilder:rbac:groups=multicluster.alibaba.com,resources=remotevteps,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=multicluster.alibaba.com,resources=remotevteps/status,verbs=get;update;patch
@@ -63,8 +71,24 @@ type RemoteVtepReconciler struct {
 	ParentCluster       cluster.Cluster
 	ParentClusterObject *multiclusterv1.RemoteCluster
 
+	// ParentClusterTimeout is the timeout of mutations against the parent cluster
+	ParentClusterTimeout time.Duration
+
 	SubnetSet    sets.CallbackSet
 	EventTrigger chan event.GenericEvent
+
+	// Recorder records events on the parent cluster object, it is optional
+	Recorder record.EventRecorder
+
+	// reportedDuplicateLocalIPs records the nodes sharing each duplicate vtep local IP which has been reported,
+	// to avoid emitting the same event on every reconciliation
+	reportedDuplicateLocalIPsLock sync.Mutex
+	reportedDuplicateLocalIPs     map[string]string
+
+	// APIReader is used to list IPInstances of node in pages if IPInstanceListPageSize is positive, otherwise
+	// IPInstances of node are listed from cache at once
+	APIReader              client.Reader
+	IPInstanceListPageSize int64
 }
 
 func (r *RemoteVtepReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
@@ -97,21 +121,37 @@ func (r *RemoteVtepReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
+	if err = validateVTEPInfo(nodeInfo.Spec.VTEPInfo); err != nil {
+		// the VTEP published before vtep info becomes invalid is stale, and should not be used by daemons
+		log.Info("ignore node with invalid vtep info", "reason", err.Error())
+		return ctrl.Result{}, wrapError("unable to clean VTEP for node", r.cleanVTEPForNode(ctx, req.Name))
+	}
+
+	if err = r.warnDuplicateLocalIPs(ctx, nodeInfo); err != nil {
+		return ctrl.Result{}, wrapError("unable to detect duplicate vtep local IPs", err)
+	}
+
+	// local IPs might be duplicated or unordered on nodes with multiple underlay NICs, sort and dedupe
+	// them to keep the patch stable
 	var vtepIP, vtepMac, vtepVxlanIPList = nodeInfo.Spec.VTEPInfo.IP, nodeInfo.Spec.VTEPInfo.MAC,
-		nodeInfo.Spec.VTEPInfo.LocalIPs
+		globalutils.SortedUniqueStrings(nodeInfo.Spec.VTEPInfo.LocalIPs)
 
 	var endpointIPList []string
 	if endpointIPList, err = r.pickEndpointIPListForNode(ctx, req.Name); err != nil {
 		return ctrl.Result{}, wrapError("unable to pick endpoint IP list for node", err)
 	}
 
+	if endpointIPList, err = r.filterUnroutableEndpointIPs(ctx, req.Name, endpointIPList); err != nil {
+		return ctrl.Result{}, wrapError("unable to validate endpoint IP list for node", err)
+	}
+
 	var operationResult controllerutil.OperationResult
 	var remoteVTEP = &multiclusterv1.RemoteVtep{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: generateVTEPName(r.ClusterName, req.Name),
 		},
 	}
-	if operationResult, err = controllerutil.CreateOrPatch(ctx, r.ParentCluster.GetClient(), remoteVTEP, func() error {
+	if operationResult, err = createOrPatchWithTimeout(ctx, r.ParentCluster.GetClient(), remoteVTEP, r.ParentClusterTimeout, func() error {
 		if !remoteVTEP.DeletionTimestamp.IsZero() {
 			return fmt.Errorf("remote VTEP %s is terminating, can not be updated", remoteVTEP.Name)
 		}
@@ -142,6 +182,10 @@ func (r *RemoteVtepReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		remoteVTEP.Spec.EndpointIPList = endpointIPList
 		return nil
 	}); err != nil {
+		if isParentClusterTimeout(err) {
+			log.Info("parent cluster is not responsive, retry later", "reason", err.Error())
+			return ctrl.Result{Requeue: true}, nil
+		}
 		return ctrl.Result{}, wrapError("unable to update VTEP", err)
 	}
 
@@ -152,7 +196,8 @@ func (r *RemoteVtepReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	remoteVTEPPatch := client.MergeFrom(remoteVTEP.DeepCopy())
 	remoteVTEP.Status.LastModifyTime = metav1.Now()
-	if err = r.ParentCluster.GetClient().Status().Patch(ctx, remoteVTEP, remoteVTEPPatch); err != nil {
+	if err = patchStatusWithTimeout(ctx, r.ParentCluster.GetClient(), remoteVTEP, remoteVTEPPatch,
+		r.ParentClusterTimeout); err != nil {
 		// this error is not fatal, print it and go on
 		log.Error(err, "unable to update VTEP status")
 	}
@@ -161,42 +206,237 @@ func (r *RemoteVtepReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return ctrl.Result{}, nil
 }
 
-func (r *RemoteVtepReconciler) cleanVTEPForNode(ctx context.Context, nodeName string) error {
-	return client.IgnoreNotFound(r.ParentCluster.GetClient().Delete(ctx,
-		&multiclusterv1.RemoteVtep{ObjectMeta: metav1.ObjectMeta{Name: generateVTEPName(r.ClusterName, nodeName)}}))
+// validateVTEPInfo checks if the VTEP IP and MAC are well-formed, which are required by daemons
+// to program fdb and neighbor entries
+func validateVTEPInfo(vtepInfo *networkingv1.VTEPInfo) error {
+	if net.ParseIP(vtepInfo.IP) == nil {
+		return fmt.Errorf("invalid vtep IP %q", vtepInfo.IP)
+	}
+
+	if _, err := net.ParseMAC(vtepInfo.MAC); err != nil {
+		return fmt.Errorf("invalid vtep MAC %q: %v", vtepInfo.MAC, err)
+	}
+	return nil
 }
 
-func (r *RemoteVtepReconciler) pickEndpointIPListForNode(ctx context.Context, nodeName string) ([]string, error) {
-	ipInstanceList, err := utils.ListIPInstances(ctx, r, client.MatchingFields{indexerFieldNode: nodeName})
-	if err != nil {
-		return nil, err
+// warnDuplicateLocalIPs surfaces a warning if any vtep local IP of the node is also advertised by other nodes,
+// which makes fdb entries in other clusters ambiguous, the warning is only emitted when the sharing nodes change
+func (r *RemoteVtepReconciler) warnDuplicateLocalIPs(ctx context.Context, nodeInfo *networkingv1.NodeInfo) error {
+	var localIPs = globalutils.SortedUniqueStrings(nodeInfo.Spec.VTEPInfo.LocalIPs)
+	if len(localIPs) == 0 {
+		return nil
 	}
 
-	var endpoints = make([]string, 0)
-	for i := range ipInstanceList.Items {
-		var ipInstance = &ipInstanceList.Items[i]
-		// only IP of recognized subnets will be handled
-		if !r.SubnetSet.Has(ipInstance.Spec.Subnet) {
+	// only nodes sharing local IPs with this node are listed by index
+	var sharingNodeInfos []networkingv1.NodeInfo
+	for _, localIP := range localIPs {
+		var nodeInfoList = &networkingv1.NodeInfoList{}
+		if err := r.List(ctx, nodeInfoList, client.MatchingFields{indexerFieldVTEPLocalIP: localIP}); err != nil {
+			return err
+		}
+		sharingNodeInfos = append(sharingNodeInfos, nodeInfoList.Items...)
+	}
+
+	var duplicateLocalIPs = findDuplicateVTEPLocalIPs(sharingNodeInfos)
+
+	r.reportedDuplicateLocalIPsLock.Lock()
+	defer r.reportedDuplicateLocalIPsLock.Unlock()
+	if r.reportedDuplicateLocalIPs == nil {
+		r.reportedDuplicateLocalIPs = map[string]string{}
+	}
+
+	for _, localIP := range localIPs {
+		nodeNames, exist := duplicateLocalIPs[localIP]
+		if !exist {
+			delete(r.reportedDuplicateLocalIPs, localIP)
 			continue
 		}
-		if ipInstance == nil {
+
+		var nodesKey = strings.Join(nodeNames, ",")
+		if r.reportedDuplicateLocalIPs[localIP] == nodesKey {
 			continue
 		}
-		if !ipInstance.DeletionTimestamp.IsZero() {
+		r.reportedDuplicateLocalIPs[localIP] = nodesKey
+
+		ctrllog.FromContext(ctx).Info("vtep local IP is advertised by multiple nodes",
+			"Cluster", r.ClusterName, "LocalIP", localIP, "Nodes", nodeNames)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(r.ParentClusterObject, corev1.EventTypeWarning, "DuplicateVTEPLocalIP",
+				"vtep local IP %s is advertised by multiple nodes %v", localIP, nodeNames)
+		}
+	}
+	return nil
+}
+
+// findDuplicateVTEPLocalIPs returns the vtep local IPs advertised by more than one distinct node, with the
+// sorted names of those nodes, a local IP repeated on the same node is not a duplicate
+func findDuplicateVTEPLocalIPs(nodeInfos []networkingv1.NodeInfo) map[string][]string {
+	var localIPNodesMap = map[string]map[string]struct{}{}
+	for i := range nodeInfos {
+		var nodeInfo = &nodeInfos[i]
+		if !nodeInfo.DeletionTimestamp.IsZero() || nodeInfo.Spec.VTEPInfo == nil {
 			continue
 		}
-		// skip reserved IPInstance
-		if networkingv1.IsReserved(ipInstance) {
+
+		for _, localIP := range nodeInfo.Spec.VTEPInfo.LocalIPs {
+			if localIPNodesMap[localIP] == nil {
+				localIPNodesMap[localIP] = map[string]struct{}{}
+			}
+			localIPNodesMap[localIP][nodeInfo.Name] = struct{}{}
+		}
+	}
+
+	var duplicateLocalIPs = map[string][]string{}
+	for localIP, nodeNameSet := range localIPNodesMap {
+		if len(nodeNameSet) < 2 {
 			continue
 		}
-		// TODO: should skip allocated but not deployed IPInstance?
-		endpointIP, _, _ := net.ParseCIDR(ipInstance.Spec.Address.IP)
-		endpoints = append(endpoints, endpointIP.String())
+
+		var nodeNames = make([]string, 0, len(nodeNameSet))
+		for nodeName := range nodeNameSet {
+			nodeNames = append(nodeNames, nodeName)
+		}
+		sort.Strings(nodeNames)
+		duplicateLocalIPs[localIP] = nodeNames
+	}
+	return duplicateLocalIPs
+}
+
+func (r *RemoteVtepReconciler) cleanVTEPForNode(ctx context.Context, nodeName string) error {
+	return client.IgnoreNotFound(deleteWithTimeout(ctx, r.ParentCluster.GetClient(),
+		&multiclusterv1.RemoteVtep{ObjectMeta: metav1.ObjectMeta{Name: generateVTEPName(r.ClusterName, nodeName)}},
+		r.ParentClusterTimeout))
+}
+
+func (r *RemoteVtepReconciler) pickEndpointIPListForNode(ctx context.Context, nodeName string) ([]string, error) {
+	var endpoints = make([]string, 0)
+	var collectEndpoint = func(ipInstance *networkingv1.IPInstance) {
+		if endpointIP, ok := r.endpointIPOf(ipInstance); ok {
+			endpoints = append(endpoints, endpointIP)
+		}
+	}
+
+	if r.IPInstanceListPageSize > 0 && r.APIReader != nil {
+		// field indexer only works for cache, so node label is used to select IPInstances from apiserver,
+		// the list restarts from the first page if the continue token expires
+		for restarts := 0; ; restarts++ {
+			err := utils.ListIPInstancesInPages(ctx, r.APIReader, r.IPInstanceListPageSize, collectEndpoint,
+				client.MatchingLabels{constants.LabelNode: nodeName})
+			if err == nil {
+				break
+			}
+			if !apierrors.IsResourceExpired(err) || restarts >= maxIPInstanceListRestarts {
+				return nil, err
+			}
+
+			ctrllog.FromContext(ctx).Info("continue token of listing ip instances expired, restart listing",
+				"Node", nodeName)
+			endpoints = endpoints[:0]
+		}
+	} else {
+		ipInstanceList, err := utils.ListIPInstances(ctx, r, client.MatchingFields{indexerFieldNode: nodeName})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range ipInstanceList.Items {
+			collectEndpoint(&ipInstanceList.Items[i])
+		}
 	}
 
 	// sort will make deep-equal stable
-	sort.Strings(endpoints)
-	return endpoints, nil
+	return globalutils.SortedUniqueStrings(endpoints), nil
+}
+
+// filterUnroutableEndpointIPs drops the endpoint IPs which are not in any subnet synced to parent cluster as remote
+// subnet, daemons of parent cluster can not route them and should never receive them. Synced subnets are taken from
+// SubnetSet and the local cache, changes of SubnetSet already refresh all nodes, so no remote subnet watch is needed.
+func (r *RemoteVtepReconciler) filterUnroutableEndpointIPs(ctx context.Context, nodeName string, endpointIPs []string) ([]string, error) {
+	if len(endpointIPs) == 0 {
+		return endpointIPs, nil
+	}
+
+	var subnets []networkingv1.Subnet
+	for _, subnetName := range r.SubnetSet.List() {
+		subnet, err := utils.GetSubnet(ctx, r, subnetName)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		subnets = append(subnets, *subnet)
+	}
+
+	// no subnet is synced to parent cluster yet, keep all endpoint IPs until range data exists
+	if len(subnets) == 0 {
+		return endpointIPs, nil
+	}
+
+	kept, dropped := splitEndpointIPsBySubnets(endpointIPs, subnets)
+	if len(dropped) > 0 {
+		ctrllog.FromContext(ctx).Info("drop endpoint IPs out of any remote subnet",
+			"Cluster", r.ClusterName, "Node", nodeName, "EndpointIPs", dropped)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(r.ParentClusterObject, corev1.EventTypeWarning, "UnroutableEndpointIP",
+				"endpoint IPs %v of node %s are out of any remote subnet", dropped, nodeName)
+		}
+	}
+	return kept, nil
+}
+
+// splitEndpointIPsBySubnets splits endpoint IPs into the ones contained by any subnet and the others,
+// the order of endpoint IPs is preserved
+func splitEndpointIPsBySubnets(endpointIPs []string, subnets []networkingv1.Subnet) (kept, dropped []string) {
+	var cidrs = make([]*net.IPNet, 0, len(subnets))
+	for i := range subnets {
+		if _, cidr, err := net.ParseCIDR(subnets[i].Spec.Range.CIDR); err == nil {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+
+	kept = make([]string, 0, len(endpointIPs))
+	for _, endpointIP := range endpointIPs {
+		if ipContainedByAny(net.ParseIP(endpointIP), cidrs) {
+			kept = append(kept, endpointIP)
+		} else {
+			dropped = append(dropped, endpointIP)
+		}
+	}
+	return kept, dropped
+}
+
+func ipContainedByAny(ip net.IP, cidrs []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointIPOf returns the endpoint IP of IPInstance if it should be advertised in remote VTEP
+func (r *RemoteVtepReconciler) endpointIPOf(ipInstance *networkingv1.IPInstance) (string, bool) {
+	if ipInstance == nil {
+		return "", false
+	}
+	// only IP of recognized subnets will be handled
+	if !r.SubnetSet.Has(ipInstance.Spec.Subnet) {
+		return "", false
+	}
+	if !ipInstance.DeletionTimestamp.IsZero() {
+		return "", false
+	}
+	// skip reserved IPInstance
+	if networkingv1.IsReserved(ipInstance) {
+		return "", false
+	}
+	// TODO: should skip allocated but not deployed IPInstance?
+	endpointIP, _, _ := net.ParseCIDR(ipInstance.Spec.Address.IP)
+	return endpointIP.String(), true
 }
 
 // RefreshAll will trigger all nodes to reconcile,
@@ -243,6 +483,17 @@ func (r *RemoteVtepReconciler) SetupWithManager(mgr ctrl.Manager) (err error) {
 		return err
 	}
 
+	// init vtep local IP indexer for node infos to find nodes sharing local IPs
+	if err = mgr.GetFieldIndexer().IndexField(context.TODO(), &networkingv1.NodeInfo{}, indexerFieldVTEPLocalIP, func(obj client.Object) []string {
+		nodeInfo, ok := obj.(*networkingv1.NodeInfo)
+		if !ok || nodeInfo.Spec.VTEPInfo == nil {
+			return nil
+		}
+		return globalutils.SortedUniqueStrings(nodeInfo.Spec.VTEPInfo.LocalIPs)
+	}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(ControllerRemoteVTEP).
 		For(&networkingv1.NodeInfo{},
@@ -278,7 +529,8 @@ func (r *RemoteVtepReconciler) SetupWithManager(mgr ctrl.Manager) (err error) {
 					}
 					return networkingv1.IsValidIPInstance(ipInstance)
 				}),
-				// if node or phase of IP instance change, node will be processed
+				// if node of IP instance changes, node will be processed, IP instances have no phase
+				// in the current model, so phase changes are not watched any more
 				predicate.Or(
 					&utils.SpecifiedLabelChangedPredicate{
 						LabelKeys: []string{
@@ -0,0 +1,565 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+
+	multiclusterv1 "github.com/alibaba/hybridnet/pkg/apis/multicluster/v1"
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+	"github.com/alibaba/hybridnet/pkg/constants"
+	"github.com/alibaba/hybridnet/pkg/controllers/utils/sets"
+)
+
+// fakeCluster only serves the client and scheme of a cluster
+type fakeCluster struct {
+	cluster.Cluster
+
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+func (f *fakeCluster) GetClient() client.Client {
+	return f.client
+}
+
+func (f *fakeCluster) GetScheme() *runtime.Scheme {
+	return f.scheme
+}
+
+func TestValidateVTEPInfo(t *testing.T) {
+	testCases := []struct {
+		name      string
+		vtepInfo  *networkingv1.VTEPInfo
+		expectErr bool
+	}{
+		{
+			"valid",
+			&networkingv1.VTEPInfo{IP: "192.168.0.1", MAC: "aa:bb:cc:dd:ee:ff"},
+			false,
+		},
+		{
+			"malformed mac",
+			&networkingv1.VTEPInfo{IP: "192.168.0.1", MAC: "aa:bb:cc:dd:ee"},
+			true,
+		},
+		{
+			"malformed ip",
+			&networkingv1.VTEPInfo{IP: "192.168.0.256", MAC: "aa:bb:cc:dd:ee:ff"},
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		if err := validateVTEPInfo(tc.vtepInfo); (err != nil) != tc.expectErr {
+			t.Errorf("test %s fails: expect error %v but got %v", tc.name, tc.expectErr, err)
+		}
+	}
+}
+
+func TestRemoteVtepReconcileWithMalformedMAC(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := multiclusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	nodeInfo := &networkingv1.NodeInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Spec: networkingv1.NodeInfoSpec{
+			VTEPInfo: &networkingv1.VTEPInfo{IP: "192.168.0.1", MAC: "not-a-mac"},
+		},
+	}
+
+	// published before the mac of node becomes malformed
+	staleRemoteVtep := &multiclusterv1.RemoteVtep{
+		ObjectMeta: metav1.ObjectMeta{Name: generateVTEPName("cluster1", "node1")},
+		Spec: multiclusterv1.RemoteVtepSpec{
+			ClusterName: "cluster1",
+			NodeName:    "node1",
+			VTEPInfo:    networkingv1.VTEPInfo{IP: "192.168.0.1", MAC: "aa:bb:cc:dd:ee:ff"},
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		parentObjects []client.Object
+	}{
+		{"no remote vtep", nil},
+		{"stale remote vtep", []client.Object{staleRemoteVtep}},
+	}
+
+	for _, tc := range testCases {
+		parentClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tc.parentObjects...).Build()
+		r := &RemoteVtepReconciler{
+			Client:              fake.NewClientBuilder().WithScheme(scheme).WithObjects(nodeInfo).Build(),
+			ClusterName:         "cluster1",
+			ParentCluster:       &fakeCluster{client: parentClient, scheme: scheme},
+			ParentClusterObject: &multiclusterv1.RemoteCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster1"}},
+		}
+
+		if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node1"}}); err != nil {
+			t.Fatalf("test %s fails: unexpected reconcile error: %v", tc.name, err)
+		}
+
+		remoteVtepList := &multiclusterv1.RemoteVtepList{}
+		if err := parentClient.List(context.Background(), remoteVtepList); err != nil {
+			t.Fatalf("test %s fails: failed to list remote vteps: %v", tc.name, err)
+		}
+
+		if len(remoteVtepList.Items) != 0 {
+			t.Errorf("test %s fails: expect no remote vtep, but got %v", tc.name, remoteVtepList.Items)
+		}
+	}
+}
+
+func TestRemoteVtepReconcileWithDuplicateLocalIP(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := multiclusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	newNodeInfo := func(name, vtepIP, vtepMAC string, localIPs ...string) *networkingv1.NodeInfo {
+		return &networkingv1.NodeInfo{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: networkingv1.NodeInfoSpec{
+				VTEPInfo: &networkingv1.VTEPInfo{IP: vtepIP, MAC: vtepMAC, LocalIPs: localIPs},
+			},
+		}
+	}
+
+	nodeInfos := []networkingv1.NodeInfo{
+		*newNodeInfo("node1", "192.168.0.1", "aa:bb:cc:dd:ee:01", "192.168.0.1", "192.168.1.100", "192.168.1.100"),
+		*newNodeInfo("node2", "192.168.0.2", "aa:bb:cc:dd:ee:02", "192.168.0.2", "192.168.1.100"),
+		// local IP repeated on the same node is not a duplicate
+		*newNodeInfo("node3", "192.168.0.3", "aa:bb:cc:dd:ee:03", "192.168.0.3", "192.168.0.3"),
+	}
+
+	duplicateLocalIPs := findDuplicateVTEPLocalIPs(nodeInfos)
+	if len(duplicateLocalIPs) != 1 || !reflect.DeepEqual(duplicateLocalIPs["192.168.1.100"], []string{"node1", "node2"}) {
+		t.Fatalf("expect 192.168.1.100 is shared by node1 and node2, but got %v", duplicateLocalIPs)
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &RemoteVtepReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(&nodeInfos[0], &nodeInfos[1], &nodeInfos[2]).Build(),
+		ClusterName:         "cluster1",
+		ParentCluster:       &fakeCluster{client: fake.NewClientBuilder().WithScheme(scheme).Build(), scheme: scheme},
+		ParentClusterObject: &multiclusterv1.RemoteCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster1"}},
+		Recorder:            recorder,
+	}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node1"}}); err != nil {
+		t.Fatalf("unexpected reconcile error: %v", err)
+	}
+
+	select {
+	case e := <-recorder.Events:
+		if !strings.Contains(e, "DuplicateVTEPLocalIP") || !strings.Contains(e, "192.168.1.100") {
+			t.Errorf("unexpected event %q", e)
+		}
+	default:
+		t.Errorf("expect a duplicate vtep local IP event")
+	}
+
+	// the same duplicate is not reported again
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node2"}}); err != nil {
+		t.Fatalf("unexpected reconcile error: %v", err)
+	}
+	select {
+	case e := <-recorder.Events:
+		t.Errorf("expect no repeated event, but got %q", e)
+	default:
+	}
+}
+
+func TestRemoteVtepReconcileWithUnroutableEndpointIP(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := multiclusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	nodeInfo := &networkingv1.NodeInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Spec: networkingv1.NodeInfoSpec{
+			VTEPInfo: &networkingv1.VTEPInfo{IP: "192.168.0.1", MAC: "aa:bb:cc:dd:ee:01"},
+		},
+	}
+
+	newIPInstance := func(name, ip string) networkingv1.IPInstance {
+		return networkingv1.IPInstance{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{constants.LabelNode: "node1"},
+			},
+			Spec: networkingv1.IPInstanceSpec{
+				Subnet:  "subnet1",
+				Address: networkingv1.Address{IP: ip},
+				Binding: networkingv1.Binding{NodeName: "node1"},
+			},
+		}
+	}
+
+	subnet := &networkingv1.Subnet{
+		ObjectMeta: metav1.ObjectMeta{Name: "subnet1"},
+		Spec: networkingv1.SubnetSpec{
+			Range: networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: "10.0.0.0/24"},
+		},
+	}
+
+	subnetSet := sets.NewCallbackSet()
+	subnetSet.Insert("subnet1")
+
+	parentClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &RemoteVtepReconciler{
+		Client:              fake.NewClientBuilder().WithScheme(scheme).WithObjects(nodeInfo, subnet).Build(),
+		ClusterName:         "cluster1",
+		ParentCluster:       &fakeCluster{client: parentClient, scheme: scheme},
+		ParentClusterObject: &multiclusterv1.RemoteCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster1"}},
+		SubnetSet:           subnetSet,
+		Recorder:            recorder,
+		APIReader: &pagedIPInstanceReader{ipInstances: []networkingv1.IPInstance{
+			newIPInstance("ip-1", "10.0.0.5/24"),
+			newIPInstance("ip-2", "10.1.0.5/24"),
+		}},
+		IPInstanceListPageSize: 100,
+	}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node1"}}); err != nil {
+		t.Fatalf("unexpected reconcile error: %v", err)
+	}
+
+	remoteVtep := &multiclusterv1.RemoteVtep{}
+	if err := parentClient.Get(context.Background(), types.NamespacedName{Name: "cluster1.node1"}, remoteVtep); err != nil {
+		t.Fatalf("failed to get remote vtep: %v", err)
+	}
+	if !reflect.DeepEqual(remoteVtep.Spec.EndpointIPList, []string{"10.0.0.5"}) {
+		t.Errorf("expect only 10.0.0.5 is published, but got %v", remoteVtep.Spec.EndpointIPList)
+	}
+
+	select {
+	case e := <-recorder.Events:
+		if !strings.Contains(e, "UnroutableEndpointIP") || !strings.Contains(e, "10.1.0.5") {
+			t.Errorf("unexpected event %q", e)
+		}
+	default:
+		t.Errorf("expect an unroutable endpoint IP event")
+	}
+}
+
+func TestRemoteVtepReconcileWithReorderedLocalIPs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := multiclusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	nodeInfo := &networkingv1.NodeInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Spec: networkingv1.NodeInfoSpec{
+			VTEPInfo: &networkingv1.VTEPInfo{IP: "192.168.0.1", MAC: "aa:bb:cc:dd:ee:01",
+				LocalIPs: []string{"192.168.1.1", "192.168.0.1", "192.168.1.1"}},
+		},
+	}
+
+	newIPInstance := func(name, ip string) networkingv1.IPInstance {
+		return networkingv1.IPInstance{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{constants.LabelNode: "node1"},
+			},
+			Spec: networkingv1.IPInstanceSpec{
+				Subnet:  "subnet1",
+				Address: networkingv1.Address{IP: ip},
+				Binding: networkingv1.Binding{NodeName: "node1"},
+			},
+		}
+	}
+
+	subnetSet := sets.NewCallbackSet()
+	subnetSet.Insert("subnet1")
+
+	nodeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(nodeInfo).Build()
+	parentClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	ipInstanceReader := &pagedIPInstanceReader{ipInstances: []networkingv1.IPInstance{
+		newIPInstance("ip-1", "10.0.0.6/24"),
+		newIPInstance("ip-2", "10.0.0.5/24"),
+	}}
+	r := &RemoteVtepReconciler{
+		Client:                 nodeClient,
+		ClusterName:            "cluster1",
+		ParentCluster:          &fakeCluster{client: parentClient, scheme: scheme},
+		ParentClusterObject:    &multiclusterv1.RemoteCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster1"}},
+		SubnetSet:              subnetSet,
+		APIReader:              ipInstanceReader,
+		IPInstanceListPageSize: 100,
+	}
+
+	getRemoteVtep := func() *multiclusterv1.RemoteVtep {
+		remoteVtep := &multiclusterv1.RemoteVtep{}
+		if err := parentClient.Get(context.Background(), types.NamespacedName{Name: "cluster1.node1"}, remoteVtep); err != nil {
+			t.Fatalf("failed to get remote vtep: %v", err)
+		}
+		return remoteVtep
+	}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node1"}}); err != nil {
+		t.Fatalf("unexpected reconcile error: %v", err)
+	}
+
+	remoteVtep := getRemoteVtep()
+	if !reflect.DeepEqual(remoteVtep.Spec.VTEPInfo.LocalIPs, []string{"192.168.0.1", "192.168.1.1"}) {
+		t.Errorf("expect sorted and deduped local IPs, but got %v", remoteVtep.Spec.VTEPInfo.LocalIPs)
+	}
+	if !reflect.DeepEqual(remoteVtep.Spec.EndpointIPList, []string{"10.0.0.5", "10.0.0.6"}) {
+		t.Errorf("expect sorted endpoint IPs, but got %v", remoteVtep.Spec.EndpointIPList)
+	}
+
+	// reorder local IPs and endpoint IPs with duplicates
+	nodeInfo = &networkingv1.NodeInfo{}
+	if err := nodeClient.Get(context.Background(), types.NamespacedName{Name: "node1"}, nodeInfo); err != nil {
+		t.Fatalf("failed to get node info: %v", err)
+	}
+	nodeInfo.Spec.VTEPInfo.LocalIPs = []string{"192.168.0.1", "192.168.1.1", "192.168.0.1"}
+	if err := nodeClient.Update(context.Background(), nodeInfo); err != nil {
+		t.Fatalf("failed to update node info: %v", err)
+	}
+	ipInstanceReader.ipInstances = []networkingv1.IPInstance{
+		newIPInstance("ip-2", "10.0.0.5/24"),
+		newIPInstance("ip-1", "10.0.0.6/24"),
+		newIPInstance("ip-3", "10.0.0.6/24"),
+	}
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node1"}}); err != nil {
+		t.Fatalf("unexpected reconcile error: %v", err)
+	}
+
+	// remote vtep is not patched, which means the operation result is none
+	if resourceVersion := getRemoteVtep().ResourceVersion; resourceVersion != remoteVtep.ResourceVersion {
+		t.Errorf("expect remote vtep is not patched, but resource version changes from %v to %v",
+			remoteVtep.ResourceVersion, resourceVersion)
+	}
+}
+
+func TestSplitEndpointIPsBySubnets(t *testing.T) {
+	newSubnet := func(cidr string) networkingv1.Subnet {
+		return networkingv1.Subnet{
+			Spec: networkingv1.SubnetSpec{Range: networkingv1.AddressRange{CIDR: cidr}},
+		}
+	}
+
+	testCases := []struct {
+		name        string
+		endpointIPs []string
+		subnets     []networkingv1.Subnet
+		kept        []string
+		dropped     []string
+	}{
+		{
+			"all contained",
+			[]string{"10.0.0.1", "fd00::1"},
+			[]networkingv1.Subnet{newSubnet("10.0.0.0/24"), newSubnet("fd00::/64")},
+			[]string{"10.0.0.1", "fd00::1"},
+			nil,
+		},
+		{
+			"out of range",
+			[]string{"10.0.0.1", "10.0.1.1"},
+			[]networkingv1.Subnet{newSubnet("10.0.0.0/24")},
+			[]string{"10.0.0.1"},
+			[]string{"10.0.1.1"},
+		},
+		{
+			"malformed subnet",
+			[]string{"10.0.0.1"},
+			[]networkingv1.Subnet{newSubnet("not-a-cidr")},
+			[]string{},
+			[]string{"10.0.0.1"},
+		},
+		{
+			"malformed endpoint IP",
+			[]string{"not-an-ip"},
+			[]networkingv1.Subnet{newSubnet("10.0.0.0/24")},
+			[]string{},
+			[]string{"not-an-ip"},
+		},
+	}
+
+	for _, tc := range testCases {
+		kept, dropped := splitEndpointIPsBySubnets(tc.endpointIPs, tc.subnets)
+		if !reflect.DeepEqual(kept, tc.kept) || !reflect.DeepEqual(dropped, tc.dropped) {
+			t.Errorf("test %s fails: expect kept %v dropped %v, but got kept %v dropped %v",
+				tc.name, tc.kept, tc.dropped, kept, dropped)
+		}
+	}
+}
+
+// pagedIPInstanceReader serves IPInstances in pages like apiserver, the continue token is the offset of next page
+type pagedIPInstanceReader struct {
+	client.Reader
+
+	ipInstances []networkingv1.IPInstance
+	pages       int
+
+	// continue tokens expire for the next expiredTimes lists of non-first pages
+	expiredTimes int
+}
+
+func (p *pagedIPInstanceReader) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOptions := &client.ListOptions{}
+	listOptions.ApplyOptions(opts)
+
+	var matched []networkingv1.IPInstance
+	for _, ipInstance := range p.ipInstances {
+		if listOptions.LabelSelector == nil || listOptions.LabelSelector.Matches(labels.Set(ipInstance.Labels)) {
+			matched = append(matched, ipInstance)
+		}
+	}
+
+	offset := 0
+	if len(listOptions.Continue) > 0 {
+		if p.expiredTimes > 0 {
+			p.expiredTimes--
+			return apierrors.NewResourceExpired("continue token is too old")
+		}
+		offset, _ = strconv.Atoi(listOptions.Continue)
+	}
+	end := offset + int(listOptions.Limit)
+	if listOptions.Limit == 0 || end > len(matched) {
+		end = len(matched)
+	}
+
+	ipList := list.(*networkingv1.IPInstanceList)
+	ipList.Items = matched[offset:end]
+	if end < len(matched) {
+		ipList.Continue = strconv.Itoa(end)
+	}
+	p.pages++
+	return nil
+}
+
+func TestPickEndpointIPListForNodeInPages(t *testing.T) {
+	newIPInstance := func(index int, nodeName, subnet string, reserved bool) networkingv1.IPInstance {
+		ipInstance := networkingv1.IPInstance{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   fmt.Sprintf("ip-%d", index),
+				Labels: map[string]string{constants.LabelNode: nodeName},
+			},
+			Spec: networkingv1.IPInstanceSpec{
+				Subnet: subnet,
+				Address: networkingv1.Address{
+					IP: fmt.Sprintf("10.%d.%d.%d/8", index/65536, index/256%256, index%256),
+				},
+			},
+		}
+		if !reserved {
+			ipInstance.Spec.Binding.NodeName = nodeName
+		}
+		return ipInstance
+	}
+
+	var ipInstances []networkingv1.IPInstance
+	var expected []string
+	for i := 20000; i > 0; i-- {
+		switch {
+		case i%10 == 0:
+			ipInstances = append(ipInstances, newIPInstance(i, "node2", "subnet1", false))
+		case i%10 == 1:
+			ipInstances = append(ipInstances, newIPInstance(i, "node1", "subnet2", false))
+		case i%10 == 2:
+			ipInstances = append(ipInstances, newIPInstance(i, "node1", "subnet1", true))
+		default:
+			ipInstance := newIPInstance(i, "node1", "subnet1", false)
+			ipInstances = append(ipInstances, ipInstance)
+			endpointIP, _, _ := net.ParseCIDR(ipInstance.Spec.Address.IP)
+			expected = append(expected, endpointIP.String())
+		}
+	}
+	sort.Strings(expected)
+
+	subnetSet := sets.NewCallbackSet()
+	subnetSet.Insert("subnet1")
+
+	reader := &pagedIPInstanceReader{ipInstances: ipInstances}
+	r := &RemoteVtepReconciler{
+		SubnetSet:              subnetSet,
+		APIReader:              reader,
+		IPInstanceListPageSize: 500,
+	}
+
+	for round := 0; round < 2; round++ {
+		reader.pages = 0
+		endpoints, err := r.pickEndpointIPListForNode(context.Background(), "node1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !reflect.DeepEqual(endpoints, expected) {
+			t.Fatalf("round %d: expect %d sorted endpoints, but got %d", round, len(expected), len(endpoints))
+		}
+
+		if expectedPages := (18000 + 499) / 500; reader.pages != expectedPages {
+			t.Errorf("round %d: expect %d pages, but got %d", round, expectedPages, reader.pages)
+		}
+	}
+
+	// listing restarts from the first page if the continue token expires
+	reader.expiredTimes = 1
+	endpoints, err := r.pickEndpointIPListForNode(context.Background(), "node1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("expect %d sorted endpoints after restart, but got %d", len(expected), len(endpoints))
+	}
+
+	// listing fails if the continue token keeps expiring
+	reader.expiredTimes = maxIPInstanceListRestarts + 1
+	if _, err = r.pickEndpointIPListForNode(context.Background(), "node1"); !apierrors.IsResourceExpired(err) {
+		t.Errorf("expect a resource expired error, but got %v", err)
+	}
+}
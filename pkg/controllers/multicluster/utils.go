@@ -18,15 +18,21 @@ package multicluster
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	"github.com/alibaba/hybridnet/pkg/controllers/multicluster/clusterchecker"
 	"github.com/alibaba/hybridnet/pkg/controllers/utils"
 )
 
-func InitClusterStatusChecker(ctx context.Context, mgr ctrl.Manager) (clusterchecker.Checker, error) {
+func InitClusterStatusChecker(ctx context.Context, mgr ctrl.Manager, ignorePrivateSubnets bool) (clusterchecker.Checker, error) {
 	clusterUUID, err := utils.GetClusterUUID(ctx, mgr.GetClient())
 	if err != nil {
 		return nil, fmt.Errorf("unable to get cluster UUID: %v", err)
@@ -43,8 +49,68 @@ func InitClusterStatusChecker(ctx context.Context, mgr ctrl.Manager) (clusterche
 	if err = checker.Register(clusterchecker.OverlayNetIDCheckName, &clusterchecker.OverlayNetID{LocalClient: mgr.GetClient()}); err != nil {
 		return nil, err
 	}
-	if err = checker.Register(clusterchecker.SubnetCheckName, &clusterchecker.Subnet{LocalClient: mgr.GetClient()}); err != nil {
+	if err = checker.Register(clusterchecker.SubnetCheckName, &clusterchecker.Subnet{
+		LocalClient:          mgr.GetClient(),
+		IgnorePrivateSubnets: ignorePrivateSubnets,
+	}); err != nil {
 		return nil, err
 	}
 	return checker, nil
 }
+
+// DefaultParentClusterTimeout is the default timeout of mutations against the parent cluster
+const DefaultParentClusterTimeout = 30 * time.Second
+
+// DefaultConnectionFailedThreshold is the default duration of a remote cluster failing to connect before it is reported
+const DefaultConnectionFailedThreshold = 5 * time.Minute
+
+// callWithTimeout calls f against the parent cluster with a deadline, and retries on transient API errors
+// within the deadline, a non-positive timeout means no deadline
+func callWithTimeout(ctx context.Context, timeout time.Duration, f func(ctx context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return retry.OnError(retry.DefaultBackoff, func(err error) bool {
+		return ctx.Err() == nil && isTransientAPIError(err)
+	}, func() error {
+		return f(ctx)
+	})
+}
+
+// createOrPatchWithTimeout calls CreateOrPatch against the parent cluster client with a deadline
+func createOrPatchWithTimeout(ctx context.Context, c client.Client, obj client.Object, timeout time.Duration,
+	f controllerutil.MutateFn) (operationResult controllerutil.OperationResult, err error) {
+	err = callWithTimeout(ctx, timeout, func(ctx context.Context) error {
+		operationResult, err = controllerutil.CreateOrPatch(ctx, c, obj, f)
+		return err
+	})
+	return operationResult, err
+}
+
+// patchStatusWithTimeout patches the status of object against the parent cluster client with a deadline
+func patchStatusWithTimeout(ctx context.Context, c client.Client, obj client.Object, patch client.Patch,
+	timeout time.Duration) error {
+	return callWithTimeout(ctx, timeout, func(ctx context.Context) error {
+		return c.Status().Patch(ctx, obj, patch)
+	})
+}
+
+// deleteWithTimeout deletes object against the parent cluster client with a deadline
+func deleteWithTimeout(ctx context.Context, c client.Client, obj client.Object, timeout time.Duration) error {
+	return callWithTimeout(ctx, timeout, func(ctx context.Context) error {
+		return c.Delete(ctx, obj)
+	})
+}
+
+func isTransientAPIError(err error) bool {
+	return apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err) || apierrors.IsInternalError(err)
+}
+
+// isParentClusterTimeout checks if error is caused by a slow or unreachable parent cluster
+func isParentClusterTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || isTransientAPIError(err)
+}
@@ -0,0 +1,167 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	multiclusterv1 "github.com/alibaba/hybridnet/pkg/apis/multicluster/v1"
+)
+
+func TestCreateOrPatchWithTimeout(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := multiclusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("retry on transient errors", func(t *testing.T) {
+		c := fake.NewClientBuilder().WithScheme(scheme).Build()
+		remoteSubnet := &multiclusterv1.RemoteSubnet{ObjectMeta: metav1.ObjectMeta{Name: "cluster1.subnet1"}}
+
+		attempts := 0
+		operationResult, err := createOrPatchWithTimeout(context.Background(), c, remoteSubnet, time.Second, func() error {
+			attempts++
+			if attempts < 3 {
+				return apierrors.NewServiceUnavailable("parent cluster is busy")
+			}
+			remoteSubnet.Spec.ClusterName = "cluster1"
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if operationResult != controllerutil.OperationResultCreated || attempts != 3 {
+			t.Errorf("expect created after 3 attempts, but got %v after %v attempts", operationResult, attempts)
+		}
+	})
+
+	t.Run("no retry on other errors", func(t *testing.T) {
+		c := fake.NewClientBuilder().WithScheme(scheme).Build()
+		remoteSubnet := &multiclusterv1.RemoteSubnet{ObjectMeta: metav1.ObjectMeta{Name: "cluster1.subnet1"}}
+
+		attempts := 0
+		_, err := createOrPatchWithTimeout(context.Background(), c, remoteSubnet, time.Second, func() error {
+			attempts++
+			return apierrors.NewForbidden(schema.GroupResource{}, remoteSubnet.Name, errors.New("forbidden"))
+		})
+		if err == nil || isParentClusterTimeout(err) || attempts != 1 {
+			t.Errorf("expect a non-retryable error after 1 attempt, but got %v after %v attempts", err, attempts)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		c := fake.NewClientBuilder().WithScheme(scheme).Build()
+		remoteSubnet := &multiclusterv1.RemoteSubnet{ObjectMeta: metav1.ObjectMeta{Name: "cluster1.subnet1"}}
+
+		_, err := createOrPatchWithTimeout(context.Background(), c, remoteSubnet, 10*time.Millisecond, func() error {
+			time.Sleep(20 * time.Millisecond)
+			return apierrors.NewTimeoutError("parent cluster is slow", 1)
+		})
+		if !isParentClusterTimeout(err) {
+			t.Errorf("expect a parent cluster timeout error, but got %v", err)
+		}
+	})
+}
+
+// flakyClient fails the first failures deletions and status patches with a transient error
+type flakyClient struct {
+	client.Client
+
+	failures int
+	attempts int
+}
+
+func (f *flakyClient) fail() error {
+	f.attempts++
+	if f.attempts <= f.failures {
+		return apierrors.NewServiceUnavailable("parent cluster is busy")
+	}
+	return nil
+}
+
+func (f *flakyClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := f.fail(); err != nil {
+		return err
+	}
+	return f.Client.Delete(ctx, obj, opts...)
+}
+
+func (f *flakyClient) Status() client.StatusWriter {
+	return &flakyStatusWriter{StatusWriter: f.Client.Status(), parent: f}
+}
+
+type flakyStatusWriter struct {
+	client.StatusWriter
+
+	parent *flakyClient
+}
+
+func (f *flakyStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch,
+	opts ...client.PatchOption) error {
+	if err := f.parent.fail(); err != nil {
+		return err
+	}
+	return f.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
+
+func TestPatchStatusAndDeleteWithTimeout(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := multiclusterv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	remoteVtep := &multiclusterv1.RemoteVtep{ObjectMeta: metav1.ObjectMeta{Name: "cluster1.node1"}}
+	c := &flakyClient{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(remoteVtep).Build(),
+		failures: 2,
+	}
+
+	patch := client.MergeFrom(remoteVtep.DeepCopy())
+	remoteVtep.Status.LastModifyTime = metav1.Now()
+	if err := patchStatusWithTimeout(context.Background(), c, remoteVtep, patch, time.Second); err != nil {
+		t.Fatalf("unexpected error of patching status: %v", err)
+	}
+	if c.attempts != 3 {
+		t.Errorf("expect status patched after 3 attempts, but got %v attempts", c.attempts)
+	}
+
+	c.attempts = 0
+	if err := deleteWithTimeout(context.Background(), c, remoteVtep, time.Second); err != nil {
+		t.Fatalf("unexpected error of deleting: %v", err)
+	}
+	if c.attempts != 3 {
+		t.Errorf("expect deleted after 3 attempts, but got %v attempts", c.attempts)
+	}
+
+	// fails with a transient error until timeout
+	c.attempts, c.failures = 0, 1<<10
+	if err := deleteWithTimeout(context.Background(), c, remoteVtep, 10*time.Millisecond); !isParentClusterTimeout(err) {
+		t.Errorf("expect a parent cluster timeout error, but got %v", err)
+	}
+}
@@ -19,6 +19,7 @@ package networking
 import (
 	"context"
 	"fmt"
+	"net"
 	"reflect"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -44,10 +45,14 @@ import (
 	"github.com/alibaba/hybridnet/pkg/controllers/utils"
 	ipamtypes "github.com/alibaba/hybridnet/pkg/ipam/types"
 	"github.com/alibaba/hybridnet/pkg/metrics"
+	globalutils "github.com/alibaba/hybridnet/pkg/utils"
 )
 
 const ControllerSubnetStatus = "SubnetStatus"
 
+// maxListedExcludeIPBlocks is the max number of exclude ip blocks listed in subnet status
+const maxListedExcludeIPBlocks = 16
+
 // SubnetStatusReconciler reconciles a Subnet object
 type SubnetStatusReconciler struct {
 	client.Client
@@ -108,6 +113,14 @@ func (r *SubnetStatusReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		LastAllocatedIP: usage.LastAllocation,
 	}
 
+	// exclude ip blocks are only for display, failure should not block usage updating
+	if blocks, count, summarizeErr := summarizeExcludeIPBlocks(&subnet.Spec.Range); summarizeErr != nil {
+		log.Error(summarizeErr, "unable to summarize exclude ip blocks")
+	} else {
+		subnetStatus.ExcludeIPBlocks = blocks
+		subnetStatus.ExcludeIPBlockCount = count
+	}
+
 	// diff for no-op
 	if reflect.DeepEqual(&subnet.Status, subnetStatus) {
 		log.V(1).Info("subnet status is up-to-date, skip updating")
@@ -132,6 +145,50 @@ func (r *SubnetStatusReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	return ctrl.Result{}, nil
 }
 
+// summarizeExcludeIPBlocks derives the ip blocks excluded from allocation from the range of subnet, which are the
+// same as the exclude ip block routes on nodes. Only the first maxListedExcludeIPBlocks blocks are listed and the
+// others are only counted, because a large ipv6 range with scattered exclude ips might be split into too many blocks.
+func summarizeExcludeIPBlocks(addressRange *networkingv1.AddressRange) ([]string, int32, error) {
+	_, cidr, err := net.ParseCIDR(addressRange.CIDR)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid cidr %v: %v", addressRange.CIDR, err)
+	}
+
+	var gateway net.IP
+	if len(addressRange.Gateway) != 0 {
+		if gateway = net.ParseIP(addressRange.Gateway); gateway == nil {
+			return nil, 0, fmt.Errorf("invalid gateway ip %v", addressRange.Gateway)
+		}
+	}
+
+	includedRanges, err := globalutils.ParseIncludedIPRanges(cidr, addressRange.Start, addressRange.End)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var excludeIPs []net.IP
+	for _, ipString := range addressRange.ExcludeIPs {
+		excludeIP := net.ParseIP(ipString)
+		if excludeIP == nil {
+			return nil, 0, fmt.Errorf("invalid exclude ip %v", ipString)
+		}
+		excludeIPs = append(excludeIPs, excludeIP)
+	}
+
+	blocks, count, err := globalutils.SummarizeSubnetExcludeIPBlocks(cidr, includedRanges, gateway, excludeIPs,
+		maxListedExcludeIPBlocks)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find exclude ip blocks: %v", err)
+	}
+
+	var listed []string
+	for _, block := range blocks {
+		listed = append(listed, block.String())
+	}
+
+	return listed, int32(count), nil
+}
+
 func updateSubnetUsageMetrics(networkName, subnetName string, subnetStatus *networkingv1.SubnetStatus) {
 	if subnetStatus.Total > 0 {
 		metrics.SubnetIPUsageGauge.With(
@@ -0,0 +1,96 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package networking
+
+import (
+	"fmt"
+	"testing"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestSummarizeExcludeIPBlocks(t *testing.T) {
+	var scatteredExcludeIPs []string
+	for i := 0; i < 20; i++ {
+		scatteredExcludeIPs = append(scatteredExcludeIPs, fmt.Sprintf("fd00::%x", i*16))
+	}
+
+	tests := []struct {
+		name           string
+		addressRange   *networkingv1.AddressRange
+		expectedBlocks []string
+		expectedCount  int32
+		expectError    bool
+	}{
+		{
+			name: "start, end, gateway and exclude ips",
+			addressRange: &networkingv1.AddressRange{
+				CIDR:       "192.168.0.0/24",
+				Start:      "192.168.0.16",
+				End:        "192.168.0.127",
+				Gateway:    "192.168.0.1",
+				ExcludeIPs: []string{"192.168.0.100"},
+			},
+			expectedBlocks: []string{"192.168.0.0/28", "192.168.0.100/32", "192.168.0.128/25"},
+			expectedCount:  3,
+		},
+		{
+			name: "only gateway",
+			addressRange: &networkingv1.AddressRange{
+				CIDR:    "192.168.0.0/24",
+				Gateway: "192.168.0.1",
+			},
+			expectedBlocks: []string{"192.168.0.1/32"},
+			expectedCount:  1,
+		},
+		{
+			name: "too many blocks are truncated",
+			addressRange: &networkingv1.AddressRange{
+				CIDR:       "fd00::/64",
+				ExcludeIPs: scatteredExcludeIPs,
+			},
+			expectedCount: 20,
+		},
+		{
+			name: "invalid cidr",
+			addressRange: &networkingv1.AddressRange{
+				CIDR: "192.168.0.0",
+			},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		blocks, count, err := summarizeExcludeIPBlocks(test.addressRange)
+		if (err != nil) != test.expectError {
+			t.Errorf("test %v failed, expect error %v but got %v", test.name, test.expectError, err)
+			continue
+		}
+
+		if count != test.expectedCount {
+			t.Errorf("test %v failed, expect count %v but got %v", test.name, test.expectedCount, count)
+		}
+
+		if len(blocks) > maxListedExcludeIPBlocks {
+			t.Errorf("test %v failed, %v blocks listed more than %v", test.name, len(blocks), maxListedExcludeIPBlocks)
+		}
+
+		if test.expectedBlocks != nil && fmt.Sprint(blocks) != fmt.Sprint(test.expectedBlocks) {
+			t.Errorf("test %v failed, expect blocks %v but got %v", test.name, test.expectedBlocks, blocks)
+		}
+	}
+}
@@ -84,6 +84,29 @@ func ListIPInstances(ctx context.Context, client client.Reader, opts ...client.L
 	return &ipList, nil
 }
 
+// ListIPInstancesInPages lists IPInstances page by page with Limit and Continue and handles them one by one,
+// which bounds the peak memory of listing a large amount of IPInstances. The reader must support Continue,
+// e.g., an API reader, because results of a cache reader are truncated by Limit without Continue.
+func ListIPInstancesInPages(ctx context.Context, c client.Reader, pageSize int64,
+	handle func(ipInstance *networkingv1.IPInstance), opts ...client.ListOption) error {
+	var continueToken string
+	for {
+		var ipList = &networkingv1.IPInstanceList{}
+		var pageOpts = append(append([]client.ListOption{}, opts...), client.Limit(pageSize), client.Continue(continueToken))
+		if err := c.List(ctx, ipList, pageOpts...); err != nil {
+			return err
+		}
+
+		for i := range ipList.Items {
+			handle(&ipList.Items[i])
+		}
+
+		if continueToken = ipList.Continue; len(continueToken) == 0 {
+			return nil
+		}
+	}
+}
+
 func ListActiveNodesToNames(ctx context.Context, client client.Reader, opts ...client.ListOption) ([]string, error) {
 	var nodeList = corev1.NodeList{}
 	if err := client.List(ctx, &nodeList, opts...); err != nil {
@@ -208,6 +231,27 @@ func FindOverlayNetwork(ctx context.Context, client client.Reader) (overlayNetwo
 	return
 }
 
+// FindOverlayNetworkForNode returns the overlay network if it selects the node, an overlay network without
+// node selector selects all nodes.
+func FindOverlayNetworkForNode(ctx context.Context, client client.Reader, nodeLabels map[string]string) (overlayNetworkName string, err error) {
+	var networkList *networkingv1.NetworkList
+	if networkList, err = ListNetworks(ctx, client); err != nil {
+		return
+	}
+
+	for i := range networkList.Items {
+		var network = networkList.Items[i]
+		if networkingv1.GetNetworkType(&network) == networkingv1.NetworkTypeOverlay {
+			if len(network.Spec.NodeSelector) > 0 &&
+				!labels.SelectorFromSet(network.Spec.NodeSelector).Matches(labels.Set(nodeLabels)) {
+				return "", nil
+			}
+			return network.Name, nil
+		}
+	}
+	return
+}
+
 func FindGlobalBGPNetwork(ctx context.Context, client client.Reader) (globalBGPNetworkName string, err error) {
 	var networkList *networkingv1.NetworkList
 	if networkList, err = ListNetworks(ctx, client); err != nil {
@@ -247,7 +291,7 @@ func DetectNetworkAttachmentOfNode(ctx context.Context, client client.Reader, no
 		return
 	}
 	var overlayNetworkName string
-	if overlayNetworkName, err = FindOverlayNetwork(ctx, client); err != nil {
+	if overlayNetworkName, err = FindOverlayNetworkForNode(ctx, client, node.GetLabels()); err != nil {
 		return
 	}
 
@@ -26,6 +26,7 @@ type CallbackSet interface {
 	Insert(item string)
 	Delete(item string)
 	Has(item string) bool
+	List() []string
 	WithCallback(callbackFunc func()) CallbackSet
 }
 
@@ -79,6 +80,13 @@ func (c *callbackSet) Has(item string) bool {
 	return c.sets.Has(item)
 }
 
+func (c *callbackSet) List() []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.sets.List()
+}
+
 func (c *callbackSet) WithCallback(callbackFunc func()) CallbackSet {
 	c.Lock()
 	defer c.Unlock()
@@ -19,12 +19,14 @@ package addr
 import (
 	"fmt"
 	"net"
+	"sort"
 
 	daemonutils "github.com/alibaba/hybridnet/pkg/daemon/utils"
 
 	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
 	"github.com/alibaba/hybridnet/pkg/utils"
 
+	"github.com/go-logr/logr"
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 
@@ -39,6 +41,22 @@ type Manager struct {
 
 	// one valid local pod to one subnet and one local vlan interface name
 	interfaceToSubnetMap map[string]subnetToPodMap
+
+	// interfaces on which enhanced addresses are not managed, exist ones will be cleaned
+	disabledInterfaces map[string]bool
+
+	// extra mode to set on forward interfaces with enhanced addresses, and the modes turned on by this manager
+	forwardInterfaceMode ForwardInterfaceMode
+	managedLinkModes     map[string]ForwardInterfaceMode
+	linkModeOperator     linkModeOperator
+
+	// arp_announce and arp_ignore values to set on forward interfaces with enhanced addresses
+	arpAnnounce int
+	arpIgnore   int
+	getSysctl   func(sysctlPath string) (int, error)
+	setSysctl   func(sysctlPath string, newVal int) error
+
+	logger logr.Logger
 }
 
 func CreateAddrManager(family int, nodeName string) *Manager {
@@ -46,6 +64,28 @@ func CreateAddrManager(family int, nodeName string) *Manager {
 		family:               family,
 		localNodeName:        nodeName,
 		interfaceToSubnetMap: map[string]subnetToPodMap{},
+		disabledInterfaces:   map[string]bool{},
+		managedLinkModes:     map[string]ForwardInterfaceMode{},
+		linkModeOperator:     netlinkLinkModeOperator{},
+		arpAnnounce:          ARPParameterUnset,
+		arpIgnore:            ARPParameterUnset,
+		getSysctl:            daemonutils.GetSysctl,
+		setSysctl:            daemonutils.SetSysctl,
+		logger:               logr.Discard(),
+	}
+}
+
+// SetLogger sets the logger of manager, logs are discarded by default.
+func (m *Manager) SetLogger(logger logr.Logger) {
+	m.logger = logger
+}
+
+// SetDisabledInterfaces disables enhanced address management on interfaces, enhanced addresses previously
+// added on them will be cleaned in the next sync and no new ones will be added.
+func (m *Manager) SetDisabledInterfaces(interfaceNames []string) {
+	m.disabledInterfaces = map[string]bool{}
+	for _, name := range interfaceNames {
+		m.disabledInterfaces[name] = true
 	}
 }
 
@@ -64,17 +104,52 @@ func (m *Manager) TryAddPodInfo(forwardNodeIfName string, subnet *net.IPNet, pod
 	}
 }
 
+// sortedForwardLinkNames returns the sorted names of forward interfaces which need enhanced addresses.
+func (m *Manager) sortedForwardLinkNames() []string {
+	var linkNames []string
+	for linkName := range m.interfaceToSubnetMap {
+		if !m.disabledInterfaces[linkName] {
+			linkNames = append(linkNames, linkName)
+		}
+	}
+	sort.Strings(linkNames)
+	return linkNames
+}
+
+// AddrOperation is a planned operation on an enhanced address of a link.
+type AddrOperation struct {
+	LinkName string
+	Addr     netlink.Addr
+
+	// OutOfDateAddr is the exist enhanced address in the same subnet which will be replaced by Addr,
+	// only for operations to add.
+	OutOfDateAddr *netlink.Addr
+}
+
+// SyncPlan contains the enhanced addresses which will be added, deleted or kept by SyncAddresses.
+type SyncPlan struct {
+	ToAdd    []AddrOperation
+	ToDelete []AddrOperation
+	ToKeep   []AddrOperation
+
+	// MisScoped contains the exist enhanced addresses whose scope is not "link", which might be selected
+	// as source ip. They are only reported.
+	MisScoped []AddrOperation
+}
+
 // SyncAddresses try to add an "enhanced" addresses on vlan node forward interface
 // For some environments, physical router or switcher might check the sender address
 // of arp request, if the sender ip address is not in the same subnet of target address
 // the arp request will be take as invalid and dropped.
 //
 // So we will always keep an valid local pod address in the vlan interface without local routes.
-func (m *Manager) SyncAddresses(getIPInstanceByAddress func(net.IP) (*networkingv1.IPInstance, error)) error {
-	// clear all invalid enhanced addresses
+//
+// If dryRun is true, the planned operations will be returned without being applied.
+func (m *Manager) SyncAddresses(getIPInstanceByAddress func(net.IP) (*networkingv1.IPInstance, error),
+	dryRun bool) (*SyncPlan, error) {
 	linkList, err := netlink.LinkList()
 	if err != nil {
-		return fmt.Errorf("failed to list link: %v", err)
+		return nil, fmt.Errorf("failed to list link: %v", err)
 	}
 
 	existEnhancedAddrMap := map[string]map[string]netlink.Addr{}
@@ -89,13 +164,13 @@ func (m *Manager) SyncAddresses(getIPInstanceByAddress func(net.IP) (*networking
 
 		addrList, err := netlink.AddrList(link, m.family)
 		if err != nil {
-			return fmt.Errorf("failed to list addresses for link %v: %v", link.Attrs().Name, err)
+			return nil, fmt.Errorf("failed to list addresses for link %v: %v", link.Attrs().Name, err)
 		}
 
 		for _, addr := range addrList {
 			isEnhancedAddr, err := checkIfEnhancedAddr(link, addr, m.family)
 			if err != nil {
-				return fmt.Errorf("failed to check addr %v enhanced address: %v", addr.String(), err)
+				return nil, fmt.Errorf("failed to check addr %v enhanced address: %v", addr.String(), err)
 			}
 
 			linkName := link.Attrs().Name
@@ -117,79 +192,122 @@ func (m *Manager) SyncAddresses(getIPInstanceByAddress func(net.IP) (*networking
 		existLinkMap[link.Attrs().Name] = link
 	}
 
+	plan, err := m.planAddresses(existEnhancedAddrMap, existManualAddrSubnetMap, getIPInstanceByAddress)
+	if err != nil {
+		return nil, err
+	}
+	plan.MisScoped = findMisScopedEnhancedAddrs(existEnhancedAddrMap)
+
+	if dryRun {
+		return plan, nil
+	}
+
 	// clear enhanced addresses which are impossible to be used
-	for existLinkName, existSubnetMap := range existEnhancedAddrMap {
-		if targetSubnetMap, exist := m.interfaceToSubnetMap[existLinkName]; !exist {
-			// link doesn't need enhanced address any more
-			for _, enhancedAddr := range existSubnetMap {
-				if err := netlink.AddrDel(existLinkMap[existLinkName], &enhancedAddr); err != nil {
-					return fmt.Errorf("failed to delete link enhanced addr %v: %v", enhancedAddr.String(), err)
-				}
+	for _, operation := range plan.ToDelete {
+		if err := netlink.AddrDel(existLinkMap[operation.LinkName], &operation.Addr); err != nil {
+			return nil, fmt.Errorf("failed to delete link enhanced addr %v: %v", operation.Addr.String(), err)
+		}
+	}
+
+	// ensure all needed enhanced addresses
+	for _, operation := range plan.ToAdd {
+		forwardNodeIf, err := netlink.LinkByName(operation.LinkName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find interface %v: %v", operation.LinkName, err)
+		}
+
+		if err := ensureSubnetEnhancedAddr(forwardNodeIf, &operation.Addr, operation.OutOfDateAddr, m.family); err != nil {
+			return nil, fmt.Errorf("failed to ensure subnet enhanced addr %v: %v", operation.Addr.IP.String(), err)
+		}
+	}
+
+	// some switches check the sender ip of arp requests, which is chosen by arp_announce
+	if m.arpAnnounce != ARPParameterUnset || m.arpIgnore != ARPParameterUnset {
+		for _, linkName := range m.sortedForwardLinkNames() {
+			if _, exist := existLinkMap[linkName]; !exist {
+				continue
 			}
-		} else {
-			// subnet doesn't need enhanced address any more
-			for subnetString, enhancedAddr := range existSubnetMap {
-				if _, exist := targetSubnetMap[subnetString]; !exist {
-					if err := netlink.AddrDel(existLinkMap[existLinkName], &enhancedAddr); err != nil {
-						return fmt.Errorf("failed to delete link subnet enhanced addr %v : %v", enhancedAddr.String(), err)
-					}
-				}
+
+			if err := m.EnsureARPParameters(linkName, m.arpAnnounce, m.arpIgnore); err != nil {
+				return nil, fmt.Errorf("failed to ensure arp parameters of interface %v: %v", linkName, err)
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// planAddresses computes the enhanced address operations from exist addresses of links, without any netlink mutation.
+func (m *Manager) planAddresses(existEnhancedAddrMap map[string]map[string]netlink.Addr,
+	existManualAddrSubnetMap map[string]map[string]bool,
+	getIPInstanceByAddress func(net.IP) (*networkingv1.IPInstance, error)) (*SyncPlan, error) {
+	plan := &SyncPlan{}
+
+	for existLinkName, existSubnetMap := range existEnhancedAddrMap {
+		targetSubnetMap := m.interfaceToSubnetMap[existLinkName]
+		if m.disabledInterfaces[existLinkName] {
+			targetSubnetMap = nil
+		}
+
+		for subnetString, enhancedAddr := range existSubnetMap {
+			// link or subnet doesn't need enhanced address any more
+			if _, exist := targetSubnetMap[subnetString]; !exist {
+				plan.ToDelete = append(plan.ToDelete, AddrOperation{
+					LinkName: existLinkName,
+					Addr:     enhancedAddr,
+				})
 			}
 		}
 	}
 
-	// ensure all needed enhanced addresses
 	for forwardNodeIfName, targetSubnetMap := range m.interfaceToSubnetMap {
-		forwardNodeIf, err := netlink.LinkByName(forwardNodeIfName)
-		if err != nil {
-			return fmt.Errorf("failed to find interface %v: %v", forwardNodeIfName, err)
+		if m.disabledInterfaces[forwardNodeIfName] {
+			continue
 		}
 
 		for subnetString, podIP := range targetSubnetMap {
 			var outOfDateEnhancedAddr *netlink.Addr
 
 			// check if manual address exist for subnet, if exist, don't do anything
-			if _, exist := existManualAddrSubnetMap[forwardNodeIfName]; exist {
-				if _, exist := existManualAddrSubnetMap[forwardNodeIfName][subnetString]; exist {
-					// When add a new address to an interface with old addresses exist, and mask length
-					// of all address are different, new address will never become a secondary address.
-					continue
-				}
+			if existManualAddrSubnetMap[forwardNodeIfName][subnetString] {
+				// When add a new address to an interface with old addresses exist, and mask length
+				// of all address are different, new address will never become a secondary address.
+				continue
 			}
 
-			if _, exist := existEnhancedAddrMap[forwardNodeIfName]; exist {
-				// subnet enhanced address already exists
-				if _, exist := existEnhancedAddrMap[forwardNodeIfName][subnetString]; exist {
-					// if forward node interface has exist enhanced address which is in the same subnet with target pod ip
-					if enhancedAddr, exist := existEnhancedAddrMap[forwardNodeIfName][subnetString]; exist {
-						// enhanced address attempt to add is the same as origin
-						if enhancedAddr.IP.Equal(podIP) {
-							continue
-						}
-
-						// check if exist enhanced address is valid
-						ipInstance, err := getIPInstanceByAddress(enhancedAddr.IP)
-						if err != nil {
-							return fmt.Errorf("failed to get ip instance by address %v: %v", enhancedAddr.IP.String(), err)
-						}
-
-						if ipInstance != nil {
-							nodeName := ipInstance.Labels[constants.LabelNode]
-							if nodeName == m.localNodeName {
-								// exist enhanced address is still valid, just keep it
-								continue
-							}
-						}
-
-						// ip instance not found or is no longer in this node, need to be refreshed
-						outOfDateEnhancedAddr = &enhancedAddr
+			// if forward node interface has exist enhanced address which is in the same subnet with target pod ip
+			if enhancedAddr, exist := existEnhancedAddrMap[forwardNodeIfName][subnetString]; exist {
+				keep := false
+
+				// enhanced address attempt to add is the same as origin
+				if enhancedAddr.IP.Equal(podIP) {
+					keep = true
+				} else {
+					// check if exist enhanced address is valid
+					ipInstance, err := getIPInstanceByAddress(enhancedAddr.IP)
+					if err != nil {
+						return nil, fmt.Errorf("failed to get ip instance by address %v: %v", enhancedAddr.IP.String(), err)
 					}
+
+					// exist enhanced address is still valid, just keep it
+					keep = ipInstance != nil && ipInstance.Labels[constants.LabelNode] == m.localNodeName
+				}
+
+				if keep {
+					plan.ToKeep = append(plan.ToKeep, AddrOperation{
+						LinkName: forwardNodeIfName,
+						Addr:     enhancedAddr,
+					})
+					continue
 				}
+
+				// ip instance not found or is no longer in this node, need to be refreshed
+				outOfDateEnhancedAddr = &enhancedAddr
 			}
 
 			_, subnetCidr, err := net.ParseCIDR(subnetString)
 			if err != nil {
-				return fmt.Errorf("failed to parse subnet cidr %v: %v", subnetString, err)
+				return nil, fmt.Errorf("failed to parse subnet cidr %v: %v", subnetString, err)
 			}
 
 			// ARP sender IP selection is totally independent with IP source selection. ARP sender IP
@@ -227,19 +345,25 @@ func (m *Manager) SyncAddresses(getIPInstanceByAddress func(net.IP) (*networking
 			// underlay vlan subnets, are never supposed to be added to enhanced-address-attached interfaces directly by
 			// host. Because of that, we can make the enhanced addresses never be selected as source IP by creating them
 			// with "link" scope.
-			if err := ensureSubnetEnhancedAddr(forwardNodeIf, &netlink.Addr{
-				IPNet: &net.IPNet{
-					IP:   podIP,
-					Mask: subnetCidr.Mask,
+			plan.ToAdd = append(plan.ToAdd, AddrOperation{
+				LinkName: forwardNodeIfName,
+				Addr: netlink.Addr{
+					IPNet: &net.IPNet{
+						IP:   podIP,
+						Mask: subnetCidr.Mask,
+					},
+					Label: enhancedAddrLabel(forwardNodeIfName, m.family),
+					Flags: unix.IFA_F_NOPREFIXROUTE,
+					Scope: unix.RT_SCOPE_LINK,
 				},
-				Label: "",
-				Flags: unix.IFA_F_NOPREFIXROUTE,
-				Scope: unix.RT_SCOPE_LINK,
-			}, outOfDateEnhancedAddr, m.family); err != nil {
-				return fmt.Errorf("failed to ensure subnet enhanced addr %v: %v", podIP.String(), err)
-			}
+				OutOfDateAddr: outOfDateEnhancedAddr,
+			})
 		}
 	}
 
-	return nil
+	sortAddrOperations(plan.ToAdd)
+	sortAddrOperations(plan.ToDelete)
+	sortAddrOperations(plan.ToKeep)
+
+	return plan, nil
 }
@@ -0,0 +1,167 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package addr
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+	"github.com/alibaba/hybridnet/pkg/constants"
+)
+
+func TestPlanAddresses(t *testing.T) {
+	newAddr := func(cidr string) netlink.Addr {
+		ip, ipNet, _ := net.ParseCIDR(cidr)
+		ipNet.IP = ip
+		return netlink.Addr{IPNet: ipNet}
+	}
+
+	m := CreateAddrManager(netlink.FAMILY_V4, "node1")
+	m.TryAddPodInfo("eth0.100", &net.IPNet{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.0.5"))
+	m.TryAddPodInfo("eth0.100", &net.IPNet{IP: net.ParseIP("10.0.1.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.1.5"))
+	m.TryAddPodInfo("eth0.100", &net.IPNet{IP: net.ParseIP("10.0.2.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.2.5"))
+	m.TryAddPodInfo("eth0.100", &net.IPNet{IP: net.ParseIP("10.0.3.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.3.5"))
+	m.TryAddPodInfo("eth0.200", &net.IPNet{IP: net.ParseIP("10.0.4.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.4.5"))
+	m.TryAddPodInfo("eth0.200", &net.IPNet{IP: net.ParseIP("10.0.5.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.5.5"))
+
+	existEnhancedAddrMap := map[string]map[string]netlink.Addr{
+		"eth0.100": {
+			// same as target, keep
+			"10.0.0.0/24": newAddr("10.0.0.5/24"),
+			// still valid on local node, keep
+			"10.0.1.0/24": newAddr("10.0.1.6/24"),
+			// moved to another node, replace
+			"10.0.2.0/24": newAddr("10.0.2.6/24"),
+			// subnet not needed any more, delete
+			"10.0.9.0/24": newAddr("10.0.9.5/24"),
+		},
+		// link not needed any more, delete
+		"eth0.300": {
+			"10.0.8.0/24": newAddr("10.0.8.5/24"),
+		},
+	}
+
+	existManualAddrSubnetMap := map[string]map[string]bool{
+		"eth0.200": {
+			"10.0.5.0/24": true,
+		},
+	}
+
+	ipInstances := map[string]*networkingv1.IPInstance{
+		"10.0.1.6": {ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{constants.LabelNode: "node1"}}},
+		"10.0.2.6": {ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{constants.LabelNode: "node2"}}},
+	}
+
+	plan, err := m.planAddresses(existEnhancedAddrMap, existManualAddrSubnetMap, func(ip net.IP) (*networkingv1.IPInstance, error) {
+		return ipInstances[ip.String()], nil
+	})
+	if err != nil {
+		t.Fatalf("failed to plan addresses: %v", err)
+	}
+
+	operationStrings := func(operations []AddrOperation) []string {
+		var result []string
+		for _, operation := range operations {
+			operationString := fmt.Sprintf("%v %v", operation.LinkName, operation.Addr.IPNet.String())
+			if operation.OutOfDateAddr != nil {
+				operationString += " replace " + operation.OutOfDateAddr.IPNet.String()
+			}
+			result = append(result, operationString)
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	expectedToAdd := []string{
+		"eth0.100 10.0.2.5/24 replace 10.0.2.6/24",
+		"eth0.100 10.0.3.5/24",
+		"eth0.200 10.0.4.5/24",
+	}
+	expectedToDelete := []string{
+		"eth0.100 10.0.9.5/24",
+		"eth0.300 10.0.8.5/24",
+	}
+	expectedToKeep := []string{
+		"eth0.100 10.0.0.5/24",
+		"eth0.100 10.0.1.6/24",
+	}
+
+	if fmt.Sprint(operationStrings(plan.ToAdd)) != fmt.Sprint(expectedToAdd) {
+		t.Errorf("expected to add %v, got %v", expectedToAdd, operationStrings(plan.ToAdd))
+	}
+	if fmt.Sprint(operationStrings(plan.ToDelete)) != fmt.Sprint(expectedToDelete) {
+		t.Errorf("expected to delete %v, got %v", expectedToDelete, operationStrings(plan.ToDelete))
+	}
+	if fmt.Sprint(operationStrings(plan.ToKeep)) != fmt.Sprint(expectedToKeep) {
+		t.Errorf("expected to keep %v, got %v", expectedToKeep, operationStrings(plan.ToKeep))
+	}
+}
+
+func TestPlanAddressesWithDisabledInterfaces(t *testing.T) {
+	newAddr := func(cidr string) netlink.Addr {
+		ip, ipNet, _ := net.ParseCIDR(cidr)
+		ipNet.IP = ip
+		return netlink.Addr{IPNet: ipNet}
+	}
+
+	m := CreateAddrManager(netlink.FAMILY_V4, "node1")
+	m.SetDisabledInterfaces([]string{"eth0.100"})
+	m.TryAddPodInfo("eth0.100", &net.IPNet{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.0.5"))
+	m.TryAddPodInfo("eth0.100", &net.IPNet{IP: net.ParseIP("10.0.1.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.1.5"))
+	m.TryAddPodInfo("eth0.200", &net.IPNet{IP: net.ParseIP("10.0.4.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.4.5"))
+
+	getIPInstance := func(ip net.IP) (*networkingv1.IPInstance, error) {
+		return nil, nil
+	}
+
+	// enhanced address previously added on disabled interface is cleaned
+	plan, err := m.planAddresses(map[string]map[string]netlink.Addr{
+		"eth0.100": {
+			"10.0.0.0/24": newAddr("10.0.0.5/24"),
+		},
+	}, map[string]map[string]bool{}, getIPInstance)
+	if err != nil {
+		t.Fatalf("failed to plan addresses: %v", err)
+	}
+
+	if len(plan.ToDelete) != 1 || plan.ToDelete[0].LinkName != "eth0.100" || len(plan.ToKeep) != 0 {
+		t.Errorf("expect enhanced address on disabled interface to be deleted, got %+v", plan)
+	}
+	if len(plan.ToAdd) != 1 || plan.ToAdd[0].LinkName != "eth0.200" {
+		t.Errorf("expect enhanced address to be added only on enabled interface, got %+v", plan.ToAdd)
+	}
+
+	// nothing to do on disabled interface once cleaned
+	plan, err = m.planAddresses(map[string]map[string]netlink.Addr{
+		"eth0.200": {
+			"10.0.4.0/24": newAddr("10.0.4.5/24"),
+		},
+	}, map[string]map[string]bool{}, getIPInstance)
+	if err != nil {
+		t.Fatalf("failed to plan addresses: %v", err)
+	}
+
+	if len(plan.ToAdd) != 0 || len(plan.ToDelete) != 0 || len(plan.ToKeep) != 1 {
+		t.Errorf("expect no operation on disabled interface after cleaned, got %+v", plan)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package addr
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/alibaba/hybridnet/pkg/constants"
+)
+
+// ARPParameterUnset means the arp parameter is not managed and kept untouched.
+const ARPParameterUnset = -1
+
+// ValidateARPParameters checks the arp_announce and arp_ignore values, ARPParameterUnset is allowed for both.
+func ValidateARPParameters(announce, ignore int) error {
+	if announce != ARPParameterUnset && (announce < 0 || announce > 2) {
+		return fmt.Errorf("invalid arp_announce %v, should be in range 0~2", announce)
+	}
+
+	if ignore != ARPParameterUnset && (ignore < 0 || ignore > 3) && ignore != 8 {
+		return fmt.Errorf("invalid arp_ignore %v, should be in range 0~3 or 8", ignore)
+	}
+	return nil
+}
+
+// SetARPParameters sets the arp_announce and arp_ignore values of forward interfaces with enhanced addresses,
+// they take effect in the next SyncAddresses. ARPParameterUnset means the parameter is not managed.
+func (m *Manager) SetARPParameters(announce, ignore int) {
+	m.arpAnnounce = announce
+	m.arpIgnore = ignore
+}
+
+// EnsureARPParameters writes the arp_announce and arp_ignore sysctls of interface if they are different from
+// the desired values, ARPParameterUnset means the parameter is kept untouched. It's a no-op for ipv6.
+func (m *Manager) EnsureARPParameters(ifName string, announce, ignore int) error {
+	if m.family != netlink.FAMILY_V4 {
+		return nil
+	}
+
+	for _, parameter := range []struct {
+		sysctlFormat string
+		value        int
+	}{
+		{constants.ArpAnnounceSysctl, announce},
+		{constants.ArpIgnoreSysctl, ignore},
+	} {
+		if parameter.value == ARPParameterUnset {
+			continue
+		}
+
+		sysctlPath := fmt.Sprintf(parameter.sysctlFormat, ifName)
+		current, err := m.getSysctl(sysctlPath)
+		if err != nil {
+			return fmt.Errorf("failed to get %s sysctl path: %v", sysctlPath, err)
+		}
+
+		if current == parameter.value {
+			continue
+		}
+
+		m.logger.Info("arp parameter of interface is different from desired, reset it", "interface", ifName,
+			"sysctl", sysctlPath, "current", current, "desired", parameter.value)
+
+		if err := m.setSysctl(sysctlPath, parameter.value); err != nil {
+			return fmt.Errorf("failed to set %s sysctl path to %v, error: %v", sysctlPath, parameter.value, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package addr
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestValidateARPParameters(t *testing.T) {
+	testCases := []struct {
+		announce  int
+		ignore    int
+		expectErr bool
+	}{
+		{ARPParameterUnset, ARPParameterUnset, false},
+		{2, ARPParameterUnset, false},
+		{0, 8, false},
+		{1, 3, false},
+		{3, 0, true},
+		{-2, 0, true},
+		{2, 4, true},
+	}
+
+	for _, test := range testCases {
+		if err := ValidateARPParameters(test.announce, test.ignore); (err != nil) != test.expectErr {
+			t.Errorf("announce %v, ignore %v: expect error %v but got %v", test.announce, test.ignore,
+				test.expectErr, err)
+		}
+	}
+}
+
+func TestEnsureARPParameters(t *testing.T) {
+	newManager := func(family int, sysctls map[string]int, written *[]string) *Manager {
+		m := CreateAddrManager(family, "node1")
+		m.getSysctl = func(sysctlPath string) (int, error) {
+			value, exist := sysctls[sysctlPath]
+			if !exist {
+				return -1, fmt.Errorf("%v not exist", sysctlPath)
+			}
+			return value, nil
+		}
+		m.setSysctl = func(sysctlPath string, newVal int) error {
+			sysctls[sysctlPath] = newVal
+			*written = append(*written, sysctlPath)
+			return nil
+		}
+		return m
+	}
+
+	sysctls := map[string]int{
+		"/proc/sys/net/ipv4/conf/eth0.100/arp_announce": 0,
+		"/proc/sys/net/ipv4/conf/eth0.100/arp_ignore":   1,
+	}
+	var written []string
+	m := newManager(netlink.FAMILY_V4, sysctls, &written)
+
+	if err := m.EnsureARPParameters("eth0.100", 2, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"/proc/sys/net/ipv4/conf/eth0.100/arp_announce"}; !reflect.DeepEqual(written, expected) {
+		t.Errorf("expect only %v written but got %v", expected, written)
+	}
+	if sysctls["/proc/sys/net/ipv4/conf/eth0.100/arp_announce"] != 2 {
+		t.Errorf("expect arp_announce set to 2 but got %v", sysctls["/proc/sys/net/ipv4/conf/eth0.100/arp_announce"])
+	}
+
+	// values already desired and unset ones are untouched
+	written = nil
+	if err := m.EnsureARPParameters("eth0.100", 2, ARPParameterUnset); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(written) != 0 {
+		t.Errorf("expect nothing written but got %v", written)
+	}
+
+	if err := m.EnsureARPParameters("eth0.200", 2, 1); err == nil {
+		t.Errorf("expect error for interface without sysctls")
+	}
+
+	// no-op for ipv6
+	var v6Written []string
+	v6Manager := newManager(netlink.FAMILY_V6, map[string]int{}, &v6Written)
+	if err := v6Manager.EnsureARPParameters("eth0.100", 2, 1); err != nil || len(v6Written) != 0 {
+		t.Errorf("expect no-op for ipv6 but got error %v and written %v", err, v6Written)
+	}
+}
@@ -0,0 +1,187 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package addr
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+)
+
+// ForwardInterfaceMode is the extra mode to set on forward interfaces with enhanced addresses. Some bridged
+// underlay fabrics only deliver the ARP replies of enhanced addresses to interfaces in allmulti or promiscuous
+// mode. Both modes make the interface receive more traffic than it needs, so they are never set by default.
+type ForwardInterfaceMode string
+
+const (
+	ForwardInterfaceModeNone     ForwardInterfaceMode = ""
+	ForwardInterfaceModeAllmulti ForwardInterfaceMode = "allmulti"
+	ForwardInterfaceModePromisc  ForwardInterfaceMode = "promisc"
+)
+
+// ParseForwardInterfaceMode parses a forward interface mode, an empty string means no extra mode.
+func ParseForwardInterfaceMode(mode string) (ForwardInterfaceMode, error) {
+	switch ForwardInterfaceMode(mode) {
+	case ForwardInterfaceModeNone, ForwardInterfaceModeAllmulti, ForwardInterfaceModePromisc:
+		return ForwardInterfaceMode(mode), nil
+	default:
+		return ForwardInterfaceModeNone, fmt.Errorf("unknown forward interface mode %q, only %q and %q are supported",
+			mode, ForwardInterfaceModeAllmulti, ForwardInterfaceModePromisc)
+	}
+}
+
+// linkModeOperator reads and switches the modes of links by name, exist is false if the link is not found.
+type linkModeOperator interface {
+	IsOn(linkName string, mode ForwardInterfaceMode) (exist, on bool, err error)
+	SetOn(linkName string, mode ForwardInterfaceMode) error
+	SetOff(linkName string, mode ForwardInterfaceMode) error
+}
+
+type netlinkLinkModeOperator struct{}
+
+func (netlinkLinkModeOperator) IsOn(linkName string, mode ForwardInterfaceMode) (bool, bool, error) {
+	link, err := netlink.LinkByName(linkName)
+	if err != nil {
+		var notFound netlink.LinkNotFoundError
+		if errors.As(err, &notFound) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+
+	switch mode {
+	case ForwardInterfaceModeAllmulti:
+		return true, link.Attrs().Allmulti == 1, nil
+	case ForwardInterfaceModePromisc:
+		return true, link.Attrs().Promisc == 1, nil
+	}
+	return true, false, nil
+}
+
+func (netlinkLinkModeOperator) SetOn(linkName string, mode ForwardInterfaceMode) error {
+	link, err := netlink.LinkByName(linkName)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case ForwardInterfaceModeAllmulti:
+		return netlink.LinkSetAllmulticastOn(link)
+	case ForwardInterfaceModePromisc:
+		return netlink.SetPromiscOn(link)
+	}
+	return nil
+}
+
+func (netlinkLinkModeOperator) SetOff(linkName string, mode ForwardInterfaceMode) error {
+	link, err := netlink.LinkByName(linkName)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case ForwardInterfaceModeAllmulti:
+		return netlink.LinkSetAllmulticastOff(link)
+	case ForwardInterfaceModePromisc:
+		return netlink.SetPromiscOff(link)
+	}
+	return nil
+}
+
+// SetForwardInterfaceMode sets the extra mode of forward interfaces with enhanced addresses, it takes effect
+// in the next SyncForwardInterfaceModes.
+func (m *Manager) SetForwardInterfaceMode(mode ForwardInterfaceMode) {
+	m.forwardInterfaceMode = mode
+}
+
+// SyncForwardInterfaceModes turns the configured mode on for the forward interfaces which need enhanced
+// addresses, and turns it off for interfaces which don't need it any more.
+//
+// Only the modes turned on by this manager will be turned off, a mode which is already on before is kept
+// untouched. Modes are not reverted across daemon restarts, CleanForwardInterfaceModes should be called on exit.
+func (m *Manager) SyncForwardInterfaceModes() error {
+	var targetLinkNames []string
+	if m.forwardInterfaceMode != ForwardInterfaceModeNone {
+		targetLinkNames = m.sortedForwardLinkNames()
+	}
+
+	for _, linkName := range m.sortedManagedLinkNames() {
+		mode := m.managedLinkModes[linkName]
+		if _, needed := m.interfaceToSubnetMap[linkName]; needed && !m.disabledInterfaces[linkName] &&
+			mode == m.forwardInterfaceMode {
+			continue
+		}
+		if err := m.turnOffLinkMode(linkName, mode); err != nil {
+			return err
+		}
+	}
+
+	for _, linkName := range targetLinkNames {
+		exist, on, err := m.linkModeOperator.IsOn(linkName, m.forwardInterfaceMode)
+		if err != nil {
+			return fmt.Errorf("failed to check %v mode of interface %v: %v", m.forwardInterfaceMode, linkName, err)
+		}
+
+		// the interface might be created later, and an already-on mode is kept untouched
+		if !exist || on {
+			continue
+		}
+
+		if err := m.linkModeOperator.SetOn(linkName, m.forwardInterfaceMode); err != nil {
+			return fmt.Errorf("failed to turn on %v mode of interface %v: %v", m.forwardInterfaceMode, linkName, err)
+		}
+		m.managedLinkModes[linkName] = m.forwardInterfaceMode
+	}
+
+	return nil
+}
+
+// CleanForwardInterfaceModes turns off all the modes turned on by this manager.
+func (m *Manager) CleanForwardInterfaceModes() error {
+	for _, linkName := range m.sortedManagedLinkNames() {
+		if err := m.turnOffLinkMode(linkName, m.managedLinkModes[linkName]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) turnOffLinkMode(linkName string, mode ForwardInterfaceMode) error {
+	exist, on, err := m.linkModeOperator.IsOn(linkName, mode)
+	if err != nil {
+		return fmt.Errorf("failed to check %v mode of interface %v: %v", mode, linkName, err)
+	}
+
+	if exist && on {
+		if err := m.linkModeOperator.SetOff(linkName, mode); err != nil {
+			return fmt.Errorf("failed to turn off %v mode of interface %v: %v", mode, linkName, err)
+		}
+	}
+	delete(m.managedLinkModes, linkName)
+	return nil
+}
+
+func (m *Manager) sortedManagedLinkNames() []string {
+	linkNames := make([]string, 0, len(m.managedLinkModes))
+	for linkName := range m.managedLinkModes {
+		linkNames = append(linkNames, linkName)
+	}
+	sort.Strings(linkNames)
+	return linkNames
+}
@@ -0,0 +1,138 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package addr
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+type fakeLinkModeOperator struct {
+	// link name to the modes which are on
+	links map[string]map[ForwardInterfaceMode]bool
+}
+
+func (f *fakeLinkModeOperator) IsOn(linkName string, mode ForwardInterfaceMode) (bool, bool, error) {
+	modes, exist := f.links[linkName]
+	return exist, modes[mode], nil
+}
+
+func (f *fakeLinkModeOperator) SetOn(linkName string, mode ForwardInterfaceMode) error {
+	f.links[linkName][mode] = true
+	return nil
+}
+
+func (f *fakeLinkModeOperator) SetOff(linkName string, mode ForwardInterfaceMode) error {
+	f.links[linkName][mode] = false
+	return nil
+}
+
+func TestParseForwardInterfaceMode(t *testing.T) {
+	for _, mode := range []string{"", "allmulti", "promisc"} {
+		if _, err := ParseForwardInterfaceMode(mode); err != nil {
+			t.Errorf("unexpected error for mode %q: %v", mode, err)
+		}
+	}
+
+	if _, err := ParseForwardInterfaceMode("unknown"); err == nil {
+		t.Errorf("expect error for unknown mode")
+	}
+}
+
+func TestSyncForwardInterfaceModes(t *testing.T) {
+	operator := &fakeLinkModeOperator{links: map[string]map[ForwardInterfaceMode]bool{
+		"eth0.100": {},
+		// promiscuous mode is turned on by others
+		"eth0.200": {ForwardInterfaceModePromisc: true},
+		"eth0.300": {},
+	}}
+
+	m := CreateAddrManager(netlink.FAMILY_V4, "node1")
+	m.linkModeOperator = operator
+	m.SetDisabledInterfaces([]string{"eth0.300"})
+
+	addPodInfos := func() {
+		m.TryAddPodInfo("eth0.100", &net.IPNet{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.0.5"))
+		m.TryAddPodInfo("eth0.200", &net.IPNet{IP: net.ParseIP("10.0.1.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.1.5"))
+		m.TryAddPodInfo("eth0.300", &net.IPNet{IP: net.ParseIP("10.0.2.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.2.5"))
+		// not created yet
+		m.TryAddPodInfo("eth0.400", &net.IPNet{IP: net.ParseIP("10.0.3.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.3.5"))
+	}
+	addPodInfos()
+
+	sync := func() {
+		if err := m.SyncForwardInterfaceModes(); err != nil {
+			t.Fatalf("failed to sync forward interface modes: %v", err)
+		}
+	}
+
+	// opt-in, nothing changes by default
+	sync()
+	if operator.links["eth0.100"][ForwardInterfaceModePromisc] || len(m.managedLinkModes) != 0 {
+		t.Fatalf("expect no mode is turned on by default")
+	}
+
+	m.SetForwardInterfaceMode(ForwardInterfaceModePromisc)
+	sync()
+	if !operator.links["eth0.100"][ForwardInterfaceModePromisc] {
+		t.Errorf("expect promiscuous mode of eth0.100 is turned on")
+	}
+	if operator.links["eth0.300"][ForwardInterfaceModePromisc] {
+		t.Errorf("expect promiscuous mode of disabled eth0.300 is not turned on")
+	}
+	if expected := map[string]ForwardInterfaceMode{"eth0.100": ForwardInterfaceModePromisc}; !reflect.DeepEqual(m.managedLinkModes, expected) {
+		t.Errorf("expect managed link modes %v, but got %v", expected, m.managedLinkModes)
+	}
+
+	// switching mode reverts the old one
+	m.SetForwardInterfaceMode(ForwardInterfaceModeAllmulti)
+	sync()
+	if operator.links["eth0.100"][ForwardInterfaceModePromisc] || !operator.links["eth0.100"][ForwardInterfaceModeAllmulti] {
+		t.Errorf("expect eth0.100 is switched from promiscuous to allmulti mode, but got %v", operator.links["eth0.100"])
+	}
+	if !operator.links["eth0.200"][ForwardInterfaceModeAllmulti] {
+		t.Errorf("expect allmulti mode of eth0.200 is turned on")
+	}
+
+	// interfaces which don't need enhanced addresses any more are reverted
+	m.ResetInfos()
+	m.TryAddPodInfo("eth0.200", &net.IPNet{IP: net.ParseIP("10.0.1.0").To4(), Mask: net.CIDRMask(24, 32)}, net.ParseIP("10.0.1.5"))
+	sync()
+	if operator.links["eth0.100"][ForwardInterfaceModeAllmulti] {
+		t.Errorf("expect allmulti mode of eth0.100 is turned off")
+	}
+	if !operator.links["eth0.200"][ForwardInterfaceModeAllmulti] {
+		t.Errorf("expect allmulti mode of eth0.200 is kept")
+	}
+
+	// cleanup reverts all the modes turned on by manager only
+	if err := m.CleanForwardInterfaceModes(); err != nil {
+		t.Fatalf("failed to clean forward interface modes: %v", err)
+	}
+	if operator.links["eth0.200"][ForwardInterfaceModeAllmulti] {
+		t.Errorf("expect allmulti mode of eth0.200 is turned off")
+	}
+	if !operator.links["eth0.200"][ForwardInterfaceModePromisc] {
+		t.Errorf("expect promiscuous mode of eth0.200 turned on by others is kept")
+	}
+	if len(m.managedLinkModes) != 0 {
+		t.Errorf("expect no managed link modes after cleanup, but got %v", m.managedLinkModes)
+	}
+}
@@ -19,12 +19,31 @@ package addr
 import (
 	"fmt"
 	"net"
+	"sort"
 
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 )
 
+// enhancedAddrLabelSuffix is appended to the interface name as the label of enhanced addresses, which makes
+// them recognizable. Address labels are only supported by IPv4.
+const enhancedAddrLabelSuffix = ":hn"
+
+// enhancedAddrLabel returns the label for enhanced addresses on the interface, an empty label is returned if
+// labels are not supported for the family or the label will be longer than the kernel limit.
+func enhancedAddrLabel(linkName string, family int) string {
+	if family != netlink.FAMILY_V4 || len(linkName)+len(enhancedAddrLabelSuffix) >= unix.IFNAMSIZ {
+		return ""
+	}
+	return linkName + enhancedAddrLabelSuffix
+}
+
 func checkIfEnhancedAddr(link netlink.Link, addr netlink.Addr, family int) (bool, error) {
+	// addresses labeled by hybridnet or by others are recognized without checking routes
+	if recognized, isEnhancedAddr := checkEnhancedAddrLabel(link.Attrs().Name, addr, family); recognized {
+		return isEnhancedAddr, nil
+	}
+
 	routeList, err := netlink.RouteListFiltered(family, &netlink.Route{
 		Table:     unix.RT_TABLE_LOCAL,
 		LinkIndex: link.Attrs().Index,
@@ -36,11 +55,24 @@ func checkIfEnhancedAddr(link netlink.Link, addr netlink.Addr, family int) (bool
 			link.Attrs().Name, addr.IP.String(), err)
 	}
 
-	if len(routeList) == 0 && addr.Flags&unix.IFA_F_SECONDARY == 0 && addr.Flags&unix.IFA_F_NOPREFIXROUTE != 0 {
-		return true, nil
+	return checkEnhancedAddrFlags(addr, len(routeList) != 0), nil
+}
+
+// checkEnhancedAddrLabel classifies addresses by label, recognized is false if the address has no specified label,
+// which happens for addresses created by older daemon versions, addresses of IPv6 or on interfaces with long names.
+func checkEnhancedAddrLabel(linkName string, addr netlink.Addr, family int) (recognized, isEnhancedAddr bool) {
+	if addr.Label == "" || addr.Label == linkName {
+		return false, false
 	}
 
-	return false, nil
+	label := enhancedAddrLabel(linkName, family)
+	return true, label != "" && addr.Label == label
+}
+
+// checkEnhancedAddrFlags classifies unlabeled addresses heuristically, enhanced addresses are primary addresses
+// created with "noprefixroute" and their local routes are removed.
+func checkEnhancedAddrFlags(addr netlink.Addr, hasLocalRoutes bool) bool {
+	return !hasLocalRoutes && addr.Flags&unix.IFA_F_SECONDARY == 0 && addr.Flags&unix.IFA_F_NOPREFIXROUTE != 0
 }
 
 func ensureSubnetEnhancedAddr(link netlink.Link, newEnhancedAddr, outOfDateEnhancedAddr *netlink.Addr, family int) error {
@@ -101,3 +133,30 @@ func ensureSubnetEnhancedAddr(link netlink.Link, newEnhancedAddr, outOfDateEnhan
 
 	return nil
 }
+
+// findMisScopedEnhancedAddrs finds the enhanced addresses whose scope is not "link".
+func findMisScopedEnhancedAddrs(enhancedAddrMap map[string]map[string]netlink.Addr) []AddrOperation {
+	var misScoped []AddrOperation
+	for linkName, addrMap := range enhancedAddrMap {
+		for _, addr := range addrMap {
+			if addr.Scope != unix.RT_SCOPE_LINK {
+				misScoped = append(misScoped, AddrOperation{
+					LinkName: linkName,
+					Addr:     addr,
+				})
+			}
+		}
+	}
+
+	sortAddrOperations(misScoped)
+	return misScoped
+}
+
+func sortAddrOperations(operations []AddrOperation) {
+	sort.Slice(operations, func(i, j int) bool {
+		if operations[i].LinkName != operations[j].LinkName {
+			return operations[i].LinkName < operations[j].LinkName
+		}
+		return operations[i].Addr.IPNet.String() < operations[j].Addr.IPNet.String()
+	})
+}
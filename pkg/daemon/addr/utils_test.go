@@ -0,0 +1,161 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package addr
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestEnhancedAddrLabel(t *testing.T) {
+	if label := enhancedAddrLabel("eth0.100", netlink.FAMILY_V4); label != "eth0.100:hn" {
+		t.Errorf("unexpected label %q", label)
+	}
+
+	if label := enhancedAddrLabel("eth0.100", netlink.FAMILY_V6); label != "" {
+		t.Errorf("expect no label for ipv6, but got %q", label)
+	}
+
+	if label := enhancedAddrLabel("enp125s0f1.1000", netlink.FAMILY_V4); label != "" {
+		t.Errorf("expect no label for long interface name, but got %q", label)
+	}
+}
+
+func TestCheckEnhancedAddr(t *testing.T) {
+	addr := func(label string, flags int) netlink.Addr {
+		return netlink.Addr{
+			IPNet: &net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(24, 32)},
+			Label: label,
+			Flags: flags,
+		}
+	}
+
+	tests := []struct {
+		name           string
+		addr           netlink.Addr
+		family         int
+		hasLocalRoutes bool
+		recognized     bool
+		expected       bool
+	}{
+		{
+			"labeled enhanced address",
+			addr("eth0.100:hn", unix.IFA_F_NOPREFIXROUTE),
+			netlink.FAMILY_V4,
+			false,
+			true,
+			true,
+		},
+		{
+			"labeled enhanced address with local routes",
+			addr("eth0.100:hn", unix.IFA_F_NOPREFIXROUTE),
+			netlink.FAMILY_V4,
+			true,
+			true,
+			true,
+		},
+		{
+			"similarly flagged address labeled by operator",
+			addr("eth0.100:op", unix.IFA_F_NOPREFIXROUTE),
+			netlink.FAMILY_V4,
+			false,
+			true,
+			false,
+		},
+		{
+			"legacy unlabeled enhanced address",
+			addr("eth0.100", unix.IFA_F_NOPREFIXROUTE),
+			netlink.FAMILY_V4,
+			false,
+			false,
+			true,
+		},
+		{
+			"legacy unlabeled address with local routes",
+			addr("eth0.100", unix.IFA_F_NOPREFIXROUTE),
+			netlink.FAMILY_V4,
+			true,
+			false,
+			false,
+		},
+		{
+			"unlabeled secondary address",
+			addr("eth0.100", unix.IFA_F_NOPREFIXROUTE|unix.IFA_F_SECONDARY),
+			netlink.FAMILY_V4,
+			false,
+			false,
+			false,
+		},
+		{
+			"ipv6 enhanced address",
+			addr("", unix.IFA_F_NOPREFIXROUTE),
+			netlink.FAMILY_V6,
+			false,
+			false,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recognized, isEnhancedAddr := checkEnhancedAddrLabel("eth0.100", test.addr, test.family)
+			if recognized != test.recognized {
+				t.Fatalf("expect recognized by label %v, but got %v", test.recognized, recognized)
+			}
+
+			if !recognized {
+				isEnhancedAddr = checkEnhancedAddrFlags(test.addr, test.hasLocalRoutes)
+			}
+
+			if isEnhancedAddr != test.expected {
+				t.Errorf("expect enhanced address %v, but got %v", test.expected, isEnhancedAddr)
+			}
+		})
+	}
+}
+
+func TestFindMisScopedEnhancedAddrs(t *testing.T) {
+	newAddr := func(cidr string, scope int) netlink.Addr {
+		ip, ipNet, _ := net.ParseCIDR(cidr)
+		ipNet.IP = ip
+		return netlink.Addr{IPNet: ipNet, Flags: unix.IFA_F_NOPREFIXROUTE, Scope: scope}
+	}
+
+	enhancedAddrMap := map[string]map[string]netlink.Addr{
+		"eth0.100": {
+			"192.168.100.0/24": newAddr("192.168.100.10/24", unix.RT_SCOPE_LINK),
+		},
+		"eth0.200": {
+			"192.168.200.0/24": newAddr("192.168.200.10/24", unix.RT_SCOPE_UNIVERSE),
+			"192.168.201.0/24": newAddr("192.168.201.10/24", unix.RT_SCOPE_LINK),
+		},
+	}
+
+	misScoped := findMisScopedEnhancedAddrs(enhancedAddrMap)
+	if len(misScoped) != 1 || misScoped[0].LinkName != "eth0.200" ||
+		misScoped[0].Addr.IPNet.String() != "192.168.200.10/24" {
+		t.Fatalf("expect only the global scoped address on eth0.200, but got %v", misScoped)
+	}
+
+	delete(enhancedAddrMap, "eth0.200")
+	if misScoped = findMisScopedEnhancedAddrs(enhancedAddrMap); len(misScoped) != 0 {
+		t.Errorf("expect no mis-scoped address, but got %v", misScoped)
+	}
+}
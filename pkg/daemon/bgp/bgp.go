@@ -55,6 +55,10 @@ type Manager struct {
 	ipMap     map[string]*ipInfo
 
 	startMutex sync.RWMutex
+
+	// snapshot of recorded peers for reporting session states
+	peerStatusMap   map[string]*peerStatus
+	peerStatusMutex sync.RWMutex
 }
 
 func NewManager(peeringInterfaceName, grpcListenAddress string, logger logr.Logger) (*Manager, error) {
@@ -73,6 +77,8 @@ func NewManager(peeringInterfaceName, grpcListenAddress string, logger logr.Logg
 		ipMap:     map[string]*ipInfo{},
 
 		startMutex: sync.RWMutex{},
+
+		peerStatusMap: map[string]*peerStatus{},
 	}
 
 	peeringLink, err := netlink.LinkByName(peeringInterfaceName)
@@ -168,6 +174,11 @@ func (m *Manager) RecordSubnet(cidr *net.IPNet) {
 	m.subnetMap[cidr.String()] = cidr
 }
 
+// WithdrawSubnet forgets a recorded subnet, the path of it will be withdrawn by the next SyncSubnetInfos.
+func (m *Manager) WithdrawSubnet(cidr *net.IPNet) {
+	delete(m.subnetMap, cidr.String())
+}
+
 func (m *Manager) RecordIP(ip net.IP, needToBeExported bool) {
 	m.ipMap[ip.String()] = &ipInfo{
 		ip:               ip,
@@ -240,11 +251,15 @@ func (m *Manager) SyncPeerInfos() error {
 		return nil
 	}
 
+	m.recordPeerStatuses()
+
 	for _, peer := range m.peerMap {
 		if _, exist := existPeerMap[peer.address]; !exist {
-			if err := m.bgpServer.AddPeer(context.Background(), &api.AddPeerRequest{
+			err := m.bgpServer.AddPeer(context.Background(), &api.AddPeerRequest{
 				Peer: generatePeerConfig(peer),
-			}); err != nil {
+			})
+			m.recordPeerError(peer.address, err)
+			if err != nil {
 				return fmt.Errorf("failed to add bgp peer %v: %v", peer.address, err)
 			}
 		}
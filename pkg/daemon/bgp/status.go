@@ -0,0 +1,130 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package bgp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// PeerState is the state of bgp session with a recorded peer.
+type PeerState struct {
+	Address      string
+	ASN          int
+	SessionState string
+	LastError    string
+}
+
+// peerStatus is the snapshot of a recorded peer which is safe to be read by other goroutines.
+type peerStatus struct {
+	asn       int
+	lastError string
+}
+
+// recordPeerStatuses takes a snapshot of the recorded peers, the last errors of peers still recorded are kept.
+func (m *Manager) recordPeerStatuses() {
+	m.peerStatusMutex.Lock()
+	defer m.peerStatusMutex.Unlock()
+
+	peerStatusMap := map[string]*peerStatus{}
+	for address, peer := range m.peerMap {
+		status := &peerStatus{asn: peer.asn}
+		if existStatus, exist := m.peerStatusMap[address]; exist {
+			status.lastError = existStatus.lastError
+		}
+		peerStatusMap[address] = status
+	}
+	m.peerStatusMap = peerStatusMap
+}
+
+// recordPeerError records the last error of configuring peer, a nil error clears it.
+func (m *Manager) recordPeerError(address string, err error) {
+	m.peerStatusMutex.Lock()
+	defer m.peerStatusMutex.Unlock()
+
+	status, exist := m.peerStatusMap[address]
+	if !exist {
+		return
+	}
+
+	status.lastError = ""
+	if err != nil {
+		status.lastError = err.Error()
+	}
+}
+
+// ListPeerStates returns the bgp session states of recorded peers sorted by address, nil will be returned if
+// bgp manager is not started.
+func (m *Manager) ListPeerStates() ([]PeerState, error) {
+	if !m.CheckIfStart() {
+		return nil, nil
+	}
+
+	sessionStateMap := map[string]api.PeerState_SessionState{}
+	if err := m.bgpServer.ListPeer(context.Background(), &api.ListPeerRequest{},
+		func(peer *api.Peer) {
+			if peer.State != nil {
+				sessionStateMap[peer.Conf.NeighborAddress] = peer.State.SessionState
+			}
+		}); err != nil {
+		return nil, fmt.Errorf("failed to list bgp peers: %v", err)
+	}
+
+	m.peerStatusMutex.RLock()
+	defer m.peerStatusMutex.RUnlock()
+
+	return buildPeerStates(m.peerStatusMap, sessionStateMap), nil
+}
+
+// WatchPeerStateChanges calls fn every time the bgp session state of any peer changes until ctx is done.
+func (m *Manager) WatchPeerStateChanges(ctx context.Context, fn func()) error {
+	return m.bgpServer.WatchEvent(ctx, &api.WatchEventRequest{Peer: &api.WatchEventRequest_Peer{}},
+		func(response *api.WatchEventResponse) {
+			if peerEvent := response.GetPeer(); peerEvent != nil &&
+				peerEvent.Type == api.WatchEventResponse_PeerEvent_STATE {
+				fn()
+			}
+		})
+}
+
+func buildPeerStates(peerStatusMap map[string]*peerStatus,
+	sessionStateMap map[string]api.PeerState_SessionState) []PeerState {
+	var states []PeerState
+	for address, status := range peerStatusMap {
+		// peers not added to bgp server yet have no session
+		sessionState, exist := sessionStateMap[address]
+		if !exist {
+			sessionState = api.PeerState_UNKNOWN
+		}
+
+		states = append(states, PeerState{
+			Address:      address,
+			ASN:          status.asn,
+			SessionState: strings.ToLower(sessionState.String()),
+			LastError:    status.lastError,
+		})
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Address < states[j].Address
+	})
+	return states
+}
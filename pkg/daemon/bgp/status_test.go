@@ -0,0 +1,48 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package bgp
+
+import (
+	"reflect"
+	"testing"
+
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+func TestBuildPeerStates(t *testing.T) {
+	peerStatusMap := map[string]*peerStatus{
+		"192.168.0.2": {asn: 65002},
+		"192.168.0.1": {asn: 65001, lastError: "failed to add peer"},
+	}
+	sessionStateMap := map[string]api.PeerState_SessionState{
+		"192.168.0.2": api.PeerState_ESTABLISHED,
+		"192.168.0.3": api.PeerState_ACTIVE,
+	}
+
+	expected := []PeerState{
+		{Address: "192.168.0.1", ASN: 65001, SessionState: "unknown", LastError: "failed to add peer"},
+		{Address: "192.168.0.2", ASN: 65002, SessionState: "established"},
+	}
+
+	if states := buildPeerStates(peerStatusMap, sessionStateMap); !reflect.DeepEqual(states, expected) {
+		t.Fatalf("buildPeerStates() = %+v, want %+v", states, expected)
+	}
+
+	if states := buildPeerStates(map[string]*peerStatus{}, sessionStateMap); states != nil {
+		t.Fatalf("buildPeerStates() with no recorded peer = %+v, want nil", states)
+	}
+}
@@ -24,7 +24,12 @@ import (
 	"strings"
 	"time"
 
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+	"github.com/alibaba/hybridnet/pkg/daemon/addr"
+	"github.com/alibaba/hybridnet/pkg/daemon/iptables"
+	"github.com/alibaba/hybridnet/pkg/daemon/route"
 	daemonutils "github.com/alibaba/hybridnet/pkg/daemon/utils"
+	"github.com/alibaba/hybridnet/pkg/daemon/vxlan"
 	"github.com/alibaba/hybridnet/pkg/utils"
 
 	"github.com/sirupsen/logrus"
@@ -40,9 +45,12 @@ const (
 	DefaultVxlanUDPPort = 8472
 
 	DefaultVlanCheckTimeout                     = 3 * time.Second
+	DefaultLinkWaitTimeout                      = 3 * time.Second
 	DefaultIPtablesCheckDuration                = 5 * time.Second
 	DefaultVxlanBaseReachableTime               = 5 * time.Second
 	DefaultVxlanExpiredNeighCachesClearInterval = 1 * time.Hour
+	DefaultRouteSyncBackoffBase                 = 1 * time.Second
+	DefaultRouteSyncBackoffMax                  = 1 * time.Minute
 
 	DefaultNeighGCThresh1 = 1024
 	DefaultNeighGCThresh2 = 2048
@@ -52,6 +60,8 @@ const (
 	DefaultToOverlaySubnetTableNum = 40000
 	DefaultOverlayMarkTableNum     = 40001
 
+	DefaultRulePriorityFallbackBase = 100
+
 	DefaultIPv6RouteCacheMaxSize  = 524288
 	DefaultIPv6RouteCacheGCThresh = 65536
 )
@@ -71,13 +81,38 @@ type Configuration struct {
 
 	ExtraNodeLocalVxlanIPCidrs []*net.IPNet
 
+	// interface names or address labels to select extra vtep local ips from, e.g., loopback aliases
+	VtepLocalIPInterfaces []string
+
+	// interfaces on which enhanced addresses of vlan arp enhancement are not managed
+	EnhancedAddrDisabledInterfaces []string
+
+	// extra mode to set on the forward interfaces with enhanced addresses, which is reverted once they are not needed
+	EnhancedAddrInterfaceMode addr.ForwardInterfaceMode
+
+	// arp_announce and arp_ignore values to set on the forward interfaces with enhanced addresses, -1 means unset
+	EnhancedAddrARPAnnounce int
+	EnhancedAddrARPIgnore   int
+
+	// destinations to route through vxlan device for overlay subnets which don't need to be NATed
+	OverlayDestinationCIDRs []*net.IPNet
+
 	HealthyServerAddress string
 	MetricsServerAddress string
 	BGPgRPCServerAddress string
 
+	// source ips of the default routes for bgp subnets, at most one for each family
+	BGPRouteSourceIPs []net.IP
+
 	VxlanUDPPort int
 
+	VxlanLearning bool
+	VxlanProxy    bool
+	VxlanL2miss   bool
+	VxlanL3miss   bool
+
 	VlanCheckTimeout      time.Duration
+	LinkWaitTimeout       time.Duration
 	IptablesCheckDuration time.Duration
 
 	VxlanBaseReachableTime               time.Duration
@@ -93,17 +128,60 @@ type Configuration struct {
 	// Use fixed table num to mark "overlay-mark-table rule"
 	OverlayMarkTableNum int
 
+	// Range of route tables to allocate for subnets
+	RouteTableRange route.TableRange
+
 	NeighGCThresh1 int
 	NeighGCThresh2 int
 	NeighGCThresh3 int
 
+	// If positive, neigh gc thresholds will be scaled in bands of this many known neighbors
+	NeighGCThreshBandSize int
+
+	// Network mode to program subnets whose mode is empty with, empty means failing the route sync
+	DefaultSubnetNetworkMode networkingv1.NetworkMode
+
 	IPv6RouteCacheMaxSize  int
 	IPv6RouteCacheGCThresh int
 
+	// If positive, ipv6 route cache parameters will be re-asserted on this interval
+	IPv6RouteCacheCheckInterval time.Duration
+
 	EnableVlanArpEnhancement     bool
 	PatchCalicoPodIPsAnnotation  bool
 	CheckPodConnectivityFromHost bool
 	UpdateIPInstanceStatus       bool
+	EnableGatewayProbe           bool
+	EnableAsyncGatewayProbe      bool
+	RulePriorityFallbackBase     int
+	EnableRouteWarmUp            bool
+
+	// how long the route table of a removed subnet is kept for the subnet to reappear, zero means no grace period
+	RouteTableDeleteGracePeriod time.Duration
+	SubnetDrainGracePeriod      time.Duration
+
+	// how long to wait for the missing direct route of a local vlan subnet before installing it, zero means never
+	DirectRouteInstallGracePeriod time.Duration
+
+	// if compatible subnets share a single route table to reduce route table consumption
+	EnableRouteTableSharing bool
+
+	// if the gateway of ipv6 vlan subnets without specified gateway is detected from router advertisements
+	EnableIPv6RAGatewayDetection bool
+
+	// requeue backoff of route sync failures, transient failures are retried with an exponential backoff
+	// from base to max, while failures caused by bad configuration are always retried after max
+	RouteSyncBackoffBase time.Duration
+	RouteSyncBackoffMax  time.Duration
+
+	// how long routes are taken as ready after the last successful sync, zero means routes never get stale
+	RouteSyncStaleWindow time.Duration
+
+	// if routes need to be read back from kernel and compared after written, for debugging only
+	VerifyRouteWrites bool
+
+	KubeProxyMasqueradeMark int
+	FullNATedPodTrafficMark int
 }
 
 // ParseFlags will parse cmd args then init kubeClient and configuration
@@ -116,26 +194,58 @@ func ParseFlags() (*Configuration, error) {
 		argBindSocket                           = pflag.String("bind-socket", "/var/run/hybridnet.sock", "The socket daemon bind to.")
 		argHealthyServerAddress                 = pflag.String("health-probe-addr", DefaultHealthyServerBindAddress, "The address which daemon healthy server bind")
 		argMetricsServerAddress                 = pflag.String("metrics-addr", DefaultMetricsServerBindAddress, "The address which daemon metrics server bind")
+		argBGPRouteSourceIPs                    = pflag.String("bgp-route-source-ips", "", "The source ip list of bgp subnet default routes, at most one for each family, e.g., \"192.168.10.1,fd00::1\"")
 		argBGPgRPCServerAddress                 = pflag.String("bgp-grpc-server-addr", DefaultBGPgRPCServerBindAddress, "The address which daemon bgp grpc server bind, for using gobgp command to debug")
 		argLocalDirectTableNum                  = pflag.Int("local-direct-table", DefaultLocalDirectTableNum, "The number of local-pod-direct route table")
 		argIPtablesCheckDuration                = pflag.Duration("iptables-check-duration", DefaultIPtablesCheckDuration, "The time period for iptables manager to check iptables rules")
 		argToOverlaySubnetTableNum              = pflag.Int("to-overlay-table", DefaultToOverlaySubnetTableNum, "The number of to-overlay-pod-subnet route table")
+		argMinRouteTableNum                     = pflag.Int("min-route-table", route.MinRouteTableNum, "The min number of route tables to allocate for subnets, which should not be less than 256")
+		argMaxRouteTableNum                     = pflag.Int("max-route-table", route.MaxRouteTableNum, "The max number of route tables to allocate for subnets, which is exclusive and should not be greater than 2^31")
 		argOverlayMarkTableNum                  = pflag.Int("overlay-mark-table", DefaultOverlayMarkTableNum, "The number of overlay-mark routing table")
 		argVlanCheckTimeout                     = pflag.Duration("vlan-check-timeout", DefaultVlanCheckTimeout, "The timeout of vlan network environment check while pod creating")
+		argLinkWaitTimeout                      = pflag.Duration("link-wait-timeout", DefaultLinkWaitTimeout, "The timeout to wait for a created vlan/vxlan interface to appear")
 		argVxlanUDPPort                         = pflag.Int("vxlan-udp-port", DefaultVxlanUDPPort, "The local udp port which vxlan tunnel use")
+		argVxlanLearning                        = pflag.Bool("vxlan-learning", true, "Whether vxlan device learns unknown source link layer addresses into fdb")
+		argVxlanProxy                           = pflag.Bool("vxlan-proxy", false, "Whether enable ARP/ND proxy of vxlan device")
+		argVxlanL2miss                          = pflag.Bool("vxlan-l2miss", false, "Whether vxlan device generates netlink notifications of link layer address misses")
+		argVxlanL3miss                          = pflag.Bool("vxlan-l3miss", false, "Whether vxlan device generates netlink notifications of IP address misses")
 		argVxlanBaseReachableTime               = pflag.Duration("vxlan-base-reachable-time", DefaultVxlanBaseReachableTime, "The time for neigh caches of vxlan device to get STALE from REACHABLE")
 		argVxlanExpiredNeighCachesClearInterval = pflag.Duration("vxlan-expired-neigh-caches-clear-interval", DefaultVxlanExpiredNeighCachesClearInterval, "The interval for daemon to clear STALE and FAILED neigh caches of vxlan device")
 		argVtepAddressCIDRs                     = pflag.String("vtep-address-cidrs", "0.0.0.0/0,::/0", "The cidr list to select vtep address on each node, e.g., \\\"192.168.10.0/24,10.2.3.0/24\\\"\"")
 		argNeighGCThresh1                       = pflag.Int("neigh-gc-thresh1", DefaultNeighGCThresh1, "Value to set net.ipv4/ipv6.neigh.default.gc_thresh1")
 		argNeighGCThresh2                       = pflag.Int("neigh-gc-thresh2", DefaultNeighGCThresh2, "Value to set net.ipv4/ipv6.neigh.default.gc_thresh2")
 		argNeighGCThresh3                       = pflag.Int("neigh-gc-thresh3", DefaultNeighGCThresh3, "Value to set net.ipv4/ipv6.neigh.default.gc_thresh3")
+		argOverlayDestinationCIDRs              = pflag.String("overlay-destination-cidrs", "", "The cidr list to route through vxlan device for overlay subnets without nat outgoing instead of a default route, e.g., \"10.0.0.0/16,10.96.0.0/12\"")
 		argExtraNodeLocalVxlanIPCidrs           = pflag.String("extra-node-local-vxlan-ip-cidrs", "", "The cidr list to select node extra local vxlan ip, e.g., \"192.168.10.0/24,10.2.3.0/24\"")
+		argEnhancedAddrDisabledInterfaces       = pflag.String("enhanced-address-disabled-interfaces", "", "The interface name list on which enhanced addresses of vlan arp enhancement are not managed, exist ones will be cleaned, e.g., \"eth0.10,eth0.20\"")
+		argEnhancedAddrARPAnnounce              = pflag.Int("enhanced-address-arp-announce", addr.ARPParameterUnset, "The arp_announce sysctl value (0~2) to set on the vlan forward interfaces with enhanced addresses, some switches need 2 to get the right sender ip of arp requests, -1 means it is not managed")
+		argEnhancedAddrARPIgnore                = pflag.Int("enhanced-address-arp-ignore", addr.ARPParameterUnset, "The arp_ignore sysctl value (0~3 or 8) to set on the vlan forward interfaces with enhanced addresses, -1 means it is not managed")
+		argEnhancedAddrInterfaceMode            = pflag.String("enhanced-address-interface-mode", "", "The mode (allmulti or promisc) to set on the vlan forward interfaces with enhanced addresses, which is needed by some bridged underlay fabrics to deliver arp replies, empty means no mode is set. Both modes make the interfaces receive extra traffic, and modes set are reverted only when the interfaces don't need enhanced addresses any more or daemon exits normally")
+		argVtepLocalIPInterfaces                = pflag.String("vtep-local-ip-interfaces", "", "The interface name or address label list to select node extra local vxlan ip, a trailing \"*\" matches by prefix, e.g., \"lo:*,eth1\"")
 		argEnableVlanArpEnhancement             = pflag.Bool("enable-vlan-arp-enhancement", true, "Whether enable arp source enhancement in a vlan environment")
+		argDefaultSubnetNetworkMode             = pflag.String("default-subnet-network-mode", "", "The network mode (VLAN, VXLAN, BGP or GlobalBGP) to program subnets whose mode is empty with, empty means failing the route sync for such subnets")
+		argNeighGCThreshBandSize                = pflag.Int("neigh-gc-thresh-band-size", 0, "If positive, scale neigh gc thresholds up from the configured values as the known neighbor count crosses bands of this size, 0 means using the configured values only")
 		argIPv6RouteCacheMaxSize                = pflag.Int("ipv6-route-cache-max-size", DefaultIPv6RouteCacheMaxSize, "Value to set net.ipv6.route.max_size")
 		argIPv6RouteCacheGCThresh               = pflag.Int("ipv6-route-cache-gc-thresh", DefaultIPv6RouteCacheGCThresh, "Value to set net.ipv6.route.gc_thresh")
+		argIPv6RouteCacheCheckInterval          = pflag.Duration("ipv6-route-cache-check-interval", 0, "The interval to check net.ipv6.route.max_size and net.ipv6.route.gc_thresh and re-apply the configured values if they drift, 0 means never check")
 		argPatchCalicoPodIPsAnnotation          = pflag.Bool("patch-calico-pod-ips-annotation", true, "Patch \"cni.projectcalico.org/podIPs\" annotations to pod")
 		argCheckPodConnectivityFromHost         = pflag.Bool("check-pod-connectivity-from-host", true, "Check pod's connectivity from host before start it")
 		argUpdateIPInstanceStatus               = pflag.Bool("update-ipinstance-status", true, "Update ipinstance status while creating pod sandbox")
+		argRulePriorityFallbackBase             = pflag.Int("rule-priority-fallback-base", DefaultRulePriorityFallbackBase, "The base priority to allocate policy rules from if node local rule is not found")
+		argRouteTableDeleteGracePeriod          = pflag.Duration("route-table-delete-grace-period", 0, "The grace period to keep the route table of a removed subnet, the table will be reclaimed intact if the subnet reappears within it")
+		argSubnetDrainGracePeriod               = pflag.Duration("subnet-drain-grace-period", 5*time.Minute, "The grace period to keep the routes of a subnet annotated as draining, during which its bgp path is withdrawn")
+		argDirectRouteInstallGracePeriod        = pflag.Duration("direct-route-install-grace-period", 0, "The grace period to wait for the missing direct route of a local vlan subnet on the forward interface before installing it, 0 means never installing it and retrying the route sync until it appears")
+		argKubeProxyMasqueradeMark              = pflag.Int("kube-proxy-masquerade-mark", iptables.KubeProxyMasqueradeMark, "The masquerade mark used by kube-proxy, which is 1 << --masquerade-bit of kube-proxy")
+		argFullNATedPodTrafficMark              = pflag.Int("full-nated-pod-traffic-mark", iptables.FullNATedPodTrafficMark, "The mark for full NATed pod traffic to skip from-pod-subnet rules")
+		argRouteSyncStaleWindow                 = pflag.Duration("route-sync-stale-window", 0, "The window after the last successful route sync within which daemon is ready, routes are resynced every half of it, 0 means routes never get stale")
+		argVerifyRouteWrites                    = pflag.Bool("verify-route-writes", false, "Read back every written route from kernel and log the mismatches, for debugging only")
+		argEnableRouteWarmUp                    = pflag.Bool("enable-route-warm-up", false, "Audit and repair the rules and route tables left by the previous instance on startup")
+		argRouteSyncBackoffBase                 = pflag.Duration("route-sync-backoff-base", DefaultRouteSyncBackoffBase, "The initial requeue delay after route sync failed transiently, which doubles on every consecutive failure")
+		argRouteSyncBackoffMax                  = pflag.Duration("route-sync-backoff-max", DefaultRouteSyncBackoffMax, "The max requeue delay after route sync failed, which is also the delay for failures caused by bad configuration")
+		argEnableIPv6RAGatewayDetection         = pflag.Bool("enable-ipv6-ra-gateway-detection", false, "Detect the gateway of ipv6 vlan subnets without specified gateway from router advertisements on the forward interfaces")
+		argEnableRouteTableSharing              = pflag.Bool("enable-route-table-sharing", false, "Share a single route table among subnets whose routes are identical, each subnet still has its own policy rule")
+		argEnableGatewayProbe                   = pflag.Bool("enable-gateway-probe", false, "Probe the reachability of underlay subnet gateways after routes are synced")
+		argEnableAsyncGatewayProbe              = pflag.Bool("enable-async-gateway-probe", false, "Probe the gateways in background instead of blocking route sync, only works with --enable-gateway-probe")
 	)
 
 	// mute info log for ipset lib
@@ -161,20 +271,44 @@ func ParseFlags() (*Configuration, error) {
 		LocalDirectTableNum:                  *argLocalDirectTableNum,
 		ToOverlaySubnetTableNum:              *argToOverlaySubnetTableNum,
 		OverlayMarkTableNum:                  *argOverlayMarkTableNum,
+		RouteTableRange:                      route.TableRange{Min: *argMinRouteTableNum, Max: *argMaxRouteTableNum},
 		VlanCheckTimeout:                     *argVlanCheckTimeout,
+		LinkWaitTimeout:                      *argLinkWaitTimeout,
 		VxlanUDPPort:                         *argVxlanUDPPort,
+		VxlanLearning:                        *argVxlanLearning,
+		VxlanProxy:                           *argVxlanProxy,
+		VxlanL2miss:                          *argVxlanL2miss,
+		VxlanL3miss:                          *argVxlanL3miss,
 		IptablesCheckDuration:                *argIPtablesCheckDuration,
 		VxlanBaseReachableTime:               *argVxlanBaseReachableTime,
 		NeighGCThresh1:                       *argNeighGCThresh1,
 		NeighGCThresh2:                       *argNeighGCThresh2,
 		NeighGCThresh3:                       *argNeighGCThresh3,
+		NeighGCThreshBandSize:                *argNeighGCThreshBandSize,
+		DefaultSubnetNetworkMode:             networkingv1.NetworkMode(*argDefaultSubnetNetworkMode),
 		VxlanExpiredNeighCachesClearInterval: *argVxlanExpiredNeighCachesClearInterval,
 		EnableVlanArpEnhancement:             *argEnableVlanArpEnhancement,
 		IPv6RouteCacheMaxSize:                *argIPv6RouteCacheMaxSize,
 		IPv6RouteCacheGCThresh:               *argIPv6RouteCacheGCThresh,
+		IPv6RouteCacheCheckInterval:          *argIPv6RouteCacheCheckInterval,
 		PatchCalicoPodIPsAnnotation:          *argPatchCalicoPodIPsAnnotation,
 		CheckPodConnectivityFromHost:         *argCheckPodConnectivityFromHost,
 		UpdateIPInstanceStatus:               *argUpdateIPInstanceStatus,
+		EnableGatewayProbe:                   *argEnableGatewayProbe,
+		EnableAsyncGatewayProbe:              *argEnableAsyncGatewayProbe,
+		RulePriorityFallbackBase:             *argRulePriorityFallbackBase,
+		EnableRouteWarmUp:                    *argEnableRouteWarmUp,
+		RouteTableDeleteGracePeriod:          *argRouteTableDeleteGracePeriod,
+		SubnetDrainGracePeriod:               *argSubnetDrainGracePeriod,
+		DirectRouteInstallGracePeriod:        *argDirectRouteInstallGracePeriod,
+		EnableRouteTableSharing:              *argEnableRouteTableSharing,
+		EnableIPv6RAGatewayDetection:         *argEnableIPv6RAGatewayDetection,
+		RouteSyncBackoffBase:                 *argRouteSyncBackoffBase,
+		RouteSyncBackoffMax:                  *argRouteSyncBackoffMax,
+		VerifyRouteWrites:                    *argVerifyRouteWrites,
+		RouteSyncStaleWindow:                 *argRouteSyncStaleWindow,
+		KubeProxyMasqueradeMark:              *argKubeProxyMasqueradeMark,
+		FullNATedPodTrafficMark:              *argFullNATedPodTrafficMark,
 	}
 
 	if *argPreferVlanInterfaces == "" {
@@ -189,6 +323,44 @@ func ParseFlags() (*Configuration, error) {
 		}
 	}
 
+	if *argEnhancedAddrDisabledInterfaces != "" {
+		config.EnhancedAddrDisabledInterfaces = strings.Split(*argEnhancedAddrDisabledInterfaces, ",")
+	}
+
+	if err := addr.ValidateARPParameters(*argEnhancedAddrARPAnnounce, *argEnhancedAddrARPIgnore); err != nil {
+		return nil, fmt.Errorf("failed to validate enhanced address arp parameters: %v", err)
+	}
+	config.EnhancedAddrARPAnnounce = *argEnhancedAddrARPAnnounce
+	config.EnhancedAddrARPIgnore = *argEnhancedAddrARPIgnore
+
+	if *argEnhancedAddrInterfaceMode != "" {
+		var err error
+		config.EnhancedAddrInterfaceMode, err = addr.ParseForwardInterfaceMode(*argEnhancedAddrInterfaceMode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse enhanced address interface mode: %v", err)
+		}
+	}
+
+	if *argVtepLocalIPInterfaces != "" {
+		config.VtepLocalIPInterfaces = strings.Split(*argVtepLocalIPInterfaces, ",")
+	}
+
+	if *argOverlayDestinationCIDRs != "" {
+		var err error
+		config.OverlayDestinationCIDRs, err = parseCidrString(*argOverlayDestinationCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse overlay destination cidrs: %v", err)
+		}
+	}
+
+	if *argBGPRouteSourceIPs != "" {
+		var err error
+		config.BGPRouteSourceIPs, err = parseRouteSourceIPString(*argBGPRouteSourceIPs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse bgp route source ips: %v", err)
+		}
+	}
+
 	if *argVtepAddressCIDRs != "" {
 		var err error
 		config.VtepAddressCIDRs, err = parseCidrString(*argVtepAddressCIDRs)
@@ -197,6 +369,31 @@ func ParseFlags() (*Configuration, error) {
 		}
 	}
 
+	if config.RouteSyncBackoffBase <= 0 || config.RouteSyncBackoffMax < config.RouteSyncBackoffBase {
+		return nil, fmt.Errorf("route sync backoff base %v must be positive and not larger than max %v",
+			config.RouteSyncBackoffBase, config.RouteSyncBackoffMax)
+	}
+
+	if err := config.RouteTableRange.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid route table range: %v", err)
+	}
+
+	if err := validateDefaultSubnetNetworkMode(config.DefaultSubnetNetworkMode); err != nil {
+		return nil, fmt.Errorf("invalid default subnet network mode: %v", err)
+	}
+
+	if config.NeighGCThreshBandSize < 0 {
+		return nil, fmt.Errorf("neigh gc thresh band size %v must not be negative", config.NeighGCThreshBandSize)
+	}
+
+	if err := vxlan.ValidatePort(config.VxlanUDPPort); err != nil {
+		return nil, fmt.Errorf("invalid vxlan udp port: %v", err)
+	}
+
+	if err := iptables.ValidateTrafficMarks(config.KubeProxyMasqueradeMark, config.FullNATedPodTrafficMark); err != nil {
+		return nil, fmt.Errorf("invalid traffic marks: %v", err)
+	}
+
 	if err := config.initNicConfig(); err != nil {
 		return nil, err
 	}
@@ -276,3 +473,40 @@ func parseCidrString(cidrListString string) ([]*net.IPNet, error) {
 
 	return cidrList, nil
 }
+
+// parseRouteSourceIPString parses the source ip list of routes, at most one for each family.
+func parseRouteSourceIPString(ipListString string) ([]net.IP, error) {
+	var ipList []net.IP
+	var hasIPv4, hasIPv6 bool
+	for _, ipString := range strings.Split(ipListString, ",") {
+		ip := net.ParseIP(ipString)
+		if ip == nil {
+			return nil, fmt.Errorf("failed to parse ip %v", ipString)
+		}
+
+		isIPv4 := ip.To4() != nil
+		if (isIPv4 && hasIPv4) || (!isIPv4 && hasIPv6) {
+			return nil, fmt.Errorf("more than one source ip of the same family as %v", ipString)
+		}
+
+		if isIPv4 {
+			hasIPv4 = true
+		} else {
+			hasIPv6 = true
+		}
+		ipList = append(ipList, ip)
+	}
+
+	return ipList, nil
+}
+
+// validateDefaultSubnetNetworkMode checks if mode can be used as the default network mode of subnets.
+func validateDefaultSubnetNetworkMode(mode networkingv1.NetworkMode) error {
+	switch mode {
+	case "", networkingv1.NetworkModeVlan, networkingv1.NetworkModeVxlan,
+		networkingv1.NetworkModeBGP, networkingv1.NetworkModeGlobalBGP:
+		return nil
+	default:
+		return fmt.Errorf("unsupported network mode %v", mode)
+	}
+}
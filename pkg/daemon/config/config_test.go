@@ -0,0 +1,63 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestParseRouteSourceIPString(t *testing.T) {
+	tests := []struct {
+		name      string
+		ipList    string
+		expectLen int
+		expectErr bool
+	}{
+		{"ipv4", "192.168.10.1", 1, false},
+		{"dual stack", "192.168.10.1,fd00::1", 2, false},
+		{"malformed", "192.168.10.256", 0, true},
+		{"duplicated ipv4", "192.168.10.1,192.168.10.2", 0, true},
+		{"duplicated ipv6", "fd00::1,192.168.10.1,fd00::2", 0, true},
+	}
+
+	for _, test := range tests {
+		ipList, err := parseRouteSourceIPString(test.ipList)
+		if (err != nil) != test.expectErr {
+			t.Errorf("test %v failed, expect error %v but got %v", test.name, test.expectErr, err)
+			continue
+		}
+
+		if len(ipList) != test.expectLen {
+			t.Errorf("test %v failed, expect %v ips but got %v", test.name, test.expectLen, ipList)
+		}
+	}
+}
+
+func TestValidateDefaultSubnetNetworkMode(t *testing.T) {
+	for _, mode := range []networkingv1.NetworkMode{"", networkingv1.NetworkModeVlan, networkingv1.NetworkModeVxlan,
+		networkingv1.NetworkModeBGP, networkingv1.NetworkModeGlobalBGP} {
+		if err := validateDefaultSubnetNetworkMode(mode); err != nil {
+			t.Errorf("unexpected error for mode %v: %v", mode, err)
+		}
+	}
+
+	if err := validateDefaultSubnetNetworkMode("IPVLAN"); err == nil {
+		t.Errorf("expect error for unsupported mode")
+	}
+}
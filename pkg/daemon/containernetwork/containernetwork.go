@@ -155,7 +155,7 @@ func ConfigureHostNic(nicName string, allocatedIPs map[networkingv1.IPVersion]*d
 
 func ConfigureContainerNic(containerNicName, hostNicName, nodeIfName string, allocatedIPs map[networkingv1.IPVersion]*daemonutils.IPInfo,
 	macAddr net.HardwareAddr, netns ns.NetNS, mtu int, vlanCheckTimeout time.Duration, networkMode networkingv1.NetworkMode,
-	neighGCThresh1, neighGCThresh2, neighGCThresh3, ipv6RouteCacheMaxSize, ipv6RouteCacheGCThresh int,
+	neighGCThreshV4, neighGCThreshV6 daemonutils.NeighGCThresh, ipv6RouteCacheMaxSize, ipv6RouteCacheGCThresh int,
 	bgpManager *bgp.Manager) error {
 
 	var defaultRouteNets []*types.Route
@@ -196,7 +196,8 @@ func ConfigureContainerNic(containerNicName, hostNicName, nodeIfName string, all
 			return fmt.Errorf("failed to enable ipv4 forwarding: %v", err)
 		}
 
-		if err := daemonutils.EnsureNeighGCThresh(netlink.FAMILY_V4, neighGCThresh1, neighGCThresh2, neighGCThresh3); err != nil {
+		if err := daemonutils.EnsureNeighGCThresh(netlink.FAMILY_V4, neighGCThreshV4.Thresh1,
+			neighGCThreshV4.Thresh2, neighGCThreshV4.Thresh3); err != nil {
 			return fmt.Errorf("failed to ensure ipv4 neigh gc thresh: %v", err)
 		}
 
@@ -252,7 +253,8 @@ func ConfigureContainerNic(containerNicName, hostNicName, nodeIfName string, all
 			return fmt.Errorf("failed to enable ipv6 forwarding: %v", err)
 		}
 
-		if err := daemonutils.EnsureNeighGCThresh(netlink.FAMILY_V6, neighGCThresh1, neighGCThresh2, neighGCThresh3); err != nil {
+		if err := daemonutils.EnsureNeighGCThresh(netlink.FAMILY_V6, neighGCThreshV6.Thresh1,
+			neighGCThreshV6.Thresh2, neighGCThreshV6.Thresh3); err != nil {
 			return fmt.Errorf("failed to ensure ipv6 neigh gc thresh: %v", err)
 		}
 
@@ -261,12 +263,17 @@ func ConfigureContainerNic(containerNicName, hostNicName, nodeIfName string, all
 		}
 
 		if networkMode == networkingv1.NetworkModeVlan {
-			if allocatedIPs[networkingv1.IPv6].Gw == nil {
-				return fmt.Errorf("get a nil gateway for ip %v", allocatedIPs[networkingv1.IPv6].Addr)
+			gateway := allocatedIPs[networkingv1.IPv6].Gw
+			if gateway == nil {
+				// gateway of subnet is unspecified and learned from router advertisements
+				var err error
+				if gateway, err = daemonutils.GetRAGateway(forwardNodeIf.Index); err != nil {
+					return fmt.Errorf("get a nil gateway for ip %v and failed to learn it from router advertisements: %v",
+						allocatedIPs[networkingv1.IPv6].Addr, err)
+				}
 			}
 
-			if err := ndp.CheckWithTimeout(forwardNodeIf, podIP,
-				allocatedIPs[networkingv1.IPv6].Gw, vlanCheckTimeout); err != nil {
+			if err := ndp.CheckWithTimeout(forwardNodeIf, podIP, gateway, vlanCheckTimeout); err != nil {
 				return fmt.Errorf("failed to check ipv6 vlan environment: %v", err)
 			}
 		}
@@ -0,0 +1,55 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	"github.com/alibaba/hybridnet/pkg/daemon/route"
+)
+
+// routeSyncBackoff computes the requeue delay after route sync failures. Transient failures are retried with
+// an exponential backoff from base to max, while permanent failures caused by bad configuration are always
+// retried after max, because retrying will not help until the configuration is fixed.
+type routeSyncBackoff struct {
+	base time.Duration
+	max  time.Duration
+
+	// consecutive transient failures since the last successful sync
+	failures int
+}
+
+func (b *routeSyncBackoff) next(err error) (delay time.Duration, permanent bool) {
+	if route.IsPermanentError(err) {
+		return b.max, true
+	}
+
+	delay = b.base
+	for i := 0; i < b.failures && delay < b.max; i++ {
+		delay *= 2
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+
+	b.failures++
+	return delay, false
+}
+
+func (b *routeSyncBackoff) reset() {
+	b.failures = 0
+}
@@ -0,0 +1,61 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alibaba/hybridnet/pkg/daemon/route"
+)
+
+func TestRouteSyncBackoff(t *testing.T) {
+	b := &routeSyncBackoff{
+		base: time.Second,
+		max:  10 * time.Second,
+	}
+	transientErr := fmt.Errorf("device busy")
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		10 * time.Second, 10 * time.Second} {
+		if delay, permanent := b.next(transientErr); delay != want || permanent {
+			t.Fatalf("next() = (%v, %v), want (%v, false)", delay, permanent, want)
+		}
+	}
+
+	b.reset()
+	if delay, _ := b.next(transientErr); delay != time.Second {
+		t.Fatalf("next() after reset = %v, want %v", delay, time.Second)
+	}
+}
+
+func TestRouteSyncBackoffWithMissingDirectRoute(t *testing.T) {
+	b := &routeSyncBackoff{
+		base: time.Second,
+		max:  10 * time.Second,
+	}
+	missingDirectRouteErr := fmt.Errorf("failed to sync ipv4 routes: %w",
+		&route.MissingDirectRouteError{LinkName: "eth0.10", CIDR: "192.168.1.0/24"})
+
+	// direct route might appear a moment later, so the sync is retried as a transient failure
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if delay, permanent := b.next(missingDirectRouteErr); delay != want || permanent {
+			t.Fatalf("next() = (%v, %v), want (%v, false)", delay, permanent, want)
+		}
+	}
+}
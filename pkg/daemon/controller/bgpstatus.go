@@ -0,0 +1,106 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+	"github.com/alibaba/hybridnet/pkg/daemon/bgp"
+)
+
+func (c *CtrlHub) bgpPeerStatusTrigger() {
+	select {
+	case c.bgpPeerStatusCh <- struct{}{}:
+	default:
+	}
+}
+
+func (c *CtrlHub) bgpPeerStatusLoop(ctx context.Context) error {
+	if err := c.bgpManager.WatchPeerStateChanges(ctx, c.bgpPeerStatusTrigger); err != nil {
+		return fmt.Errorf("failed to watch bgp peer state changes: %v", err)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-c.bgpPeerStatusCh:
+				if err := c.updateNodeBGPPeerStatus(ctx); err != nil {
+					c.logger.Error(err, "failed to update bgp peer status of node info")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (c *CtrlHub) updateNodeBGPPeerStatus(ctx context.Context) error {
+	peerStates, err := c.bgpManager.ListPeerStates()
+	if err != nil {
+		return fmt.Errorf("failed to list bgp peer states: %v", err)
+	}
+
+	nodeInfo := &networkingv1.NodeInfo{}
+	if err = c.mgr.GetClient().Get(ctx, types.NamespacedName{Name: c.config.NodeName}, nodeInfo); err != nil {
+		// node info is created by node info controller, never create it here
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get node info %v: %v", c.config.NodeName, err)
+	}
+
+	bgpPeers := toBGPPeerStatuses(peerStates)
+	if reflect.DeepEqual(bgpPeers, nodeInfo.Status.BGPPeers) {
+		return nil
+	}
+
+	bgpPeersBytes, err := json.Marshal(bgpPeers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bgp peer statuses: %v", err)
+	}
+
+	if err = c.mgr.GetClient().Status().Patch(ctx, nodeInfo,
+		client.RawPatch(types.MergePatchType,
+			[]byte(fmt.Sprintf(`{"status":{"bgpPeers":%s}}`, bgpPeersBytes)))); err != nil {
+		return fmt.Errorf("failed to update bgp peer status of node info %v: %v", nodeInfo.Name, err)
+	}
+
+	return nil
+}
+
+func toBGPPeerStatuses(peerStates []bgp.PeerState) []networkingv1.BGPPeerStatus {
+	var bgpPeers []networkingv1.BGPPeerStatus
+	for _, state := range peerStates {
+		bgpPeers = append(bgpPeers, networkingv1.BGPPeerStatus{
+			Address:   state.Address,
+			ASN:       int32(state.ASN),
+			State:     state.SessionState,
+			LastError: state.LastError,
+		})
+	}
+	return bgpPeers
+}
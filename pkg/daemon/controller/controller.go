@@ -22,6 +22,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -49,6 +50,7 @@ import (
 	"github.com/alibaba/hybridnet/pkg/daemon/neigh"
 	"github.com/alibaba/hybridnet/pkg/daemon/route"
 	"github.com/alibaba/hybridnet/pkg/feature"
+	"github.com/alibaba/hybridnet/pkg/metrics"
 )
 
 const (
@@ -68,6 +70,8 @@ type CtrlHub struct {
 
 	subnetTriggerSourceForHostLink       *simpleTriggerSource
 	subnetTriggerSourceForNodeInfoChange *simpleTriggerSource
+	subnetTriggerSourceForRouteCheck     *simpleTriggerSource
+	subnetTriggerSourceForRouteFlush     *simpleTriggerSource
 	ipInstanceTriggerSourceForHostLink   *simpleTriggerSource
 	nodeInfoTriggerSourceForHostAddr     *simpleTriggerSource
 
@@ -86,56 +90,149 @@ type CtrlHub struct {
 	iptablesSyncCh     chan struct{}
 	iptablesSyncTicker *time.Ticker
 
+	bgpPeerStatusCh chan struct{}
+
 	nodeIPCache *NodeIPCache
 
+	neighGCThreshV4Tuner *daemonutils.NeighGCThreshTuner
+	neighGCThreshV6Tuner *daemonutils.NeighGCThreshTuner
+
+	// summaries of local subnets recorded by the last successful subnet reconcile
+	localSubnetSummaryMutex sync.RWMutex
+	localSubnetSummaries    []route.LocalSubnetSummary
+
+	// desired routing states of route managers recorded by the last successful subnet reconcile
+	routeStateMutex sync.RWMutex
+	routeStates     []*route.ExportedState
+
+	// local subnets intentionally left unprogrammed by the last subnet reconcile, e.g., deferred until
+	// any router advertisement is accepted or drained, indexed by canonical cidr, all of them are taken as
+	// unprogrammed if route reconciliation is paused
+	unprogrammedSubnetMutex sync.RWMutex
+	unprogrammedSubnets     map[string]bool
+	routeReconcilePaused    bool
+
+	// if all the managed rules and routes are requested to be flushed and rebuilt by the next subnet reconcile
+	routeFlushMutex     sync.Mutex
+	routeFlushRequested bool
+
+	// local subnets deleted since the last subnet reconcile, indexed by canonical cidr, whose rules and route
+	// tables are torn down immediately by the next subnet reconcile
+	deletedSubnetMutex sync.Mutex
+	deletedSubnets     map[string]*net.IPNet
+
+	// if ipv6 is globally disabled on this node while starting, ipv6 managers will not be running
+	ipv6Disabled bool
+
 	logger logr.Logger
 }
 
 func NewCtrlHub(config *daemonconfig.Configuration, mgr ctrl.Manager, logger logr.Logger) (*CtrlHub, error) {
+	ipv6Disabled, err := daemonutils.CheckIPv6GlobalDisabled()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check ipv6 global disabled: %v", err)
+	}
+
+	if err := iptables.SetTrafficMarks(config.KubeProxyMasqueradeMark, config.FullNATedPodTrafficMark); err != nil {
+		return nil, fmt.Errorf("failed to set traffic marks: %v", err)
+	}
+
+	route.SetRouteTableFlushGuardLogger(logger.WithName("route-table-flush-guard"))
+
+	if config.VerifyRouteWrites {
+		route.EnableRouteWriteVerification(logger.WithName("route-write-verifier"))
+	}
+
 	routeV4Manager, err := route.CreateRouteManager(config.LocalDirectTableNum,
 		config.ToOverlaySubnetTableNum,
 		config.OverlayMarkTableNum,
 		netlink.FAMILY_V4,
+		config.RouteTableRange,
+		logger.WithName("route-v4-manager"),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ipv4 route manager: %v", err)
 	}
 
-	routeV6Manager, err := route.CreateRouteManager(config.LocalDirectTableNum,
-		config.ToOverlaySubnetTableNum,
-		config.OverlayMarkTableNum,
-		netlink.FAMILY_V6,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create ipv6 route manager: %v", err)
-	}
+	routeV4Manager.SetGatewayProbe(config.EnableGatewayProbe)
+	routeV4Manager.SetRulePriorityFallbackBase(config.RulePriorityFallbackBase)
+	routeV4Manager.SetTableDeleteGracePeriod(config.RouteTableDeleteGracePeriod)
+	routeV4Manager.SetSubnetDrainGracePeriod(config.SubnetDrainGracePeriod)
+	routeV4Manager.SetDirectRouteInstallGracePeriod(config.DirectRouteInstallGracePeriod)
+	routeV4Manager.SetReadinessStaleWindow(config.RouteSyncStaleWindow)
+	routeV4Manager.SetRouteTableSharing(config.EnableRouteTableSharing)
+	routeV4Manager.SetTrafficMarks(config.KubeProxyMasqueradeMark, config.FullNATedPodTrafficMark)
+	routeV4Manager.SetDefaultNetworkMode(config.DefaultSubnetNetworkMode)
 
 	neighV4Manager := neigh.CreateNeighManager(netlink.FAMILY_V4)
-	neighV6Manager := neigh.CreateNeighManager(netlink.FAMILY_V6)
 
 	iptablesV4Manager, err := iptables.CreateIPtablesManager(iptables.ProtocolIpv4)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ipv4 iptables manager: %v", err)
 	}
 
-	iptablesV6Manager, err := iptables.CreateIPtablesManager(iptables.ProtocolIpv6)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create ipv6 iptables manager: %v", err)
+	var routeV6Manager *route.Manager
+	var neighV6Manager *neigh.Manager
+	var iptablesV6Manager *iptables.Manager
+
+	if ipv6Disabled {
+		// a restart is needed if ipv6 is enabled later
+		logger.Info("ipv6 is globally disabled, ipv6 route/neigh/iptables managers will not be running")
+	} else {
+		routeV6Manager, err = route.CreateRouteManager(config.LocalDirectTableNum,
+			config.ToOverlaySubnetTableNum,
+			config.OverlayMarkTableNum,
+			netlink.FAMILY_V6,
+			config.RouteTableRange,
+			logger.WithName("route-v6-manager"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ipv6 route manager: %v", err)
+		}
+
+		routeV6Manager.SetGatewayProbe(config.EnableGatewayProbe)
+		routeV6Manager.SetRulePriorityFallbackBase(config.RulePriorityFallbackBase)
+		routeV6Manager.SetTableDeleteGracePeriod(config.RouteTableDeleteGracePeriod)
+		routeV6Manager.SetSubnetDrainGracePeriod(config.SubnetDrainGracePeriod)
+		routeV6Manager.SetDirectRouteInstallGracePeriod(config.DirectRouteInstallGracePeriod)
+		routeV6Manager.SetReadinessStaleWindow(config.RouteSyncStaleWindow)
+		routeV6Manager.SetRouteTableSharing(config.EnableRouteTableSharing)
+		routeV6Manager.SetTrafficMarks(config.KubeProxyMasqueradeMark, config.FullNATedPodTrafficMark)
+		routeV6Manager.SetDefaultNetworkMode(config.DefaultSubnetNetworkMode)
+
+		neighV6Manager = neigh.CreateNeighManager(netlink.FAMILY_V6)
+
+		iptablesV6Manager, err = iptables.CreateIPtablesManager(iptables.ProtocolIpv6)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ipv6 iptables manager: %v", err)
+		}
 	}
 
 	addrV4Manager := addr.CreateAddrManager(netlink.FAMILY_V4, config.NodeName)
+	addrV4Manager.SetDisabledInterfaces(config.EnhancedAddrDisabledInterfaces)
+	addrV4Manager.SetForwardInterfaceMode(config.EnhancedAddrInterfaceMode)
+	addrV4Manager.SetARPParameters(config.EnhancedAddrARPAnnounce, config.EnhancedAddrARPIgnore)
+	addrV4Manager.SetLogger(logger.WithName("addr-v4-manager"))
 
 	bgpManager, err := bgp.NewManager(config.NodeBGPIfName, config.BGPgRPCServerAddress, logger.WithName("bgp-server"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bgp manager: %v", err)
 	}
 
+	baseNeighGCThresh := daemonutils.NeighGCThresh{
+		Thresh1: config.NeighGCThresh1,
+		Thresh2: config.NeighGCThresh2,
+		Thresh3: config.NeighGCThresh3,
+	}
+
 	ctrlHub := &CtrlHub{
 		config: config,
 		mgr:    mgr,
 
 		subnetTriggerSourceForHostLink:       &simpleTriggerSource{key: "ForHostLinkEvent"},
 		subnetTriggerSourceForNodeInfoChange: &simpleTriggerSource{key: "ForNodeInfo"},
+		subnetTriggerSourceForRouteCheck:     &simpleTriggerSource{key: "ForRouteCheck"},
+		subnetTriggerSourceForRouteFlush:     &simpleTriggerSource{key: "ForRouteFlush"},
 		ipInstanceTriggerSourceForHostLink:   &simpleTriggerSource{key: "ForHostLinkEvent"},
 		nodeInfoTriggerSourceForHostAddr:     &simpleTriggerSource{key: "ForHostAddr"},
 
@@ -154,8 +251,17 @@ func NewCtrlHub(config *daemonconfig.Configuration, mgr ctrl.Manager, logger log
 		iptablesSyncCh:     make(chan struct{}, 1),
 		iptablesSyncTicker: time.NewTicker(config.IptablesCheckDuration),
 
+		bgpPeerStatusCh: make(chan struct{}, 1),
+
 		nodeIPCache: NewNodeIPCache(),
 
+		neighGCThreshV4Tuner: daemonutils.NewNeighGCThreshTuner(netlink.FAMILY_V4, baseNeighGCThresh,
+			config.NeighGCThreshBandSize),
+		neighGCThreshV6Tuner: daemonutils.NewNeighGCThreshTuner(netlink.FAMILY_V6, baseNeighGCThresh,
+			config.NeighGCThreshBandSize),
+
+		ipv6Disabled: ipv6Disabled,
+
 		logger: logger,
 	}
 
@@ -170,6 +276,19 @@ func NewCtrlHub(config *daemonconfig.Configuration, mgr ctrl.Manager, logger log
 func (c *CtrlHub) Run(ctx context.Context) error {
 	c.runHealthyServer()
 
+	if c.config.EnableGatewayProbe && c.config.EnableAsyncGatewayProbe {
+		for _, routeManager := range c.routeManagers() {
+			routeManager.StartAsyncGatewayProbe(ctx)
+		}
+	}
+
+	// Warm-up needs the desired state, it is done by the first route sync after subnets are reconciled.
+	if c.config.EnableRouteWarmUp {
+		for _, routeManager := range c.routeManagers() {
+			routeManager.EnableWarmUp()
+		}
+	}
+
 	if err := c.mgr.GetFieldIndexer().IndexField(context.TODO(), &networkingv1.IPInstance{},
 		InstanceIPIndex, instanceIPIndexer); err != nil {
 		return fmt.Errorf("failed to add instance ip indexer to manager: %v", err)
@@ -185,6 +304,11 @@ func (c *CtrlHub) Run(ctx context.Context) error {
 	if err := (&subnetReconciler{
 		Client:     c.mgr.GetClient(),
 		ctrlHubRef: c,
+		routeSyncBackoff: &routeSyncBackoff{
+			base: c.config.RouteSyncBackoffBase,
+			max:  c.config.RouteSyncBackoffMax,
+		},
+		raGateways: map[string]net.IP{},
 	}).SetupWithManager(c.mgr); err != nil {
 		return fmt.Errorf("failed to setup subnet controller: %v", err)
 	}
@@ -213,9 +337,20 @@ func (c *CtrlHub) Run(ctx context.Context) error {
 
 	c.iptablesSyncLoop()
 
+	c.ipv6RouteGCParametersCheckLoop()
+
+	if err := c.bgpPeerStatusLoop(ctx); err != nil {
+		return fmt.Errorf("failed to start bgp peer status loop: %v", err)
+	}
+
 	if err := c.mgr.Start(ctx); err != nil {
 		return fmt.Errorf("failed to start controller manager: %v", err)
 	}
+
+	// controllers have been stopped, so interface modes can be reverted safely
+	if err := c.addrV4Manager.CleanForwardInterfaceModes(); err != nil {
+		return fmt.Errorf("failed to clean forward interface modes: %v", err)
+	}
 	return nil
 }
 
@@ -231,10 +366,141 @@ func (c *CtrlHub) GetMgrAPIReader() client.Reader {
 	return c.mgr.GetAPIReader()
 }
 
+// GetLocalSubnetSummaries returns the summaries of local subnets recorded by the last successful subnet reconcile.
+func (c *CtrlHub) GetLocalSubnetSummaries() []route.LocalSubnetSummary {
+	c.localSubnetSummaryMutex.RLock()
+	defer c.localSubnetSummaryMutex.RUnlock()
+
+	summaries := make([]route.LocalSubnetSummary, len(c.localSubnetSummaries))
+	copy(summaries, c.localSubnetSummaries)
+	return summaries
+}
+
+func (c *CtrlHub) recordLocalSubnetSummaries(summaries []route.LocalSubnetSummary) {
+	c.localSubnetSummaryMutex.Lock()
+	defer c.localSubnetSummaryMutex.Unlock()
+
+	c.localSubnetSummaries = summaries
+}
+
+// GetRouteStates returns the desired routing states of route managers recorded by the last successful
+// subnet reconcile.
+func (c *CtrlHub) GetRouteStates() []*route.ExportedState {
+	c.routeStateMutex.RLock()
+	defer c.routeStateMutex.RUnlock()
+
+	states := make([]*route.ExportedState, len(c.routeStates))
+	copy(states, c.routeStates)
+	return states
+}
+
+func (c *CtrlHub) recordRouteStates(states []*route.ExportedState) {
+	c.routeStateMutex.Lock()
+	defer c.routeStateMutex.Unlock()
+
+	c.routeStates = states
+}
+
+// RequestRouteFlush asks the subnet reconciler to flush all the managed rules and routes and rebuild them, which
+// is the last resort for a node whose routing state has drifted beyond repair.
+func (c *CtrlHub) RequestRouteFlush() {
+	c.routeFlushMutex.Lock()
+	c.routeFlushRequested = true
+	c.routeFlushMutex.Unlock()
+
+	c.subnetTriggerSourceForRouteFlush.Trigger()
+}
+
+// takeRouteFlushRequest returns if a route flush is requested and clears the request.
+func (c *CtrlHub) takeRouteFlushRequest() bool {
+	c.routeFlushMutex.Lock()
+	defer c.routeFlushMutex.Unlock()
+
+	requested := c.routeFlushRequested
+	c.routeFlushRequested = false
+	return requested
+}
+
+func (c *CtrlHub) recordDeletedSubnet(cidr *net.IPNet) {
+	c.deletedSubnetMutex.Lock()
+	defer c.deletedSubnetMutex.Unlock()
+
+	if c.deletedSubnets == nil {
+		c.deletedSubnets = map[string]*net.IPNet{}
+	}
+	c.deletedSubnets[route.CanonicalCIDRKey(cidr)] = cidr
+}
+
+// takeDeletedSubnets returns the local subnets deleted since the last call and clears them.
+func (c *CtrlHub) takeDeletedSubnets() []*net.IPNet {
+	c.deletedSubnetMutex.Lock()
+	defer c.deletedSubnetMutex.Unlock()
+
+	var cidrs []*net.IPNet
+	for _, cidr := range c.deletedSubnets {
+		cidrs = append(cidrs, cidr)
+	}
+	c.deletedSubnets = nil
+	return cidrs
+}
+
+// isSubnetUnprogrammed checks if the local subnet is intentionally left unprogrammed by the last subnet reconcile,
+// no subnet is programmed by design while route reconciliation is paused.
+func (c *CtrlHub) isSubnetUnprogrammed(cidr *net.IPNet) bool {
+	c.unprogrammedSubnetMutex.RLock()
+	defer c.unprogrammedSubnetMutex.RUnlock()
+
+	return c.routeReconcilePaused || c.unprogrammedSubnets[route.CanonicalCIDRKey(cidr)]
+}
+
+func (c *CtrlHub) recordUnprogrammedSubnets(subnets map[string]bool) {
+	c.unprogrammedSubnetMutex.Lock()
+	defer c.unprogrammedSubnetMutex.Unlock()
+
+	c.unprogrammedSubnets = subnets
+}
+
+func (c *CtrlHub) recordRouteReconcilePaused(paused bool) {
+	c.unprogrammedSubnetMutex.Lock()
+	defer c.unprogrammedSubnetMutex.Unlock()
+
+	c.routeReconcilePaused = paused
+}
+
 func (c *CtrlHub) GetBGPManager() *bgp.Manager {
 	return c.bgpManager
 }
 
+// GetNeighGCThresh returns the neigh gc thresholds which should be kept on the node for an ip family.
+func (c *CtrlHub) GetNeighGCThresh(family int) daemonutils.NeighGCThresh {
+	if family == netlink.FAMILY_V6 {
+		return c.neighGCThreshV6Tuner.Current()
+	}
+	return c.neighGCThreshV4Tuner.Current()
+}
+
+// updateNeighGCThresh scales neigh gc thresholds of each running ip family with the known neighbor count.
+func (c *CtrlHub) updateNeighGCThresh(logger logr.Logger, neighCounts map[networkingv1.IPVersion]int) error {
+	tuners := map[networkingv1.IPVersion]*daemonutils.NeighGCThreshTuner{
+		networkingv1.IPv4: c.neighGCThreshV4Tuner,
+	}
+	if !c.ipv6Disabled {
+		tuners[networkingv1.IPv6] = c.neighGCThreshV6Tuner
+	}
+
+	for ipVersion, tuner := range tuners {
+		rewritten, err := tuner.Update(neighCounts[ipVersion])
+		if err != nil {
+			return fmt.Errorf("failed to update %v neigh gc thresholds: %v", ipVersion, err)
+		}
+		if rewritten {
+			logger.Info("neigh gc thresholds updated", "family", ipVersion,
+				"neighbors", neighCounts[ipVersion], "thresholds", tuner.Current())
+		}
+	}
+	return nil
+}
+
 // Once node network interface is set from down to up for some reasons, the routes and neigh caches for this interface
 // will be cleaned, which should cause unrecoverable problems. Listening "UP" netlink events for interfaces and
 // triggering subnet and ip instance reconcile loop will be the best way to recover routes and neigh caches.
@@ -477,8 +743,9 @@ func (c *CtrlHub) handleVxlanInterfaceNeighEvent() error {
 
 func (c *CtrlHub) iptablesSyncLoop() {
 	iptablesSyncFunc := func() error {
-		c.iptablesV4Manager.Reset()
-		c.iptablesV6Manager.Reset()
+		for _, iptablesManager := range c.iptablesManagers() {
+			iptablesManager.Reset()
+		}
 
 		networkList := &networkingv1.NetworkList{}
 		if err := c.mgr.GetClient().List(context.TODO(), networkList); err != nil {
@@ -495,12 +762,14 @@ func (c *CtrlHub) iptablesSyncLoop() {
 					return fmt.Errorf("failed to generate vxlan forward node if name: %v", err)
 				}
 
-				c.iptablesV4Manager.SetOverlayIfName(overlayIfName)
-				c.iptablesV6Manager.SetOverlayIfName(overlayIfName)
+				for _, iptablesManager := range c.iptablesManagers() {
+					iptablesManager.SetOverlayIfName(overlayIfName)
+				}
 			case networkingv1.NetworkModeBGP:
 				if nodeBelongsToNetwork(c.config.NodeName, &network) {
-					c.iptablesV4Manager.SetBgpIfName(c.config.NodeBGPIfName)
-					c.iptablesV6Manager.SetBgpIfName(c.config.NodeBGPIfName)
+					for _, iptablesManager := range c.iptablesManagers() {
+						iptablesManager.SetBgpIfName(c.config.NodeBGPIfName)
+					}
 				}
 			}
 		}
@@ -527,7 +796,7 @@ func (c *CtrlHub) iptablesSyncLoop() {
 					if ip.To4() != nil {
 						// v4 address
 						c.iptablesV4Manager.RecordLocalNodeIP(ip)
-					} else {
+					} else if !c.ipv6Disabled {
 						// v6 address
 						c.iptablesV6Manager.RecordLocalNodeIP(ip)
 					}
@@ -539,7 +808,7 @@ func (c *CtrlHub) iptablesSyncLoop() {
 				if ip.To4() != nil {
 					// v4 address
 					c.iptablesV4Manager.RecordNodeIP(ip)
-				} else {
+				} else if !c.ipv6Disabled {
 					// v6 address
 					c.iptablesV6Manager.RecordNodeIP(ip)
 				}
@@ -569,10 +838,10 @@ func (c *CtrlHub) iptablesSyncLoop() {
 				return fmt.Errorf("parse pod ip %v error: %v", ipInstance.Spec.Address.IP, err)
 			}
 
-			if podIP.To4() == nil {
-				c.iptablesV6Manager.RecordLocalPodIP(podIP)
-			} else {
+			if podIP.To4() != nil {
 				c.iptablesV4Manager.RecordLocalPodIP(podIP)
+			} else if !c.ipv6Disabled {
+				c.iptablesV6Manager.RecordLocalPodIP(podIP)
 			}
 		}
 
@@ -594,6 +863,9 @@ func (c *CtrlHub) iptablesSyncLoop() {
 			}
 
 			iptablesManager := c.getIPtablesManager(subnet.Spec.Range.Version)
+			if iptablesManager == nil {
+				continue
+			}
 
 			// isLocal means whether this node belongs to this network
 			isLocal := nodeBelongsToNetwork(c.config.NodeName, network)
@@ -614,9 +886,13 @@ func (c *CtrlHub) iptablesSyncLoop() {
 				iptablesManager.RecordVlanForwardIfName(vlanForwardIfName)
 			}
 
-			iptablesManager.RecordSubnet(cidr,
-				networkingv1.GetNetworkType(network) == networkingv1.NetworkTypeOverlay,
-				isLocal)
+			isOverlay := networkingv1.GetNetworkType(network) == networkingv1.NetworkTypeOverlay
+			iptablesManager.RecordSubnet(cidr, isOverlay, isLocal)
+
+			if egressGateway, exist := subnet.Annotations[constants.AnnotationEgressGateway]; exist && isOverlay &&
+				net.ParseIP(egressGateway) != nil {
+				iptablesManager.RecordEgressSubnet(cidr)
+			}
 		}
 
 		if feature.MultiClusterEnabled() {
@@ -640,7 +916,7 @@ func (c *CtrlHub) iptablesSyncLoop() {
 					if ip.To4() != nil {
 						// v4 address
 						c.iptablesV4Manager.RecordRemoteNodeIP(ip)
-					} else {
+					} else if !c.ipv6Disabled {
 						// v6 address
 						c.iptablesV6Manager.RecordRemoteNodeIP(ip)
 					}
@@ -652,7 +928,7 @@ func (c *CtrlHub) iptablesSyncLoop() {
 					if ip.To4() != nil {
 						// v4 address
 						c.iptablesV4Manager.RecordRemoteNodeIP(ip)
-					} else {
+					} else if !c.ipv6Disabled {
 						// v6 address
 						c.iptablesV6Manager.RecordRemoteNodeIP(ip)
 					}
@@ -666,8 +942,10 @@ func (c *CtrlHub) iptablesSyncLoop() {
 					return fmt.Errorf("failed to parse remote subnet cidr %v: %v", remoteSubnet.Spec.Range.CIDR, err)
 				}
 
-				c.getIPtablesManager(remoteSubnet.Spec.Range.Version).
-					RecordRemoteSubnet(cidr, multiclusterv1.GetRemoteSubnetType(&remoteSubnet) == networkingv1.NetworkTypeOverlay)
+				if iptablesManager := c.getIPtablesManager(remoteSubnet.Spec.Range.Version); iptablesManager != nil {
+					iptablesManager.RecordRemoteSubnet(cidr,
+						multiclusterv1.GetRemoteSubnetType(&remoteSubnet) == networkingv1.NetworkTypeOverlay)
+				}
 			}
 		}
 
@@ -676,12 +954,7 @@ func (c *CtrlHub) iptablesSyncLoop() {
 			return fmt.Errorf("failed to sync v4 iptables rule: %v", err)
 		}
 
-		globalDisabled, err := daemonutils.CheckIPv6GlobalDisabled()
-		if err != nil {
-			return fmt.Errorf("failed to check ipv6 global disabled: %v", err)
-		}
-
-		if !globalDisabled {
+		if !c.ipv6Disabled {
 			if err := c.iptablesV6Manager.SyncRules(); err != nil {
 				return fmt.Errorf("failed to sync v6 iptables rule: %v", err)
 			}
@@ -704,6 +977,30 @@ func (c *CtrlHub) iptablesSyncLoop() {
 	}()
 }
 
+// ipv6RouteGCParametersCheckLoop re-asserts the ipv6 route cache parameters periodically, because
+// they might be reset by other processes while the workaround of ipv6 route cache is still needed.
+func (c *CtrlHub) ipv6RouteGCParametersCheckLoop() {
+	if c.ipv6Disabled || c.config.IPv6RouteCacheCheckInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.config.IPv6RouteCacheCheckInterval)
+
+	go func() {
+		for range ticker.C {
+			reapplied, err := daemonutils.ReassertIPv6RouteGCParameters(c.config.IPv6RouteCacheMaxSize,
+				c.config.IPv6RouteCacheGCThresh)
+			for _, sysctlPath := range reapplied {
+				metrics.SysctlReappliedCounter.WithLabelValues(sysctlPath).Inc()
+				c.logger.Info("ipv6 route cache parameter drifted and re-applied", "sysctl", sysctlPath)
+			}
+			if err != nil {
+				c.logger.Error(err, "failed to re-assert ipv6 route cache parameters")
+			}
+		}
+	}()
+}
+
 func (c *CtrlHub) iptablesSyncTrigger() {
 	select {
 	case c.iptablesSyncCh <- struct{}{}:
@@ -713,6 +1010,7 @@ func (c *CtrlHub) iptablesSyncTrigger() {
 
 func (c *CtrlHub) runHealthyServer() {
 	health := healthcheck.NewHandler()
+	health.AddReadinessCheck("route-sync", c.checkRouteSyncReadiness)
 
 	go func() {
 		_ = http.ListenAndServe(c.config.HealthyServerAddress, health)
@@ -721,6 +1019,16 @@ func (c *CtrlHub) runHealthyServer() {
 	c.logger.Info("start healthy server", "bind-address", c.config.HealthyServerAddress)
 }
 
+// checkRouteSyncReadiness reports not-ready until routes of all families are programmed and kept up-to-date.
+func (c *CtrlHub) checkRouteSyncReadiness() error {
+	for _, routeManager := range c.routeManagers() {
+		if err := routeManager.CheckReadiness(time.Now()); err != nil {
+			return fmt.Errorf("routes of family %v are not ready: %v", routeManager.Family(), err)
+		}
+	}
+	return nil
+}
+
 func isNeighResolving(state int) bool {
 	// We need a neigh cache to be STALE if it's not used for a while.
 	return (state & netlink.NUD_INCOMPLETE) != 0
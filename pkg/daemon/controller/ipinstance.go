@@ -38,8 +38,12 @@ import (
 	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
 	"github.com/alibaba/hybridnet/pkg/constants"
 	daemonutils "github.com/alibaba/hybridnet/pkg/daemon/utils"
+	"github.com/alibaba/hybridnet/pkg/metrics"
+	"github.com/vishvananda/netlink"
 )
 
+const ipInstanceRouteRecheckInterval = 10 * time.Second
+
 type ipInstanceReconciler struct {
 	client.Client
 	ctrlHubRef *CtrlHub
@@ -61,8 +65,9 @@ func (r *ipInstanceReconciler) Reconcile(ctx context.Context, request reconcile.
 			r.ctrlHubRef.config.NodeName, err)
 	}
 
-	r.ctrlHubRef.neighV4Manager.ResetInfos()
-	r.ctrlHubRef.neighV6Manager.ResetInfos()
+	for _, neighManager := range r.ctrlHubRef.neighManagers() {
+		neighManager.ResetInfos()
+	}
 
 	r.ctrlHubRef.addrV4Manager.ResetInfos()
 	r.ctrlHubRef.bgpManager.ResetIPInfos()
@@ -73,6 +78,7 @@ func (r *ipInstanceReconciler) Reconcile(ctx context.Context, request reconcile.
 		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to collect global network info and init: %v", err)
 	}
 
+	routeChecks := map[string]*subnetRouteCheck{}
 	for _, ipInstance := range ipInstanceList.Items {
 		// skip reserved ip instance
 		if networkingv1.IsReserved(&ipInstance) {
@@ -92,7 +98,8 @@ func (r *ipInstanceReconciler) Reconcile(ctx context.Context, request reconcile.
 		}
 
 		var forwardNodeIfName string
-		switch networkingv1.GetNetworkMode(network) {
+		networkMode := networkingv1.GetNetworkMode(network)
+		switch networkMode {
 		case networkingv1.NetworkModeVlan:
 			forwardNodeIfName, err = daemonutils.GenerateVlanNetIfName(r.ctrlHubRef.config.NodeVlanIfName, netID)
 			if err != nil {
@@ -118,6 +125,21 @@ func (r *ipInstanceReconciler) Reconcile(ctx context.Context, request reconcile.
 
 		// create proxy neigh
 		neighManager := r.ctrlHubRef.getNeighManager(ipInstance.Spec.Address.Version)
+		if neighManager == nil {
+			continue
+		}
+
+		family := netlink.FAMILY_V4
+		if ipInstance.Spec.Address.Version == networkingv1.IPv6 {
+			family = netlink.FAMILY_V6
+		}
+		// rules and routes are only programmed for overlay subnets and underlay subnets on this node, and
+		// those of deferred or drained subnets are absent on purpose
+		routeManager := r.ctrlHubRef.getRouterManager(ipInstance.Spec.Address.Version)
+		if info, found := routeManager.FindSubnetInfoByIP(podIP); found && !r.ctrlHubRef.isSubnetUnprogrammed(info.CIDR()) &&
+			(networkMode == networkingv1.NetworkModeVxlan || routeManager.IsUnderlaySubnetOnHost(info.CIDR())) {
+			addSubnetRouteCheck(routeChecks, ipInstance.Name, info.CIDR(), family, networkMode)
+		}
 
 		if len(overlayForwardNodeIfName) != 0 {
 			// Every underlay pod should also add a proxy neigh on overlay forward interface.
@@ -135,27 +157,50 @@ func (r *ipInstanceReconciler) Reconcile(ctx context.Context, request reconcile.
 		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to sync ipv4 neighs: %v", err)
 	}
 
-	globalDisabled, err := daemonutils.CheckIPv6GlobalDisabled()
-	if err != nil {
-		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to check ipv6 global disabled: %v", err)
-	}
-
-	if !globalDisabled {
+	if !r.ctrlHubRef.ipv6Disabled {
 		if err := r.ctrlHubRef.neighV6Manager.SyncNeighs(); err != nil {
 			return reconcile.Result{Requeue: true}, fmt.Errorf("failed to sync ipv6 neighs: %v", err)
 		}
 	}
 
-	if err := r.ctrlHubRef.addrV4Manager.SyncAddresses(r.ctrlHubRef.getIPInstanceByAddress); err != nil {
+	addrPlan, err := r.ctrlHubRef.addrV4Manager.SyncAddresses(r.ctrlHubRef.getIPInstanceByAddress, false)
+	if err != nil {
 		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to sync ipv4 addresses: %v", err)
 	}
 
+	for _, operation := range addrPlan.MisScoped {
+		logger.Info("enhanced address is not with link scope and might be selected as source ip",
+			"interface", operation.LinkName, "address", operation.Addr.IPNet.String(),
+			"scope", netlink.Scope(operation.Addr.Scope).String())
+	}
+
+	if err := r.ctrlHubRef.addrV4Manager.SyncForwardInterfaceModes(); err != nil {
+		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to sync forward interface modes: %v", err)
+	}
+
 	if err := r.ctrlHubRef.bgpManager.SyncIPInfos(); err != nil {
 		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to sync bgp ip paths: %v", err)
 	}
 
 	r.ctrlHubRef.iptablesSyncTrigger()
 
+	// Pods will be silently broken if their subnet rules or routes are lost, e.g., after daemon crashes.
+	lackingIPInstances, err := ipInstancesLackingRoutes(routeChecks, checkSubnetRoutesProgrammed)
+	if err != nil {
+		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to check routes of local ip instances: %v", err)
+	}
+
+	metrics.IPInstanceLackingRoutesGauge.Set(float64(len(lackingIPInstances)))
+
+	if len(lackingIPInstances) != 0 {
+		logger.Info("policy rules or routes of local ip instances are not programmed, trigger subnet sync",
+			"ipInstances", lackingIPInstances)
+		r.ctrlHubRef.subnetTriggerSourceForRouteCheck.Trigger()
+
+		// check again after subnet sync
+		return reconcile.Result{RequeueAfter: ipInstanceRouteRecheckInterval}, nil
+	}
+
 	return reconcile.Result{}, nil
 }
 
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"reflect"
 	"sort"
 
 	utils2 "github.com/alibaba/hybridnet/pkg/utils"
@@ -122,11 +123,25 @@ func (r *nodeInfoReconciler) Reconcile(ctx context.Context, request reconcile.Re
 	// if the vtep ip change, vxlan interface will be rebuilt
 	vxlanDev, err := vxlan.NewVxlanDevice(vxlanLinkName, int(*overlayNetID),
 		r.ctrlHubRef.config.NodeVxlanIfName, vtepIP, r.ctrlHubRef.config.VxlanUDPPort,
-		r.ctrlHubRef.config.VxlanBaseReachableTime, true)
+		r.ctrlHubRef.config.VxlanBaseReachableTime, vxlan.Flags{
+			Learning: r.ctrlHubRef.config.VxlanLearning,
+			Proxy:    r.ctrlHubRef.config.VxlanProxy,
+			L2miss:   r.ctrlHubRef.config.VxlanL2miss,
+			L3miss:   r.ctrlHubRef.config.VxlanL3miss,
+		}, r.ctrlHubRef.config.LinkWaitTimeout)
 	if err != nil {
 		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to create vxlan device %v: %v", vxlanLinkName, err)
 	}
 
+	// vxlan device of the old NetID is orphaned if NetID of overlay network changes
+	removedLinkNames, err := utils.RemoveStaleVxlanIfs(r.ctrlHubRef.config.NodeVxlanIfName, vxlanLinkName)
+	if len(removedLinkNames) != 0 {
+		logger.Info("stale vxlan devices removed", "devices", removedLinkNames)
+	}
+	if err != nil {
+		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to remove stale vxlan devices: %v", err)
+	}
+
 	if err := ensureVxlanInterfaceAddresses(vxlanDev, nodeLocalVxlanAddrs); err != nil {
 		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to ensure addresses for vxlan device %v: %v",
 			vxlanLinkName, err)
@@ -163,6 +178,8 @@ func (r *nodeInfoReconciler) Reconcile(ctx context.Context, request reconcile.Re
 			return reconcile.Result{Requeue: true}, fmt.Errorf("failed to list remote vtep: %v", err)
 		}
 
+		var remoteVtepIPs []net.IP
+		remoteVtepMacMap := map[string]net.HardwareAddr{}
 		for _, remoteVtep := range remoteVtepList.Items {
 			vtepMac, err := net.ParseMAC(remoteVtep.Spec.VTEPInfo.MAC)
 			if err != nil {
@@ -176,7 +193,27 @@ func (r *nodeInfoReconciler) Reconcile(ctx context.Context, request reconcile.Re
 					remoteVtep.Spec.VTEPInfo.IP)
 			}
 
-			vxlanDev.RecordVtepInfo(vtepMac, vtepIP)
+			remoteVtepIPs = append(remoteVtepIPs, vtepIP)
+			remoteVtepMacMap[vtepIP.String()] = vtepMac
+		}
+
+		// remote vteps of ipv6 are not routable if ipv6 is disabled on this node
+		skippedVtepIPs, err := utils.EnsureIPsReachable(remoteVtepIPs, r.ctrlHubRef.ipv6Disabled)
+		if err != nil {
+			return reconcile.Result{Requeue: true}, fmt.Errorf("failed to ensure remote vtep ips reachable: %v", err)
+		}
+		if len(skippedVtepIPs) != 0 {
+			logger.Info("skip remote vteps of disabled ip family", "vtepIPs", skippedVtepIPs)
+		}
+
+		skippedVtepIPMap := map[string]bool{}
+		for _, vtepIP := range skippedVtepIPs {
+			skippedVtepIPMap[vtepIP.String()] = true
+		}
+		for _, vtepIP := range remoteVtepIPs {
+			if !skippedVtepIPMap[vtepIP.String()] {
+				vxlanDev.RecordVtepInfo(remoteVtepMacMap[vtepIP.String()], vtepIP)
+			}
 		}
 	}
 
@@ -276,6 +313,26 @@ func (r *nodeInfoReconciler) selectNodeLocalVxlanAddrs(thisNode *corev1.Node, vt
 		}
 	}
 
+	// Add addresses selected by interfaces or labels, e.g., node-specific loopback addresses.
+	selectedAddrList, err := utils.ListLocalAddressBySelectors(vxlanLinkName, r.ctrlHubRef.config.VtepLocalIPInterfaces)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list address for vtep local ip interfaces: %v", err)
+	}
+
+	for _, addr := range selectedAddrList {
+		exist := false
+		for _, selectedAddr := range nodeLocalVxlanAddr {
+			if selectedAddr.IP.Equal(addr.IP) {
+				exist = true
+				break
+			}
+		}
+
+		if !exist {
+			nodeLocalVxlanAddr = append(nodeLocalVxlanAddr, addr)
+		}
+	}
+
 	return nodeLocalVxlanAddr, nil
 }
 
@@ -396,7 +453,8 @@ func (r *nodeInfoReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			UpdateFunc: func(updateEvent event.UpdateEvent) bool {
 				oldNetwork := updateEvent.ObjectOld.(*networkingv1.Network)
 				newNetwork := updateEvent.ObjectNew.(*networkingv1.Network)
-				return !utils2.DeepEqualStringSlice(oldNetwork.Status.NodeList, newNetwork.Status.NodeList)
+				return !utils2.DeepEqualStringSlice(oldNetwork.Status.NodeList, newNetwork.Status.NodeList) ||
+					!reflect.DeepEqual(oldNetwork.Spec.NetID, newNetwork.Spec.NetID)
 			},
 			CreateFunc: func(createEvent event.CreateEvent) bool {
 				network := createEvent.Object.(*networkingv1.Network)
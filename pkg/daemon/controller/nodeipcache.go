@@ -84,6 +84,20 @@ func (nic *NodeIPCache) UpdateNodeIPs(nodeInfoList []networkingv1.NodeInfo, loca
 	return nil
 }
 
+// CountIPs returns the number of cached node ips of an ip family.
+func (nic *NodeIPCache) CountIPs(ipVersion networkingv1.IPVersion) int {
+	nic.mu.RLock()
+	defer nic.mu.RUnlock()
+
+	count := 0
+	for ipString := range nic.nodeIPMap {
+		if ip := net.ParseIP(ipString); ip != nil && (ip.To4() == nil) == (ipVersion == networkingv1.IPv6) {
+			count++
+		}
+	}
+	return count
+}
+
 func (nic *NodeIPCache) SearchIP(ip net.IP) (net.HardwareAddr, bool) {
 	nic.mu.RLock()
 	defer nic.mu.RUnlock()
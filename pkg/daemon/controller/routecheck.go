@@ -0,0 +1,110 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+	"github.com/alibaba/hybridnet/pkg/daemon/route"
+	daemonutils "github.com/alibaba/hybridnet/pkg/daemon/utils"
+)
+
+// subnetRouteCheck is the policy rule and routes of a subnet expected by local ip instances.
+type subnetRouteCheck struct {
+	cidr        *net.IPNet
+	family      int
+	mode        networkingv1.NetworkMode
+	ipInstances []string
+}
+
+// addSubnetRouteCheck records that ip instance expects the policy rule and routes of subnet cidr.
+func addSubnetRouteCheck(checks map[string]*subnetRouteCheck, ipInstanceName string, cidr *net.IPNet,
+	family int, mode networkingv1.NetworkMode) {
+	cidrString := route.CanonicalCIDRKey(cidr)
+
+	check, exist := checks[cidrString]
+	if !exist {
+		check = &subnetRouteCheck{
+			cidr:   cidr,
+			family: family,
+			mode:   mode,
+		}
+		checks[cidrString] = check
+	}
+
+	check.ipInstances = append(check.ipInstances, ipInstanceName)
+}
+
+// ipInstancesLackingRoutes returns the sorted names of ip instances whose subnets are not programmed.
+func ipInstancesLackingRoutes(checks map[string]*subnetRouteCheck,
+	programmed func(check *subnetRouteCheck) (bool, error)) ([]string, error) {
+	var lacking []string
+	for _, check := range checks {
+		ok, err := programmed(check)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check routes of subnet %v: %v", check.cidr, err)
+		}
+
+		if !ok {
+			lacking = append(lacking, check.ipInstances...)
+		}
+	}
+
+	sort.Strings(lacking)
+	return lacking, nil
+}
+
+// checkSubnetRoutesProgrammed checks if the from-pod-subnet rule of subnet exists and its table has the
+// expected routes. Vlan and bgp subnets always need a default route, vxlan subnets need at least one route.
+func checkSubnetRoutesProgrammed(check *subnetRouteCheck) (bool, error) {
+	ruleExist, table, err := daemonutils.CheckPodRuleExist(check.cidr, check.family)
+	if err != nil {
+		return false, fmt.Errorf("failed to check rule exist: %v", err)
+	}
+
+	if !ruleExist {
+		return false, nil
+	}
+
+	switch check.mode {
+	case networkingv1.NetworkModeVlan, networkingv1.NetworkModeBGP, networkingv1.NetworkModeGlobalBGP:
+		defaultRouteExist, err := daemonutils.CheckDefaultRouteExist(table, check.family)
+		if err != nil {
+			return false, fmt.Errorf("failed to check default route exist: %v", err)
+		}
+		return defaultRouteExist, nil
+	default:
+		routeList, err := netlink.RouteListFiltered(check.family, &netlink.Route{
+			Table: table,
+		}, netlink.RT_FILTER_TABLE)
+		if err != nil {
+			return false, fmt.Errorf("failed to list route for table %v: %v", table, err)
+		}
+
+		for _, r := range routeList {
+			if r.Table == table {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
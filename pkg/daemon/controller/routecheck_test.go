@@ -0,0 +1,116 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+	"github.com/alibaba/hybridnet/pkg/daemon/route"
+)
+
+func TestIPInstancesLackingRoutes(t *testing.T) {
+	_, programmedCidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, lostCidr, _ := net.ParseCIDR("10.0.1.0/24")
+	_, lostV6Cidr, _ := net.ParseCIDR("fd00::/64")
+
+	checks := map[string]*subnetRouteCheck{}
+	addSubnetRouteCheck(checks, "pod-a", programmedCidr, netlink.FAMILY_V4, networkingv1.NetworkModeVlan)
+	addSubnetRouteCheck(checks, "pod-c", lostCidr, netlink.FAMILY_V4, networkingv1.NetworkModeVxlan)
+	addSubnetRouteCheck(checks, "pod-b", lostCidr, netlink.FAMILY_V4, networkingv1.NetworkModeVxlan)
+	addSubnetRouteCheck(checks, "pod-d", lostV6Cidr, netlink.FAMILY_V6, networkingv1.NetworkModeVxlan)
+
+	if len(checks) != 3 || len(checks[route.CanonicalCIDRKey(lostCidr)].ipInstances) != 2 {
+		t.Fatalf("ip instances are expected to be grouped by subnet, but got %v", checks)
+	}
+
+	checkedNum := 0
+	lacking, err := ipInstancesLackingRoutes(checks, func(check *subnetRouteCheck) (bool, error) {
+		checkedNum++
+		return route.CanonicalCIDRKey(check.cidr) == route.CanonicalCIDRKey(programmedCidr), nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if checkedNum != 3 {
+		t.Errorf("every subnet is expected to be checked once, but checked %v times", checkedNum)
+	}
+
+	if expected := []string{"pod-b", "pod-c", "pod-d"}; !reflect.DeepEqual(lacking, expected) {
+		t.Errorf("expect lacking ip instances %v, but got %v", expected, lacking)
+	}
+
+	if _, err := ipInstancesLackingRoutes(checks, func(check *subnetRouteCheck) (bool, error) {
+		return false, fmt.Errorf("list rule failed")
+	}); err == nil {
+		t.Errorf("expect error if check failed")
+	}
+}
+
+func TestUnprogrammedSubnets(t *testing.T) {
+	_, deferredCidr, _ := net.ParseCIDR("fd00::/64")
+	_, programmedCidr, _ := net.ParseCIDR("10.0.0.0/24")
+
+	c := &CtrlHub{}
+	if c.isSubnetUnprogrammed(deferredCidr) {
+		t.Fatalf("expect no subnet is unprogrammed before any subnet reconcile")
+	}
+
+	c.recordUnprogrammedSubnets(map[string]bool{route.CanonicalCIDRKey(deferredCidr): true})
+
+	// cidr parsed from the address of ip instance
+	_, podCidr, _ := net.ParseCIDR("fd00::5/64")
+	if !c.isSubnetUnprogrammed(podCidr) {
+		t.Errorf("expect subnet %v to be unprogrammed", deferredCidr)
+	}
+	if c.isSubnetUnprogrammed(programmedCidr) {
+		t.Errorf("expect subnet %v not to be unprogrammed", programmedCidr)
+	}
+
+	c.recordRouteReconcilePaused(true)
+	if !c.isSubnetUnprogrammed(programmedCidr) {
+		t.Errorf("expect subnet %v to be unprogrammed while route reconciliation is paused", programmedCidr)
+	}
+}
+
+func TestDeletedSubnets(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, sameCidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, otherCidr, _ := net.ParseCIDR("fd00::/64")
+
+	c := &CtrlHub{}
+	if cidrs := c.takeDeletedSubnets(); len(cidrs) != 0 {
+		t.Fatalf("expect no deleted subnet, but got %v", cidrs)
+	}
+
+	c.recordDeletedSubnet(cidr)
+	c.recordDeletedSubnet(sameCidr)
+	c.recordDeletedSubnet(otherCidr)
+	if cidrs := c.takeDeletedSubnets(); len(cidrs) != 2 {
+		t.Errorf("expect 2 deleted subnets, but got %v", cidrs)
+	}
+
+	if cidrs := c.takeDeletedSubnets(); len(cidrs) != 0 {
+		t.Errorf("expect deleted subnets to be cleared once taken, but got %v", cidrs)
+	}
+}
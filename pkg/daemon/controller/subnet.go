@@ -19,9 +19,14 @@ package controller
 import (
 	"context"
 	"fmt"
+	"net"
 	"reflect"
+	"time"
 
 	daemonutils "github.com/alibaba/hybridnet/pkg/daemon/utils"
+	"github.com/alibaba/hybridnet/pkg/metrics"
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -34,20 +39,34 @@ import (
 
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	multiclusterv1 "github.com/alibaba/hybridnet/pkg/apis/multicluster/v1"
 	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+	"github.com/alibaba/hybridnet/pkg/constants"
+	"github.com/alibaba/hybridnet/pkg/daemon/route"
 	"github.com/alibaba/hybridnet/pkg/feature"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const routeReconcilePausedRecheckInterval = 30 * time.Second
+
+// raGatewayRecheckInterval is the interval to re-detect gateways from router advertisements, which might change
+// without any event of kubernetes objects.
+const raGatewayRecheckInterval = 30 * time.Second
+
 type subnetReconciler struct {
 	client.Client
 	ctrlHubRef *CtrlHub
+
+	routeSyncBackoff *routeSyncBackoff
+
+	// the last gateways detected from router advertisements, indexed by forward interface name
+	raGateways map[string]net.IP
 }
 
 func (r *subnetReconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
@@ -59,8 +78,9 @@ func (r *subnetReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to list subnet %v", err)
 	}
 
-	r.ctrlHubRef.routeV4Manager.ResetInfos()
-	r.ctrlHubRef.routeV6Manager.ResetInfos()
+	for _, routeManager := range r.ctrlHubRef.routeManagers() {
+		routeManager.ResetInfos()
+	}
 
 	r.ctrlHubRef.bgpManager.ResetPeerAndSubnetInfos()
 
@@ -71,6 +91,14 @@ func (r *subnetReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to collect global network info and init: %v", err)
 	}
 
+	subnetNetworkMap := map[string]string{}
+	unprogrammedSubnets := map[string]bool{}
+	raGatewayDetecting := false
+	// neighbors of overlay peers and pods in the attached underlay subnets
+	neighCounts := map[networkingv1.IPVersion]int{
+		networkingv1.IPv4: r.ctrlHubRef.nodeIPCache.CountIPs(networkingv1.IPv4),
+		networkingv1.IPv6: r.ctrlHubRef.nodeIPCache.CountIPs(networkingv1.IPv6),
+	}
 	for _, subnet := range subnetList.Items {
 		network := &networkingv1.Network{}
 		if err := r.Get(ctx, types.NamespacedName{Name: subnet.Spec.Network}, network); err != nil {
@@ -98,12 +126,46 @@ func (r *subnetReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		switch networkMode {
 		case networkingv1.NetworkModeVlan:
 			if isUnderlayOnHost {
-				forwardNodeIfName, err = daemonutils.EnsureVlanIf(r.ctrlHubRef.config.NodeVlanIfName, netID)
+				forwardNodeIfName, err = daemonutils.EnsureVlanIf(r.ctrlHubRef.config.NodeVlanIfName, netID,
+					r.ctrlHubRef.config.LinkWaitTimeout)
 				if err != nil {
 					return reconcile.Result{Requeue: true}, fmt.Errorf("failed to ensure vlan forward node interface: %v", err)
 				}
+
+				if gatewayIP == nil && (subnet.Spec.Range.Version != networkingv1.IPv6 ||
+					!r.ctrlHubRef.config.EnableIPv6RAGatewayDetection) {
+					// only the gateway of ipv6 vlan subnet can be learned from router advertisements, other
+					// subnets are still programmed
+					logger.Info("no gateway specified or detected for vlan subnet, skip it", "subnet", subnet.Name,
+						"raGatewayDetection", r.ctrlHubRef.config.EnableIPv6RAGatewayDetection)
+					unprogrammedSubnets[route.CanonicalCIDRKey(subnetCidr)] = true
+					continue
+				}
+
+				if gatewayIP == nil {
+					raGatewayDetecting = true
+					if gatewayIP, err = r.detectRAGateway(forwardNodeIfName); err != nil {
+						if err != daemonutils.NotExist {
+							return reconcile.Result{Requeue: true}, fmt.Errorf("failed to detect gateway of subnet %v: %v",
+								subnet.Name, err)
+						}
+
+						// defer programming the subnet until any router advertisement is accepted
+						logger.Info("no gateway learned from router advertisements yet, defer subnet",
+							"subnet", subnet.Name, "interface", forwardNodeIfName)
+						unprogrammedSubnets[route.CanonicalCIDRKey(subnetCidr)] = true
+						continue
+					}
+				}
 			}
 		case networkingv1.NetworkModeVxlan:
+			// overlay subnets are not programmed on nodes unselected by network, which also makes
+			// routes and rules previously programmed for them cleaned up
+			if !isUnderlayOnHost {
+				logger.V(1).Info("ignore overlay subnet of network not selecting this node",
+					"subnet", subnet.Name, "network", network.Name)
+				continue
+			}
 			forwardNodeIfName = overlayForwardNodeIfName
 			isOverlay = true
 			autoNatOutgoing = networkingv1.IsSubnetAutoNatOutgoing(&subnet.Spec)
@@ -131,9 +193,80 @@ func (r *subnetReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 
 		// create policy route
 		routeManager := r.ctrlHubRef.getRouterManager(subnet.Spec.Range.Version)
+		if routeManager == nil {
+			logger.V(1).Info("ignore subnet of disabled ip family", "subnet", subnet.Name)
+			continue
+		}
+
+		// A draining subnet stops being advertised but keeps its routes for in-flight connections, until the
+		// drain grace period expires and its routes are removed.
+		if subnet.Annotations[constants.AnnotationSubnetDraining] == "true" {
+			r.ctrlHubRef.bgpManager.WithdrawSubnet(subnetCidr)
+			if routeManager.DrainSubnet(subnetCidr, time.Now()) {
+				logger.V(1).Info("ignore drained subnet", "subnet", subnet.Name)
+				unprogrammedSubnets[route.CanonicalCIDRKey(subnetCidr)] = true
+				continue
+			}
+		}
+
+		if isUnderlayOnHost && networkMode == networkingv1.NetworkModeVlan {
+			neighCounts[subnet.Spec.Range.Version] += int(subnet.Status.Used)
+		}
+
 		routeManager.AddSubnetInfo(subnetCidr, gatewayIP, startIP, endIP, excludeIPs,
 			forwardNodeIfName, autoNatOutgoing, isOverlay, isUnderlayOnHost, networkMode)
+		subnetNetworkMap[route.CanonicalCIDRKey(subnetCidr)] = network.Name
+
+		if isUnderlayOnHost && (networkMode == networkingv1.NetworkModeBGP || networkMode == networkingv1.NetworkModeGlobalBGP) {
+			for _, routeSrc := range r.ctrlHubRef.config.BGPRouteSourceIPs {
+				routeManager.SetSubnetRouteSource(subnetCidr, routeSrc)
+			}
+		}
+
+		if bgpGatewaysString, exist := subnet.Annotations[constants.AnnotationBGPGateways]; exist && isUnderlayOnHost &&
+			(networkMode == networkingv1.NetworkModeBGP || networkMode == networkingv1.NetworkModeGlobalBGP) {
+			// A malformed annotation of one subnet should not block the route sync of the others, the subnet
+			// just falls back to the default bgp gateway.
+			if bgpGateways, err := route.ParseBGPGateways(bgpGatewaysString); err != nil {
+				logger.Error(err, "ignore invalid bgp gateways of subnet", "subnet", subnet.Name,
+					"annotation", constants.AnnotationBGPGateways)
+			} else {
+				routeManager.SetSubnetBGPGateways(subnetCidr, bgpGateways)
+			}
+		}
+
+		if isOverlay && len(r.ctrlHubRef.config.OverlayDestinationCIDRs) != 0 {
+			routeManager.SetSubnetOverlayDestinations(subnetCidr, r.ctrlHubRef.config.OverlayDestinationCIDRs)
+		}
+
+		if egressGatewayString, exist := subnet.Annotations[constants.AnnotationEgressGateway]; exist && isOverlay {
+			egressGateway := net.ParseIP(egressGatewayString)
+			if egressGateway == nil {
+				return reconcile.Result{Requeue: true}, fmt.Errorf("failed to parse egress gateway %v of subnet %v",
+					egressGatewayString, subnet.Name)
+			}
+			routeManager.SetSubnetEgressGateway(subnetCidr, egressGateway)
+		}
+
+		if isOverlay {
+			routeMTU, routeAdvMSS, err := parseSubnetRouteMTU(subnet.Annotations)
+			if err != nil {
+				return reconcile.Result{Requeue: true}, fmt.Errorf("failed to parse route mtu of subnet %v: %v",
+					subnet.Name, err)
+			}
+			routeManager.SetSubnetRouteMTU(subnetCidr, routeMTU, routeAdvMSS)
+		}
+
+		if dscpGatewaysString, exist := subnet.Annotations[constants.AnnotationDSCPGateways]; exist && isUnderlayOnHost &&
+			networkMode == networkingv1.NetworkModeVlan {
+			dscpGateways, err := route.ParseDSCPGateways(dscpGatewaysString)
+			if err != nil {
+				return reconcile.Result{Requeue: true}, fmt.Errorf("failed to parse dscp gateways of subnet %v: %v", subnet.Name, err)
+			}
+			routeManager.SetSubnetDSCPGateways(subnetCidr, dscpGateways)
+		}
 	}
+	r.ctrlHubRef.recordUnprogrammedSubnets(unprogrammedSubnets)
 
 	if feature.MultiClusterEnabled() {
 		logger.Info("Reconciling remote subnet information")
@@ -154,7 +287,23 @@ func (r *subnetReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 			var isOverlay = multiclusterv1.GetRemoteSubnetType(&remoteSubnet) == networkingv1.NetworkTypeOverlay
 
 			routeManager := r.ctrlHubRef.getRouterManager(remoteSubnet.Spec.Range.Version)
-			err = routeManager.AddRemoteSubnetInfo(subnetCidr, gatewayIP, startIP, endIP, excludeIPs, isOverlay)
+			if routeManager == nil {
+				continue
+			}
+
+			var forwardNodeIfName string
+			if isOverlay {
+				forwardNodeIfName, err = r.ctrlHubRef.ResolveRemoteForwardInterface(routeManager.Family())
+				if err != nil {
+					// routes to remote overlay subnets can only be programmed through a local vxlan interface
+					logger.Info("skip remote overlay subnet without local overlay forward interface",
+						"remoteSubnet", remoteSubnet.Name, "reason", err.Error())
+					continue
+				}
+			}
+
+			err = routeManager.AddRemoteSubnetInfo(subnetCidr, gatewayIP, startIP, endIP, excludeIPs,
+				forwardNodeIfName, isOverlay)
 
 			if err != nil {
 				return reconcile.Result{Requeue: true}, fmt.Errorf("failed to add remote subnet info: %v", err)
@@ -162,28 +311,288 @@ func (r *subnetReconciler) Reconcile(ctx context.Context, request reconcile.Requ
 		}
 	}
 
-	if err := r.ctrlHubRef.routeV4Manager.SyncRoutes(); err != nil {
-		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to sync ipv4 routes: %v", err)
+	routeReconcilePaused, err := r.updateRouteReconcilePause(ctx, logger)
+	if err != nil {
+		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to update route reconcile pause: %v", err)
 	}
+	r.ctrlHubRef.recordRouteReconcilePaused(routeReconcilePaused)
 
-	globalDisabled, err := daemonutils.CheckIPv6GlobalDisabled()
-	if err != nil {
-		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to check ipv6 global disabled: %v", err)
+	// deleted subnets are kept to be removed until route reconciliation is resumed
+	if !routeReconcilePaused {
+		r.removeDeletedSubnets(logger, subnetNetworkMap)
 	}
 
-	if !globalDisabled {
-		if err := r.ctrlHubRef.routeV6Manager.SyncRoutes(); err != nil {
-			return reconcile.Result{Requeue: true}, fmt.Errorf("failed to sync ipv6 routes: %v", err)
+	syncErr := r.syncRoutes()
+
+	// Audit even if sync failed, because a partial failure is the main cause of asymmetric dual-stack routes.
+	if !r.ctrlHubRef.ipv6Disabled {
+		if err := r.auditDualStackRoutes(logger, subnetNetworkMap); err != nil {
+			logger.Error(err, "failed to audit dual-stack routes")
 		}
 	}
+	r.auditInvalidPriorityRules(logger)
 
-	if err := r.ctrlHubRef.bgpManager.SyncPeerAndSubnetInfos(); err != nil {
+	if syncErr != nil {
+		return r.requeueAfterRouteSyncFailure(ctx, logger, syncErr), nil
+	}
+	r.routeSyncBackoff.reset()
+
+	var localSubnetSummaries []route.LocalSubnetSummary
+	var routeStates []*route.ExportedState
+	for _, routeManager := range r.ctrlHubRef.routeManagers() {
+		summaries, err := routeManager.LocalSubnetSummaries()
+		if err != nil {
+			return reconcile.Result{Requeue: true}, fmt.Errorf("failed to summarize local subnets: %v", err)
+		}
+		localSubnetSummaries = append(localSubnetSummaries, summaries...)
+
+		// route states are only for debugging, which should never fail the reconcile
+		state, err := routeManager.ExportState()
+		if err != nil {
+			logger.Error(err, "failed to export route state", "family", routeManager.Family())
+			continue
+		}
+		routeStates = append(routeStates, state)
+	}
+	r.ctrlHubRef.recordLocalSubnetSummaries(localSubnetSummaries)
+	r.ctrlHubRef.recordRouteStates(routeStates)
+
+	if err := r.ctrlHubRef.updateNeighGCThresh(logger, neighCounts); err != nil {
+		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to update neigh gc thresholds: %v", err)
+	}
+
+	for _, routeManager := range r.ctrlHubRef.routeManagers() {
+		for cidr, err := range routeManager.GetUnreachableGateways() {
+			logger.Info("gateway of subnet is unreachable", "subnet", cidr, "message", err)
+		}
+	}
+
+	err = r.ctrlHubRef.bgpManager.SyncPeerAndSubnetInfos()
+	// peers might be changed or failed to be configured
+	r.ctrlHubRef.bgpPeerStatusTrigger()
+	if err != nil {
 		return reconcile.Result{Requeue: true}, fmt.Errorf("failed to sync bgp peers and subnet paths: %v", err)
 	}
 
 	r.ctrlHubRef.iptablesSyncTrigger()
 
-	return reconcile.Result{}, nil
+	// Requeue to flush the route tables of removed subnets after their grace period,
+	var requeueAfter time.Duration
+	for _, routeManager := range r.ctrlHubRef.routeManagers() {
+		if deadline, exist := routeManager.NextPendingTableDeleteDeadline(); exist {
+			if after := time.Until(deadline) + time.Second; requeueAfter == 0 || after < requeueAfter {
+				requeueAfter = after
+			}
+		}
+
+		// and to remove the routes of draining subnets after their drain grace period
+		if deadline, exist := routeManager.NextSubnetDrainDeadline(time.Now()); exist {
+			if after := time.Until(deadline) + time.Second; requeueAfter == 0 || after < requeueAfter {
+				requeueAfter = after
+			}
+		}
+	}
+
+	// Node objects are not in list/watch cache, so requeue to check if route reconciliation has been resumed.
+	if routeReconcilePaused && (requeueAfter == 0 || routeReconcilePausedRecheckInterval < requeueAfter) {
+		requeueAfter = routeReconcilePausedRecheckInterval
+	}
+
+	if raGatewayDetecting && (requeueAfter == 0 || raGatewayRecheckInterval < requeueAfter) {
+		requeueAfter = raGatewayRecheckInterval
+	}
+
+	// Resync periodically to keep routes from getting stale for readiness checks.
+	if staleWindow := r.ctrlHubRef.config.RouteSyncStaleWindow; staleWindow > 0 &&
+		(requeueAfter == 0 || staleWindow/2 < requeueAfter) {
+		requeueAfter = staleWindow / 2
+	}
+
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// detectRAGateway detects the gateway from router advertisements on the forward interface, the last detected
+// gateway is returned if the ra-learned default route disappears for now, e.g., router lifetime expires.
+func (r *subnetReconciler) detectRAGateway(forwardNodeIfName string) (net.IP, error) {
+	// ipv6 forwarding is enabled, router advertisements are accepted only if accept_ra is 2
+	if err := daemonutils.SetSysctl(fmt.Sprintf(constants.AcceptRASysctl, forwardNodeIfName), 2); err != nil {
+		return nil, fmt.Errorf("failed to accept router advertisements on %v: %v", forwardNodeIfName, err)
+	}
+
+	forwardNodeIf, err := netlink.LinkByName(forwardNodeIfName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get forward interface %v: %v", forwardNodeIfName, err)
+	}
+
+	gateway, err := daemonutils.GetRAGateway(forwardNodeIf.Attrs().Index)
+	if err == daemonutils.NotExist {
+		if lastGateway, exist := r.raGateways[forwardNodeIfName]; exist {
+			return lastGateway, nil
+		}
+		return nil, daemonutils.NotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ra-learned gateway on %v: %v", forwardNodeIfName, err)
+	}
+
+	r.raGateways[forwardNodeIfName] = gateway
+	return gateway, nil
+}
+
+// updateRouteReconcilePause pauses or resumes route managers according to the annotation of this node,
+// and returns if route reconciliation is paused.
+func (r *subnetReconciler) updateRouteReconcilePause(ctx context.Context, logger logr.Logger) (bool, error) {
+	thisNode := &corev1.Node{}
+	if err := r.ctrlHubRef.mgr.GetAPIReader().Get(ctx, types.NamespacedName{
+		Name: r.ctrlHubRef.config.NodeName,
+	}, thisNode); err != nil {
+		return false, fmt.Errorf("failed to get node object %v: %v", r.ctrlHubRef.config.NodeName, err)
+	}
+
+	paused := thisNode.Annotations[constants.AnnotationRouteReconcilePaused] == "true"
+	for _, routeManager := range r.ctrlHubRef.routeManagers() {
+		if paused {
+			routeManager.Pause()
+		} else if routeManager.Resume() {
+			logger.Info("route reconciliation resumed, reconcile all routes to converge",
+				"family", routeManager.Family())
+		}
+	}
+
+	return paused, nil
+}
+
+// requeueAfterRouteSyncFailure backs off the next sync after route sync failed to avoid hammering netlink, and
+// records an event on this node if the failure is caused by bad configuration.
+func (r *subnetReconciler) requeueAfterRouteSyncFailure(ctx context.Context, logger logr.Logger,
+	syncErr error) reconcile.Result {
+	delay, permanent := r.routeSyncBackoff.next(syncErr)
+
+	// The direct route of a local vlan subnet might appear a moment later, e.g., during boot, it is not a real failure
+	// and might be installed by daemon after a grace period.
+	if route.IsMissingDirectRouteError(syncErr) {
+		for _, routeManager := range r.ctrlHubRef.routeManagers() {
+			if deadline, exist := routeManager.NextDirectRouteInstallDeadline(time.Now()); exist {
+				if after := time.Until(deadline) + time.Second; after < delay {
+					delay = after
+				}
+			}
+		}
+		logger.Info("waiting for direct route of local vlan subnet", "reason", syncErr.Error(), "requeueAfter", delay)
+		return reconcile.Result{RequeueAfter: delay}
+	}
+
+	logger.Error(syncErr, "failed to sync routes", "permanent", permanent, "requeueAfter", delay)
+
+	if permanent {
+		thisNode := &corev1.Node{}
+		if err := r.ctrlHubRef.mgr.GetAPIReader().Get(ctx, types.NamespacedName{
+			Name: r.ctrlHubRef.config.NodeName,
+		}, thisNode); err != nil {
+			logger.Error(err, "failed to get node object for route sync failure event")
+		} else {
+			r.ctrlHubRef.mgr.GetEventRecorderFor("DaemonSubnetController").Event(thisNode, corev1.EventTypeWarning,
+				"RouteSyncFailed", syncErr.Error())
+		}
+	}
+
+	return reconcile.Result{RequeueAfter: delay}
+}
+
+// removeDeletedSubnets tears down the rules and route tables of deleted subnets immediately, a subnet recreated
+// with the same cidr is kept. Failures are only logged, as the next route sync cleans them up anyway.
+func (r *subnetReconciler) removeDeletedSubnets(logger logr.Logger, subnetNetworkMap map[string]string) {
+	for _, cidr := range r.ctrlHubRef.takeDeletedSubnets() {
+		if _, exist := subnetNetworkMap[route.CanonicalCIDRKey(cidr)]; exist {
+			continue
+		}
+
+		version := networkingv1.IPv4
+		if cidr.IP.To4() == nil {
+			version = networkingv1.IPv6
+		}
+
+		routeManager := r.ctrlHubRef.getRouterManager(version)
+		if routeManager == nil {
+			continue
+		}
+
+		if err := routeManager.RemoveSubnet(cidr); err != nil {
+			logger.Error(err, "failed to remove deleted subnet", "subnet", cidr.String())
+		}
+	}
+}
+
+func (r *subnetReconciler) syncRoutes() error {
+	if r.ctrlHubRef.takeRouteFlushRequest() {
+		return r.flushRoutes()
+	}
+
+	if err := r.ctrlHubRef.routeV4Manager.SyncRoutes(); err != nil {
+		return fmt.Errorf("failed to sync ipv4 routes: %w", err)
+	}
+
+	if !r.ctrlHubRef.ipv6Disabled {
+		if err := r.ctrlHubRef.routeV6Manager.SyncRoutes(); err != nil {
+			return fmt.Errorf("failed to sync ipv6 routes: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// flushRoutes flushes all the managed rules and routes and rebuilds them from the recorded subnet infos.
+func (r *subnetReconciler) flushRoutes() error {
+	if err := r.ctrlHubRef.routeV4Manager.FlushAll(); err != nil {
+		return fmt.Errorf("failed to flush ipv4 routes: %w", err)
+	}
+
+	if !r.ctrlHubRef.ipv6Disabled {
+		if err := r.ctrlHubRef.routeV6Manager.FlushAll(); err != nil {
+			return fmt.Errorf("failed to flush ipv6 routes: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// auditDualStackRoutes reports the dual-stack networks whose subnet rules are programmed for only one family.
+func (r *subnetReconciler) auditDualStackRoutes(logger logr.Logger, subnetNetworkMap map[string]string) error {
+	v4Programmed, err := r.ctrlHubRef.routeV4Manager.ProgrammedLocalSubnets()
+	if err != nil {
+		return fmt.Errorf("failed to get programmed ipv4 subnets: %v", err)
+	}
+
+	v6Programmed, err := r.ctrlHubRef.routeV6Manager.ProgrammedLocalSubnets()
+	if err != nil {
+		return fmt.Errorf("failed to get programmed ipv6 subnets: %v", err)
+	}
+
+	inconsistencies := route.AuditDualStackConsistency(v4Programmed, v6Programmed, subnetNetworkMap)
+	for _, inconsistency := range inconsistencies {
+		logger.Info("subnet rules of dual-stack network are programmed for only one ip family",
+			"network", inconsistency.Network, "missingFamily", inconsistency.MissingFamily,
+			"missingSubnets", inconsistency.MissingSubnets)
+	}
+
+	metrics.DualStackRouteInconsistencyGauge.Set(float64(len(inconsistencies)))
+	return nil
+}
+
+// auditInvalidPriorityRules reports the managed rules whose priorities are out of the allocation band.
+func (r *subnetReconciler) auditInvalidPriorityRules(logger logr.Logger) {
+	for _, routeManager := range r.ctrlHubRef.routeManagers() {
+		invalidRules, err := routeManager.DetectInvalidPriorityRules()
+		if err != nil {
+			logger.Error(err, "failed to detect rules with invalid priorities")
+			continue
+		}
+
+		for _, rule := range invalidRules {
+			logger.Info("managed policy rule is out of the priority band and needs to be corrected",
+				"rule", rule.String(), "priority", rule.Priority)
+		}
+	}
 }
 
 func (r *subnetReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -195,10 +604,20 @@ func (r *subnetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return fmt.Errorf("failed to create subnet controller: %v", err)
 	}
 
+	// Creation and deletion of any subnet, including underlay ones, trigger a full sync, so that routes of
+	// overlay subnets towards underlay subnets keep up with the set of underlay subnets.
 	if err := subnetController.Watch(&source.Kind{Type: &networkingv1.Subnet{}},
 		&fixedKeyHandler{key: "ForSubnetChange"},
 		&predicate.ResourceVersionChangedPredicate{},
 		&predicate.Funcs{
+			DeleteFunc: func(deleteEvent event.DeleteEvent) bool {
+				if subnet, ok := deleteEvent.Object.(*networkingv1.Subnet); ok {
+					if _, cidr, err := net.ParseCIDR(subnet.Spec.Range.CIDR); err == nil {
+						r.ctrlHubRef.recordDeletedSubnet(cidr)
+					}
+				}
+				return true
+			},
 			UpdateFunc: func(updateEvent event.UpdateEvent) bool {
 				oldSubnet := updateEvent.ObjectOld.(*networkingv1.Subnet)
 				newSubnet := updateEvent.ObjectNew.(*networkingv1.Subnet)
@@ -211,7 +630,8 @@ func (r *subnetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 					(oldSubnetNetID != nil && newSubnetNetID != nil && *oldSubnetNetID != *newSubnetNetID) ||
 					oldSubnet.Spec.Network != newSubnet.Spec.Network ||
 					!reflect.DeepEqual(oldSubnet.Spec.Range, newSubnet.Spec.Range) ||
-					networkingv1.IsSubnetAutoNatOutgoing(&oldSubnet.Spec) != networkingv1.IsSubnetAutoNatOutgoing(&newSubnet.Spec) {
+					networkingv1.IsSubnetAutoNatOutgoing(&oldSubnet.Spec) != networkingv1.IsSubnetAutoNatOutgoing(&newSubnet.Spec) ||
+					subnetRouteAnnotationsChanged(oldSubnet, newSubnet) {
 					return true
 				}
 				return false
@@ -227,8 +647,13 @@ func (r *subnetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				oldNetwork := updateEvent.ObjectOld.(*networkingv1.Network)
 				newNetwork := updateEvent.ObjectNew.(*networkingv1.Network)
 
-				if !utils.DeepEqualStringSlice(oldNetwork.Status.SubnetList, newNetwork.Status.SubnetList) ||
-					!utils.DeepEqualStringSlice(oldNetwork.Status.NodeList, newNetwork.Status.NodeList) {
+				if !utils.DeepEqualStringSlice(oldNetwork.Status.SubnetList, newNetwork.Status.SubnetList) {
+					return true
+				}
+
+				// Subnets of network are started or stopped being programmed on this node, changes of
+				// other nodes make no difference.
+				if nodeMembershipChanged(r.ctrlHubRef.config.NodeName, oldNetwork, newNetwork) {
 					return true
 				}
 
@@ -257,6 +682,14 @@ func (r *subnetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return fmt.Errorf("failed to watch subnetTriggerSourceForNodeInfoChange for subnet controller: %v", err)
 	}
 
+	if err := subnetController.Watch(r.ctrlHubRef.subnetTriggerSourceForRouteCheck, &handler.Funcs{}); err != nil {
+		return fmt.Errorf("failed to watch subnetTriggerSourceForRouteCheck for subnet controller: %v", err)
+	}
+
+	if err := subnetController.Watch(r.ctrlHubRef.subnetTriggerSourceForRouteFlush, &handler.Funcs{}); err != nil {
+		return fmt.Errorf("failed to watch subnetTriggerSourceForRouteFlush for subnet controller: %v", err)
+	}
+
 	// enable multicluster feature
 	if feature.MultiClusterEnabled() {
 		if err := subnetController.Watch(&source.Kind{
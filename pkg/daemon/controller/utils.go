@@ -20,6 +20,8 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
 
 	"github.com/alibaba/hybridnet/pkg/daemon/bgp"
 	daemonutils "github.com/alibaba/hybridnet/pkg/daemon/utils"
@@ -95,6 +97,7 @@ func (h *fixedKeyHandler) Update(e event.UpdateEvent, q workqueue.RateLimitingIn
 	}})
 }
 
+// getRouterManager returns nil for ipv6 if ipv6 is disabled
 func (c *CtrlHub) getRouterManager(ipVersion networkingv1.IPVersion) *route.Manager {
 	if ipVersion == networkingv1.IPv6 {
 		return c.routeV6Manager
@@ -102,6 +105,7 @@ func (c *CtrlHub) getRouterManager(ipVersion networkingv1.IPVersion) *route.Mana
 	return c.routeV4Manager
 }
 
+// getNeighManager returns nil for ipv6 if ipv6 is disabled
 func (c *CtrlHub) getNeighManager(ipVersion networkingv1.IPVersion) *neigh.Manager {
 	if ipVersion == networkingv1.IPv6 {
 		return c.neighV6Manager
@@ -109,6 +113,7 @@ func (c *CtrlHub) getNeighManager(ipVersion networkingv1.IPVersion) *neigh.Manag
 	return c.neighV4Manager
 }
 
+// getIPtablesManager returns nil for ipv6 if ipv6 is disabled
 func (c *CtrlHub) getIPtablesManager(ipVersion networkingv1.IPVersion) *iptables.Manager {
 	if ipVersion == networkingv1.IPv6 {
 		return c.iptablesV6Manager
@@ -116,6 +121,30 @@ func (c *CtrlHub) getIPtablesManager(ipVersion networkingv1.IPVersion) *iptables
 	return c.iptablesV4Manager
 }
 
+// routeManagers returns route managers of all the running ip families
+func (c *CtrlHub) routeManagers() []*route.Manager {
+	if c.ipv6Disabled {
+		return []*route.Manager{c.routeV4Manager}
+	}
+	return []*route.Manager{c.routeV4Manager, c.routeV6Manager}
+}
+
+// neighManagers returns neigh managers of all the running ip families
+func (c *CtrlHub) neighManagers() []*neigh.Manager {
+	if c.ipv6Disabled {
+		return []*neigh.Manager{c.neighV4Manager}
+	}
+	return []*neigh.Manager{c.neighV4Manager, c.neighV6Manager}
+}
+
+// iptablesManagers returns iptables managers of all the running ip families
+func (c *CtrlHub) iptablesManagers() []*iptables.Manager {
+	if c.ipv6Disabled {
+		return []*iptables.Manager{c.iptablesV4Manager}
+	}
+	return []*iptables.Manager{c.iptablesV4Manager, c.iptablesV6Manager}
+}
+
 func (c *CtrlHub) getIPInstanceByAddress(address net.IP) (*networkingv1.IPInstance, error) {
 	ctx := context.Background()
 	ipInstanceList := &networkingv1.IPInstanceList{}
@@ -260,8 +289,40 @@ func isIPListEqual(a, b []string) bool {
 	return gset.NewStrSetFrom(a).Equal(gset.NewStrSetFrom(b))
 }
 
+// parseSubnetRouteMTU parses the optional mtu and advmss of overlay subnet routes from subnet annotations,
+// zero is returned if not specified.
+func parseSubnetRouteMTU(annotations map[string]string) (mtu, advMSS int, err error) {
+	parse := func(key string, min int) (int, error) {
+		valueString, exist := annotations[key]
+		if !exist {
+			return 0, nil
+		}
+
+		value, err := strconv.Atoi(valueString)
+		if err != nil || value < min || value > 65535 {
+			return 0, fmt.Errorf("invalid %v %q, should be an integer in [%v, 65535]", key, valueString, min)
+		}
+		return value, nil
+	}
+
+	// 68 is the minimum mtu of ipv4
+	if mtu, err = parse(constants.AnnotationRouteMTU, 68); err != nil {
+		return 0, 0, err
+	}
+	if advMSS, err = parse(constants.AnnotationRouteAdvMSS, 1); err != nil {
+		return 0, 0, err
+	}
+
+	if mtu != 0 && advMSS >= mtu {
+		return 0, 0, fmt.Errorf("advmss %v should be smaller than mtu %v", advMSS, mtu)
+	}
+	return mtu, advMSS, nil
+}
+
+// nodeBelongsToNetwork returns true if the node is selected by the network. An overlay network without node
+// selector selects all nodes, otherwise the selected nodes are resolved from the node list of network status.
 func nodeBelongsToNetwork(nodeName string, network *networkingv1.Network) bool {
-	if networkingv1.GetNetworkType(network) == networkingv1.NetworkTypeOverlay {
+	if networkingv1.GetNetworkType(network) == networkingv1.NetworkTypeOverlay && len(network.Spec.NodeSelector) == 0 {
 		return true
 	}
 	isUnderlayOnHost := false
@@ -274,6 +335,100 @@ func nodeBelongsToNetwork(nodeName string, network *networkingv1.Network) bool {
 	return isUnderlayOnHost
 }
 
+// nodeMembershipChanged returns true if the node is added to or removed from the network.
+func nodeMembershipChanged(nodeName string, oldNetwork, newNetwork *networkingv1.Network) bool {
+	return nodeBelongsToNetwork(nodeName, oldNetwork) != nodeBelongsToNetwork(nodeName, newNetwork)
+}
+
+// subnetRouteAnnotations are the subnet annotations which the routes of subnet are configured by.
+var subnetRouteAnnotations = []string{
+	constants.AnnotationSubnetDraining,
+	constants.AnnotationEgressGateway,
+	constants.AnnotationDSCPGateways,
+	constants.AnnotationRouteMTU,
+	constants.AnnotationRouteAdvMSS,
+	constants.AnnotationBGPGateways,
+}
+
+// subnetRouteAnnotationsChanged returns true if any annotation configuring the routes of subnet is changed.
+func subnetRouteAnnotationsChanged(oldSubnet, newSubnet *networkingv1.Subnet) bool {
+	for _, key := range subnetRouteAnnotations {
+		oldValue, oldExist := oldSubnet.Annotations[key]
+		newValue, newExist := newSubnet.Annotations[key]
+		if oldExist != newExist || oldValue != newValue {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveRemoteForwardInterface returns the vxlan forward interface for traffic to remote endpoints of the
+// specified family, an error is returned if overlay network is not configured for the family.
+func (c *CtrlHub) ResolveRemoteForwardInterface(family int) (string, error) {
+	return resolveOverlayForwardNodeIfName(context.TODO(), c.mgr.GetClient(), c.config.NodeVxlanIfName,
+		c.config.NodeName, family, c.ipv6Disabled)
+}
+
+// resolveOverlayForwardNodeIfName resolves the vxlan forward interface of the first overlay network in name order
+// which selects this node.
+func resolveOverlayForwardNodeIfName(ctx context.Context, client client.Reader, nodeVxlanIfName, nodeName string,
+	family int, ipv6Disabled bool) (string, error) {
+	switch family {
+	case netlink.FAMILY_V4:
+	case netlink.FAMILY_V6:
+		if ipv6Disabled {
+			return "", fmt.Errorf("ipv6 is disabled on this node")
+		}
+	default:
+		return "", fmt.Errorf("unsupported ip family %v", family)
+	}
+
+	networkList := &networkingv1.NetworkList{}
+	if err := client.List(ctx, networkList); err != nil {
+		return "", fmt.Errorf("failed to list network: %v", err)
+	}
+	sortNetworksByName(networkList.Items)
+
+	var overlayNetwork *networkingv1.Network
+	for i := range networkList.Items {
+		if networkingv1.GetNetworkMode(&networkList.Items[i]) == networkingv1.NetworkModeVxlan &&
+			nodeBelongsToNetwork(nodeName, &networkList.Items[i]) {
+			overlayNetwork = &networkList.Items[i]
+			break
+		}
+	}
+
+	if overlayNetwork == nil {
+		return "", fmt.Errorf("overlay network is not configured")
+	}
+
+	subnetList := &networkingv1.SubnetList{}
+	if err := client.List(ctx, subnetList); err != nil {
+		return "", fmt.Errorf("failed to list subnet: %v", err)
+	}
+
+	familySubnetExist := false
+	for i := range subnetList.Items {
+		subnet := &subnetList.Items[i]
+		if subnet.Spec.Network == overlayNetwork.Name &&
+			networkingv1.IsIPv6Subnet(subnet) == (family == netlink.FAMILY_V6) {
+			familySubnetExist = true
+			break
+		}
+	}
+
+	if !familySubnetExist {
+		return "", fmt.Errorf("overlay network %v has no subnet of ip family %v", overlayNetwork.Name, family)
+	}
+
+	forwardNodeIfName, err := daemonutils.GenerateVxlanNetIfName(nodeVxlanIfName, overlayNetwork.Spec.NetID)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate vxlan forward node if name: %v", err)
+	}
+
+	return forwardNodeIfName, nil
+}
+
 func collectGlobalNetworkInfoAndInit(ctx context.Context, client client.Reader, nodeVxlanIfName, nodeName string,
 	bgpManager *bgp.Manager, recordBGPPeers bool) (vxlanForwardNodeIfName string, attachedBGPNetworkExist bool,
 	bgpGatewayIP net.IP, err error) {
@@ -283,10 +438,17 @@ func collectGlobalNetworkInfoAndInit(ctx context.Context, client client.Reader,
 		err = fmt.Errorf("failed to list network: %v", err)
 		return
 	}
+	sortNetworksByName(networkList.Items)
 
 	for _, network := range networkList.Items {
 		switch networkingv1.GetNetworkMode(&network) {
 		case networkingv1.NetworkModeVxlan:
+			// the first overlay network in name order selecting this node wins, the same as
+			// resolveOverlayForwardNodeIfName
+			if vxlanForwardNodeIfName != "" || !nodeBelongsToNetwork(nodeName, &network) {
+				continue
+			}
+
 			netID := network.Spec.NetID
 			vxlanForwardNodeIfName, err = daemonutils.GenerateVxlanNetIfName(nodeVxlanIfName, netID)
 			if err != nil {
@@ -339,3 +501,10 @@ func collectGlobalNetworkInfoAndInit(ctx context.Context, client client.Reader,
 
 	return
 }
+
+// sortNetworksByName makes the iteration over networks, which is in random order of list, reproducible.
+func sortNetworksByName(networks []networkingv1.Network) {
+	sort.Slice(networks, func(i, j int) bool {
+		return networks[i].Name < networks[j].Name
+	})
+}
@@ -0,0 +1,439 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+	"github.com/alibaba/hybridnet/pkg/constants"
+	"github.com/alibaba/hybridnet/pkg/daemon/iptables"
+	"github.com/alibaba/hybridnet/pkg/daemon/neigh"
+	"github.com/alibaba/hybridnet/pkg/daemon/route"
+)
+
+func TestManagersWithIPv6Disabled(t *testing.T) {
+	c := &CtrlHub{
+		routeV4Manager:    &route.Manager{},
+		neighV4Manager:    &neigh.Manager{},
+		iptablesV4Manager: &iptables.Manager{},
+		ipv6Disabled:      true,
+	}
+
+	if c.getRouterManager(networkingv1.IPv6) != nil || c.getNeighManager(networkingv1.IPv6) != nil ||
+		c.getIPtablesManager(networkingv1.IPv6) != nil {
+		t.Errorf("expect no ipv6 managers if ipv6 is disabled")
+	}
+
+	if routeManagers := c.routeManagers(); len(routeManagers) != 1 || routeManagers[0] != c.routeV4Manager {
+		t.Errorf("expect only ipv4 route manager to sync routes, but got %v", routeManagers)
+	}
+
+	if neighManagers := c.neighManagers(); len(neighManagers) != 1 || neighManagers[0] != c.neighV4Manager {
+		t.Errorf("expect only ipv4 neigh manager to sync neighs, but got %v", neighManagers)
+	}
+
+	if iptablesManagers := c.iptablesManagers(); len(iptablesManagers) != 1 || iptablesManagers[0] != c.iptablesV4Manager {
+		t.Errorf("expect only ipv4 iptables manager to sync rules, but got %v", iptablesManagers)
+	}
+
+	c.routeV6Manager = &route.Manager{}
+	c.ipv6Disabled = false
+	if routeManagers := c.routeManagers(); len(routeManagers) != 2 || c.getRouterManager(networkingv1.IPv6) != c.routeV6Manager {
+		t.Errorf("expect both ipv4 and ipv6 route managers if ipv6 is enabled, but got %v", routeManagers)
+	}
+}
+
+func TestResolveOverlayForwardNodeIfName(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to add scheme: %v", err)
+	}
+
+	netID := int32(4)
+	overlayNetwork := &networkingv1.Network{
+		ObjectMeta: metav1.ObjectMeta{Name: "overlay"},
+		Spec: networkingv1.NetworkSpec{
+			NetID: &netID,
+			Type:  networkingv1.NetworkTypeOverlay,
+		},
+	}
+	overlayV4Subnet := &networkingv1.Subnet{
+		ObjectMeta: metav1.ObjectMeta{Name: "overlay-v4"},
+		Spec: networkingv1.SubnetSpec{
+			Network: "overlay",
+			Range:   networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: "10.0.0.0/16"},
+		},
+	}
+	underlayV6Subnet := &networkingv1.Subnet{
+		ObjectMeta: metav1.ObjectMeta{Name: "underlay-v6"},
+		Spec: networkingv1.SubnetSpec{
+			Network: "underlay",
+			Range:   networkingv1.AddressRange{Version: networkingv1.IPv6, CIDR: "fd00::/64"},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		objects      []runtime.Object
+		family       int
+		ipv6Disabled bool
+		expected     string
+		expectErr    bool
+	}{
+		{
+			name:     "ipv4 overlay configured",
+			objects:  []runtime.Object{overlayNetwork, overlayV4Subnet, underlayV6Subnet},
+			family:   netlink.FAMILY_V4,
+			expected: "eth0.vxlan4",
+		},
+		{
+			name:      "no ipv6 overlay subnet",
+			objects:   []runtime.Object{overlayNetwork, overlayV4Subnet, underlayV6Subnet},
+			family:    netlink.FAMILY_V6,
+			expectErr: true,
+		},
+		{
+			name:      "no overlay network",
+			objects:   []runtime.Object{overlayV4Subnet},
+			family:    netlink.FAMILY_V4,
+			expectErr: true,
+		},
+		{
+			name:         "ipv6 disabled",
+			objects:      []runtime.Object{overlayNetwork, overlayV4Subnet},
+			family:       netlink.FAMILY_V6,
+			ipv6Disabled: true,
+			expectErr:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(test.objects...).Build()
+
+			forwardNodeIfName, err := resolveOverlayForwardNodeIfName(context.TODO(), client, "eth0", "node1",
+				test.family, test.ipv6Disabled)
+			if test.expectErr {
+				if err == nil {
+					t.Errorf("expect error, but got interface %v", forwardNodeIfName)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if forwardNodeIfName != test.expected {
+				t.Errorf("expect interface %v, but got %v", test.expected, forwardNodeIfName)
+			}
+		})
+	}
+}
+
+func TestCollectGlobalNetworkInfoWithMultipleOverlayNetworks(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to add scheme: %v", err)
+	}
+
+	netID3, netID4, netID5 := int32(3), int32(4), int32(5)
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+		// selects other nodes only, it is skipped even if first in name order
+		&networkingv1.Network{
+			ObjectMeta: metav1.ObjectMeta{Name: "overlay-0"},
+			Spec: networkingv1.NetworkSpec{
+				NetID:        &netID3,
+				Type:         networkingv1.NetworkTypeOverlay,
+				NodeSelector: map[string]string{"zone": "other"},
+			},
+			Status: networkingv1.NetworkStatus{NodeList: []string{"node2"}},
+		},
+		&networkingv1.Network{
+			ObjectMeta: metav1.ObjectMeta{Name: "overlay-b"},
+			Spec: networkingv1.NetworkSpec{
+				NetID: &netID4,
+				Type:  networkingv1.NetworkTypeOverlay,
+			},
+		},
+		&networkingv1.Network{
+			ObjectMeta: metav1.ObjectMeta{Name: "overlay-a"},
+			Spec: networkingv1.NetworkSpec{
+				NetID: &netID5,
+				Type:  networkingv1.NetworkTypeOverlay,
+			},
+		},
+		&networkingv1.Subnet{
+			ObjectMeta: metav1.ObjectMeta{Name: "overlay-a-v4"},
+			Spec: networkingv1.SubnetSpec{
+				Network: "overlay-a",
+				Range:   networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: "10.0.0.0/16"},
+			},
+		},
+	).Build()
+
+	for i := 0; i < 10; i++ {
+		forwardNodeIfName, _, _, err := collectGlobalNetworkInfoAndInit(context.TODO(), client, "eth0", "node1",
+			nil, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if forwardNodeIfName != "eth0.vxlan5" {
+			t.Fatalf("expect interface eth0.vxlan5 of overlay-a, but got %v", forwardNodeIfName)
+		}
+
+		resolvedIfName, err := resolveOverlayForwardNodeIfName(context.TODO(), client, "eth0", "node1",
+			netlink.FAMILY_V4, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resolvedIfName != forwardNodeIfName {
+			t.Fatalf("expect resolved interface %v, but got %v", forwardNodeIfName, resolvedIfName)
+		}
+	}
+}
+
+func TestNodeBelongsToNetwork(t *testing.T) {
+	tests := []struct {
+		name     string
+		network  *networkingv1.Network
+		expected bool
+	}{
+		{
+			"overlay network without node selector",
+			&networkingv1.Network{
+				Spec: networkingv1.NetworkSpec{Type: networkingv1.NetworkTypeOverlay},
+			},
+			true,
+		},
+		{
+			"overlay network selecting node",
+			&networkingv1.Network{
+				Spec: networkingv1.NetworkSpec{
+					Type:         networkingv1.NetworkTypeOverlay,
+					NodeSelector: map[string]string{"overlay": "true"},
+				},
+				Status: networkingv1.NetworkStatus{NodeList: []string{"node1", "node2"}},
+			},
+			true,
+		},
+		{
+			"overlay network not selecting node",
+			&networkingv1.Network{
+				Spec: networkingv1.NetworkSpec{
+					Type:         networkingv1.NetworkTypeOverlay,
+					NodeSelector: map[string]string{"overlay": "true"},
+				},
+				Status: networkingv1.NetworkStatus{NodeList: []string{"node2"}},
+			},
+			false,
+		},
+		{
+			"underlay network not selecting node",
+			&networkingv1.Network{
+				Spec: networkingv1.NetworkSpec{
+					Type:         networkingv1.NetworkTypeUnderlay,
+					NodeSelector: map[string]string{"underlay": "true"},
+				},
+				Status: networkingv1.NetworkStatus{NodeList: []string{"node2"}},
+			},
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if belongs := nodeBelongsToNetwork("node1", test.network); belongs != test.expected {
+				t.Errorf("expect %v, but got %v", test.expected, belongs)
+			}
+		})
+	}
+}
+
+func TestParseSubnetRouteMTU(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		mtu         int
+		advMSS      int
+		expectError bool
+	}{
+		{
+			name:        "not specified",
+			annotations: nil,
+		},
+		{
+			name:        "mtu only",
+			annotations: map[string]string{constants.AnnotationRouteMTU: "1400"},
+			mtu:         1400,
+		},
+		{
+			name: "mtu and advmss",
+			annotations: map[string]string{
+				constants.AnnotationRouteMTU:    "1400",
+				constants.AnnotationRouteAdvMSS: "1360",
+			},
+			mtu:    1400,
+			advMSS: 1360,
+		},
+		{
+			name:        "invalid mtu",
+			annotations: map[string]string{constants.AnnotationRouteMTU: "abc"},
+			expectError: true,
+		},
+		{
+			name:        "mtu too small",
+			annotations: map[string]string{constants.AnnotationRouteMTU: "60"},
+			expectError: true,
+		},
+		{
+			name: "advmss not smaller than mtu",
+			annotations: map[string]string{
+				constants.AnnotationRouteMTU:    "1400",
+				constants.AnnotationRouteAdvMSS: "1400",
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		mtu, advMSS, err := parseSubnetRouteMTU(tc.annotations)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s: expect error but got nil", tc.name)
+			}
+			continue
+		}
+
+		if err != nil || mtu != tc.mtu || advMSS != tc.advMSS {
+			t.Errorf("%s: expect mtu %v and advmss %v, but got %v, %v, %v", tc.name, tc.mtu, tc.advMSS,
+				mtu, advMSS, err)
+		}
+	}
+}
+
+func TestNodeMembershipChanged(t *testing.T) {
+	newNetwork := func(nodeList ...string) *networkingv1.Network {
+		return &networkingv1.Network{
+			Spec: networkingv1.NetworkSpec{
+				Type:         networkingv1.NetworkTypeUnderlay,
+				NodeSelector: map[string]string{"underlay": "true"},
+			},
+			Status: networkingv1.NetworkStatus{NodeList: nodeList},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		oldNetwork *networkingv1.Network
+		newNetwork *networkingv1.Network
+		expected   bool
+	}{
+		{
+			"node is removed",
+			newNetwork("node1", "node2"),
+			newNetwork("node2"),
+			true,
+		},
+		{
+			"node is added",
+			newNetwork("node2"),
+			newNetwork("node2", "node1"),
+			true,
+		},
+		{
+			"other node is removed",
+			newNetwork("node1", "node2"),
+			newNetwork("node1"),
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		if result := nodeMembershipChanged("node1", test.oldNetwork, test.newNetwork); result != test.expected {
+			t.Errorf("%s: expect %v, but got %v", test.name, test.expected, result)
+		}
+	}
+}
+
+func TestSubnetRouteAnnotationsChanged(t *testing.T) {
+	newSubnet := func(annotations map[string]string) *networkingv1.Subnet {
+		return &networkingv1.Subnet{ObjectMeta: metav1.ObjectMeta{Name: "subnet1", Annotations: annotations}}
+	}
+
+	tests := []struct {
+		name      string
+		oldSubnet *networkingv1.Subnet
+		newSubnet *networkingv1.Subnet
+		expected  bool
+	}{
+		{
+			"egress gateway is added",
+			newSubnet(nil),
+			newSubnet(map[string]string{constants.AnnotationEgressGateway: "172.16.0.10"}),
+			true,
+		},
+		{
+			"dscp gateways are changed",
+			newSubnet(map[string]string{constants.AnnotationDSCPGateways: "46=192.168.1.254"}),
+			newSubnet(map[string]string{constants.AnnotationDSCPGateways: "46=192.168.1.253"}),
+			true,
+		},
+		{
+			"route mtu is removed",
+			newSubnet(map[string]string{constants.AnnotationRouteMTU: "1400"}),
+			newSubnet(nil),
+			true,
+		},
+		{
+			"route advmss is changed",
+			newSubnet(map[string]string{constants.AnnotationRouteAdvMSS: "1360"}),
+			newSubnet(map[string]string{constants.AnnotationRouteAdvMSS: "1300"}),
+			true,
+		},
+		{
+			"bgp gateways are set empty",
+			newSubnet(nil),
+			newSubnet(map[string]string{constants.AnnotationBGPGateways: ""}),
+			true,
+		},
+		{
+			"subnet starts draining",
+			newSubnet(nil),
+			newSubnet(map[string]string{constants.AnnotationSubnetDraining: "true"}),
+			true,
+		},
+		{
+			"unrelated annotation is changed",
+			newSubnet(map[string]string{"foo": "bar"}),
+			newSubnet(map[string]string{"foo": "baz"}),
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		if result := subnetRouteAnnotationsChanged(test.oldSubnet, test.newSubnet); result != test.expected {
+			t.Errorf("%s: expect %v, but got %v", test.name, test.expected, result)
+		}
+	}
+}
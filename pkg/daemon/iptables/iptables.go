@@ -57,6 +57,7 @@ const (
 	HybridnetNodeIPSetName           = "HYBR-NODE-IP"
 	HybridnetLocalPodIPSetName       = "HYBR-LOCAL-POD-IP"
 	HybridnetLocalUnderlayNetSetName = "HYBR-LOCAL-UNDERLAY-NET"
+	HybridnetEgressNetSetName        = "HYBR-EGRESS-NET"
 
 	PodToNodeBackTrafficMarkString = "0x20"
 	FullNATedPodTrafficMarkString  = "0x40"
@@ -67,6 +68,51 @@ const (
 	KubeProxyMasqueradeMarkString = "0x4000"
 )
 
+var (
+	// traffic marks which can be customized by SetTrafficMarks
+	kubeProxyMasqueradeMark = KubeProxyMasqueradeMark
+	fullNATedPodTrafficMark = FullNATedPodTrafficMark
+)
+
+// SetTrafficMarks customizes the masquerade mark used by kube-proxy and the mark of full NATed pod traffic,
+// it should be called before any manager syncs.
+func SetTrafficMarks(kubeProxyMasqueradeMarkValue, fullNATedPodTrafficMarkValue int) error {
+	if err := ValidateTrafficMarks(kubeProxyMasqueradeMarkValue, fullNATedPodTrafficMarkValue); err != nil {
+		return err
+	}
+
+	kubeProxyMasqueradeMark = kubeProxyMasqueradeMarkValue
+	fullNATedPodTrafficMark = fullNATedPodTrafficMarkValue
+	return nil
+}
+
+// ValidateTrafficMarks checks if the masquerade mark used by kube-proxy and the mark of full NATed pod traffic
+// are single bits which don't overlap with each other or the pod to node back traffic mark.
+func ValidateTrafficMarks(kubeProxyMasqueradeMarkValue, fullNATedPodTrafficMarkValue int) error {
+	marks := []struct {
+		name  string
+		value int
+	}{
+		{"kube-proxy masquerade mark", kubeProxyMasqueradeMarkValue},
+		{"full NATed pod traffic mark", fullNATedPodTrafficMarkValue},
+		{"pod to node back traffic mark", PodToNodeBackTrafficMark},
+	}
+
+	usedBits := 0
+	for _, mark := range marks {
+		if mark.value <= 0 || mark.value&(mark.value-1) != 0 {
+			return fmt.Errorf("%v %#x must be a single bit", mark.name, mark.value)
+		}
+
+		if usedBits&mark.value != 0 {
+			return fmt.Errorf("%v %#x overlaps with other marks", mark.name, mark.value)
+		}
+		usedBits |= mark.value
+	}
+
+	return nil
+}
+
 // Protocol defines the ip protocol either ipv4 or ipv6
 type Protocol byte
 
@@ -86,6 +132,9 @@ type Manager struct {
 
 	localUnderlaySubnets []*net.IPNet
 
+	// overlay subnets whose outside traffic is routed to an egress gateway node
+	egressSubnets []*net.IPNet
+
 	nodeIPList      []net.IP
 	localNodeIPList []net.IP
 	localPodIPList  []net.IP
@@ -147,6 +196,7 @@ func CreateIPtablesManager(protocol Protocol) (*Manager, error) {
 		localClusterOverlaySubnets:  []*net.IPNet{},
 		localClusterUnderlaySubnets: []*net.IPNet{},
 		localUnderlaySubnets:        []*net.IPNet{},
+		egressSubnets:               []*net.IPNet{},
 		nodeIPList:                  []net.IP{},
 		localNodeIPList:             []net.IP{},
 		vlanForwardIfNames:          []string{},
@@ -166,6 +216,7 @@ func (mgr *Manager) Reset() {
 	mgr.localClusterOverlaySubnets = []*net.IPNet{}
 	mgr.localClusterUnderlaySubnets = []*net.IPNet{}
 	mgr.localUnderlaySubnets = []*net.IPNet{}
+	mgr.egressSubnets = []*net.IPNet{}
 	mgr.nodeIPList = []net.IP{}
 	mgr.localNodeIPList = []net.IP{}
 	mgr.localPodIPList = []net.IP{}
@@ -200,6 +251,12 @@ func (mgr *Manager) RecordSubnet(subnetCidr *net.IPNet, isOverlay, isLocal bool)
 	}
 }
 
+// RecordEgressSubnet records an overlay subnet whose outside traffic is routed to an egress gateway node through
+// vxlan device, and is NATed by the egress gateway node.
+func (mgr *Manager) RecordEgressSubnet(subnetCidr *net.IPNet) {
+	mgr.egressSubnets = append(mgr.egressSubnets, subnetCidr)
+}
+
 func (mgr *Manager) RecordRemoteNodeIP(nodeIP net.IP) {
 	mgr.remoteNodeIPList = append(mgr.remoteNodeIPList, nodeIP)
 }
@@ -240,6 +297,7 @@ func (mgr *Manager) SyncRules() error {
 
 	localUnderlayIPNets := generateStringsFromIPNets(mgr.localUnderlaySubnets)
 	localPodIPs := generateStringsFromIPs(mgr.localPodIPList)
+	egressIPNets := generateStringsFromIPNets(mgr.egressSubnets)
 
 	// remote subnets & nodes
 	overlayIPNets = append(overlayIPNets, generateStringsFromIPNets(mgr.remoteClusterOverlaySubnets)...)
@@ -254,7 +312,7 @@ func (mgr *Manager) SyncRules() error {
 		return fmt.Errorf("failed to create ipset instance: %v", err)
 	}
 
-	var overlayNetSet, allIPSet, nodeIPSet, localUnderlayNetSet, localPodIPSet *ipset.Set
+	var overlayNetSet, allIPSet, nodeIPSet, localUnderlayNetSet, localPodIPSet, egressNetSet *ipset.Set
 
 	if overlayNetSet, err = createAndRefreshIPSet(ipsetInterface, HybridnetOverlayNetSetName, overlayIPNets,
 		ipset.TypeHashNet, ipset.OptionTimeout, "0"); err != nil {
@@ -281,6 +339,11 @@ func (mgr *Manager) SyncRules() error {
 		return fmt.Errorf("failed to create and refresh ip set %v: %v", HybridnetLocalPodIPSetName, err)
 	}
 
+	if egressNetSet, err = createAndRefreshIPSet(ipsetInterface, HybridnetEgressNetSetName, egressIPNets,
+		ipset.TypeHashNet, ipset.OptionTimeout, "0"); err != nil {
+		return fmt.Errorf("failed to create and refresh ip set %v: %v", HybridnetEgressNetSetName, err)
+	}
+
 	if err := mgr.ensureBasicRuleAndChains(); err != nil {
 		return fmt.Errorf("failed to ensure basic rules and chains: %v", err)
 	}
@@ -316,6 +379,8 @@ func (mgr *Manager) SyncRules() error {
 		writeLine(natRules, generateSkipMasqueradeRuleSpec()...)
 		writeLine(natRules, generateOldSkipMasqueradeRuleSpec()...)
 		writeLine(natRules, generateMasqueradeRuleSpec(mgr.overlayIfName, overlayNetSet.GetNameWithProtocol())...)
+		writeLine(natRules, generateEgressMasqueradeRuleSpec(mgr.overlayIfName, egressNetSet.GetNameWithProtocol())...)
+		writeLine(filterRules, generateEgressSkipFilterRuleSpec(mgr.overlayIfName, egressNetSet.GetNameWithProtocol())...)
 		writeLine(filterRules, generateVxlanFilterRuleSpec(mgr.overlayIfName, allIPSet.GetNameWithProtocol(), mgr.protocol)...)
 		writeLine(mangleRules, generateVxlanPodToNodeReplyMarkRuleSpec(overlayNetSet.GetNameWithProtocol(),
 			nodeIPSet.GetNameWithProtocol())...)
@@ -447,6 +512,12 @@ func generateMasqueradeRuleSpec(vxlanIf, overlayNetSet string) []string {
 		"!", "-o", vxlanIf, "-m", "set", "--match-set", overlayNetSet, "src", "-j", "MASQUERADE"}
 }
 
+// traffic forwarded from other nodes is NATed on the egress gateway node
+func generateEgressMasqueradeRuleSpec(vxlanIf, egressNetSet string) []string {
+	return []string{"-A", ChainHybridnetPostRouting, "-m", "comment", "--comment", `"hybridnet egress gateway masquerade rule"`,
+		"!", "-o", vxlanIf, "-m", "set", "--match-set", egressNetSet, "src", "-j", "MASQUERADE"}
+}
+
 func generateSkipMasqueradeRuleSpec() []string {
 	return []string{"-A", ChainHybridnetPostRouting, "-m", "comment", "--comment", `"skip masquerade if traffic is to local pod"`,
 		"-o", constants.ContainerHostLinkPrefix + "+", "-j", "RETURN"}
@@ -458,6 +529,13 @@ func generateOldSkipMasqueradeRuleSpec() []string {
 		"-o", "h_+", "-j", "RETURN"}
 }
 
+// outside traffic of egress subnets is routed to the egress gateway node through vxlan device, which should skip
+// the vxlan filter rule
+func generateEgressSkipFilterRuleSpec(vxlanIf, egressNetSet string) []string {
+	return []string{"-A", ChainHybridnetForward, "-m", "comment", "--comment", `"skip filter for overlay traffic to egress gateway node"`,
+		"-o", vxlanIf, "-m", "set", "--match-set", egressNetSet, "src", "-j", "RETURN"}
+}
+
 // ensure stateful firewall
 func generateVxlanFilterRuleSpec(vxlanIf, allIPSet string, protocol Protocol) []string {
 	return []string{"-A", ChainHybridnetForward, "-m", "comment", "--comment", `"hybridnet overlay vxlan if egress filter rule"`,
@@ -506,7 +584,7 @@ func generateVxlanPodToNodeReplyRemoveMarkRuleSpec(overlayNetSet, nodeIPSet stri
 func generateUnderlayEndLoopRuleSpec(underlayIf, localPodIPSet, localUnderlayNetSet string) []string {
 	return []string{"-A", ChainHybridnetForward, "-m", "comment", "--comment", `"drop endless underlay traffic because of route loop"`,
 		"-i", underlayIf,
-		"-m", "mark", "!", "--mark", fmt.Sprintf("%s/%s", KubeProxyMasqueradeMarkString, KubeProxyMasqueradeMarkString),
+		"-m", "mark", "!", "--mark", fmt.Sprintf("%#x/%#x", kubeProxyMasqueradeMark, kubeProxyMasqueradeMark),
 		"-m", "set", "!", "--match-set", localPodIPSet, "dst",
 		"-m", "set", "--match-set", localUnderlayNetSet, "dst",
 		"-j", "DROP",
@@ -522,8 +600,8 @@ func generateFullNATMarkSNATRuleSpec() []string {
 
 func generateFullNATMarkDNATRuleSpec(cidr *net.IPNet) []string {
 	return []string{"-A", ChainHybridnetFromRuleSkip, "-m", "conntrack", "--ctstate", "DNAT",
-		"--ctreplsrc", cidr.String(), "-j", "MARK", "--set-xmark", fmt.Sprintf("%s/%s",
-			FullNATedPodTrafficMarkString, FullNATedPodTrafficMarkString),
+		"--ctreplsrc", cidr.String(), "-j", "MARK", "--set-xmark", fmt.Sprintf("%#x/%#x",
+			fullNATedPodTrafficMark, fullNATedPodTrafficMark),
 	}
 }
 
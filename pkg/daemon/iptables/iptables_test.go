@@ -0,0 +1,76 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package iptables
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestValidateTrafficMarks(t *testing.T) {
+	tests := []struct {
+		name        string
+		kubeProxy   int
+		fullNAT     int
+		expectError bool
+	}{
+		{"default marks", KubeProxyMasqueradeMark, FullNATedPodTrafficMark, false},
+		{"custom marks", 0x8000, 0x80, false},
+		{"zero mark", 0, FullNATedPodTrafficMark, true},
+		{"negative mark", KubeProxyMasqueradeMark, -0x40, true},
+		{"multiple bits", 0xc000, FullNATedPodTrafficMark, true},
+		{"overlapped marks", 0x40, 0x40, true},
+		{"overlapped with pod to node back traffic mark", KubeProxyMasqueradeMark, PodToNodeBackTrafficMark, true},
+	}
+
+	for _, test := range tests {
+		err := ValidateTrafficMarks(test.kubeProxy, test.fullNAT)
+		if (err != nil) != test.expectError {
+			t.Errorf("test %v failed, expect error %v but got %v", test.name, test.expectError, err)
+		}
+	}
+}
+
+func TestSetTrafficMarks(t *testing.T) {
+	defer func() {
+		kubeProxyMasqueradeMark = KubeProxyMasqueradeMark
+		fullNATedPodTrafficMark = FullNATedPodTrafficMark
+	}()
+
+	if err := SetTrafficMarks(0x4000, 0x4000); err == nil {
+		t.Fatalf("expect error for overlapped marks")
+	}
+	if kubeProxyMasqueradeMark != KubeProxyMasqueradeMark || fullNATedPodTrafficMark != FullNATedPodTrafficMark {
+		t.Fatalf("marks should not be changed by invalid values")
+	}
+
+	if err := SetTrafficMarks(0x8000, 0x80); err != nil {
+		t.Fatalf("failed to set traffic marks: %v", err)
+	}
+
+	endLoopRuleSpec := strings.Join(generateUnderlayEndLoopRuleSpec("eth0", "local-pod-ip", "local-underlay-net"), " ")
+	if !strings.Contains(endLoopRuleSpec, "0x8000/0x8000") {
+		t.Errorf("unexpected underlay end loop rule spec %v", endLoopRuleSpec)
+	}
+
+	_, cidr, _ := net.ParseCIDR("192.168.0.0/24")
+	dnatRuleSpec := strings.Join(generateFullNATMarkDNATRuleSpec(cidr), " ")
+	if !strings.Contains(dnatRuleSpec, "0x80/0x80") {
+		t.Errorf("unexpected full nat mark dnat rule spec %v", dnatRuleSpec)
+	}
+}
@@ -62,11 +62,6 @@ func (m *Manager) SyncNeighs() error {
 			return fmt.Errorf("failed to get forward node if %v: %v", forwardNodeIfName, err)
 		}
 
-		neighList, err := netlink.NeighProxyList(forwardNodeIf.Attrs().Index, m.family)
-		if err != nil {
-			return fmt.Errorf("failed to list neighs for forward node if %v: %v", forwardNodeIfName, err)
-		}
-
 		if m.family == netlink.FAMILY_V6 {
 			// For ipv6, proxy_ndp need to be set.
 			sysctlPath := fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/proxy_ndp", forwardNodeIfName)
@@ -75,28 +70,13 @@ func (m *Manager) SyncNeighs() error {
 			}
 		}
 
-		existNeighMap := map[string]bool{}
-		for _, neigh := range neighList {
-			if _, exist := ipMap[neigh.IP.String()]; !exist {
-				if err := netlink.NeighDel(&neigh); err != nil {
-					return fmt.Errorf("failed to delete neigh for %v/%v: %v", neigh.IP.String(), forwardNodeIfName, err)
-				}
-			} else {
-				existNeighMap[neigh.IP.String()] = true
-			}
+		desired := make([]net.IP, 0, len(ipMap))
+		for _, ip := range ipMap {
+			desired = append(desired, ip)
 		}
 
-		for _, ip := range ipMap {
-			if _, exist := existNeighMap[ip.String()]; !exist {
-				if err := netlink.NeighAdd(&netlink.Neigh{
-					LinkIndex: forwardNodeIf.Attrs().Index,
-					Family:    m.family,
-					Flags:     netlink.NTF_PROXY,
-					IP:        ip,
-				}); err != nil {
-					return fmt.Errorf("failed to add neigh for ip %v/%v: %v", ip.String(), forwardNodeIfName, err)
-				}
-			}
+		if err := ReconcileProxyNeighs(forwardNodeIf.Attrs().Index, m.family, desired); err != nil {
+			return fmt.Errorf("failed to reconcile proxy neighs for forward node if %v: %v", forwardNodeIfName, err)
 		}
 	}
 
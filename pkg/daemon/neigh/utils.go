@@ -62,3 +62,60 @@ func ClearStaleAddFailedNeighEntries(linkIndex int, family int) error {
 
 	return nil
 }
+
+// ReconcileProxyNeighs makes sure exactly the desired proxy neigh entries exist on forward interface in one pass,
+// missing entries will be added and stale entries will be deleted.
+func ReconcileProxyNeighs(forwardIfIndex, family int, desired []net.IP) error {
+	neighList, err := netlink.NeighProxyList(forwardIfIndex, family)
+	if err != nil {
+		return fmt.Errorf("failed to list proxy neighs for link index %v: %v", forwardIfIndex, err)
+	}
+
+	toAdd, toDelete := planProxyNeighs(neighList, desired)
+
+	for _, neigh := range toDelete {
+		if err := netlink.NeighDel(&neigh); err != nil {
+			return fmt.Errorf("failed to delete proxy neigh %v for link index %v: %v", neigh.IP, forwardIfIndex, err)
+		}
+	}
+
+	for _, ip := range toAdd {
+		if err := netlink.NeighAdd(&netlink.Neigh{
+			LinkIndex: forwardIfIndex,
+			Family:    family,
+			Flags:     netlink.NTF_PROXY,
+			IP:        ip,
+		}); err != nil {
+			return fmt.Errorf("failed to add proxy neigh %v for link index %v: %v", ip, forwardIfIndex, err)
+		}
+	}
+
+	return nil
+}
+
+// planProxyNeighs returns the desired ips without proxy neigh entries and the exist entries which are not desired.
+func planProxyNeighs(existNeighs []netlink.Neigh, desired []net.IP) (toAdd []net.IP, toDelete []netlink.Neigh) {
+	desiredMap := map[string]bool{}
+	for _, ip := range desired {
+		desiredMap[ip.String()] = true
+	}
+
+	existMap := map[string]bool{}
+	for _, neigh := range existNeighs {
+		if desiredMap[neigh.IP.String()] {
+			existMap[neigh.IP.String()] = true
+		} else {
+			toDelete = append(toDelete, neigh)
+		}
+	}
+
+	for _, ip := range desired {
+		if !existMap[ip.String()] {
+			toAdd = append(toAdd, ip)
+			// avoid adding duplicated desired ips twice
+			existMap[ip.String()] = true
+		}
+	}
+
+	return toAdd, toDelete
+}
@@ -0,0 +1,103 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package neigh
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestPlanProxyNeighs(t *testing.T) {
+	neighsOf := func(ips ...string) []netlink.Neigh {
+		var neighs []netlink.Neigh
+		for _, ip := range ips {
+			neighs = append(neighs, netlink.Neigh{IP: net.ParseIP(ip), Flags: netlink.NTF_PROXY})
+		}
+		return neighs
+	}
+
+	ipsOf := func(ips ...string) []net.IP {
+		var result []net.IP
+		for _, ip := range ips {
+			result = append(result, net.ParseIP(ip))
+		}
+		return result
+	}
+
+	tests := []struct {
+		name             string
+		exist            []netlink.Neigh
+		desired          []net.IP
+		expectedToAdd    []string
+		expectedToDelete []string
+	}{
+		{
+			name:          "add missing",
+			exist:         neighsOf("10.0.0.1"),
+			desired:       ipsOf("10.0.0.1", "10.0.0.2", "10.0.0.3"),
+			expectedToAdd: []string{"10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name:             "remove stale",
+			exist:            neighsOf("10.0.0.1", "10.0.0.2"),
+			desired:          ipsOf("10.0.0.1"),
+			expectedToDelete: []string{"10.0.0.2"},
+		},
+		{
+			name:             "add and remove",
+			exist:            neighsOf("fd00::1", "fd00::2"),
+			desired:          ipsOf("fd00::2", "fd00::3"),
+			expectedToAdd:    []string{"fd00::3"},
+			expectedToDelete: []string{"fd00::1"},
+		},
+		{
+			name:    "no-op",
+			exist:   neighsOf("10.0.0.1", "10.0.0.2"),
+			desired: ipsOf("10.0.0.2", "10.0.0.1", "10.0.0.1"),
+		},
+		{
+			name:             "empty desired set",
+			exist:            neighsOf("10.0.0.1"),
+			expectedToDelete: []string{"10.0.0.1"},
+		},
+	}
+
+	for _, test := range tests {
+		toAdd, toDelete := planProxyNeighs(test.exist, test.desired)
+
+		var added, deleted []string
+		for _, ip := range toAdd {
+			added = append(added, ip.String())
+		}
+		for _, neigh := range toDelete {
+			deleted = append(deleted, neigh.IP.String())
+		}
+		sort.Strings(added)
+		sort.Strings(deleted)
+
+		if fmt.Sprint(added) != fmt.Sprint(test.expectedToAdd) {
+			t.Errorf("test %v failed, expect to add %v but got %v", test.name, test.expectedToAdd, added)
+		}
+		if fmt.Sprint(deleted) != fmt.Sprint(test.expectedToDelete) {
+			t.Errorf("test %v failed, expect to delete %v but got %v", test.name, test.expectedToDelete, deleted)
+		}
+	}
+}
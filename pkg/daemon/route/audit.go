@@ -0,0 +1,196 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/alibaba/hybridnet/pkg/metrics"
+)
+
+// DualStackInconsistency is a dual-stack network whose from-pod-subnet rules are programmed for only one family.
+type DualStackInconsistency struct {
+	Network        string
+	MissingFamily  int
+	MissingSubnets []string
+}
+
+// ProgrammedLocalSubnets returns the local subnets which need from-pod-subnet rules on this node, and whether
+// their rules exist. It is read-only.
+func (m *Manager) ProgrammedLocalSubnets() (map[string]bool, error) {
+	ruleList, err := netlink.RuleList(m.family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %v", err)
+	}
+
+	return m.programmedLocalSubnets(ruleList), nil
+}
+
+func (m *Manager) programmedLocalSubnets(ruleList []netlink.Rule) map[string]bool {
+	programmed := map[string]bool{}
+	for cidrString := range m.localClusterOverlaySubnetInfoMap {
+		programmed[cidrString] = false
+	}
+	for cidrString, info := range m.localClusterUnderlaySubnetInfoMap {
+		if info.isUnderlayOnHost {
+			programmed[cidrString] = false
+		}
+	}
+
+	for _, rule := range ruleList {
+		if !checkIsFromPodSubnetRule(rule, m.tableRange) || rule.Tos != 0 {
+			continue
+		}
+
+		cidrString := CanonicalCIDRKey(rule.Src)
+		if _, exist := programmed[cidrString]; exist {
+			programmed[cidrString] = true
+		}
+	}
+
+	return programmed
+}
+
+// AuditDualStackConsistency finds the networks which have subnets of both families on this node, but only the
+// subnets of one family are all programmed. Subnets are grouped to networks by subnetNetworkMap.
+func AuditDualStackConsistency(v4Programmed, v6Programmed map[string]bool,
+	subnetNetworkMap map[string]string) []DualStackInconsistency {
+	type familyState struct {
+		total   int
+		missing []string
+	}
+
+	collect := func(programmed map[string]bool) map[string]*familyState {
+		networkStateMap := map[string]*familyState{}
+		for cidrString, isProgrammed := range programmed {
+			network, exist := subnetNetworkMap[cidrString]
+			if !exist {
+				continue
+			}
+
+			if networkStateMap[network] == nil {
+				networkStateMap[network] = &familyState{}
+			}
+
+			networkStateMap[network].total++
+			if !isProgrammed {
+				networkStateMap[network].missing = append(networkStateMap[network].missing, cidrString)
+			}
+		}
+		return networkStateMap
+	}
+
+	v4StateMap := collect(v4Programmed)
+	v6StateMap := collect(v6Programmed)
+
+	var inconsistencies []DualStackInconsistency
+	for network, v4State := range v4StateMap {
+		v6State, exist := v6StateMap[network]
+		if !exist {
+			continue
+		}
+
+		switch {
+		case len(v4State.missing) == 0 && len(v6State.missing) != 0:
+			sort.Strings(v6State.missing)
+			inconsistencies = append(inconsistencies, DualStackInconsistency{
+				Network:        network,
+				MissingFamily:  netlink.FAMILY_V6,
+				MissingSubnets: v6State.missing,
+			})
+		case len(v4State.missing) != 0 && len(v6State.missing) == 0:
+			sort.Strings(v4State.missing)
+			inconsistencies = append(inconsistencies, DualStackInconsistency{
+				Network:        network,
+				MissingFamily:  netlink.FAMILY_V4,
+				MissingSubnets: v4State.missing,
+			})
+		}
+	}
+
+	sort.Slice(inconsistencies, func(i, j int) bool {
+		return inconsistencies[i].Network < inconsistencies[j].Network
+	})
+
+	return inconsistencies
+}
+
+// DetectInvalidPriorityRules finds the managed rules whose priorities are out of the band hybridnet allocates
+// rule priorities from, i.e., (priority of node local rule or the fallback base, MaxRulePriority]. Such rules are created by other
+// tools or corrupted, and need to be corrected. It is read-only except for updating the metric.
+func (m *Manager) DetectInvalidPriorityRules() ([]netlink.Rule, error) {
+	ruleList, err := netlink.RuleList(m.family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %v", err)
+	}
+
+	invalidRules := detectInvalidPriorityRules(ruleList, m.tableRange, m.rulePriorityFallbackBase,
+		m.fixedTableNums()...)
+	metrics.InvalidPriorityRuleGauge.WithLabelValues(ipFamilyLabel(m.family)).Set(float64(len(invalidRules)))
+	return invalidRules, nil
+}
+
+// detectInvalidPriorityRules uses the same lower bound as pickHighestUnusedRulePriority.
+func detectInvalidPriorityRules(ruleList []netlink.Rule, tableRange TableRange, fallbackBase int,
+	fixedTables ...int) []netlink.Rule {
+	lowerBound := fallbackBase
+	for _, rule := range ruleList {
+		if rule.Table == NodeLocalTableNum {
+			lowerBound = realRulePriority(rule.Priority)
+			break
+		}
+	}
+
+	var invalidRules []netlink.Rule
+	for _, rule := range ruleList {
+		if !checkIsManagedRule(rule, tableRange, fixedTables) {
+			continue
+		}
+
+		priority := realRulePriority(rule.Priority)
+		if priority <= lowerBound || priority > MaxRulePriority {
+			invalidRules = append(invalidRules, rule)
+		}
+	}
+
+	sort.Slice(invalidRules, func(i, j int) bool {
+		return invalidRules[i].Priority < invalidRules[j].Priority
+	})
+
+	return invalidRules
+}
+
+// checkIsManagedRule checks if rule is a from-pod-subnet rule or a basic rule pointing to a managed table.
+func checkIsManagedRule(rule netlink.Rule, tableRange TableRange, fixedTables []int) bool {
+	if checkIsFromPodSubnetRule(rule, tableRange) {
+		return true
+	}
+
+	if rule.Src != nil {
+		return false
+	}
+
+	for _, table := range fixedTables {
+		if rule.Table == table {
+			return true
+		}
+	}
+	return tableRange.Contains(rule.Table)
+}
@@ -0,0 +1,164 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestProgrammedLocalSubnets(t *testing.T) {
+	_, overlayCidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, underlayCidr, _ := net.ParseCIDR("192.168.1.0/24")
+	_, remoteUnderlayCidr, _ := net.ParseCIDR("192.168.2.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.AddSubnetInfo(overlayCidr, nil, nil, nil, nil, "eth0.vxlan4", true, true, false,
+		networkingv1.NetworkModeVxlan)
+	m.AddSubnetInfo(underlayCidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0", false, false, true,
+		networkingv1.NetworkModeVlan)
+	m.AddSubnetInfo(remoteUnderlayCidr, net.ParseIP("192.168.2.1"), nil, nil, nil, "", false, false, false,
+		networkingv1.NetworkModeVlan)
+
+	rule := netlink.NewRule()
+	rule.Src = overlayCidr
+	rule.Table = MinRouteTableNum
+	rule.Mark = fromRuleMark
+	rule.Mask = DefaultFromRuleMask
+
+	programmed := m.programmedLocalSubnets([]netlink.Rule{*rule})
+	expected := map[string]bool{
+		CanonicalCIDRKey(overlayCidr):  true,
+		CanonicalCIDRKey(underlayCidr): false,
+	}
+
+	if fmt.Sprint(programmed) != fmt.Sprint(expected) {
+		t.Errorf("expect %v, but got %v", expected, programmed)
+	}
+}
+
+func TestAuditDualStackConsistency(t *testing.T) {
+	subnetNetworkMap := map[string]string{
+		"10.0.0.0/24":    "net1",
+		"fd00::/64":      "net1",
+		"10.0.1.0/24":    "net2",
+		"10.0.2.0/24":    "net2",
+		"fd01::/64":      "net2",
+		"10.0.3.0/24":    "net3",
+		"fd03::/64":      "net3",
+		"192.168.0.0/24": "net4",
+	}
+
+	tests := []struct {
+		name         string
+		v4Programmed map[string]bool
+		v6Programmed map[string]bool
+		expected     []DualStackInconsistency
+	}{
+		{
+			name:         "consistent",
+			v4Programmed: map[string]bool{"10.0.0.0/24": true, "10.0.3.0/24": false, "192.168.0.0/24": false},
+			v6Programmed: map[string]bool{"fd00::/64": true, "fd03::/64": false},
+			expected:     nil,
+		},
+		{
+			name:         "ipv6 missing",
+			v4Programmed: map[string]bool{"10.0.0.0/24": true},
+			v6Programmed: map[string]bool{"fd00::/64": false},
+			expected: []DualStackInconsistency{
+				{Network: "net1", MissingFamily: netlink.FAMILY_V6, MissingSubnets: []string{"fd00::/64"}},
+			},
+		},
+		{
+			name:         "ipv4 partially missing",
+			v4Programmed: map[string]bool{"10.0.1.0/24": true, "10.0.2.0/24": false, "10.0.0.0/24": true},
+			v6Programmed: map[string]bool{"fd01::/64": true, "fd00::/64": true},
+			expected: []DualStackInconsistency{
+				{Network: "net2", MissingFamily: netlink.FAMILY_V4, MissingSubnets: []string{"10.0.2.0/24"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := AuditDualStackConsistency(test.v4Programmed, test.v6Programmed, subnetNetworkMap)
+			if fmt.Sprint(result) != fmt.Sprint(test.expected) {
+				t.Errorf("expect %v, but got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestDetectInvalidPriorityRules(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/24")
+
+	newFromPodSubnetRule := func(table, priority int) netlink.Rule {
+		rule := netlink.NewRule()
+		rule.Src = cidr
+		rule.Table = table
+		rule.Mark = fromRuleMark
+		rule.Mask = DefaultFromRuleMask
+		rule.Priority = priority
+		return *rule
+	}
+
+	ruleList := []netlink.Rule{
+		{Table: NodeLocalTableNum, Priority: 0},
+		{Table: 39999, Priority: 1},
+		{Table: 40000, Priority: 40000},
+		newFromPodSubnetRule(MinRouteTableNum, 2),
+		newFromPodSubnetRule(MinRouteTableNum+1, 40000),
+		// rules not managed are never reported
+		{Table: 254, Priority: 32766},
+		{Table: 100, Priority: 40000},
+	}
+
+	invalidRules := detectInvalidPriorityRules(ruleList, DefaultTableRange, DefaultRulePriorityFallbackBase,
+		39999, 40000, 40001)
+	if len(invalidRules) != 2 {
+		t.Fatalf("expect 2 invalid rules, but got %v", invalidRules)
+	}
+	for _, rule := range invalidRules {
+		if rule.Priority != 40000 {
+			t.Errorf("unexpected invalid rule %v", rule)
+		}
+	}
+
+	// managed rule in front of node local rule is out of band
+	invalidRules = detectInvalidPriorityRules([]netlink.Rule{
+		{Table: 39999, Priority: 10},
+		{Table: NodeLocalTableNum, Priority: 100},
+		{Table: 40000, Priority: 101},
+	}, DefaultTableRange, DefaultRulePriorityFallbackBase, 39999, 40000, 40001)
+	if len(invalidRules) != 1 || invalidRules[0].Table != 39999 {
+		t.Errorf("expect rule of table 39999 to be invalid, but got %v", invalidRules)
+	}
+
+	// without node local rule, managed rules should be behind the fallback base
+	invalidRules = detectInvalidPriorityRules([]netlink.Rule{
+		{Table: 39999, Priority: 50},
+		{Table: 40000, Priority: 101},
+	}, DefaultTableRange, 100, 39999, 40000, 40001)
+	if len(invalidRules) != 1 || invalidRules[0].Table != 39999 {
+		t.Errorf("expect rule of table 39999 in front of fallback base to be invalid, but got %v", invalidRules)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+)
+
+// ParseBGPGateways parses a comma separated gateway list string like "192.168.1.253,192.168.1.254".
+func ParseBGPGateways(gatewaysString string) ([]net.IP, error) {
+	var gateways []net.IP
+	if strings.TrimSpace(gatewaysString) == "" {
+		return gateways, nil
+	}
+
+	for _, item := range strings.Split(gatewaysString, ",") {
+		gateway := net.ParseIP(strings.TrimSpace(item))
+		if gateway == nil {
+			return nil, fmt.Errorf("invalid gateway ip %q", item)
+		}
+		gateways = append(gateways, gateway)
+	}
+
+	return dedupeGateways(gateways), nil
+}
+
+// dedupeGateways removes nil and duplicated gateways, the order of first occurrences is kept.
+func dedupeGateways(gateways []net.IP) []net.IP {
+	var result []net.IP
+	seen := map[string]bool{}
+	for _, gateway := range gateways {
+		if gateway == nil || seen[gateway.String()] {
+			continue
+		}
+		seen[gateway.String()] = true
+		result = append(result, gateway)
+	}
+	return result
+}
+
+// sortedGatewayKeys returns the deduped gateways as sorted strings.
+func sortedGatewayKeys(gateways []net.IP) []string {
+	var keys []string
+	for _, gateway := range dedupeGateways(gateways) {
+		keys = append(keys, gateway.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// buildBGPDefaultRoute builds the default route of a bgp subnet table through gateways, an ecmp route with
+// equal weights is built if there are more than one gateway, or else a single-path route.
+func buildBGPDefaultRoute(linkIndex, table int, gateways []net.IP) *netlink.Route {
+	gateways = dedupeGateways(gateways)
+
+	// don't use onlink flag in case the gateway is not a reachable next hop
+	if len(gateways) == 1 {
+		return &netlink.Route{
+			LinkIndex: linkIndex,
+			Table:     table,
+			Scope:     netlink.SCOPE_UNIVERSE,
+			Gw:        gateways[0],
+		}
+	}
+
+	route := &netlink.Route{
+		Table: table,
+		Scope: netlink.SCOPE_UNIVERSE,
+	}
+	for _, gateway := range gateways {
+		// zero hops means weight 1, all the next hops share traffic equally
+		route.MultiPath = append(route.MultiPath, &netlink.NexthopInfo{
+			LinkIndex: linkIndex,
+			Gw:        gateway,
+		})
+	}
+	return route
+}
+
+// routeNexthopKeys returns the sorted next hops of a route, a single-path route has only one next hop.
+func routeNexthopKeys(route *netlink.Route) []string {
+	if len(route.MultiPath) == 0 {
+		return []string{fmt.Sprintf("%v/%v", route.LinkIndex, route.Gw)}
+	}
+
+	var keys []string
+	for _, nexthop := range route.MultiPath {
+		keys = append(keys, fmt.Sprintf("%v/%v", nexthop.LinkIndex, nexthop.Gw))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isSameNexthops returns true if two routes have the same set of next hops, no matter whether they are
+// single-path or ecmp routes.
+func isSameNexthops(a, b *netlink.Route) bool {
+	aKeys, bKeys := routeNexthopKeys(a), routeNexthopKeys(b)
+	if len(aKeys) != len(bKeys) {
+		return false
+	}
+
+	for i := range aKeys {
+		if aKeys[i] != bKeys[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestParseBGPGateways(t *testing.T) {
+	testCases := []struct {
+		gateways  string
+		expect    []string
+		expectErr bool
+	}{
+		{"", nil, false},
+		{"192.168.1.254", []string{"192.168.1.254"}, false},
+		{"192.168.1.254, 192.168.1.253,192.168.1.254", []string{"192.168.1.254", "192.168.1.253"}, false},
+		{"192.168.1.254,invalid", nil, true},
+	}
+
+	for _, test := range testCases {
+		gateways, err := ParseBGPGateways(test.gateways)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("expect error for %q but got %v", test.gateways, gateways)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", test.gateways, err)
+			continue
+		}
+
+		if len(gateways) != len(test.expect) {
+			t.Errorf("expect %v for %q but got %v", test.expect, test.gateways, gateways)
+			continue
+		}
+		for i := range gateways {
+			if gateways[i].String() != test.expect[i] {
+				t.Errorf("expect %v for %q but got %v", test.expect, test.gateways, gateways)
+			}
+		}
+	}
+}
+
+func TestBuildBGPDefaultRoute(t *testing.T) {
+	gw1, gw2 := net.ParseIP("192.168.1.253"), net.ParseIP("192.168.1.254")
+
+	testCases := []struct {
+		name          string
+		gateways      []net.IP
+		expectGw      net.IP
+		expectNexthop []string
+	}{
+		{"single gateway", []net.IP{gw1}, gw1, nil},
+		{"duplicated gateways fall back to single path", []net.IP{gw1, net.ParseIP("192.168.1.253")}, gw1, nil},
+		{"multiple gateways", []net.IP{gw2, gw1, gw2}, nil, []string{"192.168.1.254", "192.168.1.253"}},
+	}
+
+	for _, test := range testCases {
+		route := buildBGPDefaultRoute(3, 10000, test.gateways)
+		if route.Table != 10000 || route.Scope != netlink.SCOPE_UNIVERSE {
+			t.Errorf("%s: unexpected table or scope of route %v", test.name, route)
+		}
+
+		if test.expectGw != nil {
+			if !route.Gw.Equal(test.expectGw) || route.LinkIndex != 3 || len(route.MultiPath) != 0 {
+				t.Errorf("%s: expect single-path route via %v but got %v", test.name, test.expectGw, route)
+			}
+			continue
+		}
+
+		if route.Gw != nil || route.LinkIndex != 0 || len(route.MultiPath) != len(test.expectNexthop) {
+			t.Errorf("%s: expect ecmp route via %v but got %v", test.name, test.expectNexthop, route)
+			continue
+		}
+		for i, nexthop := range route.MultiPath {
+			if nexthop.Gw.String() != test.expectNexthop[i] || nexthop.LinkIndex != 3 || nexthop.Hops != 0 {
+				t.Errorf("%s: unexpected next hop %v", test.name, nexthop)
+			}
+		}
+	}
+}
+
+func TestIsSameNexthops(t *testing.T) {
+	gw1, gw2 := net.ParseIP("192.168.1.253"), net.ParseIP("192.168.1.254")
+	single := buildBGPDefaultRoute(3, 10000, []net.IP{gw1})
+	ecmp := buildBGPDefaultRoute(3, 10000, []net.IP{gw1, gw2})
+
+	testCases := []struct {
+		name   string
+		a, b   *netlink.Route
+		expect bool
+	}{
+		{"same single-path", single, buildBGPDefaultRoute(3, 10000, []net.IP{gw1}), true},
+		{"different gateway", single, buildBGPDefaultRoute(3, 10000, []net.IP{gw2}), false},
+		{"different link", single, buildBGPDefaultRoute(4, 10000, []net.IP{gw1}), false},
+		{"same ecmp in different order", ecmp, buildBGPDefaultRoute(3, 10000, []net.IP{gw2, gw1}), true},
+		{"ecmp shrinks to single-path", ecmp, single, false},
+	}
+
+	for _, test := range testCases {
+		if result := isSameNexthops(test.a, test.b); result != test.expect {
+			t.Errorf("%s: expect %v but got %v", test.name, test.expect, result)
+		}
+	}
+}
+
+func TestSetSubnetBGPGateways(t *testing.T) {
+	manager := newTestManager(netlink.FAMILY_V4)
+	_, bgpCidr, _ := net.ParseCIDR("192.168.1.0/24")
+	_, vlanCidr, _ := net.ParseCIDR("192.168.2.0/24")
+
+	manager.AddSubnetInfo(bgpCidr, nil, nil, nil, nil, "eth0", false, false, true, networkingv1.NetworkModeBGP)
+	manager.AddSubnetInfo(vlanCidr, nil, nil, nil, nil, "eth0", false, false, true, networkingv1.NetworkModeVlan)
+
+	gateways := []net.IP{net.ParseIP("192.168.1.254"), net.ParseIP("fe80::1"), net.ParseIP("192.168.1.254"),
+		net.ParseIP("192.168.1.253")}
+	manager.SetSubnetBGPGateways(bgpCidr, gateways)
+	manager.SetSubnetBGPGateways(vlanCidr, gateways)
+
+	if result := manager.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(bgpCidr)].bgpGateways; len(result) != 2 ||
+		!result[0].Equal(gateways[0]) || !result[1].Equal(gateways[3]) {
+		t.Errorf("unexpected bgp gateways %v", result)
+	}
+
+	if result := manager.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(vlanCidr)].bgpGateways; len(result) != 0 {
+		t.Errorf("expect no bgp gateways for vlan subnet but got %v", result)
+	}
+}
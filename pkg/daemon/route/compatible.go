@@ -24,9 +24,9 @@ import (
 	"github.com/vishvananda/netlink"
 )
 
-func checkIsOldFromPodSubnetRule(rule netlink.Rule, family int) (bool, error) {
+func checkIsOldFromPodSubnetRule(rule netlink.Rule, family int, tableRange TableRange) (bool, error) {
 	if rule.IifName != "" || rule.OifName != "" || rule.Dst != nil || rule.Src == nil ||
-		rule.Table < MinRouteTableNum || rule.Table >= MaxRouteTableNum {
+		!tableRange.Contains(rule.Table) {
 		return false, nil
 	}
 
@@ -64,14 +64,8 @@ func checkIsOldFromPodSubnetRule(rule netlink.Rule, family int) (bool, error) {
 	return false, nil
 }
 
-func updateOldFromPodSubnetRuleToNew(rule netlink.Rule) error {
-	newRule := netlink.NewRule()
-
-	newRule.Src = rule.Src
-	newRule.Priority = rule.Priority
-	newRule.Table = rule.Table
-	newRule.Mark = fromRuleMark
-	newRule.Mask = fromRuleMask
+func (m *Manager) updateOldFromPodSubnetRuleToNew(rule netlink.Rule) error {
+	newRule := m.newFromPodSubnetRule(rule.Src, rule.Table, rule.Priority, rule.Tos)
 
 	if err := netlink.RuleAdd(newRule); err != nil {
 		return fmt.Errorf("failed to add new rule %v: %v", newRule.String(), err)
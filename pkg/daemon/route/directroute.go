@@ -0,0 +1,72 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"time"
+)
+
+// SetDirectRouteInstallGracePeriod sets how long to wait for the missing direct route of a local vlan subnet
+// before installing it on the forward interface, zero means never installing it and failing the sync until it
+// appears.
+func (m *Manager) SetDirectRouteInstallGracePeriod(gracePeriod time.Duration) {
+	m.directRouteInstallGracePeriod = gracePeriod
+}
+
+// NextDirectRouteInstallDeadline returns the earliest time to install a missing direct route.
+func (m *Manager) NextDirectRouteInstallDeadline(now time.Time) (time.Time, bool) {
+	if m.directRouteInstallGracePeriod <= 0 {
+		return time.Time{}, false
+	}
+
+	var next time.Time
+	for _, since := range m.missingDirectRouteMap {
+		deadline := since.Add(m.directRouteInstallGracePeriod)
+		if now.Before(deadline) && (next.IsZero() || deadline.Before(next)) {
+			next = deadline
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// shouldInstallDirectRoute returns true if the direct route of subnet has been missing for the grace period.
+func (m *Manager) shouldInstallDirectRoute(cidr *net.IPNet, now time.Time) bool {
+	if m.directRouteInstallGracePeriod <= 0 {
+		return false
+	}
+
+	since, exist := m.missingDirectRouteMap[CanonicalCIDRKey(cidr)]
+	return exist && !now.Before(since.Add(m.directRouteInstallGracePeriod))
+}
+
+// recordMissingDirectRoute records the first time the direct route of subnet is found missing.
+func (m *Manager) recordMissingDirectRoute(cidr *net.IPNet, now time.Time) {
+	cidrString := CanonicalCIDRKey(cidr)
+	if _, exist := m.missingDirectRouteMap[cidrString]; !exist {
+		m.missingDirectRouteMap[cidrString] = now
+	}
+}
+
+// pruneMissingDirectRoutes forgets the subnets which are not local underlay subnets any more.
+func (m *Manager) pruneMissingDirectRoutes() {
+	for cidrString := range m.missingDirectRouteMap {
+		if _, exist := m.localClusterUnderlaySubnetInfoMap[cidrString]; !exist {
+			delete(m.missingDirectRouteMap, cidrString)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestMissingDirectRouteInstallGracePeriod(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.1.0/24")
+	now := time.Now()
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.AddSubnetInfo(cidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0.10", false, false, true,
+		networkingv1.NetworkModeVlan)
+
+	// never install by default, the sync keeps being retried until direct route appears
+	m.recordMissingDirectRoute(cidr, now)
+	if m.shouldInstallDirectRoute(cidr, now.Add(time.Hour)) {
+		t.Fatalf("expect direct route is never installed without grace period")
+	}
+	if _, exist := m.NextDirectRouteInstallDeadline(now); exist {
+		t.Fatalf("expect no install deadline without grace period")
+	}
+
+	m.SetDirectRouteInstallGracePeriod(time.Minute)
+
+	// the first missing time is kept by later retries
+	m.recordMissingDirectRoute(cidr, now.Add(30*time.Second))
+	if m.shouldInstallDirectRoute(cidr, now.Add(59*time.Second)) {
+		t.Errorf("expect direct route is not installed within grace period")
+	}
+	if deadline, exist := m.NextDirectRouteInstallDeadline(now.Add(30 * time.Second)); !exist || !deadline.Equal(now.Add(time.Minute)) {
+		t.Errorf("expect install deadline %v, but got %v, %v", now.Add(time.Minute), deadline, exist)
+	}
+	if !m.shouldInstallDirectRoute(cidr, now.Add(time.Minute)) {
+		t.Errorf("expect direct route is installed after grace period")
+	}
+	if _, exist := m.NextDirectRouteInstallDeadline(now.Add(time.Minute)); exist {
+		t.Errorf("expect no install deadline after grace period expires")
+	}
+
+	// subnet is removed
+	m.ResetInfos()
+	m.pruneMissingDirectRoutes()
+	if len(m.missingDirectRouteMap) != 0 {
+		t.Errorf("expect missing direct routes of removed subnets are forgotten, but got %v", m.missingDirectRouteMap)
+	}
+}
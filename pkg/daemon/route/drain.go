@@ -0,0 +1,75 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"time"
+)
+
+// drainingSubnet is a local subnet being decommissioned, whose routes are kept until the deadline.
+type drainingSubnet struct {
+	deadline time.Time
+
+	// if the subnet is still draining since the last ResetInfos
+	seen bool
+}
+
+// SetSubnetDrainGracePeriod sets how long the routes of a draining subnet are kept before being removed, zero
+// means removing them immediately.
+func (m *Manager) SetSubnetDrainGracePeriod(gracePeriod time.Duration) {
+	m.subnetDrainGracePeriod = gracePeriod
+}
+
+// DrainSubnet marks subnet as draining, the drain grace period starts from the first call. It returns true if the
+// grace period has expired, then the subnet is not supposed to be added any more and its routes will be removed
+// by the next SyncRoutes. It needs to be called after every ResetInfos for the subnet to keep draining.
+func (m *Manager) DrainSubnet(cidr *net.IPNet, now time.Time) bool {
+	cidrString := CanonicalCIDRKey(cidr)
+
+	draining, exist := m.drainingSubnetMap[cidrString]
+	if !exist {
+		draining = &drainingSubnet{deadline: now.Add(m.subnetDrainGracePeriod)}
+		m.drainingSubnetMap[cidrString] = draining
+	}
+
+	draining.seen = true
+	return !now.Before(draining.deadline)
+}
+
+// NextSubnetDrainDeadline returns the earliest deadline of the subnets still in drain grace period.
+func (m *Manager) NextSubnetDrainDeadline(now time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, draining := range m.drainingSubnetMap {
+		if now.Before(draining.deadline) && (next.IsZero() || draining.deadline.Before(next)) {
+			next = draining.deadline
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// pruneDrainingSubnets forgets the subnets which stop draining, e.g., deleted or not draining any more, and starts
+// a new round of recording.
+func (m *Manager) pruneDrainingSubnets() {
+	for cidrString, draining := range m.drainingSubnetMap {
+		if !draining.seen {
+			delete(m.drainingSubnetMap, cidrString)
+			continue
+		}
+		draining.seen = false
+	}
+}
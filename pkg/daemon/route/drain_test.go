@@ -0,0 +1,79 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestDrainSubnet(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.1.0/24")
+	now := time.Now()
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.SetSubnetDrainGracePeriod(time.Minute)
+
+	addSubnet := func() {
+		m.AddSubnetInfo(cidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0.10", false, false, true,
+			networkingv1.NetworkModeVlan)
+	}
+
+	// stage 1: subnet starts draining, routes are kept
+	m.ResetInfos()
+	if m.DrainSubnet(cidr, now) {
+		t.Fatalf("expect subnet not to be drained at the beginning of grace period")
+	}
+	addSubnet()
+	if deadline, exist := m.NextSubnetDrainDeadline(now); !exist || !deadline.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expect drain deadline %v, but got %v", now.Add(time.Minute), deadline)
+	}
+
+	// stage 2: still in grace period, the deadline is not extended by later reconciliations
+	m.ResetInfos()
+	if m.DrainSubnet(cidr, now.Add(30*time.Second)) {
+		t.Fatalf("expect subnet not to be drained within grace period")
+	}
+	addSubnet()
+	if !m.checkFromPodSubnetRuleExpected(netlink.Rule{Src: cidr, Table: MinRouteTableNum}) {
+		t.Fatalf("expect rule of draining subnet to be kept")
+	}
+
+	// stage 3: grace period expires, subnet is not added any more and its rule will be removed
+	m.ResetInfos()
+	if !m.DrainSubnet(cidr, now.Add(time.Minute)) {
+		t.Fatalf("expect subnet to be drained after grace period")
+	}
+	if _, exist := m.NextSubnetDrainDeadline(now.Add(time.Minute)); exist {
+		t.Errorf("expect no drain deadline after grace period")
+	}
+	if m.checkFromPodSubnetRuleExpected(netlink.Rule{Src: cidr, Table: MinRouteTableNum}) {
+		t.Errorf("expect rule of drained subnet to be removed")
+	}
+
+	// subnet stops draining, e.g., annotation removed, and drains from the beginning next time
+	m.ResetInfos()
+	m.ResetInfos()
+	if m.DrainSubnet(cidr, now.Add(2*time.Minute)) {
+		t.Errorf("expect a new drain grace period to start")
+	}
+}
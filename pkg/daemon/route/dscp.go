@@ -0,0 +1,220 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+)
+
+// MaxDSCP is the max value of a 6-bit DSCP field.
+const MaxDSCP = 63
+
+// ParseDSCPGateways parses a DSCP-to-gateway mapping string like "46=192.168.1.254,34=192.168.1.253".
+func ParseDSCPGateways(mappingString string) (map[uint8]net.IP, error) {
+	dscpGateways := map[uint8]net.IP{}
+	if strings.TrimSpace(mappingString) == "" {
+		return dscpGateways, nil
+	}
+
+	for _, item := range strings.Split(mappingString, ",") {
+		pair := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid dscp gateway mapping %q, should be like <dscp>=<gateway>", item)
+		}
+
+		dscp, err := strconv.ParseUint(strings.TrimSpace(pair[0]), 10, 8)
+		if err != nil || dscp > MaxDSCP {
+			return nil, fmt.Errorf("invalid dscp %q, should be in range 0~%v", pair[0], MaxDSCP)
+		}
+
+		if dscp == 0 {
+			return nil, fmt.Errorf("dscp 0 is the default class and cannot be mapped to a gateway")
+		}
+
+		gateway := net.ParseIP(strings.TrimSpace(pair[1]))
+		if gateway == nil {
+			return nil, fmt.Errorf("invalid gateway ip %q for dscp %v", pair[1], dscp)
+		}
+
+		if _, exist := dscpGateways[uint8(dscp)]; exist {
+			return nil, fmt.Errorf("duplicated dscp %v", dscp)
+		}
+		dscpGateways[uint8(dscp)] = gateway
+	}
+
+	return dscpGateways, nil
+}
+
+// dscpToTos converts a DSCP value to the TOS value matched by policy rules, DSCP is the upper 6 bits of TOS.
+func dscpToTos(dscp uint8) uint {
+	return uint(dscp) << 2
+}
+
+func checkIsDSCPRule(rule netlink.Rule, tableRange TableRange) bool {
+	return checkIsFromPodSubnetRule(rule, tableRange) && rule.Tos != 0
+}
+
+func checkIfDSCPRuleExist(ruleList []netlink.Rule, cidr *net.IPNet, dscp uint8,
+	tableRange TableRange) (bool, *netlink.Rule) {
+	for _, rule := range ruleList {
+		if checkIsDSCPRule(rule, tableRange) && rule.Tos == dscpToTos(dscp) &&
+			CanonicalCIDRKey(rule.Src) == CanonicalCIDRKey(cidr) {
+			return true, &rule
+		}
+	}
+	return false, nil
+}
+
+// findUnusedRulePriorityBetween finds the highest unused rule priority in range (lower, upper).
+func findUnusedRulePriorityBetween(ruleList []netlink.Rule, lower, upper int) (int, error) {
+	priorityMap := map[int]bool{}
+	for _, rule := range ruleList {
+		priorityMap[realRulePriority(rule.Priority)] = true
+	}
+
+	for priority := upper - 1; priority > lower; priority-- {
+		if !priorityMap[priority] {
+			return priority, nil
+		}
+	}
+
+	return -1, fmt.Errorf("cannot find unused rule priority between %v and %v", lower, upper)
+}
+
+// ensureDSCPRulesAndRoutes ensures a rule matching DSCP for every mapped gateway of subnet, which points to an
+// alternate table with a default route through the gateway. DSCP rules must have higher precedence than the
+// from-pod-subnet rule of subnet, but lower than the basic rules.
+func (m *Manager) ensureDSCPRulesAndRoutes(info *SubnetInfo) error {
+	if len(info.dscpGateways) == 0 {
+		return nil
+	}
+
+	forwardLink, err := netlink.LinkByName(info.forwardNodeIfName)
+	if err != nil {
+		return fmt.Errorf("failed to get forward link %v: %v", info.forwardNodeIfName, err)
+	}
+
+	// handle dscp in order to make the allocation of tables and priorities stable
+	var dscpList []int
+	for dscp := range info.dscpGateways {
+		dscpList = append(dscpList, int(dscp))
+	}
+	sort.Ints(dscpList)
+
+	for _, dscpInt := range dscpList {
+		dscp := uint8(dscpInt)
+		gateway := info.dscpGateways[dscp]
+
+		if !info.cidr.Contains(gateway) {
+			return newPermanentError("dscp %v gateway %v is not inside the subnet cidr %v", dscp, gateway, info.cidr)
+		}
+
+		ruleList, err := netlink.RuleList(m.family)
+		if err != nil {
+			return fmt.Errorf("failed to list rules: %v", err)
+		}
+
+		var table int
+		ruleExist, existRule := checkIfDSCPRuleExist(ruleList, info.cidr, dscp, m.tableRange)
+		if ruleExist {
+			table = existRule.Table
+		} else if table, err = m.findEmptyRouteTable(); err != nil {
+			return fmt.Errorf("failed to find empty route table: %v", err)
+		}
+
+		desiredRoutes := desiredRoutesForDSCPTable(forwardLink.Attrs().Index, info.cidr, gateway, table, m.family)
+
+		actualRoutes, err := listRoutesByTable(table, m.family)
+		if err != nil {
+			return fmt.Errorf("failed to list routes for dscp table %v: %v", table, err)
+		}
+
+		if err := applyRoutesTransactionally(desiredRoutes, actualRoutes, m.family); err != nil {
+			return fmt.Errorf("failed to apply routes for dscp %v of subnet %v: %v", dscp, info.cidr, err)
+		}
+
+		if ruleExist {
+			continue
+		}
+
+		lower, upper, err := m.dscpRulePriorityRange(info.cidr)
+		if err != nil {
+			return fmt.Errorf("failed to get dscp rule priority range for subnet %v: %v", info.cidr, err)
+		}
+
+		priority, err := findUnusedRulePriorityBetween(ruleList, lower, upper)
+		if err != nil {
+			return fmt.Errorf("failed to find priority for dscp %v rule of subnet %v: %v", dscp, info.cidr, err)
+		}
+
+		rule := m.newFromPodSubnetRule(info.cidr, table, priority, dscpToTos(dscp))
+		if err := netlink.RuleAdd(rule); err != nil {
+			return fmt.Errorf("failed to add dscp policy rule %v: %v", rule.String(), err)
+		}
+	}
+
+	return nil
+}
+
+// desiredRoutesForDSCPTable returns the subnet direct route and the default route through the dscp gateway.
+func desiredRoutesForDSCPTable(linkIndex int, cidr *net.IPNet, gateway net.IP, table, family int) []netlink.Route {
+	return []netlink.Route{
+		{
+			LinkIndex: linkIndex,
+			Dst:       cidr,
+			Table:     table,
+			Scope:     netlink.SCOPE_LINK,
+			Family:    family,
+		},
+		{
+			Dst:       defaultRouteDstByFamily(family),
+			LinkIndex: linkIndex,
+			Table:     table,
+			Scope:     netlink.SCOPE_UNIVERSE,
+			Gw:        gateway,
+			Family:    family,
+		},
+	}
+}
+
+// dscpRulePriorityRange returns the range of priorities which dscp rules of cidr can use,
+// they should be after the overlay-mark rule and before the from-pod-subnet rule of cidr.
+func (m *Manager) dscpRulePriorityRange(cidr *net.IPNet) (int, int, error) {
+	exist, overlayMarkRule, err := checkIfRuleExist(nil, m.overlayMarkTableNum, m.family)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to check overlay-mark rule: %v", err)
+	}
+	if !exist {
+		return 0, 0, fmt.Errorf("overlay-mark rule not found")
+	}
+
+	exist, fromPodSubnetRule, err := checkIfRuleExist(cidr, -1, m.family)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to check from-pod-subnet rule: %v", err)
+	}
+	if !exist {
+		return 0, 0, fmt.Errorf("from-pod-subnet rule not found")
+	}
+
+	return realRulePriority(overlayMarkRule.Priority), realRulePriority(fromPodSubnetRule.Priority), nil
+}
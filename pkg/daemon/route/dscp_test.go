@@ -0,0 +1,159 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestParseDSCPGateways(t *testing.T) {
+	testCases := []struct {
+		mapping   string
+		expect    map[uint8]string
+		expectErr bool
+	}{
+		{"", map[uint8]string{}, false},
+		{"46=192.168.1.254, 34=192.168.1.253", map[uint8]string{46: "192.168.1.254", 34: "192.168.1.253"}, false},
+		{"46=192.168.1.254,46=192.168.1.253", nil, true},
+		{"64=192.168.1.254", nil, true},
+		{"0=192.168.1.254", nil, true},
+		{"46=invalid", nil, true},
+		{"46", nil, true},
+	}
+
+	for _, test := range testCases {
+		dscpGateways, err := ParseDSCPGateways(test.mapping)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("expect error for %q but got %v", test.mapping, dscpGateways)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", test.mapping, err)
+			continue
+		}
+
+		if len(dscpGateways) != len(test.expect) {
+			t.Errorf("expect %v for %q but got %v", test.expect, test.mapping, dscpGateways)
+			continue
+		}
+
+		for dscp, gateway := range test.expect {
+			if !dscpGateways[dscp].Equal(net.ParseIP(gateway)) {
+				t.Errorf("expect gateway %v for dscp %v but got %v", gateway, dscp, dscpGateways[dscp])
+			}
+		}
+	}
+}
+
+func TestNewDSCPRule(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.1.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	rule := m.newFromPodSubnetRule(cidr, 10001, 1000, dscpToTos(46))
+	if rule.Tos != 0xb8 {
+		t.Errorf("expect tos 0xb8 for dscp 46 but got %#x", rule.Tos)
+	}
+
+	if !checkIsDSCPRule(*rule, DefaultTableRange) || !checkIsFromPodSubnetRule(*rule, DefaultTableRange) {
+		t.Errorf("expect rule %v to be recognized as a managed dscp rule", rule)
+	}
+
+	if exist, _ := checkIfDSCPRuleExist([]netlink.Rule{*rule}, cidr, 46, DefaultTableRange); !exist {
+		t.Errorf("expect dscp rule of 46 to exist")
+	}
+
+	if exist, _ := checkIfDSCPRuleExist([]netlink.Rule{*rule}, cidr, 34, DefaultTableRange); exist {
+		t.Errorf("expect dscp rule of 34 not to exist")
+	}
+
+	m.AddSubnetInfo(cidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0", false, false, true,
+		networkingv1.NetworkModeVlan)
+	m.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(cidr)].dscpGateways = map[uint8]net.IP{
+		46: net.ParseIP("192.168.1.254"),
+	}
+
+	if !m.checkFromPodSubnetRuleExpected(*rule) {
+		t.Errorf("expect dscp rule %v to be expected", rule)
+	}
+
+	staleRule := m.newFromPodSubnetRule(cidr, 10002, 1001, dscpToTos(34))
+	if m.checkFromPodSubnetRuleExpected(*staleRule) {
+		t.Errorf("expect dscp rule %v to be stale", staleRule)
+	}
+}
+
+func TestFindUnusedRulePriorityBetween(t *testing.T) {
+	newRule := func(priority int) netlink.Rule {
+		rule := netlink.NewRule()
+		rule.Priority = priority
+		return *rule
+	}
+
+	ruleList := []netlink.Rule{newRule(0), newRule(1999), newRule(2000), newRule(2001), newRule(2003), newRule(32766)}
+
+	if priority, err := findUnusedRulePriorityBetween(ruleList, 2001, 2003); err != nil || priority != 2002 {
+		t.Errorf("expect priority 2002 but got %v, %v", priority, err)
+	}
+
+	if priority, err := findUnusedRulePriorityBetween(ruleList, 1999, 2001); err == nil {
+		t.Errorf("expect no unused priority but got %v", priority)
+	}
+}
+
+func TestDesiredRoutesForDSCPTableConverged(t *testing.T) {
+	testCases := []struct {
+		cidr    string
+		gateway string
+		family  int
+	}{
+		{"192.168.1.0/24", "192.168.1.254", netlink.FAMILY_V4},
+		{"fe80:1::/64", "fe80:1::fe", netlink.FAMILY_V6},
+	}
+
+	for _, test := range testCases {
+		_, cidr, _ := net.ParseCIDR(test.cidr)
+		desired := desiredRoutesForDSCPTable(2, cidr, net.ParseIP(test.gateway), 10001, test.family)
+
+		// routes read back from kernel are unicast, with protocol and the default ipv6 metric filled
+		var actual []netlink.Route
+		for _, route := range desired {
+			route.Type = unix.RTN_UNICAST
+			route.Protocol = unix.RTPROT_BOOT
+			if test.family == netlink.FAMILY_V6 {
+				route.Priority = 1024
+			}
+			if ones, _ := route.Dst.Mask.Size(); ones == 0 {
+				route.Dst = nil
+			}
+			actual = append(actual, route)
+		}
+
+		if toAdd, toDel := DiffRoutes(desired, actual); len(toAdd) != 0 || len(toDel) != 0 {
+			t.Errorf("%v: expect dscp table routes converged, but got %v to add and %v to delete",
+				test.cidr, toAdd, toDel)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PermanentError is a route sync error caused by bad configuration, which will not be resolved by retrying until
+// the configuration is fixed. Other errors, e.g., netlink failures and missing interfaces, are taken as transient.
+type PermanentError struct {
+	err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.err
+}
+
+func newPermanentError(format string, a ...interface{}) error {
+	return &PermanentError{err: fmt.Errorf(format, a...)}
+}
+
+// IsPermanentError returns true if any error in the chain of err is a PermanentError.
+func IsPermanentError(err error) bool {
+	var permanentError *PermanentError
+	return errors.As(err, &permanentError)
+}
+
+// MissingDirectRouteError is a transient route sync error that the forward interface of a local vlan subnet has
+// no direct route for the subnet yet, the direct route usually appears a moment later, e.g., during boot.
+type MissingDirectRouteError struct {
+	LinkName string
+	CIDR     string
+}
+
+func (e *MissingDirectRouteError) Error() string {
+	return fmt.Sprintf("forward interface %v should have direct route for local subnet %v", e.LinkName, e.CIDR)
+}
+
+// IsMissingDirectRouteError returns true if any error in the chain of err is a MissingDirectRouteError.
+func IsMissingDirectRouteError(err error) bool {
+	var missingDirectRouteError *MissingDirectRouteError
+	return errors.As(err, &missingDirectRouteError)
+}
+
+// ConflictingAddressError is a route sync error that the forward interface of a vlan subnet has an address
+// outside the subnet but covering it, only the subnet is skipped rather than failing the whole sync.
+type ConflictingAddressError struct {
+	LinkName string
+	Addr     string
+	CIDR     string
+}
+
+func (e *ConflictingAddressError) Error() string {
+	return fmt.Sprintf("address %v of forward interface %v is outside vlan subnet %v but covers it, "+
+		"which will interfere with the source selection of subnet direct route", e.Addr, e.LinkName, e.CIDR)
+}
+
+// IsConflictingAddressError returns true if any error in the chain of err is a ConflictingAddressError.
+func IsConflictingAddressError(err error) bool {
+	var conflictingAddressError *ConflictingAddressError
+	return errors.As(err, &conflictingAddressError)
+}
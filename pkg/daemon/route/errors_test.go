@@ -0,0 +1,138 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestIsPermanentError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			"nil error",
+			nil,
+			false,
+		},
+		{
+			"transient error",
+			fmt.Errorf("failed to add route: %v", fmt.Errorf("device busy")),
+			false,
+		},
+		{
+			"permanent error",
+			newPermanentError("unsupported network mode %v", "foo"),
+			true,
+		},
+		{
+			"wrapped permanent error",
+			fmt.Errorf("failed to sync routes: %w",
+				fmt.Errorf("failed to ensure routes: %w", newPermanentError("source ip not assigned"))),
+			true,
+		},
+		{
+			"missing direct route error",
+			fmt.Errorf("failed to sync routes: %w", &MissingDirectRouteError{LinkName: "eth0.10", CIDR: "192.168.1.0/24"}),
+			false,
+		},
+		{
+			"permanent error wrapped without %w",
+			fmt.Errorf("failed to sync routes: %v", newPermanentError("source ip not assigned")),
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsPermanentError(test.err); got != test.want {
+				t.Errorf("IsPermanentError() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsMissingDirectRouteError(t *testing.T) {
+	missingDirectRouteErr := &MissingDirectRouteError{LinkName: "eth0.10", CIDR: "192.168.1.0/24"}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			"nil error",
+			nil,
+			false,
+		},
+		{
+			"other error",
+			fmt.Errorf("failed to add route: %v", fmt.Errorf("device busy")),
+			false,
+		},
+		{
+			"wrapped missing direct route error",
+			fmt.Errorf("failed to sync routes: %w", fmt.Errorf("failed to ensure routes: %w", missingDirectRouteErr)),
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsMissingDirectRouteError(test.err); got != test.want {
+				t.Errorf("IsMissingDirectRouteError() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsConflictingAddressError(t *testing.T) {
+	conflictingAddressErr := &ConflictingAddressError{LinkName: "eth0.10", Addr: "192.168.0.10/16", CIDR: "192.168.1.0/24"}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			"nil error",
+			nil,
+			false,
+		},
+		{
+			"permanent error",
+			newPermanentError("source ip not assigned"),
+			false,
+		},
+		{
+			"wrapped conflicting address error",
+			fmt.Errorf("failed to sync routes: %w", fmt.Errorf("failed to ensure routes: %w", conflictingAddressErr)),
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsConflictingAddressError(test.err); got != test.want {
+				t.Errorf("IsConflictingAddressError() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+	"github.com/alibaba/hybridnet/pkg/daemon/iptables"
+	daemonutils "github.com/alibaba/hybridnet/pkg/daemon/utils"
+)
+
+// ExportedRule is a desired policy rule, with the priority and table allocated in kernel.
+type ExportedRule struct {
+	Priority int    `json:"priority"`
+	Src      string `json:"src,omitempty"`
+	Tos      uint   `json:"tos,omitempty"`
+	Mark     int    `json:"mark,omitempty"`
+	Mask     int    `json:"mask,omitempty"`
+	Table    int    `json:"table"`
+}
+
+// ExportedTable is the desired routes of a route table, rendered as "ip route show table N" does.
+type ExportedTable struct {
+	Table  int      `json:"table"`
+	Routes []string `json:"routes"`
+}
+
+// exportEnv is the live state which desired rules and routes depend on, e.g., the tables allocated for
+// subnets and the indexes of forward interfaces.
+type exportEnv struct {
+	ruleList []netlink.Rule
+	addrList []netlink.Addr
+
+	// the default route of main table, which is copied for bgp subnets without gateways
+	mainDefaultRoute *netlink.Route
+
+	linkIndex  func(name string) (int, bool)
+	linkName   func(index int) string
+	vlanSource func(info *SubnetInfo, linkIndex int) net.IP
+}
+
+// newLiveExportEnv collects the live state from kernel.
+func newLiveExportEnv(family int) (*exportEnv, error) {
+	ruleList, err := netlink.RuleList(family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %v", err)
+	}
+
+	addrList, err := netlink.AddrList(nil, family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses: %v", err)
+	}
+
+	mainDefaultRoute, err := daemonutils.GetDefaultRoute(family)
+	if err != nil && err != daemonutils.NotExist {
+		return nil, fmt.Errorf("failed to get default route: %v", err)
+	}
+
+	return &exportEnv{
+		ruleList:         ruleList,
+		addrList:         addrList,
+		mainDefaultRoute: mainDefaultRoute,
+		linkIndex: func(name string) (int, bool) {
+			link, err := netlink.LinkByName(name)
+			if err != nil {
+				return 0, false
+			}
+			return link.Attrs().Index, true
+		},
+		linkName: func(index int) string {
+			link, err := netlink.LinkByIndex(index)
+			if err != nil {
+				return fmt.Sprintf("if%d", index)
+			}
+			return link.Attrs().Name
+		},
+		vlanSource: func(info *SubnetInfo, linkIndex int) net.IP {
+			link, err := netlink.LinkByIndex(linkIndex)
+			if err != nil {
+				return nil
+			}
+			src, _ := lookupVlanSubnetDirectRouteSource(link, info.cidr, family)
+			return src
+		},
+	}, nil
+}
+
+// exportRulesAndTables builds the desired rules and routes with the same builders used by sync, rules and tables
+// are only exported if they are found in kernel, as priorities and tables are allocated while syncing.
+func (m *Manager) exportRulesAndTables(env *exportEnv) ([]ExportedRule, []ExportedTable, error) {
+	var rules []ExportedRule
+	tableRoutes := map[int][]netlink.Route{}
+
+	addRule := func(rule *netlink.Rule) {
+		exportedRule := ExportedRule{
+			Priority: realRulePriority(rule.Priority),
+			Tos:      rule.Tos,
+			Table:    rule.Table,
+		}
+		if rule.Src != nil {
+			exportedRule.Src = CanonicalCIDRKey(rule.Src)
+		}
+		if rule.Mark > 0 {
+			exportedRule.Mark = rule.Mark
+		}
+		if rule.Mask > 0 {
+			exportedRule.Mask = rule.Mask
+		}
+		rules = append(rules, exportedRule)
+	}
+
+	for _, basicRule := range []*netlink.Rule{
+		m.newBasicRule(m.localDirectTableNum, 0, 0),
+		m.newBasicRule(m.toOverlaySubnetTableNum, 0, 0),
+		m.newBasicRule(m.overlayMarkTableNum, iptables.PodToNodeBackTrafficMark, iptables.PodToNodeBackTrafficMark),
+	} {
+		if liveRule, exist := findBasicRule(env.ruleList, basicRule.Table); exist {
+			basicRule.Priority = liveRule.Priority
+			addRule(basicRule)
+		}
+	}
+
+	// to-overlay-pod-subnet table
+	localOverlayExcludeIPBlockMap, err := findExcludeIPBlockMap(m.localClusterOverlaySubnetInfoMap)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find exclude ip blocks for overlay subnet: %v", err)
+	}
+	remoteOverlayExcludeIPBlockMap, err := findExcludeIPBlockMap(m.remoteOverlaySubnetInfoMap)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find exclude ip blocks for remote overlay subnet: %v", err)
+	}
+	tableRoutes[m.toOverlaySubnetTableNum] = m.desiredToOverlaySubnetRoutes(env,
+		combineNetMap(localOverlayExcludeIPBlockMap, remoteOverlayExcludeIPBlockMap))
+
+	// overlay-mark table
+	tableRoutes[m.overlayMarkTableNum] = nil
+	if overlayLinkIndex, exist := env.linkIndex(m.overlayIfName); m.overlayIfName != "" && exist {
+		tableRoutes[m.overlayMarkTableNum] = []netlink.Route{{
+			Dst:       defaultRouteDstByFamily(m.family),
+			LinkIndex: overlayLinkIndex,
+			Table:     m.overlayMarkTableNum,
+			Scope:     netlink.SCOPE_UNIVERSE,
+		}}
+	}
+
+	// from-pod-subnet tables
+	localUnderlayExcludeIPBlockMap, err := findExcludeIPBlockMap(m.localClusterUnderlaySubnetInfoMap)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find exclude ip blocks for underlay subnet: %v", err)
+	}
+	remoteUnderlayExcludeIPBlockMap, err := findExcludeIPBlockMap(m.remoteUnderlaySubnetInfoMap)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find exclude ip blocks for remote underlay subnet: %v", err)
+	}
+	underlaySubnetInfoMap := combineSubnetInfoMap(m.localClusterUnderlaySubnetInfoMap, m.remoteUnderlaySubnetInfoMap)
+	underlayExcludeIPBlockMap := combineNetMap(localUnderlayExcludeIPBlockMap, remoteUnderlayExcludeIPBlockMap)
+
+	var fromPodSubnetInfos []*SubnetInfo
+	for _, info := range m.localClusterOverlaySubnetInfoMap {
+		fromPodSubnetInfos = append(fromPodSubnetInfos, info)
+	}
+	for _, info := range m.localClusterUnderlaySubnetInfoMap {
+		if info.isUnderlayOnHost {
+			fromPodSubnetInfos = append(fromPodSubnetInfos, info)
+		}
+	}
+
+	for _, info := range fromPodSubnetInfos {
+		rule, exist := findFromPodSubnetRule(env.ruleList, info.cidr, m.tableRange)
+		if !exist {
+			continue
+		}
+		addRule(m.newFromPodSubnetRule(info.cidr, rule.Table, rule.Priority, 0))
+
+		linkIndex, exist := env.linkIndex(info.forwardNodeIfName)
+		if !exist {
+			continue
+		}
+
+		// shared tables are rendered once
+		if _, rendered := tableRoutes[rule.Table]; !rendered {
+			tableRoutes[rule.Table] = m.desiredFromPodSubnetRoutes(env, info, linkIndex, rule.Table,
+				underlaySubnetInfoMap, underlayExcludeIPBlockMap)
+		}
+
+		for dscp, gateway := range info.dscpGateways {
+			dscpExist, dscpRule := checkIfDSCPRuleExist(env.ruleList, info.cidr, dscp, m.tableRange)
+			if !dscpExist {
+				continue
+			}
+			addRule(m.newFromPodSubnetRule(info.cidr, dscpRule.Table, dscpRule.Priority, dscpToTos(dscp)))
+			tableRoutes[dscpRule.Table] = desiredRoutesForDSCPTable(linkIndex, info.cidr, gateway,
+				dscpRule.Table, m.family)
+		}
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Priority < rules[j].Priority
+	})
+
+	var tables []ExportedTable
+	for table, routes := range tableRoutes {
+		tables = append(tables, ExportedTable{Table: table, Routes: formatIPRouteLines(routes, env.linkName)})
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].Table < tables[j].Table
+	})
+
+	return rules, tables, nil
+}
+
+// desiredToOverlaySubnetRoutes returns the routes of to-overlay-pod-subnet table.
+func (m *Manager) desiredToOverlaySubnetRoutes(env *exportEnv, excludeIPBlockMap map[string]*net.IPNet) []netlink.Route {
+	var routes []netlink.Route
+	addRoute := func(cidr *net.IPNet, ifName string) {
+		if linkIndex, exist := env.linkIndex(ifName); exist {
+			routes = append(routes, netlink.Route{
+				Dst:       cidr,
+				LinkIndex: linkIndex,
+				Table:     m.toOverlaySubnetTableNum,
+				Scope:     netlink.SCOPE_UNIVERSE,
+			})
+		}
+	}
+
+	for _, info := range m.localClusterOverlaySubnetInfoMap {
+		addRoute(info.cidr, info.forwardNodeIfName)
+	}
+	for _, info := range m.remoteOverlaySubnetInfoMap {
+		addRoute(info.cidr, info.forwardNodeIfName)
+	}
+	for _, block := range excludeIPBlockMap {
+		routes = append(routes, netlink.Route{
+			Dst:   block,
+			Table: m.toOverlaySubnetTableNum,
+			Type:  unix.RTN_THROW,
+		})
+	}
+	return routes
+}
+
+// desiredFromPodSubnetRoutes returns the routes of from-pod-subnet table as ensureFromPodSubnetRuleAndRoutes does.
+func (m *Manager) desiredFromPodSubnetRoutes(env *exportEnv, info *SubnetInfo, linkIndex, table int,
+	underlaySubnetInfoMap SubnetInfoMap, underlayExcludeIPBlockMap map[string]*net.IPNet) []netlink.Route {
+	switch info.mode {
+	case networkingv1.NetworkModeVxlan:
+		egressGateway, autoNatOutgoing := info.egressGateway, info.autoNatOutgoing
+		if egressGateway != nil {
+			egressGateway, autoNatOutgoing = resolveLocalEgressGateway(egressGateway, autoNatOutgoing, env.addrList)
+		}
+
+		// underlay subnets are only routed to vxlan device if overlay pod traffic is NATed
+		var underlayInfoMap SubnetInfoMap
+		var excludeIPBlockMap map[string]*net.IPNet
+		if _, isOverlay := m.localClusterOverlaySubnetInfoMap[CanonicalCIDRKey(info.cidr)]; isOverlay {
+			underlayInfoMap, excludeIPBlockMap = underlaySubnetInfoMap, underlayExcludeIPBlockMap
+		}
+
+		routes := desiredRoutesForVxlanSubnet(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Index: linkIndex}}, table,
+			autoNatOutgoing, m.family, underlayInfoMap, excludeIPBlockMap, info.overlayDestinations, egressGateway)
+		setRoutesMTU(routes, info.routeMTU, info.routeAdvMSS)
+		return routes
+	case networkingv1.NetworkModeVlan:
+		if info.gateway == nil {
+			return nil
+		}
+		return desiredRoutesForVlanSubnet(linkIndex, info.cidr, info.gateway, env.vlanSource(info, linkIndex), table)
+	case networkingv1.NetworkModeBGP, networkingv1.NetworkModeGlobalBGP:
+		gateways := info.bgpGateways
+		if len(gateways) == 0 && info.gateway != nil {
+			gateways = []net.IP{info.gateway}
+		}
+
+		var defaultRoute *netlink.Route
+		switch {
+		case len(dedupeGateways(gateways)) != 0:
+			defaultRoute = buildBGPDefaultRoute(linkIndex, table, gateways)
+		case env.mainDefaultRoute != nil:
+			copied := *env.mainDefaultRoute
+			copied.Table = table
+			defaultRoute = &copied
+		default:
+			return nil
+		}
+
+		if info.routeSrc != nil {
+			defaultRoute.Src = info.routeSrc
+		}
+		return []netlink.Route{*defaultRoute}
+	default:
+		return nil
+	}
+}
+
+// newBasicRule returns a rule which is not specific to any subnet.
+func (m *Manager) newBasicRule(table, mark, mask int) *netlink.Rule {
+	rule := netlink.NewRule()
+	rule.Table = table
+	rule.Family = m.family
+	rule.Mark = mark
+	rule.Mask = mask
+	return rule
+}
+
+// findBasicRule finds the rule without any source and tos looking up table.
+func findBasicRule(ruleList []netlink.Rule, table int) (netlink.Rule, bool) {
+	for _, rule := range ruleList {
+		if rule.Src == nil && rule.Tos == 0 && rule.Table == table {
+			return rule, true
+		}
+	}
+	return netlink.Rule{}, false
+}
+
+// findFromPodSubnetRule finds the from-pod-subnet rule of cidr, dscp rules are not taken into account.
+func findFromPodSubnetRule(ruleList []netlink.Rule, cidr *net.IPNet, tableRange TableRange) (netlink.Rule, bool) {
+	for _, rule := range ruleList {
+		if rule.Tos == 0 && checkIsFromPodSubnetRule(rule, tableRange) &&
+			CanonicalCIDRKey(rule.Src) == CanonicalCIDRKey(cidr) {
+			return rule, true
+		}
+	}
+	return netlink.Rule{}, false
+}
@@ -0,0 +1,104 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+// FlushAll removes all the policy rules and flushes all the route tables managed by hybridnet, and then rebuilds
+// them from the recorded subnet infos immediately. It is the last resort for a node whose routing state has
+// drifted beyond repair. Rules and routes not managed by hybridnet, including operator pinned routes in managed
+// tables, are never touched.
+func (m *Manager) FlushAll() error {
+	if m.IsPaused() {
+		return fmt.Errorf("route reconciliation is paused, refuse to flush routes")
+	}
+
+	ruleList, err := netlink.RuleList(m.family)
+	if err != nil {
+		return fmt.Errorf("failed to list rule: %v", err)
+	}
+
+	rulesToDel, tablesToFlush := planFlushAll(ruleList, append(m.pendingDeleteTableNums(),
+		m.localDirectTableNum, m.toOverlaySubnetTableNum, m.overlayMarkTableNum), m.tableRange)
+
+	m.logger.Info("flushing all route state", "rules", len(rulesToDel), "tables", tablesToFlush)
+
+	// Delete rules before flushing tables, traffic falls back to main table instead of being black-holed
+	// by half-flushed tables.
+	for i := range rulesToDel {
+		rule := rulesToDel[i]
+		rule.Family = m.family
+		if err := netlink.RuleDel(&rule); err != nil {
+			return fmt.Errorf("failed to delete rule %v: %v", rule.String(), err)
+		}
+	}
+
+	for _, table := range tablesToFlush {
+		if err := clearRouteTable(table, m.family, isOperatorPinnedRoute); err != nil {
+			return fmt.Errorf("failed to clear route table %v: %v", table, err)
+		}
+	}
+
+	// Programmed state has been totally removed.
+	m.pendingDeleteTableMap = map[string]*pendingDeleteTable{}
+	m.subnetModeMap = map[string]networkingv1.NetworkMode{}
+
+	if err := m.SyncRoutes(); err != nil {
+		return fmt.Errorf("failed to rebuild routes after flushing: %w", err)
+	}
+	return nil
+}
+
+// planFlushAll picks the managed rules to be deleted and the tables to be flushed, basicTables are the tables
+// not referenced by from-pod-subnet rules but still managed.
+func planFlushAll(ruleList []netlink.Rule, basicTables []int, tableRange TableRange) (rulesToDel []netlink.Rule,
+	tablesToFlush []int) {
+	basicTableMap := map[int]bool{}
+	for _, table := range basicTables {
+		basicTableMap[table] = true
+	}
+
+	tableMap := map[int]bool{}
+	for _, rule := range ruleList {
+		switch {
+		case checkIsFromPodSubnetRule(rule, tableRange):
+			tableMap[rule.Table] = true
+		case rule.Src == nil && basicTableMap[rule.Table]:
+		default:
+			continue
+		}
+		rulesToDel = append(rulesToDel, rule)
+	}
+
+	for table := range basicTableMap {
+		tableMap[table] = true
+	}
+
+	for table := range tableMap {
+		tablesToFlush = append(tablesToFlush, table)
+	}
+	sort.Ints(tablesToFlush)
+
+	return rulesToDel, tablesToFlush
+}
@@ -0,0 +1,84 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/alibaba/hybridnet/pkg/daemon/iptables"
+)
+
+func TestPlanFlushAll(t *testing.T) {
+	_, cidr1, _ := net.ParseCIDR("10.0.0.0/24")
+	_, cidr2, _ := net.ParseCIDR("10.0.1.0/24")
+	_, staleCidr, _ := net.ParseCIDR("10.0.2.0/24")
+	_, foreignCidr, _ := net.ParseCIDR("172.16.0.0/16")
+
+	newRule := func(src *net.IPNet, table, mark, mask int, tos uint) netlink.Rule {
+		rule := netlink.NewRule()
+		rule.Src = src
+		rule.Table = table
+		rule.Mark = mark
+		rule.Mask = mask
+		rule.Tos = tos
+		return *rule
+	}
+
+	ruleList := []netlink.Rule{
+		// foreign rules
+		newRule(nil, 255, 0, 0, 0),
+		newRule(nil, 254, 0, 0, 0),
+		newRule(foreignCidr, 100, 0, 0, 0),
+		newRule(foreignCidr, 10005, 0, 0, 0),
+		// basic rules
+		newRule(nil, 39999, 0, 0, 0),
+		newRule(nil, 40000, 0, 0, 0),
+		newRule(nil, 40001, iptables.PodToNodeBackTrafficMark, iptables.PodToNodeBackTrafficMark, 0),
+		// from-pod-subnet rules, including a dscp rule and a drifted rule of removed subnet
+		newRule(cidr1, 10000, 0, DefaultFromRuleMask, 0),
+		newRule(cidr1, 10003, 0, DefaultFromRuleMask, dscpToTos(10)),
+		newRule(cidr2, 10001, 0, DefaultFromRuleMask, 0),
+		newRule(staleCidr, 10002, 0, DefaultFromRuleMask, 0),
+	}
+
+	rulesToDel, tablesToFlush := planFlushAll(ruleList, []int{39999, 40000, 40001, 10004}, DefaultTableRange)
+
+	var tablesOfRulesToDel []int
+	for _, rule := range rulesToDel {
+		tablesOfRulesToDel = append(tablesOfRulesToDel, rule.Table)
+	}
+	if expected := []int{39999, 40000, 40001, 10000, 10003, 10001, 10002}; !reflect.DeepEqual(tablesOfRulesToDel, expected) {
+		t.Errorf("expect rules of tables %v to be deleted, but got %v", expected, tablesOfRulesToDel)
+	}
+
+	if expected := []int{10000, 10001, 10002, 10003, 10004, 39999, 40000, 40001}; !reflect.DeepEqual(tablesToFlush, expected) {
+		t.Errorf("expect tables %v to be flushed, but got %v", expected, tablesToFlush)
+	}
+}
+
+func TestFlushAllWhilePaused(t *testing.T) {
+	m := newTestManager(netlink.FAMILY_V4)
+	m.Pause()
+
+	if err := m.FlushAll(); err == nil {
+		t.Errorf("expect flushing to be refused while paused")
+	}
+}
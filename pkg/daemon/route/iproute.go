@@ -0,0 +1,202 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// FormatIPRoute renders the desired state in the text of "ip rule show" and "ip route show table N"
+// outputs, so that it can be compared with live "ip" outputs directly.
+func FormatIPRoute(state *ExportedState) string {
+	familyFlag := "-4"
+	if state.Family == netlink.FAMILY_V6 {
+		familyFlag = "-6"
+	}
+
+	builder := &strings.Builder{}
+
+	fmt.Fprintf(builder, "# ip %s rule show\n", familyFlag)
+	for _, rule := range state.Rules {
+		builder.WriteString(formatIPRule(rule) + "\n")
+	}
+
+	for _, table := range state.Tables {
+		fmt.Fprintf(builder, "# ip %s route show table %d\n", familyFlag, table.Table)
+		for _, route := range table.Routes {
+			builder.WriteString(route + "\n")
+		}
+	}
+
+	return builder.String()
+}
+
+// formatIPRule formats rule as "ip rule show" does.
+func formatIPRule(rule ExportedRule) string {
+	src := "all"
+	if rule.Src != "" {
+		src = formatIPRouteDst(rule.Src)
+		if src == "default" {
+			src = "all"
+		}
+	}
+
+	line := fmt.Sprintf("%d:\tfrom %s", rule.Priority, src)
+	if rule.Tos != 0 {
+		line += fmt.Sprintf(" tos %#x", rule.Tos)
+	}
+	if rule.Mark != 0 || rule.Mask != 0 {
+		mask := rule.Mask
+		if mask == 0 {
+			mask = 0xffffffff
+		}
+		line += " fwmark " + formatIPRouteMark(rule.Mark, mask)
+	}
+	return line + fmt.Sprintf(" lookup %d", rule.Table)
+}
+
+// formatIPRouteLines formats routes as "ip route show table N" does, with the default route first and the others
+// ordered by destination.
+func formatIPRouteLines(routes []netlink.Route, linkName func(index int) string) []string {
+	type routeLine struct {
+		dst  string
+		line string
+	}
+
+	var lines []routeLine
+	for i := range routes {
+		route := &routes[i]
+
+		dst := "default"
+		if route.Dst != nil {
+			dst = formatIPRouteDst(CanonicalCIDRKey(route.Dst))
+		}
+
+		if route.Type == unix.RTN_THROW {
+			lines = append(lines, routeLine{dst: dst, line: "throw " + dst})
+			continue
+		}
+
+		parts := []string{dst}
+		if route.Gw != nil {
+			parts = append(parts, "via", route.Gw.String())
+		}
+		if route.LinkIndex > 0 {
+			parts = append(parts, "dev", linkName(route.LinkIndex))
+		}
+		if route.Scope == netlink.SCOPE_LINK {
+			parts = append(parts, "scope", "link")
+		}
+		if route.Src != nil {
+			parts = append(parts, "src", route.Src.String())
+		}
+		if route.Flags&int(netlink.FLAG_ONLINK) != 0 {
+			parts = append(parts, "onlink")
+		}
+		if metrics := formatIPRouteMetrics(route.MTU, route.AdvMSS); metrics != "" {
+			parts = append(parts, metrics)
+		}
+
+		line := strings.Join(parts, " ")
+		for _, nexthop := range route.MultiPath {
+			line += fmt.Sprintf("\n\tnexthop via %s dev %s weight %d", nexthop.Gw, linkName(nexthop.LinkIndex),
+				nexthop.Hops+1)
+		}
+		lines = append(lines, routeLine{dst: dst, line: line})
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		if (lines[i].dst == "default") != (lines[j].dst == "default") {
+			return lines[i].dst == "default"
+		}
+		return lines[i].dst < lines[j].dst
+	})
+
+	var formatted []string
+	for _, line := range lines {
+		formatted = append(formatted, line.line)
+	}
+	return formatted
+}
+
+// formatIPRouteMetrics formats the mtu and advmss of route as "ip route" does, zero values are omitted.
+func formatIPRouteMetrics(mtu, advMSS int) string {
+	var metrics []string
+	if mtu != 0 {
+		metrics = append(metrics, fmt.Sprintf("mtu %d", mtu))
+	}
+	if advMSS != 0 {
+		metrics = append(metrics, fmt.Sprintf("advmss %d", advMSS))
+	}
+	return strings.Join(metrics, " ")
+}
+
+// formatIPRouteDst formats destination as "ip route" does, host routes are shown without prefix length.
+func formatIPRouteDst(cidr string) string {
+	if cidr == "default" {
+		return cidr
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return cidr
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	if ones == 0 {
+		return "default"
+	}
+	if ones == bits {
+		return ipNet.IP.String()
+	}
+	return ipNet.String()
+}
+
+// formatIPRouteMark formats fwmark as "ip rule" does.
+func formatIPRouteMark(mark, mask int) string {
+	hex := func(value int) string {
+		if value == 0 {
+			return "0"
+		}
+		return fmt.Sprintf("%#x", value)
+	}
+
+	if uint32(mask) == 0xffffffff {
+		return hex(mark)
+	}
+	return hex(mark) + "/" + hex(mask)
+}
+
+// ExportIPRoute renders the desired rules and routes of manager in "ip" command compatible text,
+// see FormatIPRoute.
+func (m *Manager) ExportIPRoute() (string, error) {
+	state, err := m.ExportState()
+	if err != nil {
+		return "", err
+	}
+
+	if state, err = state.ResolveKernelState(); err != nil {
+		return "", err
+	}
+	return FormatIPRoute(state), nil
+}
@@ -0,0 +1,214 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+// newTestExportEnv returns an export env with the rules allocated in kernel and the indexes of interfaces.
+func newTestExportEnv(ruleList []netlink.Rule, links map[string]int, vlanSource net.IP) *exportEnv {
+	return &exportEnv{
+		ruleList: ruleList,
+		linkIndex: func(name string) (int, bool) {
+			index, exist := links[name]
+			return index, exist
+		},
+		linkName: func(index int) string {
+			for name, linkIndex := range links {
+				if linkIndex == index {
+					return name
+				}
+			}
+			return fmt.Sprintf("if%d", index)
+		},
+		vlanSource: func(info *SubnetInfo, linkIndex int) net.IP {
+			return vlanSource
+		},
+	}
+}
+
+func TestManagerExportIPRoute(t *testing.T) {
+	_, overlayCidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, underlayCidr, _ := net.ParseCIDR("192.168.1.0/24")
+	_, bgpCidr, _ := net.ParseCIDR("172.16.0.0/24")
+	_, remoteOverlayCidr, _ := net.ParseCIDR("10.1.0.0/24")
+
+	addOverlay := func(m *Manager) {
+		m.AddSubnetInfo(overlayCidr, nil, nil, nil, []net.IP{net.ParseIP("10.0.0.5")}, "eth0.vxlan4", true, true,
+			false, networkingv1.NetworkModeVxlan)
+	}
+	addUnderlay := func(m *Manager) {
+		m.AddSubnetInfo(underlayCidr, net.ParseIP("192.168.1.1"), net.ParseIP("192.168.1.2"),
+			net.ParseIP("192.168.1.254"), nil, "eth0.100", false, false, true, networkingv1.NetworkModeVlan)
+		m.SetSubnetDSCPGateways(underlayCidr, map[uint8]net.IP{46: net.ParseIP("192.168.1.254")})
+	}
+	addBGP := func(m *Manager) {
+		m.AddSubnetInfo(bgpCidr, net.ParseIP("10.10.0.1"), nil, nil, nil, "eth1", false, false, true,
+			networkingv1.NetworkModeBGP)
+		m.SetSubnetBGPGateways(bgpCidr, []net.IP{net.ParseIP("10.10.0.2"), net.ParseIP("10.10.0.1")})
+		m.SetSubnetRouteSource(bgpCidr, net.ParseIP("10.10.0.100"))
+	}
+	addRemoteOverlay := func(m *Manager) {
+		if err := m.AddRemoteSubnetInfo(remoteOverlayCidr, nil, nil, nil, nil, "eth0.vxlan4", true); err != nil {
+			t.Fatalf("failed to add remote subnet info: %v", err)
+		}
+	}
+
+	m1 := newTestManager(netlink.FAMILY_V4)
+	addOverlay(m1)
+	addUnderlay(m1)
+	addBGP(m1)
+	addRemoteOverlay(m1)
+
+	m2 := newTestManager(netlink.FAMILY_V4)
+	addRemoteOverlay(m2)
+	addBGP(m2)
+	addUnderlay(m2)
+	addOverlay(m2)
+
+	newRule := func(src *net.IPNet, table, priority int, tos uint) netlink.Rule {
+		rule := m1.newFromPodSubnetRule(src, table, priority, tos)
+		return *rule
+	}
+	basicRule := func(table, priority, mark, mask int) netlink.Rule {
+		rule := m1.newBasicRule(table, mark, mask)
+		rule.Priority = priority
+		return *rule
+	}
+
+	env := newTestExportEnv([]netlink.Rule{
+		basicRule(39999, 1000, 0, 0),
+		basicRule(40000, 1001, 0, 0),
+		basicRule(40001, 1002, 0x20, 0x20),
+		newRule(underlayCidr, 10002, 1996, dscpToTos(46)),
+		newRule(bgpCidr, 10003, 1997, 0),
+		newRule(underlayCidr, 10001, 1998, 0),
+		newRule(overlayCidr, 10000, 1999, 0),
+	}, map[string]int{"eth0.vxlan4": 3, "eth0.100": 4, "eth1": 5}, net.ParseIP("192.168.1.2"))
+
+	export := func(m *Manager) string {
+		state := &ExportedState{Family: m.family}
+		var err error
+		if state.Rules, state.Tables, err = m.exportRulesAndTables(env); err != nil {
+			t.Fatalf("failed to export: %v", err)
+		}
+		return FormatIPRoute(state)
+	}
+
+	text1, text2 := export(m1), export(m2)
+	if text1 != text2 {
+		t.Fatalf("expect the same export result, got:\n%s\nand:\n%s", text1, text2)
+	}
+
+	fromRuleMarkText := formatIPRouteMark(fromRuleMark, DefaultFromRuleMask)
+	expected := fmt.Sprintf(`# ip -4 rule show
+1000:	from all lookup 39999
+1001:	from all lookup 40000
+1002:	from all fwmark 0x20/0x20 lookup 40001
+1996:	from 192.168.1.0/24 tos 0xb8 fwmark %[1]s lookup 10002
+1997:	from 172.16.0.0/24 fwmark %[1]s lookup 10003
+1998:	from 192.168.1.0/24 fwmark %[1]s lookup 10001
+1999:	from 10.0.0.0/24 fwmark %[1]s lookup 10000
+# ip -4 route show table 10000
+throw 10.10.0.1
+172.16.0.0/24 dev eth0.vxlan4
+192.168.1.0/24 dev eth0.vxlan4
+throw 192.168.1.0/31
+throw 192.168.1.255
+# ip -4 route show table 10001
+default via 192.168.1.1 dev eth0.100
+192.168.1.0/24 dev eth0.100 scope link src 192.168.1.2
+# ip -4 route show table 10002
+default via 192.168.1.254 dev eth0.100
+192.168.1.0/24 dev eth0.100 scope link
+# ip -4 route show table 10003
+default src 10.10.0.100
+	nexthop via 10.10.0.2 dev eth1 weight 1
+	nexthop via 10.10.0.1 dev eth1 weight 1
+# ip -4 route show table 40000
+10.0.0.0/24 dev eth0.vxlan4
+throw 10.0.0.5
+10.1.0.0/24 dev eth0.vxlan4
+# ip -4 route show table 40001
+default dev eth0.vxlan4
+`, fromRuleMarkText)
+
+	if text1 != expected {
+		t.Errorf("expect:\n%s\nbut got:\n%s", expected, text1)
+	}
+}
+
+func TestFormatIPRouteDstAndMark(t *testing.T) {
+	dstTests := []struct {
+		cidr     string
+		expected string
+	}{
+		{"0.0.0.0/0", "default"},
+		{"::/0", "default"},
+		{"10.0.0.1/32", "10.0.0.1"},
+		{"fd00::1/128", "fd00::1"},
+		{"fd00::/64", "fd00::/64"},
+		{"10.0.0.0/24", "10.0.0.0/24"},
+	}
+
+	for _, test := range dstTests {
+		if dst := formatIPRouteDst(test.cidr); dst != test.expected {
+			t.Errorf("expect destination %v of %v, but got %v", test.expected, test.cidr, dst)
+		}
+	}
+
+	markTests := []struct {
+		mark, mask int
+		expected   string
+	}{
+		{0, 0x4040, "0/0x4040"},
+		{0x20, 0x20, "0x20/0x20"},
+		{0x20, 0xffffffff, "0x20"},
+	}
+
+	for _, test := range markTests {
+		if mark := formatIPRouteMark(test.mark, test.mask); mark != test.expected {
+			t.Errorf("expect mark %v, but got %v", test.expected, mark)
+		}
+	}
+}
+
+func TestFormatIPRouteMetrics(t *testing.T) {
+	testCases := []struct {
+		mtu      int
+		advMSS   int
+		expected string
+	}{
+		{0, 0, ""},
+		{1400, 0, "mtu 1400"},
+		{0, 1360, "advmss 1360"},
+		{1400, 1360, "mtu 1400 advmss 1360"},
+	}
+
+	for _, tc := range testCases {
+		if result := formatIPRouteMetrics(tc.mtu, tc.advMSS); result != tc.expected {
+			t.Errorf("expect %q for mtu %v and advmss %v, but got %q", tc.expected, tc.mtu, tc.advMSS, result)
+		}
+	}
+}
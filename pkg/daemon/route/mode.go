@@ -0,0 +1,50 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+// SetDefaultNetworkMode sets the network mode to program subnets whose mode is empty with, e.g., while
+// configurations are being migrated. An empty default mode keeps the strict behavior which fails the sync.
+func (m *Manager) SetDefaultNetworkMode(mode networkingv1.NetworkMode) {
+	m.defaultNetworkMode = mode
+}
+
+// defaultedNetworkMode returns the network mode to record subnet with, the default network mode is used
+// if the mode of subnet is empty. It is resolved once when subnet info is added.
+func (m *Manager) defaultedNetworkMode(cidr *net.IPNet, mode networkingv1.NetworkMode) networkingv1.NetworkMode {
+	if mode != "" || m.defaultNetworkMode == "" {
+		return mode
+	}
+
+	m.syncLogger.Info("empty-network-mode/"+cidr.String(),
+		"network mode of subnet is empty, program it with the default network mode",
+		"subnet", cidr.String(), "defaultMode", m.defaultNetworkMode)
+	return m.defaultNetworkMode
+}
+
+// checkNetworkMode checks if subnet has a network mode to be programmed with.
+func checkNetworkMode(cidr *net.IPNet, mode networkingv1.NetworkMode) error {
+	if mode == "" {
+		return newPermanentError("network mode of subnet %v is empty", cidr)
+	}
+	return nil
+}
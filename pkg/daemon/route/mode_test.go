@@ -0,0 +1,97 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestAddSubnetInfoWithDefaultNetworkMode(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.1.0/24")
+
+	tests := []struct {
+		name          string
+		defaultMode   networkingv1.NetworkMode
+		mode          networkingv1.NetworkMode
+		expectedMode  networkingv1.NetworkMode
+		expectedError bool
+	}{
+		{
+			name:         "mode of subnet is kept",
+			defaultMode:  networkingv1.NetworkModeVlan,
+			mode:         networkingv1.NetworkModeBGP,
+			expectedMode: networkingv1.NetworkModeBGP,
+		},
+		{
+			name:         "empty mode uses the default mode",
+			defaultMode:  networkingv1.NetworkModeVlan,
+			mode:         "",
+			expectedMode: networkingv1.NetworkModeVlan,
+		},
+		{
+			name:          "empty mode fails without default mode",
+			defaultMode:   "",
+			mode:          "",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestManager(netlink.FAMILY_V4)
+			m.SetDefaultNetworkMode(test.defaultMode)
+			m.AddSubnetInfo(cidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0.100", false, false, true, test.mode)
+
+			info := m.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(cidr)]
+			err := checkNetworkMode(cidr, info.mode)
+			if test.expectedError {
+				if err == nil || !IsPermanentError(err) {
+					t.Fatalf("expect a permanent error, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if info.mode != test.expectedMode {
+				t.Errorf("expect mode %v, got %v", test.expectedMode, info.mode)
+			}
+		})
+	}
+}
+
+func TestDSCPGatewaysOfEmptyModeSubnetWithDefaultMode(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.1.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.SetDefaultNetworkMode(networkingv1.NetworkModeVlan)
+	m.AddSubnetInfo(cidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0.100", false, false, true, "")
+
+	// dscp gateways only work for vlan subnets, the empty mode subnet is programmed as a vlan one
+	m.SetSubnetDSCPGateways(cidr, map[uint8]net.IP{46: net.ParseIP("192.168.1.254")})
+
+	info := m.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(cidr)]
+	if len(info.dscpGateways) != 1 {
+		t.Errorf("expect dscp gateways to be set for subnet in default vlan mode, got %v", info.dscpGateways)
+	}
+}
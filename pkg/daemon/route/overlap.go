@@ -0,0 +1,175 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/alibaba/hybridnet/pkg/metrics"
+)
+
+// subnetOverlap is a pair of overlapped local subnets, pod ips in both of them belong to the specific one.
+type subnetOverlap struct {
+	specific *net.IPNet
+	broader  *net.IPNet
+}
+
+// reportOverlappedSubnets reports the overlapped local subnets steered by from-pod-subnet rules, with which the
+// pod ips are ambiguous and steered by the rules of most specific subnets. Underlay subnets not on this host
+// have no rules and are ignored.
+func (m *Manager) reportOverlappedSubnets() []subnetOverlap {
+	overlaps := findOverlappedSubnets(m.ruleSteeredSubnetInfoMap())
+	for _, overlap := range overlaps {
+		m.syncLogger.Info("overlapped-subnets/"+overlap.specific.String()+"/"+overlap.broader.String(),
+			"local subnets overlap, pod ips in both of them are steered by the most specific one",
+			"specific", overlap.specific.String(), "broader", overlap.broader.String())
+	}
+
+	metrics.OverlappedSubnetGauge.WithLabelValues(ipFamilyLabel(m.family)).Set(float64(len(overlaps)))
+	return overlaps
+}
+
+// ruleSteeredSubnetInfoMap returns the local subnets which have from-pod-subnet rules on this node.
+func (m *Manager) ruleSteeredSubnetInfoMap() SubnetInfoMap {
+	infoMap := SubnetInfoMap{}
+	for cidr, info := range m.localClusterOverlaySubnetInfoMap {
+		infoMap[cidr] = info
+	}
+	for cidr, info := range m.localClusterUnderlaySubnetInfoMap {
+		if info.isUnderlayOnHost {
+			infoMap[cidr] = info
+		}
+	}
+	return infoMap
+}
+
+// repairOverlappedRulePriorities keeps the from-pod-subnet rules of overlapped subnets ordered by specificity. The
+// rule of a more specific subnet added in a later sync is appended after the ones of broader subnets, so the
+// priorities of all the overlapped rules are reassigned among themselves.
+func (m *Manager) repairOverlappedRulePriorities(overlaps []subnetOverlap) error {
+	if len(overlaps) == 0 {
+		return nil
+	}
+
+	ruleList, err := netlink.RuleList(m.family)
+	if err != nil {
+		return fmt.Errorf("failed to list rules: %v", err)
+	}
+
+	toAdd, toDel := planOverlappedRulePriorities(ruleList, overlaps, m.tableRange)
+
+	// add the reordered rules before deleting the previous ones to avoid traffic falling through
+	for _, rule := range toAdd {
+		rule.Family = m.family
+		if err := netlink.RuleAdd(&rule); err != nil {
+			return fmt.Errorf("failed to add reordered policy rule %v: %v", rule.String(), err)
+		}
+	}
+
+	for _, rule := range toDel {
+		rule.Family = m.family
+		if err := netlink.RuleDel(&rule); err != nil {
+			return fmt.Errorf("failed to delete misordered policy rule %v: %v", rule.String(), err)
+		}
+	}
+	return nil
+}
+
+// planOverlappedRulePriorities reassigns the priorities of from-pod-subnet rules of overlapped subnets, the most
+// specific subnet takes the highest priority among them. Rules whose priority changes are returned to be re-added
+// with the new priority and deleted with the previous one, dscp rules are left untouched.
+func planOverlappedRulePriorities(ruleList []netlink.Rule, overlaps []subnetOverlap,
+	tableRange TableRange) (toAdd, toDel []netlink.Rule) {
+	overlappedSubnetMap := map[string]bool{}
+	for _, overlap := range overlaps {
+		overlappedSubnetMap[CanonicalCIDRKey(overlap.specific)] = true
+		overlappedSubnetMap[CanonicalCIDRKey(overlap.broader)] = true
+	}
+
+	var rules []netlink.Rule
+	var priorities []int
+	for _, rule := range ruleList {
+		if rule.Tos != 0 || !checkIsFromPodSubnetRule(rule, tableRange) ||
+			!overlappedSubnetMap[CanonicalCIDRKey(rule.Src)] {
+			continue
+		}
+		rules = append(rules, rule)
+		priorities = append(priorities, realRulePriority(rule.Priority))
+	}
+
+	sort.Ints(priorities)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return moreSpecificSubnet(rules[i].Src, rules[j].Src)
+	})
+
+	for index, rule := range rules {
+		if realRulePriority(rule.Priority) == priorities[index] {
+			continue
+		}
+
+		toDel = append(toDel, rule)
+		rule.Priority = priorities[index]
+		toAdd = append(toAdd, rule)
+	}
+	return
+}
+
+// findOverlappedSubnets returns all the overlapped subnet pairs in a deterministic order.
+func findOverlappedSubnets(infoMap SubnetInfoMap) []subnetOverlap {
+	infos := sortSubnetInfosBySpecificity(infoMap)
+
+	var overlaps []subnetOverlap
+	for i := range infos {
+		for j := i + 1; j < len(infos); j++ {
+			// the broader one contains the network address of the more specific one if they overlap
+			if infos[j].cidr.Contains(infos[i].cidr.IP) {
+				overlaps = append(overlaps, subnetOverlap{
+					specific: infos[i].cidr,
+					broader:  infos[j].cidr,
+				})
+			}
+		}
+	}
+	return overlaps
+}
+
+// sortSubnetInfosBySpecificity returns the subnet infos with the most specific first, subnets of the same
+// prefix length are sorted by cidr.
+func sortSubnetInfosBySpecificity(infoMap SubnetInfoMap) []*SubnetInfo {
+	infos := make([]*SubnetInfo, 0, len(infoMap))
+	for _, info := range infoMap {
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return moreSpecificSubnet(infos[i].cidr, infos[j].cidr)
+	})
+	return infos
+}
+
+func moreSpecificSubnet(a, b *net.IPNet) bool {
+	aOnes, _ := a.Mask.Size()
+	bOnes, _ := b.Mask.Size()
+	if aOnes != bOnes {
+		return aOnes > bOnes
+	}
+	return a.String() < b.String()
+}
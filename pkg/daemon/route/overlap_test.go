@@ -0,0 +1,125 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestOverlappedSubnets(t *testing.T) {
+	_, broaderCidr, _ := net.ParseCIDR("10.0.0.0/16")
+	_, specificCidr, _ := net.ParseCIDR("10.0.1.0/24")
+	_, otherCidr, _ := net.ParseCIDR("10.1.0.0/24")
+	_, notOnHostCidr, _ := net.ParseCIDR("10.0.2.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	for _, cidr := range []*net.IPNet{broaderCidr, specificCidr, otherCidr} {
+		m.AddSubnetInfo(cidr, nil, nil, nil, nil, "eth0.vxlan4", true, true, true,
+			networkingv1.NetworkModeVxlan)
+	}
+	// underlay subnet not on this host has no rule, overlapping with it is not reported
+	m.AddSubnetInfo(notOnHostCidr, net.ParseIP("10.0.2.1"), nil, nil, nil, "eth0", false, false, false,
+		networkingv1.NetworkModeVlan)
+
+	overlaps := findOverlappedSubnets(m.ruleSteeredSubnetInfoMap())
+	if len(overlaps) != 1 || overlaps[0].specific.String() != specificCidr.String() ||
+		overlaps[0].broader.String() != broaderCidr.String() {
+		t.Fatalf("expect only %v to overlap with %v, but got %+v", specificCidr, broaderCidr, overlaps)
+	}
+
+	// the most specific subnet is used for pod ips in both subnets, and its rule is appended first
+	m.publishSubnetInfos()
+	info, found := m.FindSubnetInfoByIP(net.ParseIP("10.0.1.10"))
+	if !found || info.CIDR().String() != specificCidr.String() {
+		t.Errorf("expect pod ip to belong to %v, but got %v", specificCidr, info)
+	}
+
+	var sorted []string
+	for _, info := range sortSubnetInfosBySpecificity(m.localClusterOverlaySubnetInfoMap) {
+		sorted = append(sorted, info.CIDR().String())
+	}
+	expected := []string{specificCidr.String(), otherCidr.String(), broaderCidr.String()}
+	for i := range expected {
+		if i >= len(sorted) || sorted[i] != expected[i] {
+			t.Fatalf("expect subnets to be sorted as %v, but got %v", expected, sorted)
+		}
+	}
+}
+
+func TestPlanOverlappedRulePriorities(t *testing.T) {
+	_, broaderCidr, _ := net.ParseCIDR("10.0.0.0/16")
+	_, specificCidr, _ := net.ParseCIDR("10.0.1.0/24")
+	_, otherCidr, _ := net.ParseCIDR("10.1.0.0/24")
+
+	newFromRule := func(src *net.IPNet, table, priority, tos int) netlink.Rule {
+		rule := netlink.NewRule()
+		rule.Src = src
+		rule.Table = table
+		rule.Priority = priority
+		rule.Tos = uint(tos)
+		rule.Mask = DefaultFromRuleMask
+		return *rule
+	}
+
+	overlaps := []subnetOverlap{{specific: specificCidr, broader: broaderCidr}}
+
+	testCases := []struct {
+		name     string
+		ruleList []netlink.Rule
+		toAdd    map[string]int
+	}{
+		{
+			"rules in order",
+			[]netlink.Rule{
+				newFromRule(specificCidr, 10001, 101, 0),
+				newFromRule(broaderCidr, 10002, 102, 0),
+			},
+			map[string]int{},
+		},
+		{
+			"specific rule appended in a later sync",
+			[]netlink.Rule{
+				newFromRule(broaderCidr, 10002, 101, 0),
+				newFromRule(otherCidr, 10003, 102, 0),
+				newFromRule(specificCidr, 10001, 103, 0),
+				// dscp rule is not reordered
+				newFromRule(broaderCidr, 10004, 104, 184),
+			},
+			map[string]int{specificCidr.String(): 101, broaderCidr.String(): 103},
+		},
+	}
+
+	for _, test := range testCases {
+		toAdd, toDel := planOverlappedRulePriorities(test.ruleList, overlaps, DefaultTableRange)
+		if len(toAdd) != len(test.toAdd) || len(toDel) != len(test.toAdd) {
+			t.Errorf("%s: expect %v rules to be reordered, but got %v to add and %v to delete",
+				test.name, len(test.toAdd), toAdd, toDel)
+			continue
+		}
+
+		for _, rule := range toAdd {
+			if priority, exist := test.toAdd[rule.Src.String()]; !exist || priority != rule.Priority {
+				t.Errorf("%s: unexpected reordered rule %v", test.name, rule.String())
+			}
+		}
+	}
+}
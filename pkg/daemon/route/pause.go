@@ -0,0 +1,58 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+// Pause freezes route programming of manager, SyncRoutes will skip all the netlink mutations until Resume
+// is called, while subnet infos are still recorded as desired state.
+func (m *Manager) Pause() {
+	if !m.paused {
+		m.logger.Info("route reconciliation paused")
+	}
+	m.paused = true
+	m.setReadinessPaused(true)
+}
+
+// Resume unfreezes route programming of manager, it returns true if any sync has been skipped while paused,
+// which means a full reconciliation is needed to converge to the desired state.
+func (m *Manager) Resume() bool {
+	if m.paused {
+		m.logger.Info("route reconciliation resumed", "syncSkipped", m.syncSkippedWhilePaused)
+	}
+
+	needSync := m.syncSkippedWhilePaused
+	m.paused = false
+	m.syncSkippedWhilePaused = false
+	m.setReadinessPaused(false)
+	return needSync
+}
+
+// IsPaused returns if route programming of manager is paused.
+func (m *Manager) IsPaused() bool {
+	return m.paused
+}
+
+// skipSyncIfPaused records the skipped sync and returns true if manager is paused.
+func (m *Manager) skipSyncIfPaused() bool {
+	if !m.paused {
+		return false
+	}
+
+	m.syncLogger.Info("sync-paused", "route reconciliation is paused, skip syncing routes",
+		"desiredLocalSubnets", len(m.localTotalSubnetInfoMap))
+	m.syncSkippedWhilePaused = true
+	return true
+}
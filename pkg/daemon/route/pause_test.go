@@ -0,0 +1,69 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestPauseAndResume(t *testing.T) {
+	// invalid table nums make any netlink mutation fail, so a nil error means nothing is programmed
+	manager := newTestManager(netlink.FAMILY_V4)
+	manager.localDirectTableNum = -1
+	manager.toOverlaySubnetTableNum = -1
+	manager.overlayMarkTableNum = -1
+
+	if manager.Resume() {
+		t.Fatalf("resume an unpaused manager should not need a sync")
+	}
+
+	manager.Pause()
+	if !manager.IsPaused() {
+		t.Fatalf("manager is expected to be paused")
+	}
+
+	_, cidr, _ := net.ParseCIDR("192.168.0.0/24")
+	manager.ResetInfos()
+	manager.AddSubnetInfo(cidr, net.ParseIP("192.168.0.1"), nil, nil, nil, "eth0.10",
+		false, false, true, networkingv1.NetworkModeVlan)
+
+	if err := manager.SyncRoutes(); err != nil {
+		t.Fatalf("sync routes while paused should be a no-op, but got error: %v", err)
+	}
+
+	if _, exist := manager.localTotalSubnetInfoMap[CanonicalCIDRKey(cidr)]; !exist {
+		t.Fatalf("desired subnet info should be kept while paused")
+	}
+
+	if !manager.Resume() {
+		t.Fatalf("resume after skipped sync should need a sync")
+	}
+	if manager.IsPaused() {
+		t.Fatalf("manager is expected to be resumed")
+	}
+	if manager.Resume() {
+		t.Fatalf("skipped sync should be only reported once")
+	}
+	if manager.skipSyncIfPaused() {
+		t.Fatalf("sync should not be skipped after resumed")
+	}
+}
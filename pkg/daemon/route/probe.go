@@ -0,0 +1,126 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// gatewayProbeTarget is the gateway of an underlay subnet to be probed.
+type gatewayProbeTarget struct {
+	cidr              string
+	subnetCidr        *net.IPNet
+	forwardNodeIfName string
+	gateway           net.IP
+}
+
+// StartAsyncGatewayProbe makes the gateway reachability probe run in a background goroutine, route sync will
+// only request a probe of the latest underlay subnets without waiting for it. The goroutine exits once ctx is done.
+// It should be called before any route manager syncs.
+func (m *Manager) StartAsyncGatewayProbe(ctx context.Context) {
+	// only the latest request matters, a pending one will be replaced
+	m.gatewayProbeCh = make(chan []gatewayProbeTarget, 1)
+
+	go func() {
+		for {
+			select {
+			case targets := <-m.gatewayProbeCh:
+				m.probeGatewayTargets(targets)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// requestGatewayProbe hands the targets over to the background probe goroutine without blocking.
+func (m *Manager) requestGatewayProbe(targets []gatewayProbeTarget) {
+	select {
+	case m.gatewayProbeCh <- targets:
+	default:
+		// drop the pending request, sync is the only sender so there is room afterwards
+		select {
+		case <-m.gatewayProbeCh:
+		default:
+		}
+		m.gatewayProbeCh <- targets
+	}
+}
+
+// probeGatewayTargets probes gateways of the targets, the probe is advisory, so any failure is only recorded as
+// the gateway being unreachable.
+func (m *Manager) probeGatewayTargets(targets []gatewayProbeTarget) {
+	unreachableGatewayMap := map[string]error{}
+	for _, target := range targets {
+		if err := m.probeGateway(target); err != nil {
+			unreachableGatewayMap[target.cidr] = err
+		}
+	}
+	m.setUnreachableGateways(unreachableGatewayMap)
+}
+
+func (m *Manager) collectGatewayProbeTargets() []gatewayProbeTarget {
+	var targets []gatewayProbeTarget
+	for cidrString, info := range m.localClusterUnderlaySubnetInfoMap {
+		if !info.isUnderlayOnHost || info.gateway == nil {
+			continue
+		}
+
+		targets = append(targets, gatewayProbeTarget{
+			cidr:              cidrString,
+			subnetCidr:        info.cidr,
+			forwardNodeIfName: info.forwardNodeIfName,
+			gateway:           info.gateway,
+		})
+	}
+	return targets
+}
+
+func (m *Manager) setUnreachableGateways(unreachableGatewayMap map[string]error) {
+	m.gatewayProbeMutex.Lock()
+	defer m.gatewayProbeMutex.Unlock()
+
+	m.unreachableGatewayMap = unreachableGatewayMap
+}
+
+// probeGatewayTarget is the default gateway probe, the gateway is looked up within the route table of subnet as
+// pod traffic is. A missing forward interface or subnet rule makes the gateway unreachable.
+func probeGatewayTarget(target gatewayProbeTarget, family int) error {
+	forwardLink, err := netlink.LinkByName(target.forwardNodeIfName)
+	if err != nil {
+		return fmt.Errorf("failed to get forward link %v: %v", target.forwardNodeIfName, err)
+	}
+
+	exist, rule, err := checkIfRuleExist(target.subnetCidr, -1, family)
+	if err != nil {
+		return fmt.Errorf("failed to check from pod subnet rule of %v: %v", target.cidr, err)
+	}
+	if !exist {
+		return fmt.Errorf("gateway %v is unreachable, from pod subnet rule of %v is not found", target.gateway, target.cidr)
+	}
+
+	tableRoutes, err := listRoutesByTable(rule.Table, family)
+	if err != nil {
+		return fmt.Errorf("failed to list routes of table %v: %v", rule.Table, err)
+	}
+
+	return probeGatewayReachability(forwardLink, target.gateway, tableRoutes, family)
+}
@@ -0,0 +1,213 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestAsyncGatewayProbe(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.1.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.localClusterUnderlaySubnetInfoMap[cidr.String()] = &SubnetInfo{
+		cidr:              cidr,
+		gateway:           net.ParseIP("192.168.1.1"),
+		forwardNodeIfName: "eth0.10",
+		isUnderlayOnHost:  true,
+	}
+
+	probeStarted := make(chan struct{}, 1)
+	probeReleased := make(chan struct{})
+	m.probeGateway = func(target gatewayProbeTarget) error {
+		probeStarted <- struct{}{}
+		<-probeReleased
+		return fmt.Errorf("gateway %v is unreachable", target.gateway)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.StartAsyncGatewayProbe(ctx)
+
+	requested := make(chan struct{})
+	go func() {
+		// the second request comes while the first probe is still running
+		m.requestGatewayProbe(m.collectGatewayProbeTargets())
+		<-probeStarted
+		m.requestGatewayProbe(m.collectGatewayProbeTargets())
+		close(requested)
+	}()
+
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expect requesting gateway probe not to wait for the probe")
+	}
+	if len(m.GetUnreachableGateways()) != 0 {
+		t.Fatalf("expect no probe result before probe finishes")
+	}
+
+	close(probeReleased)
+	deadline := time.After(5 * time.Second)
+	for len(m.GetUnreachableGateways()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatalf("expect probe result to be populated eventually")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if err := m.GetUnreachableGateways()[cidr.String()]; err == nil {
+		t.Errorf("expect gateway of subnet %v to be unreachable", cidr)
+	}
+}
+
+func TestProbeGatewayTargetsIsAdvisory(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.1.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.localClusterUnderlaySubnetInfoMap[cidr.String()] = &SubnetInfo{
+		cidr:              cidr,
+		gateway:           net.ParseIP("192.168.1.1"),
+		forwardNodeIfName: "not-exist",
+		isUnderlayOnHost:  true,
+	}
+	m.probeGateway = func(target gatewayProbeTarget) error {
+		return fmt.Errorf("failed to get forward link %v", target.forwardNodeIfName)
+	}
+
+	m.probeGatewayTargets(m.collectGatewayProbeTargets())
+
+	if err := m.GetUnreachableGateways()[cidr.String()]; err == nil {
+		t.Errorf("expect probe failure of subnet %v to be recorded as unreachable gateway", cidr)
+	}
+}
+
+func TestLookupDirectRouteLinkIndex(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	_, host, _ := net.ParseCIDR("192.168.1.1/32")
+
+	testCases := []struct {
+		name          string
+		routes        []netlink.Route
+		ip            string
+		expectedIndex int
+		expectedFound bool
+	}{
+		{
+			name: "direct subnet route",
+			routes: []netlink.Route{
+				{Dst: subnet, LinkIndex: 3, Type: unix.RTN_UNICAST, Scope: netlink.SCOPE_LINK},
+				{Dst: nil, LinkIndex: 3, Gw: net.ParseIP("192.168.1.1"), Type: unix.RTN_UNICAST},
+			},
+			ip:            "192.168.1.1",
+			expectedIndex: 3,
+			expectedFound: true,
+		},
+		{
+			name: "longest prefix wins",
+			routes: []netlink.Route{
+				{Dst: subnet, LinkIndex: 3, Scope: netlink.SCOPE_LINK},
+				{Dst: host, LinkIndex: 4, Scope: netlink.SCOPE_LINK},
+			},
+			ip:            "192.168.1.1",
+			expectedIndex: 4,
+			expectedFound: true,
+		},
+		{
+			name: "only default route through gateway",
+			routes: []netlink.Route{
+				{Dst: nil, LinkIndex: 3, Gw: net.ParseIP("10.0.0.1")},
+			},
+			ip:            "192.168.1.1",
+			expectedFound: false,
+		},
+		{
+			name: "throw route",
+			routes: []netlink.Route{
+				{Dst: subnet, Type: unix.RTN_THROW},
+			},
+			ip:            "192.168.1.1",
+			expectedFound: false,
+		},
+		{
+			name:          "empty table",
+			ip:            "192.168.1.1",
+			expectedFound: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			index, found := lookupDirectRouteLinkIndex(testCase.routes, net.ParseIP(testCase.ip))
+			if found != testCase.expectedFound || index != testCase.expectedIndex {
+				t.Errorf("expect (%v, %v), got (%v, %v)", testCase.expectedIndex, testCase.expectedFound, index, found)
+			}
+		})
+	}
+}
+
+func TestCheckNeighResolved(t *testing.T) {
+	gateway := net.ParseIP("192.168.1.1")
+
+	testCases := []struct {
+		name     string
+		neighs   []netlink.Neigh
+		expected bool
+	}{
+		{
+			name:     "reachable",
+			neighs:   []netlink.Neigh{{IP: gateway, State: netlink.NUD_REACHABLE}},
+			expected: true,
+		},
+		{
+			name:     "stale",
+			neighs:   []netlink.Neigh{{IP: gateway, State: netlink.NUD_STALE}},
+			expected: true,
+		},
+		{
+			name:     "incomplete",
+			neighs:   []netlink.Neigh{{IP: gateway, State: netlink.NUD_INCOMPLETE}},
+			expected: false,
+		},
+		{
+			name:     "failed",
+			neighs:   []netlink.Neigh{{IP: gateway, State: netlink.NUD_FAILED}},
+			expected: false,
+		},
+		{
+			name:     "missing",
+			neighs:   []netlink.Neigh{{IP: net.ParseIP("192.168.1.2"), State: netlink.NUD_FAILED}},
+			expected: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if resolved := checkNeighResolved(testCase.neighs, gateway); resolved != testCase.expected {
+				t.Errorf("expect resolved %v, got %v", testCase.expected, resolved)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// every message key is allowed to be logged defaultLogBurst times at once, and once more every
+	// defaultLogRefillInterval after that
+	defaultLogBurst          = 3
+	defaultLogRefillInterval = time.Minute
+
+	// buckets which are full and have nothing suppressed will be pruned if there are more keys than this
+	maxLogBucketNum = 1024
+)
+
+// rateLimitedLogger coalesces the repeated identical logs in route sync loops, every message key has its own
+// token bucket so distinct messages never suppress each other. The count of logs suppressed since the last
+// emitted one of a key is attached to the next emitted one as "suppressed".
+type rateLimitedLogger struct {
+	logger logr.Logger
+
+	burst          int
+	refillInterval time.Duration
+	now            func() time.Time
+
+	mutex   sync.Mutex
+	buckets map[string]*logBucket
+}
+
+type logBucket struct {
+	tokens     int
+	lastRefill time.Time
+	suppressed int
+}
+
+func newRateLimitedLogger(logger logr.Logger, burst int, refillInterval time.Duration) *rateLimitedLogger {
+	return &rateLimitedLogger{
+		logger:         logger,
+		burst:          burst,
+		refillInterval: refillInterval,
+		now:            time.Now,
+		buckets:        map[string]*logBucket{},
+	}
+}
+
+// Info logs a non-error message if the message key is not rate limited.
+func (r *rateLimitedLogger) Info(key, msg string, keysAndValues ...interface{}) {
+	if r == nil {
+		return
+	}
+
+	if allowed, suppressed := r.allow(key); allowed {
+		r.logger.Info(msg, appendSuppressed(keysAndValues, suppressed)...)
+	}
+}
+
+// Error logs an error message if the message key is not rate limited.
+func (r *rateLimitedLogger) Error(key string, err error, msg string, keysAndValues ...interface{}) {
+	if r == nil {
+		return
+	}
+
+	if allowed, suppressed := r.allow(key); allowed {
+		r.logger.Error(err, msg, appendSuppressed(keysAndValues, suppressed)...)
+	}
+}
+
+// allow takes a token of key, it returns false if no token is left, or true and the count of logs suppressed
+// since the last allowed one.
+func (r *rateLimitedLogger) allow(key string) (bool, int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.now()
+	bucket, exist := r.buckets[key]
+	if !exist {
+		if len(r.buckets) >= maxLogBucketNum {
+			r.pruneBuckets(now)
+		}
+		bucket = &logBucket{tokens: r.burst, lastRefill: now}
+		r.buckets[key] = bucket
+	}
+
+	r.refill(bucket, now)
+	if bucket.tokens == 0 {
+		bucket.suppressed++
+		return false, 0
+	}
+
+	bucket.tokens--
+	suppressed := bucket.suppressed
+	bucket.suppressed = 0
+	return true, suppressed
+}
+
+func (r *rateLimitedLogger) refill(bucket *logBucket, now time.Time) {
+	if r.refillInterval <= 0 {
+		bucket.tokens = r.burst
+		return
+	}
+
+	refilled := int(now.Sub(bucket.lastRefill) / r.refillInterval)
+	if refilled <= 0 {
+		return
+	}
+
+	bucket.lastRefill = bucket.lastRefill.Add(time.Duration(refilled) * r.refillInterval)
+	if bucket.tokens += refilled; bucket.tokens >= r.burst {
+		bucket.tokens = r.burst
+		bucket.lastRefill = now
+	}
+}
+
+// pruneBuckets removes the buckets which are the same as newly created ones.
+func (r *rateLimitedLogger) pruneBuckets(now time.Time) {
+	for key, bucket := range r.buckets {
+		r.refill(bucket, now)
+		if bucket.tokens == r.burst && bucket.suppressed == 0 {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+func appendSuppressed(keysAndValues []interface{}, suppressed int) []interface{} {
+	if suppressed == 0 {
+		return keysAndValues
+	}
+	return append(keysAndValues, "suppressed", suppressed)
+}
@@ -0,0 +1,88 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+)
+
+func TestRateLimitedLogger(t *testing.T) {
+	var logs []string
+	r := newRateLimitedLogger(funcr.New(func(prefix, args string) {
+		logs = append(logs, args)
+	}, funcr.Options{}), 3, time.Minute)
+
+	now := time.Unix(0, 0)
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < 100; i++ {
+		r.Info("same", "same message", "iteration", i)
+	}
+	if len(logs) != 3 {
+		t.Fatalf("expect 100 identical logs to be coalesced into 3 lines, but got %v", len(logs))
+	}
+
+	r.Error("distinct", fmt.Errorf("device busy"), "distinct message")
+	if len(logs) != 4 || !strings.Contains(logs[3], "distinct message") {
+		t.Fatalf("expect distinct log not to be suppressed, but got %v", logs)
+	}
+
+	now = now.Add(time.Minute)
+	r.Info("same", "same message")
+	r.Info("same", "same message")
+	if len(logs) != 5 {
+		t.Fatalf("expect only one log after one token is refilled, but got %v", len(logs))
+	}
+	if !strings.Contains(logs[4], `"suppressed"=97`) {
+		t.Errorf("expect suppressed count to be attached, but got %v", logs[4])
+	}
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 5; i++ {
+		r.Info("same", "same message")
+	}
+	if len(logs) != 8 {
+		t.Errorf("expect refilled tokens to be capped by burst, but got %v lines", len(logs))
+	}
+}
+
+func TestRateLimitedLoggerPruneBuckets(t *testing.T) {
+	r := newRateLimitedLogger(funcr.New(func(prefix, args string) {}, funcr.Options{}), 1, time.Minute)
+
+	now := time.Unix(0, 0)
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < maxLogBucketNum; i++ {
+		r.Info(fmt.Sprintf("key-%d", i), "message")
+	}
+	r.Info("key-0", "message")
+
+	now = now.Add(time.Minute)
+	r.Info("new", "message")
+
+	if _, exist := r.buckets["key-0"]; !exist {
+		t.Errorf("expect bucket with suppressed logs to be kept")
+	}
+	if len(r.buckets) != 2 {
+		t.Errorf("expect idle buckets to be pruned, but got %v buckets", len(r.buckets))
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"time"
+)
+
+// SetReadinessStaleWindow sets how long routes are taken as up-to-date after the last successful sync, zero means
+// routes never get stale.
+func (m *Manager) SetReadinessStaleWindow(window time.Duration) {
+	m.readinessMutex.Lock()
+	defer m.readinessMutex.Unlock()
+	m.readinessStaleWindow = window
+}
+
+// ReadinessStaleWindow returns how long routes are taken as up-to-date after the last successful sync.
+func (m *Manager) ReadinessStaleWindow() time.Duration {
+	m.readinessMutex.Lock()
+	defer m.readinessMutex.Unlock()
+	return m.readinessStaleWindow
+}
+
+// CheckReadiness returns nil if routes are ready, which means the initial route sync has succeeded, the last sync
+// didn't fail permanently and the last successful sync is within the stale window. Routes never get stale while
+// manager is paused, since no sync is supposed to happen. It is safe to be called concurrently with SyncRoutes,
+// e.g., by health probes.
+//
+// Warm-up is done in the first route sync, so it is covered by the initial route sync.
+func (m *Manager) CheckReadiness(now time.Time) error {
+	m.readinessMutex.Lock()
+	defer m.readinessMutex.Unlock()
+
+	if m.lastSyncSuccessTime.IsZero() {
+		return fmt.Errorf("routes have never been synced successfully")
+	}
+
+	if IsPermanentError(m.lastSyncErr) {
+		return fmt.Errorf("last route sync failed: %v", m.lastSyncErr)
+	}
+
+	if m.readinessStaleWindow > 0 && !m.readinessPaused && now.Sub(m.lastSyncSuccessTime) > m.readinessStaleWindow {
+		return fmt.Errorf("no successful route sync since %v", m.lastSyncSuccessTime.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// setReadinessPaused records if manager is paused for readiness checks.
+func (m *Manager) setReadinessPaused(paused bool) {
+	m.readinessMutex.Lock()
+	defer m.readinessMutex.Unlock()
+	m.readinessPaused = paused
+}
+
+// recordSyncResult records the result of a route sync for readiness checks.
+func (m *Manager) recordSyncResult(err error, now time.Time) {
+	m.readinessMutex.Lock()
+	defer m.readinessMutex.Unlock()
+
+	m.lastSyncErr = err
+	if err == nil {
+		m.lastSyncSuccessTime = now
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestCheckReadiness(t *testing.T) {
+	now := time.Now()
+	m := newTestManager(netlink.FAMILY_V4)
+
+	expectReady := func(step string, at time.Time, ready bool) {
+		t.Helper()
+		if err := m.CheckReadiness(at); (err == nil) != ready {
+			t.Fatalf("%s: expect ready %v, but got error %v", step, ready, err)
+		}
+	}
+
+	expectReady("never synced", now, false)
+
+	m.recordSyncResult(fmt.Errorf("device busy"), now)
+	expectReady("initial sync failed", now, false)
+
+	m.recordSyncResult(nil, now)
+	expectReady("initial sync succeeded", now, true)
+
+	m.recordSyncResult(fmt.Errorf("failed to sync routes: %w", newPermanentError("bad gateway")), now.Add(time.Second))
+	expectReady("sync failed permanently", now.Add(time.Second), false)
+
+	m.recordSyncResult(fmt.Errorf("device busy"), now.Add(2*time.Second))
+	expectReady("sync failed transiently", now.Add(2*time.Second), true)
+
+	// routes never get stale without a stale window
+	expectReady("long after without stale window", now.Add(time.Hour), true)
+
+	m.SetReadinessStaleWindow(time.Minute)
+	expectReady("within stale window", now.Add(time.Minute), true)
+	expectReady("out of stale window", now.Add(time.Minute+time.Second), false)
+
+	m.recordSyncResult(nil, now.Add(2*time.Minute))
+	expectReady("synced again", now.Add(2*time.Minute), true)
+}
+
+func TestSyncRoutesWhilePausedKeepsReadiness(t *testing.T) {
+	m := newTestManager(netlink.FAMILY_V4)
+	m.Pause()
+
+	if err := m.SyncRoutes(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := m.CheckReadiness(time.Now()); err == nil {
+		t.Errorf("expect skipped sync is not taken as a successful one")
+	}
+}
+
+func TestPausedRoutesNeverGetStale(t *testing.T) {
+	now := time.Now()
+	m := newTestManager(netlink.FAMILY_V4)
+	m.SetReadinessStaleWindow(time.Minute)
+	m.recordSyncResult(nil, now)
+
+	m.Pause()
+	if err := m.CheckReadiness(now.Add(time.Hour)); err != nil {
+		t.Errorf("expect paused routes to be ready out of stale window, but got %v", err)
+	}
+
+	m.Resume()
+	if err := m.CheckReadiness(now.Add(time.Hour)); err == nil {
+		t.Errorf("expect resumed routes to be stale until synced again")
+	}
+}
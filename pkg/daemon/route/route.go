@@ -17,13 +17,20 @@
 package route
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
 
 	"github.com/alibaba/hybridnet/pkg/daemon/iptables"
-	daemonutils "github.com/alibaba/hybridnet/pkg/daemon/utils"
+	"github.com/alibaba/hybridnet/pkg/metrics"
+	"github.com/alibaba/hybridnet/pkg/utils"
+	"github.com/go-logr/logr"
 	"github.com/vishvananda/netlink"
 )
 
@@ -61,6 +68,23 @@ type Manager struct {
 	// Use fixed table num to mark "overlay-mark-table rule"
 	overlayMarkTableNum int
 
+	// range of route tables to allocate for subnets
+	tableRange TableRange
+
+	// mask of from-pod-subnet rules, computed from the traffic marks which skip from-pod-subnet rules
+	fromRuleMask int
+
+	// tables which the from-pod-subnet rules of this daemon have pointed to, only they can be reclaimed if
+	// not referenced by any rule, others in table range might be owned by other policy routing daemons
+	ownedTables map[int]bool
+	flushTable  func(table int) error
+
+	// if owned tables have been derived from the rules left by the previous instance
+	ownedTablesSeeded bool
+
+	// if rules and route tables left by the previous instance should be audited before the first sync
+	warmUpPending bool
+
 	// Vxlan interface name.
 	overlayIfName string
 
@@ -70,12 +94,85 @@ type Manager struct {
 	localClusterUnderlaySubnetInfoMap SubnetInfoMap
 	localTotalSubnetInfoMap           SubnetInfoMap
 
+	// local subnet infos of the last sync, which might be looked up by other reconcilers concurrently
+	syncedUnderlaySubnetInfoMap SubnetInfoMap
+	syncedTotalSubnetInfoMap    SubnetInfoMap
+	syncedSubnetInfoMutex       sync.RWMutex
+
 	// add cluster-mesh remote subnet info
 	remoteOverlaySubnetInfoMap  SubnetInfoMap
 	remoteUnderlaySubnetInfoMap SubnetInfoMap
+
+	// if gateways of underlay subnets need to be probed after routes are synced
+	gatewayProbeEnabled bool
+
+	// results of the last gateway probe, which are keyed by subnet cidr
+	unreachableGatewayMap map[string]error
+	gatewayProbeMutex     sync.RWMutex
+
+	// requests to the background probe goroutine, gateways are probed in sync if it is nil
+	gatewayProbeCh chan []gatewayProbeTarget
+	probeGateway   func(target gatewayProbeTarget) error
+
+	// results of route syncs for readiness checks, which might be read by health probes concurrently
+	readinessMutex       sync.Mutex
+	lastSyncSuccessTime  time.Time
+	lastSyncErr          error
+	readinessStaleWindow time.Duration
+	// routes are frozen by design while paused, they never get stale
+	readinessPaused bool
+
+	// base rule priority to allocate from if node local rule is not found
+	rulePriorityFallbackBase int
+
+	// subnets whose exclude ip block route count has been recorded in metrics
+	excludeIPBlockRouteSubnets map[string]bool
+
+	// network modes of the local subnets whose routes have been programmed, which are keyed by subnet cidr
+	subnetModeMap map[string]networkingv1.NetworkMode
+
+	// how long the route table of a removed subnet is kept before being flushed, zero means flushing immediately
+	tableDeleteGracePeriod time.Duration
+
+	// route tables of removed subnets which are waiting to be flushed, which are keyed by subnet cidr
+	pendingDeleteTableMap map[string]*pendingDeleteTable
+
+	// how long the routes of a draining subnet are kept before being removed
+	subnetDrainGracePeriod time.Duration
+
+	// subnets being decommissioned, which are keyed by subnet cidr
+	drainingSubnetMap map[string]*drainingSubnet
+
+	// how long to wait for the missing direct route of a local vlan subnet before installing it, zero means never
+	directRouteInstallGracePeriod time.Duration
+
+	// the first time the direct routes of local vlan subnets are found missing, which are keyed by subnet cidr
+	missingDirectRouteMap map[string]time.Time
+
+	// if compatible subnets share a single route table with their own from-pod-subnet rules
+	routeTableSharingEnabled bool
+
+	// network mode to program subnets whose mode is empty with, empty means failing the sync
+	defaultNetworkMode networkingv1.NetworkMode
+
+	// if route programming is frozen, e.g., during node maintenance
+	paused bool
+
+	// if any sync has been skipped since manager was paused
+	syncSkippedWhilePaused bool
+
+	logger logr.Logger
+
+	// for the logs repeated in every sync, e.g., warnings about a subnet, to be coalesced
+	syncLogger *rateLimitedLogger
 }
 
-func CreateRouteManager(localDirectTableNum, toOverlaySubnetTableNum, overlayMarkTableNum, family int) (*Manager, error) {
+func CreateRouteManager(localDirectTableNum, toOverlaySubnetTableNum, overlayMarkTableNum, family int,
+	tableRange TableRange, logger logr.Logger) (*Manager, error) {
+	if err := tableRange.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid route table range: %v", err)
+	}
+
 	// Check if route tables are being used by others.
 	if empty, err := checkIfRouteTableEmpty(localDirectTableNum, family); err != nil {
 		return nil, fmt.Errorf("failed to check table %v empty: %v", localDirectTableNum, err)
@@ -165,17 +262,70 @@ func CreateRouteManager(localDirectTableNum, toOverlaySubnetTableNum, overlayMar
 		return nil, fmt.Errorf("unsupported family %v", family)
 	}
 
-	return &Manager{
+	m := &Manager{
 		localDirectTableNum:               localDirectTableNum,
 		toOverlaySubnetTableNum:           toOverlaySubnetTableNum,
 		overlayMarkTableNum:               overlayMarkTableNum,
+		tableRange:                        tableRange,
 		family:                            family,
 		localTotalSubnetInfoMap:           SubnetInfoMap{},
 		localClusterOverlaySubnetInfoMap:  SubnetInfoMap{},
 		localClusterUnderlaySubnetInfoMap: SubnetInfoMap{},
 		remoteOverlaySubnetInfoMap:        SubnetInfoMap{},
 		remoteUnderlaySubnetInfoMap:       SubnetInfoMap{},
-	}, nil
+		unreachableGatewayMap:             map[string]error{},
+		subnetModeMap:                     map[string]networkingv1.NetworkMode{},
+		pendingDeleteTableMap:             map[string]*pendingDeleteTable{},
+		drainingSubnetMap:                 map[string]*drainingSubnet{},
+		missingDirectRouteMap:             map[string]time.Time{},
+		rulePriorityFallbackBase:          DefaultRulePriorityFallbackBase,
+		fromRuleMask:                      DefaultFromRuleMask,
+		ownedTables:                       map[int]bool{},
+		logger:                            logger,
+		syncLogger:                        newRateLimitedLogger(logger, defaultLogBurst, defaultLogRefillInterval),
+	}
+	m.probeGateway = func(target gatewayProbeTarget) error {
+		return probeGatewayTarget(target, m.family)
+	}
+	m.flushTable = func(table int) error {
+		return clearRouteTable(table, m.family, isOperatorPinnedRoute)
+	}
+
+	return m, nil
+}
+
+// Family returns the ip family of route manager.
+func (m *Manager) Family() int {
+	return m.family
+}
+
+// SetGatewayProbe enables or disables the gateway reachability probe for underlay subnets.
+// The probe is non-fatal, unreachable gateways will only be recorded.
+func (m *Manager) SetGatewayProbe(enabled bool) {
+	m.gatewayProbeEnabled = enabled
+}
+
+// SetTrafficMarks sets the masquerade mark used by kube-proxy and the mark of full NATed pod traffic, which the
+// mask of from-pod-subnet rules is computed from. Existing rules with a different mask will be repaired in sync.
+func (m *Manager) SetTrafficMarks(kubeProxyMasqueradeMark, fullNATedPodTrafficMark int) {
+	m.fromRuleMask = computeFromRuleMask(kubeProxyMasqueradeMark, fullNATedPodTrafficMark)
+}
+
+// SetRulePriorityFallbackBase sets the base rule priority to allocate from if node local rule is not found.
+func (m *Manager) SetRulePriorityFallbackBase(base int) {
+	m.rulePriorityFallbackBase = base
+}
+
+// GetUnreachableGateways returns the subnets whose gateway failed the last reachability probe.
+func (m *Manager) GetUnreachableGateways() map[string]error {
+	m.gatewayProbeMutex.RLock()
+	defer m.gatewayProbeMutex.RUnlock()
+
+	res := make(map[string]error, len(m.unreachableGatewayMap))
+	for cidr, err := range m.unreachableGatewayMap {
+		res[cidr] = err
+	}
+	return res
 }
 
 func (m *Manager) ResetInfos() {
@@ -184,12 +334,13 @@ func (m *Manager) ResetInfos() {
 	m.localClusterOverlaySubnetInfoMap = SubnetInfoMap{}
 	m.remoteOverlaySubnetInfoMap = SubnetInfoMap{}
 	m.remoteUnderlaySubnetInfoMap = SubnetInfoMap{}
+	m.pruneDrainingSubnets()
 }
 
 func (m *Manager) AddSubnetInfo(cidr *net.IPNet, gateway, start, end net.IP, excludeIPs []net.IP,
 	forwardNodeIfName string, autoNatOutgoing, isOverlay, isUnderlayOnHost bool, mode networkingv1.NetworkMode) {
 
-	cidrString := cidr.String()
+	cidrString := CanonicalCIDRKey(cidr)
 
 	if _, exist := m.localTotalSubnetInfoMap[cidrString]; !exist {
 		m.localTotalSubnetInfoMap[cidrString] = &SubnetInfo{
@@ -197,10 +348,10 @@ func (m *Manager) AddSubnetInfo(cidr *net.IPNet, gateway, start, end net.IP, exc
 			forwardNodeIfName: forwardNodeIfName,
 			gateway:           gateway,
 			autoNatOutgoing:   autoNatOutgoing,
-			includedIPRanges:  []*daemonutils.IPRange{},
+			includedIPRanges:  []*utils.IPRange{},
 			excludeIPs:        []net.IP{},
 			isUnderlayOnHost:  isUnderlayOnHost,
-			mode:              mode,
+			mode:              m.defaultedNetworkMode(cidr, mode),
 		}
 	}
 
@@ -216,10 +367,10 @@ func (m *Manager) AddSubnetInfo(cidr *net.IPNet, gateway, start, end net.IP, exc
 		}
 
 		if end == nil {
-			end = daemonutils.LastIP(cidr)
+			end = utils.LastIPOfCIDR(cidr)
 		}
 
-		if ipRange, _ := daemonutils.CreateIPRange(start, end); ipRange != nil {
+		if ipRange, _ := utils.CreateIPRange(start, end); ipRange != nil {
 			subnetInfo.includedIPRanges = append(subnetInfo.includedIPRanges, ipRange)
 		}
 	}
@@ -233,17 +384,170 @@ func (m *Manager) AddSubnetInfo(cidr *net.IPNet, gateway, start, end net.IP, exc
 	}
 }
 
-func (m *Manager) AddRemoteSubnetInfo(cidr *net.IPNet, gateway, start, end net.IP, excludeIPs []net.IP, isOverlay bool) error {
-	cidrString := cidr.String()
+// SetSubnetDSCPGateways sets the gateways for the traffic of subnet marked with specific DSCP values,
+// which only works for vlan subnets on this host.
+func (m *Manager) SetSubnetDSCPGateways(cidr *net.IPNet, dscpGateways map[uint8]net.IP) {
+	if info, exist := m.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(cidr)]; exist &&
+		info.mode == networkingv1.NetworkModeVlan {
+		info.dscpGateways = dscpGateways
+	}
+}
+
+// SetSubnetOverlayDestinations sets the destinations to route through vxlan device for an overlay subnet
+// which doesn't need to be NATed, instead of a catch-all default route. Destinations of other families
+// will be ignored.
+func (m *Manager) SetSubnetOverlayDestinations(cidr *net.IPNet, destinations []*net.IPNet) {
+	info, exist := m.localClusterOverlaySubnetInfoMap[CanonicalCIDRKey(cidr)]
+	if !exist {
+		return
+	}
+
+	var familyDestinations []*net.IPNet
+	for _, destination := range destinations {
+		if (destination.IP.To4() != nil) == (m.family == netlink.FAMILY_V4) {
+			familyDestinations = append(familyDestinations, destination)
+		}
+	}
+	info.overlayDestinations = familyDestinations
+}
+
+// SetSubnetEgressGateway sets the vtep ip of the egress gateway node for an overlay subnet, the outside traffic
+// of pods will be routed to it rather than being NATed locally. The gateway of other family will be ignored.
+func (m *Manager) SetSubnetEgressGateway(cidr *net.IPNet, egressGateway net.IP) {
+	if (egressGateway.To4() != nil) != (m.family == netlink.FAMILY_V4) {
+		return
+	}
+
+	if info, exist := m.localClusterOverlaySubnetInfoMap[CanonicalCIDRKey(cidr)]; exist {
+		info.egressGateway = egressGateway
+	}
+}
+
+// SetSubnetRouteMTU sets the mtu and advmss of the routes through vxlan device for an overlay subnet, zero
+// means not to set it.
+func (m *Manager) SetSubnetRouteMTU(cidr *net.IPNet, mtu, advMSS int) {
+	if info, exist := m.localClusterOverlaySubnetInfoMap[CanonicalCIDRKey(cidr)]; exist {
+		info.routeMTU = mtu
+		info.routeAdvMSS = advMSS
+	}
+}
+
+// SetSubnetRouteSource sets the source ip of the default route for a bgp subnet on this host, the source
+// ip of other family will be ignored.
+func (m *Manager) SetSubnetRouteSource(cidr *net.IPNet, routeSrc net.IP) {
+	if (routeSrc.To4() != nil) != (m.family == netlink.FAMILY_V4) {
+		return
+	}
+
+	if info, exist := m.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(cidr)]; exist && info.isUnderlayOnHost &&
+		(info.mode == networkingv1.NetworkModeBGP || info.mode == networkingv1.NetworkModeGlobalBGP) {
+		info.routeSrc = routeSrc
+	}
+}
+
+// SetSubnetBGPGateways sets the gateways of the ecmp default route for a bgp subnet on this host, the
+// gateways of other family will be ignored.
+func (m *Manager) SetSubnetBGPGateways(cidr *net.IPNet, gateways []net.IP) {
+	var familyGateways []net.IP
+	for _, gateway := range gateways {
+		if (gateway.To4() != nil) == (m.family == netlink.FAMILY_V4) {
+			familyGateways = append(familyGateways, gateway)
+		}
+	}
+
+	if info, exist := m.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(cidr)]; exist && info.isUnderlayOnHost &&
+		(info.mode == networkingv1.NetworkModeBGP || info.mode == networkingv1.NetworkModeGlobalBGP) {
+		info.bgpGateways = dedupeGateways(familyGateways)
+	}
+}
+
+// IsUnderlaySubnetOnHost returns true if subnet is a local underlay subnet on this node in the last sync.
+func (m *Manager) IsUnderlaySubnetOnHost(subnet *net.IPNet) bool {
+	m.syncedSubnetInfoMutex.RLock()
+	defer m.syncedSubnetInfoMutex.RUnlock()
+
+	info, exist := m.syncedUnderlaySubnetInfoMap[CanonicalCIDRKey(subnet)]
+	return exist && info.isUnderlayOnHost
+}
+
+// FindSubnetInfoByIP returns the info of local subnet in the last sync which the pod ip belongs to, the most
+// specific subnet will be returned if subnets overlap.
+func (m *Manager) FindSubnetInfoByIP(podIP net.IP) (*SubnetInfo, bool) {
+	m.syncedSubnetInfoMutex.RLock()
+	defer m.syncedSubnetInfoMutex.RUnlock()
+
+	var owner *SubnetInfo
+	for _, info := range m.syncedTotalSubnetInfoMap {
+		if !info.cidr.Contains(podIP) {
+			continue
+		}
+
+		if owner == nil {
+			owner = info
+			continue
+		}
+
+		if moreSpecificSubnet(info.cidr, owner.cidr) {
+			owner = info
+		}
+	}
+	return owner, owner != nil
+}
+
+// publishSubnetInfos makes the recorded local subnet infos visible to lookups from other reconcilers, the maps
+// will not be written any more since ResetInfos always replaces them.
+func (m *Manager) publishSubnetInfos() {
+	m.syncedSubnetInfoMutex.Lock()
+	defer m.syncedSubnetInfoMutex.Unlock()
+
+	m.syncedUnderlaySubnetInfoMap = m.localClusterUnderlaySubnetInfoMap
+	m.syncedTotalSubnetInfoMap = m.localTotalSubnetInfoMap
+}
+
+// subnetModeChanged checks if the network mode of subnet is different from the one whose routes have been programmed.
+func (m *Manager) subnetModeChanged(cidr *net.IPNet, mode networkingv1.NetworkMode) bool {
+	previousMode, exist := m.subnetModeMap[CanonicalCIDRKey(cidr)]
+	return exist && previousMode != mode
+}
+
+func (m *Manager) checkFromPodSubnetRuleExpected(rule netlink.Rule) bool {
+	info, exist := m.localTotalSubnetInfoMap[CanonicalCIDRKey(rule.Src)]
+	if !exist {
+		return false
+	}
+
+	// Underlay subnets are programmed only if this node belongs to their networks, e.g., after this node is
+	// removed from the node list of a bgp network, rules of its subnets are not supposed to exist.
+	if _, isOverlay := m.localClusterOverlaySubnetInfoMap[CanonicalCIDRKey(rule.Src)]; !isOverlay &&
+		!info.isUnderlayOnHost {
+		return false
+	}
+
+	if rule.Tos != 0 {
+		if !info.isUnderlayOnHost || rule.Tos&0x3 != 0 {
+			return false
+		}
+		_, exist = info.dscpGateways[uint8(rule.Tos>>2)]
+		return exist
+	}
+
+	return true
+}
+
+// AddRemoteSubnetInfo records a remote subnet, forwardNodeIfName is the local vxlan interface for remote overlay subnets.
+func (m *Manager) AddRemoteSubnetInfo(cidr *net.IPNet, gateway, start, end net.IP, excludeIPs []net.IP,
+	forwardNodeIfName string, isOverlay bool) error {
+	cidrString := CanonicalCIDRKey(cidr)
 
 	var subnetInfo *SubnetInfo
 	if isOverlay {
 		if _, exists := m.remoteOverlaySubnetInfoMap[cidrString]; !exists {
 			m.remoteOverlaySubnetInfoMap[cidrString] = &SubnetInfo{
-				cidr:             cidr,
-				gateway:          gateway,
-				includedIPRanges: []*daemonutils.IPRange{},
-				excludeIPs:       []net.IP{},
+				cidr:              cidr,
+				gateway:           gateway,
+				forwardNodeIfName: forwardNodeIfName,
+				includedIPRanges:  []*utils.IPRange{},
+				excludeIPs:        []net.IP{},
 			}
 		}
 
@@ -253,7 +557,7 @@ func (m *Manager) AddRemoteSubnetInfo(cidr *net.IPNet, gateway, start, end net.I
 			m.remoteUnderlaySubnetInfoMap[cidrString] = &SubnetInfo{
 				cidr:             cidr,
 				gateway:          gateway,
-				includedIPRanges: []*daemonutils.IPRange{},
+				includedIPRanges: []*utils.IPRange{},
 				excludeIPs:       []net.IP{},
 			}
 		}
@@ -271,10 +575,10 @@ func (m *Manager) AddRemoteSubnetInfo(cidr *net.IPNet, gateway, start, end net.I
 		}
 
 		if end == nil {
-			end = daemonutils.LastIP(cidr)
+			end = utils.LastIPOfCIDR(cidr)
 		}
 
-		if ipRange, _ := daemonutils.CreateIPRange(start, end); ipRange != nil {
+		if ipRange, _ := utils.CreateIPRange(start, end); ipRange != nil {
 			subnetInfo.includedIPRanges = append(subnetInfo.includedIPRanges, ipRange)
 		}
 	}
@@ -282,21 +586,59 @@ func (m *Manager) AddRemoteSubnetInfo(cidr *net.IPNet, gateway, start, end net.I
 	return nil
 }
 
+// SyncRoutes programs rules and routes of recorded subnets, and records the result for readiness checks.
 func (m *Manager) SyncRoutes() error {
+	m.publishSubnetInfos()
+
+	if m.skipSyncIfPaused() {
+		return nil
+	}
+
+	if !m.ownedTablesSeeded {
+		if err := m.seedOwnedRouteTables(); err != nil {
+			err = fmt.Errorf("failed to seed owned route tables: %v", err)
+			m.recordSyncResult(err, time.Now())
+			return err
+		}
+		m.ownedTablesSeeded = true
+	}
+
+	if m.warmUpPending {
+		result, err := m.warmUp()
+		if err != nil {
+			err = fmt.Errorf("failed to warm up: %v", err)
+			m.recordSyncResult(err, time.Now())
+			return err
+		}
+		m.warmUpPending = false
+		m.logger.Info("route manager warmed up", "family", m.family, "result", result)
+	}
+
+	err := m.syncRoutes()
+	m.recordSyncResult(err, time.Now())
+	return err
+}
+
+func (m *Manager) syncRoutes() error {
 	// Ensure basic rules.
-	if err := appendHighestUnusedPriorityRuleIfNotExist(nil, m.localDirectTableNum, m.family, 0, 0); err != nil {
+	if err := m.appendHighestUnusedPriorityRuleIfNotExist(nil, m.localDirectTableNum, 0, 0); err != nil {
 		return fmt.Errorf("failed to append local-pod-direct rule: %v", err)
 	}
 
-	if err := appendHighestUnusedPriorityRuleIfNotExist(nil, m.toOverlaySubnetTableNum, m.family, 0, 0); err != nil {
+	if err := m.appendHighestUnusedPriorityRuleIfNotExist(nil, m.toOverlaySubnetTableNum, 0, 0); err != nil {
 		return fmt.Errorf("failed to append to-overlay-pod-subnet rule: %v", err)
 	}
 
-	if err := appendHighestUnusedPriorityRuleIfNotExist(nil, m.overlayMarkTableNum, m.family,
+	if err := m.appendHighestUnusedPriorityRuleIfNotExist(nil, m.overlayMarkTableNum,
 		iptables.PodToNodeBackTrafficMark, iptables.PodToNodeBackTrafficMark); err != nil {
 		return fmt.Errorf("failed to append overlay-mark rule: %v", err)
 	}
 
+	// Flush route tables of removed subnets whose grace period expired.
+	if err := m.finalizePendingDeleteTables(time.Now()); err != nil {
+		return fmt.Errorf("failed to finalize pending delete route tables: %v", err)
+	}
+
 	// Find excluded ip ranges.
 	// TODO: if CIDRs are different but overlapped, exclude IP blocks might be conflicted
 	localUnderlayExcludeIPBlockMap, err := findExcludeIPBlockMap(m.localClusterUnderlaySubnetInfoMap)
@@ -332,66 +674,115 @@ func (m *Manager) SyncRoutes() error {
 		return fmt.Errorf("failed to list rule: %v", err)
 	}
 
+	// Tables still referenced by expected from-pod-subnet rules, which should not be flushed.
+	tableMembers := m.fromPodSubnetRuleTableMembers(ruleList)
+
 	// Sync from every pod subnet rules.
 	for _, rule := range ruleList {
-		isFromPodSubnetRule := checkIsFromPodSubnetRule(rule)
+		isFromPodSubnetRule := checkIsFromPodSubnetRule(rule, m.tableRange)
+		if isFromPodSubnetRule {
+			m.ownedTables[rule.Table] = true
+		}
 
 		// TODO: for compatibility, to be removed in the next major version
 		if !isFromPodSubnetRule {
-			isOldFromPodSubnetRule, err := checkIsOldFromPodSubnetRule(rule, m.family)
+			isOldFromPodSubnetRule, err := checkIsOldFromPodSubnetRule(rule, m.family, m.tableRange)
 			if err != nil {
 				return fmt.Errorf("failed to check if rule %v is outdated from pod subnet rule: %v", rule.String(), err)
 			}
 
 			if isOldFromPodSubnetRule {
-				if err := updateOldFromPodSubnetRuleToNew(rule); err != nil {
+				if err := m.updateOldFromPodSubnetRuleToNew(rule); err != nil {
 					return fmt.Errorf("failed to update old from subnet rule %v: %v", rule.String(), err)
 				}
 				isFromPodSubnetRule = true
+				m.ownedTables[rule.Table] = true
 			}
 		}
 
-		if isFromPodSubnetRule {
-			// Delete subnet rules which are not supposed to exist.
-			if _, exist := m.localTotalSubnetInfoMap[rule.Src.String()]; !exist {
-				rule.Family = m.family
-				if err := netlink.RuleDel(&rule); err != nil {
-					return fmt.Errorf("del subnet policy rule error: %v", err)
-				}
-
-				if err := clearRouteTable(rule.Table, m.family); err != nil {
-					return fmt.Errorf("failed to clear route table %v: %v", rule.Table, err)
-				}
+		// Delete subnet rules which are not supposed to exist.
+		if isFromPodSubnetRule && !m.checkFromPodSubnetRuleExpected(rule) {
+			if err := m.teardownFromPodSubnetRule(rule, tableMembers); err != nil {
+				return err
 			}
 		}
 	}
 
-	for _, info := range m.localClusterOverlaySubnetInfoMap {
+	// Rules of the previous traffic marks are not matching the traffic as expected.
+	if err := m.repairFromRuleMasks(ruleList); err != nil {
+		return fmt.Errorf("failed to repair masks of from pod subnet rules: %v", err)
+	}
+
+	sharedTables := planSharedRouteTables(tableMembers, m.subnetShareKeys())
+
+	overlaps := m.reportOverlappedSubnets()
+
+	// Subnets are iterated with the most specific first, so that the newly appended rule of a more specific
+	// subnet takes precedence over the ones of overlapped subnets in the same sync, rules appended in different
+	// syncs are reordered after all the subnets are synced.
+	for _, info := range sortSubnetInfosBySpecificity(m.localClusterOverlaySubnetInfoMap) {
 		// Append overlay from pod subnet rules which don't exist and adapt to subnet configuration
-		if err := ensureFromPodSubnetRuleAndRoutes(info.forwardNodeIfName, info.cidr, info.gateway, info.autoNatOutgoing, m.family,
+		if err := m.ensureFromPodSubnetRuleAndRoutes(info.forwardNodeIfName, info.cidr, info.gateway, info.autoNatOutgoing,
 			combineSubnetInfoMap(m.localClusterUnderlaySubnetInfoMap, m.remoteUnderlaySubnetInfoMap),
 			combineNetMap(localUnderlayExcludeIPBlockMap, remoteUnderlayExcludeIPBlockMap),
-			info.mode,
+			info.mode, sharedTables, m.shareKeyOf(info),
 		); err != nil {
-			return fmt.Errorf("failed to add overlay subnet %v rule and routes: %v", info.cidr, err)
+			return fmt.Errorf("failed to add overlay subnet %v rule and routes: %w", info.cidr, err)
 		}
 	}
 
-	for _, info := range m.localClusterUnderlaySubnetInfoMap {
+	// A missing direct route of one subnet should not block the others, it is returned after all subnets are synced.
+	var missingDirectRouteErr error
+	m.pruneMissingDirectRoutes()
+
+	for _, info := range sortSubnetInfosBySpecificity(m.localClusterUnderlaySubnetInfoMap) {
 		// do not need create from-pod-subnet rules for underlay subnet which is not on this host
 		if !info.isUnderlayOnHost {
 			continue
 		}
 
 		// Append underlay from-pod-subnet rules which don't exist and adapt to subnet configuration
-		if err := ensureFromPodSubnetRuleAndRoutes(info.forwardNodeIfName, info.cidr,
-			info.gateway, info.autoNatOutgoing, m.family, nil, nil, info.mode,
-		); err != nil {
-			return fmt.Errorf("failed to add underlay subnet %v rule and routes: %v", info.cidr, err)
+		err := m.ensureFromPodSubnetRuleAndRoutes(info.forwardNodeIfName, info.cidr,
+			info.gateway, info.autoNatOutgoing, nil, nil, info.mode, sharedTables, m.shareKeyOf(info),
+		)
+		switch {
+		case IsMissingDirectRouteError(err):
+			m.recordMissingDirectRoute(info.cidr, time.Now())
+			if missingDirectRouteErr == nil {
+				missingDirectRouteErr = fmt.Errorf("failed to add underlay subnet %v rule and routes: %w", info.cidr, err)
+			}
+			continue
+		case IsConflictingAddressError(err):
+			// bad address of one forward interface should not block the other subnets
+			m.syncLogger.Error("conflicting-address/"+info.cidr.String(), err,
+				"skip underlay subnet with conflicting address on forward interface", "subnet", info.cidr.String())
+			continue
+		case err != nil:
+			return fmt.Errorf("failed to add underlay subnet %v rule and routes: %w", info.cidr, err)
+		}
+		delete(m.missingDirectRouteMap, CanonicalCIDRKey(info.cidr))
+
+		if err := m.ensureDSCPRulesAndRoutes(info); err != nil {
+			return fmt.Errorf("failed to add underlay subnet %v dscp rules and routes: %w", info.cidr, err)
 		}
 	}
 
-	return nil
+	if err := m.repairOverlappedRulePriorities(overlaps); err != nil {
+		return fmt.Errorf("failed to repair priorities of overlapped subnet rules: %v", err)
+	}
+
+	if m.gatewayProbeEnabled && m.gatewayProbeCh != nil {
+		m.requestGatewayProbe(m.collectGatewayProbeTargets())
+	} else if m.gatewayProbeEnabled {
+		m.probeGatewayTargets(m.collectGatewayProbeTargets())
+	}
+
+	// Table usage is only for observation, failing to report it should not fail the sync.
+	if err := m.reportRouteTablesInUse(); err != nil {
+		m.syncLogger.Error("route-tables-in-use", err, "failed to report route tables in use")
+	}
+
+	return missingDirectRouteErr
 }
 
 func (m *Manager) ensureToOverlaySubnetRoutes(excludeIPBlockMap map[string]*net.IPNet) error {
@@ -410,23 +801,24 @@ func (m *Manager) ensureToOverlaySubnetRoutes(excludeIPBlockMap map[string]*net.
 			continue
 		}
 
-		if _, exist := m.localClusterOverlaySubnetInfoMap[route.Dst.String()]; exist {
-			existOverlaySubnetRouteMap[route.Dst.String()] = true
-		} else if _, exist := m.remoteOverlaySubnetInfoMap[route.Dst.String()]; exist {
-			existRemoteOverlaySubnetRouteMap[route.Dst.String()] = true
+		dstKey := CanonicalCIDRKey(route.Dst)
+		if _, exist := m.localClusterOverlaySubnetInfoMap[dstKey]; exist {
+			existOverlaySubnetRouteMap[dstKey] = true
+		} else if _, exist := m.remoteOverlaySubnetInfoMap[dstKey]; exist {
+			existRemoteOverlaySubnetRouteMap[dstKey] = true
 		} else if err := netlink.RouteDel(&route); err != nil {
 			return fmt.Errorf("failed to delete route %v: %v", route.String(), err)
 		}
 	}
 
 	for _, info := range m.localClusterOverlaySubnetInfoMap {
-		if _, exist := existOverlaySubnetRouteMap[info.cidr.String()]; !exist {
+		if _, exist := existOverlaySubnetRouteMap[CanonicalCIDRKey(info.cidr)]; !exist {
 			overlayLink, err := netlink.LinkByName(info.forwardNodeIfName)
 			if err != nil {
 				return fmt.Errorf("failed to get overlay link %v: %v", info.forwardNodeIfName, err)
 			}
 
-			if err := netlink.RouteReplace(&netlink.Route{
+			if err := replaceRoute(&netlink.Route{
 				Dst:       info.cidr,
 				LinkIndex: overlayLink.Attrs().Index,
 				Table:     m.toOverlaySubnetTableNum,
@@ -439,13 +831,13 @@ func (m *Manager) ensureToOverlaySubnetRoutes(excludeIPBlockMap map[string]*net.
 
 	// add route for remote overlay subnets
 	for _, info := range m.remoteOverlaySubnetInfoMap {
-		if _, exist := existRemoteOverlaySubnetRouteMap[info.cidr.String()]; !exist {
-			overlayLink, err := netlink.LinkByName(m.overlayIfName)
+		if _, exist := existRemoteOverlaySubnetRouteMap[CanonicalCIDRKey(info.cidr)]; !exist {
+			overlayLink, err := netlink.LinkByName(info.forwardNodeIfName)
 			if err != nil {
-				return fmt.Errorf("failed to get overlay link %v: %v", m.overlayIfName, err)
+				return fmt.Errorf("failed to get overlay link %v: %v", info.forwardNodeIfName, err)
 			}
 
-			if err := netlink.RouteReplace(&netlink.Route{
+			if err := replaceRoute(&netlink.Route{
 				Dst:       info.cidr,
 				LinkIndex: overlayLink.Attrs().Index,
 				Table:     m.toOverlaySubnetTableNum,
@@ -460,9 +852,32 @@ func (m *Manager) ensureToOverlaySubnetRoutes(excludeIPBlockMap map[string]*net.
 	if err := ensureExcludedIPBlockRoutes(excludeIPBlockMap, m.toOverlaySubnetTableNum, m.family); err != nil {
 		return fmt.Errorf("failed to ensure exclude ip block routes: %v", err)
 	}
+
+	m.recordExcludeIPBlockRouteCount(combineSubnetInfoMap(m.localClusterOverlaySubnetInfoMap, m.remoteOverlaySubnetInfoMap),
+		excludeIPBlockMap, m.toOverlaySubnetTableNum)
 	return nil
 }
 
+// recordExcludeIPBlockRouteCount updates the exclude ip block route gauge of every subnet in table,
+// gauges of the subnets which no longer exist will be deleted.
+func (m *Manager) recordExcludeIPBlockRouteCount(subnetInfoMap SubnetInfoMap, excludeIPBlockMap map[string]*net.IPNet,
+	table int) {
+	tableLabel, familyLabel := strconv.Itoa(table), ipFamilyLabel(m.family)
+	countMap := countExcludeIPBlocksBySubnet(subnetInfoMap, excludeIPBlockMap)
+
+	for subnet := range m.excludeIPBlockRouteSubnets {
+		if _, exist := subnetInfoMap[subnet]; !exist {
+			metrics.ExcludeIPBlockRouteGauge.DeleteLabelValues(subnet, tableLabel, familyLabel)
+		}
+	}
+
+	m.excludeIPBlockRouteSubnets = map[string]bool{}
+	for subnet := range subnetInfoMap {
+		metrics.ExcludeIPBlockRouteGauge.WithLabelValues(subnet, tableLabel, familyLabel).Set(float64(countMap[subnet]))
+		m.excludeIPBlockRouteSubnets[subnet] = true
+	}
+}
+
 func (m *Manager) ensureOverlayMarkRoutes() error {
 	if m.overlayIfName != "" {
 		overlayLink, err := netlink.LinkByName(m.overlayIfName)
@@ -470,7 +885,7 @@ func (m *Manager) ensureOverlayMarkRoutes() error {
 			return fmt.Errorf("failed to get overlay link %v: %v", m.overlayIfName, err)
 		}
 
-		if err := netlink.RouteReplace(&netlink.Route{
+		if err := replaceRoute(&netlink.Route{
 			Dst:       defaultRouteDstByFamily(m.family),
 			LinkIndex: overlayLink.Attrs().Index,
 			Table:     m.overlayMarkTableNum,
@@ -482,3 +897,185 @@ func (m *Manager) ensureOverlayMarkRoutes() error {
 
 	return nil
 }
+
+// ExportedState is the desired routing state of a route Manager. Subnets only depend on the recorded subnet infos,
+// while rules and tables are filled by ResolveKernelState with the priorities and tables allocated in kernel.
+type ExportedState struct {
+	Family                  int              `json:"family"`
+	LocalDirectTableNum     int              `json:"localDirectTableNum"`
+	ToOverlaySubnetTableNum int              `json:"toOverlaySubnetTableNum"`
+	OverlayMarkTableNum     int              `json:"overlayMarkTableNum"`
+	FromRuleMask            int              `json:"fromRuleMask"`
+	OverlayIfName           string           `json:"overlayIfName,omitempty"`
+	LocalOverlaySubnets     []ExportedSubnet `json:"localOverlaySubnets"`
+	LocalUnderlaySubnets    []ExportedSubnet `json:"localUnderlaySubnets"`
+	RemoteOverlaySubnets    []ExportedSubnet `json:"remoteOverlaySubnets"`
+	RemoteUnderlaySubnets   []ExportedSubnet `json:"remoteUnderlaySubnets"`
+	Rules                   []ExportedRule   `json:"rules"`
+	Tables                  []ExportedTable  `json:"tables"`
+
+	// copy of the manager fields which rules and tables are built from
+	snapshot *Manager
+}
+
+// ExportedSubnet is the desired routing state of a single subnet.
+type ExportedSubnet struct {
+	CIDR                string   `json:"cidr"`
+	Gateway             string   `json:"gateway,omitempty"`
+	Mode                string   `json:"mode,omitempty"`
+	ForwardNodeIfName   string   `json:"forwardNodeIfName,omitempty"`
+	AutoNatOutgoing     bool     `json:"autoNatOutgoing"`
+	IsUnderlayOnHost    bool     `json:"isUnderlayOnHost"`
+	FromPodSubnetRule   bool     `json:"fromPodSubnetRule"`
+	ExcludeIPBlocks     []string `json:"excludeIPBlocks,omitempty"`
+	OverlayDestinations []string `json:"overlayDestinations,omitempty"`
+	EgressGateway       string   `json:"egressGateway,omitempty"`
+	RouteSource         string   `json:"routeSource,omitempty"`
+	RouteMTU            int      `json:"routeMTU,omitempty"`
+	RouteAdvMSS         int      `json:"routeAdvMSS,omitempty"`
+	// gateways of the ecmp default route for bgp subnets
+	BGPGateways  []string              `json:"bgpGateways,omitempty"`
+	DSCPGateways []ExportedDSCPGateway `json:"dscpGateways,omitempty"`
+}
+
+// ExportedDSCPGateway is the gateway for the traffic marked with a DSCP value.
+type ExportedDSCPGateway struct {
+	DSCP    uint8  `json:"dscp"`
+	Gateway string `json:"gateway"`
+}
+
+// Export serializes the desired subnets of manager into a deterministic JSON document, kernel state is never read.
+func (m *Manager) Export() ([]byte, error) {
+	state, err := m.ExportState()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(state, "", "  ")
+}
+
+// ExportState returns the desired subnets of manager without touching kernel, it must not be called concurrently
+// with the methods recording subnet infos.
+func (m *Manager) ExportState() (*ExportedState, error) {
+	state := &ExportedState{
+		Family:                  m.family,
+		LocalDirectTableNum:     m.localDirectTableNum,
+		ToOverlaySubnetTableNum: m.toOverlaySubnetTableNum,
+		OverlayMarkTableNum:     m.overlayMarkTableNum,
+		FromRuleMask:            m.fromRuleMask,
+		OverlayIfName:           m.overlayIfName,
+	}
+
+	var err error
+	if state.LocalOverlaySubnets, err = exportSubnetInfoMap(m.localClusterOverlaySubnetInfoMap, true); err != nil {
+		return nil, fmt.Errorf("failed to export local overlay subnets: %v", err)
+	}
+	if state.LocalUnderlaySubnets, err = exportSubnetInfoMap(m.localClusterUnderlaySubnetInfoMap, false); err != nil {
+		return nil, fmt.Errorf("failed to export local underlay subnets: %v", err)
+	}
+	if state.RemoteOverlaySubnets, err = exportSubnetInfoMap(m.remoteOverlaySubnetInfoMap, false); err != nil {
+		return nil, fmt.Errorf("failed to export remote overlay subnets: %v", err)
+	}
+	if state.RemoteUnderlaySubnets, err = exportSubnetInfoMap(m.remoteUnderlaySubnetInfoMap, false); err != nil {
+		return nil, fmt.Errorf("failed to export remote underlay subnets: %v", err)
+	}
+
+	state.snapshot = &Manager{
+		localDirectTableNum:               m.localDirectTableNum,
+		toOverlaySubnetTableNum:           m.toOverlaySubnetTableNum,
+		overlayMarkTableNum:               m.overlayMarkTableNum,
+		tableRange:                        m.tableRange,
+		fromRuleMask:                      m.fromRuleMask,
+		overlayIfName:                     m.overlayIfName,
+		family:                            m.family,
+		localClusterOverlaySubnetInfoMap:  copySubnetInfoMap(m.localClusterOverlaySubnetInfoMap),
+		localClusterUnderlaySubnetInfoMap: copySubnetInfoMap(m.localClusterUnderlaySubnetInfoMap),
+		remoteOverlaySubnetInfoMap:        copySubnetInfoMap(m.remoteOverlaySubnetInfoMap),
+		remoteUnderlaySubnetInfoMap:       copySubnetInfoMap(m.remoteUnderlaySubnetInfoMap),
+	}
+
+	return state, nil
+}
+
+// ResolveKernelState returns a copy of state with the rules and tables built with the priorities and tables
+// allocated in kernel. It reads kernel state and is meant for debugging only, e.g., serving the route states.
+func (s *ExportedState) ResolveKernelState() (*ExportedState, error) {
+	resolved := *s
+	if s.snapshot == nil {
+		return &resolved, nil
+	}
+
+	env, err := newLiveExportEnv(s.Family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect live state: %v", err)
+	}
+	if resolved.Rules, resolved.Tables, err = s.snapshot.exportRulesAndTables(env); err != nil {
+		return nil, fmt.Errorf("failed to export rules and tables: %v", err)
+	}
+	return &resolved, nil
+}
+
+func exportSubnetInfoMap(subnetInfoMap SubnetInfoMap, isOverlay bool) ([]ExportedSubnet, error) {
+	exportedSubnets := make([]ExportedSubnet, 0, len(subnetInfoMap))
+	for cidrString, info := range subnetInfoMap {
+		exportedSubnet := ExportedSubnet{
+			CIDR:              cidrString,
+			Mode:              string(info.mode),
+			ForwardNodeIfName: info.forwardNodeIfName,
+			AutoNatOutgoing:   info.autoNatOutgoing,
+			IsUnderlayOnHost:  info.isUnderlayOnHost,
+			// from-pod-subnet rules only exist for local overlay subnets and underlay subnets on this host
+			FromPodSubnetRule: info.forwardNodeIfName != "" && (isOverlay || info.isUnderlayOnHost),
+			RouteMTU:          info.routeMTU,
+			RouteAdvMSS:       info.routeAdvMSS,
+		}
+
+		if info.gateway != nil {
+			exportedSubnet.Gateway = info.gateway.String()
+		}
+		if info.egressGateway != nil {
+			exportedSubnet.EgressGateway = info.egressGateway.String()
+		}
+		if info.routeSrc != nil {
+			exportedSubnet.RouteSource = info.routeSrc.String()
+		}
+		for _, gateway := range info.bgpGateways {
+			exportedSubnet.BGPGateways = append(exportedSubnet.BGPGateways, gateway.String())
+		}
+		sort.Strings(exportedSubnet.BGPGateways)
+
+		for dscp, gateway := range info.dscpGateways {
+			exportedSubnet.DSCPGateways = append(exportedSubnet.DSCPGateways, ExportedDSCPGateway{
+				DSCP:    dscp,
+				Gateway: gateway.String(),
+			})
+		}
+		sort.Slice(exportedSubnet.DSCPGateways, func(i, j int) bool {
+			return exportedSubnet.DSCPGateways[i].DSCP < exportedSubnet.DSCPGateways[j].DSCP
+		})
+
+		for _, destination := range info.overlayDestinations {
+			exportedSubnet.OverlayDestinations = append(exportedSubnet.OverlayDestinations, CanonicalCIDRKey(destination))
+		}
+		sort.Strings(exportedSubnet.OverlayDestinations)
+
+		excludeIPBlocks, err := utils.FindSubnetExcludeIPBlocks(info.cidr, info.includedIPRanges,
+			info.gateway, info.excludeIPs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find excluded ip blocks for subnet %v: %v", cidrString, err)
+		}
+
+		for _, block := range excludeIPBlocks {
+			exportedSubnet.ExcludeIPBlocks = append(exportedSubnet.ExcludeIPBlocks, CanonicalCIDRKey(block))
+		}
+		sort.Strings(exportedSubnet.ExcludeIPBlocks)
+
+		exportedSubnets = append(exportedSubnets, exportedSubnet)
+	}
+
+	sort.Slice(exportedSubnets, func(i, j int) bool {
+		return exportedSubnets[i].CIDR < exportedSubnets[j].CIDR
+	})
+
+	return exportedSubnets, nil
+}
@@ -0,0 +1,366 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func newTestManager(family int) *Manager {
+	return &Manager{
+		localDirectTableNum:               39999,
+		toOverlaySubnetTableNum:           40000,
+		overlayMarkTableNum:               40001,
+		tableRange:                        DefaultTableRange,
+		family:                            family,
+		localTotalSubnetInfoMap:           SubnetInfoMap{},
+		localClusterOverlaySubnetInfoMap:  SubnetInfoMap{},
+		localClusterUnderlaySubnetInfoMap: SubnetInfoMap{},
+		remoteOverlaySubnetInfoMap:        SubnetInfoMap{},
+		remoteUnderlaySubnetInfoMap:       SubnetInfoMap{},
+		unreachableGatewayMap:             map[string]error{},
+		subnetModeMap:                     map[string]networkingv1.NetworkMode{},
+		pendingDeleteTableMap:             map[string]*pendingDeleteTable{},
+		drainingSubnetMap:                 map[string]*drainingSubnet{},
+		missingDirectRouteMap:             map[string]time.Time{},
+		rulePriorityFallbackBase:          DefaultRulePriorityFallbackBase,
+		fromRuleMask:                      DefaultFromRuleMask,
+		ownedTables:                       map[int]bool{},
+		logger:                            logr.Discard(),
+		syncLogger:                        newRateLimitedLogger(logr.Discard(), defaultLogBurst, defaultLogRefillInterval),
+	}
+}
+
+func TestManagerExport(t *testing.T) {
+	_, overlayCidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, underlayCidr, _ := net.ParseCIDR("192.168.1.0/24")
+
+	addOverlay := func(m *Manager) {
+		m.AddSubnetInfo(overlayCidr, nil, nil, nil, nil, "eth0.vxlan4", true, true, false,
+			networkingv1.NetworkModeVxlan)
+	}
+	addUnderlay := func(m *Manager) {
+		m.AddSubnetInfo(underlayCidr, net.ParseIP("192.168.1.1"), net.ParseIP("192.168.1.100"),
+			net.ParseIP("192.168.1.200"), nil, "eth0", false, false, true, networkingv1.NetworkModeVlan)
+	}
+
+	m1 := newTestManager(netlink.FAMILY_V4)
+	addOverlay(m1)
+	addUnderlay(m1)
+
+	m2 := newTestManager(netlink.FAMILY_V4)
+	addUnderlay(m2)
+	addOverlay(m2)
+
+	exported1, err := m1.Export()
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+
+	exported2, err := m2.Export()
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+
+	if string(exported1) != string(exported2) {
+		t.Fatalf("expect the same export result, got:\n%s\nand:\n%s", exported1, exported2)
+	}
+
+	state := &ExportedState{}
+	if err := json.Unmarshal(exported1, state); err != nil {
+		t.Fatalf("failed to unmarshal exported state: %v", err)
+	}
+
+	if len(state.LocalOverlaySubnets) != 1 || state.LocalOverlaySubnets[0].CIDR != "10.0.0.0/24" ||
+		!state.LocalOverlaySubnets[0].FromPodSubnetRule {
+		t.Errorf("unexpected local overlay subnets: %+v", state.LocalOverlaySubnets)
+	}
+
+	if len(state.LocalUnderlaySubnets) != 1 || state.LocalUnderlaySubnets[0].Gateway != "192.168.1.1" ||
+		len(state.LocalUnderlaySubnets[0].ExcludeIPBlocks) == 0 {
+		t.Errorf("unexpected local underlay subnets: %+v", state.LocalUnderlaySubnets)
+	}
+
+	// rules and tables allocated in kernel are only resolved on demand
+	if len(state.Rules) != 0 || len(state.Tables) != 0 {
+		t.Errorf("expect no rules and tables exported, but got %+v and %+v", state.Rules, state.Tables)
+	}
+
+	// rules and tables are resolved from the subnet infos at the time of export
+	exportedState, err := m2.ExportState()
+	if err != nil {
+		t.Fatalf("failed to export state: %v", err)
+	}
+	delete(m2.localClusterOverlaySubnetInfoMap, CanonicalCIDRKey(overlayCidr))
+	if len(exportedState.snapshot.localClusterOverlaySubnetInfoMap) != 1 {
+		t.Errorf("expect subnet infos of exported state not to be changed by manager")
+	}
+
+	// gateways are exported in order regardless of the order they are set
+	_, bgpCidr, _ := net.ParseCIDR("192.168.2.0/24")
+	m1.AddSubnetInfo(bgpCidr, net.ParseIP("192.168.2.1"), nil, nil, nil, "", false, false, true,
+		networkingv1.NetworkModeBGP)
+	m1.SetSubnetBGPGateways(bgpCidr, []net.IP{net.ParseIP("10.10.0.2"), net.ParseIP("10.10.0.1")})
+	m1.SetSubnetDSCPGateways(underlayCidr, map[uint8]net.IP{
+		46: net.ParseIP("192.168.1.2"),
+		34: net.ParseIP("192.168.1.3"),
+	})
+
+	exported1, err = m1.Export()
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+
+	state = &ExportedState{}
+	if err := json.Unmarshal(exported1, state); err != nil {
+		t.Fatalf("failed to unmarshal exported state: %v", err)
+	}
+
+	expectedSubnets := map[string]ExportedSubnet{
+		"192.168.1.0/24": {DSCPGateways: []ExportedDSCPGateway{{34, "192.168.1.3"}, {46, "192.168.1.2"}}},
+		"192.168.2.0/24": {BGPGateways: []string{"10.10.0.1", "10.10.0.2"}},
+	}
+	if len(state.LocalUnderlaySubnets) != len(expectedSubnets) {
+		t.Fatalf("unexpected local underlay subnets: %+v", state.LocalUnderlaySubnets)
+	}
+	for _, subnet := range state.LocalUnderlaySubnets {
+		expected := expectedSubnets[subnet.CIDR]
+		if !reflect.DeepEqual(subnet.BGPGateways, expected.BGPGateways) ||
+			!reflect.DeepEqual(subnet.DSCPGateways, expected.DSCPGateways) {
+			t.Errorf("subnet %v: expect bgp gateways %v and dscp gateways %v, but got %v and %v", subnet.CIDR,
+				expected.BGPGateways, expected.DSCPGateways, subnet.BGPGateways, subnet.DSCPGateways)
+		}
+	}
+}
+
+func TestShouldDetachFromTableOnModeChange(t *testing.T) {
+	_, vlanCidr, _ := net.ParseCIDR("192.168.1.0/24")
+	_, changedCidr, _ := net.ParseCIDR("192.168.2.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.subnetModeMap[CanonicalCIDRKey(vlanCidr)] = networkingv1.NetworkModeVlan
+	m.subnetModeMap[CanonicalCIDRKey(changedCidr)] = networkingv1.NetworkModeVlan
+
+	// two vlan subnets share table 10000, one of them changes to vxlan and is kept in the table because of
+	// its share key, while the rule of the other vlan subnet still points to the table
+	plan := planSharedRouteTables(map[int][]*net.IPNet{
+		10000: {vlanCidr, changedCidr},
+	}, map[string]string{
+		CanonicalCIDRKey(vlanCidr):    "b-vlan",
+		CanonicalCIDRKey(changedCidr): "a-vxlan",
+	})
+	if plan.evictedSubnets[CanonicalCIDRKey(changedCidr)] {
+		t.Fatalf("expect subnet %v to be kept in table 10000", changedCidr)
+	}
+
+	if !m.shouldDetachFromTable(changedCidr, networkingv1.NetworkModeVxlan, 10000, plan) {
+		t.Errorf("expect subnet %v changed to vxlan to detach from the shared table", changedCidr)
+	}
+
+	if m.shouldDetachFromTable(vlanCidr, networkingv1.NetworkModeVlan, 10000, plan) {
+		t.Errorf("expect subnet %v whose mode is not changed to stay in table", vlanCidr)
+	}
+
+	// the table is not shared any more after the vlan subnet moves out
+	plan.leave(vlanCidr, 10000)
+	if m.shouldDetachFromTable(changedCidr, networkingv1.NetworkModeVxlan, 10000, plan) {
+		t.Errorf("expect subnet %v to clear its own table rather than detaching", changedCidr)
+	}
+}
+
+func TestManagerSubnetOnHost(t *testing.T) {
+	_, onHostCidr, _ := net.ParseCIDR("192.168.1.0/24")
+	_, offHostCidr, _ := net.ParseCIDR("192.168.2.0/24")
+	_, overlayCidr, _ := net.ParseCIDR("10.0.0.0/16")
+	_, overlaySubCidr, _ := net.ParseCIDR("10.0.1.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.AddSubnetInfo(onHostCidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0", false, false, true,
+		networkingv1.NetworkModeVlan)
+	m.AddSubnetInfo(offHostCidr, net.ParseIP("192.168.2.1"), nil, nil, nil, "eth0", false, false, false,
+		networkingv1.NetworkModeVlan)
+	m.AddSubnetInfo(overlayCidr, nil, nil, nil, nil, "eth0.vxlan4", true, true, false,
+		networkingv1.NetworkModeVxlan)
+	m.AddSubnetInfo(overlaySubCidr, nil, nil, nil, nil, "eth0.vxlan4", true, true, false,
+		networkingv1.NetworkModeVxlan)
+
+	if m.IsUnderlaySubnetOnHost(onHostCidr) {
+		t.Errorf("expect subnet %v not visible before sync", onHostCidr)
+	}
+
+	m.publishSubnetInfos()
+
+	if !m.IsUnderlaySubnetOnHost(onHostCidr) {
+		t.Errorf("expect subnet %v on host", onHostCidr)
+	}
+
+	_, unnormalizedCidr, _ := net.ParseCIDR("192.168.1.100/24")
+	if !m.IsUnderlaySubnetOnHost(unnormalizedCidr) {
+		t.Errorf("expect subnet %v on host", unnormalizedCidr)
+	}
+
+	for _, cidr := range []*net.IPNet{offHostCidr, overlayCidr} {
+		if m.IsUnderlaySubnetOnHost(cidr) {
+			t.Errorf("expect subnet %v not on host", cidr)
+		}
+	}
+
+	testCases := []struct {
+		ip       string
+		cidr     string
+		onHost   bool
+		notFound bool
+	}{
+		{"192.168.1.10", "192.168.1.0/24", true, false},
+		{"192.168.2.10", "192.168.2.0/24", false, false},
+		{"10.0.1.10", "10.0.1.0/24", false, false},
+		{"10.0.2.10", "10.0.0.0/16", false, false},
+		{"172.16.0.1", "", false, true},
+	}
+
+	for _, tc := range testCases {
+		info, found := m.FindSubnetInfoByIP(net.ParseIP(tc.ip))
+		if found == tc.notFound {
+			t.Errorf("ip %v: expect found %v but got %v", tc.ip, !tc.notFound, found)
+			continue
+		}
+
+		if !found {
+			continue
+		}
+
+		if info.CIDR().String() != tc.cidr || info.IsUnderlayOnHost() != tc.onHost {
+			t.Errorf("ip %v: expect subnet %v on host %v, but got %v on host %v",
+				tc.ip, tc.cidr, tc.onHost, info.CIDR(), info.IsUnderlayOnHost())
+		}
+	}
+}
+
+func TestFromPodSubnetRuleOfUnselectedOverlaySubnet(t *testing.T) {
+	_, overlayCidr, _ := net.ParseCIDR("10.0.0.0/24")
+	rule := netlink.Rule{Src: overlayCidr, Table: 10000}
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.AddSubnetInfo(overlayCidr, nil, nil, nil, nil, "eth0.vxlan4", true, true, true,
+		networkingv1.NetworkModeVxlan)
+	if !m.checkFromPodSubnetRuleExpected(rule) {
+		t.Fatalf("expect rule of selected overlay subnet %v to be kept", overlayCidr)
+	}
+
+	// the overlay network stops selecting this node, its subnets are not recorded any more
+	m.ResetInfos()
+	if m.checkFromPodSubnetRuleExpected(rule) {
+		t.Errorf("expect rule of unselected overlay subnet %v to be cleaned up", overlayCidr)
+	}
+}
+
+func TestFromPodSubnetRuleOfUnderlaySubnetLeavingHost(t *testing.T) {
+	_, underlayCidr, _ := net.ParseCIDR("192.168.1.0/24")
+	rule := netlink.Rule{Src: underlayCidr, Table: 10000}
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.AddSubnetInfo(underlayCidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0", false, false, true,
+		networkingv1.NetworkModeBGP)
+	if !m.checkFromPodSubnetRuleExpected(rule) {
+		t.Fatalf("expect rule of underlay subnet %v on host to be kept", underlayCidr)
+	}
+
+	// this node is removed from the node list of bgp network, its subnets are recorded as remote ones
+	m.ResetInfos()
+	m.AddSubnetInfo(underlayCidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "", false, false, false,
+		networkingv1.NetworkModeBGP)
+	if m.checkFromPodSubnetRuleExpected(rule) {
+		t.Errorf("expect rule of underlay subnet %v leaving host to be cleaned up", underlayCidr)
+	}
+}
+
+func TestOverlayRoutesFollowUnderlaySubnets(t *testing.T) {
+	forwardLink := &netlink.Vxlan{LinkAttrs: netlink.LinkAttrs{Name: "eth0.vxlan4", Index: 10}}
+
+	_, overlayCidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, underlayCidr1, _ := net.ParseCIDR("192.168.1.0/24")
+	_, underlayCidr2, _ := net.ParseCIDR("192.168.2.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	desiredOverlayRouteDsts := func() []string {
+		var dsts []string
+		routes := desiredRoutesForVxlanSubnet(forwardLink, 10000, true, netlink.FAMILY_V4,
+			combineSubnetInfoMap(m.localClusterUnderlaySubnetInfoMap, m.remoteUnderlaySubnetInfoMap), nil, nil, nil)
+		for _, route := range routes {
+			dsts = append(dsts, route.Dst.String())
+		}
+		sort.Strings(dsts)
+		return dsts
+	}
+
+	m.AddSubnetInfo(overlayCidr, nil, nil, nil, nil, "eth0.vxlan4", true, true, true,
+		networkingv1.NetworkModeVxlan)
+	m.AddSubnetInfo(underlayCidr1, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0.10", false, false, true,
+		networkingv1.NetworkModeVlan)
+	if dsts := desiredOverlayRouteDsts(); !reflect.DeepEqual(dsts, []string{underlayCidr1.String()}) {
+		t.Fatalf("unexpected overlay routes to %v", dsts)
+	}
+
+	// an underlay subnet is added without any change of the overlay subnet, infos are rebuilt in the next sync
+	m.ResetInfos()
+	m.AddSubnetInfo(overlayCidr, nil, nil, nil, nil, "eth0.vxlan4", true, true, true,
+		networkingv1.NetworkModeVxlan)
+	m.AddSubnetInfo(underlayCidr1, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0.10", false, false, true,
+		networkingv1.NetworkModeVlan)
+	m.AddSubnetInfo(underlayCidr2, net.ParseIP("192.168.2.1"), nil, nil, nil, "eth0.20", false, false, false,
+		networkingv1.NetworkModeVlan)
+	if dsts := desiredOverlayRouteDsts(); !reflect.DeepEqual(dsts, []string{underlayCidr1.String(), underlayCidr2.String()}) {
+		t.Errorf("expect overlay table to gain a direct route to new underlay subnet, but got routes to %v", dsts)
+	}
+}
+
+func TestSubnetModeChanged(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.1.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	if m.subnetModeChanged(cidr, networkingv1.NetworkModeVlan) {
+		t.Errorf("expect mode of a new subnet not changed")
+	}
+
+	// routes of vlan mode have been programmed
+	m.subnetModeMap[CanonicalCIDRKey(cidr)] = networkingv1.NetworkModeVlan
+	if m.subnetModeChanged(cidr, networkingv1.NetworkModeVlan) {
+		t.Errorf("expect mode not changed")
+	}
+
+	if !m.subnetModeChanged(cidr, networkingv1.NetworkModeVxlan) {
+		t.Fatalf("expect mode changed from vlan to vxlan")
+	}
+
+	// the whole table will be cleared before programming vxlan routes, so the vlan direct route is gone
+	vlanDirectRoute := netlink.Route{Dst: cidr, LinkIndex: 2, Table: 10000, Scope: netlink.SCOPE_LINK}
+	vlanDefaultRoute := netlink.Route{Gw: net.ParseIP("192.168.1.1"), LinkIndex: 2, Table: 10000}
+	routesToClear := filterRoutesToClear([]netlink.Route{vlanDirectRoute, vlanDefaultRoute}, isOperatorPinnedRoute)
+	if len(routesToClear) != 2 || routesToClear[0].Dst.String() != cidr.String() {
+		t.Errorf("expect vlan direct route to be cleared, but got %v", routesToClear)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+// sharedRouteTables records how from-pod-subnet route tables are shared among compatible subnets in one sync.
+type sharedRouteTables struct {
+	// route tables which can be shared, which are keyed by share key of subnets
+	keyTableMap map[string]int
+
+	// cidrs of the subnets whose from-pod-subnet rules point to the table, which are keyed by table num
+	tableMembers map[int][]*net.IPNet
+
+	// subnets which are not compatible with the others in the same table, their rules need to be moved
+	evictedSubnets map[string]bool
+
+	// cidrs of the subnets whose from-pod-subnet rules point to the table in kernel, including the evicted ones
+	// which have not been moved yet, which are keyed by table num
+	referencingSubnets map[int][]*net.IPNet
+}
+
+// SetRouteTableSharing sets if compatible subnets share a single route table with their own from-pod-subnet rules,
+// which reduces route table consumption on nodes with lots of subnets.
+func (m *Manager) SetRouteTableSharing(enabled bool) {
+	m.routeTableSharingEnabled = enabled
+}
+
+// routeTableShareKey returns a key identifying the routes in the table of subnet, subnets with the same
+// non-empty key have identical routes and can share one table. Vlan subnets have a direct route of their
+// own cidr, so they can never share.
+func routeTableShareKey(info *SubnetInfo) string {
+	switch info.mode {
+	case networkingv1.NetworkModeVxlan:
+		destinations := make([]string, 0, len(info.overlayDestinations))
+		for _, destination := range info.overlayDestinations {
+			destinations = append(destinations, CanonicalCIDRKey(destination))
+		}
+		sort.Strings(destinations)
+
+		return fmt.Sprintf("%v/%v/%v/%v/%v/%v/%v", info.mode, info.forwardNodeIfName, info.autoNatOutgoing,
+			info.egressGateway, strings.Join(destinations, ","), info.routeMTU, info.routeAdvMSS)
+	case networkingv1.NetworkModeBGP, networkingv1.NetworkModeGlobalBGP:
+		return fmt.Sprintf("%v/%v/%v/%v/%v", info.mode, info.forwardNodeIfName, info.gateway, info.routeSrc,
+			strings.Join(sortedGatewayKeys(info.bgpGateways), ","))
+	default:
+		return ""
+	}
+}
+
+// shareKeyOf returns the share key of subnet, which is always empty if sharing is disabled.
+func (m *Manager) shareKeyOf(info *SubnetInfo) string {
+	if !m.routeTableSharingEnabled {
+		return ""
+	}
+	return routeTableShareKey(info)
+}
+
+// subnetShareKeys returns the share keys of local subnets.
+func (m *Manager) subnetShareKeys() map[string]string {
+	shareKeys := map[string]string{}
+	for cidrString, info := range m.localTotalSubnetInfoMap {
+		shareKeys[cidrString] = m.shareKeyOf(info)
+	}
+	return shareKeys
+}
+
+// planSharedRouteTables decides which subnets keep their current tables. In every table, only the subnets with
+// the most common non-empty share key (or a single subnet if none of them can share) are kept, the others are
+// evicted. Existing tables of different subnets are never merged.
+func planSharedRouteTables(tableMembers map[int][]*net.IPNet, subnetShareKeys map[string]string) *sharedRouteTables {
+	plan := &sharedRouteTables{
+		keyTableMap:        map[string]int{},
+		tableMembers:       map[int][]*net.IPNet{},
+		evictedSubnets:     map[string]bool{},
+		referencingSubnets: map[int][]*net.IPNet{},
+	}
+
+	for table, members := range tableMembers {
+		plan.referencingSubnets[table] = append([]*net.IPNet{}, members...)
+	}
+
+	tables := make([]int, 0, len(tableMembers))
+	for table := range tableMembers {
+		tables = append(tables, table)
+	}
+	sort.Ints(tables)
+
+	for _, table := range tables {
+		members := append([]*net.IPNet{}, tableMembers[table]...)
+		sort.Slice(members, func(i, j int) bool {
+			return CanonicalCIDRKey(members[i]) < CanonicalCIDRKey(members[j])
+		})
+
+		keyMembers := map[string][]*net.IPNet{}
+		for _, member := range members {
+			key := subnetShareKeys[CanonicalCIDRKey(member)]
+			keyMembers[key] = append(keyMembers[key], member)
+		}
+
+		var keptKey string
+		for key, sameKeyMembers := range keyMembers {
+			if key == "" {
+				continue
+			}
+			if keptKey == "" || len(sameKeyMembers) > len(keyMembers[keptKey]) ||
+				(len(sameKeyMembers) == len(keyMembers[keptKey]) && key < keptKey) {
+				keptKey = key
+			}
+		}
+
+		var kept []*net.IPNet
+		if keptKey != "" {
+			kept = keyMembers[keptKey]
+		} else {
+			kept = members[:1]
+		}
+
+		for _, member := range members {
+			if !containsNet(kept, member) {
+				plan.evictedSubnets[CanonicalCIDRKey(member)] = true
+			}
+		}
+		plan.tableMembers[table] = kept
+
+		// Prefer the table with the most subnets if there are several tables for the same key.
+		if keptKey != "" {
+			if existTable, exist := plan.keyTableMap[keptKey]; !exist ||
+				len(kept) > len(plan.tableMembers[existTable]) {
+				plan.keyTableMap[keptKey] = table
+			}
+		}
+	}
+
+	return plan
+}
+
+// tableForKey returns the shared table for key if cidr doesn't overlap with any subnet already in it.
+func (s *sharedRouteTables) tableForKey(key string, cidr *net.IPNet) (int, bool) {
+	if key == "" {
+		return 0, false
+	}
+
+	table, exist := s.keyTableMap[key]
+	if !exist {
+		return 0, false
+	}
+
+	for _, member := range s.tableMembers[table] {
+		if member.Contains(cidr.IP) || cidr.Contains(member.IP) {
+			return 0, false
+		}
+	}
+
+	return table, true
+}
+
+// join records that the from-pod-subnet rule of cidr points to table.
+func (s *sharedRouteTables) join(key string, cidr *net.IPNet, table int) {
+	if !containsNet(s.tableMembers[table], cidr) {
+		s.tableMembers[table] = append(s.tableMembers[table], cidr)
+	}
+	if !containsNet(s.referencingSubnets[table], cidr) {
+		s.referencingSubnets[table] = append(s.referencingSubnets[table], cidr)
+	}
+
+	if _, exist := s.keyTableMap[key]; key != "" && !exist {
+		s.keyTableMap[key] = table
+	}
+}
+
+// leave records that the from-pod-subnet rule of cidr doesn't point to table any more.
+func (s *sharedRouteTables) leave(cidr *net.IPNet, table int) {
+	s.tableMembers[table] = removeNet(s.tableMembers[table], cidr)
+	s.referencingSubnets[table] = removeNet(s.referencingSubnets[table], cidr)
+}
+
+// isReferencedByOthers returns if the rule of any other subnet points to table in kernel, routes of the table
+// must not be cleared for the changes of cidr.
+func (s *sharedRouteTables) isReferencedByOthers(table int, cidr *net.IPNet) bool {
+	for _, member := range s.referencingSubnets[table] {
+		if CanonicalCIDRKey(member) != CanonicalCIDRKey(cidr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isShared returns if any other subnet points to table.
+func (s *sharedRouteTables) isShared(table int, cidr *net.IPNet) bool {
+	for _, member := range s.tableMembers[table] {
+		if CanonicalCIDRKey(member) != CanonicalCIDRKey(cidr) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromPodSubnetRuleTableMembers returns the cidrs of expected from-pod-subnet rules, which are keyed by table num.
+func (m *Manager) fromPodSubnetRuleTableMembers(ruleList []netlink.Rule) map[int][]*net.IPNet {
+	tableMembers := map[int][]*net.IPNet{}
+	for _, rule := range ruleList {
+		if rule.Tos != 0 || !checkIsFromPodSubnetRule(rule, m.tableRange) || !m.checkFromPodSubnetRuleExpected(rule) {
+			continue
+		}
+		tableMembers[rule.Table] = append(tableMembers[rule.Table], rule.Src)
+	}
+	return tableMembers
+}
+
+func containsNet(nets []*net.IPNet, target *net.IPNet) bool {
+	for _, n := range nets {
+		if CanonicalCIDRKey(n) == CanonicalCIDRKey(target) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeNet(nets []*net.IPNet, target *net.IPNet) []*net.IPNet {
+	var remaining []*net.IPNet
+	for _, n := range nets {
+		if CanonicalCIDRKey(n) != CanonicalCIDRKey(target) {
+			remaining = append(remaining, n)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,176 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestRouteTableShareKey(t *testing.T) {
+	_, cidr1, _ := net.ParseCIDR("10.0.0.0/24")
+	_, cidr2, _ := net.ParseCIDR("10.0.1.0/24")
+
+	vxlan1 := &SubnetInfo{cidr: cidr1, forwardNodeIfName: "eth0.vxlan4", autoNatOutgoing: true, mode: networkingv1.NetworkModeVxlan}
+	vxlan2 := &SubnetInfo{cidr: cidr2, forwardNodeIfName: "eth0.vxlan4", autoNatOutgoing: true, mode: networkingv1.NetworkModeVxlan}
+	if routeTableShareKey(vxlan1) == "" || routeTableShareKey(vxlan1) != routeTableShareKey(vxlan2) {
+		t.Errorf("compatible vxlan subnets are expected to have the same share key")
+	}
+
+	vxlan2.routeMTU, vxlan2.routeAdvMSS = 1400, 1360
+	if routeTableShareKey(vxlan1) == routeTableShareKey(vxlan2) {
+		t.Errorf("vxlan subnets with different route mtu should not share")
+	}
+
+	vxlan1.routeMTU = 1400
+	if routeTableShareKey(vxlan1) == routeTableShareKey(vxlan2) {
+		t.Errorf("vxlan subnets with different route advmss should not share")
+	}
+
+	vxlan1.routeAdvMSS = 1360
+	vxlan2.autoNatOutgoing = false
+	if routeTableShareKey(vxlan1) == routeTableShareKey(vxlan2) {
+		t.Errorf("vxlan subnets with different autoNatOutgoing should not share")
+	}
+
+	bgp1 := &SubnetInfo{cidr: cidr1, forwardNodeIfName: "eth0", gateway: net.ParseIP("192.168.0.1"), mode: networkingv1.NetworkModeBGP}
+	bgp2 := &SubnetInfo{cidr: cidr2, forwardNodeIfName: "eth0", gateway: net.ParseIP("192.168.0.2"), mode: networkingv1.NetworkModeBGP}
+	if routeTableShareKey(bgp1) == routeTableShareKey(bgp2) {
+		t.Errorf("bgp subnets with different gateways should not share")
+	}
+
+	bgp2.gateway = bgp1.gateway
+	bgp1.bgpGateways = []net.IP{net.ParseIP("192.168.0.1"), net.ParseIP("192.168.0.2")}
+	if routeTableShareKey(bgp1) == routeTableShareKey(bgp2) {
+		t.Errorf("bgp subnets with different ecmp gateways should not share")
+	}
+
+	bgp2.bgpGateways = []net.IP{net.ParseIP("192.168.0.2"), net.ParseIP("192.168.0.1"), net.ParseIP("192.168.0.2")}
+	if routeTableShareKey(bgp1) != routeTableShareKey(bgp2) {
+		t.Errorf("bgp subnets with the same set of ecmp gateways are expected to share")
+	}
+
+	vlan := &SubnetInfo{cidr: cidr1, forwardNodeIfName: "eth0.10", gateway: net.ParseIP("10.0.0.1"), mode: networkingv1.NetworkModeVlan}
+	if routeTableShareKey(vlan) != "" {
+		t.Errorf("vlan subnets should never share")
+	}
+}
+
+func TestPlanSharedRouteTables(t *testing.T) {
+	_, cidr1, _ := net.ParseCIDR("10.0.0.0/24")
+	_, cidr2, _ := net.ParseCIDR("10.0.1.0/24")
+	_, cidr3, _ := net.ParseCIDR("10.0.2.0/24")
+	_, cidr4, _ := net.ParseCIDR("10.0.3.0/24")
+	_, cidr5, _ := net.ParseCIDR("10.0.4.0/24")
+
+	shareKeys := map[string]string{
+		CanonicalCIDRKey(cidr1): "a",
+		CanonicalCIDRKey(cidr2): "a",
+		CanonicalCIDRKey(cidr3): "b",
+		CanonicalCIDRKey(cidr4): "",
+		CanonicalCIDRKey(cidr5): "",
+	}
+
+	plan := planSharedRouteTables(map[int][]*net.IPNet{
+		10000: {cidr1, cidr2, cidr3},
+		10001: {cidr4, cidr5},
+	}, shareKeys)
+
+	if table, exist := plan.keyTableMap["a"]; !exist || table != 10000 {
+		t.Errorf("expect table 10000 for key a, but got %v", plan.keyTableMap)
+	}
+	if _, exist := plan.keyTableMap["b"]; exist {
+		t.Errorf("key b should not own any table")
+	}
+
+	expectedEvicted := []*net.IPNet{cidr3, cidr5}
+	if len(plan.evictedSubnets) != len(expectedEvicted) {
+		t.Fatalf("expect evicted subnets %v, but got %v", expectedEvicted, plan.evictedSubnets)
+	}
+	for _, cidr := range expectedEvicted {
+		if !plan.evictedSubnets[CanonicalCIDRKey(cidr)] {
+			t.Errorf("subnet %v is expected to be evicted", cidr)
+		}
+	}
+
+	if len(plan.tableMembers[10000]) != 2 || len(plan.tableMembers[10001]) != 1 ||
+		!containsNet(plan.tableMembers[10001], cidr4) {
+		t.Errorf("unexpected table members %v", plan.tableMembers)
+	}
+}
+
+func TestSharedRouteTablesJoin(t *testing.T) {
+	_, cidr1, _ := net.ParseCIDR("10.0.0.0/24")
+	_, cidr2, _ := net.ParseCIDR("10.0.1.0/24")
+	_, overlapped, _ := net.ParseCIDR("10.0.0.0/16")
+
+	plan := planSharedRouteTables(map[int][]*net.IPNet{}, map[string]string{})
+
+	if _, shared := plan.tableForKey("a", cidr1); shared {
+		t.Fatalf("no table is expected to be shared before any subnet joins")
+	}
+
+	plan.join("a", cidr1, 10000)
+
+	table, shared := plan.tableForKey("a", cidr2)
+	if !shared || table != 10000 {
+		t.Fatalf("expect subnet %v to share table 10000, but got %v %v", cidr2, table, shared)
+	}
+	plan.join("a", cidr2, table)
+
+	if !plan.isShared(10000, cidr1) || len(plan.tableMembers[10000]) != 2 {
+		t.Errorf("expect table 10000 to be shared by two subnets, but got %v", plan.tableMembers[10000])
+	}
+
+	if _, shared := plan.tableForKey("a", overlapped); shared {
+		t.Errorf("overlapped subnet %v should not share table", overlapped)
+	}
+
+	if _, shared := plan.tableForKey("", cidr2); shared {
+		t.Errorf("empty share key should never share table")
+	}
+
+	if _, shared := plan.tableForKey("b", cidr2); shared {
+		t.Errorf("subnet with different share key should not share table")
+	}
+}
+
+func TestFromPodSubnetRuleTableMembers(t *testing.T) {
+	_, cidr1, _ := net.ParseCIDR("10.0.0.0/24")
+	_, cidr2, _ := net.ParseCIDR("10.0.1.0/24")
+	_, removed, _ := net.ParseCIDR("10.0.2.0/24")
+
+	manager := newTestManager(netlink.FAMILY_V4)
+	manager.AddSubnetInfo(cidr1, nil, nil, nil, nil, "eth0.vxlan4", true, true, false, networkingv1.NetworkModeVxlan)
+	manager.AddSubnetInfo(cidr2, nil, nil, nil, nil, "eth0.vxlan4", true, true, false, networkingv1.NetworkModeVxlan)
+
+	ruleList := []netlink.Rule{
+		{Src: cidr1, Table: MinRouteTableNum, Mask: DefaultFromRuleMask},
+		{Src: cidr2, Table: MinRouteTableNum, Mask: DefaultFromRuleMask},
+		{Src: removed, Table: MinRouteTableNum + 1, Mask: DefaultFromRuleMask},
+		{Src: cidr1, Table: MinRouteTableNum + 2, Mask: DefaultFromRuleMask, Tos: 8},
+	}
+
+	tableMembers := manager.fromPodSubnetRuleTableMembers(ruleList)
+	if len(tableMembers) != 1 || len(tableMembers[MinRouteTableNum]) != 2 {
+		t.Fatalf("expect separate rules of two subnets pointing to the shared table, but got %v", tableMembers)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// pendingDeleteTable is the route table of a removed subnet which is kept for a grace period.
+type pendingDeleteTable struct {
+	table    int
+	deadline time.Time
+}
+
+// SetTableDeleteGracePeriod sets how long the route table of a removed subnet is kept before being flushed. If the
+// same subnet reappears within the grace period, its table will be reclaimed intact. Zero means flushing immediately.
+func (m *Manager) SetTableDeleteGracePeriod(gracePeriod time.Duration) {
+	m.tableDeleteGracePeriod = gracePeriod
+}
+
+// NextPendingTableDeleteDeadline returns the earliest deadline of the route tables waiting to be flushed.
+func (m *Manager) NextPendingTableDeleteDeadline() (time.Time, bool) {
+	var next time.Time
+	for _, pending := range m.pendingDeleteTableMap {
+		if next.IsZero() || pending.deadline.Before(next) {
+			next = pending.deadline
+		}
+	}
+	return next, !next.IsZero()
+}
+
+func (m *Manager) markTablePendingDelete(cidr *net.IPNet, table int, now time.Time) {
+	m.pendingDeleteTableMap[CanonicalCIDRKey(cidr)] = &pendingDeleteTable{
+		table:    table,
+		deadline: now.Add(m.tableDeleteGracePeriod),
+	}
+}
+
+// reclaimPendingDeleteTable takes back the route table of subnet if its grace period has not expired.
+func (m *Manager) reclaimPendingDeleteTable(cidr *net.IPNet, now time.Time) (int, bool) {
+	cidrString := CanonicalCIDRKey(cidr)
+
+	pending, exist := m.pendingDeleteTableMap[cidrString]
+	if !exist || now.After(pending.deadline) {
+		return 0, false
+	}
+
+	delete(m.pendingDeleteTableMap, cidrString)
+	return pending.table, true
+}
+
+func (m *Manager) pendingDeleteTableNums() []int {
+	var tables []int
+	for _, pending := range m.pendingDeleteTableMap {
+		tables = append(tables, pending.table)
+	}
+	return tables
+}
+
+// expiredPendingDeleteTables returns the subnets whose route tables need to be flushed at the time.
+func (m *Manager) expiredPendingDeleteTables(now time.Time) []string {
+	var expired []string
+	for cidrString, pending := range m.pendingDeleteTableMap {
+		if now.After(pending.deadline) {
+			expired = append(expired, cidrString)
+		}
+	}
+	return expired
+}
+
+func (m *Manager) finalizePendingDeleteTables(now time.Time) error {
+	for _, cidrString := range m.expiredPendingDeleteTables(now) {
+		table := m.pendingDeleteTableMap[cidrString].table
+		if err := clearRouteTable(table, m.family, isOperatorPinnedRoute); err != nil {
+			return fmt.Errorf("failed to clear route table %v of removed subnet %v: %v", table, cidrString, err)
+		}
+
+		delete(m.pendingDeleteTableMap, cidrString)
+		delete(m.subnetModeMap, cidrString)
+	}
+	return nil
+}
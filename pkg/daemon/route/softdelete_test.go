@@ -0,0 +1,79 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestReclaimPendingDeleteTable(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/24")
+	now := time.Now()
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.SetTableDeleteGracePeriod(time.Minute)
+	m.markTablePendingDelete(cidr, 10001, now)
+
+	if tables := m.pendingDeleteTableNums(); len(tables) != 1 || tables[0] != 10001 {
+		t.Fatalf("expect table 10001 to be reserved, but got %v", tables)
+	}
+
+	if deadline, exist := m.NextPendingTableDeleteDeadline(); !exist || !deadline.Equal(now.Add(time.Minute)) {
+		t.Errorf("expect next deadline %v, but got %v", now.Add(time.Minute), deadline)
+	}
+
+	if expired := m.expiredPendingDeleteTables(now.Add(30 * time.Second)); len(expired) != 0 {
+		t.Errorf("expect no expired table within grace period, but got %v", expired)
+	}
+
+	table, reclaimed := m.reclaimPendingDeleteTable(cidr, now.Add(30*time.Second))
+	if !reclaimed || table != 10001 {
+		t.Fatalf("expect table 10001 to be reclaimed within grace period, but got %v %v", table, reclaimed)
+	}
+
+	if _, reclaimed := m.reclaimPendingDeleteTable(cidr, now.Add(30*time.Second)); reclaimed {
+		t.Errorf("expect table to be reclaimed only once")
+	}
+
+	if _, exist := m.NextPendingTableDeleteDeadline(); exist {
+		t.Errorf("expect no pending table after reclaimed")
+	}
+}
+
+func TestFinalizePendingDeleteTableAfterGracePeriod(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, otherCidr, _ := net.ParseCIDR("10.0.1.0/24")
+	now := time.Now()
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.SetTableDeleteGracePeriod(time.Minute)
+	m.markTablePendingDelete(cidr, 10001, now)
+	m.markTablePendingDelete(otherCidr, 10002, now.Add(time.Minute))
+
+	if _, reclaimed := m.reclaimPendingDeleteTable(cidr, now.Add(2*time.Minute)); reclaimed {
+		t.Errorf("expect table not to be reclaimed after grace period")
+	}
+
+	expired := m.expiredPendingDeleteTables(now.Add(90 * time.Second))
+	if len(expired) != 1 || expired[0] != CanonicalCIDRKey(cidr) {
+		t.Errorf("expect only %v to be expired, but got %v", cidr, expired)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+)
+
+// LocalSubnetSummary is an operator-friendly summary of a local subnet from the view of this node.
+type LocalSubnetSummary struct {
+	CIDR              string `json:"cidr"`
+	Mode              string `json:"mode"`
+	Table             int    `json:"table,omitempty"`
+	ForwardNodeIfName string `json:"forwardNodeIfName,omitempty"`
+	AutoNatOutgoing   bool   `json:"autoNatOutgoing"`
+	IsOverlay         bool   `json:"isOverlay"`
+	IsUnderlayOnHost  bool   `json:"isUnderlayOnHost"`
+}
+
+// LocalSubnetSummaries returns the summaries of all the local subnets with the route tables resolved from
+// from-pod-subnet rules. It is read-only and must not be called concurrently with SyncRoutes.
+func (m *Manager) LocalSubnetSummaries() ([]LocalSubnetSummary, error) {
+	ruleList, err := netlink.RuleList(m.family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %v", err)
+	}
+
+	return m.summarizeLocalSubnets(ruleList), nil
+}
+
+func (m *Manager) summarizeLocalSubnets(ruleList []netlink.Rule) []LocalSubnetSummary {
+	subnetTableMap := map[string]int{}
+	for _, rule := range ruleList {
+		if checkIsFromPodSubnetRule(rule, m.tableRange) && rule.Tos == 0 {
+			subnetTableMap[CanonicalCIDRKey(rule.Src)] = rule.Table
+		}
+	}
+
+	summaries := make([]LocalSubnetSummary, 0, len(m.localTotalSubnetInfoMap))
+	for cidrString, info := range m.localTotalSubnetInfoMap {
+		_, isOverlay := m.localClusterOverlaySubnetInfoMap[cidrString]
+
+		summaries = append(summaries, LocalSubnetSummary{
+			CIDR:              cidrString,
+			Mode:              string(info.mode),
+			Table:             subnetTableMap[cidrString],
+			ForwardNodeIfName: info.forwardNodeIfName,
+			AutoNatOutgoing:   info.autoNatOutgoing,
+			IsOverlay:         isOverlay,
+			IsUnderlayOnHost:  info.isUnderlayOnHost,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].CIDR < summaries[j].CIDR
+	})
+
+	return summaries
+}
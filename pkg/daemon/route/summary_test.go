@@ -0,0 +1,70 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestSummarizeLocalSubnets(t *testing.T) {
+	_, overlayCidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, underlayCidr, _ := net.ParseCIDR("192.168.1.0/24")
+	_, otherUnderlayCidr, _ := net.ParseCIDR("192.168.2.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.AddSubnetInfo(overlayCidr, nil, nil, nil, nil, "eth0.vxlan4", true, true, false,
+		networkingv1.NetworkModeVxlan)
+	m.AddSubnetInfo(underlayCidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0.100", false, false, true,
+		networkingv1.NetworkModeVlan)
+	m.AddSubnetInfo(otherUnderlayCidr, net.ParseIP("192.168.2.1"), nil, nil, nil, "", false, false, false,
+		networkingv1.NetworkModeVlan)
+
+	newFromPodSubnetRule := func(src *net.IPNet, table, tos int) netlink.Rule {
+		rule := netlink.NewRule()
+		rule.Src = src
+		rule.Table = table
+		rule.Tos = uint(tos)
+		rule.Mark = fromRuleMark
+		rule.Mask = DefaultFromRuleMask
+		return *rule
+	}
+
+	summaries := m.summarizeLocalSubnets([]netlink.Rule{
+		newFromPodSubnetRule(overlayCidr, MinRouteTableNum, 0),
+		newFromPodSubnetRule(underlayCidr, MinRouteTableNum+1, 0),
+		// dscp rule should not be taken as the table of subnet
+		newFromPodSubnetRule(underlayCidr, MinRouteTableNum+2, 0x28),
+	})
+
+	expected := []LocalSubnetSummary{
+		{CIDR: "10.0.0.0/24", Mode: "VXLAN", Table: MinRouteTableNum, ForwardNodeIfName: "eth0.vxlan4",
+			AutoNatOutgoing: true, IsOverlay: true},
+		{CIDR: "192.168.1.0/24", Mode: "VLAN", Table: MinRouteTableNum + 1, ForwardNodeIfName: "eth0.100",
+			IsUnderlayOnHost: true},
+		{CIDR: "192.168.2.0/24", Mode: "VLAN"},
+	}
+
+	if fmt.Sprint(summaries) != fmt.Sprint(expected) {
+		t.Errorf("expect summaries %v, but got %v", expected, summaries)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+)
+
+// routeTableFlushGuard logs the flushes of route tables which are still referenced by rules.
+var routeTableFlushGuard = logr.Discard()
+
+// SetRouteTableFlushGuardLogger sets the logger to warn about the route tables flushed while rules still point at
+// them, whose traffic will be black-holed by the empty tables. It should be called before any route manager syncs.
+func SetRouteTableFlushGuardLogger(logger logr.Logger) {
+	routeTableFlushGuard = logger
+}
+
+// RemoveSubnet removes a local subnet and tears down its from-pod-subnet rules and route tables immediately,
+// other routes referring to it are cleaned by the next SyncRoutes.
+func (m *Manager) RemoveSubnet(cidr *net.IPNet) error {
+	if m.IsPaused() {
+		return fmt.Errorf("route reconciliation is paused, refuse to remove subnet %v", cidr)
+	}
+
+	cidrString := CanonicalCIDRKey(cidr)
+
+	// recorded maps might have been published to lookups
+	m.syncedSubnetInfoMutex.Lock()
+	delete(m.localTotalSubnetInfoMap, cidrString)
+	delete(m.localClusterOverlaySubnetInfoMap, cidrString)
+	delete(m.localClusterUnderlaySubnetInfoMap, cidrString)
+	m.syncedSubnetInfoMutex.Unlock()
+
+	ruleList, err := netlink.RuleList(m.family)
+	if err != nil {
+		return fmt.Errorf("failed to list rule: %v", err)
+	}
+
+	tableMembers := m.fromPodSubnetRuleTableMembers(ruleList)
+	for _, rule := range ruleList {
+		if !checkIsFromPodSubnetRule(rule, m.tableRange) || CanonicalCIDRKey(rule.Src) != cidrString {
+			continue
+		}
+
+		if err := m.teardownFromPodSubnetRule(rule, tableMembers); err != nil {
+			return fmt.Errorf("failed to remove subnet %v: %v", cidrString, err)
+		}
+	}
+
+	return nil
+}
+
+// teardownFromPodSubnetRule deletes a from-pod-subnet rule which is not supposed to exist, and then flushes its
+// route table. The order matters, if routes are flushed first, traffic is still steered by the rule into an empty
+// table and black-holed. tableMembers are the cidrs of expected rules keyed by table, tables referenced by them
+// are shared with other subnets and never flushed.
+func (m *Manager) teardownFromPodSubnetRule(rule netlink.Rule, tableMembers map[int][]*net.IPNet) error {
+	rule.Family = m.family
+	if err := netlink.RuleDel(&rule); err != nil {
+		return fmt.Errorf("del subnet policy rule error: %v", err)
+	}
+
+	// The table is shared with other subnets, only the rule of removed subnet is deleted.
+	if rule.Tos == 0 && len(tableMembers[rule.Table]) > 0 {
+		delete(m.subnetModeMap, CanonicalCIDRKey(rule.Src))
+		return nil
+	}
+
+	// Keep the table of removed subnet for a grace period in case it reappears soon.
+	if rule.Tos == 0 && m.tableDeleteGracePeriod > 0 {
+		m.markTablePendingDelete(rule.Src, rule.Table, time.Now())
+		return nil
+	}
+
+	if err := clearRouteTable(rule.Table, m.family, isOperatorPinnedRoute); err != nil {
+		return fmt.Errorf("failed to clear route table %v: %v", rule.Table, err)
+	}
+
+	if rule.Tos == 0 {
+		delete(m.subnetModeMap, CanonicalCIDRKey(rule.Src))
+	}
+	return nil
+}
+
+// warnIfRouteTableReferenced warns if the route table to be flushed is still referenced by rules.
+func warnIfRouteTableReferenced(table, family int) {
+	ruleList, err := netlink.RuleList(family)
+	if err != nil {
+		routeTableFlushGuard.Error(err, "failed to list rules for checking route table references", "table", table)
+		return
+	}
+
+	checkRouteTableReferenced(routeTableFlushGuard, ruleList, table)
+}
+
+// checkRouteTableReferenced logs a warning and returns true if any rule of ruleList points at table.
+func checkRouteTableReferenced(logger logr.Logger, ruleList []netlink.Rule, table int) bool {
+	var referencingRules []string
+	for _, rule := range ruleList {
+		if rule.Table == table {
+			referencingRules = append(referencingRules, rule.String())
+		}
+	}
+
+	if len(referencingRules) == 0 {
+		return false
+	}
+
+	logger.Info("flushing route table still referenced by rules, traffic might be black-holed",
+		"table", table, "rules", referencingRules)
+	return true
+}
@@ -0,0 +1,57 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/vishvananda/netlink"
+)
+
+func TestCheckRouteTableReferenced(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/24")
+
+	rule := netlink.NewRule()
+	rule.Src = cidr
+	rule.Table = MinRouteTableNum
+	rule.Mark = fromRuleMark
+	rule.Mask = DefaultFromRuleMask
+	ruleList := []netlink.Rule{*rule, {Table: 39999, Priority: 1}}
+
+	var logs []string
+	logger := funcr.New(func(prefix, args string) {
+		logs = append(logs, args)
+	}, funcr.Options{})
+
+	if !checkRouteTableReferenced(logger, ruleList, MinRouteTableNum) {
+		t.Errorf("expect table %v to be referenced", MinRouteTableNum)
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0], "flushing route table") || !strings.Contains(logs[0], "10.0.0.0/24") {
+		t.Errorf("expect a warning about the referencing rule, but got %v", logs)
+	}
+
+	logs = nil
+	if checkRouteTableReferenced(logger, ruleList, MinRouteTableNum+1) {
+		t.Errorf("expect table %v not to be referenced", MinRouteTableNum+1)
+	}
+	if len(logs) != 0 {
+		t.Errorf("expect no warning for unreferenced table, but got %v", logs)
+	}
+}
@@ -19,6 +19,10 @@ package route
 import (
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/alibaba/hybridnet/pkg/daemon/iptables"
 
@@ -27,26 +31,42 @@ import (
 	"golang.org/x/sys/unix"
 
 	daemonutils "github.com/alibaba/hybridnet/pkg/daemon/utils"
+	"github.com/alibaba/hybridnet/pkg/metrics"
+	"github.com/alibaba/hybridnet/pkg/utils"
 
 	"github.com/vishvananda/netlink"
 )
 
 const (
+	// MinRouteTableNum and MaxRouteTableNum are the default range of route tables allocated for subnets, max
+	// is exclusive and fixed tables in range are never allocated
 	MinRouteTableNum = 10000
 	MaxRouteTableNum = 40000
 
 	MaxRulePriority   = 32767
 	NodeLocalTableNum = 255
 
-	fromRuleMask = iptables.KubeProxyMasqueradeMark + iptables.FullNATedPodTrafficMark
+	// DefaultRulePriorityFallbackBase leaves room for rules of others in front of hybridnet rules
+	// while node local rule is not found
+	DefaultRulePriorityFallbackBase = 100
+
 	fromRuleMark = 0x0
+
+	defaultIPv6RouteMetric = 1024
 )
 
+// DefaultFromRuleMask is the mask of from-pod-subnet rules computed from the default traffic marks.
+var DefaultFromRuleMask = computeFromRuleMask(iptables.KubeProxyMasqueradeMark, iptables.FullNATedPodTrafficMark)
+
+func computeFromRuleMask(kubeProxyMasqueradeMark, fullNATedPodTrafficMark int) int {
+	return kubeProxyMasqueradeMark | fullNATedPodTrafficMark
+}
+
 type SubnetInfo struct {
 	cidr             *net.IPNet
 	gateway          net.IP
 	excludeIPs       []net.IP
-	includedIPRanges []*daemonutils.IPRange
+	includedIPRanges []*utils.IPRange
 
 	// the virtual network interface (can be directly physical interface) for container to use
 	forwardNodeIfName string
@@ -58,10 +78,56 @@ type SubnetInfo struct {
 	isUnderlayOnHost bool
 
 	mode networkingv1.NetworkMode
+
+	// optional gateways for the traffic marked with specific DSCP values
+	dscpGateways map[uint8]net.IP
+
+	// if not empty, routes to these destinations rather than a default route will be installed
+	// for overlay pod traffic which doesn't need to be NATed
+	overlayDestinations []*net.IPNet
+
+	// optional source ip of the default route for bgp subnets, which must be assigned on this node
+	routeSrc net.IP
+
+	// optional gateways of the ecmp default route for bgp subnets, which override the subnet gateway
+	bgpGateways []net.IP
+
+	// optional vtep ip of the egress gateway node, to which the outside traffic of overlay pods is routed
+	// instead of being NATed locally
+	egressGateway net.IP
+
+	// optional mtu and advmss of the routes through vxlan device, to avoid path mtu black holes for tcp
+	routeMTU    int
+	routeAdvMSS int
+}
+
+// CIDR returns the cidr of subnet.
+func (info *SubnetInfo) CIDR() *net.IPNet {
+	return info.cidr
+}
+
+// IsUnderlayOnHost returns true if subnet is an underlay subnet on this node.
+func (info *SubnetInfo) IsUnderlayOnHost() bool {
+	return info.isUnderlayOnHost
 }
 
 type SubnetInfoMap map[string]*SubnetInfo
 
+// CanonicalCIDRKey masks the host bits of cidr and returns a stable string form of it, so that
+// equal CIDRs in different formats (e.g. "10.0.0.5/24" and "10.0.0.0/24") are mapped to the same key.
+func CanonicalCIDRKey(cidr *net.IPNet) string {
+	if cidr == nil {
+		return ""
+	}
+
+	ip := cidr.IP.Mask(cidr.Mask)
+	if ip == nil {
+		return cidr.String()
+	}
+
+	return (&net.IPNet{IP: ip, Mask: cidr.Mask}).String()
+}
+
 func checkIfRouteTableEmpty(tableNum, family int) (bool, error) {
 	routeList, err := netlink.RouteListFiltered(family, &netlink.Route{
 		Table: tableNum,
@@ -90,58 +156,113 @@ func listRoutesByTable(tableNum, family int) ([]netlink.Route, error) {
 	return routeList, nil
 }
 
-// findHighestUnusedRulePriority find out the highest unused rule priority after node local rule
-func findHighestUnusedRulePriority(family int) (int, error) {
+// findHighestUnusedRulePriority find out the highest unused rule priority after node local rule,
+// if node local rule is not found, the highest unused priority after fallbackBase will be returned
+func findHighestUnusedRulePriority(family, fallbackBase int) (int, bool, error) {
 	ruleList, err := netlink.RuleList(family)
 	if err != nil {
-		return -1, fmt.Errorf("failed to list rules: %v", err)
+		return -1, false, fmt.Errorf("failed to list rules: %v", err)
 	}
 
+	return pickHighestUnusedRulePriority(ruleList, fallbackBase)
+}
+
+func pickHighestUnusedRulePriority(ruleList []netlink.Rule, fallbackBase int) (int, bool, error) {
 	priorityMap := map[int]bool{}
+	nodeLocalRuleFound := false
 	nodeLocalRulePrio := 0
 	for _, rule := range ruleList {
 		if rule.Table == NodeLocalTableNum {
+			nodeLocalRuleFound = true
 			nodeLocalRulePrio = realRulePriority(rule.Priority)
 		}
 		priorityMap[realRulePriority(rule.Priority)] = true
 	}
 
+	basePriority := nodeLocalRulePrio
+	if !nodeLocalRuleFound {
+		basePriority = fallbackBase
+	}
+
 	for priority := 0; priority <= MaxRulePriority; priority++ {
 		if _, inUsed := priorityMap[priority]; !inUsed {
 			// priority is not in used and lower than local rule
-			if priority > nodeLocalRulePrio {
-				return priority, nil
+			if priority > basePriority {
+				return priority, nodeLocalRuleFound, nil
 			}
 		}
 	}
 
-	return -1, fmt.Errorf("cannot find unused rule priority")
+	return -1, nodeLocalRuleFound, fmt.Errorf("cannot find unused rule priority")
 }
 
-func appendHighestUnusedPriorityRuleIfNotExist(src *net.IPNet, table, family int, mark, mask int) error {
-	exist, _, err := checkIfRuleExist(src, table, family)
+// appendHighestUnusedPriorityRuleIfNotExist ensures the rule of src pointing to table with mark and mask, rules of
+// the same src and table but with a drifted mark or mask are replaced.
+func (m *Manager) appendHighestUnusedPriorityRuleIfNotExist(src *net.IPNet, table int, mark, mask int) error {
+	ruleList, err := netlink.RuleList(m.family)
 	if err != nil {
-		return fmt.Errorf("failed to check rule (src: %v, table: %v) exist: %v", src.String(), table, err)
+		return fmt.Errorf("failed to list rules: %v", err)
 	}
 
-	if exist {
-		// rule exist
-		return nil
+	rule := netlink.NewRule()
+	rule.Src = src
+	rule.Table = table
+	rule.Family = m.family
+	rule.Mask = mask
+	rule.Mark = mark
+
+	toAdd, toDel := DiffRules([]netlink.Rule{*rule}, filterRulesBySrcAndTable(ruleList, src, table))
+	switch {
+	case len(toAdd) != 0 && len(toDel) != 0:
+		// take the place of the drifted rule to keep the precedence among rules
+		rule.Priority = toDel[0].Priority
+		if err := netlink.RuleAdd(rule); err != nil {
+			return fmt.Errorf("failed to add policy rule %v: %v", rule.String(), err)
+		}
+	case len(toAdd) != 0:
+		if err := m.appendHighestUnusedPriorityRule(rule); err != nil {
+			return err
+		}
 	}
 
-	priority, err := findHighestUnusedRulePriority(family)
+	// delete the drifted rules after the new one is added to avoid traffic falling through
+	for _, driftedRule := range toDel {
+		driftedRule.Family = m.family
+		if err := netlink.RuleDel(&driftedRule); err != nil {
+			return fmt.Errorf("failed to delete drifted policy rule %v: %v", driftedRule.String(), err)
+		}
+	}
+
+	return nil
+}
+
+// filterRulesBySrcAndTable returns the rules of src pointing to table, dscp rules are managed separately.
+func filterRulesBySrcAndTable(ruleList []netlink.Rule, src *net.IPNet, table int) []netlink.Rule {
+	var rules []netlink.Rule
+	for _, rule := range ruleList {
+		if rule.Tos != 0 || rule.Table != table || (src == nil) != (rule.Src == nil) {
+			continue
+		}
+
+		if src == nil || CanonicalCIDRKey(src) == CanonicalCIDRKey(rule.Src) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (m *Manager) appendHighestUnusedPriorityRule(rule *netlink.Rule) error {
+	priority, nodeLocalRuleFound, err := findHighestUnusedRulePriority(m.family, m.rulePriorityFallbackBase)
 	if err != nil {
 		return fmt.Errorf("failed to find highest unused rule priority: %v", err)
 	}
 
-	rule := netlink.NewRule()
-	rule.Src = src
-	rule.Table = table
-	rule.Priority = priority
-	rule.Family = family
-	rule.Mask = mask
-	rule.Mark = mark
+	if !nodeLocalRuleFound {
+		m.logger.Info("node local rule not found, use fallback base rule priority",
+			"table", NodeLocalTableNum, "fallbackBase", m.rulePriorityFallbackBase, "family", m.family)
+	}
 
+	rule.Priority = priority
 	if err := netlink.RuleAdd(rule); err != nil {
 		return fmt.Errorf("failed to add policy rule %v: %v", rule.String(), err)
 	}
@@ -149,27 +270,193 @@ func appendHighestUnusedPriorityRuleIfNotExist(src *net.IPNet, table, family int
 	return nil
 }
 
-// findEmptyRouteTable found the first empty route table in range MinRouteTableNum ~ MaxRouteTableNum
-func findEmptyRouteTable(family int) (int, error) {
-	for i := MinRouteTableNum; i < MaxRouteTableNum; i++ {
-		empty, err := checkIfRouteTableEmpty(i, family)
-		if err != nil {
-			return 0, fmt.Errorf("failed to check route table %v empty: %v", i, err)
+// TableRange is the range of route table numbers allocated for subnets, i.e., [Min, Max). It should not
+// overlap with the tables used by other policy routing daemons.
+type TableRange struct {
+	Min int
+	Max int
+}
+
+// DefaultTableRange is the route table range used if not specified.
+var DefaultTableRange = TableRange{Min: MinRouteTableNum, Max: MaxRouteTableNum}
+
+// Contains returns true if table is in range.
+func (r TableRange) Contains(table int) bool {
+	return table >= r.Min && table < r.Max
+}
+
+// Validate checks if range avoids the reserved tables and fits the table numbers of kernel.
+func (r TableRange) Validate() error {
+	if r.Min < 256 {
+		return fmt.Errorf("min table %v should not be less than 256, tables below are reserved", r.Min)
+	}
+	if int64(r.Max) > 1<<31 {
+		return fmt.Errorf("max table %v should not be greater than %v", r.Max, int64(1<<31))
+	}
+	if r.Min >= r.Max {
+		return fmt.Errorf("min table %v should be less than max table %v", r.Min, r.Max)
+	}
+	return nil
+}
+
+// findEmptyRouteTable found the first empty route table in table range, fixed tables and tables pending deletion
+// will never be chosen. The chosen table is taken as owned by this daemon.
+func (m *Manager) findEmptyRouteTable() (int, error) {
+	// list routes of all tables once rather than checking every table in range one by one,
+	// which might take tens of thousands of netlink requests
+	routeList, err := netlink.RouteListFiltered(m.family, &netlink.Route{
+		Table: unix.RT_TABLE_UNSPEC,
+	}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list routes of all tables: %v", err)
+	}
+
+	if table, found := findFirstEmptyRouteTable(countRoutesByTable(routeList, m.tableRange),
+		m.tableRange, append(m.pendingDeleteTableNums(), m.fixedTableNums()...)...); found {
+		m.ownedTables[table] = true
+		return table, nil
+	}
+
+	// All the route tables in range are not empty, try to reclaim an orphan table of this daemon which is
+	// not referenced by any rule, e.g., the rule of subnet is deleted but flushing its table failed.
+	ruleList, err := netlink.RuleList(m.family)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list rules: %v", err)
+	}
+
+	if table, found, err := m.reclaimOwnedRouteTable(ruleList); err != nil || found {
+		return table, err
+	}
+
+	metrics.RouteTableExhaustedCounter.WithLabelValues(ipFamilyLabel(m.family)).Inc()
+	return 0, fmt.Errorf("cannot find empty route table in range %v~%v", m.tableRange.Min, m.tableRange.Max)
+}
+
+// reclaimOwnedRouteTable flushes the first owned table which is not referenced by any rule and returns it.
+func (m *Manager) reclaimOwnedRouteTable(ruleList []netlink.Rule) (int, bool, error) {
+	table, found := findUnreferencedOwnedRouteTable(ruleList, m.ownedTables, m.pendingDeleteTableNums()...)
+	if !found {
+		return 0, false, nil
+	}
+
+	if err := m.flushTable(table); err != nil {
+		return 0, false, fmt.Errorf("failed to reclaim orphan route table %v: %v", table, err)
+	}
+	return table, true, nil
+}
+
+// fixedTableNums returns the fixed tables of basic rules, which might be in table range but never allocated.
+func (m *Manager) fixedTableNums() []int {
+	return []int{m.localDirectTableNum, m.toOverlaySubnetTableNum, m.overlayMarkTableNum}
+}
+
+// findFirstEmptyRouteTable found the first route table in table range which has no routes, reserved tables
+// are taken as occupied.
+func findFirstEmptyRouteTable(tableRouteCount map[int]int, tableRange TableRange, reservedTables ...int) (int, bool) {
+	reservedTableMap := map[int]bool{}
+	for _, table := range reservedTables {
+		reservedTableMap[table] = true
+	}
+
+	for i := tableRange.Min; i < tableRange.Max; i++ {
+		if !reservedTableMap[i] && tableRouteCount[i] == 0 {
+			return i, true
 		}
+	}
+	return 0, false
+}
+
+// findUnreferencedOwnedRouteTable found the smallest owned route table which is not referenced by any rule,
+// reserved tables are taken as referenced.
+func findUnreferencedOwnedRouteTable(ruleList []netlink.Rule, ownedTables map[int]bool,
+	reservedTables ...int) (int, bool) {
+	referencedTableMap := map[int]bool{}
+	for _, rule := range ruleList {
+		referencedTableMap[rule.Table] = true
+	}
+	for _, table := range reservedTables {
+		referencedTableMap[table] = true
+	}
 
-		if empty {
-			return i, nil
+	found := false
+	minTable := 0
+	for table, owned := range ownedTables {
+		if owned && !referencedTableMap[table] && (!found || table < minTable) {
+			found = true
+			minTable = table
 		}
 	}
-	return 0, fmt.Errorf("cannot find empty route table in range %v~%v", MinRouteTableNum, MaxRouteTableNum)
+	return minTable, found
 }
 
-func checkIsFromPodSubnetRule(rule netlink.Rule) bool {
-	return rule.Src != nil && rule.Mask == fromRuleMask &&
-		rule.Table >= MinRouteTableNum && rule.Table <= MaxRouteTableNum
+// checkIsFromPodSubnetRule checks if rule is a from-pod-subnet rule no matter which mask it has, so that the rules
+// added with the mask of previous traffic marks can still be recognized and repaired. Mark 0 is not reported
+// by kernel.
+func checkIsFromPodSubnetRule(rule netlink.Rule, tableRange TableRange) bool {
+	return rule.Src != nil && rule.Mask > 0 && rule.Mark <= fromRuleMark && tableRange.Contains(rule.Table)
 }
 
-func clearRouteTable(table int, family int) error {
+// repairFromRuleMasks replaces the expected from-pod-subnet rules whose mark or mask drifted, e.g., traffic marks
+// are changed, with the rules of the current mask. Priorities and tos of dscp rules are kept.
+func (m *Manager) repairFromRuleMasks(ruleList []netlink.Rule) error {
+	toAdd, toDel := m.planFromRuleMaskRepairs(ruleList)
+
+	// add the new rules before deleting the old ones to avoid traffic falling through
+	for _, rule := range toAdd {
+		if err := netlink.RuleAdd(&rule); err != nil {
+			return fmt.Errorf("failed to add from pod subnet rule %v with mask %#x: %v", rule.String(),
+				m.fromRuleMask, err)
+		}
+	}
+
+	for _, rule := range toDel {
+		rule.Family = m.family
+		if err := netlink.RuleDel(&rule); err != nil {
+			return fmt.Errorf("failed to delete from pod subnet rule %v with stale mask %#x: %v", rule.String(),
+				rule.Mask, err)
+		}
+	}
+	return nil
+}
+
+// planFromRuleMaskRepairs returns the rules of the current mark and mask to add and the drifted rules to delete.
+func (m *Manager) planFromRuleMaskRepairs(ruleList []netlink.Rule) (toAdd, toDel []netlink.Rule) {
+	var desired, actual []netlink.Rule
+	for _, rule := range ruleList {
+		if !checkIsFromPodSubnetRule(rule, m.tableRange) || !m.checkFromPodSubnetRuleExpected(rule) {
+			continue
+		}
+
+		actual = append(actual, rule)
+		desired = append(desired, *m.newFromPodSubnetRule(rule.Src, rule.Table, rule.Priority, rule.Tos))
+	}
+	return DiffRules(desired, actual)
+}
+
+// newFromPodSubnetRule builds a from-pod-subnet rule with the current mask, a non-zero tos makes a dscp rule.
+func (m *Manager) newFromPodSubnetRule(src *net.IPNet, table, priority int, tos uint) *netlink.Rule {
+	rule := netlink.NewRule()
+	rule.Src = src
+	rule.Tos = tos
+	rule.Table = table
+	rule.Priority = priority
+	rule.Family = m.family
+	rule.Mark = fromRuleMark
+	rule.Mask = m.fromRuleMask
+	return rule
+}
+
+// clearRouteTable deletes all the routes in table except the ones preserve returns true for, a nil preserve
+// means no route will be preserved. Rules pointing at the table should have been deleted, otherwise traffic is
+// black-holed by the empty table and a warning is logged.
+func clearRouteTable(table int, family int, preserve func(route netlink.Route) bool) error {
+	warnIfRouteTableReferenced(table, family)
+	return flushRouteTable(table, family, preserve)
+}
+
+// flushRouteTable deletes routes like clearRouteTable without checking rule references, it is only for the tables
+// whose routes will be reprogrammed right after, e.g., the network mode of subnet changes.
+func flushRouteTable(table int, family int, preserve func(route netlink.Route) bool) error {
 	defaultRouteDst := defaultRouteDstByFamily(family)
 
 	routeList, err := netlink.RouteListFiltered(family, &netlink.Route{
@@ -180,7 +467,7 @@ func clearRouteTable(table int, family int) error {
 		return fmt.Errorf("failed to list route for table %v: %v", table, err)
 	}
 
-	for _, r := range routeList {
+	for _, r := range filterRoutesToClear(routeList, preserve) {
 		if r.Dst == nil {
 			r.Dst = defaultRouteDst
 		}
@@ -192,26 +479,90 @@ func clearRouteTable(table int, family int) error {
 	return nil
 }
 
-func ensureFromPodSubnetRuleAndRoutes(forwardNodeIfName string, cidr *net.IPNet,
-	gateway net.IP, autoNatOutgoing bool, family int, underlaySubnetInfoMap SubnetInfoMap,
-	underlayExcludeIPBlockMap map[string]*net.IPNet, mode networkingv1.NetworkMode) error {
+func filterRoutesToClear(routeList []netlink.Route, preserve func(route netlink.Route) bool) []netlink.Route {
+	if preserve == nil {
+		return routeList
+	}
+
+	var routesToClear []netlink.Route
+	for _, route := range routeList {
+		if !preserve(route) {
+			routesToClear = append(routesToClear, route)
+		}
+	}
+	return routesToClear
+}
+
+// isOperatorPinnedRoute checks if route is a host route pinned by operators, which is marked with "proto static".
+func isOperatorPinnedRoute(route netlink.Route) bool {
+	if route.Dst == nil || route.Protocol != unix.RTPROT_STATIC {
+		return false
+	}
+
+	ones, bits := route.Dst.Mask.Size()
+	return ones == bits
+}
+
+func (m *Manager) ensureFromPodSubnetRuleAndRoutes(forwardNodeIfName string, cidr *net.IPNet,
+	gateway net.IP, autoNatOutgoing bool, underlaySubnetInfoMap SubnetInfoMap,
+	underlayExcludeIPBlockMap map[string]*net.IPNet, mode networkingv1.NetworkMode,
+	sharedTables *sharedRouteTables, shareKey string) error {
 
 	var table int
 	var err error
 
-	ruleExist, existRule, err := checkIfRuleExist(cidr, -1, family)
+	if err = checkNetworkMode(cidr, mode); err != nil {
+		return err
+	}
+
+	ruleExist, existRule, err := checkIfRuleExist(cidr, -1, m.family)
 	if err != nil {
 		return fmt.Errorf("failed to check rule (src: %v, table: %v) exist: %v", cidr.String(), table, err)
 	}
 
+	// Routes of the shared table are not compatible with this subnet any more, move its rule to another table.
+	var evictedRule *netlink.Rule
+	if ruleExist && sharedTables.evictedSubnets[CanonicalCIDRKey(cidr)] {
+		evictedRule = existRule
+		ruleExist = false
+	}
+
+	// Routes of a shared table are still used by the other subnets, detach from it rather than clearing it.
+	if ruleExist && m.shouldDetachFromTable(cidr, mode, existRule.Table, sharedTables) {
+		evictedRule = existRule
+		ruleExist = false
+	}
+
 	// Add subnet rule if not exist.
 	if !ruleExist {
-		table, err = findEmptyRouteTable(family)
-		if err != nil {
-			return fmt.Errorf("failed to find empty route table: %v", err)
+		if pendingTable, reclaimed := m.reclaimPendingDeleteTable(cidr, time.Now()); reclaimed {
+			// Subnet reappears within the grace period, reuse its table with routes intact.
+			table = pendingTable
+
+			if m.subnetModeChanged(cidr, mode) {
+				if err := flushRouteTable(table, m.family, isOperatorPinnedRoute); err != nil {
+					return fmt.Errorf("failed to clear reclaimed route table %v for subnet %v whose mode changed: %v",
+						table, cidr, err)
+				}
+			}
+		} else if sharedTable, shared := sharedTables.tableForKey(shareKey, cidr); shared {
+			// Compatible subnet exists, share its table whose routes are identical.
+			table = sharedTable
+		} else {
+			table, err = m.findEmptyRouteTable()
+			if err != nil {
+				return fmt.Errorf("failed to find empty route table: %v", err)
+			}
 		}
 	} else {
 		table = existRule.Table
+
+		// Routes of the previous mode will not be managed by the new mode, clear them all.
+		if m.subnetModeChanged(cidr, mode) {
+			if err := flushRouteTable(table, m.family, isOperatorPinnedRoute); err != nil {
+				return fmt.Errorf("failed to clear route table %v for subnet %v whose mode changed: %v", table, cidr, err)
+			}
+		}
 	}
 
 	forwardLink, err := netlink.LinkByName(forwardNodeIfName)
@@ -221,34 +572,69 @@ func ensureFromPodSubnetRuleAndRoutes(forwardNodeIfName string, cidr *net.IPNet,
 
 	switch mode {
 	case networkingv1.NetworkModeVxlan:
-		if err := ensureRoutesForVxlanSubnet(forwardLink, cidr, table, autoNatOutgoing, family,
-			underlaySubnetInfoMap, underlayExcludeIPBlockMap); err != nil {
-			return fmt.Errorf("failed to ensure routes for vxlan subnet %v: %v", cidr.String(), err)
+		var overlayDestinations []*net.IPNet
+		var egressGateway net.IP
+		var routeMTU, routeAdvMSS int
+		if info, exist := m.localClusterOverlaySubnetInfoMap[CanonicalCIDRKey(cidr)]; exist {
+			overlayDestinations = info.overlayDestinations
+			egressGateway = info.egressGateway
+			routeMTU, routeAdvMSS = info.routeMTU, info.routeAdvMSS
+		}
+
+		if err := ensureRoutesForVxlanSubnet(forwardLink, cidr, table, autoNatOutgoing, m.family,
+			underlaySubnetInfoMap, underlayExcludeIPBlockMap, overlayDestinations, egressGateway,
+			routeMTU, routeAdvMSS); err != nil {
+			return fmt.Errorf("failed to ensure routes for vxlan subnet %v: %w", cidr.String(), err)
 		}
 	case networkingv1.NetworkModeVlan:
-		if err := ensureRoutesForVlanSubnet(forwardLink, cidr, gateway, table, family); err != nil {
-			return fmt.Errorf("failed to ensure routes for vlan subnet %v: %v", cidr.String(), err)
+		if err := ensureRoutesForVlanSubnet(forwardLink, cidr, gateway, table, m.family,
+			m.shouldInstallDirectRoute(cidr, time.Now())); err != nil {
+			return fmt.Errorf("failed to ensure routes for vlan subnet %v: %w", cidr.String(), err)
 		}
 	case networkingv1.NetworkModeBGP, networkingv1.NetworkModeGlobalBGP:
-		if err := ensureRoutesForBGPSubnet(forwardLink, cidr, gateway, table, family); err != nil {
-			return fmt.Errorf("failed to ensure routes for bgp subnet %v: %v", cidr.String(), err)
+		var routeSrc net.IP
+		var gateways []net.IP
+		if info, exist := m.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(cidr)]; exist {
+			routeSrc = info.routeSrc
+			gateways = info.bgpGateways
+		}
+
+		if len(gateways) == 0 && gateway != nil {
+			gateways = []net.IP{gateway}
+		}
+
+		if err := ensureRoutesForBGPSubnet(forwardLink, cidr, gateways, routeSrc, table, m.family); err != nil {
+			return fmt.Errorf("failed to ensure routes for bgp subnet %v: %w", cidr.String(), err)
 		}
 	default:
-		return fmt.Errorf("unsupported network mode %v", mode)
+		return newPermanentError("unsupported network mode %v", mode)
 	}
 
+	m.subnetModeMap[CanonicalCIDRKey(cidr)] = mode
+	sharedTables.join(shareKey, cidr, table)
+
 	// Add rule at the last in case error happens while failed to add any routes to table.
 	if !ruleExist {
-		if err := appendHighestUnusedPriorityRuleIfNotExist(cidr, table, family, fromRuleMark, fromRuleMask); err != nil {
+		if err := m.appendHighestUnusedPriorityRuleIfNotExist(cidr, table, fromRuleMark, m.fromRuleMask); err != nil {
 			return fmt.Errorf("failed to append from subnet rule for cidr %v: %v", cidr, err)
 		}
 	}
 
+	// Delete the evicted rule after the new one is added to avoid traffic falling through.
+	if evictedRule != nil && evictedRule.Table != table {
+		evictedRule.Family = m.family
+		if err := netlink.RuleDel(evictedRule); err != nil {
+			return fmt.Errorf("failed to delete evicted from subnet rule %v: %v", evictedRule.String(), err)
+		}
+		sharedTables.leave(cidr, evictedRule.Table)
+	}
+
 	return nil
 }
 
 func ensureRoutesForVxlanSubnet(forwardLink netlink.Link, cidr *net.IPNet, table int, autoNatOutgoing bool,
-	family int, underlaySubnetInfoMap SubnetInfoMap, underlayExcludeIPBlockMap map[string]*net.IPNet) error {
+	family int, underlaySubnetInfoMap SubnetInfoMap, underlayExcludeIPBlockMap map[string]*net.IPNet,
+	overlayDestinations []*net.IPNet, egressGateway net.IP, routeMTU, routeAdvMSS int) error {
 
 	routeList, err := netlink.RouteListFiltered(family, &netlink.Route{
 		Table: table,
@@ -257,98 +643,189 @@ func ensureRoutesForVxlanSubnet(forwardLink netlink.Link, cidr *net.IPNet, table
 		return fmt.Errorf("failed to list route for table %v: %v", table, err)
 	}
 
-	if !autoNatOutgoing {
-		defaultRoute := &netlink.Route{
-			Dst:       defaultRouteDstByFamily(family),
-			LinkIndex: forwardLink.Attrs().Index,
-			Table:     table,
-			Scope:     netlink.SCOPE_UNIVERSE,
+	if egressGateway != nil {
+		addrList, err := netlink.AddrList(nil, family)
+		if err != nil {
+			return fmt.Errorf("failed to list addresses: %v", err)
 		}
+		egressGateway, autoNatOutgoing = resolveLocalEgressGateway(egressGateway, autoNatOutgoing, addrList)
+	}
 
-		if err := netlink.RouteReplace(defaultRoute); err != nil {
-			return fmt.Errorf("failed to add overlay subnet %v default route %v: %v", cidr.String(), defaultRoute.String(), err)
-		}
+	desiredRoutes := desiredRoutesForVxlanSubnet(forwardLink, table, autoNatOutgoing, family,
+		underlaySubnetInfoMap, underlayExcludeIPBlockMap, overlayDestinations, egressGateway)
+	setRoutesMTU(desiredRoutes, routeMTU, routeAdvMSS)
 
-		for _, route := range routeList {
-			// Delete extra useless routes.
-			if route.Dst != nil {
-				if err := netlink.RouteDel(&route); err != nil {
-					return fmt.Errorf("failed to delete overlay route %v for table %v: %v", route.String(), table, err)
-				}
-			}
-		}
+	if err := applyRoutesTransactionally(desiredRoutes, routeList, family); err != nil {
+		return fmt.Errorf("failed to apply routes for overlay subnet %v: %v", cidr.String(), err)
+	}
+	return nil
+}
 
-	} else {
-		for _, route := range routeList {
-			// skip exclude routes
-			if isExcludeRoute(&route) {
-				continue
-			}
+// resolveLocalEgressGateway returns the egress gateway and whether outside traffic is NATed for the node. If this
+// node is the egress gateway itself, outside traffic, including the one forwarded from other nodes, should go out
+// locally through the underlay path, or it will be looped back to the vxlan device by a default route.
+func resolveLocalEgressGateway(egressGateway net.IP, autoNatOutgoing bool, addrList []netlink.Addr) (net.IP, bool) {
+	for _, addr := range addrList {
+		if addr.IP.Equal(egressGateway) {
+			return nil, true
+		}
+	}
+	return egressGateway, autoNatOutgoing
+}
 
-			if route.Dst != nil {
-				if _, exist := underlaySubnetInfoMap[route.Dst.String()]; exist {
-					continue
-				}
-			} else {
-				route.Dst = defaultRouteDstByFamily(family)
-			}
+func desiredRoutesForVxlanSubnet(forwardLink netlink.Link, table int, autoNatOutgoing bool, family int,
+	underlaySubnetInfoMap SubnetInfoMap, underlayExcludeIPBlockMap map[string]*net.IPNet,
+	overlayDestinations []*net.IPNet, egressGateway net.IP) []netlink.Route {
 
-			// Delete extra useless routes.
-			if err := netlink.RouteDel(&route); err != nil {
-				return fmt.Errorf("failed to delete overlay route %v for table %v: %v", route.String(), table, err)
-			}
+	if egressGateway == nil && !autoNatOutgoing && len(overlayDestinations) != 0 {
+		// Only route the specific destinations to vxlan device, other traffic will fall through to the next rules.
+		var desiredRoutes []netlink.Route
+		for _, destination := range overlayDestinations {
+			desiredRoutes = append(desiredRoutes, netlink.Route{
+				Dst:       destination,
+				LinkIndex: forwardLink.Attrs().Index,
+				Table:     table,
+				Scope:     netlink.SCOPE_UNIVERSE,
+				Family:    family,
+			})
 		}
+		return desiredRoutes
+	}
 
-		for _, subnet := range underlaySubnetInfoMap {
-			subnetRoute := &netlink.Route{
+	if egressGateway == nil && !autoNatOutgoing {
+		return []netlink.Route{
+			{
+				Dst:       defaultRouteDstByFamily(family),
 				LinkIndex: forwardLink.Attrs().Index,
-				Dst:       subnet.cidr,
 				Table:     table,
 				Scope:     netlink.SCOPE_UNIVERSE,
-			}
+				Family:    family,
+			},
+		}
+	}
+
+	var desiredRoutes []netlink.Route
+	for _, subnet := range underlaySubnetInfoMap {
+		desiredRoutes = append(desiredRoutes, netlink.Route{
+			LinkIndex: forwardLink.Attrs().Index,
+			Dst:       subnet.cidr,
+			Table:     table,
+			Scope:     netlink.SCOPE_UNIVERSE,
+			Family:    family,
+		})
+	}
+
+	// For overlay pod to access underlay excluded ip addresses, should not be forced to pass through vxlan device.
+	for _, block := range underlayExcludeIPBlockMap {
+		desiredRoutes = append(desiredRoutes, netlink.Route{
+			Dst:    block,
+			Table:  table,
+			Type:   unix.RTN_THROW,
+			Family: family,
+		})
+	}
+
+	// Outside traffic is routed to the egress gateway node through vxlan device rather than being NATed locally.
+	if egressGateway != nil {
+		desiredRoutes = append(desiredRoutes, netlink.Route{
+			Dst:       defaultRouteDstByFamily(family),
+			Gw:        egressGateway,
+			LinkIndex: forwardLink.Attrs().Index,
+			Table:     table,
+			Scope:     netlink.SCOPE_UNIVERSE,
+			Flags:     int(netlink.FLAG_ONLINK),
+			Family:    family,
+		})
+	}
+
+	return desiredRoutes
+}
+
+// setRoutesMTU sets mtu and advmss on the routes through devices, throw routes are left untouched.
+func setRoutesMTU(routes []netlink.Route, mtu, advMSS int) {
+	for i := range routes {
+		if routes[i].Type == unix.RTN_THROW {
+			continue
+		}
+		routes[i].MTU = mtu
+		routes[i].AdvMSS = advMSS
+	}
+}
 
-			if err := netlink.RouteReplace(subnetRoute); err != nil {
-				return fmt.Errorf("failed to set overlay route %v for table %v: %v", subnetRoute.String(), table, err)
+// applyRoutesTransactionally converges actual routes to desired routes. Extra routes will only be deleted after
+// all the missing routes are added successfully, and added routes will be rolled back if any of them fails,
+// so that a failed apply leaves the previous working routes intact rather than a half-applied state.
+func applyRoutesTransactionally(desired, actual []netlink.Route, family int) error {
+	toAdd, toDel := DiffRoutes(desired, actual)
+	replaced := snapshotReplacedRoutes(toAdd, actual)
+
+	for index, route := range toAdd {
+		if err := replaceRoute(&route); err != nil {
+			// best effort to roll back, replaced routes are restored and newly added ones are deleted
+			for i := index - 1; i >= 0; i-- {
+				if replaced[i] != nil {
+					_ = netlink.RouteReplace(replaced[i])
+					continue
+				}
+				_ = netlink.RouteDel(&toAdd[i])
 			}
+			return fmt.Errorf("failed to add route %v for table %v: %v", route.String(), route.Table, err)
+		}
+	}
+
+	for _, route := range toDel {
+		if route.Dst == nil {
+			route.Dst = defaultRouteDstByFamily(family)
 		}
 
-		// For overlay pod to access underlay excluded ip addresses, should not be forced to pass through vxlan device.
-		if err := ensureExcludedIPBlockRoutes(underlayExcludeIPBlockMap, table, family); err != nil {
-			return fmt.Errorf("failed to ensure exclude all ip block routes: %v", err)
+		if err := netlink.RouteDel(&route); err != nil {
+			return fmt.Errorf("failed to delete route %v for table %v: %v", route.String(), route.Table, err)
 		}
 	}
+
+	return nil
+}
+
+// checkVlanGateway checks if gateway of vlan subnet is usable, only the ipv6 gateway learned from router
+// advertisements might be a link-local address outside the subnet.
+func checkVlanGateway(cidr *net.IPNet, gateway net.IP, family int) error {
+	if gateway == nil {
+		return newPermanentError("gateway of vlan subnet %v is neither specified nor detected", cidr)
+	}
+
+	if !cidr.Contains(gateway) && !(family == netlink.FAMILY_V6 && gateway.IsLinkLocalUnicast()) {
+		return newPermanentError("vlan gateway address %v is not inside the vlan subnet cidr %v", gateway, cidr)
+	}
 	return nil
 }
 
-func ensureRoutesForVlanSubnet(forwardLink netlink.Link, cidr *net.IPNet, gateway net.IP, table, family int) error {
+// ensureRoutesForVlanSubnet ensures the direct and default routes of vlan subnet in table. If the subnet is local
+// but the forward interface has no direct route for it, a MissingDirectRouteError is returned, or the direct route
+// is installed on the forward interface if installMissingDirectRoute is true.
+func ensureRoutesForVlanSubnet(forwardLink netlink.Link, cidr *net.IPNet, gateway net.IP, table, family int,
+	installMissingDirectRoute bool) error {
 	localAddrList, err := netlink.AddrList(nil, family)
 	if err != nil {
 		return fmt.Errorf("failed to list local addresses: %v", err)
 	}
 
-	if !cidr.Contains(gateway) {
-		return fmt.Errorf("vlan gateway address %v is not inside the vlan subnet cidr %v", gateway, cidr)
+	if err := checkVlanGateway(cidr, gateway, family); err != nil {
+		return err
 	}
 
-	isLocalSubnet := false
-	for _, address := range localAddrList {
-		if cidr.Contains(address.IP) {
-			// Check if address is an enhanced address or used to connect a subnet.
-			if address.Flags&unix.IFA_F_NOPREFIXROUTE == 0 {
-				isLocalSubnet = true
-				break
-			}
-		}
+	isLocalSubnet := checkIsLocalSubnet(localAddrList, cidr)
+
+	forwardLinkAddrList, err := netlink.AddrList(forwardLink, family)
+	if err != nil {
+		return fmt.Errorf("failed to list addresses of forward interface %v: %v", forwardLink.Attrs().Name, err)
 	}
 
-	subnetDirectRoute := &netlink.Route{
-		LinkIndex: forwardLink.Attrs().Index,
-		Dst:       cidr,
-		Table:     table,
-		// cannot add default route if the scope of subnet direct route is not "link"
-		Scope: netlink.SCOPE_LINK,
+	if conflictAddr := findConflictingAddress(forwardLinkAddrList, cidr); conflictAddr != nil {
+		return &ConflictingAddressError{LinkName: forwardLink.Attrs().Name, Addr: conflictAddr.IPNet.String(),
+			CIDR: cidr.String()}
 	}
 
+	var src net.IP
 	if isLocalSubnet {
 		// Check if forward interface has default route which has the same gateway ip with this hybridnet subnet.
 		defaultRoute, err := daemonutils.GetDefaultRoute(family)
@@ -359,7 +836,7 @@ func ensureRoutesForVlanSubnet(forwardLink netlink.Link, cidr *net.IPNet, gatewa
 		if defaultRoute != nil {
 			if defaultRoute.LinkIndex == forwardLink.Attrs().Index &&
 				defaultRoute.Gw != nil && !defaultRoute.Gw.Equal(gateway) {
-				return fmt.Errorf("exist default route of forward interface %v has a different gateway %v with %v",
+				return newPermanentError("exist default route of forward interface %v has a different gateway %v with %v",
 					forwardLink.Attrs().Name, defaultRoute.Gw, gateway)
 			}
 		}
@@ -376,38 +853,137 @@ func ensureRoutesForVlanSubnet(forwardLink netlink.Link, cidr *net.IPNet, gatewa
 		}
 
 		if len(directRouteList) == 0 {
-			return fmt.Errorf("forward interface %v should have direct route for local subnet %v",
-				forwardLink.Attrs().Name, cidr.String())
+			if !installMissingDirectRoute {
+				return &MissingDirectRouteError{LinkName: forwardLink.Attrs().Name, CIDR: cidr.String()}
+			}
+
+			mainDirectRoute := netlink.Route{
+				LinkIndex: forwardLink.Attrs().Index,
+				Dst:       cidr,
+				Scope:     netlink.SCOPE_LINK,
+			}
+			if err := replaceRoute(&mainDirectRoute); err != nil {
+				return fmt.Errorf("failed to install missing direct route for interface %v and subnet %v: %v",
+					forwardLink.Attrs().Name, cidr.String(), err)
+			}
+			directRouteList = append(directRouteList, mainDirectRoute)
 		}
 
-		subnetDirectRoute.Src = directRouteList[0].Src
+		if src, err = daemonutils.SelectSourceAddress(forwardLink, cidr, family); err == daemonutils.NotExist {
+			src = directRouteList[0].Src
+		} else if err != nil {
+			return fmt.Errorf("failed to select source address for subnet %v: %v", cidr.String(), err)
+		}
 	}
 
-	// avoid to use onlink flag because it doesn't work for ipv6 routes until linux 4.16
-	defaultRoute := &netlink.Route{
-		LinkIndex: forwardLink.Attrs().Index,
-		Table:     table,
-		Scope:     netlink.SCOPE_UNIVERSE,
-		Gw:        gateway,
-	}
+	desiredRoutes := desiredRoutesForVlanSubnet(forwardLink.Attrs().Index, cidr, gateway, src, table)
+	subnetDirectRoute, defaultRoute := &desiredRoutes[0], &desiredRoutes[1]
 
-	if err := netlink.RouteReplace(subnetDirectRoute); err != nil {
+	if err := replaceRoute(subnetDirectRoute); err != nil {
 		return fmt.Errorf("failed to add vlan subent %v direct route %v: %v", cidr.String(), subnetDirectRoute.String(), err)
 	}
 
-	if err := netlink.RouteReplace(defaultRoute); err != nil {
+	if err := replaceRoute(defaultRoute); err != nil {
 		return fmt.Errorf("failed to add vlan subnet %v default route %v: %v", cidr.String(), defaultRoute.String(), err)
 	}
 
 	return nil
 }
 
-func ensureRoutesForBGPSubnet(forwardLink netlink.Link, cidr *net.IPNet, gateway net.IP, table, family int) error {
+// shouldDetachFromTable checks if subnet whose network mode changed should move its rule out of table, because the
+// routes of table are still used by the other subnets.
+func (m *Manager) shouldDetachFromTable(cidr *net.IPNet, mode networkingv1.NetworkMode, table int,
+	sharedTables *sharedRouteTables) bool {
+	return m.subnetModeChanged(cidr, mode) && sharedTables.isReferencedByOthers(table, cidr)
+}
+
+// checkIsLocalSubnet checks if cidr is connected to this node by any address, enhanced addresses which don't
+// have prefix routes are not taken into account.
+func checkIsLocalSubnet(addrList []netlink.Addr, cidr *net.IPNet) bool {
+	for _, address := range addrList {
+		if cidr.Contains(address.IP) && address.Flags&unix.IFA_F_NOPREFIXROUTE == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// desiredRoutesForVlanSubnet returns the subnet direct route and the default route through gateway, src is only
+// set on the direct route of a local subnet.
+func desiredRoutesForVlanSubnet(linkIndex int, cidr *net.IPNet, gateway, src net.IP, table int) []netlink.Route {
+	return []netlink.Route{
+		{
+			LinkIndex: linkIndex,
+			Dst:       cidr,
+			Table:     table,
+			// cannot add default route if the scope of subnet direct route is not "link"
+			Scope: netlink.SCOPE_LINK,
+			Src:   src,
+		},
+		{
+			// avoid to use onlink flag because it doesn't work for ipv6 routes until linux 4.16
+			LinkIndex: linkIndex,
+			Table:     table,
+			Scope:     netlink.SCOPE_UNIVERSE,
+			Gw:        gateway,
+		},
+	}
+}
+
+// lookupVlanSubnetDirectRouteSource returns the source address of vlan subnet direct route the same way as
+// ensureRoutesForVlanSubnet, without changing anything.
+func lookupVlanSubnetDirectRouteSource(forwardLink netlink.Link, cidr *net.IPNet, family int) (net.IP, error) {
+	localAddrList, err := netlink.AddrList(nil, family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local addresses: %v", err)
+	}
+
+	if !checkIsLocalSubnet(localAddrList, cidr) {
+		return nil, nil
+	}
+
+	src, err := daemonutils.SelectSourceAddress(forwardLink, cidr, family)
+	if err != daemonutils.NotExist {
+		return src, err
+	}
+
+	directRouteList, err := netlink.RouteListFiltered(family, &netlink.Route{
+		LinkIndex: forwardLink.Attrs().Index,
+		Dst:       cidr,
+	}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_DST)
+	if err != nil || len(directRouteList) == 0 {
+		return nil, err
+	}
+	return directRouteList[0].Src, nil
+}
+
+// findConflictingAddress finds the address which is outside cidr but has a prefix route covering cidr,
+// enhanced addresses and link-local addresses are ignored.
+func findConflictingAddress(addrList []netlink.Addr, cidr *net.IPNet) *netlink.Addr {
+	cidrOnes, _ := cidr.Mask.Size()
+	for i := range addrList {
+		address := &addrList[i]
+		if address.IPNet == nil || address.Flags&unix.IFA_F_NOPREFIXROUTE != 0 ||
+			address.IP.IsLinkLocalUnicast() || cidr.Contains(address.IP) {
+			continue
+		}
+
+		addrOnes, _ := address.Mask.Size()
+		addrNet := &net.IPNet{IP: address.IP.Mask(address.Mask), Mask: address.Mask}
+		if addrOnes < cidrOnes && addrNet.Contains(cidr.IP) {
+			return address
+		}
+	}
+	return nil
+}
+
+func ensureRoutesForBGPSubnet(forwardLink netlink.Link, cidr *net.IPNet, gateways []net.IP, routeSrc net.IP,
+	table, family int) error {
 	// default route is always needed
 	var defaultRoute *netlink.Route
 	var err error
 
-	if gateway == nil {
+	if len(dedupeGateways(gateways)) == 0 {
 		// copy the origin node default route in bgp subnet table
 		defaultRoute, err = daemonutils.GetDefaultRoute(family)
 		if err != nil {
@@ -415,21 +991,27 @@ func ensureRoutesForBGPSubnet(forwardLink netlink.Link, cidr *net.IPNet, gateway
 		}
 		defaultRoute.Table = table
 	} else {
-		// TODO: support multiple bgp gateway
-		// don't use onlink flag in case the gateway is not a reachable next hop
-		defaultRoute = &netlink.Route{
-			LinkIndex: forwardLink.Attrs().Index,
-			Table:     table,
-			Scope:     netlink.SCOPE_UNIVERSE,
-			Gw:        gateway,
+		defaultRoute = buildBGPDefaultRoute(forwardLink.Attrs().Index, table, gateways)
+	}
+
+	if routeSrc != nil {
+		addrList, err := netlink.AddrList(nil, family)
+		if err != nil {
+			return fmt.Errorf("failed to list addresses: %v", err)
+		}
+
+		if err := setRouteSource(defaultRoute, routeSrc, addrList); err != nil {
+			return fmt.Errorf("failed to set source for bgp subnet %v default route: %w", cidr.String(), err)
 		}
 	}
 
-	if err := netlink.RouteReplace(defaultRoute); err != nil {
+	if err := replaceRoute(defaultRoute); err != nil {
 		return fmt.Errorf("failed to add bgp subnet %v default route %v: %v", cidr.String(), defaultRoute.String(), err)
 	}
 
 	// Because `ip route replace` will not delete default route if gateway changed, we need to delete it additionally.
+	// Both single-path and ecmp routes are compared by their next hops, so that a stale ecmp route is also removed
+	// after the peer set shrinks back to one gateway.
 	routeList, err := netlink.RouteListFiltered(family, &netlink.Route{
 		Table: table,
 	}, netlink.RT_FILTER_TABLE)
@@ -439,9 +1021,7 @@ func ensureRoutesForBGPSubnet(forwardLink netlink.Link, cidr *net.IPNet, gateway
 
 	for _, route := range routeList {
 		// cannot use route.Equal() because of empty fields
-		if daemonutils.IsDefaultRoute(&route, family) &&
-			// TODO: support multiple bgp gateway
-			(!route.Gw.Equal(defaultRoute.Gw) || route.LinkIndex != defaultRoute.LinkIndex) {
+		if daemonutils.IsDefaultRoute(&route, family) && !isSameNexthops(&route, defaultRoute) {
 			if err := netlink.RouteDel(&route); err != nil {
 				return fmt.Errorf("failed to delete bgp route %v for table %v: %v", route.String(), table, err)
 			}
@@ -451,6 +1031,95 @@ func ensureRoutesForBGPSubnet(forwardLink netlink.Link, cidr *net.IPNet, gateway
 	return nil
 }
 
+// setRouteSource sets the source ip of route after checking it is assigned on this node. The error of a source ip
+// not assigned is transient, as the ip might be assigned later.
+func setRouteSource(route *netlink.Route, routeSrc net.IP, addrList []netlink.Addr) error {
+	for _, addr := range addrList {
+		if addr.IP.Equal(routeSrc) {
+			route.Src = routeSrc
+			return nil
+		}
+	}
+	return fmt.Errorf("source ip %v is not assigned on this node", routeSrc)
+}
+
+// probeGatewayReachability checks if gateway can be reached through the forward interface by the routes of subnet
+// table, and it's neigh entry has been resolved.
+func probeGatewayReachability(forwardLink netlink.Link, gateway net.IP, tableRoutes []netlink.Route, family int) error {
+	linkIndex, found := lookupDirectRouteLinkIndex(tableRoutes, gateway)
+	if !found {
+		// next hop which is not directly reachable in subnet table is resolved by the other tables as kernel does
+		routeList, err := netlink.RouteGet(gateway)
+		if err != nil {
+			return fmt.Errorf("gateway %v is unreachable: %v", gateway, err)
+		}
+
+		if len(routeList) == 0 {
+			return fmt.Errorf("gateway %v is unreachable, no route found", gateway)
+		}
+		linkIndex = routeList[0].LinkIndex
+	}
+
+	if linkIndex != forwardLink.Attrs().Index {
+		return fmt.Errorf("gateway %v is not reachable through forward interface %v",
+			gateway, forwardLink.Attrs().Name)
+	}
+
+	neighList, err := netlink.NeighList(forwardLink.Attrs().Index, family)
+	if err != nil {
+		return fmt.Errorf("failed to list neighs for forward interface %v: %v", forwardLink.Attrs().Name, err)
+	}
+
+	if !checkNeighResolved(neighList, gateway) {
+		return fmt.Errorf("failed to resolve link layer address of gateway %v on forward interface %v",
+			gateway, forwardLink.Attrs().Name)
+	}
+
+	return nil
+}
+
+// lookupDirectRouteLinkIndex looks up ip by the longest prefix match in routes, the link index is only found if
+// the matched route is a direct route of device.
+func lookupDirectRouteLinkIndex(routeList []netlink.Route, ip net.IP) (int, bool) {
+	var matched *netlink.Route
+	matchedOnes := -1
+	for i := range routeList {
+		route := &routeList[i]
+
+		ones := 0
+		if route.Dst != nil {
+			if !route.Dst.Contains(ip) {
+				continue
+			}
+			ones, _ = route.Dst.Mask.Size()
+		}
+
+		if ones > matchedOnes {
+			matched = route
+			matchedOnes = ones
+		}
+	}
+
+	if matched == nil || routeType(matched) != unix.RTN_UNICAST || matched.Gw != nil ||
+		len(matched.MultiPath) != 0 || matched.LinkIndex <= 0 {
+		return 0, false
+	}
+	return matched.LinkIndex, true
+}
+
+// checkNeighResolved checks if the link layer address of ip has not failed to be resolved, only incomplete and
+// failed neigh entries are taken as unresolved. A missing entry only means no traffic has been sent to ip yet.
+func checkNeighResolved(neighList []netlink.Neigh, ip net.IP) bool {
+	unresolvedStates := netlink.NUD_INCOMPLETE | netlink.NUD_FAILED
+
+	for _, neigh := range neighList {
+		if neigh.IP.Equal(ip) && neigh.State&unresolvedStates != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func realRulePriority(priority int) int {
 	if priority == -1 {
 		return 0
@@ -465,6 +1134,11 @@ func checkIfRuleExist(src *net.IPNet, table, family int) (bool, *netlink.Rule, e
 	}
 
 	for _, rule := range ruleList {
+		// skip dscp rules, which are managed separately
+		if rule.Tos != 0 {
+			continue
+		}
+
 		if src == rule.Src || (src != nil && rule.Src != nil && src.String() == rule.Src.String()) {
 			if table > 0 {
 				if rule.Table == table {
@@ -505,31 +1179,79 @@ func ensureExcludedIPBlockRoutes(excludeIPBlockMap map[string]*net.IPNet, table,
 		return fmt.Errorf("failed to list excluded routes: %v", err)
 	}
 
+	tableLabel, familyLabel := strconv.Itoa(table), ipFamilyLabel(family)
+
+	existExcludedRouteMap := map[string]bool{}
 	for _, route := range excludedRouteList {
-		if _, exists := excludeIPBlockMap[route.Dst.String()]; !exists {
+		if _, exists := excludeIPBlockMap[CanonicalCIDRKey(route.Dst)]; !exists {
 			if err := netlink.RouteDel(&route); err != nil {
 				return fmt.Errorf("failed delete excluded route %v: %v", route, err)
 			}
+			metrics.ExcludeIPBlockRouteOperationCounter.WithLabelValues(tableLabel, familyLabel,
+				metrics.RouteDeleteOperation).Inc()
+			continue
 		}
+		existExcludedRouteMap[CanonicalCIDRKey(route.Dst)] = true
 	}
 
-	for _, cidr := range excludeIPBlockMap {
-		if err := netlink.RouteReplace(&netlink.Route{
+	for key, cidr := range excludeIPBlockMap {
+		if err := replaceRoute(&netlink.Route{
 			Dst:   cidr,
 			Table: table,
 			Type:  unix.RTN_THROW,
 		}); err != nil {
 			return fmt.Errorf("failed to add excluded route for block %v: %v", cidr.String(), err)
 		}
+
+		if !existExcludedRouteMap[key] {
+			metrics.ExcludeIPBlockRouteOperationCounter.WithLabelValues(tableLabel, familyLabel,
+				metrics.RouteAddOperation).Inc()
+		}
+	}
+
+	return nil
+}
+
+// countExcludeIPBlocksBySubnet counts exclude ip blocks of every subnet, which is keyed by subnet cidr
+func countExcludeIPBlocksBySubnet(subnetInfoMap SubnetInfoMap, excludeIPBlockMap map[string]*net.IPNet) map[string]int {
+	countMap := map[string]int{}
+	for _, block := range excludeIPBlockMap {
+		for key, info := range subnetInfoMap {
+			if info.cidr.Contains(block.IP) {
+				countMap[key]++
+				break
+			}
+		}
+	}
+	return countMap
+}
+
+// reportRouteTablesInUse updates the number of non-empty route tables in table range, which can
+// never be chosen by findEmptyRouteTable.
+func (m *Manager) reportRouteTablesInUse() error {
+	routeList, err := netlink.RouteListFiltered(m.family, &netlink.Route{
+		Table: unix.RT_TABLE_UNSPEC,
+	}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return fmt.Errorf("failed to list routes of all tables: %v", err)
 	}
 
+	tableRouteCount := countRoutesByTable(routeList, m.tableRange)
+	metrics.RouteTableInUseGauge.WithLabelValues(ipFamilyLabel(m.family)).Set(float64(len(tableRouteCount)))
 	return nil
 }
 
+func ipFamilyLabel(family int) string {
+	if family == netlink.FAMILY_V6 {
+		return metrics.IPv6
+	}
+	return metrics.IPv4
+}
+
 func findExcludeIPBlockMap(subnetInfoMap SubnetInfoMap) (map[string]*net.IPNet, error) {
 	excludeIPBlockMap := map[string]*net.IPNet{}
 	for _, info := range subnetInfoMap {
-		excludeIPBlocks, err := daemonutils.FindSubnetExcludeIPBlocks(info.cidr, info.includedIPRanges,
+		excludeIPBlocks, err := utils.FindSubnetExcludeIPBlocks(info.cidr, info.includedIPRanges,
 			info.gateway, info.excludeIPs)
 
 		if err != nil {
@@ -537,7 +1259,7 @@ func findExcludeIPBlockMap(subnetInfoMap SubnetInfoMap) (map[string]*net.IPNet,
 		}
 
 		for _, block := range excludeIPBlocks {
-			excludeIPBlockMap[block.String()] = block
+			excludeIPBlockMap[CanonicalCIDRKey(block)] = block
 		}
 	}
 	return excludeIPBlockMap, nil
@@ -550,6 +1272,192 @@ func isExcludeRoute(route *netlink.Route) bool {
 	return route.Type == unix.RTN_THROW
 }
 
+// DiffRoutes computes the minimal routes to add and delete for converging actual routes to desired routes.
+// Routes are matched by (Dst, Table, LinkIndex, Gw, Type, Priority, MTU, AdvMSS) and multipath next hops.
+// Host routes pinned by operators are never deleted, as they are also kept when route tables are cleared.
+func DiffRoutes(desired, actual []netlink.Route) (toAdd, toDel []netlink.Route) {
+	actualRouteMap := make(map[string]bool, len(actual))
+	for _, route := range actual {
+		actualRouteMap[routeDiffKey(&route)] = true
+	}
+
+	desiredRouteMap := make(map[string]bool, len(desired))
+	for _, route := range desired {
+		key := routeDiffKey(&route)
+		if desiredRouteMap[key] {
+			continue
+		}
+		desiredRouteMap[key] = true
+
+		if !actualRouteMap[key] {
+			toAdd = append(toAdd, route)
+		}
+	}
+
+	// Routes of the same (Dst, Table, Priority) are overwritten in place by replacing, deleting them would remove
+	// the replaced ones.
+	replacedRouteMap := make(map[string]bool, len(toAdd))
+	for _, route := range toAdd {
+		replacedRouteMap[routeSlotKey(&route)] = true
+	}
+
+	for _, route := range actual {
+		if isOperatorPinnedRoute(route) {
+			continue
+		}
+		if !desiredRouteMap[routeDiffKey(&route)] && !replacedRouteMap[routeSlotKey(&route)] {
+			toDel = append(toDel, route)
+		}
+	}
+
+	return toAdd, toDel
+}
+
+// snapshotReplacedRoutes returns the actual route which will be overwritten by replacing each of the routes to
+// add, or nil if the route to add is a new one. Kernel replaces the route of the same (Dst, Table, Priority).
+func snapshotReplacedRoutes(toAdd, actual []netlink.Route) []*netlink.Route {
+	actualRouteMap := make(map[string]*netlink.Route, len(actual))
+	for i := range actual {
+		actualRouteMap[routeSlotKey(&actual[i])] = &actual[i]
+	}
+
+	replaced := make([]*netlink.Route, len(toAdd))
+	for i := range toAdd {
+		replaced[i] = actualRouteMap[routeSlotKey(&toAdd[i])]
+	}
+	return replaced
+}
+
+func routeSlotKey(route *netlink.Route) string {
+	return fmt.Sprintf("%v|%v|%v", routeDstKey(route), route.Table, routePriority(route))
+}
+
+func routeDstKey(route *netlink.Route) string {
+	if route.Dst != nil {
+		if ones, _ := route.Dst.Mask.Size(); ones != 0 {
+			return CanonicalCIDRKey(route.Dst)
+		}
+	}
+	return "default"
+}
+
+// routePriority returns the metric of route, ipv6 routes without a specified metric will be assigned with 1024
+// by kernel. Routes without family are taken as ipv6 ones by their destination.
+func routePriority(route *netlink.Route) int {
+	if route.Priority == 0 && (route.Family == netlink.FAMILY_V6 ||
+		(route.Dst != nil && route.Dst.IP.To4() == nil && len(route.Dst.IP) == net.IPv6len)) {
+		return defaultIPv6RouteMetric
+	}
+	return route.Priority
+}
+
+// routeType returns the type of route, routes without a specified type are reported as unicast by kernel.
+func routeType(route *netlink.Route) int {
+	if route.Type == unix.RTN_UNSPEC {
+		return unix.RTN_UNICAST
+	}
+	return route.Type
+}
+
+func routeDiffKey(route *netlink.Route) string {
+	return fmt.Sprintf("%v|%v|%v", routeIdentityKey(route), route.MTU, route.AdvMSS)
+}
+
+// routeIdentityKey identifies a route regardless of its metrics.
+func routeIdentityKey(route *netlink.Route) string {
+	gw := ""
+	if route.Gw != nil {
+		gw = route.Gw.String()
+	}
+
+	// "throw" v6 routes without a specified device will always be specified to "dev lo" by kernel automatically
+	linkIndex := route.LinkIndex
+	if route.Type == unix.RTN_THROW {
+		linkIndex = 0
+	}
+
+	var nextHops []string
+	for _, nh := range route.MultiPath {
+		nhGw := ""
+		if nh.Gw != nil {
+			nhGw = nh.Gw.String()
+		}
+		nextHops = append(nextHops, fmt.Sprintf("%v/%v/%v", nh.LinkIndex, nhGw, nh.Hops))
+	}
+	sort.Strings(nextHops)
+
+	return fmt.Sprintf("%v|%v|%v|%v|%v|%v|%v", routeDstKey(route), route.Table, linkIndex, gw,
+		routeType(route), routePriority(route), strings.Join(nextHops, ","))
+}
+
+// DiffRules computes the minimal rules to add and delete for converging actual rules to desired rules. Rules are
+// matched by (Src, Table, Mark, Mask, Priority) and TOS of dscp rules, a negative priority of desired rule matches
+// any priority because it will be chosen by kernel.
+func DiffRules(desired, actual []netlink.Rule) (toAdd, toDel []netlink.Rule) {
+	actualRuleMap := make(map[string][]int, len(actual))
+	for i := range actual {
+		key := ruleDiffKey(&actual[i])
+		actualRuleMap[key] = append(actualRuleMap[key], i)
+	}
+
+	matched := make([]bool, len(actual))
+	for _, rule := range desired {
+		found := false
+		for _, index := range actualRuleMap[ruleDiffKey(&rule)] {
+			if matched[index] || (rule.Priority >= 0 && actual[index].Priority != rule.Priority) {
+				continue
+			}
+			matched[index] = true
+			found = true
+			break
+		}
+
+		if !found {
+			toAdd = append(toAdd, rule)
+		}
+	}
+
+	for i := range actual {
+		if !matched[i] {
+			toDel = append(toDel, actual[i])
+		}
+	}
+
+	return toAdd, toDel
+}
+
+// ruleDiffKey returns the key of rule except priority, mark and mask are normalized as what kernel reports.
+func ruleDiffKey(rule *netlink.Rule) string {
+	src := "all"
+	if rule.Src != nil {
+		src = CanonicalCIDRKey(rule.Src)
+	}
+
+	// mark is not reported by kernel if both mark and mask are zero
+	mark, mask := rule.Mark, rule.Mask
+	if mark < 0 {
+		mark = 0
+	}
+	if mask < 0 {
+		// mask defaults to 0xffffffff if only mark is specified
+		mask = 0
+		if mark != 0 {
+			mask = 0xffffffff
+		}
+	}
+
+	return fmt.Sprintf("%v|%v|%#x|%#x|%v", src, rule.Table, mark, mask, rule.Tos)
+}
+
+// copySubnetInfoMap returns a new map of the same subnet infos.
+func copySubnetInfoMap(subnetInfoMap SubnetInfoMap) SubnetInfoMap {
+	res := make(SubnetInfoMap, len(subnetInfoMap))
+	for cidr, info := range subnetInfoMap {
+		res[cidr] = info
+	}
+	return res
+}
+
 func combineSubnetInfoMap(a, b SubnetInfoMap) SubnetInfoMap {
 	if len(b) == 0 {
 		return a
@@ -0,0 +1,1157 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+	"github.com/alibaba/hybridnet/pkg/daemon/iptables"
+)
+
+func TestCanonicalCIDRKey(t *testing.T) {
+	testCases := []struct {
+		cidr string
+		key  string
+	}{
+		{
+			"10.0.0.5/24",
+			"10.0.0.0/24",
+		},
+		{
+			"10.0.0.0/24",
+			"10.0.0.0/24",
+		},
+		{
+			"192.168.3.100/32",
+			"192.168.3.100/32",
+		},
+		{
+			"2021:23::ffff/64",
+			"2021:23::/64",
+		},
+	}
+
+	for _, test := range testCases {
+		ip, cidr, err := net.ParseCIDR(test.cidr)
+		if err != nil {
+			t.Fatalf("failed to parse cidr %v: %v", test.cidr, err)
+		}
+
+		// keep the host bits which net.ParseCIDR has masked
+		cidr.IP = ip
+		if key := CanonicalCIDRKey(cidr); key != test.key {
+			t.Errorf("expect key %s for cidr %s but got %s", test.key, test.cidr, key)
+		}
+	}
+
+	hostBitsSet := &net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(24, 32)}
+	masked := &net.IPNet{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.CIDRMask(24, 32)}
+	if CanonicalCIDRKey(hostBitsSet) != CanonicalCIDRKey(masked) {
+		t.Errorf("expect %s and %s to have the same key", hostBitsSet, masked)
+	}
+
+	if key := CanonicalCIDRKey(nil); key != "" {
+		t.Errorf("expect empty key for nil cidr but got %s", key)
+	}
+}
+
+func TestFindUnreferencedOwnedRouteTable(t *testing.T) {
+	newRule := func(table int) netlink.Rule {
+		rule := netlink.NewRule()
+		rule.Table = table
+		return *rule
+	}
+
+	testCases := []struct {
+		ruleList       []netlink.Rule
+		ownedTables    map[int]bool
+		reservedTables []int
+		table          int
+		found          bool
+	}{
+		{
+			// every owned table is referenced
+			[]netlink.Rule{newRule(10000), newRule(10001), newRule(10002)},
+			map[int]bool{10000: true, 10001: true},
+			nil,
+			0,
+			false,
+		},
+		{
+			// table 10001 is an orphan table of this daemon, table 10003 is not owned
+			[]netlink.Rule{newRule(255), newRule(10000), newRule(10002)},
+			map[int]bool{10000: true, 10001: true, 10002: true},
+			nil,
+			10001,
+			true,
+		},
+		{
+			// unreferenced tables of others are never chosen
+			nil,
+			map[int]bool{},
+			nil,
+			0,
+			false,
+		},
+		{
+			// reserved tables are taken as referenced
+			nil,
+			map[int]bool{10002: true, 10004: true},
+			[]int{10002},
+			10004,
+			true,
+		},
+	}
+
+	for index, test := range testCases {
+		table, found := findUnreferencedOwnedRouteTable(test.ruleList, test.ownedTables, test.reservedTables...)
+		if table != test.table || found != test.found {
+			t.Errorf("case %v: expect table %v found %v but got table %v found %v",
+				index, test.table, test.found, table, found)
+		}
+	}
+}
+
+func TestReclaimOwnedRouteTable(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.1.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	var flushedTables []int
+	m.flushTable = func(table int) error {
+		flushedTables = append(flushedTables, table)
+		return nil
+	}
+
+	// table 10001 is owned by other policy routing daemons in the same band
+	ruleList := []netlink.Rule{{Src: cidr, Table: 10000, Mark: -1, Mask: DefaultFromRuleMask}}
+	if _, found, err := m.reclaimOwnedRouteTable(ruleList); err != nil || found || len(flushedTables) != 0 {
+		t.Fatalf("expect no table to be reclaimed, but got found %v, flushed %v, err %v", found, flushedTables, err)
+	}
+
+	// the rule of subnet was deleted while its table is left
+	m.ownedTables[10000] = true
+	m.ownedTables[10002] = true
+	table, found, err := m.reclaimOwnedRouteTable(ruleList)
+	if err != nil || !found || table != 10002 || !reflect.DeepEqual(flushedTables, []int{10002}) {
+		t.Fatalf("expect owned table 10002 to be flushed and reclaimed, but got table %v, found %v, flushed %v, err %v",
+			table, found, flushedTables, err)
+	}
+
+	m.flushTable = func(table int) error {
+		return fmt.Errorf("permission denied")
+	}
+	if _, found, err := m.reclaimOwnedRouteTable(ruleList); err == nil || found {
+		t.Errorf("expect flushing failure to be returned, but got found %v, err %v", found, err)
+	}
+}
+
+func TestFindFirstEmptyRouteTable(t *testing.T) {
+	tableRange := TableRange{Min: 10000, Max: 10003}
+
+	testCases := []struct {
+		tableRouteCount map[int]int
+		reservedTables  []int
+		table           int
+		found           bool
+	}{
+		{
+			// every table in range is occupied
+			map[int]int{10000: 1, 10001: 2, 10002: 1},
+			nil,
+			0,
+			false,
+		},
+		{
+			map[int]int{10000: 1, 10002: 1},
+			nil,
+			10001,
+			true,
+		},
+		{
+			// table 10001 is reserved
+			map[int]int{10000: 1},
+			[]int{10001},
+			10002,
+			true,
+		},
+		{
+			// max of range is never chosen
+			map[int]int{10000: 1, 10001: 1},
+			[]int{10002},
+			0,
+			false,
+		},
+		{
+			nil,
+			nil,
+			10000,
+			true,
+		},
+	}
+
+	for index, test := range testCases {
+		table, found := findFirstEmptyRouteTable(test.tableRouteCount, tableRange, test.reservedTables...)
+		if table != test.table || found != test.found {
+			t.Errorf("test %v: expect table %v found %v but got table %v found %v",
+				index, test.table, test.found, table, found)
+		}
+	}
+}
+
+// BenchmarkFindEmptyRouteTable compares listing routes of every candidate table with listing routes of all
+// tables once, the netlink requests taken by each are reported as "listings/op".
+func BenchmarkFindEmptyRouteTable(b *testing.B) {
+	// the first 1000 tables are occupied by subnets
+	var routeList []netlink.Route
+	for table := MinRouteTableNum; table < MinRouteTableNum+1000; table++ {
+		routeList = append(routeList, netlink.Route{Table: table})
+	}
+
+	listRoutes := func(listings *int, table int) []netlink.Route {
+		*listings++
+		var result []netlink.Route
+		for _, route := range routeList {
+			if table == unix.RT_TABLE_UNSPEC || route.Table == table {
+				result = append(result, route)
+			}
+		}
+		return result
+	}
+
+	b.Run("per-table-listing", func(b *testing.B) {
+		listings := 0
+		for i := 0; i < b.N; i++ {
+			for table := DefaultTableRange.Min; table < DefaultTableRange.Max; table++ {
+				if len(listRoutes(&listings, table)) == 0 {
+					break
+				}
+			}
+		}
+		b.ReportMetric(float64(listings)/float64(b.N), "listings/op")
+	})
+
+	b.Run("single-listing", func(b *testing.B) {
+		listings := 0
+		for i := 0; i < b.N; i++ {
+			tableRouteCount := countRoutesByTable(listRoutes(&listings, unix.RT_TABLE_UNSPEC),
+				DefaultTableRange)
+			if _, found := findFirstEmptyRouteTable(tableRouteCount, DefaultTableRange); !found {
+				b.Fatal("expect an empty route table")
+			}
+		}
+		b.ReportMetric(float64(listings)/float64(b.N), "listings/op")
+	})
+}
+
+func TestFindConflictingAddress(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.1.0/24")
+
+	newAddr := func(addr string, flags int) netlink.Addr {
+		ip, ipNet, _ := net.ParseCIDR(addr)
+		ipNet.IP = ip
+		return netlink.Addr{IPNet: ipNet, Flags: flags}
+	}
+
+	testCases := []struct {
+		addrList []netlink.Addr
+		conflict string
+	}{
+		{
+			// address inside subnet
+			[]netlink.Addr{newAddr("10.0.1.5/24", 0)},
+			"",
+		},
+		{
+			// address of another subnet which doesn't cover this subnet
+			[]netlink.Addr{newAddr("192.168.0.5/24", 0)},
+			"",
+		},
+		{
+			// enhanced address
+			[]netlink.Addr{newAddr("10.0.0.5/16", unix.IFA_F_NOPREFIXROUTE)},
+			"",
+		},
+		{
+			[]netlink.Addr{newAddr("192.168.0.5/24", 0), newAddr("10.0.0.5/16", 0)},
+			"10.0.0.5/16",
+		},
+	}
+
+	for index, test := range testCases {
+		conflict := ""
+		if address := findConflictingAddress(test.addrList, cidr); address != nil {
+			conflict = address.IPNet.String()
+		}
+
+		if conflict != test.conflict {
+			t.Errorf("case %v: expect conflicting address %q but got %q", index, test.conflict, conflict)
+		}
+	}
+}
+
+func TestCheckVlanGateway(t *testing.T) {
+	_, v4Cidr, _ := net.ParseCIDR("10.0.1.0/24")
+	_, v6Cidr, _ := net.ParseCIDR("fd00:1::/64")
+
+	testCases := []struct {
+		name      string
+		cidr      *net.IPNet
+		gateway   string
+		family    int
+		expectErr bool
+	}{
+		{"ipv4 gateway inside subnet", v4Cidr, "10.0.1.1", netlink.FAMILY_V4, false},
+		{"ipv4 gateway outside subnet", v4Cidr, "10.0.2.1", netlink.FAMILY_V4, true},
+		{"ipv4 link-local gateway", v4Cidr, "169.254.0.1", netlink.FAMILY_V4, true},
+		{"ipv4 gateway missing", v4Cidr, "", netlink.FAMILY_V4, true},
+		{"ipv6 gateway inside subnet", v6Cidr, "fd00:1::1", netlink.FAMILY_V6, false},
+		{"ipv6 link-local gateway", v6Cidr, "fe80::1", netlink.FAMILY_V6, false},
+		{"ipv6 gateway outside subnet", v6Cidr, "fd00:2::1", netlink.FAMILY_V6, true},
+	}
+
+	for _, test := range testCases {
+		if err := checkVlanGateway(test.cidr, net.ParseIP(test.gateway), test.family); (err != nil) != test.expectErr {
+			t.Errorf("test %v failed, expect error %v but got %v", test.name, test.expectErr, err)
+		}
+	}
+}
+
+func TestDiffRoutes(t *testing.T) {
+	_, dst1, _ := net.ParseCIDR("10.0.0.0/24")
+	_, dst2, _ := net.ParseCIDR("10.0.1.0/24")
+	gw1 := net.ParseIP("192.168.0.1")
+	gw2 := net.ParseIP("192.168.0.2")
+	_, dst6, _ := net.ParseCIDR("2021:23::/64")
+
+	testCases := []struct {
+		name    string
+		desired []netlink.Route
+		actual  []netlink.Route
+		toAdd   int
+		toDel   int
+	}{
+		{
+			"equal routes",
+			[]netlink.Route{{Dst: dst1, Table: 10000, LinkIndex: 2}},
+			[]netlink.Route{{Dst: dst1, Table: 10000, LinkIndex: 2}},
+			0,
+			0,
+		},
+		{
+			"host bits of dst are ignored",
+			[]netlink.Route{{Dst: &net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(24, 32)}, Table: 10000}},
+			[]netlink.Route{{Dst: dst1, Table: 10000}},
+			0,
+			0,
+		},
+		{
+			"metric only difference",
+			[]netlink.Route{{Dst: dst1, Table: 10000, LinkIndex: 2, Priority: 100}},
+			[]netlink.Route{{Dst: dst1, Table: 10000, LinkIndex: 2, Priority: 200}},
+			1,
+			1,
+		},
+		{
+			"mtu only difference is replaced in place",
+			[]netlink.Route{{Dst: dst1, Table: 10000, LinkIndex: 2, MTU: 1400, AdvMSS: 1360}},
+			[]netlink.Route{{Dst: dst1, Table: 10000, LinkIndex: 2}},
+			1,
+			0,
+		},
+		{
+			"extra and missing routes",
+			[]netlink.Route{{Dst: dst1, Table: 10000, LinkIndex: 2}},
+			[]netlink.Route{{Dst: dst2, Table: 10000, LinkIndex: 2}},
+			1,
+			1,
+		},
+		{
+			"nil dst is the default route",
+			[]netlink.Route{{Dst: defaultRouteDstByFamily(netlink.FAMILY_V4), Table: 10000, LinkIndex: 2}},
+			[]netlink.Route{{Table: 10000, LinkIndex: 2}},
+			0,
+			0,
+		},
+		{
+			"ipv6 throw route filled by kernel",
+			[]netlink.Route{{Dst: dst6, Table: 10000, Type: unix.RTN_THROW, Family: netlink.FAMILY_V6}},
+			[]netlink.Route{{Dst: dst6, Table: 10000, Type: unix.RTN_THROW, Family: netlink.FAMILY_V6,
+				LinkIndex: 1, Priority: 1024}},
+			0,
+			0,
+		},
+		{
+			"unicast routes reported by kernel",
+			[]netlink.Route{
+				{Dst: dst1, Table: 10000, LinkIndex: 2, Scope: netlink.SCOPE_UNIVERSE},
+				{Table: 10000, LinkIndex: 2, Gw: gw1, Flags: int(netlink.FLAG_ONLINK)},
+			},
+			[]netlink.Route{
+				{Dst: dst1, Table: 10000, LinkIndex: 2, Type: unix.RTN_UNICAST, Protocol: unix.RTPROT_BOOT,
+					Scope: netlink.SCOPE_UNIVERSE},
+				{Table: 10000, LinkIndex: 2, Gw: gw1, Type: unix.RTN_UNICAST, Protocol: unix.RTPROT_BOOT,
+					Flags: int(netlink.FLAG_ONLINK)},
+			},
+			0,
+			0,
+		},
+		{
+			"ipv6 unicast route reported by kernel",
+			[]netlink.Route{{Dst: dst6, Table: 10000, LinkIndex: 2, Family: netlink.FAMILY_V6}},
+			[]netlink.Route{{Dst: dst6, Table: 10000, LinkIndex: 2, Family: netlink.FAMILY_V6,
+				Type: unix.RTN_UNICAST, Protocol: unix.RTPROT_BOOT, Priority: 1024}},
+			0,
+			0,
+		},
+		{
+			"multipath with different next hop order",
+			[]netlink.Route{{Table: 10000, MultiPath: []*netlink.NexthopInfo{
+				{LinkIndex: 2, Gw: gw1}, {LinkIndex: 2, Gw: gw2},
+			}}},
+			[]netlink.Route{{Table: 10000, MultiPath: []*netlink.NexthopInfo{
+				{LinkIndex: 2, Gw: gw2}, {LinkIndex: 2, Gw: gw1},
+			}}},
+			0,
+			0,
+		},
+		{
+			"multipath with different next hops",
+			[]netlink.Route{{Table: 10000, MultiPath: []*netlink.NexthopInfo{
+				{LinkIndex: 2, Gw: gw1}, {LinkIndex: 2, Gw: gw2},
+			}}},
+			[]netlink.Route{{Table: 10000, MultiPath: []*netlink.NexthopInfo{
+				{LinkIndex: 2, Gw: gw1},
+			}}},
+			1,
+			0,
+		},
+		{
+			"operator pinned host route is kept",
+			[]netlink.Route{{Dst: dst1, Table: 10000, LinkIndex: 2}},
+			[]netlink.Route{
+				{Dst: dst1, Table: 10000, LinkIndex: 2},
+				{Dst: &net.IPNet{IP: net.ParseIP("10.0.2.10"), Mask: net.CIDRMask(32, 32)}, Table: 10000,
+					LinkIndex: 2, Protocol: unix.RTPROT_STATIC},
+			},
+			0,
+			0,
+		},
+	}
+
+	for _, test := range testCases {
+		toAdd, toDel := DiffRoutes(test.desired, test.actual)
+		if len(toAdd) != test.toAdd || len(toDel) != test.toDel {
+			t.Errorf("%s: expect %v routes to add and %v to delete, but got %v and %v",
+				test.name, test.toAdd, test.toDel, len(toAdd), len(toDel))
+		}
+	}
+}
+
+func TestFilterRulesBySrcAndTable(t *testing.T) {
+	_, src, _ := net.ParseCIDR("10.0.0.0/24")
+
+	ruleList := []netlink.Rule{
+		{Table: 39999, Priority: 1000, Mark: -1, Mask: -1},
+		// overlay-mark rule whose mark drifted
+		{Table: 40001, Priority: 1002, Mark: 0x10, Mask: 0x10},
+		{Src: src, Table: 40001, Priority: 1003, Mark: -1, Mask: -1},
+		{Src: src, Table: 10000, Priority: 1004, Mark: -1, Mask: 0x4040},
+		{Src: src, Table: 10001, Priority: 1005, Mark: -1, Mask: 0x4040, Tos: 0xb8},
+	}
+
+	desired := netlink.Rule{Table: 40001, Priority: -1, Mark: 0x20, Mask: 0x20}
+	rules := filterRulesBySrcAndTable(ruleList, nil, 40001)
+	if len(rules) != 1 || rules[0].Priority != 1002 {
+		t.Fatalf("expect only the overlay-mark rule, but got %v", rules)
+	}
+
+	toAdd, toDel := DiffRules([]netlink.Rule{desired}, rules)
+	if len(toAdd) != 1 || len(toDel) != 1 {
+		t.Errorf("expect the drifted overlay-mark rule to be replaced, but got %v to add and %v to delete", toAdd, toDel)
+	}
+
+	// the local-pod-direct rule reported by kernel without mark matches the desired one
+	toAdd, toDel = DiffRules([]netlink.Rule{{Table: 39999, Priority: -1}}, filterRulesBySrcAndTable(ruleList, nil, 39999))
+	if len(toAdd) != 0 || len(toDel) != 0 {
+		t.Errorf("expect local-pod-direct rule unchanged, but got %v to add and %v to delete", toAdd, toDel)
+	}
+
+	// dscp rules are not included
+	if rules := filterRulesBySrcAndTable(ruleList, src, 10001); len(rules) != 0 {
+		t.Errorf("expect no rules for dscp table, but got %v", rules)
+	}
+	if rules := filterRulesBySrcAndTable(ruleList, src, 10000); len(rules) != 1 {
+		t.Errorf("expect the from-pod-subnet rule, but got %v", rules)
+	}
+}
+
+func TestSnapshotReplacedRoutes(t *testing.T) {
+	_, dst1, _ := net.ParseCIDR("10.0.0.0/24")
+	_, dst2, _ := net.ParseCIDR("10.0.1.0/24")
+	gw1 := net.ParseIP("192.168.0.1")
+	gw2 := net.ParseIP("192.168.0.2")
+
+	actual := []netlink.Route{
+		{Table: 10000, LinkIndex: 2, Gw: gw1, Type: unix.RTN_UNICAST, Protocol: unix.RTPROT_BOOT},
+		{Dst: dst1, Table: 10000, LinkIndex: 2, Type: unix.RTN_UNICAST, Protocol: unix.RTPROT_BOOT},
+	}
+	desired := []netlink.Route{
+		{Dst: defaultRouteDstByFamily(netlink.FAMILY_V4), Table: 10000, LinkIndex: 2, Gw: gw2},
+		{Dst: dst1, Table: 10000, LinkIndex: 2},
+		{Dst: dst2, Table: 10000, LinkIndex: 2},
+	}
+
+	toAdd, toDel := DiffRoutes(desired, actual)
+	if len(toAdd) != 2 || len(toDel) != 0 {
+		t.Fatalf("expect 2 routes to add and none to delete, but got %v and %v", toAdd, toDel)
+	}
+
+	replaced := snapshotReplacedRoutes(toAdd, actual)
+	if replaced[0] == nil || !replaced[0].Gw.Equal(gw1) {
+		t.Errorf("expect default route via %v to be restored on rollback, but got %v", gw1, replaced[0])
+	}
+	if replaced[1] != nil {
+		t.Errorf("expect new route %v to be deleted on rollback, but got %v", toAdd[1], replaced[1])
+	}
+}
+
+func TestDiffRules(t *testing.T) {
+	_, src1, _ := net.ParseCIDR("10.0.0.0/24")
+	_, src2, _ := net.ParseCIDR("10.0.1.0/24")
+
+	newRule := func(src *net.IPNet, table, priority, mark, mask int) netlink.Rule {
+		rule := netlink.NewRule()
+		rule.Src = src
+		rule.Table = table
+		rule.Priority = priority
+		rule.Mark = mark
+		rule.Mask = mask
+		return *rule
+	}
+
+	testCases := []struct {
+		name    string
+		desired []netlink.Rule
+		actual  []netlink.Rule
+		toAdd   int
+		toDel   int
+	}{
+		{
+			"equal rules",
+			[]netlink.Rule{newRule(src1, 10000, 100, 0, 0x30000)},
+			[]netlink.Rule{newRule(src1, 10000, 100, 0, 0x30000)},
+			0,
+			0,
+		},
+		{
+			"host bits of src are ignored",
+			[]netlink.Rule{newRule(&net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(24, 32)}, 10000, 100, 0, 0x30000)},
+			[]netlink.Rule{newRule(src1, 10000, 100, 0, 0x30000)},
+			0,
+			0,
+		},
+		{
+			"priority only difference",
+			[]netlink.Rule{newRule(src1, 10000, 100, 0, 0x30000)},
+			[]netlink.Rule{newRule(src1, 10000, 101, 0, 0x30000)},
+			1,
+			1,
+		},
+		{
+			"priority chosen by kernel",
+			[]netlink.Rule{newRule(src1, 10000, -1, 0, 0x30000)},
+			[]netlink.Rule{newRule(src1, 10000, 101, 0, 0x30000)},
+			0,
+			0,
+		},
+		{
+			"mark drift",
+			[]netlink.Rule{newRule(nil, 40001, 100, 0x20, 0x20)},
+			[]netlink.Rule{newRule(nil, 40001, 100, 0x40, 0x40)},
+			1,
+			1,
+		},
+		{
+			"mask drift",
+			[]netlink.Rule{newRule(src1, 10000, 100, 0, 0x30000)},
+			[]netlink.Rule{newRule(src1, 10000, 100, 0, 0x10000)},
+			1,
+			1,
+		},
+		{
+			"zero mark and mask are not reported by kernel",
+			[]netlink.Rule{newRule(nil, 39999, 100, 0, 0)},
+			[]netlink.Rule{newRule(nil, 39999, 100, -1, -1)},
+			0,
+			0,
+		},
+		{
+			"table drift",
+			[]netlink.Rule{newRule(src1, 10000, 100, 0, 0x30000)},
+			[]netlink.Rule{newRule(src1, 10001, 100, 0, 0x30000)},
+			1,
+			1,
+		},
+		{
+			"extra and missing rules",
+			[]netlink.Rule{newRule(src1, 10000, 100, 0, 0x30000)},
+			[]netlink.Rule{newRule(src1, 10000, 100, 0, 0x30000), newRule(src2, 10001, 99, 0, 0x30000)},
+			0,
+			1,
+		},
+		{
+			"duplicated actual rules",
+			[]netlink.Rule{newRule(src1, 10000, -1, 0, 0x30000)},
+			[]netlink.Rule{newRule(src1, 10000, 100, 0, 0x30000), newRule(src1, 10000, 99, 0, 0x30000)},
+			0,
+			1,
+		},
+	}
+
+	for _, test := range testCases {
+		toAdd, toDel := DiffRules(test.desired, test.actual)
+		if len(toAdd) != test.toAdd || len(toDel) != test.toDel {
+			t.Errorf("%s: expect %v rules to add and %v to delete, but got %v and %v",
+				test.name, test.toAdd, test.toDel, len(toAdd), len(toDel))
+		}
+	}
+}
+
+func TestDesiredRoutesForVxlanSubnet(t *testing.T) {
+	forwardLink := &netlink.Vxlan{LinkAttrs: netlink.LinkAttrs{Name: "eth0.vxlan4", Index: 10}}
+
+	_, underlayCidr, _ := net.ParseCIDR("192.168.1.0/24")
+	_, excludeBlock, _ := net.ParseCIDR("192.168.1.0/26")
+
+	underlaySubnetInfoMap := SubnetInfoMap{
+		CanonicalCIDRKey(underlayCidr): &SubnetInfo{cidr: underlayCidr},
+	}
+	excludeIPBlockMap := map[string]*net.IPNet{
+		CanonicalCIDRKey(excludeBlock): excludeBlock,
+	}
+
+	routes := desiredRoutesForVxlanSubnet(forwardLink, 10000, false, netlink.FAMILY_V4,
+		underlaySubnetInfoMap, excludeIPBlockMap, nil, nil)
+	if len(routes) != 1 || routes[0].LinkIndex != 10 || !isDefaultDstRoute(routes[0]) {
+		t.Errorf("expect only a default route through vxlan interface, but got %v", routes)
+	}
+
+	routes = desiredRoutesForVxlanSubnet(forwardLink, 10000, true, netlink.FAMILY_V4,
+		underlaySubnetInfoMap, excludeIPBlockMap, nil, nil)
+	if len(routes) != 2 {
+		t.Fatalf("expect an underlay subnet route and an exclude route, but got %v", routes)
+	}
+
+	for _, route := range routes {
+		if route.Type == unix.RTN_THROW {
+			if route.Dst.String() != excludeBlock.String() {
+				t.Errorf("unexpected exclude route %v", route)
+			}
+		} else if route.Dst.String() != underlayCidr.String() || route.LinkIndex != 10 {
+			t.Errorf("unexpected underlay subnet route %v", route)
+		}
+	}
+}
+
+func TestDesiredRoutesForVxlanSubnetWithOverlayDestinations(t *testing.T) {
+	forwardLink := &netlink.Vxlan{LinkAttrs: netlink.LinkAttrs{Name: "eth0.vxlan4", Index: 10}}
+
+	_, clusterCidr, _ := net.ParseCIDR("10.0.0.0/16")
+	_, serviceCidr, _ := net.ParseCIDR("10.96.0.0/12")
+	_, underlayCidr, _ := net.ParseCIDR("192.168.1.0/24")
+
+	underlaySubnetInfoMap := SubnetInfoMap{
+		CanonicalCIDRKey(underlayCidr): &SubnetInfo{cidr: underlayCidr},
+	}
+
+	routes := desiredRoutesForVxlanSubnet(forwardLink, 10000, false, netlink.FAMILY_V4,
+		underlaySubnetInfoMap, nil, []*net.IPNet{clusterCidr, serviceCidr}, nil)
+	if len(routes) != 2 {
+		t.Fatalf("expect two specific routes, but got %v", routes)
+	}
+
+	for index, expectedDst := range []*net.IPNet{clusterCidr, serviceCidr} {
+		if isDefaultDstRoute(routes[index]) || routes[index].Dst.String() != expectedDst.String() ||
+			routes[index].LinkIndex != 10 || routes[index].Table != 10000 {
+			t.Errorf("expect a route to %v through vxlan interface, but got %v", expectedDst, routes[index])
+		}
+	}
+
+	// overlay destinations don't work for subnets whose traffic will be NATed
+	routes = desiredRoutesForVxlanSubnet(forwardLink, 10000, true, netlink.FAMILY_V4,
+		underlaySubnetInfoMap, nil, []*net.IPNet{clusterCidr, serviceCidr}, nil)
+	if len(routes) != 1 || routes[0].Dst.String() != underlayCidr.String() {
+		t.Errorf("expect only an underlay subnet route, but got %v", routes)
+	}
+}
+
+func TestDesiredRoutesForVxlanSubnetWithEgressGateway(t *testing.T) {
+	forwardLink := &netlink.Vxlan{LinkAttrs: netlink.LinkAttrs{Name: "eth0.vxlan4", Index: 10}}
+
+	_, clusterCidr, _ := net.ParseCIDR("10.0.0.0/16")
+	_, underlayCidr, _ := net.ParseCIDR("192.168.1.0/24")
+	_, excludeBlock, _ := net.ParseCIDR("192.168.1.128/25")
+	egressGateway := net.ParseIP("172.16.0.10")
+
+	underlaySubnetInfoMap := SubnetInfoMap{
+		CanonicalCIDRKey(underlayCidr): &SubnetInfo{cidr: underlayCidr},
+	}
+	excludeIPBlockMap := map[string]*net.IPNet{
+		CanonicalCIDRKey(excludeBlock): excludeBlock,
+	}
+
+	// egress gateway takes effect no matter whether the traffic is supposed to be NATed or not
+	for _, autoNatOutgoing := range []bool{true, false} {
+		routes := desiredRoutesForVxlanSubnet(forwardLink, 10000, autoNatOutgoing, netlink.FAMILY_V4,
+			underlaySubnetInfoMap, excludeIPBlockMap, []*net.IPNet{clusterCidr}, egressGateway)
+		if len(routes) != 3 {
+			t.Fatalf("expect an underlay subnet route, an exclude route and a default route, but got %v", routes)
+		}
+
+		for _, route := range routes {
+			switch {
+			case route.Type == unix.RTN_THROW:
+				if route.Dst.String() != excludeBlock.String() {
+					t.Errorf("unexpected exclude route %v", route)
+				}
+			case isDefaultDstRoute(route):
+				if !route.Gw.Equal(egressGateway) || route.LinkIndex != 10 || route.Table != 10000 ||
+					route.Flags&int(netlink.FLAG_ONLINK) == 0 {
+					t.Errorf("expect an onlink default route to egress gateway through vxlan interface, but got %v", route)
+				}
+			default:
+				if route.Dst.String() != underlayCidr.String() || route.LinkIndex != 10 || route.Gw != nil {
+					t.Errorf("unexpected underlay subnet route %v", route)
+				}
+			}
+		}
+	}
+}
+
+func TestDesiredRoutesForVxlanSubnetOnEgressGatewayNode(t *testing.T) {
+	forwardLink := &netlink.Vxlan{LinkAttrs: netlink.LinkAttrs{Name: "eth0.vxlan4", Index: 10}}
+
+	_, underlayCidr, _ := net.ParseCIDR("192.168.1.0/24")
+	egressGateway := net.ParseIP("172.16.0.10")
+	underlaySubnetInfoMap := SubnetInfoMap{
+		CanonicalCIDRKey(underlayCidr): &SubnetInfo{cidr: underlayCidr},
+	}
+
+	localAddrList := []netlink.Addr{{IPNet: &net.IPNet{IP: egressGateway, Mask: net.CIDRMask(24, 32)}}}
+	remoteAddrList := []netlink.Addr{{IPNet: &net.IPNet{IP: net.ParseIP("172.16.0.11"), Mask: net.CIDRMask(24, 32)}}}
+
+	gateway, autoNatOutgoing := resolveLocalEgressGateway(egressGateway, false, remoteAddrList)
+	if !gateway.Equal(egressGateway) || autoNatOutgoing {
+		t.Errorf("expect egress gateway %v kept on other nodes, but got %v, nat %v", egressGateway, gateway, autoNatOutgoing)
+	}
+
+	gateway, autoNatOutgoing = resolveLocalEgressGateway(egressGateway, false, localAddrList)
+	if gateway != nil || !autoNatOutgoing {
+		t.Fatalf("expect egress gateway node to go out locally, but got %v, nat %v", gateway, autoNatOutgoing)
+	}
+
+	// traffic forwarded from other nodes must not be looped back to vxlan device by a default route
+	routes := desiredRoutesForVxlanSubnet(forwardLink, 10000, autoNatOutgoing, netlink.FAMILY_V4,
+		underlaySubnetInfoMap, nil, nil, gateway)
+	for _, route := range routes {
+		if isDefaultDstRoute(route) {
+			t.Errorf("expect no default route on egress gateway node, but got %v", route)
+		}
+	}
+	if len(routes) != 1 || routes[0].Dst.String() != underlayCidr.String() {
+		t.Errorf("expect only an underlay subnet route on egress gateway node, but got %v", routes)
+	}
+}
+
+func TestSetSubnetEgressGateway(t *testing.T) {
+	_, overlayCidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, underlayCidr, _ := net.ParseCIDR("192.168.1.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.AddSubnetInfo(overlayCidr, nil, nil, nil, nil, "eth0.vxlan4", false, true, false,
+		networkingv1.NetworkModeVxlan)
+	m.AddSubnetInfo(underlayCidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0", false, false, true,
+		networkingv1.NetworkModeVlan)
+
+	m.SetSubnetEgressGateway(overlayCidr, net.ParseIP("fd00::10"))
+	if m.localClusterOverlaySubnetInfoMap[CanonicalCIDRKey(overlayCidr)].egressGateway != nil {
+		t.Errorf("expect egress gateway of other family to be ignored")
+	}
+
+	m.SetSubnetEgressGateway(overlayCidr, net.ParseIP("172.16.0.10"))
+	if gateway := m.localClusterOverlaySubnetInfoMap[CanonicalCIDRKey(overlayCidr)].egressGateway; !gateway.Equal(net.ParseIP("172.16.0.10")) {
+		t.Errorf("expect egress gateway 172.16.0.10, but got %v", gateway)
+	}
+
+	m.SetSubnetEgressGateway(underlayCidr, net.ParseIP("172.16.0.10"))
+	if m.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(underlayCidr)].egressGateway != nil {
+		t.Errorf("expect egress gateway to be ignored for underlay subnet")
+	}
+}
+
+func TestSetSubnetOverlayDestinations(t *testing.T) {
+	_, overlayCidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, v4Destination, _ := net.ParseCIDR("10.0.0.0/16")
+	_, v6Destination, _ := net.ParseCIDR("fd00::/64")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.AddSubnetInfo(overlayCidr, nil, nil, nil, nil, "eth0.vxlan4", false, true, false,
+		networkingv1.NetworkModeVxlan)
+	m.SetSubnetOverlayDestinations(overlayCidr, []*net.IPNet{v4Destination, v6Destination})
+
+	destinations := m.localClusterOverlaySubnetInfoMap[CanonicalCIDRKey(overlayCidr)].overlayDestinations
+	if len(destinations) != 1 || destinations[0].String() != v4Destination.String() {
+		t.Errorf("expect only ipv4 destination is kept, but got %v", destinations)
+	}
+}
+
+func isDefaultDstRoute(route netlink.Route) bool {
+	ones, _ := route.Dst.Mask.Size()
+	return ones == 0
+}
+
+func TestPickHighestUnusedRulePriority(t *testing.T) {
+	testCases := []struct {
+		name          string
+		rules         []netlink.Rule
+		fallbackBase  int
+		priority      int
+		nodeLocalRule bool
+	}{
+		{
+			"node local rule exists",
+			[]netlink.Rule{{Table: NodeLocalTableNum, Priority: 0}, {Table: 39999, Priority: 1}, {Table: 254, Priority: 32766}},
+			DefaultRulePriorityFallbackBase,
+			2,
+			true,
+		},
+		{
+			"node local rule moved",
+			[]netlink.Rule{{Table: NodeLocalTableNum, Priority: 1000}, {Table: 254, Priority: 32766}},
+			DefaultRulePriorityFallbackBase,
+			1001,
+			true,
+		},
+		{
+			"node local rule missing",
+			[]netlink.Rule{{Table: 254, Priority: 32766}, {Table: 253, Priority: 32767}},
+			DefaultRulePriorityFallbackBase,
+			DefaultRulePriorityFallbackBase + 1,
+			false,
+		},
+		{
+			"node local rule missing and fallback base in use",
+			[]netlink.Rule{{Table: 39999, Priority: 101}, {Table: 254, Priority: 32766}},
+			DefaultRulePriorityFallbackBase,
+			DefaultRulePriorityFallbackBase + 2,
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		priority, nodeLocalRule, err := pickHighestUnusedRulePriority(tc.rules, tc.fallbackBase)
+		if err != nil {
+			t.Errorf("test %s fails: unexpected error %v", tc.name, err)
+			continue
+		}
+
+		if priority != tc.priority || nodeLocalRule != tc.nodeLocalRule {
+			t.Errorf("test %s fails: expect priority %v and node local rule found %v, but got %v and %v",
+				tc.name, tc.priority, tc.nodeLocalRule, priority, nodeLocalRule)
+		}
+	}
+}
+
+func TestCountExcludeIPBlocksBySubnet(t *testing.T) {
+	_, subnet1, _ := net.ParseCIDR("10.0.0.0/24")
+	_, subnet2, _ := net.ParseCIDR("10.0.1.0/24")
+	_, subnet3, _ := net.ParseCIDR("10.0.2.0/24")
+
+	subnetInfoMap := SubnetInfoMap{
+		CanonicalCIDRKey(subnet1): &SubnetInfo{cidr: subnet1},
+		CanonicalCIDRKey(subnet2): &SubnetInfo{cidr: subnet2},
+		CanonicalCIDRKey(subnet3): &SubnetInfo{cidr: subnet3},
+	}
+
+	excludeIPBlockMap := map[string]*net.IPNet{}
+	for _, block := range []string{"10.0.0.0/26", "10.0.0.64/27", "10.0.0.255/32", "10.0.1.128/25", "10.0.5.0/24"} {
+		_, cidr, _ := net.ParseCIDR(block)
+		excludeIPBlockMap[CanonicalCIDRKey(cidr)] = cidr
+	}
+
+	countMap := countExcludeIPBlocksBySubnet(subnetInfoMap, excludeIPBlockMap)
+	expected := map[string]int{
+		CanonicalCIDRKey(subnet1): 3,
+		CanonicalCIDRKey(subnet2): 1,
+	}
+
+	if len(countMap) != len(expected) {
+		t.Fatalf("expect count map %v but got %v", expected, countMap)
+	}
+	for subnet, count := range expected {
+		if countMap[subnet] != count {
+			t.Errorf("expect %v exclude ip blocks for subnet %v but got %v", count, subnet, countMap[subnet])
+		}
+	}
+}
+
+func TestSetRouteSource(t *testing.T) {
+	_, localAddr, _ := net.ParseCIDR("192.168.1.10/24")
+	localAddr.IP = net.ParseIP("192.168.1.10")
+	addrList := []netlink.Addr{{IPNet: localAddr}}
+
+	route := &netlink.Route{Gw: net.ParseIP("192.168.1.1"), Table: 10000}
+	if err := setRouteSource(route, net.ParseIP("192.168.1.10"), addrList); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !route.Src.Equal(net.ParseIP("192.168.1.10")) {
+		t.Errorf("expect route source 192.168.1.10 but got %v", route.Src)
+	}
+
+	route = &netlink.Route{Gw: net.ParseIP("192.168.1.1"), Table: 10000}
+	if err := setRouteSource(route, net.ParseIP("192.168.1.11"), addrList); err == nil {
+		t.Errorf("expect error for a source ip not assigned on this node")
+	} else if IsPermanentError(err) {
+		t.Errorf("expect a transient error for a source ip not assigned on this node, but got %v", err)
+	}
+
+	if route.Src != nil {
+		t.Errorf("expect no route source but got %v", route.Src)
+	}
+}
+
+func TestSetSubnetRouteSource(t *testing.T) {
+	_, bgpCidr, _ := net.ParseCIDR("192.168.1.0/24")
+	_, vlanCidr, _ := net.ParseCIDR("192.168.2.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.AddSubnetInfo(bgpCidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0", false, false, true,
+		networkingv1.NetworkModeBGP)
+	m.AddSubnetInfo(vlanCidr, net.ParseIP("192.168.2.1"), nil, nil, nil, "eth0", false, false, true,
+		networkingv1.NetworkModeVlan)
+
+	m.SetSubnetRouteSource(bgpCidr, net.ParseIP("fd00::1"))
+	m.SetSubnetRouteSource(bgpCidr, net.ParseIP("10.0.0.1"))
+	m.SetSubnetRouteSource(vlanCidr, net.ParseIP("10.0.0.1"))
+
+	if routeSrc := m.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(bgpCidr)].routeSrc; !routeSrc.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("expect route source 10.0.0.1 for bgp subnet but got %v", routeSrc)
+	}
+
+	if routeSrc := m.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(vlanCidr)].routeSrc; routeSrc != nil {
+		t.Errorf("expect no route source for vlan subnet but got %v", routeSrc)
+	}
+}
+
+func TestFilterRoutesToClear(t *testing.T) {
+	_, pinnedDst, _ := net.ParseCIDR("192.168.10.10/32")
+	_, pinnedV6Dst, _ := net.ParseCIDR("fd00::10/128")
+	_, subnetDst, _ := net.ParseCIDR("192.168.1.0/24")
+
+	routeList := []netlink.Route{
+		// default route
+		{Table: 10000, Gw: net.ParseIP("192.168.1.1")},
+		{Table: 10000, Dst: subnetDst, Protocol: unix.RTPROT_STATIC},
+		{Table: 10000, Dst: pinnedDst, Protocol: unix.RTPROT_BOOT},
+		{Table: 10000, Dst: pinnedDst, Protocol: unix.RTPROT_STATIC},
+		{Table: 10000, Dst: pinnedV6Dst, Protocol: unix.RTPROT_STATIC},
+	}
+
+	if routes := filterRoutesToClear(routeList, nil); len(routes) != len(routeList) {
+		t.Errorf("expect all routes to be cleared without preserve predicate, but got %v", routes)
+	}
+
+	routes := filterRoutesToClear(routeList, isOperatorPinnedRoute)
+	if len(routes) != 3 {
+		t.Fatalf("expect 3 routes to be cleared, but got %v", routes)
+	}
+
+	for _, route := range routes {
+		if route.Protocol == unix.RTPROT_STATIC && (route.Dst == pinnedDst || route.Dst == pinnedV6Dst) {
+			t.Errorf("expect pinned route %v to be preserved", route)
+		}
+	}
+}
+
+func TestFromPodSubnetRuleWithCustomMarks(t *testing.T) {
+	_, src, _ := net.ParseCIDR("192.168.0.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	if m.fromRuleMask != 0x4040 {
+		t.Fatalf("expect default from rule mask 0x4040, but got %#x", m.fromRuleMask)
+	}
+
+	m.SetTrafficMarks(0x8000, iptables.FullNATedPodTrafficMark)
+	rule := m.newFromPodSubnetRule(src, MinRouteTableNum, 1000, 0)
+	if rule.Mask != 0x8040 || rule.Mark != fromRuleMark {
+		t.Fatalf("expect from rule mask 0x8040 for custom marks, but got %v", rule)
+	}
+
+	// rules reported by kernel have no mark attribute, rules of both previous and current masks are recognized
+	tests := []struct {
+		name     string
+		rule     netlink.Rule
+		expected bool
+	}{
+		{"current mask", netlink.Rule{Src: src, Table: MinRouteTableNum, Mark: -1, Mask: 0x8040}, true},
+		{"previous mask", netlink.Rule{Src: src, Table: MinRouteTableNum, Mark: -1, Mask: 0x4040}, true},
+		{"dscp rule of previous mask", netlink.Rule{Src: src, Table: MinRouteTableNum, Mark: -1, Mask: 0x4040, Tos: 0xb8}, true},
+		{"old rule without mask", netlink.Rule{Src: src, Table: MinRouteTableNum, Mark: -1, Mask: -1}, false},
+		{"rule matching a mark", netlink.Rule{Src: src, Table: MinRouteTableNum, Mark: 0x20, Mask: 0x20}, false},
+		{"rule out of table range", netlink.Rule{Src: src, Table: 100, Mark: -1, Mask: 0x8040}, false},
+	}
+
+	for _, test := range tests {
+		if result := checkIsFromPodSubnetRule(test.rule, DefaultTableRange); result != test.expected {
+			t.Errorf("%s: expect %v, but got %v", test.name, test.expected, result)
+		}
+	}
+}
+
+func TestPlanFromRuleMaskRepairs(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.1.0/24")
+	_, removedCidr, _ := net.ParseCIDR("192.168.2.0/24")
+
+	m := newTestManager(netlink.FAMILY_V4)
+	m.AddSubnetInfo(cidr, net.ParseIP("192.168.1.1"), nil, nil, nil, "eth0", false, false, true,
+		networkingv1.NetworkModeVlan)
+	m.localClusterUnderlaySubnetInfoMap[CanonicalCIDRKey(cidr)].dscpGateways = map[uint8]net.IP{
+		46: net.ParseIP("192.168.1.254"),
+	}
+	m.SetTrafficMarks(0x8000, iptables.FullNATedPodTrafficMark)
+
+	ruleList := []netlink.Rule{
+		{Src: cidr, Table: 10000, Priority: 1001, Mark: -1, Mask: 0x4040},
+		{Src: cidr, Table: 10001, Priority: 1000, Mark: -1, Mask: 0x4040, Tos: dscpToTos(46)},
+		{Src: removedCidr, Table: 10002, Priority: 1002, Mark: -1, Mask: 0x4040},
+		{Src: cidr, Table: 10003, Priority: 1003, Mark: -1, Mask: 0x8040},
+	}
+
+	toAdd, toDel := m.planFromRuleMaskRepairs(ruleList[:2])
+	if len(toAdd) != 2 || len(toDel) != 2 {
+		t.Fatalf("expect 2 rules to be repaired, but got %v to add and %v to delete", toAdd, toDel)
+	}
+
+	for i, rule := range toAdd {
+		if rule.Mask != 0x8040 || rule.Table != ruleList[i].Table || rule.Priority != ruleList[i].Priority ||
+			rule.Tos != ruleList[i].Tos {
+			t.Errorf("expect rule %v to be repaired with mask 0x8040 and the same table, priority and tos, "+
+				"but got %v", ruleList[i], rule)
+		}
+	}
+
+	// rules of removed subnets are torn down rather than repaired, rules of current mask are untouched
+	if toAdd, toDel = m.planFromRuleMaskRepairs(ruleList[2:]); len(toAdd) != 0 || len(toDel) != 0 {
+		t.Errorf("expect nothing to be repaired, but got %v to add and %v to delete", toAdd, toDel)
+	}
+}
+
+func TestDesiredRoutesForVxlanSubnetWithMTU(t *testing.T) {
+	forwardLink := &netlink.Vxlan{LinkAttrs: netlink.LinkAttrs{Name: "eth0.vxlan4", Index: 10}}
+
+	_, underlayCidr, _ := net.ParseCIDR("192.168.1.0/24")
+	_, excludeBlock, _ := net.ParseCIDR("192.168.1.128/25")
+
+	underlaySubnetInfoMap := SubnetInfoMap{
+		CanonicalCIDRKey(underlayCidr): &SubnetInfo{cidr: underlayCidr},
+	}
+	excludeIPBlockMap := map[string]*net.IPNet{
+		CanonicalCIDRKey(excludeBlock): excludeBlock,
+	}
+
+	routes := desiredRoutesForVxlanSubnet(forwardLink, 10000, true, netlink.FAMILY_V4,
+		underlaySubnetInfoMap, excludeIPBlockMap, nil, nil)
+	setRoutesMTU(routes, 1400, 1360)
+
+	for _, route := range routes {
+		if route.Type == unix.RTN_THROW {
+			if route.MTU != 0 || route.AdvMSS != 0 {
+				t.Errorf("expect no mtu on throw route, but got %v", route)
+			}
+			continue
+		}
+		if route.MTU != 1400 || route.AdvMSS != 1360 {
+			t.Errorf("expect mtu 1400 and advmss 1360 on route, but got %v", route)
+		}
+	}
+
+	// routes without mtu are replaced rather than deleted
+	var actual []netlink.Route
+	for _, route := range routes {
+		route.MTU, route.AdvMSS = 0, 0
+		actual = append(actual, route)
+	}
+	toAdd, toDel := DiffRoutes(routes, actual)
+	if len(toAdd) != 1 || len(toDel) != 0 {
+		t.Errorf("expect 1 route to be replaced, but got %v to add and %v to delete", toAdd, toDel)
+	}
+
+	// re-sync with mtu applied changes nothing
+	toAdd, toDel = DiffRoutes(routes, routes)
+	if len(toAdd) != 0 || len(toDel) != 0 {
+		t.Errorf("expect no changes on re-sync, but got %v to add and %v to delete", toAdd, toDel)
+	}
+}
+
+func TestTableRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		tableRange TableRange
+		expectErr  bool
+	}{
+		{"default", DefaultTableRange, false},
+		{"custom", TableRange{Min: 50000, Max: 60000}, false},
+		{"max boundary", TableRange{Min: 256, Max: 1 << 31}, false},
+		{"reserved tables", TableRange{Min: 255, Max: 1000}, true},
+		{"too large", TableRange{Min: 50000, Max: 1<<31 + 1}, true},
+		{"empty", TableRange{Min: 50000, Max: 50000}, true},
+		{"inverted", TableRange{Min: 60000, Max: 50000}, true},
+		{"overlapping fixed tables", TableRange{Min: 30000, Max: 40002}, false},
+	}
+
+	for _, test := range tests {
+		if err := test.tableRange.Validate(); (err != nil) != test.expectErr {
+			t.Errorf("test %v failed, expect error %v but got %v", test.name, test.expectErr, err)
+		}
+	}
+
+	_, src, _ := net.ParseCIDR("192.168.0.0/24")
+	customRange := TableRange{Min: 50000, Max: 60000}
+	rule := netlink.Rule{Src: src, Table: MinRouteTableNum, Mask: DefaultFromRuleMask}
+
+	if !checkIsFromPodSubnetRule(rule, DefaultTableRange) || checkIsFromPodSubnetRule(rule, customRange) {
+		t.Errorf("expect rule of table %v to be only managed in default range", rule.Table)
+	}
+
+	rule.Table = 50000
+	if checkIsFromPodSubnetRule(rule, DefaultTableRange) || !checkIsFromPodSubnetRule(rule, customRange) {
+		t.Errorf("expect rule of table %v to be only managed in custom range", rule.Table)
+	}
+
+	rule.Table = 60000
+	if checkIsFromPodSubnetRule(rule, customRange) {
+		t.Errorf("expect rule of table %v not to be managed, max of range is exclusive", rule.Table)
+	}
+}
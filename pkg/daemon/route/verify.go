@@ -0,0 +1,134 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+)
+
+// routeWriteVerifier logs the mismatches between written routes and the ones read back from kernel,
+// verification is disabled if it is nil.
+var routeWriteVerifier *rateLimitedLogger
+
+// EnableRouteWriteVerification makes every replaced route to be read back from kernel and compared with the
+// requested one, mismatches will be logged as warnings. It is for debugging the kernel-version-specific behaviors,
+// e.g., a normalized scope or a dropped onlink flag, and should be called before any route manager syncs.
+func EnableRouteWriteVerification(logger logr.Logger) {
+	routeWriteVerifier = newRateLimitedLogger(logger, defaultLogBurst, defaultLogRefillInterval)
+}
+
+// replaceRoute replaces the route and verifies it if route write verification is enabled.
+func replaceRoute(route *netlink.Route) error {
+	if err := netlink.RouteReplace(route); err != nil {
+		return err
+	}
+
+	if routeWriteVerifier != nil {
+		verifyWrittenRoute(routeWriteVerifier, route)
+	}
+	return nil
+}
+
+func verifyWrittenRoute(logger *rateLimitedLogger, requested *netlink.Route) {
+	// the same route is written in every sync, only coalesce the logs of the same route
+	routeKey := requested.String()
+
+	family := requested.Family
+	if family == 0 {
+		family = netlink.FAMILY_ALL
+		if requested.Dst != nil {
+			family = netlink.FAMILY_V6
+			if requested.Dst.IP.To4() != nil {
+				family = netlink.FAMILY_V4
+			}
+		}
+	}
+
+	routeList, err := netlink.RouteListFiltered(family, &netlink.Route{
+		Table: requested.Table,
+	}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		logger.Error("read-back-failed/"+routeKey, err, "failed to read back written route", "route", requested.String())
+		return
+	}
+
+	actual, found := findWrittenRoute(requested, routeList)
+	if !found {
+		logger.Info("not-found/"+routeKey, "written route not found in kernel", "route", requested.String())
+		return
+	}
+
+	if mismatches := compareWrittenRoute(requested, actual); len(mismatches) != 0 {
+		logger.Info("mismatched/"+routeKey, "written route is different from kernel", "requested", requested.String(),
+			"actual", actual.String(), "mismatches", mismatches)
+		return
+	}
+
+	logger.logger.V(4).Info("written route verified", "route", requested.String())
+}
+
+// findWrittenRoute finds the route read back from kernel which has the same destination and metric
+// with the requested one.
+func findWrittenRoute(requested *netlink.Route, routeList []netlink.Route) (*netlink.Route, bool) {
+	for i := range routeList {
+		if routeDstKey(&routeList[i]) == routeDstKey(requested) &&
+			routePriority(&routeList[i]) == routePriority(requested) {
+			return &routeList[i], true
+		}
+	}
+	return nil, false
+}
+
+// compareWrittenRoute returns the fields of the route read back from kernel which differ from the requested one,
+// fields not specified in the requested route are ignored.
+func compareWrittenRoute(requested, actual *netlink.Route) []string {
+	var mismatches []string
+
+	if requested.LinkIndex != 0 && !isExcludeRoute(requested) && requested.LinkIndex != actual.LinkIndex {
+		mismatches = append(mismatches, fmt.Sprintf("link index %v != %v", requested.LinkIndex, actual.LinkIndex))
+	}
+
+	if requested.Gw != nil && !requested.Gw.Equal(actual.Gw) {
+		mismatches = append(mismatches, fmt.Sprintf("gateway %v != %v", requested.Gw, actual.Gw))
+	}
+
+	if requested.Src != nil && !requested.Src.Equal(actual.Src) {
+		mismatches = append(mismatches, fmt.Sprintf("source %v != %v", requested.Src, actual.Src))
+	}
+
+	if requested.Scope != actual.Scope {
+		mismatches = append(mismatches, fmt.Sprintf("scope %v != %v", requested.Scope, actual.Scope))
+	}
+
+	if requested.Type != 0 && requested.Type != actual.Type {
+		mismatches = append(mismatches, fmt.Sprintf("type %v != %v", requested.Type, actual.Type))
+	}
+
+	if requested.Protocol != 0 && requested.Protocol != actual.Protocol {
+		mismatches = append(mismatches, fmt.Sprintf("protocol %v != %v", requested.Protocol, actual.Protocol))
+	}
+
+	if onlink := int(netlink.FLAG_ONLINK); requested.Flags&onlink != actual.Flags&onlink {
+		mismatches = append(mismatches, fmt.Sprintf("onlink flag %v != %v",
+			requested.Flags&onlink != 0, actual.Flags&onlink != 0))
+	}
+
+	return mismatches
+}
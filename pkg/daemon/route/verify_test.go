@@ -0,0 +1,127 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestFindWrittenRoute(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, v6Cidr, _ := net.ParseCIDR("fd00::/64")
+
+	routeList := []netlink.Route{
+		{Dst: nil, Table: 10000, LinkIndex: 10},
+		{Dst: cidr, Table: 10000, LinkIndex: 10, Priority: 100},
+		{Dst: v6Cidr, Table: 10000, LinkIndex: 10, Priority: defaultIPv6RouteMetric, Family: netlink.FAMILY_V6},
+	}
+
+	tests := []struct {
+		name      string
+		requested netlink.Route
+		expected  int
+		found     bool
+	}{
+		{
+			name:      "default route",
+			requested: netlink.Route{Dst: defaultRouteDstByFamily(netlink.FAMILY_V4), Table: 10000},
+			expected:  0,
+			found:     true,
+		},
+		{
+			name:      "route with metric",
+			requested: netlink.Route{Dst: cidr, Table: 10000, Priority: 100},
+			expected:  1,
+			found:     true,
+		},
+		{
+			name:      "route with different metric",
+			requested: netlink.Route{Dst: cidr, Table: 10000},
+			found:     false,
+		},
+		{
+			name:      "ipv6 route with default metric",
+			requested: netlink.Route{Dst: v6Cidr, Table: 10000, Family: netlink.FAMILY_V6},
+			expected:  2,
+			found:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, found := findWrittenRoute(&test.requested, routeList)
+			if found != test.found {
+				t.Fatalf("expect found %v, but got %v", test.found, found)
+			}
+			if found && actual != &routeList[test.expected] {
+				t.Errorf("expect route %v, but got %v", routeList[test.expected], *actual)
+			}
+		})
+	}
+}
+
+func TestCompareWrittenRoute(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/24")
+	gateway := net.ParseIP("192.168.1.1")
+
+	tests := []struct {
+		name      string
+		requested netlink.Route
+		actual    netlink.Route
+		expected  []string
+	}{
+		{
+			name:      "same route",
+			requested: netlink.Route{Dst: cidr, LinkIndex: 10, Gw: gateway, Flags: int(netlink.FLAG_ONLINK)},
+			actual: netlink.Route{Dst: cidr, LinkIndex: 10, Gw: gateway, Flags: int(netlink.FLAG_ONLINK),
+				Protocol: unix.RTPROT_BOOT, Type: unix.RTN_UNICAST},
+			expected: nil,
+		},
+		{
+			name:      "onlink flag dropped and scope normalized",
+			requested: netlink.Route{Dst: cidr, LinkIndex: 10, Gw: gateway, Flags: int(netlink.FLAG_ONLINK)},
+			actual:    netlink.Route{Dst: cidr, LinkIndex: 10, Gw: gateway, Scope: netlink.SCOPE_LINK},
+			expected:  []string{"scope universe != link", "onlink flag true != false"},
+		},
+		{
+			name:      "throw route on loopback",
+			requested: netlink.Route{Dst: cidr, Type: unix.RTN_THROW},
+			actual:    netlink.Route{Dst: cidr, Type: unix.RTN_THROW, LinkIndex: 1},
+			expected:  nil,
+		},
+		{
+			name:      "different device",
+			requested: netlink.Route{Dst: cidr, LinkIndex: 10},
+			actual:    netlink.Route{Dst: cidr, LinkIndex: 11},
+			expected:  []string{"link index 10 != 11"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mismatches := compareWrittenRoute(&test.requested, &test.actual)
+			if fmt.Sprint(mismatches) != fmt.Sprint(test.expected) {
+				t.Errorf("expect mismatches %v, but got %v", test.expected, mismatches)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// WarmUpResult records what has been repaired by WarmUp.
+type WarmUpResult struct {
+	DuplicatedRulesDeleted int
+	EmptyTableRulesDeleted int
+	OrphanTablesReclaimed  int
+}
+
+// EnableWarmUp makes the first SyncRoutes audit rules and route tables left by the previous instance before
+// syncing, so that the drifts are repaired against the desired state recorded by then.
+func (m *Manager) EnableWarmUp() {
+	m.warmUpPending = true
+}
+
+// warmUp repairs the drifts left by the previous instance: duplicated from-pod-subnet rules and rules pointing to
+// empty tables will be deleted, tables of the deleted rules will be reclaimed if not referenced any more, the same as
+// the non-empty tables in range which are not referenced by any rule. Tables referenced by other rules might be owned
+// by others and are never reclaimed. The deleted rules of expected subnets are recreated by the following sync.
+func (m *Manager) warmUp() (*WarmUpResult, error) {
+	ruleList, err := netlink.RuleList(m.family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %v", err)
+	}
+
+	routeList, err := netlink.RouteListFiltered(m.family, &netlink.Route{
+		Table: unix.RT_TABLE_UNSPEC,
+	}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes of all tables: %v", err)
+	}
+
+	tableRouteCount := countRoutesByTable(routeList, m.tableRange)
+	duplicatedRules, emptyTableRules, retainedRules := planFromPodSubnetRuleRepairs(ruleList, tableRouteCount, m.tableRange)
+
+	result := &WarmUpResult{}
+	for _, rule := range append(duplicatedRules, emptyTableRules...) {
+		rule.Family = m.family
+		if err := netlink.RuleDel(&rule); err != nil {
+			return result, fmt.Errorf("failed to delete rule %v: %v", rule.String(), err)
+		}
+	}
+	result.DuplicatedRulesDeleted = len(duplicatedRules)
+	result.EmptyTableRulesDeleted = len(emptyTableRules)
+
+	// fixed tables and tables pending deletion should never be reclaimed even if their rules are missing
+	reservedTables := append(m.fixedTableNums(), m.pendingDeleteTableNums()...)
+	for _, table := range findOrphanRouteTables(retainedRules, tableRouteCount, m.ownedTables, reservedTables...) {
+		if err := m.flushTable(table); err != nil {
+			return result, fmt.Errorf("failed to reclaim orphan route table %v: %v", table, err)
+		}
+		result.OrphanTablesReclaimed++
+	}
+
+	return result, nil
+}
+
+// seedOwnedRouteTables derives owned tables from the rules and route tables left by the previous instance, so that
+// the orphan tables left by it can still be reclaimed after restarting.
+func (m *Manager) seedOwnedRouteTables() error {
+	ruleList, err := netlink.RuleList(m.family)
+	if err != nil {
+		return fmt.Errorf("failed to list rules: %v", err)
+	}
+
+	routeList, err := netlink.RouteListFiltered(m.family, &netlink.Route{
+		Table: unix.RT_TABLE_UNSPEC,
+	}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return fmt.Errorf("failed to list routes of all tables: %v", err)
+	}
+
+	reservedTables := append(m.fixedTableNums(), m.pendingDeleteTableNums()...)
+	for _, table := range findOwnedRouteTables(ruleList, countRoutesByTable(routeList, m.tableRange), m.tableRange,
+		reservedTables...) {
+		m.ownedTables[table] = true
+	}
+	return nil
+}
+
+// findOwnedRouteTables finds out the tables pointed by from-pod-subnet rules, and the non-empty tables in range
+// which are not referenced by any rule, e.g., the rule of subnet is deleted but flushing its table failed before
+// restarting. Tables referenced by other rules and reserved tables are never owned.
+func findOwnedRouteTables(ruleList []netlink.Rule, tableRouteCount map[int]int, tableRange TableRange,
+	reservedTables ...int) []int {
+	ownedTableMap := map[int]bool{}
+	referencedTableMap := map[int]bool{}
+	for _, rule := range ruleList {
+		referencedTableMap[rule.Table] = true
+		if checkIsFromPodSubnetRule(rule, tableRange) {
+			ownedTableMap[rule.Table] = true
+		}
+	}
+	for _, table := range reservedTables {
+		referencedTableMap[table] = true
+	}
+
+	for table, count := range tableRouteCount {
+		if count != 0 && tableRange.Contains(table) && !referencedTableMap[table] {
+			ownedTableMap[table] = true
+		}
+	}
+
+	var ownedTables []int
+	for table := range ownedTableMap {
+		ownedTables = append(ownedTables, table)
+	}
+	sort.Ints(ownedTables)
+	return ownedTables
+}
+
+// countRoutesByTable counts routes of every table in range.
+func countRoutesByTable(routeList []netlink.Route, tableRange TableRange) map[int]int {
+	tableRouteCount := map[int]int{}
+	for _, route := range routeList {
+		if tableRange.Contains(route.Table) {
+			tableRouteCount[route.Table]++
+		}
+	}
+	return tableRouteCount
+}
+
+// planFromPodSubnetRuleRepairs finds out the from-pod-subnet rules which are duplicated with a higher priority
+// rule of the same source and tos, and the ones pointing to empty tables. Other rules will be retained.
+func planFromPodSubnetRuleRepairs(ruleList []netlink.Rule, tableRouteCount map[int]int, tableRange TableRange) (duplicated,
+	emptyTable, retained []netlink.Rule) {
+	sortedRules := make([]netlink.Rule, len(ruleList))
+	copy(sortedRules, ruleList)
+	sort.SliceStable(sortedRules, func(i, j int) bool {
+		return realRulePriority(sortedRules[i].Priority) < realRulePriority(sortedRules[j].Priority)
+	})
+
+	seen := map[string]bool{}
+	for _, rule := range sortedRules {
+		if !checkIsFromPodSubnetRule(rule, tableRange) {
+			retained = append(retained, rule)
+			continue
+		}
+
+		key := fmt.Sprintf("%v/%v", CanonicalCIDRKey(rule.Src), rule.Tos)
+		switch {
+		case seen[key]:
+			duplicated = append(duplicated, rule)
+		case tableRouteCount[rule.Table] == 0:
+			emptyTable = append(emptyTable, rule)
+		default:
+			seen[key] = true
+			retained = append(retained, rule)
+		}
+	}
+	return
+}
+
+// findOrphanRouteTables finds out the non-empty owned tables which are not referenced by any rule, except reserved
+// tables.
+func findOrphanRouteTables(ruleList []netlink.Rule, tableRouteCount map[int]int, ownedTables map[int]bool,
+	reservedTables ...int) []int {
+	referencedTableMap := map[int]bool{}
+	for _, rule := range ruleList {
+		referencedTableMap[rule.Table] = true
+	}
+	for _, table := range reservedTables {
+		referencedTableMap[table] = true
+	}
+
+	var orphanTables []int
+	for table, count := range tableRouteCount {
+		if count != 0 && ownedTables[table] && !referencedTableMap[table] {
+			orphanTables = append(orphanTables, table)
+		}
+	}
+	sort.Ints(orphanTables)
+	return orphanTables
+}
@@ -0,0 +1,132 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package route
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestPlanFromPodSubnetRuleRepairs(t *testing.T) {
+	_, cidr1, _ := net.ParseCIDR("10.0.0.0/24")
+	_, cidr2, _ := net.ParseCIDR("10.0.1.0/24")
+
+	newFromRule := func(src *net.IPNet, table, priority, tos int) netlink.Rule {
+		rule := netlink.NewRule()
+		rule.Src = src
+		rule.Table = table
+		rule.Priority = priority
+		rule.Tos = uint(tos)
+		rule.Mask = DefaultFromRuleMask
+		return *rule
+	}
+
+	localRule := netlink.NewRule()
+	localRule.Table = NodeLocalTableNum
+
+	ruleList := []netlink.Rule{
+		*localRule,
+		newFromRule(cidr1, 10001, 5, 0),
+		// duplicated with the rule of priority 5
+		newFromRule(cidr1, 10002, 6, 0),
+		// dscp rule of the same source is not duplicated
+		newFromRule(cidr1, 10003, 4, 184),
+		// points to an empty table
+		newFromRule(cidr2, 10004, 7, 0),
+	}
+
+	tableRouteCount := map[int]int{10001: 2, 10002: 2, 10003: 2}
+
+	duplicated, emptyTable, retained := planFromPodSubnetRuleRepairs(ruleList, tableRouteCount, DefaultTableRange)
+	if len(duplicated) != 1 || duplicated[0].Table != 10002 {
+		t.Errorf("expect duplicated rule of table 10002, but got %v", duplicated)
+	}
+
+	if len(emptyTable) != 1 || emptyTable[0].Table != 10004 {
+		t.Errorf("expect empty table rule of table 10004, but got %v", emptyTable)
+	}
+
+	if len(retained) != 3 {
+		t.Errorf("expect 3 retained rules, but got %v", retained)
+	}
+
+	// table 10005 is not referenced but not owned
+	ownedTables := map[int]bool{10001: true, 10002: true, 10003: true, 10004: true}
+	orphanTables := findOrphanRouteTables(retained, map[int]int{10001: 2, 10002: 2, 10003: 2, 10005: 1, 39999: 3},
+		ownedTables, 39999)
+	if len(orphanTables) != 1 || orphanTables[0] != 10002 {
+		t.Errorf("expect orphan tables [10002], but got %v", orphanTables)
+	}
+}
+
+func TestFindOwnedRouteTables(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/24")
+
+	fromRule := netlink.NewRule()
+	fromRule.Src = cidr
+	fromRule.Table = 10001
+	fromRule.Mask = DefaultFromRuleMask
+
+	duplicatedFromRule := *fromRule
+	duplicatedFromRule.Priority = 2
+
+	// rule of other policy routing daemons has no mask
+	foreignRule := netlink.NewRule()
+	foreignRule.Src = cidr
+	foreignRule.Table = 10002
+
+	// rule pointing to table out of range
+	outOfRangeRule := *fromRule
+	outOfRangeRule.Table = 100
+
+	// 10003 is left by a deleted rule, 10004 is empty, 39999 is reserved and 100 is out of range
+	tableRouteCount := map[int]int{10001: 2, 10002: 2, 10003: 1, 10004: 0, 39999: 3, 100: 1}
+
+	ownedTables := findOwnedRouteTables([]netlink.Rule{*fromRule, duplicatedFromRule, *foreignRule, outOfRangeRule},
+		tableRouteCount, DefaultTableRange, 39999)
+	if len(ownedTables) != 2 || ownedTables[0] != 10001 || ownedTables[1] != 10003 {
+		t.Errorf("expect owned tables [10001 10003], but got %v", ownedTables)
+	}
+}
+
+func TestCountRoutesByTable(t *testing.T) {
+	routeList := []netlink.Route{{Table: 254}, {Table: 10000}, {Table: 10000}, {Table: 39998}, {Table: 39999},
+		{Table: 40000}}
+
+	// max of range is exclusive
+	tableRouteCount := countRoutesByTable(routeList, DefaultTableRange)
+	if len(tableRouteCount) != 3 || tableRouteCount[10000] != 2 || tableRouteCount[39998] != 1 ||
+		tableRouteCount[39999] != 1 {
+		t.Errorf("unexpected route count by table %v", tableRouteCount)
+	}
+}
+
+func TestWarmUpPendingWhilePaused(t *testing.T) {
+	m := newTestManager(netlink.FAMILY_V4)
+	m.EnableWarmUp()
+	m.Pause()
+
+	if err := m.SyncRoutes(); err != nil {
+		t.Fatalf("expect sync to be skipped while paused, but got %v", err)
+	}
+
+	if !m.warmUpPending {
+		t.Errorf("expect warm-up to be done by the first sync after resumed")
+	}
+}
@@ -76,7 +76,7 @@ func (cdh *cniDaemonHandler) configureNic(podName, podNamespace, netns, mac stri
 
 	if err = containernetwork.ConfigureContainerNic(containerNicName, hostNicName, nodeIfName,
 		allocatedIPs, macAddr, podNS, mtu, cdh.config.VlanCheckTimeout, networkMode,
-		cdh.config.NeighGCThresh1, cdh.config.NeighGCThresh2, cdh.config.NeighGCThresh3, cdh.config.IPv6RouteCacheMaxSize,
+		cdh.getNeighGCThresh(netlink.FAMILY_V4), cdh.getNeighGCThresh(netlink.FAMILY_V6), cdh.config.IPv6RouteCacheMaxSize,
 		cdh.config.IPv6RouteCacheGCThresh, cdh.bgpManager); err != nil {
 		return "", fmt.Errorf("failed to configure container nic for %v.%v: %v", podName, podNamespace, err)
 	}
@@ -38,6 +38,7 @@ import (
 	"github.com/alibaba/hybridnet/pkg/daemon/bgp"
 	daemonconfig "github.com/alibaba/hybridnet/pkg/daemon/config"
 	"github.com/alibaba/hybridnet/pkg/daemon/controller"
+	"github.com/alibaba/hybridnet/pkg/daemon/route"
 	"github.com/alibaba/hybridnet/pkg/daemon/utils"
 	ipamtypes "github.com/alibaba/hybridnet/pkg/ipam/types"
 	"github.com/alibaba/hybridnet/pkg/request"
@@ -51,6 +52,11 @@ type cniDaemonHandler struct {
 	mgrAPIReader client.Reader
 	bgpManager   *bgp.Manager
 
+	getLocalSubnetSummaries func() []route.LocalSubnetSummary
+	getNeighGCThresh        func(family int) utils.NeighGCThresh
+	getRouteStates          func() []*route.ExportedState
+	requestRouteFlush       func()
+
 	logger logr.Logger
 }
 
@@ -62,6 +68,11 @@ func createCniDaemonHandler(ctx context.Context, config *daemonconfig.Configurat
 		mgrAPIReader: ctrlRef.GetMgrAPIReader(),
 		bgpManager:   ctrlRef.GetBGPManager(),
 		logger:       logger,
+
+		getLocalSubnetSummaries: ctrlRef.GetLocalSubnetSummaries,
+		getNeighGCThresh:        ctrlRef.GetNeighGCThresh,
+		getRouteStates:          ctrlRef.GetRouteStates,
+		requestRouteFlush:       ctrlRef.RequestRouteFlush,
 	}
 
 	if ok := ctrlRef.CacheSynced(ctx); !ok {
@@ -340,6 +351,49 @@ func (cdh *cniDaemonHandler) handleDel(req *restful.Request, resp *restful.Respo
 	resp.WriteHeader(http.StatusNoContent)
 }
 
+func (cdh *cniDaemonHandler) handleListSubnets(req *restful.Request, resp *restful.Response) {
+	_ = resp.WriteHeaderAndEntity(http.StatusOK, cdh.getLocalSubnetSummaries())
+}
+
+// handleListRoutes returns the desired routing states of all ip families, which are rendered in the text of
+// "ip rule show" and "ip route show table N" if "format=iproute" is specified.
+func (cdh *cniDaemonHandler) handleListRoutes(req *restful.Request, resp *restful.Response) {
+	var states []*route.ExportedState
+	for _, state := range cdh.getRouteStates() {
+		resolved, err := state.ResolveKernelState()
+		if err != nil {
+			// subnets are still worth showing without rules and tables
+			cdh.logger.Error(err, "failed to resolve kernel state of routes", "family", state.Family)
+			resolved = state
+		}
+		states = append(states, resolved)
+	}
+
+	switch format := req.QueryParameter("format"); format {
+	case "", "json":
+		_ = resp.WriteHeaderAndEntity(http.StatusOK, states)
+	case "iproute":
+		var texts []string
+		for _, state := range states {
+			texts = append(texts, route.FormatIPRoute(state))
+		}
+
+		resp.AddHeader(restful.HEADER_ContentType, "text/plain")
+		resp.WriteHeader(http.StatusOK)
+		_, _ = resp.Write([]byte(strings.Join(texts, "\n")))
+	default:
+		_ = resp.WriteErrorString(http.StatusBadRequest, fmt.Sprintf("unsupported format %v", format))
+	}
+}
+
+// handleFlushRoutes requests all the managed rules and routes to be flushed and rebuilt by the next subnet
+// reconcile, the result can be observed through the readiness and logs of daemon.
+func (cdh *cniDaemonHandler) handleFlushRoutes(req *restful.Request, resp *restful.Response) {
+	cdh.logger.Info("flushing all managed rules and routes is requested")
+	cdh.requestRouteFlush()
+	resp.WriteHeader(http.StatusAccepted)
+}
+
 func (cdh *cniDaemonHandler) errorWrapper(err error, status int, resp *restful.Response) {
 	cdh.logger.Error(err, "handler error")
 	_ = resp.WriteHeaderAndEntity(status, request.PodResponse{
@@ -26,6 +26,7 @@ import (
 
 	"github.com/alibaba/hybridnet/pkg/daemon/config"
 	"github.com/alibaba/hybridnet/pkg/daemon/controller"
+	"github.com/alibaba/hybridnet/pkg/daemon/route"
 	"github.com/alibaba/hybridnet/pkg/request"
 
 	"github.com/emicklei/go-restful"
@@ -71,6 +72,19 @@ func createHandler(cdh *cniDaemonHandler) http.Handler {
 		ws.POST("/del").
 			To(cdh.handleDel).
 			Reads(request.PodRequest{}))
+	ws.Route(
+		ws.GET("/subnets").
+			To(cdh.handleListSubnets).
+			Writes([]route.LocalSubnetSummary{}))
+	ws.Route(
+		ws.GET("/routes").
+			To(cdh.handleListRoutes).
+			Param(ws.QueryParameter("format", "output format, \"json\" (default) or \"iproute\"")).
+			Produces(restful.MIME_JSON, "text/plain").
+			Writes([]route.ExportedState{}))
+	ws.Route(
+		ws.POST("/routes/flush").
+			To(cdh.handleFlushRoutes))
 
 	return wsContainer
 }
@@ -0,0 +1,124 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"sync"
+)
+
+// neighGCThreshHeadroom is the multiple of known neighbors that gc_thresh3 is scaled to, so that
+// transient entries (e.g., incomplete or stale ones) will not overflow the neighbor table.
+const neighGCThreshHeadroom = 2
+
+// NeighGCThresh is the set of gc thresholds of neighbor table for one ip family.
+type NeighGCThresh struct {
+	Thresh1 int
+	Thresh2 int
+	Thresh3 int
+}
+
+// ComputeNeighGCThresh scales the base thresholds by the band which the known neighbor count falls in,
+// and returns the computed thresholds and the band. A band size not larger than zero disables the scaling.
+func ComputeNeighGCThresh(base NeighGCThresh, neighCount, bandSize int) (NeighGCThresh, int) {
+	if bandSize <= 0 || neighCount <= 0 {
+		return base, 0
+	}
+
+	band := (neighCount + bandSize - 1) / bandSize
+
+	thresh := NeighGCThresh{
+		Thresh3: maxInt(base.Thresh3, band*bandSize*neighGCThreshHeadroom),
+	}
+	thresh.Thresh2 = maxInt(base.Thresh2, thresh.Thresh3/2)
+	thresh.Thresh1 = maxInt(base.Thresh1, thresh.Thresh3/4)
+
+	return thresh, band
+}
+
+// NeighGCThreshTuner keeps the neighbor gc thresholds of one ip family in line with the known neighbor count,
+// thresholds will only be rewritten when the count crosses a band.
+type NeighGCThreshTuner struct {
+	family   int
+	base     NeighGCThresh
+	bandSize int
+
+	mu      sync.RWMutex
+	applied bool
+	band    int
+	current NeighGCThresh
+
+	apply func(family int, thresh NeighGCThresh) error
+}
+
+func NewNeighGCThreshTuner(family int, base NeighGCThresh, bandSize int) *NeighGCThreshTuner {
+	return &NeighGCThreshTuner{
+		family:   family,
+		base:     base,
+		bandSize: bandSize,
+		current:  base,
+		apply: func(family int, thresh NeighGCThresh) error {
+			return EnsureNeighGCThresh(family, thresh.Thresh1, thresh.Thresh2, thresh.Thresh3)
+		},
+	}
+}
+
+// Enabled returns whether thresholds are derived from the known neighbor count.
+func (t *NeighGCThreshTuner) Enabled() bool {
+	return t.bandSize > 0
+}
+
+// Update computes thresholds for the known neighbor count and applies them if the band changes,
+// returns whether thresholds are rewritten.
+func (t *NeighGCThreshTuner) Update(neighCount int) (bool, error) {
+	if !t.Enabled() {
+		return false, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	thresh, band := ComputeNeighGCThresh(t.base, neighCount, t.bandSize)
+	if t.applied && band == t.band {
+		return false, nil
+	}
+
+	if err := t.apply(t.family, thresh); err != nil {
+		return false, fmt.Errorf("failed to apply neigh gc thresholds %+v: %v", thresh, err)
+	}
+
+	t.applied = true
+	t.band = band
+	t.current = thresh
+
+	return true, nil
+}
+
+// Current returns the thresholds which should be kept on the node.
+func (t *NeighGCThreshTuner) Current() NeighGCThresh {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.current
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
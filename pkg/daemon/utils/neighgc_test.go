@@ -0,0 +1,147 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestComputeNeighGCThresh(t *testing.T) {
+	base := NeighGCThresh{Thresh1: 1024, Thresh2: 2048, Thresh3: 4096}
+
+	tests := []struct {
+		name       string
+		neighCount int
+		bandSize   int
+		expected   NeighGCThresh
+		band       int
+	}{
+		{
+			name:       "scaling disabled",
+			neighCount: 100000,
+			bandSize:   0,
+			expected:   base,
+			band:       0,
+		},
+		{
+			name:       "no known neighbors",
+			neighCount: 0,
+			bandSize:   1000,
+			expected:   base,
+			band:       0,
+		},
+		{
+			name:       "small cluster keeps base thresholds",
+			neighCount: 800,
+			bandSize:   1000,
+			expected:   base,
+			band:       1,
+		},
+		{
+			name:       "large cluster scales thresholds",
+			neighCount: 4500,
+			bandSize:   1000,
+			expected:   NeighGCThresh{Thresh1: 2500, Thresh2: 5000, Thresh3: 10000},
+			band:       5,
+		},
+		{
+			name:       "larger cluster scales thresholds further",
+			neighCount: 20000,
+			bandSize:   1000,
+			expected:   NeighGCThresh{Thresh1: 10000, Thresh2: 20000, Thresh3: 40000},
+			band:       20,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			thresh, band := ComputeNeighGCThresh(base, test.neighCount, test.bandSize)
+			if thresh != test.expected {
+				t.Errorf("expected thresholds %+v, got %+v", test.expected, thresh)
+			}
+			if band != test.band {
+				t.Errorf("expected band %v, got %v", test.band, band)
+			}
+		})
+	}
+}
+
+func TestNeighGCThreshTunerRewritesOnBandChange(t *testing.T) {
+	base := NeighGCThresh{Thresh1: 1024, Thresh2: 2048, Thresh3: 4096}
+
+	var applied []NeighGCThresh
+	tuner := NewNeighGCThreshTuner(netlink.FAMILY_V6, base, 1000)
+	tuner.apply = func(family int, thresh NeighGCThresh) error {
+		if family != netlink.FAMILY_V6 {
+			t.Errorf("unexpected family %v", family)
+		}
+		applied = append(applied, thresh)
+		return nil
+	}
+
+	steps := []struct {
+		neighCount int
+		rewritten  bool
+	}{
+		{neighCount: 10, rewritten: true},
+		{neighCount: 999, rewritten: false},
+		{neighCount: 1000, rewritten: false},
+		{neighCount: 1001, rewritten: true},
+		{neighCount: 1500, rewritten: false},
+		{neighCount: 5000, rewritten: true},
+		{neighCount: 4001, rewritten: false},
+		{neighCount: 4000, rewritten: true},
+	}
+
+	for _, step := range steps {
+		rewritten, err := tuner.Update(step.neighCount)
+		if err != nil {
+			t.Fatalf("unexpected error for count %v: %v", step.neighCount, err)
+		}
+		if rewritten != step.rewritten {
+			t.Errorf("expected rewritten %v for count %v, got %v", step.rewritten, step.neighCount, rewritten)
+		}
+	}
+
+	if len(applied) != 4 {
+		t.Fatalf("expected 4 rewrites, got %v", len(applied))
+	}
+
+	expected := NeighGCThresh{Thresh1: 2000, Thresh2: 4000, Thresh3: 8000}
+	if current := tuner.Current(); current != expected {
+		t.Errorf("expected current thresholds %+v, got %+v", expected, current)
+	}
+}
+
+func TestNeighGCThreshTunerDisabled(t *testing.T) {
+	base := NeighGCThresh{Thresh1: 1024, Thresh2: 2048, Thresh3: 4096}
+
+	tuner := NewNeighGCThreshTuner(netlink.FAMILY_V4, base, 0)
+	tuner.apply = func(family int, thresh NeighGCThresh) error {
+		t.Errorf("thresholds should not be applied while scaling is disabled")
+		return nil
+	}
+
+	if rewritten, err := tuner.Update(100000); err != nil || rewritten {
+		t.Errorf("expected no rewrite, got %v, %v", rewritten, err)
+	}
+	if current := tuner.Current(); current != base {
+		t.Errorf("expected base thresholds %+v, got %+v", base, current)
+	}
+}
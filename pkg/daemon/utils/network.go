@@ -17,11 +17,14 @@
 package utils
 
 import (
-	"errors"
+	"bytes"
 	"fmt"
 	"net"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alibaba/hybridnet/pkg/constants"
 
@@ -33,6 +36,8 @@ import (
 	"github.com/vishvananda/netlink"
 )
 
+const LinkWaitPollInterval = 100 * time.Millisecond
+
 type IPInfo struct {
 	Addr  net.IP
 	Gw    net.IP
@@ -40,6 +45,90 @@ type IPInfo struct {
 	NetID *int32
 }
 
+// repairVlanIf makes sure the vlan interface of parent is named as expected. If the parent interface is renamed,
+// the vlan interface left by hybridnet will be renamed to the new scheme, and another vlan interface which takes
+// the expected name but doesn't belong to parent will be removed. The renamed interface is set down, so routes
+// through it are removed by kernel and rebuilt by the next route sync.
+func repairVlanIf(parentIndex, vlanID int, expectedName string) error {
+	linkList, err := netlink.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list links: %v", err)
+	}
+
+	addrList, err := netlink.AddrList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		return fmt.Errorf("failed to list addresses: %v", err)
+	}
+
+	toRename, toRemove := planVlanIfRepair(linkList, linkIndexesWithNodeAddrs(addrList), parentIndex, vlanID, expectedName)
+
+	if toRemove != nil {
+		if err := netlink.LinkDel(toRemove); err != nil {
+			return fmt.Errorf("failed to remove orphan vlan interface %v: %v", toRemove.Attrs().Name, err)
+		}
+	}
+
+	if toRename != nil {
+		// interface must be down before renamed, it will be set up again after repaired
+		if err := netlink.LinkSetDown(toRename); err != nil {
+			return fmt.Errorf("failed to set down vlan interface %v: %v", toRename.Attrs().Name, err)
+		}
+
+		if err := netlink.LinkSetName(toRename, expectedName); err != nil {
+			return fmt.Errorf("failed to rename vlan interface %v to %v: %v", toRename.Attrs().Name, expectedName, err)
+		}
+	}
+
+	return nil
+}
+
+// planVlanIfRepair returns the vlan interface of parent which needs to be renamed to the expected name, and
+// the vlan interface with the expected name which doesn't belong to parent and needs to be removed. Only the
+// vlan interface named as "<old parent name>.<vlan id>" without node addresses is taken as left by hybridnet,
+// others of the same vlan id, e.g., node uplinks, are never touched.
+func planVlanIfRepair(linkList []netlink.Link, nodeAddrLinkIndexes map[int]bool, parentIndex, vlanID int,
+	expectedName string) (toRename, toRemove netlink.Link) {
+	linkNames := map[string]bool{}
+	for _, link := range linkList {
+		linkNames[link.Attrs().Name] = true
+	}
+
+	vlanSuffix := fmt.Sprintf(".%d", vlanID)
+	for _, link := range linkList {
+		vlan, ok := link.(*netlink.Vlan)
+		if !ok {
+			continue
+		}
+
+		belongsToParent := vlan.ParentIndex == parentIndex && vlan.VlanId == vlanID
+
+		switch {
+		case vlan.Name == expectedName && !belongsToParent:
+			toRemove = vlan
+		case vlan.Name != expectedName && belongsToParent:
+			// the old parent name should not be taken by any interface since parent is renamed
+			oldParentName := strings.TrimSuffix(vlan.Name, vlanSuffix)
+			if oldParentName != vlan.Name && !linkNames[oldParentName] && !nodeAddrLinkIndexes[vlan.Index] {
+				toRename = vlan
+			}
+		}
+	}
+
+	return toRename, toRemove
+}
+
+// linkIndexesWithNodeAddrs returns the indexes of links with addresses not in link scope, enhanced addresses
+// of hybridnet are always in link scope.
+func linkIndexesWithNodeAddrs(addrList []netlink.Addr) map[int]bool {
+	linkIndexes := map[int]bool{}
+	for _, addr := range addrList {
+		if addr.Scope != int(netlink.SCOPE_LINK) {
+			linkIndexes[addr.LinkIndex] = true
+		}
+	}
+	return linkIndexes
+}
+
 func GenerateVlanNetIfName(parentName string, vlanID *int32) (string, error) {
 	if vlanID == nil {
 		return "", fmt.Errorf("vlan id should not be nil")
@@ -69,7 +158,51 @@ func GenerateVxlanNetIfName(parentName string, vlanID *int32) (string, error) {
 	return fmt.Sprintf("%s%s%v", parentName, constants.VxlanLinkInfix, *vlanID), nil
 }
 
-func EnsureVlanIf(nodeIfName string, vlanID *int32) (string, error) {
+// RemoveStaleVxlanIfs removes the vxlan interfaces of parent which are not named as expected, e.g., the ones
+// left behind after NetID of the overlay network changes, and returns the names of removed interfaces.
+func RemoveStaleVxlanIfs(parentName, expectedName string) ([]string, error) {
+	linkList, err := netlink.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %v", err)
+	}
+
+	var removed []string
+	for _, link := range planStaleVxlanIfs(linkList, parentName, expectedName) {
+		if err := netlink.LinkDel(link); err != nil {
+			return removed, fmt.Errorf("failed to remove stale vxlan interface %v: %v", link.Attrs().Name, err)
+		}
+		removed = append(removed, link.Attrs().Name)
+	}
+
+	return removed, nil
+}
+
+// planStaleVxlanIfs returns the vxlan interfaces named by GenerateVxlanNetIfName for parent except the expected one.
+func planStaleVxlanIfs(linkList []netlink.Link, parentName, expectedName string) []netlink.Link {
+	prefix := parentName + constants.VxlanLinkInfix
+
+	var stale []netlink.Link
+	for _, link := range linkList {
+		if _, ok := link.(*netlink.Vxlan); !ok {
+			continue
+		}
+
+		name := link.Attrs().Name
+		if name == expectedName || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		if _, err := strconv.ParseUint(strings.TrimPrefix(name, prefix), 10, 32); err != nil {
+			continue
+		}
+
+		stale = append(stale, link)
+	}
+
+	return stale
+}
+
+func EnsureVlanIf(nodeIfName string, vlanID *int32, linkWaitTimeout time.Duration) (string, error) {
 	nodeIf, err := netlink.LinkByName(nodeIfName)
 	if err != nil {
 		return "", err
@@ -80,6 +213,12 @@ func EnsureVlanIf(nodeIfName string, vlanID *int32) (string, error) {
 		return "", fmt.Errorf("failed to ensure bridge: %v", err)
 	}
 
+	if vlanIfName != nodeIfName {
+		if err := repairVlanIf(nodeIf.Attrs().Index, int(*vlanID), vlanIfName); err != nil {
+			return vlanIfName, fmt.Errorf("failed to repair vlan interface %v: %v", vlanIfName, err)
+		}
+	}
+
 	// create the vlan interface if not exist
 	var vlanIf netlink.Link
 	if vlanIf, err = netlink.LinkByName(vlanIfName); err != nil {
@@ -100,7 +239,7 @@ func EnsureVlanIf(nodeIfName string, vlanID *int32) (string, error) {
 			return vlanIfName, err
 		}
 
-		vlanIf, err = netlink.LinkByName(vlanIfName)
+		vlanIf, err = WaitForLink(vlanIfName, linkWaitTimeout)
 		if err != nil {
 			return vlanIfName, err
 		}
@@ -114,22 +253,214 @@ func EnsureVlanIf(nodeIfName string, vlanID *int32) (string, error) {
 	return vlanIfName, nil
 }
 
-func GetDefaultInterface(family int) (*net.Interface, error) {
-	defaultRoute, err := GetDefaultRoute(family)
+// GenerateQinQNetIfName returns the name of double-tagged vlan interface like "eth0.100.200", the outer
+// (S-VLAN) interface is named as GenerateVlanNetIfName does.
+func GenerateQinQNetIfName(parentName string, outerVlanID, innerVlanID *int32) (string, error) {
+	if outerVlanID == nil || innerVlanID == nil {
+		return "", fmt.Errorf("outer and inner vlan id should not be nil")
+	}
+
+	if *outerVlanID < 1 || *outerVlanID > 4094 {
+		return "", fmt.Errorf("outer vlan id %v is out of range 1~4094", *outerVlanID)
+	}
+
+	if *innerVlanID < 1 || *innerVlanID > 4094 {
+		return "", fmt.Errorf("inner vlan id %v is out of range 1~4094", *innerVlanID)
+	}
+
+	name := fmt.Sprintf("%s.%v.%v", parentName, *outerVlanID, *innerVlanID)
+	if len(name) >= unix.IFNAMSIZ {
+		return "", fmt.Errorf("interface name %v is longer than %v characters", name, unix.IFNAMSIZ-1)
+	}
+
+	return name, nil
+}
+
+// EnsureQinQIf creates the double-tagged vlan interface of node interface if not exist, the outer interface is
+// tagged with 802.1ad protocol (S-VLAN) and the inner one is tagged with 802.1q protocol (C-VLAN) on it.
+func EnsureQinQIf(nodeIfName string, outerVlanID, innerVlanID *int32, linkWaitTimeout time.Duration) (string, error) {
+	qinqIfName, err := GenerateQinQNetIfName(nodeIfName, outerVlanID, innerVlanID)
+	if err != nil {
+		return "", fmt.Errorf("failed to ensure qinq interface: %v", err)
+	}
+
+	nodeIf, err := netlink.LinkByName(nodeIfName)
 	if err != nil {
+		return qinqIfName, err
+	}
+
+	outerIfName := fmt.Sprintf("%s.%v", nodeIfName, *outerVlanID)
+
+	linkList, err := netlink.LinkList()
+	if err != nil {
+		return qinqIfName, fmt.Errorf("failed to list links: %v", err)
+	}
+
+	if err := checkQinQOuterIfConflicts(nodeIf, linkList, int(*outerVlanID), outerIfName); err != nil {
+		return qinqIfName, err
+	}
+
+	outerIf, err := ensureTaggedIf(nodeIf, int(*outerVlanID), netlink.VLAN_PROTOCOL_8021AD, outerIfName, linkWaitTimeout)
+	if err != nil {
+		return qinqIfName, fmt.Errorf("failed to ensure outer vlan interface %v: %v", outerIfName, err)
+	}
+
+	if _, err := ensureTaggedIf(outerIf, int(*innerVlanID), netlink.VLAN_PROTOCOL_8021Q, qinqIfName,
+		linkWaitTimeout); err != nil {
+		return qinqIfName, fmt.Errorf("failed to ensure inner vlan interface %v: %v", qinqIfName, err)
+	}
+
+	return qinqIfName, nil
+}
+
+// checkQinQOuterIfConflicts makes sure the outer vlan interface of a qinq interface can be created on parent,
+// the parent should not be tagged already, and the outer vlan id should not be taken by an 802.1q interface.
+func checkQinQOuterIfConflicts(parent netlink.Link, linkList []netlink.Link, outerVlanID int, outerIfName string) error {
+	if vlan, ok := parent.(*netlink.Vlan); ok {
+		return fmt.Errorf("parent interface %v is already tagged with vlan %v", vlan.Name, vlan.VlanId)
+	}
+
+	for _, link := range linkList {
+		vlan, ok := link.(*netlink.Vlan)
+		if !ok {
+			if link.Attrs().Name == outerIfName {
+				return fmt.Errorf("outer vlan interface name %v is taken by a %v interface",
+					outerIfName, link.Type())
+			}
+			continue
+		}
+
+		if vlan.ParentIndex != parent.Attrs().Index || vlan.VlanId != outerVlanID {
+			if vlan.Name == outerIfName {
+				return fmt.Errorf("outer vlan interface name %v is taken by vlan %v of another parent",
+					outerIfName, vlan.VlanId)
+			}
+			continue
+		}
+
+		if vlan.VlanProtocol != netlink.VLAN_PROTOCOL_8021AD {
+			return fmt.Errorf("parent interface %v already has an 802.1q interface %v tagged with vlan %v",
+				parent.Attrs().Name, vlan.Name, outerVlanID)
+		}
+	}
+
+	return nil
+}
+
+// ensureTaggedIf creates the vlan interface of parent with specific protocol if not exist and sets it up.
+func ensureTaggedIf(parent netlink.Link, vlanID int, protocol netlink.VlanProtocol, name string,
+	linkWaitTimeout time.Duration) (netlink.Link, error) {
+	link, err := netlink.LinkByName(name)
+	if err == nil {
+		if !isExpectedTaggedIf(link, parent.Attrs().Index, vlanID, protocol) {
+			return nil, fmt.Errorf("interface %v exists but is not a %v vlan %v interface of %v",
+				name, protocol, vlanID, parent.Attrs().Name)
+		}
+	} else {
+		vif := &netlink.Vlan{
+			VlanId:       vlanID,
+			VlanProtocol: protocol,
+			LinkAttrs:    netlink.NewLinkAttrs(),
+		}
+		vif.ParentIndex = parent.Attrs().Index
+		vif.Name = name
+
+		if err := netlink.LinkAdd(vif); err != nil {
+			return nil, err
+		}
+
+		if link, err = WaitForLink(name, linkWaitTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := netlink.LinkSetUp(link); err != nil {
 		return nil, err
 	}
 
-	if defaultRoute.LinkIndex <= 0 {
-		return nil, errors.New("found ipv4 default route but could not determine interface")
+	return link, nil
+}
+
+// isExpectedTaggedIf returns true if link is the vlan interface of parent with specific vlan id and protocol,
+// an unknown protocol is taken as 802.1q.
+func isExpectedTaggedIf(link netlink.Link, parentIndex, vlanID int, protocol netlink.VlanProtocol) bool {
+	vlan, ok := link.(*netlink.Vlan)
+	if !ok || vlan.ParentIndex != parentIndex || vlan.VlanId != vlanID {
+		return false
+	}
+
+	linkProtocol := vlan.VlanProtocol
+	if linkProtocol == netlink.VLAN_PROTOCOL_UNKNOWN {
+		linkProtocol = netlink.VLAN_PROTOCOL_8021Q
 	}
+	return linkProtocol == protocol
+}
+
+// WaitForLink polls the link by name until it appears or timeout, because a link might not be
+// queryable immediately after it is created on slow systems.
+func WaitForLink(name string, timeout time.Duration) (netlink.Link, error) {
+	return waitForLink(name, timeout, LinkWaitPollInterval, netlink.LinkByName)
+}
+
+func waitForLink(name string, timeout, interval time.Duration,
+	linkByName func(name string) (netlink.Link, error)) (netlink.Link, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		link, err := linkByName(name)
+		if err == nil {
+			return link, nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return nil, fmt.Errorf("failed to wait for link %v in %v: %v", name, timeout, err)
+		}
+		time.Sleep(interval)
+	}
+}
 
-	iface, err := net.InterfaceByIndex(defaultRoute.LinkIndex)
+// GetDefaultInterface returns the interface of the lowest-metric default route, which is up and not loopback.
+func GetDefaultInterface(family int) (*net.Interface, error) {
+	defaultRoutes, err := GetDefaultRoutes(family)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get interface %v", err)
+		return nil, err
+	}
+
+	return pickUsableDefaultInterface(defaultRoutes, net.InterfaceByIndex)
+}
+
+func pickUsableDefaultInterface(defaultRoutes []netlink.Route,
+	interfaceByIndex func(index int) (*net.Interface, error)) (*net.Interface, error) {
+	var unusableReasons []string
+	for _, route := range defaultRoutes {
+		if route.LinkIndex <= 0 {
+			unusableReasons = append(unusableReasons,
+				fmt.Sprintf("default route %v has no interface", route.String()))
+			continue
+		}
+
+		iface, err := interfaceByIndex(route.LinkIndex)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get interface %v", err)
+		}
+
+		if iface.Flags&net.FlagLoopback != 0 {
+			unusableReasons = append(unusableReasons, fmt.Sprintf("interface %v is loopback", iface.Name))
+			continue
+		}
+
+		if iface.Flags&net.FlagUp == 0 {
+			unusableReasons = append(unusableReasons, fmt.Sprintf("interface %v is down", iface.Name))
+			continue
+		}
+
+		return iface, nil
 	}
 
-	return iface, nil
+	if len(unusableReasons) == 0 {
+		return nil, NotExist
+	}
+
+	return nil, fmt.Errorf("no usable default route interface found: %v", strings.Join(unusableReasons, ", "))
 }
 
 func GetDefaultRoute(family int) (*netlink.Route, error) {
@@ -147,6 +478,113 @@ func GetDefaultRoute(family int) (*netlink.Route, error) {
 	return nil, NotExist
 }
 
+// GetDefaultRoutes returns all the default routes of main table, sorted by metric from low to high.
+func GetDefaultRoutes(family int) ([]netlink.Route, error) {
+	routes, err := netlink.RouteList(nil, family)
+	if err != nil {
+		return nil, err
+	}
+
+	var defaultRoutes []netlink.Route
+	for _, route := range routes {
+		if IsDefaultRoute(&route, family) {
+			defaultRoutes = append(defaultRoutes, route)
+		}
+	}
+
+	if len(defaultRoutes) == 0 {
+		return nil, NotExist
+	}
+
+	sort.SliceStable(defaultRoutes, func(i, j int) bool {
+		return defaultRoutes[i].Priority < defaultRoutes[j].Priority
+	})
+
+	return defaultRoutes, nil
+}
+
+// SelectSourceAddress selects the best local address of link in subnet to be used as route source,
+// NotExist is returned if there is no candidate.
+func SelectSourceAddress(link netlink.Link, subnet *net.IPNet, family int) (net.IP, error) {
+	addrList, err := netlink.AddrList(link, family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses of link %v: %v", link.Attrs().Name, err)
+	}
+
+	src := pickSourceAddress(addrList, subnet)
+	if src == nil {
+		return nil, NotExist
+	}
+	return src, nil
+}
+
+// pickSourceAddress picks the address in subnet with universe or link scope deterministically,
+// which prefers universe scope and then the lowest ip. Tentative or dad-failed addresses are ignored.
+func pickSourceAddress(addrList []netlink.Addr, subnet *net.IPNet) net.IP {
+	var candidates []netlink.Addr
+	for _, addr := range addrList {
+		if addr.IPNet == nil || !subnet.Contains(addr.IP) ||
+			addr.Flags&(unix.IFA_F_TENTATIVE|unix.IFA_F_DADFAILED) != 0 {
+			continue
+		}
+
+		if addr.Scope != unix.RT_SCOPE_UNIVERSE && addr.Scope != unix.RT_SCOPE_LINK {
+			continue
+		}
+
+		candidates = append(candidates, addr)
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Scope != candidates[j].Scope {
+			return candidates[i].Scope == unix.RT_SCOPE_UNIVERSE
+		}
+		return bytes.Compare(candidates[i].IP.To16(), candidates[j].IP.To16()) < 0
+	})
+
+	return candidates[0].IP
+}
+
+// GetRAGateway returns the gateway of the ipv6 default route learned from router advertisements on the link,
+// NotExist is returned if no router advertisement has been accepted on the link yet.
+func GetRAGateway(linkIndex int) (net.IP, error) {
+	routes, err := netlink.RouteListFiltered(netlink.FAMILY_V6, &netlink.Route{
+		LinkIndex: linkIndex,
+	}, netlink.RT_FILTER_OIF)
+	if err != nil {
+		return nil, err
+	}
+
+	if gateway := pickRAGateway(routes); gateway != nil {
+		return gateway, nil
+	}
+	return nil, NotExist
+}
+
+// pickRAGateway picks the gateway of the ra-learned default route with the lowest metric.
+func pickRAGateway(routes []netlink.Route) net.IP {
+	var picked *netlink.Route
+	for i := range routes {
+		route := &routes[i]
+		if !IsDefaultRoute(route, netlink.FAMILY_V6) || route.Protocol != unix.RTPROT_RA || route.Gw == nil {
+			continue
+		}
+
+		if picked == nil || route.Priority < picked.Priority {
+			picked = route
+		}
+	}
+
+	if picked == nil {
+		return nil
+	}
+	return picked.Gw
+}
+
 func IsDefaultRoute(route *netlink.Route, family int) bool {
 	if route == nil {
 		return false
@@ -232,13 +670,20 @@ func CheckPodRuleExist(podCidr *net.IPNet, family int) (bool, int, error) {
 		return false, 0, fmt.Errorf("failed to list rule: %v", err)
 	}
 
+	exist, table := findPodRule(ruleList, podCidr)
+	return exist, table, nil
+}
+
+// findPodRule finds the from-pod-subnet rule of podCidr, dscp rules of the same source matching a
+// non-zero tos are not the from-pod-subnet rule.
+func findPodRule(ruleList []netlink.Rule, podCidr *net.IPNet) (bool, int) {
 	for _, rule := range ruleList {
-		if rule.Src != nil && podCidr.String() == rule.Src.String() {
-			return true, rule.Table, nil
+		if rule.Tos == 0 && rule.Src != nil && podCidr.String() == rule.Src.String() {
+			return true, rule.Table
 		}
 	}
 
-	return false, 0, nil
+	return false, 0
 }
 
 func CheckDefaultRouteExist(table int, family int) (bool, error) {
@@ -277,10 +722,8 @@ func CheckPodNeighExist(podIP net.IP, forwardNodeIfIndex int, family int) (bool,
 // AddRoute adds a universally-scoped route. If no direct route contains gw IP, add single route for gw.
 func AddRoute(ipn *net.IPNet, gw net.IP, dev netlink.Link) error {
 	ipFamily := netlink.FAMILY_V4
-	ipMask := net.CIDRMask(32, 32)
 	if gw.To4() == nil {
 		ipFamily = netlink.FAMILY_V6
-		ipMask = net.CIDRMask(128, 128)
 	}
 
 	routeList, err := netlink.RouteList(dev, ipFamily)
@@ -296,25 +739,44 @@ func AddRoute(ipn *net.IPNet, gw net.IP, dev netlink.Link) error {
 		}
 	}
 
-	if !containsGW {
-		if err := netlink.RouteAdd(&netlink.Route{
-			LinkIndex: dev.Attrs().Index,
+	directRoute, targetRoute := routesForGateway(ipn, gw, dev.Attrs().Index, !containsGW)
+	if directRoute != nil {
+		if err := netlink.RouteAdd(directRoute); err != nil {
+			return fmt.Errorf("failed to add direct route for gw ip %v: %v", gw.String(), err)
+		}
+	}
+
+	return netlink.RouteAdd(targetRoute)
+}
+
+// routesForGateway builds the direct route for gw (if needed) and the route to ipn via gw, both of them
+// specify the output device, which is necessary for an ipv6 link-local gw to be resolved.
+func routesForGateway(ipn *net.IPNet, gw net.IP, linkIndex int, needDirectRoute bool) (*netlink.Route, *netlink.Route) {
+	ipMask := net.CIDRMask(32, 32)
+	if gw.To4() != nil {
+		gw = gw.To4()
+	} else {
+		ipMask = net.CIDRMask(128, 128)
+	}
+
+	var directRoute *netlink.Route
+	if needDirectRoute {
+		directRoute = &netlink.Route{
+			LinkIndex: linkIndex,
 			Scope:     netlink.SCOPE_LINK,
 			Dst: &net.IPNet{
 				IP:   gw,
 				Mask: ipMask,
 			},
-		}); err != nil {
-			return fmt.Errorf("failed to add direct route for gw ip %v: %v", gw.String(), err)
 		}
 	}
 
-	return netlink.RouteAdd(&netlink.Route{
-		LinkIndex: dev.Attrs().Index,
+	return directRoute, &netlink.Route{
+		LinkIndex: linkIndex,
 		Scope:     netlink.SCOPE_UNIVERSE,
 		Dst:       ipn,
 		Gw:        gw,
-	})
+	}
 }
 
 func EnableIPForward(family int) error {
@@ -415,6 +877,41 @@ func EnsureIPv6RouteGCParameters(routeCacheMaxSize, gcThresh int) error {
 	return nil
 }
 
+// ReassertIPv6RouteGCParameters re-applies the ipv6 route cache parameters which have drifted from the
+// configured values (e.g., reset by other processes), returns the sysctl paths re-applied.
+func ReassertIPv6RouteGCParameters(routeCacheMaxSize, gcThresh int) ([]string, error) {
+	return reassertSysctls([]sysctlValue{
+		{path: constants.IPv6RouteCacheMaxSizeSysctl, value: routeCacheMaxSize},
+		{path: constants.IPv6RouteCacheGCThresh, value: gcThresh},
+	}, GetSysctl, SetSysctl)
+}
+
+type sysctlValue struct {
+	path  string
+	value int
+}
+
+func reassertSysctls(desired []sysctlValue, get func(string) (int, error),
+	set func(string, int) error) ([]string, error) {
+	var reapplied []string
+	for _, sysctl := range desired {
+		current, err := get(sysctl.path)
+		if err != nil {
+			return reapplied, fmt.Errorf("failed to get %s sysctl path: %v", sysctl.path, err)
+		}
+
+		if current == sysctl.value {
+			continue
+		}
+
+		if err := set(sysctl.path, sysctl.value); err != nil {
+			return reapplied, fmt.Errorf("failed to set %s sysctl path to %v, error: %v", sysctl.path, sysctl.value, err)
+		}
+		reapplied = append(reapplied, sysctl.path)
+	}
+	return reapplied, nil
+}
+
 func CheckIPv6GlobalDisabled() (bool, error) {
 	moduleDisableVar, err := GetSysctl(constants.IPv6DisableModuleParameter)
 	if err != nil {
@@ -586,6 +1083,34 @@ func EnsureIPReachable(ip net.IP) error {
 	return nil
 }
 
+// EnsureIPsReachable makes the ips reachable like EnsureIPReachable, the ips of ipv6 are skipped if ipv6 is
+// disabled on this node, and the skipped ips are returned.
+func EnsureIPsReachable(ips []net.IP, ipv6Disabled bool) ([]net.IP, error) {
+	reachableIPs, skippedIPs := FilterIPsByEnabledFamily(ips, ipv6Disabled)
+	for _, ip := range reachableIPs {
+		if err := EnsureIPReachable(ip); err != nil {
+			return skippedIPs, fmt.Errorf("failed to ensure ip %v reachable: %v", ip, err)
+		}
+	}
+	return skippedIPs, nil
+}
+
+// FilterIPsByEnabledFamily splits ips into the ones of enabled families and the ones of ipv6 if ipv6 is disabled,
+// invalid ips are dropped.
+func FilterIPsByEnabledFamily(ips []net.IP, ipv6Disabled bool) (enabled, disabled []net.IP) {
+	for _, ip := range ips {
+		switch {
+		case ip == nil:
+			continue
+		case ip.To4() == nil && ipv6Disabled:
+			disabled = append(disabled, ip)
+		default:
+			enabled = append(enabled, ip)
+		}
+	}
+	return enabled, disabled
+}
+
 func CheckIfContainerNetworkLink(linkName string) bool {
 	// TODO: suffix "_h" and prefix "h_" is deprecated, need to be removed further
 	return strings.HasSuffix(linkName, "_h") ||
@@ -620,6 +1145,66 @@ func ListLocalAddressExceptLink(exceptLinkName string) ([]netlink.Addr, error) {
 	return addrList, nil
 }
 
+// ListLocalAddressBySelectors lists the global unicast addresses of host links (except the specified one and
+// container network links) which are selected by link name or address label, see SelectAddressBySelectors.
+func ListLocalAddressBySelectors(exceptLinkName string, selectors []string) ([]netlink.Addr, error) {
+	var addrList []netlink.Addr
+
+	if len(selectors) == 0 {
+		return nil, nil
+	}
+
+	linkList, err := netlink.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list link: %v", err)
+	}
+
+	for _, link := range linkList {
+		linkName := link.Attrs().Name
+		if linkName == exceptLinkName || CheckIfContainerNetworkLink(linkName) {
+			continue
+		}
+
+		linkAddrList, err := ListAllGlobalUnicastAddress(link)
+		if err != nil {
+			return nil, fmt.Errorf("failed to link addr for link %v: %v", linkName, err)
+		}
+
+		addrList = append(addrList, SelectAddressBySelectors(linkName, linkAddrList, selectors)...)
+	}
+
+	return addrList, nil
+}
+
+// SelectAddressBySelectors returns the addresses of a link which match one of the selectors. A selector matches
+// an address if it equals to the link name or the address label (e.g., "lo:1"), and a selector ending with "*"
+// matches by prefix. Only global unicast addresses of universe scope are selected.
+func SelectAddressBySelectors(linkName string, addrList []netlink.Addr, selectors []string) []netlink.Addr {
+	var result []netlink.Addr
+
+	for _, addr := range addrList {
+		if addr.IPNet == nil || !CheckIPIsGlobalUnicast(addr.IP) || addr.Scope != unix.RT_SCOPE_UNIVERSE {
+			continue
+		}
+
+		for _, selector := range selectors {
+			if matchAddressSelector(selector, linkName) || (addr.Label != "" && matchAddressSelector(selector, addr.Label)) {
+				result = append(result, addr)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+func matchAddressSelector(selector, name string) bool {
+	if strings.HasSuffix(selector, "*") {
+		return strings.HasPrefix(name, strings.TrimSuffix(selector, "*"))
+	}
+	return selector == name
+}
+
 func EnsureRpFilter(containerIfs ...string) error {
 	ifArray := append([]string{"default", "all"}, containerIfs...)
 
@@ -0,0 +1,742 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestPickUsableDefaultInterface(t *testing.T) {
+	interfaces := map[int]*net.Interface{
+		1: {Index: 1, Name: "lo", Flags: net.FlagUp | net.FlagLoopback},
+		2: {Index: 2, Name: "eth0", Flags: 0},
+		3: {Index: 3, Name: "eth1", Flags: net.FlagUp},
+	}
+
+	interfaceByIndex := func(index int) (*net.Interface, error) {
+		if iface, exist := interfaces[index]; exist {
+			return iface, nil
+		}
+		return nil, fmt.Errorf("interface %v not found", index)
+	}
+
+	testCases := []struct {
+		name          string
+		defaultRoutes []netlink.Route
+		ifName        string
+		expectErr     bool
+	}{
+		{
+			"loopback interface is skipped",
+			[]netlink.Route{{LinkIndex: 1, Priority: 0}, {LinkIndex: 3, Priority: 100}},
+			"eth1",
+			false,
+		},
+		{
+			"down interface is skipped",
+			[]netlink.Route{{LinkIndex: 2, Priority: 0}, {LinkIndex: 3, Priority: 100}},
+			"eth1",
+			false,
+		},
+		{
+			"no usable interface",
+			[]netlink.Route{{LinkIndex: 1, Priority: 0}, {LinkIndex: 2, Priority: 100}},
+			"",
+			true,
+		},
+		{
+			"no default route",
+			nil,
+			"",
+			true,
+		},
+	}
+
+	for _, test := range testCases {
+		iface, err := pickUsableDefaultInterface(test.defaultRoutes, interfaceByIndex)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%s: expect error but got interface %v", test.name, iface.Name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if iface.Name != test.ifName {
+			t.Errorf("%s: expect interface %v but got %v", test.name, test.ifName, iface.Name)
+		}
+	}
+}
+
+func TestRoutesForGateway(t *testing.T) {
+	_, dst, _ := net.ParseCIDR("2021:23::/64")
+	gw := net.ParseIP("fe80::1")
+
+	directRoute, targetRoute := routesForGateway(dst, gw, 3, true)
+	if directRoute == nil {
+		t.Fatalf("expect direct route for gw %v", gw)
+	}
+
+	if directRoute.LinkIndex != 3 || directRoute.Scope != netlink.SCOPE_LINK || directRoute.Dst.String() != "fe80::1/128" {
+		t.Errorf("unexpected direct route %v", directRoute)
+	}
+
+	if targetRoute.LinkIndex != 3 || !targetRoute.Gw.Equal(gw) || targetRoute.Dst.String() != dst.String() {
+		t.Errorf("unexpected target route %v", targetRoute)
+	}
+
+	directRoute, _ = routesForGateway(dst, gw, 3, false)
+	if directRoute != nil {
+		t.Errorf("expect no direct route, but got %v", directRoute)
+	}
+
+	_, dst4, _ := net.ParseCIDR("10.0.0.0/24")
+	directRoute, _ = routesForGateway(dst4, net.ParseIP("192.168.0.1"), 3, true)
+	if directRoute.Dst.String() != "192.168.0.1/32" {
+		t.Errorf("unexpected direct route %v", directRoute)
+	}
+}
+
+func TestWaitForLink(t *testing.T) {
+	attempts := 0
+	delayedLinkByName := func(name string) (netlink.Link, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, fmt.Errorf("link %v not found", name)
+		}
+		return &netlink.Vlan{LinkAttrs: netlink.LinkAttrs{Name: name}}, nil
+	}
+
+	link, err := waitForLink("eth0.10", time.Second, time.Millisecond, delayedLinkByName)
+	if err != nil {
+		t.Fatalf("expect delayed link to be found, but got error: %v", err)
+	}
+
+	if link.Attrs().Name != "eth0.10" || attempts != 3 {
+		t.Errorf("unexpected link %v after %v attempts", link.Attrs().Name, attempts)
+	}
+
+	neverLinkByName := func(name string) (netlink.Link, error) {
+		return nil, fmt.Errorf("link %v not found", name)
+	}
+
+	if _, err := waitForLink("eth0.10", 10*time.Millisecond, time.Millisecond, neverLinkByName); err == nil {
+		t.Errorf("expect timeout error for a link never appears")
+	}
+}
+
+func TestSelectAddressBySelectors(t *testing.T) {
+	newAddr := func(cidr, label string, scope int) netlink.Addr {
+		ip, ipNet, _ := net.ParseCIDR(cidr)
+		ipNet.IP = ip
+		return netlink.Addr{IPNet: ipNet, Label: label, Scope: scope}
+	}
+
+	loAddrs := []netlink.Addr{
+		newAddr("127.0.0.1/8", "lo", int(unix.RT_SCOPE_HOST)),
+		newAddr("10.0.0.1/32", "lo:1", int(unix.RT_SCOPE_UNIVERSE)),
+		newAddr("10.0.0.2/32", "lo:2", int(unix.RT_SCOPE_UNIVERSE)),
+		newAddr("10.0.0.3/32", "lo", int(unix.RT_SCOPE_HOST)),
+		newAddr("fd00::1/128", "", int(unix.RT_SCOPE_UNIVERSE)),
+		newAddr("fe80::1/64", "", int(unix.RT_SCOPE_LINK)),
+	}
+
+	tests := []struct {
+		name      string
+		linkName  string
+		addrList  []netlink.Addr
+		selectors []string
+		expected  []string
+	}{
+		{
+			name:      "no selectors",
+			linkName:  "lo",
+			addrList:  loAddrs,
+			selectors: nil,
+			expected:  nil,
+		},
+		{
+			name:      "select by link name",
+			linkName:  "lo",
+			addrList:  loAddrs,
+			selectors: []string{"lo"},
+			expected:  []string{"10.0.0.1", "10.0.0.2", "fd00::1"},
+		},
+		{
+			name:      "select by label",
+			linkName:  "lo",
+			addrList:  loAddrs,
+			selectors: []string{"lo:2"},
+			expected:  []string{"10.0.0.2"},
+		},
+		{
+			name:      "select by label prefix",
+			linkName:  "lo",
+			addrList:  loAddrs,
+			selectors: []string{"lo:*"},
+			expected:  []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name:      "unmatched link",
+			linkName:  "eth0",
+			addrList:  []netlink.Addr{newAddr("192.168.1.2/24", "eth0", int(unix.RT_SCOPE_UNIVERSE))},
+			selectors: []string{"lo", "eth1"},
+			expected:  nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := GenerateIPStringList(SelectAddressBySelectors(test.linkName, test.addrList, test.selectors))
+			if fmt.Sprint(result) != fmt.Sprint(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestPlanVlanIfRepair(t *testing.T) {
+	newVlan := func(name string, index, parentIndex, vlanID int) *netlink.Vlan {
+		attrs := netlink.NewLinkAttrs()
+		attrs.Name = name
+		attrs.Index = index
+		attrs.ParentIndex = parentIndex
+		return &netlink.Vlan{LinkAttrs: attrs, VlanId: vlanID}
+	}
+
+	parent := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "ens1", Index: 2}}
+	bond := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "bond0", Index: 3}}
+
+	tests := []struct {
+		name                string
+		linkList            []netlink.Link
+		nodeAddrLinkIndexes map[int]bool
+		expectedRename      string
+		expectedRemove      string
+	}{
+		{
+			"vlan interface is named as expected",
+			[]netlink.Link{parent, newVlan("ens1.10", 10, 2, 10)},
+			nil,
+			"",
+			"",
+		},
+		{
+			// parent is renamed from eth0 to ens1 with the same index
+			"parent interface is renamed",
+			[]netlink.Link{parent, newVlan("eth0.10", 10, 2, 10), newVlan("eth0.20", 11, 2, 20)},
+			nil,
+			"eth0.10",
+			"",
+		},
+		{
+			"expected name is taken by vlan interface of another parent",
+			[]netlink.Link{parent, bond, newVlan("ens1.10", 10, 3, 10)},
+			nil,
+			"",
+			"ens1.10",
+		},
+		{
+			"expected name is taken and parent is renamed",
+			[]netlink.Link{parent, bond, newVlan("ens1.10", 10, 3, 10), newVlan("eth0.10", 11, 2, 10)},
+			nil,
+			"eth0.10",
+			"ens1.10",
+		},
+		{
+			"no vlan interface exists",
+			[]netlink.Link{parent},
+			nil,
+			"",
+			"",
+		},
+		{
+			"vlan interface of the same vlan id carries node addresses",
+			[]netlink.Link{parent, newVlan("eth0.10", 10, 2, 10)},
+			map[int]bool{10: true},
+			"",
+			"",
+		},
+		{
+			"vlan interface of the same vlan id is not named after parent",
+			[]netlink.Link{parent, newVlan("uplink", 10, 2, 10)},
+			nil,
+			"",
+			"",
+		},
+		{
+			"vlan interface of the same vlan id is named after another existing interface",
+			[]netlink.Link{parent, bond, newVlan("bond0.10", 10, 2, 10)},
+			nil,
+			"",
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		toRename, toRemove := planVlanIfRepair(test.linkList, test.nodeAddrLinkIndexes, 2, 10, "ens1.10")
+
+		renamed := ""
+		if toRename != nil {
+			renamed = toRename.Attrs().Name
+		}
+
+		removed := ""
+		if toRemove != nil {
+			removed = toRemove.Attrs().Name
+		}
+
+		if renamed != test.expectedRename || removed != test.expectedRemove {
+			t.Errorf("test %v failed, expect rename %q and remove %q, but got %q and %q",
+				test.name, test.expectedRename, test.expectedRemove, renamed, removed)
+		}
+	}
+}
+
+func TestGenerateQinQNetIfName(t *testing.T) {
+	id := func(i int32) *int32 { return &i }
+
+	tests := []struct {
+		name      string
+		parent    string
+		outer     *int32
+		inner     *int32
+		expected  string
+		expectErr bool
+	}{
+		{"valid qinq interface", "eth0", id(100), id(200), "eth0.100.200", false},
+		{"max vlan ids", "bond0", id(4094), id(4094), "bond0.4094.4094", false},
+		{"nil outer vlan id", "eth0", nil, id(200), "", true},
+		{"nil inner vlan id", "eth0", id(100), nil, "", true},
+		{"zero outer vlan id", "eth0", id(0), id(200), "", true},
+		{"inner vlan id out of range", "eth0", id(100), id(4095), "", true},
+		{"interface name too long", "enp3s0f1", id(100), id(200), "", true},
+	}
+
+	for _, test := range tests {
+		name, err := GenerateQinQNetIfName(test.parent, test.outer, test.inner)
+		if (err != nil) != test.expectErr || name != test.expected {
+			t.Errorf("test %v failed, expect %q and error %v, but got %q and %v",
+				test.name, test.expected, test.expectErr, name, err)
+		}
+	}
+}
+
+func TestCheckQinQOuterIfConflicts(t *testing.T) {
+	newVlan := func(name string, parentIndex, vlanID int, protocol netlink.VlanProtocol) *netlink.Vlan {
+		attrs := netlink.NewLinkAttrs()
+		attrs.Name = name
+		attrs.Index = 10
+		attrs.ParentIndex = parentIndex
+		return &netlink.Vlan{LinkAttrs: attrs, VlanId: vlanID, VlanProtocol: protocol}
+	}
+
+	parent := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0", Index: 2}}
+
+	tests := []struct {
+		name      string
+		parent    netlink.Link
+		linkList  []netlink.Link
+		expectErr bool
+	}{
+		{
+			"no outer vlan interface exists",
+			parent,
+			[]netlink.Link{parent, newVlan("eth0.20", 2, 20, netlink.VLAN_PROTOCOL_8021Q)},
+			false,
+		},
+		{
+			"outer vlan interface exists",
+			parent,
+			[]netlink.Link{parent, newVlan("eth0.100", 2, 100, netlink.VLAN_PROTOCOL_8021AD)},
+			false,
+		},
+		{
+			"outer vlan id is taken by an 802.1q interface",
+			parent,
+			[]netlink.Link{parent, newVlan("eth0.100", 2, 100, netlink.VLAN_PROTOCOL_8021Q)},
+			true,
+		},
+		{
+			"outer vlan id is taken by a renamed 802.1q interface",
+			parent,
+			[]netlink.Link{parent, newVlan("vlan100", 2, 100, netlink.VLAN_PROTOCOL_UNKNOWN)},
+			true,
+		},
+		{
+			"outer vlan interface name is taken by vlan of another parent",
+			parent,
+			[]netlink.Link{parent, newVlan("eth0.100", 3, 100, netlink.VLAN_PROTOCOL_8021AD)},
+			true,
+		},
+		{
+			"outer vlan interface name is taken by a non-vlan interface",
+			parent,
+			[]netlink.Link{parent, &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "eth0.100", Index: 4}}},
+			true,
+		},
+		{
+			"parent is already tagged",
+			newVlan("eth0", 1, 10, netlink.VLAN_PROTOCOL_8021Q),
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		err := checkQinQOuterIfConflicts(test.parent, test.linkList, 100, "eth0.100")
+		if (err != nil) != test.expectErr {
+			t.Errorf("test %v failed, expect error %v, but got %v", test.name, test.expectErr, err)
+		}
+	}
+}
+
+func TestIsExpectedTaggedIf(t *testing.T) {
+	newVlan := func(parentIndex, vlanID int, protocol netlink.VlanProtocol) *netlink.Vlan {
+		attrs := netlink.NewLinkAttrs()
+		attrs.ParentIndex = parentIndex
+		return &netlink.Vlan{LinkAttrs: attrs, VlanId: vlanID, VlanProtocol: protocol}
+	}
+
+	tests := []struct {
+		name     string
+		link     netlink.Link
+		protocol netlink.VlanProtocol
+		expected bool
+	}{
+		{"expected 802.1ad interface", newVlan(2, 100, netlink.VLAN_PROTOCOL_8021AD), netlink.VLAN_PROTOCOL_8021AD, true},
+		{"unknown protocol is taken as 802.1q", newVlan(2, 100, netlink.VLAN_PROTOCOL_UNKNOWN), netlink.VLAN_PROTOCOL_8021Q, true},
+		{"different protocol", newVlan(2, 100, netlink.VLAN_PROTOCOL_8021Q), netlink.VLAN_PROTOCOL_8021AD, false},
+		{"different parent", newVlan(3, 100, netlink.VLAN_PROTOCOL_8021AD), netlink.VLAN_PROTOCOL_8021AD, false},
+		{"different vlan id", newVlan(2, 200, netlink.VLAN_PROTOCOL_8021AD), netlink.VLAN_PROTOCOL_8021AD, false},
+		{"not a vlan interface", &netlink.Dummy{}, netlink.VLAN_PROTOCOL_8021Q, false},
+	}
+
+	for _, test := range tests {
+		if result := isExpectedTaggedIf(test.link, 2, 100, test.protocol); result != test.expected {
+			t.Errorf("test %v failed, expect %v, but got %v", test.name, test.expected, result)
+		}
+	}
+}
+
+func TestPickRAGateway(t *testing.T) {
+	_, dst, _ := net.ParseCIDR("2021:23::/64")
+	_, defaultDst, _ := net.ParseCIDR("::/0")
+
+	tests := []struct {
+		name     string
+		routes   []netlink.Route
+		expected net.IP
+	}{
+		{
+			"no ra-learned default route yet",
+			[]netlink.Route{
+				{Dst: dst, Protocol: unix.RTPROT_RA},
+				{Gw: net.ParseIP("fe80::1"), Protocol: unix.RTPROT_STATIC},
+			},
+			nil,
+		},
+		{
+			"ra-learned default route",
+			[]netlink.Route{
+				{Dst: dst, Protocol: unix.RTPROT_RA},
+				{Dst: defaultDst, Gw: net.ParseIP("fe80::1"), Protocol: unix.RTPROT_RA, Priority: 1024},
+			},
+			net.ParseIP("fe80::1"),
+		},
+		{
+			"multiple routers",
+			[]netlink.Route{
+				{Gw: net.ParseIP("fe80::1"), Protocol: unix.RTPROT_RA, Priority: 1024},
+				{Gw: net.ParseIP("fe80::2"), Protocol: unix.RTPROT_RA, Priority: 512},
+			},
+			net.ParseIP("fe80::2"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if gateway := pickRAGateway(test.routes); !gateway.Equal(test.expected) {
+				t.Errorf("expect gateway %v, but got %v", test.expected, gateway)
+			}
+		})
+	}
+}
+
+func TestReassertSysctls(t *testing.T) {
+	desired := []sysctlValue{
+		{path: "max_size", value: 524288},
+		{path: "gc_thresh", value: 65536},
+	}
+
+	tests := []struct {
+		name              string
+		current           map[string]int
+		expectedReapplied []string
+	}{
+		{
+			"no drift",
+			map[string]int{"max_size": 524288, "gc_thresh": 65536},
+			nil,
+		},
+		{
+			"max size reset",
+			map[string]int{"max_size": 4096, "gc_thresh": 65536},
+			[]string{"max_size"},
+		},
+		{
+			"both reset",
+			map[string]int{"max_size": 4096, "gc_thresh": 1024},
+			[]string{"max_size", "gc_thresh"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sysctls := map[string]int{}
+			for path, value := range test.current {
+				sysctls[path] = value
+			}
+
+			get := func(path string) (int, error) {
+				value, exist := sysctls[path]
+				if !exist {
+					return -1, fmt.Errorf("sysctl %v not exist", path)
+				}
+				return value, nil
+			}
+			set := func(path string, value int) error {
+				sysctls[path] = value
+				return nil
+			}
+
+			reapplied, err := reassertSysctls(desired, get, set)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fmt.Sprint(reapplied) != fmt.Sprint(test.expectedReapplied) {
+				t.Errorf("expect re-applied %v, but got %v", test.expectedReapplied, reapplied)
+			}
+			for _, sysctl := range desired {
+				if sysctls[sysctl.path] != sysctl.value {
+					t.Errorf("expect %v to be %v, but got %v", sysctl.path, sysctl.value, sysctls[sysctl.path])
+				}
+			}
+		})
+	}
+}
+
+func TestPickSourceAddress(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	_, v6Subnet, _ := net.ParseCIDR("fd00::/64")
+
+	newAddr := func(cidr string, scope int, flags int) netlink.Addr {
+		ip, ipNet, _ := net.ParseCIDR(cidr)
+		ipNet.IP = ip
+		return netlink.Addr{IPNet: ipNet, Scope: scope, Flags: flags}
+	}
+
+	tests := []struct {
+		name     string
+		subnet   *net.IPNet
+		addrList []netlink.Addr
+		expected net.IP
+	}{
+		{
+			"no address",
+			subnet,
+			nil,
+			nil,
+		},
+		{
+			"no address in subnet",
+			subnet,
+			[]netlink.Addr{newAddr("10.0.0.1/24", unix.RT_SCOPE_UNIVERSE, 0)},
+			nil,
+		},
+		{
+			"lowest ip of multiple candidates",
+			subnet,
+			[]netlink.Addr{
+				newAddr("192.168.1.30/24", unix.RT_SCOPE_UNIVERSE, 0),
+				newAddr("10.0.0.1/24", unix.RT_SCOPE_UNIVERSE, 0),
+				newAddr("192.168.1.4/24", unix.RT_SCOPE_UNIVERSE, 0),
+				newAddr("192.168.1.200/24", unix.RT_SCOPE_UNIVERSE, 0),
+			},
+			net.ParseIP("192.168.1.4"),
+		},
+		{
+			"universe scope preferred",
+			subnet,
+			[]netlink.Addr{
+				newAddr("192.168.1.2/24", unix.RT_SCOPE_LINK, 0),
+				newAddr("192.168.1.10/24", unix.RT_SCOPE_UNIVERSE, 0),
+			},
+			net.ParseIP("192.168.1.10"),
+		},
+		{
+			"link scope as fallback",
+			subnet,
+			[]netlink.Addr{
+				newAddr("192.168.1.2/24", unix.RT_SCOPE_HOST, 0),
+				newAddr("192.168.1.20/24", unix.RT_SCOPE_LINK, 0),
+			},
+			net.ParseIP("192.168.1.20"),
+		},
+		{
+			"tentative address ignored",
+			v6Subnet,
+			[]netlink.Addr{
+				newAddr("fd00::1/64", unix.RT_SCOPE_UNIVERSE, unix.IFA_F_TENTATIVE),
+				newAddr("fd00::a/64", unix.RT_SCOPE_UNIVERSE, 0),
+				newAddr("fd00::5/64", unix.RT_SCOPE_UNIVERSE, unix.IFA_F_DADFAILED),
+			},
+			net.ParseIP("fd00::a"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if src := pickSourceAddress(test.addrList, test.subnet); !src.Equal(test.expected) {
+				t.Errorf("expect source %v, but got %v", test.expected, src)
+			}
+		})
+	}
+}
+
+func TestPlanStaleVxlanIfs(t *testing.T) {
+	newVxlan := func(name string) *netlink.Vxlan {
+		attrs := netlink.NewLinkAttrs()
+		attrs.Name = name
+		return &netlink.Vxlan{LinkAttrs: attrs}
+	}
+	newDevice := func(name string) *netlink.Device {
+		attrs := netlink.NewLinkAttrs()
+		attrs.Name = name
+		return &netlink.Device{LinkAttrs: attrs}
+	}
+
+	tests := []struct {
+		name          string
+		linkList      []netlink.Link
+		expectedName  string
+		expectedStale []string
+	}{
+		{
+			"only expected vxlan interface exists",
+			[]netlink.Link{newDevice("eth0"), newVxlan("eth0.vxlan4")},
+			"eth0.vxlan4",
+			nil,
+		},
+		{
+			// NetID of overlay network changes from 4 to 5
+			"vxlan interface of old net id is left",
+			[]netlink.Link{newDevice("eth0"), newVxlan("eth0.vxlan4"), newVxlan("eth0.vxlan5")},
+			"eth0.vxlan5",
+			[]string{"eth0.vxlan4"},
+		},
+		{
+			"interfaces not created for parent are kept",
+			[]netlink.Link{newVxlan("eth1.vxlan4"), newVxlan("eth0.vxlan5"), newVxlan("eth0.vxlan-test"),
+				newDevice("eth0.vxlan6")},
+			"eth0.vxlan5",
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		var stale []string
+		for _, link := range planStaleVxlanIfs(test.linkList, "eth0", test.expectedName) {
+			stale = append(stale, link.Attrs().Name)
+		}
+
+		if !reflect.DeepEqual(stale, test.expectedStale) {
+			t.Errorf("test %v failed, expect stale interfaces %v, but got %v", test.name, test.expectedStale, stale)
+		}
+	}
+}
+
+func TestFilterIPsByEnabledFamily(t *testing.T) {
+	ips := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1"), nil, net.ParseIP("::ffff:10.0.0.2")}
+
+	enabled, disabled := FilterIPsByEnabledFamily(ips, true)
+	if fmt.Sprint(enabled) != "[10.0.0.1 10.0.0.2]" || fmt.Sprint(disabled) != "[fd00::1]" {
+		t.Errorf("expect ipv6 endpoints to be skipped, but got enabled %v and disabled %v", enabled, disabled)
+	}
+
+	enabled, disabled = FilterIPsByEnabledFamily(ips, false)
+	if fmt.Sprint(enabled) != "[10.0.0.1 fd00::1 10.0.0.2]" || len(disabled) != 0 {
+		t.Errorf("expect all valid endpoints to be kept, but got enabled %v and disabled %v", enabled, disabled)
+	}
+}
+
+func TestFindPodRule(t *testing.T) {
+	_, podCidr, _ := net.ParseCIDR("10.0.0.0/24")
+	_, otherCidr, _ := net.ParseCIDR("10.0.1.0/24")
+
+	testCases := []struct {
+		name          string
+		ruleList      []netlink.Rule
+		expectedExist bool
+		expectedTable int
+	}{
+		{
+			name: "dscp rule before from-pod-subnet rule",
+			ruleList: []netlink.Rule{
+				{Src: podCidr, Table: 10001, Tos: 184},
+				{Src: podCidr, Table: 10000},
+			},
+			expectedExist: true,
+			expectedTable: 10000,
+		},
+		{
+			name: "only dscp rule",
+			ruleList: []netlink.Rule{
+				{Src: podCidr, Table: 10001, Tos: 184},
+			},
+			expectedExist: false,
+		},
+		{
+			name: "rule of other subnet",
+			ruleList: []netlink.Rule{
+				{Src: otherCidr, Table: 10000},
+				{Table: 39999},
+			},
+			expectedExist: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			exist, table := findPodRule(testCase.ruleList, podCidr)
+			if exist != testCase.expectedExist || table != testCase.expectedTable {
+				t.Errorf("expect (%v, %v), got (%v, %v)", testCase.expectedExist, testCase.expectedTable, exist, table)
+			}
+		})
+	}
+}
@@ -37,6 +37,21 @@ var (
 	broadcastFdbMac, _ = net.ParseMAC("FF:FF:FF:FF:FF:F1")
 )
 
+// Flags are the vxlan specific flags of a vxlan device.
+type Flags struct {
+	// If unknown source link layer addresses and IP addresses will be learned into fdb.
+	Learning bool
+
+	// If ARP/ND proxy will be enabled.
+	Proxy bool
+
+	// If netlink notifications of link layer address misses will be generated.
+	L2miss bool
+
+	// If netlink notifications of IP address misses will be generated.
+	L3miss bool
+}
+
 type Device struct {
 	link *netlink.Vxlan
 
@@ -45,27 +60,18 @@ type Device struct {
 }
 
 func NewVxlanDevice(name string, vxlanID int, parent string, localAddr net.IP, port int, baseReachableTime time.Duration,
-	learning bool) (*Device, error) {
+	flags Flags, linkWaitTimeout time.Duration) (*Device, error) {
+	if err := ValidatePort(port); err != nil {
+		return nil, err
+	}
+
 	parentLink, err := netlink.LinkByName(parent)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get parent link %v: %v", parent, err)
 	}
 
-	link := &netlink.Vxlan{
-		LinkAttrs: netlink.LinkAttrs{
-			Name: name,
-
-			// Use parent's mac as hardware address.
-			HardwareAddr: parentLink.Attrs().HardwareAddr,
-		},
-		VxlanId:      vxlanID,
-		VtepDevIndex: parentLink.Attrs().Index,
-		SrcAddr:      localAddr,
-		Port:         port,
-		Learning:     learning,
-	}
-
-	link, err = ensureLink(link)
+	// Port is immutable, an existing device with a different port will be recreated.
+	link, err := ensureLink(newVxlanLink(name, vxlanID, parentLink, localAddr, port, flags), linkWaitTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -112,6 +118,33 @@ func NewVxlanDevice(name string, vxlanID int, parent string, localAddr net.IP, p
 	}, nil
 }
 
+// ValidatePort checks if port is a valid udp port for vxlan tunnel.
+func ValidatePort(port int) error {
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("vxlan udp port %v is out of range 1-65535", port)
+	}
+	return nil
+}
+
+func newVxlanLink(name string, vxlanID int, parentLink netlink.Link, localAddr net.IP, port int, flags Flags) *netlink.Vxlan {
+	return &netlink.Vxlan{
+		LinkAttrs: netlink.LinkAttrs{
+			Name: name,
+
+			// Use parent's mac as hardware address.
+			HardwareAddr: parentLink.Attrs().HardwareAddr,
+		},
+		VxlanId:      vxlanID,
+		VtepDevIndex: parentLink.Attrs().Index,
+		SrcAddr:      localAddr,
+		Port:         port,
+		Learning:     flags.Learning,
+		Proxy:        flags.Proxy,
+		L2miss:       flags.L2miss,
+		L3miss:       flags.L3miss,
+	}
+}
+
 func (dev *Device) MacAddr() net.HardwareAddr {
 	return dev.link.HardwareAddr
 }
@@ -180,7 +213,7 @@ func (dev *Device) SyncVtepInfo(execDel bool) error {
 	return nil
 }
 
-func ensureLink(vxlan *netlink.Vxlan) (*netlink.Vxlan, error) {
+func ensureLink(vxlan *netlink.Vxlan, linkWaitTimeout time.Duration) (*netlink.Vxlan, error) {
 	err := netlink.LinkAdd(vxlan)
 	if err == syscall.EEXIST {
 		// it's ok if the device already exists as long as config is similar
@@ -211,15 +244,14 @@ func ensureLink(vxlan *netlink.Vxlan) (*netlink.Vxlan, error) {
 		return nil, err
 	}
 
-	ifIndex := vxlan.Index
-	link, err := netlink.LinkByIndex(vxlan.Index)
+	link, err := daemonutils.WaitForLink(vxlan.Name, linkWaitTimeout)
 	if err != nil {
-		return nil, fmt.Errorf("can't locate created vxlan device with index %v", ifIndex)
+		return nil, fmt.Errorf("can't locate created vxlan device %v: %v", vxlan.Name, err)
 	}
 
 	var ok bool
 	if vxlan, ok = link.(*netlink.Vxlan); !ok {
-		return nil, fmt.Errorf("created vxlan device with index %v is not vxlan", ifIndex)
+		return nil, fmt.Errorf("created vxlan device %v is not vxlan", link.Attrs().Name)
 	}
 
 	if err = netlink.LinkSetUp(link); err != nil {
@@ -268,6 +300,18 @@ func vxlanLinksIncompat(l1, l2 netlink.Link) string {
 		return fmt.Sprintf("l2miss: %v vs %v", v1.L2miss, v2.L2miss)
 	}
 
+	if v1.L3miss != v2.L3miss {
+		return fmt.Sprintf("l3miss: %v vs %v", v1.L3miss, v2.L3miss)
+	}
+
+	if v1.Learning != v2.Learning {
+		return fmt.Sprintf("learning: %v vs %v", v1.Learning, v2.Learning)
+	}
+
+	if v1.Proxy != v2.Proxy {
+		return fmt.Sprintf("proxy: %v vs %v", v1.Proxy, v2.Proxy)
+	}
+
 	if v1.Port > 0 && v2.Port > 0 && v1.Port != v2.Port {
 		return fmt.Sprintf("port: %v vs %v", v1.Port, v2.Port)
 	}
@@ -0,0 +1,116 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vxlan
+
+import (
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestVxlanLinksIncompatFlags(t *testing.T) {
+	newVxlan := func(flags Flags) *netlink.Vxlan {
+		return &netlink.Vxlan{
+			LinkAttrs: netlink.LinkAttrs{Name: "eth0.vxlan4"},
+			VxlanId:   4,
+			Port:      8472,
+			Learning:  flags.Learning,
+			Proxy:     flags.Proxy,
+			L2miss:    flags.L2miss,
+			L3miss:    flags.L3miss,
+		}
+	}
+
+	expected := Flags{
+		Learning: false,
+		Proxy:    true,
+	}
+
+	testCases := []struct {
+		existing Flags
+		incompat bool
+	}{
+		{
+			Flags{Learning: false, Proxy: true},
+			false,
+		},
+		{
+			Flags{Learning: true, Proxy: true},
+			true,
+		},
+		{
+			Flags{Learning: false, Proxy: false},
+			true,
+		},
+		{
+			Flags{Learning: false, Proxy: true, L2miss: true},
+			true,
+		},
+		{
+			Flags{Learning: false, Proxy: true, L3miss: true},
+			true,
+		},
+	}
+
+	for _, test := range testCases {
+		incompat := vxlanLinksIncompat(newVxlan(expected), newVxlan(test.existing))
+		if (incompat != "") != test.incompat {
+			t.Errorf("expect incompat %v for flags %+v but got %q", test.incompat, test.existing, incompat)
+		}
+	}
+}
+
+func TestValidatePort(t *testing.T) {
+	testCases := []struct {
+		port  int
+		valid bool
+	}{
+		{4789, true},
+		{8472, true},
+		{1, true},
+		{65535, true},
+		{0, false},
+		{-1, false},
+		{65536, false},
+	}
+
+	for _, test := range testCases {
+		if err := ValidatePort(test.port); (err == nil) != test.valid {
+			t.Errorf("expect valid %v for port %v but got %v", test.valid, test.port, err)
+		}
+	}
+}
+
+func TestNewVxlanLinkPort(t *testing.T) {
+	parent := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth0", Index: 2}}
+
+	link := newVxlanLink("eth0.vxlan4", 4, parent, nil, 4789, Flags{})
+	if link.Port != 4789 || link.VtepDevIndex != 2 {
+		t.Fatalf("expect configured port 4789 and parent index 2 to be applied, but got %v and %v",
+			link.Port, link.VtepDevIndex)
+	}
+
+	// existing device with a different port needs to be recreated
+	existing := newVxlanLink("eth0.vxlan4", 4, parent, nil, 8472, Flags{})
+	if vxlanLinksIncompat(link, existing) == "" {
+		t.Errorf("expect vxlan links with different ports to be incompatible")
+	}
+
+	if incompat := vxlanLinksIncompat(link, newVxlanLink("eth0.vxlan4", 4, parent, nil, 4789, Flags{})); incompat != "" {
+		t.Errorf("expect vxlan links with the same port to be compatible, but got %q", incompat)
+	}
+}
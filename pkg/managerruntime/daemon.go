@@ -16,10 +16,14 @@
 
 package managerruntime
 
+import "time"
+
 type daemonStatus struct {
 	running            bool
 	restartCount       int32
 	terminationMessage string
+	failingSince       time.Time
+	lastChecked        time.Time
 }
 
 func (s *daemonStatus) Running() bool {
@@ -33,3 +37,20 @@ func (s *daemonStatus) RestartCount() int32 {
 func (s *daemonStatus) TerminationMessage() string {
 	return s.terminationMessage
 }
+
+func (s *daemonStatus) FailingSince() time.Time {
+	return s.failingSince
+}
+
+func (s *daemonStatus) LastChecked() time.Time {
+	return s.lastChecked
+}
+
+// recordFailure records a failure of daemon, it is not thread-safe.
+func (s *daemonStatus) recordFailure(err error, now time.Time) {
+	s.restartCount++
+	s.terminationMessage = err.Error()
+	if s.failingSince.IsZero() {
+		s.failingSince = now
+	}
+}
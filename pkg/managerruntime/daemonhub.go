@@ -19,6 +19,7 @@ package managerruntime
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 )
 
@@ -104,6 +105,36 @@ func (d *daemonHub) Stop(id DaemonID) error {
 	return daemon.Stop()
 }
 
+// Snapshot returns the states of all the registered daemons sorted by id.
+func (d *daemonHub) Snapshot() []DaemonSnapshot {
+	d.RLock()
+	defer d.RUnlock()
+
+	snapshots := make([]DaemonSnapshot, 0, len(d.hub))
+	for id, daemon := range d.hub {
+		// status is read with the lock of daemon itself
+		status := daemon.Status()
+		snapshot := DaemonSnapshot{
+			ID:                 id,
+			Running:            status.Running(),
+			RestartCount:       status.RestartCount(),
+			TerminationMessage: status.TerminationMessage(),
+		}
+		if lastChecked := status.LastChecked(); !lastChecked.IsZero() {
+			snapshot.LastChecked = &lastChecked
+		}
+		if named, ok := daemon.(interface{ Name() string }); ok {
+			snapshot.Name = named.Name()
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].ID < snapshots[j].ID
+	})
+	return snapshots
+}
+
 func NewDaemonHub(ctx context.Context) DaemonHub {
 	return &daemonHub{
 		ctx:     ctx,
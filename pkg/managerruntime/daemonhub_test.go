@@ -0,0 +1,136 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package managerruntime
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+type fakeDaemon struct {
+	daemonStatus
+}
+
+func (f *fakeDaemon) Run(ctx context.Context) error {
+	f.running = true
+	return nil
+}
+
+func (f *fakeDaemon) Stop() error {
+	f.running = false
+	return nil
+}
+
+func (f *fakeDaemon) Status() DaemonStatus {
+	status := f.daemonStatus
+	return &status
+}
+
+type fakeNamedDaemon struct {
+	fakeDaemon
+	name string
+}
+
+func (f *fakeNamedDaemon) Name() string {
+	return f.name
+}
+
+func TestDaemonHubSnapshot(t *testing.T) {
+	hub := NewDaemonHub(context.Background())
+	lastChecked := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if snapshots := hub.Snapshot(); len(snapshots) != 0 {
+		t.Fatalf("expect empty snapshot, but got %+v", snapshots)
+	}
+
+	if err := hub.Register("uuid-2", &fakeNamedDaemon{
+		fakeDaemon: fakeDaemon{daemonStatus{restartCount: 3, terminationMessage: "connection refused",
+			lastChecked: lastChecked}},
+		name: "cluster2",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.Register("uuid-1", &fakeDaemon{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.Run("uuid-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []DaemonSnapshot{
+		{ID: "uuid-1", Running: true},
+		{ID: "uuid-2", Name: "cluster2", RestartCount: 3, TerminationMessage: "connection refused",
+			LastChecked: &lastChecked},
+	}
+	if snapshots := hub.Snapshot(); !reflect.DeepEqual(snapshots, expected) {
+		t.Errorf("expect snapshot %+v, but got %+v", expected, snapshots)
+	}
+
+	if err := hub.Stop("uuid-1"); err != nil {
+		t.Fatal(err)
+	}
+	if snapshots := hub.Snapshot(); snapshots[0].Running {
+		t.Errorf("expect stopped daemon not to be running in snapshot")
+	}
+}
+
+func TestManagerRuntimeNeverConnecting(t *testing.T) {
+	m := &managerRuntime{
+		name:   "unreachable",
+		logger: logr.Discard(),
+		// nothing is listening on this port, so the manager never connects
+		restConfig: &rest.Config{Host: "https://127.0.0.1:1", Timeout: time.Second},
+		options:    &manager.Options{MetricsBindAddress: "0"},
+		initFunc: func(mgr manager.Manager) error {
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := m.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.After(10 * time.Second)
+	for m.Status().FailingSince().IsZero() {
+		select {
+		case <-deadline:
+			t.Fatalf("expect never-connecting daemon to be failing")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	status := m.Status()
+	if !status.Running() || status.RestartCount() == 0 || status.TerminationMessage() == "" {
+		t.Errorf("expect running daemon with restarts and termination message, but got running %v, "+
+			"restarts %v, message %q", status.Running(), status.RestartCount(), status.TerminationMessage())
+	}
+
+	if err := m.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Status().FailingSince().IsZero() {
+		t.Errorf("expect failing state to be reset after daemon stops")
+	}
+}
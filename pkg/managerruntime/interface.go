@@ -18,6 +18,7 @@ package managerruntime
 
 import (
 	"context"
+	"time"
 
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -26,6 +27,8 @@ import (
 type ManagerRuntime interface {
 	Name() string
 	Manager() manager.Manager
+	// RecordChecked records the time when the status of remote cluster is checked
+	RecordChecked(now time.Time)
 	Daemon
 }
 
@@ -39,6 +42,10 @@ type DaemonStatus interface {
 	Running() bool
 	RestartCount() int32
 	TerminationMessage() string
+	// FailingSince returns when the daemon started failing continuously, zero if it is not failing
+	FailingSince() time.Time
+	// LastChecked returns when the daemon was checked last time, zero if it is never checked
+	LastChecked() time.Time
 }
 
 type DaemonID types.UID
@@ -50,4 +57,15 @@ type DaemonHub interface {
 	Get(id DaemonID) (daemon Daemon, registered bool)
 	Run(id DaemonID) error
 	Stop(id DaemonID) error
+	Snapshot() []DaemonSnapshot
+}
+
+// DaemonSnapshot is the read-only state of a registered daemon for diagnostics.
+type DaemonSnapshot struct {
+	ID                 DaemonID   `json:"id"`
+	Name               string     `json:"name,omitempty"`
+	Running            bool       `json:"running"`
+	RestartCount       int32      `json:"restartCount"`
+	TerminationMessage string     `json:"terminationMessage,omitempty"`
+	LastChecked        *time.Time `json:"lastChecked,omitempty"`
 }
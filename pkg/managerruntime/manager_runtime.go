@@ -62,11 +62,12 @@ func (m *managerRuntime) Run(ctx context.Context) (err error) {
 	m.Lock()
 
 	if m.running {
+		m.Unlock()
 		return fmt.Errorf("runtime is running, can not run again")
 	}
 
 	m.ctx, m.cancelFunc = context.WithCancel(ctx)
-	m.running, m.restartCount, m.terminationMessage = true, 0, ""
+	m.running, m.restartCount, m.terminationMessage, m.failingSince = true, 0, "", time.Time{}
 
 	m.Unlock()
 
@@ -77,16 +78,16 @@ func (m *managerRuntime) Run(ctx context.Context) (err error) {
 		)
 		if newManager, err = manager.New(m.restConfig, *m.options); err != nil {
 			m.logger.Error(err, "unable to create manager")
-			m.restartCount++
-			m.terminationMessage = err.Error()
+			m.Lock()
+			m.recordFailure(err, time.Now())
 			m.Unlock()
 			return
 		}
 
 		if err = m.initFunc(newManager); err != nil {
 			m.logger.Error(err, "unable to init manager")
-			m.restartCount++
-			m.terminationMessage = err.Error()
+			m.Lock()
+			m.recordFailure(err, time.Now())
 			m.Unlock()
 			return
 		}
@@ -95,12 +96,20 @@ func (m *managerRuntime) Run(ctx context.Context) (err error) {
 		m.mgr = newManager
 		m.Unlock()
 
+		// the daemon is not failing any more once the manager connects to cluster and caches are synced
+		go func() {
+			if newManager.GetCache().WaitForCacheSync(ctx) {
+				m.Lock()
+				m.failingSince = time.Time{}
+				m.Unlock()
+			}
+		}()
+
 		m.logger.Info("starting daemon")
 		if err = m.mgr.Start(ctx); err != nil {
 			m.logger.Error(err, "daemon is exiting")
 			m.Lock()
-			m.restartCount++
-			m.terminationMessage = err.Error()
+			m.recordFailure(err, time.Now())
 			m.Unlock()
 
 		}
@@ -110,6 +119,13 @@ func (m *managerRuntime) Run(ctx context.Context) (err error) {
 	return nil
 }
 
+func (m *managerRuntime) RecordChecked(now time.Time) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.lastChecked = now
+}
+
 func (m *managerRuntime) Stop() error {
 	m.Lock()
 	defer m.Unlock()
@@ -119,7 +135,7 @@ func (m *managerRuntime) Stop() error {
 	}
 
 	m.cancelFunc()
-	m.running, m.restartCount, m.terminationMessage = false, 0, ""
+	m.running, m.restartCount, m.terminationMessage, m.failingSince = false, 0, "", time.Time{}
 
 	m.logger.Info("stopping daemon")
 	return nil
@@ -133,6 +149,8 @@ func (m *managerRuntime) Status() DaemonStatus {
 		running:            m.running,
 		restartCount:       m.restartCount,
 		terminationMessage: m.terminationMessage,
+		failingSince:       m.failingSince,
+		lastChecked:        m.lastChecked,
 	}
 }
 
@@ -27,6 +27,15 @@ func init() {
 		SubnetIPUsageGauge,
 		IPAllocationPeriodSummary,
 		RemoteClusterStatusCheckDuration,
+		ExcludeIPBlockRouteGauge,
+		ExcludeIPBlockRouteOperationCounter,
+		DualStackRouteInconsistencyGauge,
+		IPInstanceLackingRoutesGauge,
+		SysctlReappliedCounter,
+		OverlappedSubnetGauge,
+		RouteTableInUseGauge,
+		RouteTableExhaustedCounter,
+		InvalidPriorityRuleGauge,
 	)
 }
 
@@ -92,3 +101,96 @@ var RemoteClusterStatusCheckDuration = prometheus.NewHistogramVec(
 		"clusterName",
 	},
 )
+
+const (
+	RouteAddOperation    = "add"
+	RouteDeleteOperation = "delete"
+)
+
+var ExcludeIPBlockRouteGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "exclude_ip_block_route_count",
+		Help: "the number of exclude ip block routes of different subnets in route tables",
+	},
+	[]string{
+		"subnet",
+		"table",
+		"ipFamily",
+	},
+)
+
+var ExcludeIPBlockRouteOperationCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "exclude_ip_block_route_operation_total",
+		Help: "the count of exclude ip block route operations in route tables",
+	},
+	[]string{
+		"table",
+		"ipFamily",
+		"operation",
+	},
+)
+
+var DualStackRouteInconsistencyGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "dual_stack_route_inconsistent_network_count",
+		Help: "the number of dual-stack networks whose subnet rules are programmed for only one ip family",
+	},
+)
+
+var IPInstanceLackingRoutesGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "ip_instance_lacking_routes_count",
+		Help: "the number of local ip instances whose subnet policy rules or routes are not programmed",
+	},
+)
+
+var SysctlReappliedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "sysctl_reapplied_total",
+		Help: "the count of sysctl parameters re-applied after drifting from the configured values",
+	},
+	[]string{
+		"sysctl",
+	},
+)
+
+var OverlappedSubnetGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "overlapped_subnet_pair_count",
+		Help: "the number of local subnet pairs whose cidrs overlap, pod ips in them are steered by the most specific one",
+	},
+	[]string{
+		"ipFamily",
+	},
+)
+
+var RouteTableInUseGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "route_table_in_use_count",
+		Help: "the number of route tables in the subnet route table range which are not empty",
+	},
+	[]string{
+		"ipFamily",
+	},
+)
+
+var RouteTableExhaustedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "route_table_exhausted_total",
+		Help: "the count of failures to find an empty route table because all the tables in range are in use",
+	},
+	[]string{
+		"ipFamily",
+	},
+)
+
+var InvalidPriorityRuleGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "invalid_priority_rule_count",
+		Help: "the number of managed policy rules whose priorities are out of the band rule priorities are allocated from",
+	},
+	[]string{
+		"ipFamily",
+	},
+)
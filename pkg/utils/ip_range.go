@@ -0,0 +1,552 @@
+/*
+ Copyright 2021 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/mikioh/ipaddr"
+)
+
+type IPRange struct {
+	start net.IP
+	end   net.IP
+}
+
+func CreateIPRange(start, end net.IP) (*IPRange, error) {
+	if start == nil || end == nil {
+		return nil, fmt.Errorf("start and end should not be nil")
+	}
+
+	canonicalStart, canonicalEnd := canonicalIP(start), canonicalIP(end)
+	if canonicalStart == nil || canonicalEnd == nil {
+		return nil, fmt.Errorf("invalid start %v or end %v", start, end)
+	}
+
+	if len(canonicalStart) != len(canonicalEnd) {
+		return nil, fmt.Errorf("start %v and end %v are of different families", start, end)
+	}
+
+	if Cmp(canonicalStart, canonicalEnd) > 0 {
+		return nil, nil
+	}
+
+	return &IPRange{
+		start: canonicalStart,
+		end:   canonicalEnd,
+	}, nil
+}
+
+// Start returns a copy of the first ip address of range.
+func (ir *IPRange) Start() net.IP {
+	return copyIP(ir.start)
+}
+
+// End returns a copy of the last ip address of range.
+func (ir *IPRange) End() net.IP {
+	return copyIP(ir.end)
+}
+
+// String returns the range in form of "start~end".
+func (ir *IPRange) String() string {
+	if ir == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%v~%v", ir.start, ir.end)
+}
+
+func copyIP(ip net.IP) net.IP {
+	if ip == nil {
+		return nil
+	}
+
+	dup := make(net.IP, len(ip))
+	copy(dup, ip)
+	return dup
+}
+
+func (ir *IPRange) TryAddIP(ipAddr net.IP) (success bool) {
+	// a 16-byte form of ipv4 address should not be mixed up with the 4-byte form in range
+	if ipAddr = canonicalIP(ipAddr); ipAddr == nil || len(ipAddr) != len(ir.start) {
+		return false
+	}
+
+	if ipAddr.Equal(PrevIP(ir.start)) {
+		ir.start = ipAddr
+		return true
+	}
+
+	if ipAddr.Equal(NextIP(ir.end)) {
+		ir.end = ipAddr
+		return true
+	}
+
+	if Cmp(ipAddr, ir.start) >= 0 && Cmp(ipAddr, ir.end) <= 0 {
+		// a range exist which includes this ip address
+		return true
+	}
+
+	return false
+}
+
+// canonicalIP returns the 4-byte form of ipv4 address and the 16-byte form of ipv6 address,
+// so that ips of the same family always have the same length, nil is returned for invalid ip.
+func canonicalIP(ip net.IP) net.IP {
+	if ipTo4 := ip.To4(); ipTo4 != nil {
+		return ipTo4
+	}
+	return ip.To16()
+}
+
+// IPRangesIntersect returns true if the two ip ranges have at least one common ip address,
+// ip ranges of different families never intersect.
+func IPRangesIntersect(a, b *IPRange) bool {
+	if a == nil || b == nil {
+		return false
+	}
+
+	if Cmp(a.start, b.end) == -2 {
+		// different families
+		return false
+	}
+
+	return Cmp(a.start, b.end) <= 0 && Cmp(b.start, a.end) <= 0
+}
+
+// CIDRsOverlap returns true if the two cidrs have at least one common ip address.
+func CIDRsOverlap(a, b *net.IPNet) bool {
+	if a == nil || b == nil {
+		return false
+	}
+
+	return IPRangesIntersect(&IPRange{start: a.IP.Mask(a.Mask), end: LastIPOfCIDR(a)},
+		&IPRange{start: b.IP.Mask(b.Mask), end: LastIPOfCIDR(b)})
+}
+
+// ParseIncludedIPRanges parses the included ip ranges of a subnet from its start and end strings,
+// an empty start or end is taken as the first or last ip of cidr.
+func ParseIncludedIPRanges(cidr *net.IPNet, startString, endString string) ([]*IPRange, error) {
+	if len(startString) == 0 && len(endString) == 0 {
+		return nil, nil
+	}
+
+	start, end := cidr.IP, LastIPOfCIDR(cidr)
+	if len(startString) != 0 {
+		if start = net.ParseIP(startString); start == nil {
+			return nil, fmt.Errorf("invalid start ip %v", startString)
+		}
+	}
+	if len(endString) != 0 {
+		if end = net.ParseIP(endString); end == nil {
+			return nil, fmt.Errorf("invalid end ip %v", endString)
+		}
+	}
+
+	ipRange, err := CreateIPRange(start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ip range %v~%v: %v", start, end, err)
+	}
+	if ipRange == nil {
+		return nil, nil
+	}
+
+	return []*IPRange{ipRange}, nil
+}
+
+// ValidateIncludedIPRanges sorts the included ip ranges of a subnet and makes sure they are all
+// in cidr and not overlapped with each other.
+func ValidateIncludedIPRanges(cidr *net.IPNet, includedRanges []*IPRange) error {
+	cidrStart := cidr.IP
+	cidrEnd := LastIPOfCIDR(cidr)
+
+	sort.Slice(includedRanges, func(i, j int) bool {
+		return Cmp(includedRanges[i].start, includedRanges[j].start) < 0
+	})
+
+	for currentIPRangeIndex, currentIPRange := range includedRanges {
+		if Cmp(currentIPRange.start, cidrStart) < 0 || Cmp(currentIPRange.end, cidrEnd) > 0 {
+			return fmt.Errorf("ip range %v~%v is out of cidr %v",
+				currentIPRange.start, currentIPRange.end, cidr)
+		}
+
+		if currentIPRangeIndex < (len(includedRanges)-1) &&
+			Cmp(currentIPRange.end, includedRanges[currentIPRangeIndex+1].start) >= 0 {
+			return fmt.Errorf("ip range is overlapped for range %v~%v and %v~%v",
+				currentIPRange.start, currentIPRange.end,
+				includedRanges[currentIPRangeIndex+1].start, includedRanges[currentIPRangeIndex+1].end)
+		}
+	}
+
+	return nil
+}
+
+// SubtractIPRanges returns the sorted gaps of base range which are not covered by any of minus ranges,
+// overlapped or adjacent minus ranges are merged first. The whole base range is returned if minus is empty.
+func SubtractIPRanges(base *IPRange, minus []*IPRange) ([]*IPRange, error) {
+	if base == nil {
+		return nil, fmt.Errorf("base ip range should not be nil")
+	}
+
+	var intersectedMinus []*IPRange
+	for _, ipRange := range minus {
+		if ipRange == nil {
+			continue
+		}
+		if len(ipRange.start) != len(base.start) {
+			return nil, fmt.Errorf("ip range %v and base ip range %v are of different families", ipRange, base)
+		}
+		if IPRangesIntersect(base, ipRange) {
+			intersectedMinus = append(intersectedMinus, ipRange)
+		}
+	}
+
+	var gaps []*IPRange
+	cursor := base.start
+	for _, ipRange := range mergeIPRanges(intersectedMinus) {
+		if Cmp(ipRange.start, cursor) > 0 {
+			gaps = append(gaps, &IPRange{
+				start: copyIP(cursor),
+				end:   fitIPLength(PrevIP(ipRange.start), len(base.start)),
+			})
+		}
+
+		if Cmp(ipRange.end, base.end) >= 0 {
+			return gaps, nil
+		}
+		cursor = fitIPLength(NextIP(ipRange.end), len(base.start))
+	}
+
+	return append(gaps, &IPRange{start: copyIP(cursor), end: copyIP(base.end)}), nil
+}
+
+// mergeIPRanges sorts ip ranges of the same family and merges the overlapped or adjacent ones, the input
+// ranges are not changed.
+func mergeIPRanges(ipRanges []*IPRange) []*IPRange {
+	sortedRanges := make([]*IPRange, len(ipRanges))
+	copy(sortedRanges, ipRanges)
+	sort.SliceStable(sortedRanges, func(i, j int) bool {
+		return Cmp(sortedRanges[i].start, sortedRanges[j].start) < 0
+	})
+
+	var mergedRanges []*IPRange
+	for _, ipRange := range sortedRanges {
+		if len(mergedRanges) != 0 {
+			last := mergedRanges[len(mergedRanges)-1]
+			if Cmp(ipRange.start, last.end) <= 0 || Cmp(PrevIP(ipRange.start), last.end) == 0 {
+				if Cmp(ipRange.end, last.end) > 0 {
+					last.end = ipRange.end
+				}
+				continue
+			}
+		}
+		mergedRanges = append(mergedRanges, &IPRange{start: ipRange.start, end: ipRange.end})
+	}
+	return mergedRanges
+}
+
+// fitIPLength pads the ip returned by PrevIP/NextIP with leading zeros, which might be shorter
+// than 16 bytes for a small ipv6 address.
+func fitIPLength(ip net.IP, length int) net.IP {
+	if len(ip) >= length {
+		return ip
+	}
+	return append(make(net.IP, length-len(ip)), ip...)
+}
+
+// Translate a subnet range into a series ip block description.
+func FindSubnetExcludeIPBlocks(cidr *net.IPNet, includedRanges []*IPRange, gateway net.IP,
+	excludeIPs []net.IP) ([]*net.IPNet, error) {
+	excludeIPRanges, err := findSubnetExcludeIPRanges(cidr, includedRanges, gateway, excludeIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	var excludeIPBlocks []*net.IPNet
+	for _, ipRange := range excludeIPRanges {
+		excludeIPBlocks = append(excludeIPBlocks, ipRange.splitIPRangeToIPBlocks()...)
+	}
+	sortIPBlocks(excludeIPBlocks)
+
+	return excludeIPBlocks, nil
+}
+
+// SummarizeSubnetExcludeIPBlocks returns the first limit exclude ip blocks of subnet in the same order as
+// FindSubnetExcludeIPBlocks and the total count of them, the blocks beyond limit are only counted.
+func SummarizeSubnetExcludeIPBlocks(cidr *net.IPNet, includedRanges []*IPRange, gateway net.IP,
+	excludeIPs []net.IP, limit int) ([]*net.IPNet, int, error) {
+	excludeIPRanges, err := findSubnetExcludeIPRanges(cidr, includedRanges, gateway, excludeIPs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// merged ranges are sorted and not overlapped, so are the blocks split from them in turn
+	var excludeIPBlocks []*net.IPNet
+	count := 0
+	for _, ipRange := range excludeIPRanges {
+		for nextRangeStart := ipRange.start; nextRangeStart != nil; count++ {
+			var block *net.IPNet
+			block, nextRangeStart = findTheFirstLargestCidr(nextRangeStart, ipRange.end)
+			if count < limit {
+				excludeIPBlocks = append(excludeIPBlocks, block)
+			}
+		}
+	}
+
+	return excludeIPBlocks, count, nil
+}
+
+// findSubnetExcludeIPRanges returns the sorted and merged ip ranges of subnet excluded from allocation.
+func findSubnetExcludeIPRanges(cidr *net.IPNet, includedRanges []*IPRange, gateway net.IP,
+	excludeIPs []net.IP) ([]*IPRange, error) {
+
+	cidrStart := cidr.IP
+	cidrEnd := LastIPOfCIDR(cidr)
+
+	var excludeIPRanges []*IPRange
+
+	// included ranges are sorted by validation
+	if err := ValidateIncludedIPRanges(cidr, includedRanges); err != nil {
+		return nil, err
+	}
+
+	for currentIPRangeIndex, currentIPRange := range includedRanges {
+		if currentIPRangeIndex == 0 {
+			// add [cidrStart, currentRangeStartPrev] to exclude ip ranges
+			currentRangeStartPrev := PrevIP(currentIPRange.start)
+
+			ipRange, err := CreateIPRange(cidrStart, currentRangeStartPrev)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create ip range for %v~%v: %v", cidrStart, currentRangeStartPrev, err)
+			}
+
+			if ipRange != nil {
+				excludeIPRanges = append(excludeIPRanges, ipRange)
+			}
+		}
+
+		var nextRangeStartPrev net.IP
+		if currentIPRangeIndex == len(includedRanges)-1 {
+			nextRangeStartPrev = cidrEnd
+		} else {
+			nextRangeStartPrev = PrevIP(includedRanges[currentIPRangeIndex+1].start)
+		}
+
+		// add [endNext, nextRangeStartPrev] to exclude ip ranges
+		endNext := NextIP(currentIPRange.end)
+
+		ipRange, err := CreateIPRange(endNext, nextRangeStartPrev)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ip range for %v~%v: %v", endNext, nextRangeStartPrev, err)
+		}
+
+		if ipRange != nil {
+			excludeIPRanges = append(excludeIPRanges, ipRange)
+		}
+	}
+
+	// exclude ips are merged in ascending order, so that the result is independent of their input order
+	allExcludedIPs := make([]net.IP, 0, len(excludeIPs)+1)
+	allExcludedIPs = append(allExcludedIPs, excludeIPs...)
+	if gateway != nil {
+		allExcludedIPs = append(allExcludedIPs, gateway)
+	}
+	sort.SliceStable(allExcludedIPs, func(i, j int) bool {
+		return Cmp(allExcludedIPs[i], allExcludedIPs[j]) < 0
+	})
+
+Loop2:
+	for _, ipAddr := range allExcludedIPs {
+		if len(excludeIPRanges) != 0 {
+			for _, ipRange := range excludeIPRanges {
+				if ipRange.TryAddIP(ipAddr) {
+					continue Loop2
+				}
+			}
+		}
+
+		singleIPRange, err := CreateIPRange(ipAddr, ipAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ip range for ip %v: %v", ipAddr, err)
+		}
+		excludeIPRanges = append(excludeIPRanges, singleIPRange)
+	}
+
+	// exclude ranges extended by exclude ips might be overlapped or adjacent, merge them before splitting
+	// to get the fewest blocks
+	return mergeIPRanges(excludeIPRanges), nil
+}
+
+// sortIPBlocks sorts ip blocks of the same family by ip and then by prefix length.
+func sortIPBlocks(ipBlocks []*net.IPNet) {
+	sort.SliceStable(ipBlocks, func(i, j int) bool {
+		if cmp := Cmp(ipBlocks[i].IP, ipBlocks[j].IP); cmp != 0 {
+			return cmp < 0
+		}
+
+		iOnes, _ := ipBlocks[i].Mask.Size()
+		jOnes, _ := ipBlocks[j].Mask.Size()
+		return iOnes < jOnes
+	})
+}
+
+func (ir *IPRange) splitIPRangeToIPBlocks() []*net.IPNet {
+	rangeStart := ir.start
+	rangeEnd := ir.end
+	nextRangeStart := rangeStart
+
+	var ipBlocks []*net.IPNet
+
+	for nextRangeStart != nil {
+		var newBlock *net.IPNet
+		newBlock, nextRangeStart = findTheFirstLargestCidr(nextRangeStart, rangeEnd)
+		ipBlocks = append(ipBlocks, newBlock)
+	}
+
+	return ipBlocks
+}
+
+// SplitRangeToCIDRs converts the ip range [start, end] into the minimal sorted cidr blocks covering exactly
+// the same ips, start and end must be of the same family and start must not be greater than end.
+func SplitRangeToCIDRs(start, end net.IP) ([]*net.IPNet, error) {
+	ipRange, err := CreateIPRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+	if ipRange == nil {
+		return nil, fmt.Errorf("start %v is greater than end %v", start, end)
+	}
+
+	return ipRange.splitIPRangeToIPBlocks(), nil
+}
+
+func calculateIPLastZeroBits(ip net.IP) int {
+	testMaskBits := net.IPv4len * 8
+	if ip.To4() == nil {
+		testMaskBits = net.IPv6len * 8
+	}
+
+	zeroBits := 0
+	for ; !ip.Mask(net.CIDRMask(zeroBits, testMaskBits)).Equal(ip); zeroBits++ {
+	}
+
+	return testMaskBits - zeroBits
+}
+
+func findTheFirstLargestCidr(start, end net.IP) (*net.IPNet, net.IP) {
+	// The max possible cidr size for the start ip to represent.
+	zeroBits := calculateIPLastZeroBits(start)
+	var ipLen = net.IPv4len * 8
+	if start.To4() == nil {
+		ipLen = net.IPv6len * 8
+	}
+
+	minCidrPrefixLen := ipLen - zeroBits
+	maxValidCidrPrefixLen := minCidrPrefixLen
+
+	for {
+		tmpCidr := &net.IPNet{
+			IP:   start,
+			Mask: net.CIDRMask(maxValidCidrPrefixLen, ipLen),
+		}
+
+		tmpCidrEnd := LastIPOfCIDR(tmpCidr)
+
+		if tmpCidrEnd.Equal(end) {
+			return tmpCidr, nil
+		}
+
+		if tmpCidr.Contains(end) {
+			maxValidCidrPrefixLen++
+		} else {
+			return tmpCidr, NextIP(tmpCidrEnd)
+		}
+	}
+}
+
+// LastIPOfCIDR returns the last ip of cidr, unlike LastIP the broadcast address of ipv4 is included.
+func LastIPOfCIDR(cidr *net.IPNet) net.IP {
+	cur := ipaddr.NewCursor([]ipaddr.Prefix{*ipaddr.NewPrefix(cidr)})
+	return cur.Last().IP
+}
+
+// SummarizeEndpointIPs aggregates contiguous endpoint ips into minimal cidr blocks if the count of
+// ips exceeds maxEntries, only the given ips will be covered by the returned cidr blocks.
+func SummarizeEndpointIPs(ips []string, maxEntries int) ([]string, error) {
+	if len(ips) <= maxEntries {
+		return ips, nil
+	}
+
+	var v4IPs, v6IPs []net.IP
+	for _, ipString := range ips {
+		ip := net.ParseIP(ipString)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid endpoint ip %v", ipString)
+		}
+
+		if ip.To4() != nil {
+			v4IPs = append(v4IPs, ip.To4())
+		} else {
+			v6IPs = append(v6IPs, ip)
+		}
+	}
+
+	var summarized []string
+	for _, familyIPs := range [][]net.IP{v4IPs, v6IPs} {
+		for _, ipRange := range mergeContiguousIPs(familyIPs) {
+			for _, block := range ipRange.splitIPRangeToIPBlocks() {
+				summarized = append(summarized, block.String())
+			}
+		}
+	}
+
+	if len(summarized) > maxEntries {
+		return nil, fmt.Errorf("endpoint ips can only be summarized into %v cidr blocks, more than %v",
+			len(summarized), maxEntries)
+	}
+
+	return summarized, nil
+}
+
+// mergeContiguousIPs merges ips of the same family into sorted ip ranges, duplicated ips are ignored.
+func mergeContiguousIPs(ips []net.IP) []*IPRange {
+	if len(ips) == 0 {
+		return nil
+	}
+
+	sort.Slice(ips, func(i, j int) bool {
+		return Cmp(ips[i], ips[j]) < 0
+	})
+
+	ipRanges := []*IPRange{{start: ips[0], end: ips[0]}}
+	for _, ip := range ips[1:] {
+		last := ipRanges[len(ipRanges)-1]
+		if last.end.Equal(ip) {
+			continue
+		}
+
+		if NextIP(last.end).Equal(ip) {
+			last.end = ip
+			continue
+		}
+
+		ipRanges = append(ipRanges, &IPRange{start: ip, end: ip})
+	}
+
+	return ipRanges
+}
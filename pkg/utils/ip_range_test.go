@@ -0,0 +1,988 @@
+/*
+ Copyright 2021 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+)
+
+type TestSubnetSpec struct {
+	cidr           *net.IPNet
+	includedRanges []*IPRange
+	gateway        net.IP
+	excludeIPs     []net.IP
+
+	expectIPBlocks []*net.IPNet
+	lastIP         net.IP
+}
+
+type TestIPSpec struct {
+	addr         net.IP
+	lastZeroBits int
+}
+
+func TestFindSubnetExcludeIPBlocks(t *testing.T) {
+	testCases := []TestSubnetSpec{
+		{
+			cidr: &net.IPNet{
+				IP:   net.ParseIP("192.168.3.0"),
+				Mask: net.CIDRMask(24, 32),
+			},
+			expectIPBlocks: nil,
+		}, {
+			cidr: &net.IPNet{
+				IP:   net.ParseIP("192.168.3.0"),
+				Mask: net.CIDRMask(24, 32),
+			},
+			gateway: net.ParseIP("192.168.3.1"),
+			expectIPBlocks: []*net.IPNet{
+				{
+					IP:   net.ParseIP("192.168.3.1"),
+					Mask: net.CIDRMask(32, 32),
+				},
+			},
+		}, {
+			cidr: &net.IPNet{
+				IP:   net.ParseIP("192.168.3.0"),
+				Mask: net.CIDRMask(24, 32),
+			},
+			gateway: net.ParseIP("192.168.3.1"),
+			includedRanges: []*IPRange{
+				{
+					start: net.ParseIP("192.168.3.100"),
+					end:   net.ParseIP("192.168.3.200"),
+				},
+			},
+			expectIPBlocks: []*net.IPNet{
+				{
+					IP:   net.ParseIP("192.168.3.0"),
+					Mask: net.CIDRMask(26, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.64"),
+					Mask: net.CIDRMask(27, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.96"),
+					Mask: net.CIDRMask(30, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.201"),
+					Mask: net.CIDRMask(32, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.202"),
+					Mask: net.CIDRMask(31, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.204"),
+					Mask: net.CIDRMask(30, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.208"),
+					Mask: net.CIDRMask(28, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.224"),
+					Mask: net.CIDRMask(27, 32),
+				},
+			},
+		}, {
+			cidr: &net.IPNet{
+				IP:   net.ParseIP("192.168.3.0"),
+				Mask: net.CIDRMask(24, 32),
+			},
+			gateway: net.ParseIP("192.168.3.1"),
+			includedRanges: []*IPRange{
+				{
+					start: net.ParseIP("192.168.3.100"),
+					end:   net.ParseIP("192.168.3.150"),
+				}, {
+					start: net.ParseIP("192.168.3.151"),
+					end:   net.ParseIP("192.168.3.200"),
+				},
+			},
+			expectIPBlocks: []*net.IPNet{
+				{
+					IP:   net.ParseIP("192.168.3.0"),
+					Mask: net.CIDRMask(26, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.64"),
+					Mask: net.CIDRMask(27, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.96"),
+					Mask: net.CIDRMask(30, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.201"),
+					Mask: net.CIDRMask(32, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.202"),
+					Mask: net.CIDRMask(31, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.204"),
+					Mask: net.CIDRMask(30, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.208"),
+					Mask: net.CIDRMask(28, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.224"),
+					Mask: net.CIDRMask(27, 32),
+				},
+			},
+		}, {
+			cidr: &net.IPNet{
+				IP:   net.ParseIP("192.168.3.0"),
+				Mask: net.CIDRMask(24, 32),
+			},
+			gateway: net.ParseIP("192.168.3.1"),
+			includedRanges: []*IPRange{
+				{
+					start: net.ParseIP("192.168.3.100"),
+					end:   net.ParseIP("192.168.3.150"),
+				}, {
+					start: net.ParseIP("192.168.3.152"),
+					end:   net.ParseIP("192.168.3.200"),
+				}, {
+					start: net.ParseIP("192.168.3.208"),
+					end:   net.ParseIP("192.168.3.223"),
+				},
+			},
+			expectIPBlocks: []*net.IPNet{
+				{
+					IP:   net.ParseIP("192.168.3.0"),
+					Mask: net.CIDRMask(26, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.64"),
+					Mask: net.CIDRMask(27, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.96"),
+					Mask: net.CIDRMask(30, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.201"),
+					Mask: net.CIDRMask(32, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.202"),
+					Mask: net.CIDRMask(31, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.204"),
+					Mask: net.CIDRMask(30, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.151"),
+					Mask: net.CIDRMask(32, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.224"),
+					Mask: net.CIDRMask(27, 32),
+				},
+			},
+		}, {
+			cidr: &net.IPNet{
+				IP:   net.ParseIP("192.168.3.0"),
+				Mask: net.CIDRMask(24, 32),
+			},
+			gateway: net.ParseIP("192.168.3.1"),
+			includedRanges: []*IPRange{
+				{
+					start: net.ParseIP("192.168.3.100"),
+					end:   net.ParseIP("192.168.3.150"),
+				}, {
+					start: net.ParseIP("192.168.3.151"),
+					end:   net.ParseIP("192.168.3.200"),
+				}, {
+					start: net.ParseIP("192.168.3.208"),
+					end:   net.ParseIP("192.168.3.223"),
+				},
+			},
+			excludeIPs: []net.IP{
+				net.ParseIP("192.168.3.50"),
+				net.ParseIP("192.168.3.120"),
+				net.ParseIP("192.168.3.121"),
+				net.ParseIP("192.168.3.160"),
+				net.ParseIP("192.168.3.207"),
+				net.ParseIP("192.168.3.224"),
+			},
+			expectIPBlocks: []*net.IPNet{
+				{
+					IP:   net.ParseIP("192.168.3.0"),
+					Mask: net.CIDRMask(26, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.64"),
+					Mask: net.CIDRMask(27, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.96"),
+					Mask: net.CIDRMask(30, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.120"),
+					Mask: net.CIDRMask(31, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.160"),
+					Mask: net.CIDRMask(32, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.201"),
+					Mask: net.CIDRMask(32, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.202"),
+					Mask: net.CIDRMask(31, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.204"),
+					Mask: net.CIDRMask(30, 32),
+				}, {
+					IP:   net.ParseIP("192.168.3.224"),
+					Mask: net.CIDRMask(27, 32),
+				},
+			},
+		}, {
+			cidr: &net.IPNet{
+				IP:   net.ParseIP("192.168.3.100"),
+				Mask: net.CIDRMask(32, 32),
+			},
+			excludeIPs: []net.IP{
+				net.ParseIP("192.168.3.100"),
+			},
+			expectIPBlocks: []*net.IPNet{
+				{
+					IP:   net.ParseIP("192.168.3.100"),
+					Mask: net.CIDRMask(32, 32),
+				},
+			},
+		},
+	}
+
+	for index, test := range testCases {
+		ipBlocks, _ := FindSubnetExcludeIPBlocks(test.cidr, test.includedRanges,
+			test.gateway, test.excludeIPs)
+
+		if !blockSliceEqual(ipBlocks, test.expectIPBlocks) {
+			t.Fatalf("failed to parse case %v ip range %v, result ip blocks: %v", index, test.String(), ipBlocks)
+		}
+	}
+}
+
+func TestLastIPOfCIDR(t *testing.T) {
+	testCases := []TestSubnetSpec{
+		{
+			cidr: &net.IPNet{
+				IP:   net.ParseIP("192.168.3.0"),
+				Mask: net.CIDRMask(24, 32),
+			},
+			lastIP: net.ParseIP("192.168.3.255"),
+		}, {
+			cidr: &net.IPNet{
+				IP:   net.ParseIP("2021:23::"),
+				Mask: net.CIDRMask(64, 128),
+			},
+			lastIP: net.ParseIP("2021:23::ffff:ffff:ffff:ffff"),
+		},
+	}
+
+	for index, test := range testCases {
+		lastIP := LastIPOfCIDR(test.cidr)
+
+		if !lastIP.Equal(test.lastIP) {
+			t.Fatalf("failed to parse case %v cidr %v, result last ip: %v", index, test.cidr.String(), lastIP)
+		}
+	}
+}
+
+func TestZeroBits(t *testing.T) {
+	testCases := []TestIPSpec{
+		{
+			addr:         net.ParseIP("192.168.3.0"),
+			lastZeroBits: 8,
+		}, {
+			addr:         net.ParseIP("2021:23::"),
+			lastZeroBits: 96,
+		}, {
+			addr:         net.ParseIP("2021:23::ffff"),
+			lastZeroBits: 0,
+		}, {
+			addr:         net.ParseIP("192.168.3.1"),
+			lastZeroBits: 0,
+		},
+	}
+
+	for index, test := range testCases {
+		lastZeroBits := calculateIPLastZeroBits(test.addr)
+
+		if lastZeroBits != test.lastZeroBits {
+			t.Fatalf("failed to parse case %v addr %v, result last zero bits: %v", index, test.addr, lastZeroBits)
+		}
+	}
+}
+
+func (ts *TestSubnetSpec) String() string {
+	return fmt.Sprintf("cidr: %v, includedIPRanges: %v, gateway: %v, excludeIPs: %v",
+		ts.cidr.String(), ts.includedRanges, ts.gateway.String(), ts.excludeIPs)
+}
+
+func blockSliceEqual(slice1, slice2 []*net.IPNet) bool {
+	if len(slice1) != len(slice2) {
+		return false
+	}
+
+	for _, block := range slice1 {
+		found := false
+		for _, targetBlock := range slice2 {
+			if targetBlock.String() == block.String() {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestSummarizeEndpointIPs(t *testing.T) {
+	testCases := []struct {
+		name       string
+		ips        []string
+		maxEntries int
+		expected   []string
+		expectErr  bool
+	}{
+		{
+			"under threshold",
+			[]string{"10.0.0.3", "10.0.0.1"},
+			2,
+			[]string{"10.0.0.3", "10.0.0.1"},
+			false,
+		},
+		{
+			"contiguous ipv4",
+			[]string{"10.0.0.3", "10.0.0.0", "10.0.0.2", "10.0.0.1", "10.0.0.4"},
+			2,
+			[]string{"10.0.0.0/30", "10.0.0.4/32"},
+			false,
+		},
+		{
+			"duplicated and dual stack",
+			[]string{"10.0.0.0", "10.0.0.1", "10.0.0.1", "fe80::2", "fe80::3"},
+			2,
+			[]string{"10.0.0.0/31", "fe80::2/127"},
+			false,
+		},
+		{
+			"not summarizable",
+			[]string{"10.0.0.1", "10.0.0.3", "10.0.0.5"},
+			2,
+			nil,
+			true,
+		},
+		{
+			"invalid ip",
+			[]string{"10.0.0.1", "10.0.0.2", "foo"},
+			2,
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		summarized, err := SummarizeEndpointIPs(tc.ips, tc.maxEntries)
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("test %s fails: expect error but got nil", tc.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("test %s fails: unexpected error %v", tc.name, err)
+			continue
+		}
+
+		if fmt.Sprint(summarized) != fmt.Sprint(tc.expected) {
+			t.Errorf("test %s fails: expect %v but got %v", tc.name, tc.expected, summarized)
+			continue
+		}
+
+		if len(tc.ips) <= tc.maxEntries {
+			continue
+		}
+
+		// summarized cidr blocks should cover exactly the same ips
+		covered := map[string]bool{}
+		for _, block := range summarized {
+			_, cidr, _ := net.ParseCIDR(block)
+			for ip := cidr.IP; cidr.Contains(ip); ip = NextIP(ip) {
+				covered[ip.String()] = true
+			}
+		}
+
+		unique := map[string]bool{}
+		for _, ip := range tc.ips {
+			unique[net.ParseIP(ip).String()] = true
+			if !covered[net.ParseIP(ip).String()] {
+				t.Errorf("test %s fails: ip %v is not covered by %v", tc.name, ip, summarized)
+			}
+		}
+
+		if len(covered) != len(unique) {
+			t.Errorf("test %s fails: %v ips covered by %v, but expect %v", tc.name, len(covered), summarized, len(unique))
+		}
+	}
+}
+
+func TestIPRangesIntersect(t *testing.T) {
+	testCases := []struct {
+		name      string
+		a         [2]string
+		b         [2]string
+		intersect bool
+	}{
+		{"disjoint", [2]string{"10.0.0.1", "10.0.0.10"}, [2]string{"10.0.0.20", "10.0.0.30"}, false},
+		{"adjacent", [2]string{"10.0.0.1", "10.0.0.10"}, [2]string{"10.0.0.11", "10.0.0.30"}, false},
+		{"touching", [2]string{"10.0.0.1", "10.0.0.10"}, [2]string{"10.0.0.10", "10.0.0.30"}, true},
+		{"nested", [2]string{"10.0.0.1", "10.0.0.100"}, [2]string{"10.0.0.20", "10.0.0.30"}, true},
+		{"partially overlapped", [2]string{"10.0.0.20", "10.0.0.40"}, [2]string{"10.0.0.1", "10.0.0.30"}, true},
+		{"single ip", [2]string{"10.0.0.5", "10.0.0.5"}, [2]string{"10.0.0.1", "10.0.0.30"}, true},
+		{"different families", [2]string{"10.0.0.1", "10.0.0.10"}, [2]string{"fe80::1", "fe80::10"}, false},
+		{"ipv6 nested", [2]string{"fe80::1", "fe80::100"}, [2]string{"fe80::10", "fe80::20"}, true},
+	}
+
+	for _, tc := range testCases {
+		a, _ := CreateIPRange(net.ParseIP(tc.a[0]), net.ParseIP(tc.a[1]))
+		b, _ := CreateIPRange(net.ParseIP(tc.b[0]), net.ParseIP(tc.b[1]))
+
+		if IPRangesIntersect(a, b) != tc.intersect || IPRangesIntersect(b, a) != tc.intersect {
+			t.Errorf("test %s fails: expect intersect %v", tc.name, tc.intersect)
+		}
+	}
+}
+
+func TestCIDRsOverlap(t *testing.T) {
+	testCases := []struct {
+		name    string
+		a       string
+		b       string
+		overlap bool
+	}{
+		{"disjoint", "10.0.0.0/24", "10.0.2.0/24", false},
+		{"adjacent", "10.0.0.0/24", "10.0.1.0/24", false},
+		{"nested", "10.0.0.0/16", "10.0.1.0/24", true},
+		{"same", "10.0.0.0/24", "10.0.0.0/24", true},
+		{"different families", "0.0.0.0/0", "::/0", false},
+	}
+
+	for _, tc := range testCases {
+		_, a, _ := net.ParseCIDR(tc.a)
+		_, b, _ := net.ParseCIDR(tc.b)
+
+		if CIDRsOverlap(a, b) != tc.overlap || CIDRsOverlap(b, a) != tc.overlap {
+			t.Errorf("test %s fails: expect overlap %v", tc.name, tc.overlap)
+		}
+	}
+
+	// host bits of cidr should be ignored
+	unnormalized := &net.IPNet{IP: net.ParseIP("10.0.0.100").To4(), Mask: net.CIDRMask(24, 32)}
+	_, head, _ := net.ParseCIDR("10.0.0.0/28")
+	if !CIDRsOverlap(unnormalized, head) {
+		t.Errorf("expect %v overlaps with %v", unnormalized, head)
+	}
+}
+
+func TestValidateIncludedIPRanges(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cidr      string
+		ranges    [][2]string
+		expectErr bool
+	}{
+		{"no ranges", "10.0.0.0/24", nil, false},
+		{"single range", "10.0.0.0/24", [][2]string{{"10.0.0.10", "10.0.0.20"}}, false},
+		{"whole cidr", "10.0.0.0/24", [][2]string{{"10.0.0.0", "10.0.0.255"}}, false},
+		{"disjoint ranges", "10.0.0.0/24", [][2]string{{"10.0.0.30", "10.0.0.40"}, {"10.0.0.10", "10.0.0.20"}}, false},
+		{"start out of cidr", "10.0.0.0/24", [][2]string{{"10.0.1.0", "10.0.1.20"}}, true},
+		{"end out of cidr", "10.0.0.0/24", [][2]string{{"10.0.0.10", "10.0.1.20"}}, true},
+		{"overlapped ranges", "10.0.0.0/24", [][2]string{{"10.0.0.10", "10.0.0.20"}, {"10.0.0.20", "10.0.0.30"}}, true},
+		{"nested ranges", "10.0.0.0/24", [][2]string{{"10.0.0.10", "10.0.0.100"}, {"10.0.0.20", "10.0.0.30"}}, true},
+		{"ipv6 out of cidr", "fe80::/64", [][2]string{{"fe80::10", "fe80:0:0:1::10"}}, true},
+	}
+
+	for _, tc := range testCases {
+		_, cidr, _ := net.ParseCIDR(tc.cidr)
+
+		var includedRanges []*IPRange
+		for _, r := range tc.ranges {
+			ipRange, _ := CreateIPRange(net.ParseIP(r[0]), net.ParseIP(r[1]))
+			includedRanges = append(includedRanges, ipRange)
+		}
+
+		if err := ValidateIncludedIPRanges(cidr, includedRanges); (err != nil) != tc.expectErr {
+			t.Errorf("test %s fails: expect error %v, got %v", tc.name, tc.expectErr, err)
+		}
+	}
+}
+
+func TestIPRangeWithMixedLengthIPs(t *testing.T) {
+	ip4 := func(s string) net.IP { return net.ParseIP(s).To4() }
+	ip16 := func(s string) net.IP { return net.ParseIP(s).To16() }
+
+	mixed, err := CreateIPRange(ip4("10.0.0.10"), ip16("10.0.0.20"))
+	if err != nil || mixed == nil {
+		t.Fatalf("failed to create ip range from mixed length ips: %v", err)
+	}
+	if len(mixed.start) != net.IPv4len || len(mixed.end) != net.IPv4len {
+		t.Errorf("expect canonical 4-byte range, got %v~%v", []byte(mixed.start), []byte(mixed.end))
+	}
+
+	if ipRange, err := CreateIPRange(ip16("10.0.0.20"), ip4("10.0.0.10")); err != nil || ipRange != nil {
+		t.Errorf("expect nil range for reversed mixed length ips, got %v, %v", ipRange, err)
+	}
+
+	if _, err := CreateIPRange(ip4("10.0.0.10"), net.ParseIP("fd00::1")); err == nil {
+		t.Errorf("expect error for ips of different families")
+	}
+
+	tryAddTests := []struct {
+		ip      net.IP
+		success bool
+		start   string
+		end     string
+	}{
+		{ip16("10.0.0.9"), true, "10.0.0.9", "10.0.0.20"},
+		{ip4("10.0.0.21"), true, "10.0.0.9", "10.0.0.21"},
+		{ip16("10.0.0.15"), true, "10.0.0.9", "10.0.0.21"},
+		{ip16("10.0.0.30"), false, "10.0.0.9", "10.0.0.21"},
+		{net.ParseIP("::ffff:a00:8"), true, "10.0.0.8", "10.0.0.21"},
+	}
+
+	for _, test := range tryAddTests {
+		if success := mixed.TryAddIP(test.ip); success != test.success {
+			t.Errorf("expect adding %v to be %v, got %v", test.ip, test.success, success)
+		}
+		if !mixed.start.Equal(net.ParseIP(test.start)) || !mixed.end.Equal(net.ParseIP(test.end)) {
+			t.Errorf("expect range %v~%v after adding %v, got %v~%v", test.start, test.end, test.ip,
+				mixed.start, mixed.end)
+		}
+		if len(mixed.start) != net.IPv4len || len(mixed.end) != net.IPv4len {
+			t.Errorf("expect range to keep 4-byte ips after adding %v", test.ip)
+		}
+	}
+
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/24")
+	canonicalRange, _ := CreateIPRange(ip4("10.0.0.10"), ip4("10.0.0.200"))
+	mixedRange, _ := CreateIPRange(ip16("10.0.0.10"), ip4("10.0.0.200"))
+
+	expectBlocks, err := FindSubnetExcludeIPBlocks(cidr, []*IPRange{canonicalRange}, ip4("10.0.0.1"),
+		[]net.IP{ip4("10.0.0.100")})
+	if err != nil {
+		t.Fatalf("failed to find exclude ip blocks: %v", err)
+	}
+
+	blocks, err := FindSubnetExcludeIPBlocks(&net.IPNet{IP: ip16("10.0.0.0"), Mask: cidr.Mask},
+		[]*IPRange{mixedRange}, ip16("10.0.0.1"), []net.IP{ip16("10.0.0.100")})
+	if err != nil {
+		t.Fatalf("failed to find exclude ip blocks with mixed length ips: %v", err)
+	}
+
+	if !blockSliceEqual(expectBlocks, blocks) {
+		t.Errorf("expect exclude ip blocks %v, got %v", expectBlocks, blocks)
+	}
+}
+
+func TestSplitRangeToCIDRs(t *testing.T) {
+	testCases := []struct {
+		name      string
+		start     string
+		end       string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			"ipv4",
+			"10.0.0.1",
+			"10.0.0.10",
+			[]string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/31", "10.0.0.10/32"},
+			false,
+		},
+		{
+			"ipv4 aligned",
+			"10.0.0.0",
+			"10.0.1.255",
+			[]string{"10.0.0.0/23"},
+			false,
+		},
+		{
+			"ipv6",
+			"fd00::1",
+			"fd00::4",
+			[]string{"fd00::1/128", "fd00::2/127", "fd00::4/128"},
+			false,
+		},
+		{
+			"single ipv4",
+			"10.0.0.5",
+			"10.0.0.5",
+			[]string{"10.0.0.5/32"},
+			false,
+		},
+		{
+			"single ipv6",
+			"fd00::5",
+			"fd00::5",
+			[]string{"fd00::5/128"},
+			false,
+		},
+		{
+			"ipv4 in 16-byte form",
+			"::ffff:10.0.0.0",
+			"10.0.0.3",
+			[]string{"10.0.0.0/30"},
+			false,
+		},
+		{
+			"start greater than end",
+			"10.0.0.10",
+			"10.0.0.1",
+			nil,
+			true,
+		},
+		{
+			"different families",
+			"10.0.0.1",
+			"fd00::1",
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		cidrs, err := SplitRangeToCIDRs(net.ParseIP(tc.start), net.ParseIP(tc.end))
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("test %s fails: expect error but got nil", tc.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("test %s fails: unexpected error %v", tc.name, err)
+			continue
+		}
+
+		if fmt.Sprint(cidrs) != fmt.Sprint(tc.expected) {
+			t.Errorf("test %s fails: expect %v but got %v", tc.name, tc.expected, cidrs)
+		}
+	}
+
+	if _, err := SplitRangeToCIDRs(nil, net.ParseIP("10.0.0.1")); err == nil {
+		t.Errorf("expect error for nil start")
+	}
+}
+
+func TestFindSubnetExcludeIPBlocksOrderStable(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.3.0/24")
+
+	newRanges := func(reverse bool) []*IPRange {
+		ranges := []*IPRange{
+			{start: net.ParseIP("192.168.3.10").To4(), end: net.ParseIP("192.168.3.50").To4()},
+			{start: net.ParseIP("192.168.3.100").To4(), end: net.ParseIP("192.168.3.200").To4()},
+		}
+		if reverse {
+			ranges[0], ranges[1] = ranges[1], ranges[0]
+		}
+		return ranges
+	}
+
+	excludeIPs := []net.IP{
+		net.ParseIP("192.168.3.20"),
+		net.ParseIP("192.168.3.52"),
+		net.ParseIP("192.168.3.51"),
+		net.ParseIP("192.168.3.150"),
+	}
+	reversedExcludeIPs := make([]net.IP, len(excludeIPs))
+	for i := range excludeIPs {
+		reversedExcludeIPs[len(excludeIPs)-1-i] = excludeIPs[i]
+	}
+
+	expected, err := FindSubnetExcludeIPBlocks(cidr, newRanges(false), net.ParseIP("192.168.3.1"), excludeIPs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i := 1; i < len(expected); i++ {
+		if Cmp(expected[i-1].IP, expected[i].IP) >= 0 {
+			t.Fatalf("expect ip blocks sorted by ip, but got %v", expected)
+		}
+	}
+
+	for round := 0; round < 3; round++ {
+		ipBlocks, err := FindSubnetExcludeIPBlocks(cidr, newRanges(round%2 == 0), net.ParseIP("192.168.3.1"),
+			reversedExcludeIPs)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if fmt.Sprint(ipBlocks) != fmt.Sprint(expected) {
+			t.Fatalf("round %d: expect %v but got %v", round, expected, ipBlocks)
+		}
+	}
+
+	if !excludeIPs[1].Equal(net.ParseIP("192.168.3.52")) {
+		t.Errorf("expect exclude ips of caller are not reordered, but got %v", excludeIPs)
+	}
+}
+
+func TestSummarizeSubnetExcludeIPBlocks(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.3.0/24")
+	includedRanges := []*IPRange{
+		{start: net.ParseIP("192.168.3.10").To4(), end: net.ParseIP("192.168.3.50").To4()},
+		{start: net.ParseIP("192.168.3.100").To4(), end: net.ParseIP("192.168.3.200").To4()},
+	}
+	excludeIPs := []net.IP{net.ParseIP("192.168.3.20"), net.ParseIP("192.168.3.150")}
+
+	allBlocks, err := FindSubnetExcludeIPBlocks(cidr, includedRanges, net.ParseIP("192.168.3.1"), excludeIPs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, limit := range []int{0, 3, len(allBlocks), len(allBlocks) + 1} {
+		blocks, count, err := SummarizeSubnetExcludeIPBlocks(cidr, includedRanges, net.ParseIP("192.168.3.1"),
+			excludeIPs, limit)
+		if err != nil {
+			t.Fatalf("limit %v: unexpected error: %v", limit, err)
+		}
+
+		if count != len(allBlocks) {
+			t.Errorf("limit %v: expect count %v, but got %v", limit, len(allBlocks), count)
+		}
+
+		expected := allBlocks
+		if limit < len(allBlocks) {
+			expected = allBlocks[:limit]
+		}
+		if fmt.Sprint(blocks) != fmt.Sprint(expected) {
+			t.Errorf("limit %v: expect blocks %v, but got %v", limit, expected, blocks)
+		}
+	}
+}
+
+func TestIPRangeGetters(t *testing.T) {
+	ipRange, err := CreateIPRange(net.ParseIP("192.168.0.10"), net.ParseIP("192.168.0.20"))
+	if err != nil || ipRange == nil {
+		t.Fatalf("failed to create ip range: %v", err)
+	}
+
+	if start := ipRange.Start(); !start.Equal(net.ParseIP("192.168.0.10")) {
+		t.Errorf("expect start 192.168.0.10 but got %v", start)
+	}
+	if end := ipRange.End(); !end.Equal(net.ParseIP("192.168.0.20")) {
+		t.Errorf("expect end 192.168.0.20 but got %v", end)
+	}
+	if str := ipRange.String(); str != "192.168.0.10~192.168.0.20" {
+		t.Errorf("expect string 192.168.0.10~192.168.0.20 but got %v", str)
+	}
+
+	// returned ips are copies which should not change the range
+	start, end := ipRange.Start(), ipRange.End()
+	start[len(start)-1] = 1
+	end[len(end)-1] = 1
+	if str := ipRange.String(); str != "192.168.0.10~192.168.0.20" {
+		t.Errorf("expect range not changed by returned ips but got %v", str)
+	}
+
+	v6Range, err := CreateIPRange(net.ParseIP("fe80::1"), net.ParseIP("fe80::ff"))
+	if err != nil || v6Range == nil {
+		t.Fatalf("failed to create ipv6 ip range: %v", err)
+	}
+	if str := v6Range.String(); str != "fe80::1~fe80::ff" {
+		t.Errorf("expect string fe80::1~fe80::ff but got %v", str)
+	}
+
+	var nilRange *IPRange
+	if str := nilRange.String(); str != "<nil>" {
+		t.Errorf("expect <nil> for nil range but got %v", str)
+	}
+}
+
+func TestSubtractIPRanges(t *testing.T) {
+	newRange := func(start, end string) *IPRange {
+		ipRange, err := CreateIPRange(net.ParseIP(start), net.ParseIP(end))
+		if err != nil || ipRange == nil {
+			t.Fatalf("failed to create ip range %v~%v: %v", start, end, err)
+		}
+		return ipRange
+	}
+
+	testCases := []struct {
+		name      string
+		base      *IPRange
+		minus     []*IPRange
+		expect    []string
+		expectErr bool
+	}{
+		{
+			"empty minus",
+			newRange("192.168.0.0", "192.168.0.255"),
+			nil,
+			[]string{"192.168.0.0~192.168.0.255"},
+			false,
+		},
+		{
+			"minus in the middle",
+			newRange("192.168.0.0", "192.168.0.255"),
+			[]*IPRange{newRange("192.168.0.10", "192.168.0.20")},
+			[]string{"192.168.0.0~192.168.0.9", "192.168.0.21~192.168.0.255"},
+			false,
+		},
+		{
+			"overlapped and adjacent minus in random order",
+			newRange("192.168.0.0", "192.168.0.255"),
+			[]*IPRange{
+				newRange("192.168.0.100", "192.168.0.200"),
+				newRange("192.168.0.21", "192.168.0.30"),
+				newRange("192.168.0.10", "192.168.0.20"),
+				newRange("192.168.0.150", "192.168.0.160"),
+				newRange("192.168.0.25", "192.168.0.40"),
+			},
+			[]string{"192.168.0.0~192.168.0.9", "192.168.0.41~192.168.0.99", "192.168.0.201~192.168.0.255"},
+			false,
+		},
+		{
+			"minus out of and across the bounds of base",
+			newRange("192.168.0.10", "192.168.0.100"),
+			[]*IPRange{
+				newRange("192.168.0.0", "192.168.0.20"),
+				newRange("192.168.0.90", "192.168.1.0"),
+				newRange("192.168.2.0", "192.168.2.10"),
+			},
+			[]string{"192.168.0.21~192.168.0.89"},
+			false,
+		},
+		{
+			"minus covers the whole base",
+			newRange("192.168.0.10", "192.168.0.100"),
+			[]*IPRange{newRange("192.168.0.10", "192.168.0.50"), newRange("192.168.0.51", "192.168.0.100")},
+			nil,
+			false,
+		},
+		{
+			"ipv6",
+			newRange("::1", "::ffff"),
+			[]*IPRange{newRange("::10", "::20"), newRange("fe80::1", "fe80::2")},
+			[]string{"::1~::f", "::21~::ffff"},
+			false,
+		},
+		{
+			"different families",
+			newRange("192.168.0.0", "192.168.0.255"),
+			[]*IPRange{newRange("fe80::1", "fe80::2")},
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range testCases {
+		gaps, err := SubtractIPRanges(test.base, test.minus)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("%s: expect error but got %v", test.name, gaps)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		var result []string
+		for _, gap := range gaps {
+			result = append(result, gap.String())
+			if len(gap.start) != len(test.base.start) || len(gap.end) != len(test.base.start) {
+				t.Errorf("%s: expect gap %v of the same length with base", test.name, gap)
+			}
+		}
+		if !reflect.DeepEqual(result, test.expect) {
+			t.Errorf("%s: expect %v but got %v", test.name, test.expect, result)
+		}
+	}
+
+	if _, err := SubtractIPRanges(nil, nil); err == nil {
+		t.Errorf("expect error for nil base range")
+	}
+}
+
+func TestFindSubnetExcludeIPBlocksMerged(t *testing.T) {
+	newRange := func(start, end string) *IPRange {
+		ipRange, err := CreateIPRange(net.ParseIP(start), net.ParseIP(end))
+		if err != nil || ipRange == nil {
+			t.Fatalf("failed to create ip range %v~%v: %v", start, end, err)
+		}
+		return ipRange
+	}
+
+	testCases := []struct {
+		name           string
+		cidr           string
+		includedRanges []*IPRange
+		gateway        net.IP
+		excludeIPs     []net.IP
+		expect         string
+	}{
+		{
+			// exclude ranges 10.0.0.0~10.0.0.8 and 10.0.0.9~10.0.0.15 are adjacent after adding 10.0.0.8
+			"ipv4 adjacent exclude ranges",
+			"10.0.0.0/24",
+			[]*IPRange{newRange("10.0.0.8", "10.0.0.8"), newRange("10.0.0.16", "10.0.0.255")},
+			nil,
+			[]net.IP{net.ParseIP("10.0.0.8")},
+			"[10.0.0.0/28]",
+		},
+		{
+			// exclude ranges 10.0.0.16~10.0.0.23 and 10.0.0.24~10.0.0.31 are coalesced into an aligned block
+			"ipv4 aligned sibling blocks",
+			"10.0.0.0/24",
+			[]*IPRange{newRange("10.0.0.0", "10.0.0.15"), newRange("10.0.0.24", "10.0.0.24"),
+				newRange("10.0.0.32", "10.0.0.255")},
+			nil,
+			[]net.IP{net.ParseIP("10.0.0.24")},
+			"[10.0.0.16/28]",
+		},
+		{
+			"ipv4 with gateway and exclude ips",
+			"10.0.0.0/24",
+			[]*IPRange{newRange("10.0.0.1", "10.0.0.3"), newRange("10.0.0.5", "10.0.0.254")},
+			net.ParseIP("10.0.0.1"),
+			[]net.IP{net.ParseIP("10.0.0.3"), net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.5"),
+				net.ParseIP("10.0.0.6"), net.ParseIP("10.0.0.7")},
+			"[10.0.0.0/29 10.0.0.255/32]",
+		},
+		{
+			"ipv6 adjacent exclude ranges",
+			"fd00::/120",
+			[]*IPRange{newRange("fd00::8", "fd00::8"), newRange("fd00::10", "fd00::ff")},
+			nil,
+			[]net.IP{net.ParseIP("fd00::8")},
+			"[fd00::/124]",
+		},
+	}
+
+	for _, test := range testCases {
+		_, cidr, _ := net.ParseCIDR(test.cidr)
+		ipBlocks, err := FindSubnetExcludeIPBlocks(cidr, test.includedRanges, test.gateway, test.excludeIPs)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if result := fmt.Sprint(ipBlocks); result != test.expect {
+			t.Errorf("%s: expect %v but got %v", test.name, test.expect, result)
+		}
+	}
+}
@@ -49,3 +49,18 @@ func DeepEqualStringSlice(a []string, b []string) bool {
 func DeepCopyStringSlice(in []string) []string {
 	return append(in[:0:0], in...)
 }
+
+// SortedUniqueStrings returns a sorted copy of in without duplicated items, a nil or empty input is
+// kept as it is.
+func SortedUniqueStrings(in []string) []string {
+	out := DeepCopyStringSlice(in)
+	sort.Strings(out)
+
+	unique := out[:0]
+	for i, item := range out {
+		if i == 0 || item != out[i-1] {
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
@@ -144,3 +144,38 @@ func TestDeepCopyStringSlice(t *testing.T) {
 		})
 	}
 }
+
+func TestSortedUniqueStrings(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		out  []string
+	}{
+		{
+			"nil",
+			nil,
+			nil,
+		},
+		{
+			"empty",
+			[]string{},
+			[]string{},
+		},
+		{
+			"unordered with duplicates",
+			[]string{"c", "a", "b", "a", "c"},
+			[]string{"a", "b", "c"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := DeepCopyStringSlice(test.in)
+			if !reflect.DeepEqual(SortedUniqueStrings(test.in), test.out) {
+				t.Errorf("test %s fails", test.name)
+			}
+			if !reflect.DeepEqual(in, test.in) {
+				t.Errorf("test %s fails, input is changed", test.name)
+			}
+		})
+	}
+}
@@ -39,6 +39,9 @@ type Handler struct {
 	Decoder *admission.Decoder
 	Cache   cache.Cache
 	Client  client.Client
+
+	// if subnets and remote subnets are indexed by cidr
+	rangeIndexed bool
 }
 
 func NewHandler() *Handler {
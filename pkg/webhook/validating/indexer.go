@@ -0,0 +1,148 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package validating
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	multiclusterv1 "github.com/alibaba/hybridnet/pkg/apis/multicluster/v1"
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+	"github.com/alibaba/hybridnet/pkg/feature"
+)
+
+const (
+	// indexerFieldRangeCIDR indexes subnets and remote subnets by the canonical form of their cidr
+	indexerFieldRangeCIDR = "spec.range.cidr"
+
+	// indexerFieldRangeSuperCIDRs indexes subnets and remote subnets by all the cidrs containing their cidr,
+	// including the cidr itself
+	indexerFieldRangeSuperCIDRs = "spec.range.superCIDRs"
+)
+
+// InitIndexers registers the cidr indexers of subnets and remote subnets, so that overlapped ranges can be found
+// by cidr lookups rather than scanning all the objects. The linear scan is still used if it's not called.
+func (h *Handler) InitIndexers(ctx context.Context, indexer client.FieldIndexer) error {
+	// remote subnets are only validated with multi-cluster feature, whose crd might not exist otherwise
+	if !feature.MultiClusterEnabled() {
+		return nil
+	}
+
+	for _, obj := range []client.Object{&networkingv1.Subnet{}, &multiclusterv1.RemoteSubnet{}} {
+		if err := indexer.IndexField(ctx, obj, indexerFieldRangeCIDR, indexRangeCIDR); err != nil {
+			return fmt.Errorf("failed to index %T by range cidr: %v", obj, err)
+		}
+		if err := indexer.IndexField(ctx, obj, indexerFieldRangeSuperCIDRs, indexRangeSuperCIDRs); err != nil {
+			return fmt.Errorf("failed to index %T by range super cidrs: %v", obj, err)
+		}
+	}
+
+	h.rangeIndexed = true
+	return nil
+}
+
+func addressRangeOf(obj client.Object) *networkingv1.AddressRange {
+	switch o := obj.(type) {
+	case *networkingv1.Subnet:
+		return &o.Spec.Range
+	case *multiclusterv1.RemoteSubnet:
+		return &o.Spec.Range
+	default:
+		return nil
+	}
+}
+
+func indexRangeCIDR(obj client.Object) []string {
+	addressRange := addressRangeOf(obj)
+	if addressRange == nil {
+		return nil
+	}
+
+	_, cidr, err := net.ParseCIDR(addressRange.CIDR)
+	if err != nil {
+		return nil
+	}
+	return []string{cidr.String()}
+}
+
+func indexRangeSuperCIDRs(obj client.Object) []string {
+	addressRange := addressRangeOf(obj)
+	if addressRange == nil {
+		return nil
+	}
+
+	_, cidr, err := net.ParseCIDR(addressRange.CIDR)
+	if err != nil {
+		return nil
+	}
+
+	ones, _ := cidr.Mask.Size()
+	return superCIDRKeys(cidr, ones)
+}
+
+// superCIDRKeys returns the canonical forms of cidrs containing cidr whose prefix length is not greater than
+// maxOnes, from the shortest prefix to the longest.
+func superCIDRKeys(cidr *net.IPNet, maxOnes int) []string {
+	_, bits := cidr.Mask.Size()
+
+	keys := make([]string, 0, maxOnes+1)
+	for ones := 0; ones <= maxOnes; ones++ {
+		mask := net.CIDRMask(ones, bits)
+		keys = append(keys, (&net.IPNet{IP: cidr.IP.Mask(mask), Mask: mask}).String())
+	}
+	return keys
+}
+
+// listCIDROverlappedSubnets lists the subnets and remote subnets whose cidr contains or is contained by the cidr of
+// address range by indexes, ranges are not checked. False is returned if the cidr is invalid.
+func listCIDROverlappedSubnets(ctx context.Context, reader client.Reader, addressRange *networkingv1.AddressRange) (
+	[]networkingv1.Subnet, []multiclusterv1.RemoteSubnet, bool, error) {
+	_, cidr, err := net.ParseCIDR(addressRange.CIDR)
+	if err != nil {
+		return nil, nil, false, nil
+	}
+
+	ones, _ := cidr.Mask.Size()
+
+	// the ones contained by cidr (including the same one) are indexed by cidr as one of their super cidrs,
+	// and the ones containing cidr are indexed by one of its super cidrs
+	lookups := []client.MatchingFields{{indexerFieldRangeSuperCIDRs: cidr.String()}}
+	for _, key := range superCIDRKeys(cidr, ones-1) {
+		lookups = append(lookups, client.MatchingFields{indexerFieldRangeCIDR: key})
+	}
+
+	var subnets []networkingv1.Subnet
+	var remoteSubnets []multiclusterv1.RemoteSubnet
+	for _, lookup := range lookups {
+		subnetList := &networkingv1.SubnetList{}
+		if err := reader.List(ctx, subnetList, lookup); err != nil {
+			return nil, nil, false, err
+		}
+		subnets = append(subnets, subnetList.Items...)
+
+		remoteSubnetList := &multiclusterv1.RemoteSubnetList{}
+		if err := reader.List(ctx, remoteSubnetList, lookup); err != nil {
+			return nil, nil, false, err
+		}
+		remoteSubnets = append(remoteSubnets, remoteSubnetList.Items...)
+	}
+
+	return subnets, remoteSubnets, true, nil
+}
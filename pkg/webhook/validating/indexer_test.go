@@ -0,0 +1,247 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package validating
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	multiclusterv1 "github.com/alibaba/hybridnet/pkg/apis/multicluster/v1"
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+// fakeFieldIndexer records the index functions registered.
+type fakeFieldIndexer struct {
+	indexFuncs map[string]map[string]client.IndexerFunc
+}
+
+func (f *fakeFieldIndexer) IndexField(_ context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	kind := reflect.TypeOf(obj).String()
+	if f.indexFuncs[kind] == nil {
+		f.indexFuncs[kind] = map[string]client.IndexerFunc{}
+	}
+	f.indexFuncs[kind][field] = extractValue
+	return nil
+}
+
+// indexedClient serves List like the cache of manager, objects are looked up by the registered indexes if
+// fields are matched, and the objects returned are counted.
+type indexedClient struct {
+	client.Client
+	stores   map[string]toolscache.Indexer
+	returned int
+}
+
+func newIndexedClient(indexFuncs map[string]map[string]client.IndexerFunc, objs ...client.Object) *indexedClient {
+	c := &indexedClient{stores: map[string]toolscache.Indexer{}}
+	for kind, funcs := range indexFuncs {
+		indexers := toolscache.Indexers{}
+		for field, extractValue := range funcs {
+			extractValue := extractValue
+			indexers["field:"+field] = func(obj interface{}) ([]string, error) {
+				return extractValue(obj.(client.Object)), nil
+			}
+		}
+		c.stores[kind] = toolscache.NewIndexer(toolscache.MetaNamespaceKeyFunc, indexers)
+	}
+
+	for _, obj := range objs {
+		_ = c.stores[reflect.TypeOf(obj).String()].Add(obj)
+	}
+	return c
+}
+
+func (c *indexedClient) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+
+	var store toolscache.Indexer
+	switch list.(type) {
+	case *networkingv1.SubnetList:
+		store = c.stores[reflect.TypeOf(&networkingv1.Subnet{}).String()]
+	case *multiclusterv1.RemoteSubnetList:
+		store = c.stores[reflect.TypeOf(&multiclusterv1.RemoteSubnet{}).String()]
+	default:
+		return fmt.Errorf("unexpected list type %T", list)
+	}
+
+	objs := store.List()
+	if listOpts.FieldSelector != nil {
+		requirements := listOpts.FieldSelector.Requirements()
+		var err error
+		if objs, err = store.ByIndex("field:"+requirements[0].Field, requirements[0].Value); err != nil {
+			return err
+		}
+	}
+	c.returned += len(objs)
+
+	for _, obj := range objs {
+		switch l := list.(type) {
+		case *networkingv1.SubnetList:
+			l.Items = append(l.Items, *obj.(*networkingv1.Subnet))
+		case *multiclusterv1.RemoteSubnetList:
+			l.Items = append(l.Items, *obj.(*multiclusterv1.RemoteSubnet))
+		}
+	}
+	return nil
+}
+
+func TestSuperCIDRKeys(t *testing.T) {
+	subnet := &networkingv1.Subnet{Spec: networkingv1.SubnetSpec{
+		Range: networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: "10.1.2.0/24"},
+	}}
+
+	keys := indexRangeSuperCIDRs(subnet)
+	if len(keys) != 25 || keys[0] != "0.0.0.0/0" || keys[8] != "10.0.0.0/8" || keys[24] != "10.1.2.0/24" {
+		t.Errorf("unexpected super cidr keys %v", keys)
+	}
+
+	if keys := indexRangeCIDR(subnet); !reflect.DeepEqual(keys, []string{"10.1.2.0/24"}) {
+		t.Errorf("unexpected cidr keys %v", keys)
+	}
+
+	v6Keys := superCIDRKeys(mustParseCIDR(t, "fd00:1::/64"), 64)
+	if len(v6Keys) != 65 || v6Keys[16] != "fd00::/16" || v6Keys[64] != "fd00:1::/64" {
+		t.Errorf("unexpected ipv6 super cidr keys %v", v6Keys)
+	}
+
+	invalid := &networkingv1.Subnet{Spec: networkingv1.SubnetSpec{
+		Range: networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: "invalid"},
+	}}
+	if keys := indexRangeSuperCIDRs(invalid); keys != nil {
+		t.Errorf("expect no keys for invalid cidr but got %v", keys)
+	}
+}
+
+func TestRemoteSubnetValidationWithIndexers(t *testing.T) {
+	if err := utilfeature.DefaultMutableFeatureGate.Set("MultiCluster=true"); err != nil {
+		t.Fatalf("failed to enable multi-cluster feature: %v", err)
+	}
+	defer func() {
+		_ = utilfeature.DefaultMutableFeatureGate.Set("MultiCluster=false")
+	}()
+
+	scheme := runtime.NewScheme()
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to add scheme: %v", err)
+	}
+	if err := multiclusterv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to add scheme: %v", err)
+	}
+
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatalf("failed to create decoder: %v", err)
+	}
+
+	handler := &Handler{Decoder: decoder}
+	indexer := &fakeFieldIndexer{indexFuncs: map[string]map[string]client.IndexerFunc{}}
+	if err := handler.InitIndexers(context.Background(), indexer); err != nil {
+		t.Fatalf("failed to init indexers: %v", err)
+	}
+	if !handler.rangeIndexed || len(indexer.indexFuncs) != 2 {
+		t.Fatalf("expect subnets and remote subnets indexed, got %v", indexer.indexFuncs)
+	}
+
+	// 2500 local subnets in 10.0.0.0/8 and 2500 remote subnets in 11.0.0.0/8
+	const count = 2500
+	var objs []client.Object
+	for i := 0; i < count; i++ {
+		objs = append(objs, &networkingv1.Subnet{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("local-%d", i)},
+			Spec: networkingv1.SubnetSpec{
+				Range: networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: fmt.Sprintf("10.%d.%d.0/24", i/256, i%256)},
+			},
+		})
+		objs = append(objs, newTestRemoteSubnet(fmt.Sprintf("remote-%d", i), fmt.Sprintf("11.%d.%d.0/24", i/256, i%256)))
+	}
+
+	newCreateRequest := func(rs *multiclusterv1.RemoteSubnet) *admission.Request {
+		raw, _ := json.Marshal(rs)
+		return &admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+	}
+
+	tests := []struct {
+		name           string
+		remoteSubnet   *multiclusterv1.RemoteSubnet
+		expectAllowed  bool
+		expectReturned int
+	}{
+		{"no overlap", newTestRemoteSubnet("new", "12.0.0.0/24"), true, 0},
+		{"same cidr with local subnet", newTestRemoteSubnet("new", "10.3.5.0/24"), false, 1},
+		{"contained by local subnet", newTestRemoteSubnet("new", "10.3.5.128/25"), false, 1},
+		{"containing remote subnets", newTestRemoteSubnet("new", "11.1.0.0/16"), false, 256},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler.Client = newIndexedClient(indexer.indexFuncs, objs...)
+			handler.rangeIndexed = true
+
+			start := time.Now()
+			resp := RemoteSubnetCreateValidation(context.Background(), newCreateRequest(test.remoteSubnet), handler)
+			indexedLatency := time.Since(start)
+			if resp.Allowed != test.expectAllowed {
+				t.Errorf("expect allowed %v, got %v: %v", test.expectAllowed, resp.Allowed, resp.Result)
+			}
+
+			// only the candidates found by cidr lookups are examined rather than all the subnets
+			if returned := handler.Client.(*indexedClient).returned; returned != test.expectReturned {
+				t.Errorf("expect %v subnets examined with indexes, got %v", test.expectReturned, returned)
+			}
+
+			// fall back to linear scan without indexes
+			handler.Client = newIndexedClient(indexer.indexFuncs, objs...)
+			handler.rangeIndexed = false
+
+			start = time.Now()
+			resp = RemoteSubnetCreateValidation(context.Background(), newCreateRequest(test.remoteSubnet), handler)
+			linearLatency := time.Since(start)
+			if resp.Allowed != test.expectAllowed {
+				t.Errorf("expect allowed %v with linear scan, got %v: %v", test.expectAllowed, resp.Allowed, resp.Result)
+			}
+			if returned := handler.Client.(*indexedClient).returned; returned != 2*count {
+				t.Errorf("expect %v subnets examined with linear scan, got %v", 2*count, returned)
+			}
+
+			t.Logf("admission latency with indexes: %v, with linear scan: %v", indexedLatency, linearLatency)
+		})
+	}
+}
+
+func mustParseCIDR(t *testing.T, s string) *net.IPNet {
+	_, cidr, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatalf("failed to parse cidr %v: %v", s, err)
+	}
+	return cidr
+}
@@ -81,11 +81,6 @@ func NetworkCreateValidation(ctx context.Context, req *admission.Request, handle
 			return webhookutils.AdmissionDeniedWithLog("must have one overlay network at most", logger)
 		}
 
-		// check node selector
-		if network.Spec.NodeSelector != nil && len(network.Spec.NodeSelector) > 0 {
-			return webhookutils.AdmissionDeniedWithLog("must not assign node selector for overlay network", logger)
-		}
-
 		// check net id
 		if network.Spec.NetID == nil {
 			return webhookutils.AdmissionDeniedWithLog("must assign net ID for overlay network", logger)
@@ -151,6 +146,14 @@ func NetworkCreateValidation(ctx context.Context, req *admission.Request, handle
 		return admission.Denied(fmt.Sprintf("unknown network mode %s", networkingv1.GetNetworkMode(network)))
 	}
 
+	// check net id uniqueness, vxlan interface names and bgp AS numbers are derived from net ids
+	if conflicted, conflictedNetwork, err := checkNetIDConflicted(ctx, handler.Client, network); err != nil {
+		return webhookutils.AdmissionErroredWithLog(http.StatusInternalServerError, err, logger)
+	} else if conflicted {
+		return webhookutils.AdmissionDeniedWithLog(fmt.Sprintf("net ID %v is already used by network %v",
+			*network.Spec.NetID, conflictedNetwork), logger)
+	}
+
 	return admission.Allowed("validation pass")
 }
 
@@ -176,9 +179,7 @@ func NetworkUpdateValidation(ctx context.Context, req *admission.Request, handle
 			return admission.Denied("must have node selector for underlay network")
 		}
 	case networkingv1.NetworkTypeOverlay:
-		if newN.Spec.NodeSelector != nil && len(newN.Spec.NodeSelector) > 0 {
-			return webhookutils.AdmissionDeniedWithLog("node selector must not be assigned for overlay network", logger)
-		}
+		// node selector is optional for overlay network, only selected nodes program routes of overlay subnets
 	case networkingv1.NetworkTypeGlobalBGP:
 		if newN.Spec.NodeSelector != nil && len(newN.Spec.NodeSelector) > 0 {
 			return webhookutils.AdmissionDeniedWithLog("node selector must not be assigned for global bgp network", logger)
@@ -207,6 +208,7 @@ func NetworkUpdateValidation(ctx context.Context, req *admission.Request, handle
 		return admission.Denied(fmt.Sprintf("unknown network mode %s", networkingv1.GetNetworkMode(newN)))
 	}
 
+	// net ID uniqueness is only checked on creation, because net ID is immutable
 	if !reflect.DeepEqual(oldN.Spec.NetID, newN.Spec.NetID) {
 		return webhookutils.AdmissionDeniedWithLog("net ID must not be changed", logger)
 	}
@@ -318,3 +320,33 @@ func checkUnderlayNetworkOverlapped(ctx context.Context, c client.Reader, networ
 	}
 	return false, "", nil
 }
+
+// checkNetIDConflicted checks if the net id of a vxlan or bgp network is already used by another network
+// of the same mode.
+func checkNetIDConflicted(ctx context.Context, c client.Reader, network *networkingv1.Network) (bool, string, error) {
+	mode := networkingv1.GetNetworkMode(network)
+	if network.Spec.NetID == nil || (mode != networkingv1.NetworkModeVxlan && mode != networkingv1.NetworkModeBGP) {
+		return false, "", nil
+	}
+
+	networks := &networkingv1.NetworkList{}
+	if err := c.List(ctx, networks); err != nil {
+		return false, "", err
+	}
+
+	for i := range networks.Items {
+		// ignore the network itself
+		if networks.Items[i].Name == network.Name {
+			continue
+		}
+
+		if networkingv1.GetNetworkMode(&networks.Items[i]) != mode || networks.Items[i].Spec.NetID == nil {
+			continue
+		}
+
+		if *networks.Items[i].Spec.NetID == *network.Spec.NetID {
+			return true, networks.Items[i].Name, nil
+		}
+	}
+	return false, "", nil
+}
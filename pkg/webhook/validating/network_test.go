@@ -0,0 +1,175 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package validating
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestCheckNetIDConflicted(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to add scheme: %v", err)
+	}
+
+	newNetwork := func(name string, networkType networkingv1.NetworkType, mode networkingv1.NetworkMode,
+		netID int32) *networkingv1.Network {
+		return &networkingv1.Network{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: networkingv1.NetworkSpec{
+				NetID: &netID,
+				Type:  networkType,
+				Mode:  mode,
+			},
+		}
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+		newNetwork("overlay", networkingv1.NetworkTypeOverlay, networkingv1.NetworkModeVxlan, 4),
+		newNetwork("bgp", networkingv1.NetworkTypeUnderlay, networkingv1.NetworkModeBGP, 65001),
+		newNetwork("vlan", networkingv1.NetworkTypeUnderlay, networkingv1.NetworkModeVlan, 100),
+	).Build()
+
+	tests := []struct {
+		name               string
+		network            *networkingv1.Network
+		expectConflicted   bool
+		expectConflictWith string
+	}{
+		{
+			name:               "duplicate vxlan net id",
+			network:            newNetwork("overlay2", networkingv1.NetworkTypeOverlay, networkingv1.NetworkModeVxlan, 4),
+			expectConflicted:   true,
+			expectConflictWith: "overlay",
+		},
+		{
+			name:               "duplicate bgp AS",
+			network:            newNetwork("bgp2", networkingv1.NetworkTypeUnderlay, networkingv1.NetworkModeBGP, 65001),
+			expectConflicted:   true,
+			expectConflictWith: "bgp",
+		},
+		{
+			name:             "same net id of different mode",
+			network:          newNetwork("bgp3", networkingv1.NetworkTypeUnderlay, networkingv1.NetworkModeBGP, 4),
+			expectConflicted: false,
+		},
+		{
+			name:             "vlan net id is not checked",
+			network:          newNetwork("vlan2", networkingv1.NetworkTypeUnderlay, networkingv1.NetworkModeVlan, 100),
+			expectConflicted: false,
+		},
+		{
+			name:             "update network itself",
+			network:          newNetwork("overlay", networkingv1.NetworkTypeOverlay, networkingv1.NetworkModeVxlan, 4),
+			expectConflicted: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conflicted, conflictedNetwork, err := checkNetIDConflicted(context.TODO(), client, test.network)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if conflicted != test.expectConflicted || conflictedNetwork != test.expectConflictWith {
+				t.Errorf("expect conflicted %v with %q, but got %v with %q", test.expectConflicted,
+					test.expectConflictWith, conflicted, conflictedNetwork)
+			}
+		})
+	}
+}
+
+func TestNetworkUpdateValidationWithConflictedNetID(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to add scheme: %v", err)
+	}
+
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatalf("failed to create decoder: %v", err)
+	}
+
+	newNetwork := func(name string, netID int32, labels map[string]string) *networkingv1.Network {
+		return &networkingv1.Network{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Spec: networkingv1.NetworkSpec{
+				NetID: &netID,
+				Type:  networkingv1.NetworkTypeOverlay,
+				Mode:  networkingv1.NetworkModeVxlan,
+			},
+		}
+	}
+
+	// overlay1 and overlay2 have shared the net id before uniqueness is checked, which should not block updates
+	handler := &Handler{
+		Decoder: decoder,
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+			newNetwork("overlay1", 4, nil),
+			newNetwork("overlay2", 4, nil),
+		).Build(),
+	}
+
+	newRequest := func(oldN, newN *networkingv1.Network) *admission.Request {
+		oldRaw, _ := json.Marshal(oldN)
+		newRaw, _ := json.Marshal(newN)
+		return &admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Update,
+			Object:    runtime.RawExtension{Raw: newRaw},
+			OldObject: runtime.RawExtension{Raw: oldRaw},
+		}}
+	}
+
+	tests := []struct {
+		name          string
+		oldN, newN    *networkingv1.Network
+		expectAllowed bool
+	}{
+		{
+			"net id not changed",
+			newNetwork("overlay1", 4, nil),
+			newNetwork("overlay1", 4, map[string]string{"foo": "bar"}),
+			true,
+		},
+		{
+			"net id changed",
+			newNetwork("overlay1", 4, nil),
+			newNetwork("overlay1", 5, nil),
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := NetworkUpdateValidation(context.Background(), newRequest(test.oldN, test.newN), handler)
+			if resp.Allowed != test.expectAllowed {
+				t.Errorf("expect allowed %v, got %v: %v", test.expectAllowed, resp.Allowed, resp.Result)
+			}
+		})
+	}
+}
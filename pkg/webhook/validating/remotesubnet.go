@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"reflect"
 	"sync"
 
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -55,33 +56,91 @@ func RemoteSubnetCreateValidation(ctx context.Context, req *admission.Request, h
 		return webhookutils.AdmissionErroredWithLog(http.StatusBadRequest, err, logger)
 	}
 
-	var localSubnetList = &networkingv1.SubnetList{}
-	if err = handler.Client.List(ctx, localSubnetList); err != nil {
-		return webhookutils.AdmissionErroredWithLog(http.StatusInternalServerError, err, logger)
+	return validateRemoteSubnetRange(ctx, remoteSubnet, handler)
+}
+
+func RemoteSubnetUpdateValidation(ctx context.Context, req *admission.Request, handler *Handler) admission.Response {
+	rsLock.Lock()
+	defer rsLock.Unlock()
+
+	logger := log.FromContext(ctx)
+
+	var err error
+	oldRS, newRS := &multiclusterv1.RemoteSubnet{}, &multiclusterv1.RemoteSubnet{}
+	if err = handler.Decoder.DecodeRaw(req.Object, newRS); err != nil {
+		return webhookutils.AdmissionErroredWithLog(http.StatusBadRequest, err, logger)
 	}
-	for i := range localSubnetList.Items {
-		var localSubnet = &localSubnetList.Items[i]
-		if networkingv1.Intersect(&remoteSubnet.Spec.Range, &localSubnet.Spec.Range) {
-			return webhookutils.AdmissionDeniedWithLog(fmt.Sprintf("overlay with existing subnet %s", localSubnet.Name), logger)
-		}
+	if err = handler.Decoder.DecodeRaw(req.OldObject, oldRS); err != nil {
+		return webhookutils.AdmissionErroredWithLog(http.StatusBadRequest, err, logger)
 	}
 
-	var remoteSubnetList = &multiclusterv1.RemoteSubnetList{}
-	if err = handler.Client.List(ctx, remoteSubnetList); err != nil {
-		return webhookutils.AdmissionErroredWithLog(http.StatusInternalServerError, err, logger)
+	// updates which don't change range, e.g., of labels, are not blocked by overlaps created before
+	if reflect.DeepEqual(oldRS.Spec.Range, newRS.Spec.Range) {
+		return admission.Allowed("validation pass")
 	}
-	for i := range remoteSubnetList.Items {
-		var comparedRemoteCluster = &remoteSubnetList.Items[i]
-		if networkingv1.Intersect(&remoteSubnet.Spec.Range, &comparedRemoteCluster.Spec.Range) {
-			return webhookutils.AdmissionDeniedWithLog(fmt.Sprintf("overlay with existing remote subnet %s", comparedRemoteCluster.Name), logger)
+
+	return validateRemoteSubnetRange(ctx, newRS, handler)
+}
+
+// validateRemoteSubnetRange denies the remote subnet whose range overlaps with any local subnet or other remote
+// subnet, rsLock should be held by caller. Only the candidates found by cidr indexes are checked if indexed.
+func validateRemoteSubnetRange(ctx context.Context, remoteSubnet *multiclusterv1.RemoteSubnet,
+	handler *Handler) admission.Response {
+	logger := log.FromContext(ctx)
+
+	var localSubnets []networkingv1.Subnet
+	var remoteSubnets []multiclusterv1.RemoteSubnet
+	var indexed bool
+	if handler.rangeIndexed {
+		var err error
+		localSubnets, remoteSubnets, indexed, err = listCIDROverlappedSubnets(ctx, handler.Client, &remoteSubnet.Spec.Range)
+		if err != nil {
+			return webhookutils.AdmissionErroredWithLog(http.StatusInternalServerError, err, logger)
 		}
 	}
 
+	if !indexed {
+		var localSubnetList = &networkingv1.SubnetList{}
+		if err := handler.Client.List(ctx, localSubnetList); err != nil {
+			return webhookutils.AdmissionErroredWithLog(http.StatusInternalServerError, err, logger)
+		}
+
+		var remoteSubnetList = &multiclusterv1.RemoteSubnetList{}
+		if err := handler.Client.List(ctx, remoteSubnetList); err != nil {
+			return webhookutils.AdmissionErroredWithLog(http.StatusInternalServerError, err, logger)
+		}
+		localSubnets, remoteSubnets = localSubnetList.Items, remoteSubnetList.Items
+	}
+
+	if reason := findRemoteSubnetRangeConflict(remoteSubnet, localSubnets, remoteSubnets); reason != "" {
+		return webhookutils.AdmissionDeniedWithLog(reason, logger)
+	}
+
 	return admission.Allowed("validation pass")
 }
 
-func RemoteSubnetUpdateValidation(ctx context.Context, req *admission.Request, handler *Handler) admission.Response {
-	return admission.Allowed("validation pass")
+// findRemoteSubnetRangeConflict returns the reason if range of remote subnet overlaps with any local subnet or
+// other remote subnet, the remote subnet itself is skipped by name. An empty string means no conflict.
+func findRemoteSubnetRangeConflict(remoteSubnet *multiclusterv1.RemoteSubnet, localSubnets []networkingv1.Subnet,
+	remoteSubnets []multiclusterv1.RemoteSubnet) string {
+	for i := range localSubnets {
+		var localSubnet = &localSubnets[i]
+		if networkingv1.Intersect(&remoteSubnet.Spec.Range, &localSubnet.Spec.Range) {
+			return fmt.Sprintf("overlay with existing subnet %s", localSubnet.Name)
+		}
+	}
+
+	for i := range remoteSubnets {
+		var comparedRemoteSubnet = &remoteSubnets[i]
+		if comparedRemoteSubnet.Name == remoteSubnet.Name {
+			continue
+		}
+		if networkingv1.Intersect(&remoteSubnet.Spec.Range, &comparedRemoteSubnet.Spec.Range) {
+			return fmt.Sprintf("overlay with existing remote subnet %s", comparedRemoteSubnet.Name)
+		}
+	}
+
+	return ""
 }
 
 func RemoteSubnetDeleteValidation(ctx context.Context, req *admission.Request, handler *Handler) admission.Response {
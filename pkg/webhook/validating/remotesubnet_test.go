@@ -0,0 +1,150 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package validating
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	multiclusterv1 "github.com/alibaba/hybridnet/pkg/apis/multicluster/v1"
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func newTestRemoteSubnet(name, cidr string) *multiclusterv1.RemoteSubnet {
+	return &multiclusterv1.RemoteSubnet{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: multiclusterv1.RemoteSubnetSpec{
+			Range:       networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: cidr},
+			Type:        networkingv1.NetworkTypeUnderlay,
+			ClusterName: "cluster1",
+		},
+	}
+}
+
+func TestFindRemoteSubnetRangeConflict(t *testing.T) {
+	localSubnets := []networkingv1.Subnet{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "local"},
+			Spec: networkingv1.SubnetSpec{
+				Range: networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: "192.168.0.0/24"},
+			},
+		},
+	}
+	remoteSubnets := []multiclusterv1.RemoteSubnet{
+		*newTestRemoteSubnet("remote1", "10.0.0.0/24"),
+		*newTestRemoteSubnet("remote2", "10.0.1.0/24"),
+	}
+
+	tests := []struct {
+		name         string
+		remoteSubnet *multiclusterv1.RemoteSubnet
+		expectReason string
+	}{
+		{"no overlap", newTestRemoteSubnet("remote3", "10.0.2.0/24"), ""},
+		{"overlap with local subnet", newTestRemoteSubnet("remote3", "192.168.0.0/16"),
+			"overlay with existing subnet local"},
+		{"overlap with another remote subnet", newTestRemoteSubnet("remote3", "10.0.1.128/25"),
+			"overlay with existing remote subnet remote2"},
+		{"remote subnet itself is skipped", newTestRemoteSubnet("remote1", "10.0.0.0/25"), ""},
+		{"updated to overlap with another remote subnet", newTestRemoteSubnet("remote1", "10.0.0.0/23"),
+			"overlay with existing remote subnet remote2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if reason := findRemoteSubnetRangeConflict(test.remoteSubnet, localSubnets, remoteSubnets); reason != test.expectReason {
+				t.Errorf("expect reason %q, got %q", test.expectReason, reason)
+			}
+		})
+	}
+}
+
+func TestRemoteSubnetUpdateValidation(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := networkingv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to add scheme: %v", err)
+	}
+	if err := multiclusterv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to add scheme: %v", err)
+	}
+
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatalf("failed to create decoder: %v", err)
+	}
+
+	// remote1 and remote2 are overlapped before, which should not block updates keeping the range
+	handler := &Handler{
+		Decoder: decoder,
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+			newTestRemoteSubnet("remote1", "10.0.0.0/24"),
+			newTestRemoteSubnet("remote2", "10.0.0.0/23"),
+			newTestRemoteSubnet("remote3", "10.0.4.0/24"),
+		).Build(),
+	}
+
+	newRequest := func(oldRS, newRS *multiclusterv1.RemoteSubnet) *admission.Request {
+		oldRaw, _ := json.Marshal(oldRS)
+		newRaw, _ := json.Marshal(newRS)
+		return &admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Update,
+			Object:    runtime.RawExtension{Raw: newRaw},
+			OldObject: runtime.RawExtension{Raw: oldRaw},
+		}}
+	}
+
+	tests := []struct {
+		name          string
+		oldRS, newRS  *multiclusterv1.RemoteSubnet
+		expectAllowed bool
+	}{
+		{
+			"range not changed",
+			newTestRemoteSubnet("remote1", "10.0.0.0/24"),
+			newTestRemoteSubnet("remote1", "10.0.0.0/24"),
+			true,
+		},
+		{
+			"range changed without overlap",
+			newTestRemoteSubnet("remote3", "10.0.4.0/24"),
+			newTestRemoteSubnet("remote3", "10.0.4.0/23"),
+			true,
+		},
+		{
+			"range changed to overlap with another remote subnet",
+			newTestRemoteSubnet("remote3", "10.0.4.0/24"),
+			newTestRemoteSubnet("remote3", "10.0.0.0/16"),
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := RemoteSubnetUpdateValidation(context.Background(), newRequest(test.oldRS, test.newRS), handler)
+			if resp.Allowed != test.expectAllowed {
+				t.Errorf("expect allowed %v, got %v: %v", test.expectAllowed, resp.Allowed, resp.Result)
+			}
+		})
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"net"
 	"net/http"
 	"reflect"
 	"strings"
@@ -93,8 +94,9 @@ func SubnetCreateValidation(ctx context.Context, req *admission.Request, handler
 			return webhookutils.AdmissionDeniedWithLog("must not set autoNatOutgoing with underlay subnet", logger)
 		}
 
-		if len(subnet.Spec.Range.Gateway) == 0 {
-			return admission.Denied("must assign gateway for a vlan subnet")
+		// gateway of ipv6 vlan subnet can be learned from router advertisements by daemons
+		if len(subnet.Spec.Range.Gateway) == 0 && subnet.Spec.Range.Version != networkingv1.IPv6 {
+			return admission.Denied("must assign gateway for an ipv4 vlan subnet")
 		}
 	case networkingv1.NetworkModeBGP, networkingv1.NetworkModeGlobalBGP:
 		if subnet.Spec.NetID != nil {
@@ -115,6 +117,11 @@ func SubnetCreateValidation(ctx context.Context, req *admission.Request, handler
 		return webhookutils.AdmissionDeniedWithLog(err.Error(), logger)
 	}
 
+	// Included ranges validation, which is the same as daemons do while programming routes
+	if err = validateIncludedRanges(&subnet.Spec.Range); err != nil {
+		return webhookutils.AdmissionDeniedWithLog(err.Error(), logger)
+	}
+
 	// Capacity validation
 	if capacity := networkingv1.CalculateCapacity(&subnet.Spec.Range); capacity.Cmp(big.NewInt(MaxSubnetCapacity)) == 1 {
 		return webhookutils.AdmissionDeniedWithLog(fmt.Sprintf("subnet contains more than %d IPs", MaxSubnetCapacity), logger)
@@ -219,6 +226,11 @@ func SubnetUpdateValidation(ctx context.Context, req *admission.Request, handler
 	if err != nil {
 		return webhookutils.AdmissionDeniedWithLog(err.Error(), logger)
 	}
+
+	// Included ranges validation, included ranges are allowed to be changed
+	if err = validateIncludedRanges(&newS.Spec.Range); err != nil {
+		return webhookutils.AdmissionDeniedWithLog(err.Error(), logger)
+	}
 	if oldS.Spec.Range.Start != newS.Spec.Range.Start {
 		return webhookutils.AdmissionDeniedWithLog("must not change range start", logger)
 	}
@@ -262,3 +274,26 @@ func SubnetDeleteValidation(ctx context.Context, req *admission.Request, handler
 
 	return admission.Allowed("validation pass")
 }
+
+// validateIncludedRanges rejects included ranges of an address range which are out of cidr or overlapped.
+func validateIncludedRanges(ar *networkingv1.AddressRange) error {
+	_, cidr, err := net.ParseCIDR(ar.CIDR)
+	if err != nil {
+		return fmt.Errorf("invalid range CIDR %s", ar.CIDR)
+	}
+
+	includedRanges, err := utils.ParseIncludedIPRanges(cidr, ar.Start, ar.End)
+	if err != nil {
+		return fmt.Errorf("invalid included ranges: %v", err)
+	}
+
+	// an empty start or end is taken as the edge of cidr, which might leave an empty range
+	if (len(ar.Start) != 0 || len(ar.End) != 0) && len(includedRanges) == 0 {
+		return fmt.Errorf("included range %s~%s contains no ip in CIDR %s", ar.Start, ar.End, ar.CIDR)
+	}
+
+	if err = utils.ValidateIncludedIPRanges(cidr, includedRanges); err != nil {
+		return fmt.Errorf("invalid included ranges: %v", err)
+	}
+	return nil
+}
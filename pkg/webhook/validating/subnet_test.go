@@ -0,0 +1,78 @@
+/*
+ Copyright 2022 The Hybridnet Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package validating
+
+import (
+	"testing"
+
+	networkingv1 "github.com/alibaba/hybridnet/pkg/apis/networking/v1"
+)
+
+func TestValidateIncludedRanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		ar        networkingv1.AddressRange
+		expectErr bool
+	}{
+		{
+			name: "no included range",
+			ar:   networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: "192.168.0.0/24"},
+		},
+		{
+			name: "included range in cidr",
+			ar: networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: "192.168.0.0/24",
+				Start: "192.168.0.10", End: "192.168.0.100"},
+		},
+		{
+			name: "only start in cidr",
+			ar: networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: "192.168.0.0/24",
+				Start: "192.168.0.10"},
+		},
+		{
+			name: "start out of cidr",
+			ar: networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: "192.168.0.0/24",
+				Start: "192.168.1.10"},
+			expectErr: true,
+		},
+		{
+			name: "end out of cidr",
+			ar: networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: "192.168.0.0/24",
+				Start: "192.168.0.10", End: "192.168.1.10"},
+			expectErr: true,
+		},
+		{
+			name: "ipv6 end out of cidr",
+			ar: networkingv1.AddressRange{Version: networkingv1.IPv6, CIDR: "fd00::/120",
+				End: "fd00::1:1"},
+			expectErr: true,
+		},
+		{
+			name: "invalid start",
+			ar: networkingv1.AddressRange{Version: networkingv1.IPv4, CIDR: "192.168.0.0/24",
+				Start: "192.168.0"},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := validateIncludedRanges(&test.ar); (err != nil) != test.expectErr {
+				t.Errorf("expect error %v, got %v", test.expectErr, err)
+			}
+		})
+	}
+}